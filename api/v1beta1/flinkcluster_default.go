@@ -17,17 +17,31 @@ limitations under the License.
 package v1beta1
 
 import (
+	"strings"
+	"time"
+
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
 // Sets default values for unspecified FlinkCluster properties.
 func _SetDefault(cluster *FlinkCluster) {
 	_SetImageDefault(&cluster.Spec.Image)
+	_SetFlinkVersionDefault(&cluster.Spec)
 	_SetJobManagerDefault(&cluster.Spec.JobManager)
+	_SetTaskManagerReplicasDefault(&cluster.Spec)
 	_SetTaskManagerDefault(&cluster.Spec.TaskManager)
 	_SetJobDefault(cluster.Spec.Job)
 	_SetHadoopConfigDefault(cluster.Spec.HadoopConfig)
+	_SetSecurityDefault(cluster.Spec.Security)
+	_SetJobManagerProxyDefault(cluster.Spec.JobManagerProxy)
+	_SetNetworkingDefault(cluster.Spec.Networking)
+	_SetServiceAccountDefault(cluster.Spec.ServiceAccount, cluster.Name)
+	_SetTableDefault(cluster.Spec.Table)
+	_SetCheckpointStorageDefault(cluster.Spec.CheckpointStorage, cluster.Name)
+	_SetDiagnosticsBundleDefault(cluster.Spec.DiagnosticsBundle)
+	_SetHealthCheckDefault(cluster.Spec.HealthCheck)
 }
 
 func _SetImageDefault(imageSpec *ImageSpec) {
@@ -36,6 +50,16 @@ func _SetImageDefault(imageSpec *ImageSpec) {
 	}
 }
 
+func _SetFlinkVersionDefault(clusterSpec *FlinkClusterSpec) {
+	if len(clusterSpec.FlinkVersion) > 0 {
+		return
+	}
+	var version, ok = getFlinkVersion(clusterSpec.Image.Name)
+	if ok {
+		clusterSpec.FlinkVersion = version.String()
+	}
+}
+
 func _SetJobManagerDefault(jmSpec *JobManagerSpec) {
 	if jmSpec.Replicas == nil {
 		jmSpec.Replicas = new(int32)
@@ -73,9 +97,45 @@ func _SetJobManagerDefault(jmSpec *JobManagerSpec) {
 		jmSpec.MemoryOffHeapRatio = new(int32)
 		*jmSpec.MemoryOffHeapRatio = 25
 	}
+	if jmSpec.GracefulShutdownTimeout == nil {
+		jmSpec.GracefulShutdownTimeout = &metav1.Duration{
+			Duration: 120 * time.Second,
+		}
+	}
+	_SetResourceRequestsDefault(&jmSpec.Resources, "200m", "1Gi")
+}
+
+// Sets the TaskManager replicas of a job cluster with the parallelism, so that
+// the TaskManagers and the pools provide enough task slots for it, but at
+// least the default of 2. The replicas of the spec are never raised.
+func _SetTaskManagerReplicasDefault(clusterSpec *FlinkClusterSpec) {
+	var tmSpec = &clusterSpec.TaskManager
+	var jobSpec = clusterSpec.Job
+	if tmSpec.Replicas != 0 || tmSpec.MaxReplicas != nil ||
+		jobSpec == nil || jobSpec.Parallelism == nil {
+		return
+	}
+	var slots = getTaskSlotsPerTaskManager(clusterSpec)
+	var required = *jobSpec.Parallelism
+	for _, pool := range tmSpec.Pools {
+		required -= pool.Replicas * slots
+	}
+	required = (required + slots - 1) / slots
+	if required > 2 {
+		tmSpec.Replicas = required
+	}
 }
 
 func _SetTaskManagerDefault(tmSpec *TaskManagerSpec) {
+	// 0 replicas is invalid, so it means unspecified.
+	if tmSpec.Replicas == 0 {
+		tmSpec.Replicas = 2
+	}
+	if tmSpec.SlotsPerTask == nil {
+		tmSpec.SlotsPerTask = new(int32)
+		*tmSpec.SlotsPerTask = 1
+	}
+	_SetResourceRequestsDefault(&tmSpec.Resources, "500m", "2Gi")
 	if tmSpec.Ports.Data == nil {
 		tmSpec.Ports.Data = new(int32)
 		*tmSpec.Ports.Data = 6121
@@ -95,6 +155,44 @@ func _SetTaskManagerDefault(tmSpec *TaskManagerSpec) {
 		tmSpec.MemoryOffHeapRatio = new(int32)
 		*tmSpec.MemoryOffHeapRatio = 25
 	}
+	// Longer than the Kubernetes default of 30s, flushing the state might
+	// take a while.
+	if tmSpec.TerminationGracePeriodSeconds == nil {
+		tmSpec.TerminationGracePeriodSeconds = new(int64)
+		*tmSpec.TerminationGracePeriodSeconds = 60
+	}
+	if tmSpec.MaxReplicas != nil {
+		if tmSpec.MinReplicas == nil {
+			tmSpec.MinReplicas = new(int32)
+			*tmSpec.MinReplicas = 1
+		}
+		if tmSpec.AutoscaleCooldownSeconds == nil {
+			tmSpec.AutoscaleCooldownSeconds = new(int32)
+			*tmSpec.AutoscaleCooldownSeconds = 300
+		}
+	}
+}
+
+// Sets the CPU and memory requests which are specified neither as requests
+// nor as limits. A limit without a request already implies an equal request.
+func _SetResourceRequestsDefault(
+	resources *corev1.ResourceRequirements, cpu string, memory string) {
+	var defaults = corev1.ResourceList{
+		corev1.ResourceCPU:    resource.MustParse(cpu),
+		corev1.ResourceMemory: resource.MustParse(memory),
+	}
+	for name, quantity := range defaults {
+		if _, ok := resources.Requests[name]; ok {
+			continue
+		}
+		if _, ok := resources.Limits[name]; ok {
+			continue
+		}
+		if resources.Requests == nil {
+			resources.Requests = corev1.ResourceList{}
+		}
+		resources.Requests[name] = quantity
+	}
 }
 
 func _SetJobDefault(jobSpec *JobSpec) {
@@ -117,6 +215,32 @@ func _SetJobDefault(jobSpec *JobSpec) {
 		jobSpec.RestartPolicy = new(JobRestartPolicy)
 		*jobSpec.RestartPolicy = JobRestartPolicyNever
 	}
+	if jobSpec.RestartBackoff != nil {
+		if jobSpec.RestartBackoff.InitialBackoffSeconds == 0 {
+			jobSpec.RestartBackoff.InitialBackoffSeconds = 10
+		}
+		if jobSpec.RestartBackoff.BackoffMultiplier == 0 {
+			jobSpec.RestartBackoff.BackoffMultiplier = 2
+		}
+	}
+	if jobSpec.SubmissionRetry != nil {
+		if jobSpec.SubmissionRetry.DeadlineSeconds == 0 {
+			jobSpec.SubmissionRetry.DeadlineSeconds = 300
+		}
+		if jobSpec.SubmissionRetry.InitialBackoffSeconds == 0 {
+			jobSpec.SubmissionRetry.InitialBackoffSeconds = 5
+		}
+		if jobSpec.SubmissionRetry.BackoffMultiplier == 0 {
+			jobSpec.SubmissionRetry.BackoffMultiplier = 2
+		}
+		if jobSpec.SubmissionRetry.MaxBackoffSeconds == 0 {
+			jobSpec.SubmissionRetry.MaxBackoffSeconds = 60
+		}
+	}
+	if jobSpec.CheckpointHealth != nil &&
+		jobSpec.CheckpointHealth.MaxConsecutiveFailures == 0 {
+		jobSpec.CheckpointHealth.MaxConsecutiveFailures = 3
+	}
 	if jobSpec.CleanupPolicy == nil {
 		jobSpec.CleanupPolicy = &CleanupPolicy{
 			AfterJobSucceeds:  CleanupActionDeleteCluster,
@@ -124,6 +248,14 @@ func _SetJobDefault(jobSpec *JobSpec) {
 			AfterJobCancelled: CleanupActionDeleteCluster,
 		}
 	}
+	if len(jobSpec.JarURI) > 0 {
+		if len(jobSpec.JarFile) == 0 && len(jobSpec.PythonScript) == 0 {
+			jobSpec.JarFile = GetDownloadedJarFile(jobSpec.JarURI)
+		}
+		if len(jobSpec.JarDownloaderImage) == 0 {
+			jobSpec.JarDownloaderImage = "google/cloud-sdk"
+		}
+	}
 }
 
 func _SetHadoopConfigDefault(hadoopConfig *HadoopConfig) {
@@ -134,3 +266,123 @@ func _SetHadoopConfigDefault(hadoopConfig *HadoopConfig) {
 		hadoopConfig.MountPath = "/etc/hadoop/conf"
 	}
 }
+
+func _SetSecurityDefault(security *SecuritySpec) {
+	if security == nil {
+		return
+	}
+	if security.SSOEnabled == nil {
+		security.SSOEnabled = new(bool)
+		*security.SSOEnabled = false
+	}
+	if security.OIDCConfig != nil && len(security.OIDCConfig.ProxyImage) == 0 {
+		security.OIDCConfig.ProxyImage = "quay.io/oauth2-proxy/oauth2-proxy:v5.1.0"
+	}
+}
+
+func _SetJobManagerProxyDefault(proxy *ProxySpec) {
+	if proxy == nil {
+		return
+	}
+	if len(proxy.Type) == 0 {
+		proxy.Type = ProxyTypeNginx
+	}
+	if proxy.RateLimitRPM == nil {
+		proxy.RateLimitRPM = new(int32)
+		*proxy.RateLimitRPM = 60
+	}
+	if proxy.RateLimitBurst == nil {
+		proxy.RateLimitBurst = new(int32)
+		*proxy.RateLimitBurst = 10
+	}
+	if proxy.WAF == nil {
+		proxy.WAF = new(bool)
+		*proxy.WAF = true
+	}
+	if len(proxy.Image) == 0 {
+		proxy.Image = "nginx:1.17"
+	}
+}
+
+func _SetNetworkingDefault(networking *NetworkingSpec) {
+	if networking == nil || networking.ServiceMesh == nil ||
+		networking.ServiceMesh.TrafficSplitting == nil {
+		return
+	}
+	var trafficSplitting = networking.ServiceMesh.TrafficSplitting
+	_SetJobDefault(&trafficSplitting.VersionA)
+	_SetJobDefault(&trafficSplitting.VersionB)
+}
+
+func _SetServiceAccountDefault(
+	serviceAccount *ServiceAccountSpec, clusterName string) {
+	if serviceAccount == nil {
+		return
+	}
+	if serviceAccount.Create && len(serviceAccount.Name) == 0 {
+		serviceAccount.Name = clusterName + "-flink"
+	}
+}
+
+func _SetTableDefault(table *TableSpec) {
+	if table == nil {
+		return
+	}
+	if len(table.SQLDialect) == 0 {
+		table.SQLDialect = SQLDialectDefault
+	}
+	if table.SQLDialect == SQLDialectHive && len(table.HiveConnectorJar) == 0 {
+		table.HiveConnectorJar = "/opt/flink/opt/flink-connector-hive.jar"
+	}
+}
+
+func _SetCheckpointStorageDefault(
+	checkpointStorage *CheckpointStorageSpec, clusterName string) {
+	if checkpointStorage == nil {
+		return
+	}
+	if len(checkpointStorage.MountPath) == 0 {
+		checkpointStorage.MountPath = "/checkpoints"
+	}
+	if len(checkpointStorage.StorageClass) == 0 {
+		return
+	}
+	if len(checkpointStorage.PVCName) == 0 {
+		checkpointStorage.PVCName = clusterName + "-checkpoints"
+	}
+	if checkpointStorage.StorageSize.IsZero() {
+		checkpointStorage.StorageSize = resource.MustParse("10Gi")
+	}
+	if len(checkpointStorage.AccessMode) == 0 {
+		checkpointStorage.AccessMode = corev1.ReadWriteMany
+	}
+}
+
+func _SetDiagnosticsBundleDefault(diagnosticsBundle *DiagnosticsBundleSpec) {
+	if diagnosticsBundle == nil {
+		return
+	}
+	// The Cloud SDK image has no aws CLI.
+	if len(diagnosticsBundle.Image) == 0 &&
+		!strings.HasPrefix(diagnosticsBundle.UploadURI, "s3://") {
+		diagnosticsBundle.Image = "google/cloud-sdk"
+	}
+}
+
+func _SetHealthCheckDefault(healthCheck *HealthCheckSpec) {
+	if healthCheck == nil {
+		return
+	}
+	if healthCheck.IntervalSeconds == nil {
+		healthCheck.IntervalSeconds = new(int32)
+		*healthCheck.IntervalSeconds = 30
+	}
+	if healthCheck.FailureThreshold == nil {
+		healthCheck.FailureThreshold = new(int32)
+		*healthCheck.FailureThreshold = 3
+	}
+	if healthCheck.SuccessThreshold == nil {
+		healthCheck.SuccessThreshold = new(int32)
+		*healthCheck.SuccessThreshold = 1
+	}
+}
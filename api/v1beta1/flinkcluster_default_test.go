@@ -18,6 +18,7 @@ package v1beta1
 
 import (
 	"testing"
+	"time"
 
 	"github.com/google/go-cmp/cmp/cmpopts"
 	"k8s.io/apimachinery/pkg/api/resource"
@@ -48,6 +49,7 @@ func TestSetDefault(t *testing.T) {
 	var defaultTmDataPort = int32(6121)
 	var defaultTmRPCPort = int32(6122)
 	var defaultTmQueryPort = int32(6125)
+	var defaultTmSlotsPerTask = int32(1)
 	var defaultJobAllowNonRestoredState = false
 	var defaultJobParallelism = int32(1)
 	var defaultJobNoLoggingToStdout = false
@@ -55,6 +57,10 @@ func TestSetDefault(t *testing.T) {
 	var defatulJobManagerIngressTLSUse = false
 	var defaultMemoryOffHeapRatio = int32(25)
 	var defaultMemoryOffHeapMin = resource.MustParse("600M")
+	var defaultJmGracefulShutdownTimeout = metav1.Duration{
+		Duration: 120 * time.Second,
+	}
+	var defaultTmGracePeriod = int64(60)
 	var expectedCluster = FlinkCluster{
 		TypeMeta:   metav1.TypeMeta{},
 		ObjectMeta: metav1.ObjectMeta{},
@@ -76,23 +82,36 @@ func TestSetDefault(t *testing.T) {
 					Query: &defaultJmQueryPort,
 					UI:    &defaultJmUIPort,
 				},
-				Resources:          corev1.ResourceRequirements{},
-				MemoryOffHeapRatio: &defaultMemoryOffHeapRatio,
-				MemoryOffHeapMin:   defaultMemoryOffHeapMin,
-				Volumes:            nil,
-				VolumeMounts:       nil,
+				Resources: corev1.ResourceRequirements{
+					Requests: corev1.ResourceList{
+						corev1.ResourceCPU:    resource.MustParse("200m"),
+						corev1.ResourceMemory: resource.MustParse("1Gi"),
+					},
+				},
+				MemoryOffHeapRatio:      &defaultMemoryOffHeapRatio,
+				MemoryOffHeapMin:        defaultMemoryOffHeapMin,
+				Volumes:                 nil,
+				VolumeMounts:            nil,
+				GracefulShutdownTimeout: &defaultJmGracefulShutdownTimeout,
 			},
 			TaskManager: TaskManagerSpec{
-				Replicas: 0,
+				Replicas:     2,
+				SlotsPerTask: &defaultTmSlotsPerTask,
 				Ports: TaskManagerPorts{
 					Data:  &defaultTmDataPort,
 					RPC:   &defaultTmRPCPort,
 					Query: &defaultTmQueryPort,
 				},
-				Resources:          corev1.ResourceRequirements{},
-				MemoryOffHeapRatio: &defaultMemoryOffHeapRatio,
-				MemoryOffHeapMin:   defaultMemoryOffHeapMin,
-				Volumes:            nil,
+				Resources: corev1.ResourceRequirements{
+					Requests: corev1.ResourceList{
+						corev1.ResourceCPU:    resource.MustParse("500m"),
+						corev1.ResourceMemory: resource.MustParse("2Gi"),
+					},
+				},
+				MemoryOffHeapRatio:            &defaultMemoryOffHeapRatio,
+				MemoryOffHeapMin:              defaultMemoryOffHeapMin,
+				Volumes:                       nil,
+				TerminationGracePeriodSeconds: &defaultTmGracePeriod,
 			},
 			Job: &JobSpec{
 				AllowNonRestoredState: &defaultJobAllowNonRestoredState,
@@ -131,6 +150,7 @@ func TestSetNonDefault(t *testing.T) {
 	var tmDataPort = int32(8121)
 	var tmRPCPort = int32(8122)
 	var tmQueryPort = int32(8125)
+	var tmSlotsPerTask = int32(2)
 	var jobAllowNonRestoredState = true
 	var jobParallelism = int32(2)
 	var jobNoLoggingToStdout = true
@@ -138,6 +158,21 @@ func TestSetNonDefault(t *testing.T) {
 	var jobManagerIngressTLSUse = true
 	var memoryOffHeapRatio = int32(50)
 	var memoryOffHeapMin = resource.MustParse("600M")
+	var jmGracefulShutdownTimeout = metav1.Duration{Duration: 60 * time.Second}
+	var tmGracePeriod = int64(120)
+	var jmResources = corev1.ResourceRequirements{
+		Requests: corev1.ResourceList{
+			corev1.ResourceCPU:    resource.MustParse("1"),
+			corev1.ResourceMemory: resource.MustParse("4Gi"),
+		},
+	}
+	// Limits imply the requests.
+	var tmResources = corev1.ResourceRequirements{
+		Limits: corev1.ResourceList{
+			corev1.ResourceCPU:    resource.MustParse("2"),
+			corev1.ResourceMemory: resource.MustParse("8Gi"),
+		},
+	}
 	var cluster = FlinkCluster{
 		TypeMeta:   metav1.TypeMeta{},
 		ObjectMeta: metav1.ObjectMeta{},
@@ -159,23 +194,26 @@ func TestSetNonDefault(t *testing.T) {
 					Query: &jmQueryPort,
 					UI:    &jmUIPort,
 				},
-				Resources:          corev1.ResourceRequirements{},
-				MemoryOffHeapRatio: &memoryOffHeapRatio,
-				MemoryOffHeapMin:   memoryOffHeapMin,
-				Volumes:            nil,
-				VolumeMounts:       nil,
+				Resources:               jmResources,
+				MemoryOffHeapRatio:      &memoryOffHeapRatio,
+				MemoryOffHeapMin:        memoryOffHeapMin,
+				Volumes:                 nil,
+				VolumeMounts:            nil,
+				GracefulShutdownTimeout: &jmGracefulShutdownTimeout,
 			},
 			TaskManager: TaskManagerSpec{
-				Replicas: 0,
+				Replicas:     3,
+				SlotsPerTask: &tmSlotsPerTask,
 				Ports: TaskManagerPorts{
 					Data:  &tmDataPort,
 					RPC:   &tmRPCPort,
 					Query: &tmQueryPort,
 				},
-				Resources:          corev1.ResourceRequirements{},
-				MemoryOffHeapRatio: &memoryOffHeapRatio,
-				MemoryOffHeapMin:   memoryOffHeapMin,
-				Volumes:            nil,
+				Resources:                     tmResources,
+				MemoryOffHeapRatio:            &memoryOffHeapRatio,
+				MemoryOffHeapMin:              memoryOffHeapMin,
+				Volumes:                       nil,
+				TerminationGracePeriodSeconds: &tmGracePeriod,
 			},
 			Job: &JobSpec{
 				AllowNonRestoredState: &jobAllowNonRestoredState,
@@ -220,23 +258,26 @@ func TestSetNonDefault(t *testing.T) {
 					Query: &jmQueryPort,
 					UI:    &jmUIPort,
 				},
-				Resources:          corev1.ResourceRequirements{},
-				MemoryOffHeapRatio: &memoryOffHeapRatio,
-				MemoryOffHeapMin:   memoryOffHeapMin,
-				Volumes:            nil,
-				VolumeMounts:       nil,
+				Resources:               jmResources,
+				MemoryOffHeapRatio:      &memoryOffHeapRatio,
+				MemoryOffHeapMin:        memoryOffHeapMin,
+				Volumes:                 nil,
+				VolumeMounts:            nil,
+				GracefulShutdownTimeout: &jmGracefulShutdownTimeout,
 			},
 			TaskManager: TaskManagerSpec{
-				Replicas: 0,
+				Replicas:     3,
+				SlotsPerTask: &tmSlotsPerTask,
 				Ports: TaskManagerPorts{
 					Data:  &tmDataPort,
 					RPC:   &tmRPCPort,
 					Query: &tmQueryPort,
 				},
-				Resources:          corev1.ResourceRequirements{},
-				MemoryOffHeapRatio: &memoryOffHeapRatio,
-				MemoryOffHeapMin:   memoryOffHeapMin,
-				Volumes:            nil,
+				Resources:                     tmResources,
+				MemoryOffHeapRatio:            &memoryOffHeapRatio,
+				MemoryOffHeapMin:              memoryOffHeapMin,
+				Volumes:                       nil,
+				TerminationGracePeriodSeconds: &tmGracePeriod,
 			},
 			Job: &JobSpec{
 				AllowNonRestoredState: &jobAllowNonRestoredState,
@@ -264,3 +305,114 @@ func TestSetNonDefault(t *testing.T) {
 		expectedCluster,
 		cmpopts.IgnoreUnexported(resource.Quantity{}))
 }
+
+func TestSetFlinkVersionDefault(t *testing.T) {
+	var clusterSpec = FlinkClusterSpec{Image: ImageSpec{Name: "flink:1.9.1"}}
+	_SetFlinkVersionDefault(&clusterSpec)
+	assert.Equal(t, clusterSpec.FlinkVersion, "1.9")
+
+	clusterSpec = FlinkClusterSpec{
+		Image:        ImageSpec{Name: "flink:1.9.1"},
+		FlinkVersion: "1.9.1",
+	}
+	_SetFlinkVersionDefault(&clusterSpec)
+	assert.Equal(t, clusterSpec.FlinkVersion, "1.9.1")
+
+	clusterSpec = FlinkClusterSpec{Image: ImageSpec{Name: "flink:latest"}}
+	_SetFlinkVersionDefault(&clusterSpec)
+	assert.Equal(t, clusterSpec.FlinkVersion, "")
+}
+
+func TestSetJobManagerProxyDefault(t *testing.T) {
+	var proxy = ProxySpec{}
+	_SetJobManagerProxyDefault(&proxy)
+	var rateLimitRPM int32 = 60
+	var rateLimitBurst int32 = 10
+	var waf = true
+	assert.DeepEqual(
+		t,
+		proxy,
+		ProxySpec{
+			Type:           ProxyTypeNginx,
+			RateLimitRPM:   &rateLimitRPM,
+			RateLimitBurst: &rateLimitBurst,
+			WAF:            &waf,
+			Image:          "nginx:1.17",
+		})
+}
+
+func TestSetHealthCheckDefault(t *testing.T) {
+	var healthCheck = HealthCheckSpec{Enabled: true}
+	_SetHealthCheckDefault(&healthCheck)
+	var intervalSeconds int32 = 30
+	var failureThreshold int32 = 3
+	var successThreshold int32 = 1
+	assert.DeepEqual(
+		t,
+		healthCheck,
+		HealthCheckSpec{
+			Enabled:          true,
+			IntervalSeconds:  &intervalSeconds,
+			FailureThreshold: &failureThreshold,
+			SuccessThreshold: &successThreshold,
+		})
+}
+
+func TestSetTaskManagerReplicasDefault(t *testing.T) {
+	var parallelism int32 = 7
+	var clusterSpec = FlinkClusterSpec{
+		Job: &JobSpec{Parallelism: &parallelism},
+		FlinkProperties: map[string]string{
+			"taskmanager.numberOfTaskSlots": "2",
+		},
+	}
+	_SetTaskManagerReplicasDefault(&clusterSpec)
+	assert.Equal(t, clusterSpec.TaskManager.Replicas, int32(4))
+
+	// The slots of the pools are counted.
+	clusterSpec.TaskManager.Replicas = 0
+	clusterSpec.TaskManager.Pools = []TaskManagerPoolSpec{
+		{Name: "highmem", Replicas: 1},
+	}
+	_SetTaskManagerReplicasDefault(&clusterSpec)
+	assert.Equal(t, clusterSpec.TaskManager.Replicas, int32(3))
+
+	// The replicas of the spec are not raised.
+	clusterSpec.TaskManager.Replicas = 1
+	_SetTaskManagerReplicasDefault(&clusterSpec)
+	assert.Equal(t, clusterSpec.TaskManager.Replicas, int32(1))
+
+	// The default of 2 applies to lower parallelisms.
+	parallelism = 2
+	clusterSpec.TaskManager.Replicas = 0
+	_SetTaskManagerReplicasDefault(&clusterSpec)
+	assert.Equal(t, clusterSpec.TaskManager.Replicas, int32(0))
+	_SetTaskManagerDefault(&clusterSpec.TaskManager)
+	assert.Equal(t, clusterSpec.TaskManager.Replicas, int32(2))
+}
+
+func TestSetJobJarURIDefault(t *testing.T) {
+	var jobSpec = JobSpec{
+		JarURI: "https://repo.example.com/jobs/wordcount.jar?version=2",
+	}
+	_SetJobDefault(&jobSpec)
+	assert.Equal(t, jobSpec.JarFile, "/opt/flink/job-jar/wordcount.jar")
+	assert.Equal(t, jobSpec.JarDownloaderImage, "google/cloud-sdk")
+}
+
+func TestSetJobSubmissionRetryDefault(t *testing.T) {
+	var jobSpec = JobSpec{
+		JarFile:         "/opt/flink/job/myjob.jar",
+		SubmissionRetry: &JobSubmissionRetry{DeadlineSeconds: 600},
+	}
+	_SetJobDefault(&jobSpec)
+	assert.DeepEqual(
+		t,
+		*jobSpec.SubmissionRetry,
+		JobSubmissionRetry{
+			DeadlineSeconds:       600,
+			InitialBackoffSeconds: 5,
+			BackoffMultiplier:     2,
+			MaxBackoffSeconds:     60,
+		})
+}
@@ -0,0 +1,173 @@
+/*
+Copyright 2019 Google LLC.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1beta1
+
+// ObservedState summarizes the observed components of a cluster, which is
+// the input of DeriveState. The operator fills it from the resources of the
+// cluster in each reconcile, other tools can fill it from their own
+// observations.
+// +kubebuilder:object:generate=false
+type ObservedState struct {
+	// The state recorded in the status of the cluster, empty for a new
+	// cluster.
+	RecordedState string
+
+	// The number of the required components, i.e., the components
+	// requested by the spec, and how many of them are ready. The cluster is
+	// running once they are equal.
+	RequiredComponents      int
+	ReadyRequiredComponents int
+
+	// Whether the job has stopped, and whether it succeeded, failed or was
+	// cancelled.
+	JobStopped   bool
+	JobSucceeded bool
+	JobFailed    bool
+	JobCancelled bool
+
+	// Whether the failed job has reached the restart limit of its restart
+	// backoff.
+	JobRestartLimitReached bool
+
+	// Whether the failed job will be restarted by its restart policy.
+	JobRestartPending bool
+
+	// The cleanup policy of the job, nil stops the cluster once the job has
+	// stopped.
+	CleanupPolicy *CleanupPolicy
+
+	// Whether the cluster failed by the readiness timeout, which has been
+	// extended since.
+	ReadinessTimeoutRetried bool
+
+	// Whether the cluster is requested to be suspended, and whether all its
+	// pods have been terminated.
+	Suspend      bool
+	ScaledToZero bool
+
+	// Whether the health check of the Flink REST API has failed consecutively
+	// up to the failure threshold, and not recovered since.
+	Unhealthy bool
+}
+
+// DeriveState derives the state of a cluster from its recorded state and its
+// observed components, e.g., a creating cluster is Running once all the
+// required components are ready. An unknown recorded state, e.g., one written
+// by a newer version of the operator, is derived from the components only.
+func DeriveState(observed ObservedState) string {
+	var state string
+	var policy = CleanupPolicy{}
+	if observed.CleanupPolicy != nil {
+		policy = *observed.CleanupPolicy
+	}
+	var allReady = observed.ReadyRequiredComponents ==
+		observed.RequiredComponents
+
+	switch observed.RecordedState {
+	case "", ClusterStateCreating:
+		if !allReady {
+			state = ClusterStateCreating
+		} else {
+			state = ClusterStateRunning
+		}
+	case ClusterStateRunning,
+		ClusterStateReconciling,
+		ClusterStateDegraded:
+		if observed.JobStopped {
+			if observed.JobRestartLimitReached {
+				state = ClusterStateFailed
+			} else if observed.JobRestartPending {
+				// Keep the cluster running for the pending restart.
+				state = ClusterStateRunning
+			} else if observed.JobSucceeded &&
+				policy.AfterJobSucceeds != CleanupActionKeepCluster {
+				state = ClusterStateStopping
+			} else if observed.JobFailed &&
+				policy.AfterJobFails != CleanupActionKeepCluster {
+				state = ClusterStateStopping
+			} else if observed.JobCancelled &&
+				policy.AfterJobCancelled != CleanupActionKeepCluster {
+				state = ClusterStateStopping
+			} else {
+				state = ClusterStateRunning
+			}
+		} else if !allReady {
+			state = ClusterStateReconciling
+		} else if observed.Unhealthy {
+			state = ClusterStateDegraded
+		} else {
+			state = ClusterStateRunning
+		}
+	case ClusterStateStopping,
+		ClusterStatePartiallyStopped:
+		if observed.ReadyRequiredComponents == 0 {
+			state = ClusterStateStopped
+		} else if !allReady {
+			state = ClusterStatePartiallyStopped
+		} else {
+			state = ClusterStateStopping
+		}
+	case ClusterStateStopped:
+		state = ClusterStateStopped
+	case ClusterStateFailed:
+		if observed.ReadinessTimeoutRetried {
+			state = ClusterStateReconciling
+		} else {
+			state = ClusterStateFailed
+		}
+	case ClusterStateSuspending,
+		ClusterStateSuspended:
+		// Resumed.
+		if !allReady {
+			state = ClusterStateReconciling
+		} else {
+			state = ClusterStateRunning
+		}
+	default:
+		// Unknown, reconciled like a cluster whose components changed.
+		if !allReady {
+			state = ClusterStateReconciling
+		} else {
+			state = ClusterStateRunning
+		}
+	}
+
+	// Suspension takes precedence over the states of the components, so that a
+	// suspended cluster does not flap back to Reconciling.
+	if observed.Suspend && isSuspendableState(observed.RecordedState) {
+		if observed.RecordedState == ClusterStateSuspended ||
+			observed.ScaledToZero {
+			state = ClusterStateSuspended
+		} else {
+			state = ClusterStateSuspending
+		}
+	}
+	return state
+}
+
+// Checks whether a cluster in the state can be suspended, a cluster which is
+// stopping, stopped or failed can't.
+func isSuspendableState(state string) bool {
+	switch state {
+	case ClusterStateStopping,
+		ClusterStatePartiallyStopped,
+		ClusterStateStopped,
+		ClusterStateFailed:
+		return false
+	}
+	return true
+}
@@ -0,0 +1,196 @@
+/*
+Copyright 2019 Google LLC.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1beta1
+
+import (
+	"testing"
+
+	"gotest.tools/assert"
+)
+
+func TestDeriveState(t *testing.T) {
+	var keepCluster = &CleanupPolicy{
+		AfterJobSucceeds:  CleanupActionKeepCluster,
+		AfterJobFails:     CleanupActionKeepCluster,
+		AfterJobCancelled: CleanupActionKeepCluster,
+	}
+	var tests = []struct {
+		name     string
+		observed ObservedState
+		expected string
+	}{
+		{
+			name: "new cluster",
+			observed: ObservedState{
+				RequiredComponents: 3, ReadyRequiredComponents: 1},
+			expected: ClusterStateCreating,
+		},
+		{
+			name: "created cluster",
+			observed: ObservedState{
+				RecordedState:           ClusterStateCreating,
+				RequiredComponents:      3,
+				ReadyRequiredComponents: 3,
+			},
+			expected: ClusterStateRunning,
+		},
+		{
+			name: "component not ready",
+			observed: ObservedState{
+				RecordedState:           ClusterStateRunning,
+				RequiredComponents:      3,
+				ReadyRequiredComponents: 2,
+			},
+			expected: ClusterStateReconciling,
+		},
+		{
+			name: "job succeeded",
+			observed: ObservedState{
+				RecordedState:           ClusterStateRunning,
+				RequiredComponents:      3,
+				ReadyRequiredComponents: 3,
+				JobStopped:              true,
+				JobSucceeded:            true,
+			},
+			expected: ClusterStateStopping,
+		},
+		{
+			name: "job failed with the cluster kept",
+			observed: ObservedState{
+				RecordedState:           ClusterStateRunning,
+				RequiredComponents:      3,
+				ReadyRequiredComponents: 3,
+				JobStopped:              true,
+				JobFailed:               true,
+				CleanupPolicy:           keepCluster,
+			},
+			expected: ClusterStateRunning,
+		},
+		{
+			name: "job restart pending",
+			observed: ObservedState{
+				RecordedState:     ClusterStateRunning,
+				JobStopped:        true,
+				JobFailed:         true,
+				JobRestartPending: true,
+			},
+			expected: ClusterStateRunning,
+		},
+		{
+			name: "job restart limit reached",
+			observed: ObservedState{
+				RecordedState:          ClusterStateRunning,
+				JobStopped:             true,
+				JobFailed:              true,
+				JobRestartLimitReached: true,
+			},
+			expected: ClusterStateFailed,
+		},
+		{
+			name: "partially stopped",
+			observed: ObservedState{
+				RecordedState:           ClusterStateStopping,
+				RequiredComponents:      3,
+				ReadyRequiredComponents: 1,
+			},
+			expected: ClusterStatePartiallyStopped,
+		},
+		{
+			name: "stopped",
+			observed: ObservedState{
+				RecordedState:      ClusterStatePartiallyStopped,
+				RequiredComponents: 3,
+			},
+			expected: ClusterStateStopped,
+		},
+		{
+			name: "readiness timeout retried",
+			observed: ObservedState{
+				RecordedState:           ClusterStateFailed,
+				ReadinessTimeoutRetried: true,
+			},
+			expected: ClusterStateReconciling,
+		},
+		{
+			name: "suspending",
+			observed: ObservedState{
+				RecordedState:           ClusterStateRunning,
+				RequiredComponents:      3,
+				ReadyRequiredComponents: 3,
+				Suspend:                 true,
+			},
+			expected: ClusterStateSuspending,
+		},
+		{
+			name: "suspended",
+			observed: ObservedState{
+				RecordedState:      ClusterStateSuspending,
+				RequiredComponents: 3,
+				Suspend:            true,
+				ScaledToZero:       true,
+			},
+			expected: ClusterStateSuspended,
+		},
+		{
+			name: "resumed",
+			observed: ObservedState{
+				RecordedState:      ClusterStateSuspended,
+				RequiredComponents: 3,
+			},
+			expected: ClusterStateReconciling,
+		},
+		{
+			name: "unhealthy",
+			observed: ObservedState{
+				RecordedState:           ClusterStateRunning,
+				RequiredComponents:      3,
+				ReadyRequiredComponents: 3,
+				Unhealthy:               true,
+			},
+			expected: ClusterStateDegraded,
+		},
+		{
+			name: "recovered",
+			observed: ObservedState{
+				RecordedState:           ClusterStateDegraded,
+				RequiredComponents:      3,
+				ReadyRequiredComponents: 3,
+			},
+			expected: ClusterStateRunning,
+		},
+		{
+			name: "stopped cluster not suspended",
+			observed: ObservedState{
+				RecordedState: ClusterStateStopped,
+				Suspend:       true,
+			},
+			expected: ClusterStateStopped,
+		},
+		{
+			name: "unknown state",
+			observed: ObservedState{
+				RecordedState:           "Unknown",
+				RequiredComponents:      3,
+				ReadyRequiredComponents: 2,
+			},
+			expected: ClusterStateReconciling,
+		},
+	}
+	for _, test := range tests {
+		assert.Equal(t, DeriveState(test.observed), test.expected, test.name)
+	}
+}
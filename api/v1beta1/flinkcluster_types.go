@@ -17,6 +17,9 @@ limitations under the License.
 package v1beta1
 
 import (
+	"path"
+	"strings"
+
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
@@ -30,6 +33,49 @@ const (
 	ClusterStateStopping         = "Stopping"
 	ClusterStatePartiallyStopped = "PartiallyStopped"
 	ClusterStateStopped          = "Stopped"
+	ClusterStateFailed           = "Failed"
+	ClusterStateSuspending       = "Suspending"
+	ClusterStateSuspended        = "Suspended"
+	ClusterStateDegraded         = "Degraded"
+)
+
+// JobJarDirectory is the directory of the JAR downloaded from `jarURI`. It is
+// not /opt/flink/usrlib, which the volume would shadow in the images with
+// user JARs.
+const JobJarDirectory = "/opt/flink/job-jar"
+
+// GetDownloadedJarFile gets the path of the JAR downloaded from `jarURI`, in
+// JobJarDirectory with the base name of the path of the URI.
+func GetDownloadedJarFile(jarURI string) string {
+	var uriPath = strings.SplitN(jarURI, "?", 2)[0]
+	return JobJarDirectory + "/" + path.Base(uriPath)
+}
+
+// The Kubernetes high availability services factory of Flink 1.12+, which
+// can be set instead of "kubernetes".
+const kubernetesHAServicesFactory = "org.apache.flink.kubernetes.highavailability.KubernetesHaServicesFactory"
+
+// IsKubernetesHAEnabled tells whether the Flink properties enable the
+// Kubernetes high availability services of Flink 1.12+, i.e.,
+// `high-availability`, or `high-availability.type` in Flink 1.17+, is
+// "kubernetes". The JobManager replicas then elect their leader through
+// ConfigMaps.
+func IsKubernetesHAEnabled(properties map[string]string) bool {
+	for _, key := range []string{"high-availability", "high-availability.type"} {
+		var mode = strings.TrimSpace(properties[key])
+		if strings.EqualFold(mode, "kubernetes") ||
+			mode == kubernetesHAServicesFactory {
+			return true
+		}
+	}
+	return false
+}
+
+// ClusterReason defines reasons for the state of a cluster.
+const (
+	// The cluster stayed in the Reconciling state longer than
+	// `readinessTimeoutSeconds`, so it is failed.
+	ClusterReasonReadinessTimeout = "ReadinessTimeout"
 )
 
 // ComponentState defines states for a cluster component.
@@ -37,16 +83,134 @@ const (
 	ComponentStateNotReady = "NotReady"
 	ComponentStateReady    = "Ready"
 	ComponentStateDeleted  = "Deleted"
+	// Some pods of the component are restarting repeatedly, which might not
+	// be reflected by the available replicas of the deployment yet.
+	ComponentStateCrashLoopBackOff = "CrashLoopBackOff"
+)
+
+// ComponentReason defines reasons for the state of a cluster component.
+const (
+	// The image fails to be pulled and the pull secrets are missing, e.g.,
+	// the referenced Secret does not exist or the image is in a private
+	// registry without pull secrets.
+	ComponentReasonMissingPullSecret = "MissingPullSecret"
+	// The init container is downloading the job JAR from `jarURI`.
+	ComponentReasonDownloadingJar = "DownloadingJar"
+	// The init container failed to download the job JAR from `jarURI`.
+	ComponentReasonJarDownloadFailed = "JarDownloadFailed"
+	// Some TaskManager containers were OOMKilled, the memory limit of the
+	// container is likely lower than the memory configured for Flink, e.g.,
+	// by `taskmanager.memory.process.size`.
+	ComponentReasonMemoryMismatch = "MemoryMismatch"
+	// The ConfigMap referenced by `flinkConfigMap` does not exist.
+	ComponentReasonMissingConfig = "MissingConfig"
+	// The TaskManager deployment waits for enough idle TaskManagers to be
+	// removed before it is scaled down.
+	ComponentReasonDraining = "Draining"
+	// The job is specified, but its Kubernetes job has not been created
+	// although the other components are ready.
+	ComponentReasonJobNotCreated = "JobNotCreated"
+	// The heap usage of the JobManager stayed above the memory pressure ratio
+	// configured for the operator in consecutive metrics snapshots.
+	ComponentReasonHighMemoryPressure = "HighMemoryPressure"
+	// The TaskManagers provide fewer task slots than the job parallelism, so
+	// the job is pending, or can't be scheduled if it restarts.
+	ComponentReasonInsufficientSlots = "InsufficientSlots"
+	// Some sidecar containers of the pods are not ready, e.g., a log shipper
+	// or a proxy is crashing, while the Flink containers might be running.
+	ComponentReasonSidecarNotReady = "SidecarNotReady"
+	// The JobManager did not accept the job submitted through its REST API
+	// before the deadline of `submissionRetry`.
+	ComponentReasonSubmissionFailed = "SubmissionFailed"
+	// None of the JobManager replicas is the elected leader with Kubernetes
+	// high availability, e.g., during a failover.
+	ComponentReasonLeaderElection = "LeaderElection"
+)
+
+// ClusterConditionType defines types of the conditions of a cluster.
+const (
+	// The resources requested by the cluster exceed the available resource
+	// quota of the namespace, so the cluster is not created.
+	ClusterConditionQuotaExceeded = "QuotaExceeded"
+	// Whether the spec passes the validation of the operator, which also
+	// catches the specs that bypassed the validating webhook. The cluster
+	// resources are not reconciled while it is False, except for cancelling
+	// the job and suspending the cluster.
+	ClusterConditionSpecValid = "SpecValid"
+	// Whether fields of the spec which can't be changed after the cluster is
+	// created, e.g., the state backend, differ from the last applied spec.
+	// The cluster resources are not reconciled while it is True, except for
+	// cancelling the job and suspending the cluster.
+	ClusterConditionSpecImmutableViolation = "SpecImmutableViolation"
+	// Whether PriorityClasses referenced by the spec don't exist, the
+	// workloads using them are not created until they exist.
+	ClusterConditionPriorityClassNotFound = "PriorityClassNotFound"
+	// Whether the hooks of `job.onSuccess` succeeded for the last completion
+	// of the job. The hooks are executed once, they are not retried while it
+	// is False.
+	ClusterConditionSuccessHooksExecuted = "SuccessHooksExecuted"
+)
+
+// ScaleReason defines reasons for the TaskManager autoscaler to change the
+// desired number of replicas.
+const (
+	ScaleReasonHighBackpressure    = "HighBackpressure"
+	ScaleReasonHighSlotUtilization = "HighSlotUtilization"
+	ScaleReasonLowSlotUtilization  = "LowSlotUtilization"
 )
 
 // JobState defines states for a Flink job.
 const (
 	JobStatePending   = "Pending"
 	JobStateRunning   = "Running"
+	JobStateUnhealthy = "Unhealthy"
 	JobStateSucceeded = "Succeeded"
 	JobStateFailed    = "Failed"
 	JobStateCancelled = "Cancelled"
 	JobStateUnknown   = "Unknown"
+	// The job submitter did not finish the submission within
+	// `submitJobTimeoutSeconds`.
+	JobStateSubmitTimeout = "SubmitTimeout"
+	// Some pods of the job submitter failed, and the Kubernetes job is
+	// retrying within its `backoffLimit`.
+	JobStateRetrying = "Retrying"
+	// The operator is submitting the job through the REST API of the
+	// JobManager, retrying until the JobManager accepts it.
+	JobStateDeploying = "Deploying"
+	// The job is being stopped with a savepoint and resubmitted from it with
+	// the new parallelism of the spec.
+	JobStateRescaling = "Rescaling"
+)
+
+// JobRescalePhase defines the phases of a change of the job parallelism.
+const (
+	// The job is being stopped with a savepoint.
+	JobRescalePhaseStopping = "Stopping"
+	// The job is being resubmitted from the savepoint once the TaskManagers
+	// have been scaled.
+	JobRescalePhaseResubmitting = "Resubmitting"
+	// The savepoint failed, the job keeps running with the old parallelism.
+	JobRescalePhaseFailed = "Failed"
+)
+
+// BackpressureLevel defines backpressure levels of a job vertex.
+const (
+	BackpressureLevelOK   = "OK"
+	BackpressureLevelLow  = "LOW"
+	BackpressureLevelHigh = "HIGH"
+)
+
+// SQLDialect defines the SQL dialect of the Flink Table API.
+const (
+	SQLDialectDefault = "default"
+	SQLDialectHive    = "hive"
+)
+
+// StateBackend defines the state backend of Flink jobs.
+const (
+	StateBackendFilesystem = "filesystem"
+	StateBackendRocksDB    = "rocksdb"
+	StateBackendMemory     = "memory"
 )
 
 // AccessScope defines the access scope of JobManager service.
@@ -67,8 +231,58 @@ const (
 	// JobRestartPolicyFromSavepointOnFailure - restart the job from the latest
 	// savepoint if available, otherwise do not restart.
 	JobRestartPolicyFromSavepointOnFailure = "FromSavepointOnFailure"
+
+	// JobRestartPolicyOnFailure - restart the job from the latest savepoint if
+	// available, otherwise from the initial savepoint or from scratch.
+	JobRestartPolicyOnFailure = "OnFailure"
 )
 
+// JobRestartBackoff defines the delay between restarts of a failed job and
+// the limit of attempts.
+type JobRestartBackoff struct {
+	// The maximum number of attempts to run the job, including the first one.
+	// When reached, the cluster enters the terminal "Failed" state.
+	// 0 means unlimited, default: 0.
+	MaxAttempts int32 `json:"maxAttempts,omitempty"`
+
+	// The delay before the first restart in seconds, default: 10.
+	InitialBackoffSeconds int64 `json:"initialBackoffSeconds,omitempty"`
+
+	// The multiplier applied to the delay for each subsequent restart,
+	// default: 2.
+	BackoffMultiplier int32 `json:"backoffMultiplier,omitempty"`
+}
+
+// JobSubmissionRetry defines the retries of the submission of a job through
+// the REST API of the JobManager.
+type JobSubmissionRetry struct {
+	// The time in seconds from the first attempt after which the submission
+	// is given up and the job state becomes "Failed", default: 300.
+	DeadlineSeconds int64 `json:"deadlineSeconds,omitempty"`
+
+	// The delay before the second attempt in seconds, default: 5.
+	InitialBackoffSeconds int64 `json:"initialBackoffSeconds,omitempty"`
+
+	// The multiplier applied to the delay for each subsequent attempt,
+	// default: 2.
+	BackoffMultiplier int32 `json:"backoffMultiplier,omitempty"`
+
+	// The maximum delay between two attempts in seconds, default: 60.
+	MaxBackoffSeconds int64 `json:"maxBackoffSeconds,omitempty"`
+}
+
+// JobCheckpointHealth defines the thresholds beyond which a running job is
+// considered unhealthy because of its checkpoints.
+type JobCheckpointHealth struct {
+	// The number of consecutive failed checkpoints after which the job is
+	// unhealthy, default: 3.
+	MaxConsecutiveFailures int32 `json:"maxConsecutiveFailures,omitempty"`
+
+	// The maximum time in seconds since the last completed checkpoint, beyond
+	// which the job is unhealthy. 0 means no limit, default: 0.
+	MaxCheckpointAgeSeconds int64 `json:"maxCheckpointAgeSeconds,omitempty"`
+}
+
 // ImageSpec defines Flink image of JobManager and TaskManager containers.
 type ImageSpec struct {
 	// Flink image name.
@@ -114,11 +328,12 @@ type JobManagerIngressSpec struct {
 
 // JobManagerSpec defines properties of JobManager.
 type JobManagerSpec struct {
-	// The number of replicas.
+	// The number of replicas, which must be 1 unless Kubernetes high
+	// availability is enabled by the Flink properties.
 	Replicas *int32 `json:"replicas,omitempty"`
 
 	// Access scope, enum("Cluster", "VPC", "External").
-	AccessScope string `json:"accessScope"`
+	AccessScope string `json:"accessScope,omitempty"`
 
 	// (Optional) Ingress.
 	Ingress *JobManagerIngressSpec `json:"ingress,omitempty"`
@@ -152,6 +367,50 @@ type JobManagerSpec struct {
 	// scheduled on that node.
 	// More info: https://kubernetes.io/docs/concepts/configuration/assign-pod-node/
 	NodeSelector map[string]string `json:"nodeSelector,omitempty"`
+
+	// (Optional) The name of the PriorityClass of the JobManager pod, so that
+	// it is less likely to be evicted under node pressure. The
+	// PriorityClass must exist before the deployment is created. Removing
+	// it later does not affect the running pods, only the pods created
+	// afterwards, e.g., when they are restarted.
+	// More info: https://kubernetes.io/docs/concepts/configuration/pod-priority-preemption/
+	PriorityClassName string `json:"priorityClassName,omitempty"`
+
+	// (Optional) Scheduling constraints of the JobManager pod, e.g., node
+	// affinity and pod anti-affinity.
+	// More info: https://kubernetes.io/docs/concepts/configuration/assign-pod-node/#affinity-and-anti-affinity
+	Affinity *corev1.Affinity `json:"affinity,omitempty"`
+
+	// (Optional) Tolerations of the JobManager pod, e.g., of the taints of
+	// dedicated Flink nodes.
+	// More info: https://kubernetes.io/docs/concepts/configuration/taint-and-toleration/
+	Tolerations []corev1.Toleration `json:"tolerations,omitempty"`
+
+	// (Optional) Environment variables of the JobManager container, appended to
+	// the shared `envVars`, e.g., credentials from a Secret referenced by
+	// `valueFrom.secretKeyRef`.
+	// +sensitive
+	Env []corev1.EnvVar `json:"env,omitempty"`
+
+	// (Optional) Sources of environment variables of the JobManager container,
+	// e.g., all the keys of a Secret or ConfigMap.
+	EnvFrom []corev1.EnvFromSource `json:"envFrom,omitempty"`
+
+	// Sidecar containers running alongside with the JobManager container in the
+	// pod, e.g., for shipping the log files in /opt/flink/log.
+	Sidecars []corev1.Container `json:"sidecars,omitempty"`
+
+	// How long the JobManager is given to shut down cleanly when its pod is
+	// terminated, default: 120s. It sets both the pod's
+	// `terminationGracePeriodSeconds` and the `jobmanager.timeout` Flink
+	// property.
+	GracefulShutdownTimeout *metav1.Duration `json:"gracefulShutdownTimeout,omitempty"`
+
+	// (Optional) Thresholds of the liveness and readiness probes of the
+	// JobManager container. The liveness probe connects to the RPC port, the
+	// readiness probe requests `/config` from the Flink REST API unless it
+	// requires client certificates.
+	Probes *ProbesSpec `json:"probes,omitempty"`
 }
 
 // TaskManagerPorts defines ports of TaskManager.
@@ -168,8 +427,13 @@ type TaskManagerPorts struct {
 
 // TaskManagerSpec defines properties of TaskManager.
 type TaskManagerSpec struct {
-	// The number of replicas.
-	Replicas int32 `json:"replicas"`
+	// The number of replicas, default: 2, or enough for the job parallelism.
+	Replicas int32 `json:"replicas,omitempty"`
+
+	// The number of task slots of each TaskManager, which is set as
+	// `taskmanager.numberOfTaskSlots` of the Flink config unless it is
+	// specified in the Flink properties, default: 1.
+	SlotsPerTask *int32 `json:"slotsPerTask,omitempty"`
 
 	// Ports.
 	Ports TaskManagerPorts `json:"ports,omitempty"`
@@ -198,14 +462,172 @@ type TaskManagerSpec struct {
 	// More info: https://kubernetes.io/docs/concepts/storage/volumes/
 	VolumeMounts []corev1.VolumeMount `json:"volumeMounts,omitempty"`
 
+	// (Optional) Ephemeral volumes of the TaskManager pods which are mounted
+	// to the TaskManager containers, e.g., a tmpfs for the local state of the
+	// RocksDB state backend.
+	EmptyDirVolumes []EmptyDirVolumeSpec `json:"emptyDirVolumes,omitempty"`
+
+	// (Optional) PersistentVolumeClaims created for each TaskManager, e.g., for
+	// the local state of the RocksDB state backend, which are mounted by the
+	// `volumeMounts` with the same names. If specified, the TaskManagers run
+	// as a StatefulSet instead of a deployment, and each of them keeps its
+	// claims across restarts. The claims are not deleted with the cluster.
+	// Cannot be updated.
+	// More info: https://kubernetes.io/docs/concepts/workloads/controllers/statefulset/#volume-claim-templates
+	VolumeClaimTemplates []corev1.PersistentVolumeClaim `json:"volumeClaimTemplates,omitempty"`
+
 	// Selector which must match a node's labels for the TaskManager pod to be
 	// scheduled on that node.
 	// More info: https://kubernetes.io/docs/concepts/configuration/assign-pod-node/
 	NodeSelector map[string]string `json:"nodeSelector,omitempty"`
 
+	// (Optional) The name of the PriorityClass of the TaskManager pods, so that
+	// they are less likely to be evicted under node pressure. The
+	// PriorityClass must exist before the deployment is created. Removing
+	// it later does not affect the running pods, only the pods created
+	// afterwards, e.g., when they are restarted.
+	// More info: https://kubernetes.io/docs/concepts/configuration/pod-priority-preemption/
+	PriorityClassName string `json:"priorityClassName,omitempty"`
+
+	// (Optional) Scheduling constraints of the TaskManager pods, e.g., node
+	// affinity and pod anti-affinity. If omitted and the spec allows more than
+	// one replica, i.e., `replicas` or `maxReplicas` of the TaskManager or of a
+	// pool, the pods are preferably spread across zones and nodes.
+	// More info: https://kubernetes.io/docs/concepts/configuration/assign-pod-node/#affinity-and-anti-affinity
+	Affinity *corev1.Affinity `json:"affinity,omitempty"`
+
+	// (Optional) Tolerations of the TaskManager pods, including those of the
+	// pools, e.g., of the taints of dedicated Flink nodes.
+	// More info: https://kubernetes.io/docs/concepts/configuration/taint-and-toleration/
+	Tolerations []corev1.Toleration `json:"tolerations,omitempty"`
+
+	// (Optional) Environment variables of the TaskManager container, appended to
+	// the shared `envVars`, e.g., credentials from a Secret referenced by
+	// `valueFrom.secretKeyRef`.
+	// +sensitive
+	Env []corev1.EnvVar `json:"env,omitempty"`
+
+	// (Optional) Sources of environment variables of the TaskManager container,
+	// e.g., all the keys of a Secret or ConfigMap.
+	EnvFrom []corev1.EnvFromSource `json:"envFrom,omitempty"`
+
 	// Sidecar containers running alongside with the TaskManager container in the
-	// pod.
+	// pod, e.g., for shipping the log files in /opt/flink/log.
 	Sidecars []corev1.Container `json:"sidecars,omitempty"`
+
+	// How long the TaskManager pods are given to shut down cleanly when they
+	// are terminated, e.g., to flush their state, before they are killed,
+	// default: 60.
+	TerminationGracePeriodSeconds *int64 `json:"terminationGracePeriodSeconds,omitempty"`
+
+	// (Optional) Whether to stop the TaskManager with `bin/taskmanager.sh
+	// stop` in a pre-stop hook of its container, so that it shuts down
+	// cleanly within the grace period, default: false.
+	PreStopHook bool `json:"preStopHook,omitempty"`
+
+	// (Optional) How long a scale-down of the TaskManagers waits for the
+	// TaskManagers to be removed to become idle, i.e., to have all their task
+	// slots free, default: 600. After it, they are removed anyway and Flink
+	// restarts the tasks they were running.
+	DrainTimeoutSeconds *int32 `json:"drainTimeoutSeconds,omitempty"`
+
+	// (Optional) Additional pools of TaskManagers with heterogeneous resources,
+	// each of which is a separate deployment.
+	Pools []TaskManagerPoolSpec `json:"pools,omitempty"`
+
+	// Minimum number of seconds for which a newly created TaskManager pod
+	// should be ready before it is considered available, which slows down
+	// rolling updates so that each TaskManager warms up before the next one
+	// is replaced, from 0 to 600, default: 0.
+	MinReadySeconds int32 `json:"minReadySeconds,omitempty"`
+
+	// (Optional) The minimum number of replicas when autoscaling, default: 1.
+	MinReplicas *int32 `json:"minReplicas,omitempty"`
+
+	// (Optional) The maximum number of replicas. If specified, the replicas of
+	// the TaskManager deployment are adjusted between MinReplicas and
+	// MaxReplicas based on the slot utilization and the backpressure of the
+	// cluster, starting from Replicas.
+	MaxReplicas *int32 `json:"maxReplicas,omitempty"`
+
+	// (Optional) The minimum number of seconds between two scaling decisions
+	// of the autoscaler, default: 300.
+	AutoscaleCooldownSeconds *int32 `json:"autoscaleCooldownSeconds,omitempty"`
+
+	// (Optional) Thresholds of the liveness and readiness probes of the
+	// TaskManager container, which connect to its RPC port.
+	Probes *ProbesSpec `json:"probes,omitempty"`
+}
+
+// ProbesSpec defines the liveness and readiness probes of a Flink container.
+// The pods are only ready once their probes succeed, so that the cluster is
+// not Running before Flink is serving.
+type ProbesSpec struct {
+	// (Optional) The liveness probe, which restarts the container after
+	// consecutive failures, default: initialDelaySeconds 30, periodSeconds
+	// 60, timeoutSeconds 10, failureThreshold 5.
+	Liveness *ProbeThresholds `json:"liveness,omitempty"`
+
+	// (Optional) The readiness probe, which takes the pod out of service
+	// after consecutive failures, default: initialDelaySeconds 10,
+	// periodSeconds 10, timeoutSeconds 5, failureThreshold 3.
+	Readiness *ProbeThresholds `json:"readiness,omitempty"`
+}
+
+// ProbeThresholds defines the timing of a probe, the unspecified fields take
+// the defaults of the probe.
+// More info: https://kubernetes.io/docs/tasks/configure-pod-container/configure-liveness-readiness-startup-probes/#configure-probes
+type ProbeThresholds struct {
+	// Number of seconds after the container has started before the probe is
+	// initiated.
+	InitialDelaySeconds *int32 `json:"initialDelaySeconds,omitempty"`
+
+	// How often in seconds to perform the probe.
+	PeriodSeconds *int32 `json:"periodSeconds,omitempty"`
+
+	// Number of seconds after which the probe times out.
+	TimeoutSeconds *int32 `json:"timeoutSeconds,omitempty"`
+
+	// Number of consecutive failures after which the probe is considered
+	// failed.
+	FailureThreshold *int32 `json:"failureThreshold,omitempty"`
+}
+
+// EmptyDirVolumeSpec defines an ephemeral volume of the TaskManager pods,
+// which is created empty when a pod starts and deleted when it stops.
+type EmptyDirVolumeSpec struct {
+	// The name of the volume, unique among the volumes of the TaskManager pods.
+	Name string `json:"name"`
+
+	// The path to mount the volume to in the TaskManager containers.
+	MountPath string `json:"mountPath"`
+
+	// (Optional) The maximum size of the volume. For the `Memory` medium, it
+	// counts against the memory limit of the TaskManager container.
+	SizeLimit resource.Quantity `json:"sizeLimit,omitempty"`
+
+	// (Optional) The storage medium of the volume, `Memory` for a tmpfs,
+	// default: the storage of the node.
+	// More info: https://kubernetes.io/docs/concepts/storage/volumes#emptydir
+	Medium corev1.StorageMedium `json:"medium,omitempty"`
+}
+
+// TaskManagerPoolSpec defines an additional pool of TaskManagers. The
+// unspecified properties are inherited from the TaskManager spec.
+type TaskManagerPoolSpec struct {
+	// The name of the pool, must be unique in the cluster.
+	Name string `json:"name"`
+
+	// The number of replicas.
+	Replicas int32 `json:"replicas"`
+
+	// (Optional) Compute resources required by each TaskManager container of
+	// the pool.
+	Resources *corev1.ResourceRequirements `json:"resources,omitempty"`
+
+	// (Optional) Selector which must match a node's labels for the TaskManager
+	// pods of the pool to be scheduled on that node.
+	NodeSelector map[string]string `json:"nodeSelector,omitempty"`
 }
 
 // CleanupAction defines the action to take after job finishes.
@@ -232,8 +654,40 @@ type CleanupPolicy struct {
 
 // JobSpec defines properties of a Flink job.
 type JobSpec struct {
-	// JAR file of the job.
-	JarFile string `json:"jarFile"`
+	// JAR file of the job. One of `jarFile`, `pythonScript` and `sqlJob` must
+	// be specified.
+	JarFile string `json:"jarFile,omitempty"`
+
+	// (Optional) Remote URI of the JAR file of the job, "gs://", "s3://" or
+	// "http(s)://". If specified, an init container downloads the JAR into a
+	// volume mounted at /opt/flink/job-jar in the JobManager pod and the job
+	// submitter pod, and `jarFile` defaults to the downloaded file.
+	JarURI string `json:"jarURI,omitempty"`
+
+	// (Optional) Image of the init container downloading `jarURI`, which must
+	// contain the downloader of the scheme, i.e., gsutil, aws or curl,
+	// default: google/cloud-sdk.
+	JarDownloaderImage string `json:"jarDownloaderImage,omitempty"`
+
+	// Python script of a PyFlink job, e.g., /opt/flink/job/wordcount.py.
+	PythonScript string `json:"pythonScript,omitempty"`
+
+	// (Optional) Content of the requirements.txt file of a PyFlink job, the
+	// packages are installed before the job runs.
+	PythonRequirements string `json:"pythonRequirements,omitempty"`
+
+	// (Optional) Flink SQL job, which is submitted by the SQL client instead
+	// of `flink run`.
+	SQLJob *SQLJobSpec `json:"sqlJob,omitempty"`
+
+	// (Optional) Execution plan JSON of the job, e.g., from
+	// `StreamExecutionEnvironment.getExecutionPlan()`. If specified, the
+	// operator runs the JAR file with the plan through the
+	// `/jars/{jarId}/run` endpoint of the JobManager instead of creating the
+	// job submitter, and records the ID of the submitted job. The JAR file
+	// with the base name of `jarFile` must have been uploaded to the
+	// JobManager.
+	StreamGraphJSON string `json:"streamGraphJSON,omitempty"`
 
 	// Fully qualified Java class name of the job.
 	ClassName *string `json:"className,omitempty"`
@@ -257,7 +711,14 @@ type JobSpec struct {
 	// cluster to trigger a new savepoint to `savepointsDir` on demand.
 	SavepointGeneration int32 `json:"savepointGeneration,omitempty"`
 
-	// Job parallelism, default: 1.
+	// Job parallelism, default: 1. Unless autoscaling is enabled, the
+	// TaskManager replicas default to `ceil(parallelism / slots)`, but at
+	// least 2, counting the task slots of the pools, where slots is
+	// `taskManager.slotsPerTask`, default: 1. Specified replicas are never
+	// raised, a shortfall of task slots is the InsufficientSlots reason of
+	// the TaskManager deployment status. It can be updated for a running
+	// job with `savepointsDir`, which is then stopped with a savepoint and
+	// resubmitted from it with the new parallelism.
 	Parallelism *int32 `json:"parallelism,omitempty"`
 
 	// No logging output to STDOUT, default: false.
@@ -277,8 +738,8 @@ type JobSpec struct {
 	// More info: https://kubernetes.io/docs/concepts/workloads/pods/init-containers/
 	InitContainers []corev1.Container `json:"initContainers,omitempty"`
 
-	// Restart policy when the job fails, "Never" or "FromSavepointOnFailure",
-	// default: "Never".
+	// Restart policy when the job fails, "Never", "FromSavepointOnFailure" or
+	// "OnFailure", default: "Never".
 	//
 	// "Never" means the operator will never try to restart a failed job, manual
 	// cleanup and restart is required.
@@ -287,7 +748,39 @@ type JobSpec struct {
 	// job from the savepoint recorded in the job status if available; otherwise,
 	// the job will stay in failed state. This option is usually used together
 	// with `autoSavepointSeconds` and `savepointsDir`.
-	RestartPolicy *JobRestartPolicy `json:"restartPolicy"`
+	//
+	// "OnFailure" means the operator will always try to restart the failed job,
+	// from the savepoint recorded in the job status if available; otherwise,
+	// from `fromSavepoint` or from scratch.
+	RestartPolicy *JobRestartPolicy `json:"restartPolicy,omitempty"`
+
+	// (Optional) Backoff and attempts limit of job restarts. If omitted, the
+	// failed job is restarted immediately and without limit.
+	RestartBackoff *JobRestartBackoff `json:"restartBackoff,omitempty"`
+
+	// (Optional) The time in seconds the job submitter is given to submit the
+	// job, i.e., until the Flink job is observed running. When exceeded, the
+	// submitter is terminated and the job state becomes "SubmitTimeout", which
+	// is not restarted by `restartPolicy`. If omitted, there is no limit.
+	SubmitJobTimeoutSeconds *int64 `json:"submitJobTimeoutSeconds,omitempty"`
+
+	// (Optional) If specified, the operator runs the JAR file through the
+	// `/jars/{jarId}/run` endpoint of the JobManager instead of creating the
+	// job submitter, retrying with exponential backoff until the JobManager
+	// accepts the job or the deadline passes. If the JAR file with the base
+	// name of `jarFile` has not been uploaded to the JobManager, the operator
+	// uploads it from an HTTP(S) `jarURI`. The failed submission is not
+	// restarted by `restartPolicy`.
+	SubmissionRetry *JobSubmissionRetry `json:"submissionRetry,omitempty"`
+
+	// (Optional) Checkpoint thresholds of the running job. When exceeded, the
+	// job state becomes "Unhealthy" until a checkpoint completes again. If
+	// omitted, the checkpoints are only recorded in the job status.
+	CheckpointHealth *JobCheckpointHealth `json:"checkpointHealth,omitempty"`
+
+	// (Optional) Hooks executed once when the job succeeds, e.g., to notify
+	// a downstream system or to start the next step of a pipeline.
+	OnSuccess *JobSuccessHooks `json:"onSuccess,omitempty"`
 
 	// The action to take after job finishes.
 	CleanupPolicy *CleanupPolicy `json:"cleanupPolicy,omitempty"`
@@ -298,34 +791,314 @@ type JobSpec struct {
 	CancelRequested *bool `json:"cancelRequested,omitempty"`
 }
 
+// JobSuccessHooks defines the hooks executed when the job succeeds. They are
+// executed once per completion of the job, a failed hook is not retried but
+// reported in the SuccessHooksExecuted condition of the cluster.
+type JobSuccessHooks struct {
+	// (Optional) The URL which a JSON notification is POSTed to, with the
+	// `cluster`, `namespace`, `jobID` and `completionTime` of the job.
+	// Redirects are not followed, and hosts at private and link-local
+	// addresses must be allowed by the operator.
+	WebhookURL string `json:"webhookURL,omitempty"`
+
+	// (Optional) The name of a CronJob in the namespace of the cluster, whose
+	// job template is used to create a Job, like
+	// `kubectl create job --from=cronjob/<name>`. The CronJob must be labeled
+	// `flinkoperator.k8s.io/success-hook-template: "true"`. A suspended
+	// CronJob can serve as a template only.
+	TriggerJobName string `json:"triggerJobName,omitempty"`
+
+	// (Optional) The annotations of the triggered Job, in addition to those
+	// of the job template.
+	Annotations map[string]string `json:"annotations,omitempty"`
+}
+
+// SQLJobSpec defines a Flink SQL job. The SQL file is mounted from the
+// ConfigMap into the job submitter pod, which runs it with
+// `sql-client.sh embedded -f <file>`.
+type SQLJobSpec struct {
+	// The name of the ConfigMap which contains the SQL file. The ConfigMap
+	// must be in the same namespace as the FlinkCluster.
+	ConfigMapRef string `json:"configMapRef"`
+
+	// The key of the SQL file in the ConfigMap, e.g., `job.sql`.
+	StatementFile string `json:"statementFile"`
+}
+
 // FlinkClusterSpec defines the desired state of FlinkCluster
 type FlinkClusterSpec struct {
-	// Flink image spec for the cluster's components.
-	Image ImageSpec `json:"image"`
+	// Flink image spec for the cluster's components. Required unless it is
+	// provided by the cluster template.
+	Image ImageSpec `json:"image,omitempty"`
 
-	// Flink JobManager spec.
-	JobManager JobManagerSpec `json:"jobManager"`
+	// (Optional) The Flink version of the image, e.g., "1.9", default: the
+	// version in the image tag if available.
+	FlinkVersion string `json:"flinkVersion,omitempty"`
 
-	// Flink TaskManager spec.
-	TaskManager TaskManagerSpec `json:"taskManager"`
+	// Flink JobManager spec. Required unless it is provided by the cluster
+	// template.
+	JobManager JobManagerSpec `json:"jobManager,omitempty"`
+
+	// Flink TaskManager spec. Required unless it is provided by the cluster
+	// template.
+	TaskManager TaskManagerSpec `json:"taskManager,omitempty"`
 
 	// (Optional) Job spec. If specified, this cluster is an ephemeral Job
 	// Cluster, which will be automatically terminated after the job finishes;
 	// otherwise, it is a long-running Session Cluster.
 	Job *JobSpec `json:"job,omitempty"`
 
+	// (Optional) Whether to observe the jobs which are submitted to a Session
+	// Cluster through the Flink REST API, default: false. The job status is
+	// derived from the Flink job overview, preferring the recorded job, then
+	// the running job which started last, and doesn't change the state of the
+	// cluster. Ignored for Job Clusters.
+	ObserveSessionJobs bool `json:"observeSessionJobs,omitempty"`
+
+	// (Optional) How the JobManager and TaskManagers are deployed,
+	// `enum("operator", "native")`, default: "operator". In "native" mode,
+	// which requires Flink 1.12+ and a Job Cluster with a JAR file in the
+	// image, the operator only creates the ConfigMap of the Flink config and
+	// the job submitter, which deploys an application cluster with
+	// `flink run-application -t kubernetes-application`. Flink creates the
+	// JobManager and TaskManager pods itself, so the service account of the
+	// cluster must be allowed to manage pods, services, ConfigMaps and
+	// deployments.
+	DeploymentMode DeploymentMode `json:"deploymentMode,omitempty"`
+
 	// Environment variables shared by all JobManager, TaskManager and job
 	// containers.
+	// +sensitive
 	EnvVars []corev1.EnvVar `json:"envVars,omitempty"`
 
 	// Flink properties which are appened to flink-conf.yaml.
+	// +sensitive
 	FlinkProperties map[string]string `json:"flinkProperties,omitempty"`
 
+	// (Optional) The name of an externally managed ConfigMap with
+	// `flink-conf.yaml` and the log configs, which is mounted to
+	// `/opt/flink/conf` of the JobManager and TaskManager pods instead of the
+	// config generated by the operator. It must set the properties of the
+	// deployed environment, e.g., `jobmanager.rpc.address`, and the Flink
+	// properties of the spec, e.g., `flinkProperties`, are ignored. The pods
+	// are restarted when its data changes.
+	FlinkConfigMap string `json:"flinkConfigMap,omitempty"`
+
 	// Config for Hadoop.
 	HadoopConfig *HadoopConfig `json:"hadoopConfig,omitempty"`
 
 	// Config for GCP.
 	GCPConfig *GCPConfig `json:"gcpConfig,omitempty"`
+
+	// Security config.
+	Security *SecuritySpec `json:"security,omitempty"`
+
+	// (Optional) Reverse proxy in front of the JobManager web UI and REST API,
+	// e.g., for rate limiting a public-facing API.
+	JobManagerProxy *ProxySpec `json:"jobManagerProxy,omitempty"`
+
+	// Networking config.
+	Networking *NetworkingSpec `json:"networking,omitempty"`
+
+	// (Optional) Monitoring config.
+	Monitoring *MonitoringSpec `json:"monitoring,omitempty"`
+
+	// (Optional) The service account of the JobManager, TaskManager and job
+	// pods.
+	ServiceAccount *ServiceAccountSpec `json:"serviceAccount,omitempty"`
+
+	// (Optional) Paths of extra JAR files in the image, which are appended to
+	// the classpath of the JobManager, TaskManager and job containers.
+	ExtraClassPath []string `json:"extraClassPath,omitempty"`
+
+	// (Optional) Config for the Flink Table API and SQL.
+	Table *TableSpec `json:"table,omitempty"`
+
+	// (Optional) Persistent storage for checkpoints, which is mounted into the
+	// JobManager and TaskManager pods.
+	CheckpointStorage *CheckpointStorageSpec `json:"checkpointStorage,omitempty"`
+
+	// (Optional) Checkpointing and state backend config, which is translated
+	// to the Flink properties and takes precedence over `flinkProperties`.
+	CheckpointConfig *CheckpointConfig `json:"checkpointConfig,omitempty"`
+
+	// Suspend the cluster by scaling the JobManager and TaskManager
+	// deployments to zero replicas, default: false. Setting it back to false
+	// restores the configured replicas. If the job is running and
+	// `savepointsDir` is provided, a savepoint is taken before suspending, from
+	// which the job can be restarted according to its restart policy.
+	Suspend bool `json:"suspend,omitempty"`
+
+	// (Optional) Reference to an existing FlinkCluster in the same namespace
+	// to clone. If specified, the spec and labels of the referenced cluster
+	// are copied to this cluster on creation, replacing the other spec fields.
+	// The names of the service account and the checkpoint PVC created for the
+	// referenced cluster are derived from the name of this cluster instead.
+	// Only allowed at creation time.
+	CloneFrom *ClusterRef `json:"cloneFrom,omitempty"`
+
+	// (Optional) Reference to a FlinkClusterTemplate in the namespace of the
+	// cluster. The spec of the cluster is applied to the spec of the template
+	// as a JSON merge patch: the fields set in the cluster take precedence,
+	// even to zero values, null removes a field, objects and maps are merged
+	// per key, and lists replace the lists of the template. The webhook sets
+	// the defaults of the fields set by neither. Updates of the template are
+	// validated as updates of the referencing clusters, and applied to them.
+	TemplateRef *corev1.LocalObjectReference `json:"templateRef,omitempty"`
+
+	// (Optional) Keys of the labels of the cluster's namespace which are
+	// copied to all the resources of the cluster, e.g., for RBAC or billing.
+	// The labels set by the operator, i.e., `app`, `cluster`, `component`,
+	// `pool` and `version`, are not inherited. Changes and removals of the
+	// namespace labels are propagated to the existing resources, pods pick
+	// them up when they are recreated.
+	InheritNamespaceLabels []string `json:"inheritNamespaceLabels,omitempty"`
+
+	// (Optional) The prefix of the names of the resources created for the
+	// cluster, e.g., `<namingPrefix>-jobmanager`, default: the cluster name.
+	// It avoids collisions with the resources of other operators in a shared
+	// namespace, and too long names for clusters with long names. It must be
+	// a DNS-1123 label, and differ from the naming prefixes and the names of
+	// the other clusters in the namespace.
+	NamingPrefix string `json:"namingPrefix,omitempty"`
+
+	// (Optional) Collection of a diagnostics bundle when the cluster enters
+	// some states, e.g., Failed.
+	DiagnosticsBundle *DiagnosticsBundleSpec `json:"diagnosticsBundle,omitempty"`
+
+	// (Optional) The maximum time in seconds the cluster can stay in the
+	// Reconciling state, after which it is failed with the ReadinessTimeout
+	// reason. The operator doesn't create any resources for the failed cluster
+	// until its spec is updated. Default: no timeout.
+	ReadinessTimeoutSeconds *int64 `json:"readinessTimeoutSeconds,omitempty"`
+
+	// (Optional) Periodic health check of the Flink REST API of the running
+	// cluster.
+	HealthCheck *HealthCheckSpec `json:"healthCheck,omitempty"`
+}
+
+// HealthCheckSpec defines the health check of a running cluster, which
+// requests the overview of the cluster from the Flink REST API of the
+// JobManager. The cluster is Degraded after consecutive failures, e.g., when
+// the JobManager pod is ready but its REST API is unresponsive, and Running
+// again after consecutive successes.
+type HealthCheckSpec struct {
+	// Whether the health check is enabled, default: false.
+	Enabled bool `json:"enabled,omitempty"`
+
+	// The interval of the checks in seconds, default: 30.
+	IntervalSeconds *int32 `json:"intervalSeconds,omitempty"`
+
+	// The number of consecutive failed checks after which the cluster is
+	// Degraded, default: 3.
+	FailureThreshold *int32 `json:"failureThreshold,omitempty"`
+
+	// The number of consecutive successful checks after which a Degraded
+	// cluster is Running again, default: 1.
+	SuccessThreshold *int32 `json:"successThreshold,omitempty"`
+}
+
+// DiagnosticsBundleSpec defines the collection of the thread dumps, heap
+// dumps, logs and Flink metrics of the cluster pods into a tarball. The
+// collector is a Kubernetes job which runs with a dedicated service account
+// created by the operator, which can list the pods, read their logs and exec
+// into them, so that the service account of the Flink pods is not granted
+// these permissions.
+type DiagnosticsBundleSpec struct {
+	// The cluster states which trigger the collection, e.g., ["Failed"]. The
+	// bundle is collected once each time the cluster enters one of the
+	// states.
+	TriggerOnState []string `json:"triggerOnState"`
+
+	// The URI of the directory to which the bundle is uploaded. Supported
+	// schemes are "gs://", "s3://" and "http(s)://", for the latter the bundle
+	// is uploaded with a PUT request.
+	UploadURI string `json:"uploadURI"`
+
+	// Collector image, which must contain kubectl, curl, tar and the uploader
+	// of the scheme, i.e., gsutil or the aws CLI, default: google/cloud-sdk
+	// unless the scheme is "s3://", which requires an image.
+	Image string `json:"image,omitempty"`
+
+	// (Optional) Annotations of the service account of the collector, e.g.,
+	// for the Workload Identity to upload the bundle with.
+	ServiceAccountAnnotations map[string]string `json:"serviceAccountAnnotations,omitempty"`
+}
+
+// ClusterRef defines a reference to a FlinkCluster.
+type ClusterRef struct {
+	// The name of the cluster.
+	Name string `json:"name"`
+
+	// (Optional) The namespace of the cluster, which must be the namespace of
+	// the referencing cluster, default: the namespace of the referencing
+	// cluster.
+	Namespace string `json:"namespace,omitempty"`
+}
+
+// CheckpointStorageSpec defines the PersistentVolumeClaim for checkpoints.
+type CheckpointStorageSpec struct {
+	// The name of the PersistentVolumeClaim. Required when `storageClass` is
+	// not specified, default: "<clusterName>-checkpoints" when it is.
+	PVCName string `json:"pvcName,omitempty"`
+
+	// The path where to mount the volume, default: /checkpoints.
+	// `state.checkpoints.dir` points at this path.
+	MountPath string `json:"mountPath,omitempty"`
+
+	// (Optional) The storage class of the PersistentVolumeClaim. If specified,
+	// the claim is created by the operator, otherwise it must already exist.
+	// The created claim is not owned by the cluster, so the checkpoints
+	// survive the deletion of the cluster.
+	StorageClass string `json:"storageClass,omitempty"`
+
+	// The storage size of the created PersistentVolumeClaim, default: 10Gi.
+	StorageSize resource.Quantity `json:"storageSize,omitempty"`
+
+	// The access mode of the created PersistentVolumeClaim,
+	// `enum("ReadWriteMany", "ReadWriteOnce")`, default: "ReadWriteMany".
+	// The volume is shared by the JobManager and TaskManager pods, so
+	// "ReadWriteOnce" requires them to be scheduled on the same node.
+	AccessMode corev1.PersistentVolumeAccessMode `json:"accessMode,omitempty"`
+}
+
+// CheckpointConfig defines the checkpointing and the state backend of the
+// jobs. The unset fields are left to `flinkProperties` or the Flink defaults.
+type CheckpointConfig struct {
+	// The interval between checkpoints in milliseconds,
+	// `execution.checkpointing.interval`.
+	IntervalMillis int64 `json:"intervalMillis,omitempty"`
+
+	// The minimum pause between checkpoints in milliseconds,
+	// `execution.checkpointing.min-pause`.
+	MinPauseBetweenCheckpointsMillis int64 `json:"minPauseBetweenCheckpointsMillis,omitempty"`
+
+	// The maximum number of concurrent checkpoints,
+	// `execution.checkpointing.max-concurrent-checkpoints`.
+	MaxConcurrentCheckpoints int `json:"maxConcurrentCheckpoints,omitempty"`
+
+	// The state backend, `enum("filesystem", "rocksdb", "memory")`,
+	// `state.backend`.
+	StateBackend string `json:"stateBackend,omitempty"`
+
+	// The URI of the checkpoint directory, e.g., gs://my-bucket/checkpoints,
+	// `state.checkpoints.dir`. It takes precedence over `checkpointStorage`.
+	StateBackendStoragePath string `json:"stateBackendStoragePath,omitempty"`
+}
+
+// TableSpec defines configs for the Flink Table API and SQL.
+type TableSpec struct {
+	// SQL dialect, `default` or `hive`, default: `default`.
+	SQLDialect string `json:"sqlDialect,omitempty"`
+
+	// URI of the Hive metastore, e.g., thrift://hive-metastore:9083. Required
+	// when `sqlDialect` is `hive`.
+	HiveMetastoreURI string `json:"hiveMetastoreURI,omitempty"`
+
+	// Path of the Hive connector JAR file in the image, which is added to the
+	// classpath when `sqlDialect` is `hive`,
+	// default: /opt/flink/opt/flink-connector-hive.jar.
+	HiveConnectorJar string `json:"hiveConnectorJar,omitempty"`
 }
 
 // HadoopConfig defines configs for Hadoop.
@@ -357,6 +1130,208 @@ type GCPServiceAccount struct {
 	MountPath string `json:"mountPath,omitempty"`
 }
 
+// SecuritySpec defines security settings of the cluster.
+type SecuritySpec struct {
+	// Put the JobManager web UI and REST API behind an OAuth2 proxy sidecar for
+	// single sign-on, default: false. The operator and the job submitter reach
+	// the REST API on the internal port 18081 of the JobManager service, which
+	// bypasses the proxy.
+	SSOEnabled *bool `json:"ssoEnabled,omitempty"`
+
+	// OIDC config of the OAuth2 proxy, required when `ssoEnabled` is true.
+	OIDCConfig *OIDCConfig `json:"oidcConfig,omitempty"`
+
+	// (Optional) TLS of the Flink REST API, through which the operator talks
+	// to the JobManager. Flink itself must be configured to serve the REST
+	// API over HTTPS, e.g., with `security.ssl.rest.*` in `flinkProperties`.
+	RESTTLS *RESTTLSSpec `json:"restTLS,omitempty"`
+}
+
+// RESTTLSSpec defines how the operator connects to the Flink REST API over
+// TLS.
+type RESTTLSSpec struct {
+	// The name of the Secret with the PEM-encoded CA bundle `ca.crt` which
+	// verifies the server certificate, and optionally the client certificate
+	// `tls.crt` and key `tls.key` for mutual TLS. The Secret must be in the
+	// same namespace as the FlinkCluster.
+	SecretName string `json:"secretName"`
+
+	// Skip the verification of the server certificate, default: false. Only
+	// meant for testing, the connection is not protected against
+	// man-in-the-middle attacks.
+	InsecureSkipVerify bool `json:"insecureSkipVerify,omitempty"`
+}
+
+// DeploymentMode defines how the JobManager and TaskManagers of a cluster are
+// deployed.
+type DeploymentMode string
+
+// DeploymentMode enums.
+const (
+	// DeploymentModeOperator - the operator creates the JobManager and
+	// TaskManager deployments.
+	DeploymentModeOperator DeploymentMode = "operator"
+	// DeploymentModeNative - Flink creates the JobManager and TaskManager
+	// pods itself through the Kubernetes API.
+	DeploymentModeNative DeploymentMode = "native"
+)
+
+// ProxyType defines the type of the JobManager proxy.
+type ProxyType string
+
+// ProxyType enums.
+const (
+	ProxyTypeNginx ProxyType = "nginx"
+)
+
+// ProxySpec defines a reverse proxy sidecar in front of the JobManager web UI
+// and REST API. The Flink REST server listens on an internal port and the
+// proxy listens on the JobManager UI port.
+type ProxySpec struct {
+	// Type of the proxy, `enum("nginx")`, default: nginx.
+	Type ProxyType `json:"type,omitempty"`
+
+	// (Optional) Go template of nginx.conf, which can refer to `{{.ProxyPort}}`,
+	// `{{.UpstreamPort}}`, `{{.RateLimitRPM}}`, `{{.RateLimitBurst}}` and
+	// `{{.WAF}}`. Default: a config which proxies all requests to the Flink
+	// REST server, rate-limits the requests to `/jars/upload` and `/jobs`
+	// other than GET per client IP, and applies the WAF rules if enabled.
+	ConfigTemplate string `json:"configTemplate,omitempty"`
+
+	// The maximum number of rate-limited requests per minute per client IP,
+	// default: 60.
+	RateLimitRPM *int32 `json:"rateLimitRPM,omitempty"`
+
+	// The number of rate-limited requests per client IP which are accepted
+	// in a burst above the rate, default: 10.
+	RateLimitBurst *int32 `json:"rateLimitBurst,omitempty"`
+
+	// Whether the proxy rejects requests with disallowed methods and requests
+	// whose URI contains common attack patterns, e.g., path traversal, script
+	// injection or SQL injection, default: true.
+	WAF *bool `json:"waf,omitempty"`
+
+	// Proxy image, default: nginx:1.17.
+	Image string `json:"image,omitempty"`
+}
+
+// OIDCConfig defines the OpenID Connect config of the OAuth2 proxy.
+type OIDCConfig struct {
+	// OIDC issuer URL, e.g., https://accounts.google.com.
+	IssuerURL string `json:"issuerURL"`
+
+	// OAuth2 client ID.
+	ClientID string `json:"clientID"`
+
+	// The Secret key holding the OAuth2 client secret.
+	// The Secret must be in the same namespace as the FlinkCluster.
+	ClientSecretRef corev1.SecretKeySelector `json:"clientSecretRef"`
+
+	// The Secret key holding the seed of secure cookies.
+	// The Secret must be in the same namespace as the FlinkCluster.
+	CookieSecretRef corev1.SecretKeySelector `json:"cookieSecretRef"`
+
+	// OAuth2 proxy image, default: quay.io/oauth2-proxy/oauth2-proxy:v5.1.0.
+	ProxyImage string `json:"proxyImage,omitempty"`
+}
+
+// ServiceAccountSpec defines the service account of the cluster pods.
+type ServiceAccountSpec struct {
+	// Whether to create the service account along with a Role and a
+	// RoleBinding owned by the cluster, default: false. If false, the service
+	// account must already exist.
+	Create bool `json:"create,omitempty"`
+
+	// The name of the service account. Required when `create` is false,
+	// default: "<clusterName>-flink" when `create` is true.
+	Name string `json:"name,omitempty"`
+
+	// Annotations of the created service account, e.g., for binding it to a
+	// cloud IAM identity.
+	Annotations map[string]string `json:"annotations,omitempty"`
+}
+
+// NetworkingSpec defines networking settings of the cluster.
+type NetworkingSpec struct {
+	// Service mesh config.
+	ServiceMesh *ServiceMeshSpec `json:"serviceMesh,omitempty"`
+
+	// (Optional) Network policy isolating the JobManager and TaskManager pods.
+	NetworkPolicy *NetworkPolicySpec `json:"networkPolicy,omitempty"`
+}
+
+// NetworkPolicySpec defines the network policy of the cluster. When enabled,
+// the JobManager and TaskManager pods accept traffic only from the pods of
+// the cluster, except for the JobManager RPC and UI ports, including the SSO
+// proxy port, which also accept traffic from the allowed namespaces. The
+// Flink REST server behind a proxy of the UI port only accepts traffic from
+// the operator. Network policies are additive, more traffic can be allowed by
+// other policies.
+type NetworkPolicySpec struct {
+	// Whether the network policy is created, default: false.
+	Enabled bool `json:"enabled,omitempty"`
+
+	// The namespaces from which the JobManager RPC and UI ports can be
+	// reached, default: the namespace of the cluster. The namespaces are
+	// matched by the `kubernetes.io/metadata.name` label, which requires
+	// Kubernetes 1.21+, the policy is not created on older versions. The
+	// operator is always allowed.
+	AllowedNamespaces []string `json:"allowedNamespaces,omitempty"`
+
+	// Whether the pods send traffic only to the pods of the cluster and to
+	// DNS, default: false. Other destinations, e.g., the checkpoint storage
+	// or the JAR download, must then be allowed by other policies.
+	RestrictEgress bool `json:"restrictEgress,omitempty"`
+}
+
+// MonitoringSpec defines monitoring settings of the cluster.
+type MonitoringSpec struct {
+	// (Optional) Grafana dashboard of the cluster.
+	GrafanaDashboard *GrafanaDashboardSpec `json:"grafanaDashboard,omitempty"`
+}
+
+// GrafanaDashboardSpec defines the Grafana dashboard of the cluster. When
+// enabled, a ConfigMap with the dashboard JSON and the label
+// `grafana_dashboard: "1"` is created, so that the dashboard sidecar of
+// Grafana picks it up.
+type GrafanaDashboardSpec struct {
+	// Whether the dashboard ConfigMap is created, default: false.
+	Enabled bool `json:"enabled,omitempty"`
+
+	// The namespace of the dashboard ConfigMap, e.g., the namespace watched by
+	// the Grafana sidecar, default: the namespace of the cluster. Other
+	// namespaces must be allowed by the operator, see its
+	// `--grafana-dashboard-namespaces` flag.
+	Namespace string `json:"namespace,omitempty"`
+}
+
+// ServiceMeshSpec defines the Istio service mesh settings of the cluster.
+type ServiceMeshSpec struct {
+	// (Optional) Traffic splitting between two versions of a job for A/B
+	// testing.
+	TrafficSplitting *TrafficSplittingSpec `json:"trafficSplitting,omitempty"`
+}
+
+// TrafficSplittingSpec defines A/B testing of two versions of a job in a
+// session cluster. When enabled, each version runs in a job cluster
+// "<clusterName>-version-a" or "<clusterName>-version-b" owned by the cluster,
+// and an Istio VirtualService splits the traffic to the JobManager service of
+// the cluster between the JobManager services of the versions by weight.
+type TrafficSplittingSpec struct {
+	// Whether traffic splitting is enabled, default: false.
+	Enabled bool `json:"enabled,omitempty"`
+
+	// Job spec of version A.
+	VersionA JobSpec `json:"versionA"`
+
+	// Job spec of version B.
+	VersionB JobSpec `json:"versionB"`
+
+	// Percentage of the traffic routed to version A, the rest is routed to
+	// version B.
+	WeightA int32 `json:"weightA"`
+}
+
 // FlinkClusterComponentState defines the observed state of a component
 // of a FlinkCluster.
 type FlinkClusterComponentState struct {
@@ -365,6 +1340,73 @@ type FlinkClusterComponentState struct {
 
 	// The state of the component.
 	State string `json:"state"`
+
+	// (Optional) The reason of the state, e.g., MissingPullSecret when the
+	// component is not ready because its image cannot be pulled.
+	Reason string `json:"reason,omitempty"`
+
+	// (Optional) The number of replicas, only for the TaskManager deployment,
+	// which is reported by the scale subresource.
+	Replicas int32 `json:"replicas,omitempty"`
+
+	// (Optional) The pod of the elected leader, only for the JobManager
+	// deployment with Kubernetes high availability.
+	Leader string `json:"leader,omitempty"`
+
+	// (Optional) The number of replicas decided by the TaskManager autoscaler,
+	// only for the TaskManager deployment.
+	DesiredReplicas int32 `json:"desiredReplicas,omitempty"`
+
+	// (Optional) The reason of the last scaling decision of the TaskManager
+	// autoscaler, e.g., HighBackpressure.
+	ScaleReason string `json:"scaleReason,omitempty"`
+
+	// (Optional) The time of the last scaling decision of the TaskManager
+	// autoscaler.
+	LastScaleTime string `json:"lastScaleTime,omitempty"`
+
+	// (Optional) The time the TaskManagers started to be drained for a
+	// scale-down, only for the TaskManager deployment.
+	DrainStartTime string `json:"drainStartTime,omitempty"`
+
+	// (Optional) The replicas of the spec when the TaskManager autoscaler last
+	// decided, the decision is overridden when they are edited.
+	SpecReplicas int32 `json:"specReplicas,omitempty"`
+
+	// (Optional) The parallelism of the job which fills the task slots added
+	// by the TaskManager autoscaler for high backpressure. The job is
+	// rescaled to it while it is more than the parallelism of the spec.
+	AutoscaledParallelism int32 `json:"autoscaledParallelism,omitempty"`
+
+	// (Optional) The latest metrics snapshot, only for the JobManager
+	// deployment.
+	Metrics *JobManagerMetrics `json:"metrics,omitempty"`
+
+	// The last time the state of the component changed.
+	LastTransitionTime string `json:"lastTransitionTime,omitempty"`
+}
+
+// JobManagerMetrics defines a compact snapshot of the JVM metrics of the
+// JobManager, which is refreshed periodically from the Flink REST API.
+type JobManagerMetrics struct {
+	// The used heap memory in bytes.
+	HeapUsed int64 `json:"heapUsed"`
+
+	// The maximum heap memory in bytes.
+	HeapMax int64 `json:"heapMax"`
+
+	// The total number of garbage collections of all the collectors.
+	GCCount int64 `json:"gcCount"`
+
+	// The total time spent in garbage collections in milliseconds.
+	GCTimeMillis int64 `json:"gcTimeMillis"`
+
+	// The number of consecutive snapshots in which the heap usage was above
+	// the memory pressure ratio.
+	HighHeapSamples int32 `json:"highHeapSamples,omitempty"`
+
+	// The time when the snapshot was taken.
+	ObservedTime string `json:"observedTime,omitempty"`
 }
 
 // FlinkClusterComponentsStatus defines the observed status of the
@@ -385,8 +1427,41 @@ type FlinkClusterComponentsStatus struct {
 	// The state of TaskManager deployment.
 	TaskManagerDeployment FlinkClusterComponentState `json:"taskManagerDeployment"`
 
+	// The states of the deployments of the additional TaskManager pools, keyed
+	// by pool name.
+	TaskManagerPools map[string]FlinkClusterComponentState `json:"taskManagerPools,omitempty"`
+
 	// The status of the job, available only when JobSpec is provided.
 	Job *JobStatus `json:"job,omitempty"`
+
+	// The status of traffic splitting, available only when it is enabled.
+	TrafficSplitting *TrafficSplittingStatus `json:"trafficSplitting,omitempty"`
+
+	// The Grafana dashboard ConfigMap, available only while it exists.
+	GrafanaDashboard *GrafanaDashboardStatus `json:"grafanaDashboard,omitempty"`
+}
+
+// GrafanaDashboardStatus defines the Grafana dashboard ConfigMap of the
+// cluster, which is recorded so that it is found by name, e.g., in the
+// previous namespace after the dashboard namespace changed.
+type GrafanaDashboardStatus struct {
+	// The namespace of the ConfigMap.
+	Namespace string `json:"namespace"`
+
+	// The name of the ConfigMap.
+	Name string `json:"name"`
+}
+
+// TrafficSplittingStatus defines the status of traffic splitting.
+type TrafficSplittingStatus struct {
+	// The state of the VirtualService.
+	VirtualService FlinkClusterComponentState `json:"virtualService"`
+
+	// The name of the cluster of version A and the state of its job.
+	VersionA FlinkClusterComponentState `json:"versionA"`
+
+	// The name of the cluster of version B and the state of its job.
+	VersionB FlinkClusterComponentState `json:"versionB"`
 }
 
 // JobStatus defines the status of a job.
@@ -400,6 +1475,10 @@ type JobStatus struct {
 	// The state of the Kubernetes job.
 	State string `json:"state"`
 
+	// (Optional) The reason of the state, e.g., JobNotCreated when the state is
+	// Unknown because the Kubernetes job does not exist.
+	Reason string `json:"reason,omitempty"`
+
 	// The actual savepoint from which this job started.
 	// In case of restart, it might be different from the savepoint in the job
 	// spec.
@@ -419,8 +1498,69 @@ type JobStatus struct {
 	// Last successful or failed savepoint operation timestamp.
 	LastSavepointTime string `json:"lastSavepointTime,omitempty"`
 
+	// The time of the last completed checkpoint.
+	LastCheckpointTime string `json:"lastCheckpointTime,omitempty"`
+
+	// The number of consecutive failed checkpoints since the last completed
+	// one.
+	FailedCheckpoints int32 `json:"failedCheckpoints,omitempty"`
+
+	// The message of the Failed condition of the Kubernetes job, available
+	// only when the job failed, e.g., it exceeded its backoff limit.
+	FailureReason string `json:"failureReason,omitempty"`
+
 	// The number of restarts.
 	RestartCount int32 `json:"restartCount,omitempty"`
+
+	// The time after which the failed job will be restarted, available only
+	// when a restart is pending.
+	NextRestartTime string `json:"nextRestartTime,omitempty"`
+
+	// The number of attempts to submit the job through the REST API of the
+	// JobManager, available only with `submissionRetry`.
+	SubmissionAttempts int32 `json:"submissionAttempts,omitempty"`
+
+	// The time of the first attempt to submit the job, available only with
+	// `submissionRetry`.
+	FirstSubmissionTime string `json:"firstSubmissionTime,omitempty"`
+
+	// The time after which the submission will be attempted again, available
+	// only while the job is "Deploying".
+	NextSubmissionTime string `json:"nextSubmissionTime,omitempty"`
+
+	// The last time the state of the job changed.
+	LastTransitionTime string `json:"lastTransitionTime,omitempty"`
+
+	// The status of the last change of the job parallelism, available only
+	// while the job is "Rescaling" or after the rescale failed.
+	Rescale *JobRescaleStatus `json:"rescale,omitempty"`
+}
+
+// JobRescaleStatus defines the status of a change of the job parallelism,
+// which is applied by stopping the job with a savepoint and resubmitting it
+// from the savepoint.
+type JobRescaleStatus struct {
+	// The parallelism of the job before the change.
+	FromParallelism int32 `json:"fromParallelism"`
+
+	// The parallelism of the spec the job is rescaled to.
+	ToParallelism int32 `json:"toParallelism"`
+
+	// The phase of the rescale, "Stopping", "Resubmitting" or "Failed".
+	Phase string `json:"phase"`
+
+	// The trigger ID of the savepoint of the stopped job.
+	TriggerID string `json:"triggerID,omitempty"`
+
+	// The location of the savepoint the job is resubmitted from.
+	SavepointLocation string `json:"savepointLocation,omitempty"`
+
+	// The cause of the failed savepoint, available only in the "Failed"
+	// phase.
+	FailureReason string `json:"failureReason,omitempty"`
+
+	// The time when the rescale started.
+	StartTime string `json:"startTime,omitempty"`
 }
 
 // JobManagerIngressStatus defines the status of a JobManager ingress.
@@ -433,6 +1573,9 @@ type JobManagerIngressStatus struct {
 
 	// The URLs of ingress.
 	URLs []string `json:"urls,omitempty"`
+
+	// The last time the state of the component changed.
+	LastTransitionTime string `json:"lastTransitionTime,omitempty"`
 }
 
 // JobManagerServiceStatus defines the observed state of FlinkCluster
@@ -445,6 +1588,15 @@ type JobManagerServiceStatus struct {
 
 	// (Optional) The node port, present when `accessScope` is `NodePort`.
 	NodePort int32 `json:"nodePort,omitempty"`
+
+	// (Optional) The URL of the Flink Web UI, through the node IP of a
+	// JobManager pod and the node port for `NodePort`, the external address
+	// for `LoadBalancer`, and the in-cluster address for `ClusterIP`. Empty
+	// until the address is assigned.
+	WebUIURL string `json:"webUIURL,omitempty"`
+
+	// The last time the state of the component changed.
+	LastTransitionTime string `json:"lastTransitionTime,omitempty"`
 }
 
 // FlinkClusterStatus defines the observed state of FlinkCluster
@@ -455,17 +1607,188 @@ type FlinkClusterStatus struct {
 	// The overall state of the Flink cluster.
 	State string `json:"state"`
 
+	// (Optional) The reason of the state, e.g., ReadinessTimeout for Failed.
+	Reason string `json:"reason,omitempty"`
+
+	// (Optional) A human-readable summary of why the cluster is not running,
+	// e.g., "Waiting for TaskManager deployment (1/3 ready)".
+	Message string `json:"message,omitempty"`
+
+	// The number of the ready components, out of totalComponents.
+	ReadyComponents int `json:"readyComponents,omitempty"`
+
+	// The number of the components, i.e., the JobManager deployment and
+	// service, the TaskManager deployment and pools, and the optional
+	// components which exist, e.g., the JobManager ingress.
+	TotalComponents int `json:"totalComponents,omitempty"`
+
+	// (Optional) The time when the cluster entered the Reconciling state, set
+	// only while it is Reconciling.
+	ReconcilingSince string `json:"reconcilingSince,omitempty"`
+
+	// (Optional) The generation of the spec when the status was derived.
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+
 	// The status of the components.
 	Components FlinkClusterComponentsStatus `json:"components"`
 
+	// The backpressure of the vertices of the running job, available only for
+	// job clusters.
+	BackpressureStatus []VertexBackpressure `json:"backpressureStatus,omitempty"`
+
+	// The throughput and backpressure of the running job, available only for
+	// job clusters.
+	JobMetrics *JobMetrics `json:"jobMetrics,omitempty"`
+
+	// The overview of the Flink cluster reported by the JobManager.
+	Flink *FlinkStatus `json:"flink,omitempty"`
+
+	// The estimated time of a rolling update of the TaskManagers in seconds,
+	// i.e., `minReadySeconds * replicas`.
+	EstimatedRolloutSeconds int32 `json:"estimatedRolloutSeconds,omitempty"`
+
+	// The parallelism which the job can run with on the TaskManager
+	// deployment, i.e., the job parallelism capped by the task slots of the
+	// TaskManagers, available only for job clusters.
+	EffectiveParallelism int `json:"effectiveParallelism,omitempty"`
+
+	// The number of free task slots of the TaskManagers registered with the
+	// JobManager, available only when the cluster is running.
+	AvailableSlots int `json:"availableSlots,omitempty"`
+
+	// The label selector of the TaskManager pods, which is reported by the
+	// scale subresource, e.g., for the HorizontalPodAutoscaler.
+	Selector string `json:"selector,omitempty"`
+
+	// (Optional) The conditions of the cluster, e.g., QuotaExceeded.
+	Conditions []FlinkClusterCondition `json:"conditions,omitempty"`
+
+	// (Optional) The URI of the last diagnostics bundle collected.
+	LastDiagnosticsBundleURI string `json:"lastDiagnosticsBundleURI,omitempty"`
+
+	// (Optional) The time when the job succeeded, which triggers the hooks
+	// of `job.onSuccess`. It is cleared when the job runs again.
+	CompletionTime string `json:"completionTime,omitempty"`
+
+	// (Optional) The effective Flink config of the cluster, i.e., the
+	// properties of `flink-conf.yaml` in the ConfigMap generated by the
+	// operator, or in the external `flinkConfigMap`. The values of the
+	// sensitive properties, e.g., passwords, are redacted.
+	EffectiveConfig map[string]string `json:"effectiveConfig,omitempty"`
+
+	// (Optional) The checksum of the `flink-conf.yaml` of the effective Flink
+	// config, which also changes when a redacted value changes.
+	EffectiveConfigChecksum string `json:"effectiveConfigChecksum,omitempty"`
+
+	// (Optional) The recent transitions of the cluster state, oldest first,
+	// up to the last 10. Unlike events, they are not garbage-collected.
+	History []StatusTransition `json:"history,omitempty"`
+
 	// Last update timestamp for this status.
 	LastUpdateTime string `json:"lastUpdateTime,omitempty"`
 }
 
+// FlinkClusterCondition defines an observation of the cluster at a point in
+// time.
+type FlinkClusterCondition struct {
+	// The type of the condition, e.g., QuotaExceeded.
+	Type string `json:"type"`
+
+	// The status of the condition, "True", "False" or "Unknown".
+	Status corev1.ConditionStatus `json:"status"`
+
+	// (Optional) The machine-readable reason of the status.
+	Reason string `json:"reason,omitempty"`
+
+	// (Optional) The human-readable details of the status.
+	Message string `json:"message,omitempty"`
+
+	// The last time the status of the condition changed.
+	LastTransitionTime string `json:"lastTransitionTime,omitempty"`
+}
+
+// StatusTransition defines a transition of the cluster state.
+type StatusTransition struct {
+	// The time of the transition.
+	Time string `json:"time"`
+
+	// (Optional) The previous state, empty for the first state.
+	FromState string `json:"fromState,omitempty"`
+
+	// The new state.
+	ToState string `json:"toState"`
+
+	// (Optional) The reason of the new state, e.g., ReadinessTimeout.
+	Reason string `json:"reason,omitempty"`
+}
+
+// FlinkStatus defines the overview of the Flink cluster reported by the
+// JobManager REST API.
+type FlinkStatus struct {
+	// The number of running jobs.
+	JobsRunning int32 `json:"jobsRunning"`
+
+	// The number of finished jobs.
+	JobsFinished int32 `json:"jobsFinished"`
+
+	// The number of cancelled jobs.
+	JobsCancelled int32 `json:"jobsCancelled"`
+
+	// The number of failed jobs.
+	JobsFailed int32 `json:"jobsFailed"`
+
+	// The total number of task slots.
+	SlotsTotal int32 `json:"slotsTotal"`
+
+	// The number of available task slots.
+	SlotsAvailable int32 `json:"slotsAvailable"`
+
+	// True if the JobManager was unreachable in the last observation, in which
+	// case the values are from an earlier observation.
+	Stale bool `json:"stale,omitempty"`
+}
+
+// VertexBackpressure defines the backpressure of a job vertex.
+type VertexBackpressure struct {
+	// The name of the vertex.
+	VertexName string `json:"vertexName"`
+
+	// The maximum percentage of backpressured samples among the subtasks of
+	// the vertex, from 0 to 100.
+	Ratio int32 `json:"ratio"`
+
+	// The backpressure level, "OK", "LOW" or "HIGH".
+	Level string `json:"level"`
+}
+
+// JobMetrics defines the throughput and backpressure of the running job, the
+// throughput is refreshed periodically from the Flink REST API.
+type JobMetrics struct {
+	// The number of records per second emitted by the source vertex of the
+	// job.
+	RecordsPerSecondIn int64 `json:"recordsPerSecondIn"`
+
+	// The number of records per second received by the sink vertex of the
+	// job.
+	RecordsPerSecondOut int64 `json:"recordsPerSecondOut"`
+
+	// The highest backpressure level of the vertices, "OK", "LOW" or "HIGH".
+	BackpressureLevel string `json:"backpressureLevel,omitempty"`
+
+	// The time when the throughput was observed.
+	ObservedTime string `json:"observedTime,omitempty"`
+}
+
 // +kubebuilder:object:root=true
 
 // FlinkCluster is the Schema for the flinkclusters API
 // +kubebuilder:subresource:status
+// +kubebuilder:subresource:scale:specpath=.spec.taskManager.replicas,statuspath=.status.components.taskManagerDeployment.replicas,selectorpath=.status.selector
+// +kubebuilder:printcolumn:name="State",type="string",JSONPath=".status.state"
+// +kubebuilder:printcolumn:name="JobState",type="string",JSONPath=".status.components.job.state"
+// +kubebuilder:printcolumn:name="Age",type="date",JSONPath=".metadata.creationTimestamp"
+// +kubebuilder:printcolumn:name="FlinkVersion",type="string",JSONPath=".spec.flinkVersion"
+// +kubebuilder:printcolumn:name="Message",type="string",JSONPath=".status.message"
 type FlinkCluster struct {
 	metav1.TypeMeta   `json:",inline"`
 	metav1.ObjectMeta `json:"metadata,omitempty"`
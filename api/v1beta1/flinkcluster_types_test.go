@@ -17,12 +17,19 @@ limitations under the License.
 package v1beta1
 
 import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
 
 	"golang.org/x/net/context"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	metav1beta1 "k8s.io/apimachinery/pkg/apis/meta/v1beta1"
 	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/rest"
 )
 
 // These tests are written in BDD-style using Ginkgo framework. Refer to
@@ -74,4 +81,93 @@ var _ = Describe("FlinkCluster", func() {
 
 	})
 
+	Context("Printer columns", func() {
+
+		It("should populate the printer columns", func() {
+
+			var replicas int32 = 1
+			created = &FlinkCluster{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "bar",
+					Namespace: "default",
+				},
+				Spec: FlinkClusterSpec{
+					Image:        ImageSpec{Name: "flink:1.9.1"},
+					FlinkVersion: "1.9",
+					JobManager: JobManagerSpec{
+						Replicas:    &replicas,
+						AccessScope: AccessScopeCluster,
+					},
+					TaskManager: TaskManagerSpec{Replicas: 1},
+				},
+			}
+
+			By("creating an API obj")
+			Expect(k8sClient.Create(context.TODO(), created)).To(Succeed())
+
+			By("updating the status")
+			created.Status = FlinkClusterStatus{
+				State: ClusterStateRunning,
+				Components: FlinkClusterComponentsStatus{
+					ConfigMap: FlinkClusterComponentState{
+						Name: "bar-configmap", State: ComponentStateReady},
+					JobManagerDeployment: FlinkClusterComponentState{
+						Name: "bar-jobmanager", State: ComponentStateReady},
+					JobManagerService: JobManagerServiceStatus{
+						Name: "bar-jobmanager", State: ComponentStateReady},
+					TaskManagerDeployment: FlinkClusterComponentState{
+						Name: "bar-taskmanager", State: ComponentStateReady},
+					Job: &JobStatus{Name: "bar-job", State: JobStateRunning},
+				},
+			}
+			Expect(k8sClient.Status().Update(context.TODO(), created)).To(Succeed())
+
+			By("getting the object as a table")
+			var table = getFlinkClusterTable("default", "bar")
+			var columns = []string{}
+			for _, column := range table.ColumnDefinitions {
+				columns = append(columns, column.Name)
+			}
+			Expect(columns).To(Equal(
+				[]string{"Name", "State", "JobState", "Age", "FlinkVersion"}))
+			Expect(table.Rows).To(HaveLen(1))
+			var cells = table.Rows[0].Cells
+			Expect(cells[0]).To(Equal("bar"))
+			Expect(cells[1]).To(Equal(ClusterStateRunning))
+			Expect(cells[2]).To(Equal(JobStateRunning))
+			Expect(cells[3]).NotTo(BeEmpty())
+			Expect(cells[4]).To(Equal("1.9"))
+
+			By("deleting the created object")
+			Expect(k8sClient.Delete(context.TODO(), created)).To(Succeed())
+		})
+
+	})
+
 })
+
+// Gets a FlinkCluster in the table format which is used by kubectl to print
+// the columns.
+func getFlinkClusterTable(namespace string, name string) *metav1beta1.Table {
+	var transport, err = rest.TransportFor(cfg)
+	Expect(err).NotTo(HaveOccurred())
+
+	var url = fmt.Sprintf(
+		"%s/apis/%s/%s/namespaces/%s/flinkclusters/%s",
+		cfg.Host, GroupVersion.Group, GroupVersion.Version, namespace, name)
+	request, err := http.NewRequest("GET", url, nil)
+	Expect(err).NotTo(HaveOccurred())
+	request.Header.Set(
+		"Accept", "application/json;as=Table;v=v1beta1;g=meta.k8s.io")
+
+	response, err := (&http.Client{Transport: transport}).Do(request)
+	Expect(err).NotTo(HaveOccurred())
+	defer response.Body.Close()
+	Expect(response.StatusCode).To(Equal(http.StatusOK))
+
+	body, err := ioutil.ReadAll(response.Body)
+	Expect(err).NotTo(HaveOccurred())
+	var table = &metav1beta1.Table{}
+	Expect(json.Unmarshal(body, table)).To(Succeed())
+	return table
+}
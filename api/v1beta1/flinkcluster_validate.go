@@ -17,55 +17,243 @@ limitations under the License.
 package v1beta1
 
 import (
+	"context"
+	"encoding/json"
 	"fmt"
+	"io/ioutil"
+	"path"
 	"reflect"
+	"regexp"
+	"strconv"
 	"strings"
+	"text/template"
 
 	"k8s.io/apimachinery/pkg/api/resource"
 
 	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"sigs.k8s.io/controller-runtime/pkg/client"
 )
 
+// flinkVersion is the major and minor version of Flink.
+type flinkVersion struct {
+	major int
+	minor int
+}
+
+func (v flinkVersion) String() string {
+	return fmt.Sprintf("%d.%d", v.major, v.minor)
+}
+
+func (v flinkVersion) lessThan(other flinkVersion) bool {
+	return v.major < other.major ||
+		(v.major == other.major && v.minor < other.minor)
+}
+
+// The Flink versions supported by the operator.
+var supportedFlinkVersions = []flinkVersion{
+	{major: 1, minor: 7},
+	{major: 1, minor: 8},
+	{major: 1, minor: 9},
+	{major: 1, minor: 10},
+}
+
+// The minimum Flink version of the native deployment mode, i.e., of
+// `flink run-application -t kubernetes-application`.
+var nativeModeMinFlinkVersion = flinkVersion{major: 1, minor: 12}
+
+// The minimum Flink version of the Kubernetes high availability services.
+var kubernetesHAMinFlinkVersion = flinkVersion{major: 1, minor: 12}
+
+// The minimum Flink version of the SQL client which runs a SQL file, i.e., of
+// `sql-client.sh embedded -f`.
+var sqlClientMinFlinkVersion = flinkVersion{major: 1, minor: 13}
+
+// Flink properties which are only available since a certain version.
+var flinkPropertyMinVersions = map[string]flinkVersion{
+	"taskmanager.memory.process.size":      {major: 1, minor: 10},
+	"taskmanager.memory.flink.size":        {major: 1, minor: 10},
+	"taskmanager.memory.managed.fraction":  {major: 1, minor: 10},
+	"state.backend.rocksdb.memory.managed": {major: 1, minor: 10},
+	"execution.checkpointing.interval":     {major: 1, minor: 10},
+}
+
+var imageTagVersionRegex = regexp.MustCompile(`^v?(\d+)\.(\d+)`)
+
+// Flink memory sizes, e.g., "1728m" or "2 gb", all units are powers of 1024.
+var flinkMemorySizeRegex = regexp.MustCompile(`^\s*(\d+)\s*([a-zA-Z]*)\s*$`)
+
+var flinkMemoryUnits = map[string]int64{
+	"":          1,
+	"b":         1,
+	"bytes":     1,
+	"k":         1 << 10,
+	"kb":        1 << 10,
+	"kibibytes": 1 << 10,
+	"m":         1 << 20,
+	"mb":        1 << 20,
+	"mebibytes": 1 << 20,
+	"g":         1 << 30,
+	"gb":        1 << 30,
+	"gibibytes": 1 << 30,
+	"t":         1 << 40,
+	"tb":        1 << 40,
+	"tebibytes": 1 << 40,
+}
+
+// TaskManager pool names are used in deployment names and labels.
+var taskManagerPoolNameRegex = regexp.MustCompile(`^[a-z0-9]([-a-z0-9]*[a-z0-9])?$`)
+
+// Parses a Flink memory size into bytes.
+func parseFlinkMemorySize(size string) (int64, error) {
+	var match = flinkMemorySizeRegex.FindStringSubmatch(size)
+	if match == nil {
+		return 0, fmt.Errorf("invalid memory size %v", size)
+	}
+	var unit, found = flinkMemoryUnits[strings.ToLower(match[2])]
+	if !found {
+		return 0, fmt.Errorf("invalid memory unit in %v", size)
+	}
+	var value, err = strconv.ParseInt(match[1], 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid memory size %v", size)
+	}
+	return value * unit, nil
+}
+
+// Gets the Flink version from the tag of the image name, returns false if the
+// tag is not a version.
+func getFlinkVersion(imageName string) (flinkVersion, bool) {
+	// Strip the digest and the registry/repository parts, note that the
+	// registry may contain a port, e.g., "localhost:5000/flink:1.9".
+	imageName = strings.Split(imageName, "@")[0]
+	var slash = strings.LastIndex(imageName, "/")
+	var colon = strings.LastIndex(imageName, ":")
+	if colon <= slash {
+		return flinkVersion{}, false
+	}
+	var matches = imageTagVersionRegex.FindStringSubmatch(imageName[colon+1:])
+	if matches == nil {
+		return flinkVersion{}, false
+	}
+	var major, _ = strconv.Atoi(matches[1])
+	var minor, _ = strconv.Atoi(matches[2])
+	return flinkVersion{major: major, minor: minor}, true
+}
+
 // Validator validates CUD requests for the CR.
-type Validator struct{}
+type Validator struct {
+	// Reads the resources referenced by the cluster, e.g., image pull
+	// secrets. They are not checked if it is nil.
+	k8sReader client.Reader
+}
 
 // ValidateCreate validates create request.
 func (v *Validator) ValidateCreate(cluster *FlinkCluster) error {
-	var err error
-	err = v.validateMeta(&cluster.ObjectMeta)
-	if err != nil {
-		return err
-	}
-	err = v.validateHadoopConfig(cluster.Spec.HadoopConfig)
-	if err != nil {
-		return err
+	return v.validateCreate(cluster, nil)
+}
+
+// Validates the create request, rawSpec is the JSON of the spec of the
+// cluster in the request, see GetTemplatedCluster.
+func (v *Validator) validateCreate(
+	cluster *FlinkCluster, rawSpec []byte) error {
+	var errs = v.validateSpec(cluster, rawSpec)
+	if len(errs) > 0 {
+		return errs[0]
 	}
-	err = v.validateGCPConfig(cluster.Spec.GCPConfig)
-	if err != nil {
-		return err
+	return nil
+}
+
+// ValidateSpec validates the cluster and returns all the errors instead of
+// only the first one, e.g., for reporting them in the status of a cluster
+// which bypassed the validating webhook.
+func (v *Validator) ValidateSpec(cluster *FlinkCluster) []error {
+	return v.validateSpec(cluster, nil)
+}
+
+func (v *Validator) validateSpec(
+	cluster *FlinkCluster, rawSpec []byte) []error {
+	var errs []error
+	var check = func(err error) {
+		if err != nil {
+			errs = append(errs, err)
+		}
 	}
-	err = v.validateImage(&cluster.Spec.Image)
-	if err != nil {
-		return err
+	check(v.validateMeta(&cluster.ObjectMeta))
+	check(v.validateNamingPrefix(cluster.Spec.NamingPrefix))
+	check(v.validateNamingPrefixUnique(cluster))
+	// The spec of a clone is replaced by the spec of the source cluster, and
+	// validated when the clone is applied.
+	if cluster.Spec.CloneFrom != nil {
+		check(v.validateCloneFrom(cluster.Namespace, cluster.Spec.CloneFrom))
+		return errs
 	}
-	err = v.validateJobManager(&cluster.Spec.JobManager)
-	if err != nil {
-		return err
+	// The spec of a templated cluster is validated after it is merged with
+	// the template.
+	if cluster.Spec.TemplateRef != nil {
+		var templated, err = v.getTemplatedCluster(cluster, rawSpec)
+		if err != nil {
+			return append(errs, err)
+		}
+		cluster = templated
 	}
-	err = v.validateTaskManager(&cluster.Spec.TaskManager)
-	if err != nil {
-		return err
+	check(v.validateHadoopConfig(cluster.Spec.HadoopConfig))
+	check(v.validateGCPConfig(cluster.Spec.GCPConfig))
+	check(v.validateImage(&cluster.Spec.Image))
+	check(v.validatePullSecrets(cluster.Namespace, &cluster.Spec.Image))
+	// In native mode, for SQL jobs and with Kubernetes high availability, the
+	// versions which support them are checked instead.
+	var isSQLJob = cluster.Spec.Job != nil && cluster.Spec.Job.SQLJob != nil
+	if cluster.Spec.DeploymentMode != DeploymentModeNative && !isSQLJob &&
+		!IsKubernetesHAEnabled(cluster.Spec.FlinkProperties) {
+		check(v.validateFlinkVersion(
+			&cluster.Spec.Image, cluster.Spec.FlinkProperties))
 	}
-	err = v.validateJob(cluster.Spec.Job)
-	if err != nil {
-		return err
+	check(v.validateDeploymentMode(cluster))
+	check(v.validateJobManager(
+		&cluster.Spec.JobManager, cluster.Spec.FlinkProperties))
+	check(v.validateKubernetesHA(cluster))
+	check(v.validateTaskManager(&cluster.Spec.TaskManager))
+	check(v.validateTaskManagerMemory(
+		&cluster.Spec.TaskManager, cluster.Spec.FlinkProperties))
+	check(v.validateJob(cluster.Spec.Job))
+	check(v.validateSQLJobFlinkVersion(cluster))
+	check(v.validateTaskSlots(cluster))
+	check(v.validateSecurity(cluster.Spec.Security))
+	check(v.validateJobManagerProxy(
+		cluster.Spec.JobManagerProxy, cluster.Spec.Security))
+	check(v.validateNetworking(cluster.Spec.Networking, cluster.Spec.Job))
+	check(v.validateMonitoring(cluster.Spec.Monitoring))
+	check(v.validateServiceAccount(cluster.Spec.ServiceAccount))
+	check(v.validateTable(cluster.Spec.Table))
+	check(v.validateCheckpointStorage(cluster.Spec.CheckpointStorage))
+	check(v.validateCheckpointConfig(cluster.Spec.CheckpointConfig))
+	check(v.validateDiagnosticsBundle(cluster.Spec.DiagnosticsBundle))
+	check(v.validateHealthCheck(cluster.Spec.HealthCheck))
+	var readinessTimeout = cluster.Spec.ReadinessTimeoutSeconds
+	if readinessTimeout != nil && *readinessTimeout <= 0 {
+		check(fmt.Errorf("readinessTimeoutSeconds must be > 0"))
 	}
-	return nil
+	return errs
 }
 
 // ValidateUpdate validates update request.
 func (v *Validator) ValidateUpdate(old *FlinkCluster, new *FlinkCluster) error {
+	return v.validateUpdate(old, new, nil)
+}
+
+// Validates the update request, rawSpec is the JSON of the spec of the new
+// cluster in the request, see GetTemplatedCluster.
+func (v *Validator) validateUpdate(
+	old *FlinkCluster, new *FlinkCluster, rawSpec []byte) error {
+	// Compare the clusters with the defaults set, so that the defaults added
+	// by a newer version of the mutating webhook are not taken as updates of
+	// the clusters created before.
+	old, new = getDefaultedCluster(old), getDefaultedCluster(new)
+
 	cancelRequested, err := v.checkCancelRequested(old, new)
 	if err != nil {
 		return err
@@ -74,6 +262,16 @@ func (v *Validator) ValidateUpdate(old *FlinkCluster, new *FlinkCluster) error {
 		return nil
 	}
 
+	// The cluster has no resources until the clone is applied, so the spec
+	// is validated as on creation instead of being checked for immutability.
+	cloneApplied, err := v.checkCloneFrom(old, new)
+	if err != nil {
+		return err
+	}
+	if cloneApplied {
+		return v.validateCreate(new, rawSpec)
+	}
+
 	savepointGenUpdated, err := v.checkSavepointGeneration(old, new)
 	if err != nil {
 		return err
@@ -82,6 +280,22 @@ func (v *Validator) ValidateUpdate(old *FlinkCluster, new *FlinkCluster) error {
 		return nil
 	}
 
+	replicasUpdated, err := v.checkTaskManagerReplicas(old, new)
+	if err != nil {
+		return err
+	}
+	if replicasUpdated {
+		return nil
+	}
+
+	parallelismUpdated, err := v.checkJobParallelism(old, new)
+	if err != nil {
+		return err
+	}
+	if parallelismUpdated {
+		return nil
+	}
+
 	if !reflect.DeepEqual(new.Spec, old.Spec) {
 		return fmt.Errorf("the cluster properties are immutable")
 	}
@@ -89,6 +303,17 @@ func (v *Validator) ValidateUpdate(old *FlinkCluster, new *FlinkCluster) error {
 	return nil
 }
 
+// Gets a copy of the cluster with the defaults set as by the mutating
+// webhook, which doesn't set the defaults of a templated cluster.
+func getDefaultedCluster(cluster *FlinkCluster) *FlinkCluster {
+	if cluster.Spec.TemplateRef != nil {
+		return cluster
+	}
+	var defaulted = cluster.DeepCopy()
+	_SetDefault(defaulted)
+	return defaulted
+}
+
 func (v *Validator) checkCancelRequested(
 	old *FlinkCluster, new *FlinkCluster) (bool, error) {
 	if old.Spec.Job == nil || new.Spec.Job == nil {
@@ -141,6 +366,184 @@ func (v *Validator) checkSavepointGeneration(
 	return reflect.DeepEqual(new.Spec, oldCopy.Spec), nil
 }
 
+// Checks whether only the TaskManager replicas are updated, e.g., through the
+// scale subresource.
+func (v *Validator) checkTaskManagerReplicas(
+	old *FlinkCluster, new *FlinkCluster) (bool, error) {
+	var newReplicas = new.Spec.TaskManager.Replicas
+	if old.Spec.TaskManager.Replicas == newReplicas {
+		return false, nil
+	}
+	if newReplicas < 1 {
+		return false, fmt.Errorf("invalid TaskManager replicas, it must >= 1")
+	}
+
+	var oldCopy = old.DeepCopy()
+	oldCopy.Spec.TaskManager.Replicas = newReplicas
+	return reflect.DeepEqual(new.Spec, oldCopy.Spec), nil
+}
+
+// Checks whether only the job parallelism is updated, which is applied by
+// stopping the job with a savepoint and resubmitting it from the savepoint,
+// so it requires `savepointsDir` and the job submitter.
+func (v *Validator) checkJobParallelism(
+	old *FlinkCluster, new *FlinkCluster) (bool, error) {
+	if old.Spec.Job == nil || new.Spec.Job == nil {
+		return false, nil
+	}
+	var newParallelism = new.Spec.Job.Parallelism
+	if reflect.DeepEqual(old.Spec.Job.Parallelism, newParallelism) {
+		return false, nil
+	}
+	if newParallelism == nil || *newParallelism < 1 {
+		return false, fmt.Errorf("job parallelism must be >= 1")
+	}
+	if new.Spec.Job.SavepointsDir == nil {
+		return false, fmt.Errorf(
+			"updating job parallelism requires savepointsDir")
+	}
+	if new.Spec.DeploymentMode == DeploymentModeNative ||
+		len(new.Spec.Job.StreamGraphJSON) > 0 ||
+		new.Spec.Job.SubmissionRetry != nil {
+		return false, fmt.Errorf(
+			"updating job parallelism is only supported for jobs submitted by the job submitter")
+	}
+	var err = v.validateTaskSlots(new)
+	if err != nil {
+		return false, err
+	}
+
+	var oldCopy = old.DeepCopy()
+	oldCopy.Spec.Job.Parallelism = newParallelism
+	return reflect.DeepEqual(new.Spec, oldCopy.Spec), nil
+}
+
+// Checks that `cloneFrom` is not added or changed, returns true if the clone
+// is being applied, i.e., the spec is replaced and `cloneFrom` is removed.
+func (v *Validator) checkCloneFrom(
+	old *FlinkCluster, new *FlinkCluster) (bool, error) {
+	if new.Spec.CloneFrom != nil &&
+		!reflect.DeepEqual(new.Spec.CloneFrom, old.Spec.CloneFrom) {
+		return false, fmt.Errorf("cloneFrom is only allowed at creation time")
+	}
+	return old.Spec.CloneFrom != nil && new.Spec.CloneFrom == nil, nil
+}
+
+// Merges the spec of the cluster with the referenced template. The cluster is
+// returned as is if the validator can't read the template, in which case it
+// is expected to be merged by the caller, e.g., the operator.
+func (v *Validator) getTemplatedCluster(
+	cluster *FlinkCluster, rawSpec []byte) (*FlinkCluster, error) {
+	var template, err = v.getTemplate(cluster)
+	if err != nil {
+		return nil, err
+	}
+	if template == nil {
+		return cluster, nil
+	}
+	return GetTemplatedCluster(cluster, rawSpec, template)
+}
+
+// Gets the template referenced by the cluster, nil if the validator can't
+// read it.
+func (v *Validator) getTemplate(
+	cluster *FlinkCluster) (*FlinkClusterTemplate, error) {
+	var templateName = cluster.Spec.TemplateRef.Name
+	if len(templateName) == 0 {
+		return nil, fmt.Errorf("templateRef name is unspecified")
+	}
+	if v.k8sReader == nil {
+		return nil, nil
+	}
+	var template = FlinkClusterTemplate{}
+	var err = v.k8sReader.Get(
+		context.Background(),
+		types.NamespacedName{Namespace: cluster.Namespace, Name: templateName},
+		&template)
+	if errors.IsNotFound(err) {
+		return nil, fmt.Errorf(
+			"cluster template %v does not exist in namespace %v",
+			templateName, cluster.Namespace)
+	}
+	if err != nil {
+		return nil, fmt.Errorf(
+			"failed to get cluster template %v: %v", templateName, err)
+	}
+	return &template, nil
+}
+
+// ValidateTemplateCreate validates create request of a template. The template
+// can be partial, so it is validated merged with the clusters which already
+// reference it.
+func (v *Validator) ValidateTemplateCreate(
+	template *FlinkClusterTemplate) error {
+	return v.validateTemplate(nil, template)
+}
+
+// ValidateTemplateUpdate validates update request of a template. The update
+// is validated as an update of each cluster referencing the template, so that
+// it can't change the immutable fields of the clusters.
+func (v *Validator) ValidateTemplateUpdate(
+	old *FlinkClusterTemplate, new *FlinkClusterTemplate) error {
+	return v.validateTemplate(old, new)
+}
+
+// Validates the new template merged with the clusters referencing it, and the
+// change from the old template if it is not nil.
+func (v *Validator) validateTemplate(
+	old *FlinkClusterTemplate, new *FlinkClusterTemplate) error {
+	if len(new.Name) == 0 {
+		return fmt.Errorf("template name is unspecified")
+	}
+	if v.k8sReader == nil {
+		return nil
+	}
+	var clusters = FlinkClusterList{}
+	var err = v.k8sReader.List(
+		context.Background(), &clusters, client.InNamespace(new.Namespace))
+	if err != nil {
+		return fmt.Errorf("failed to list the clusters: %v", err)
+	}
+	for i := range clusters.Items {
+		var cluster = &clusters.Items[i]
+		var templateRef = cluster.Spec.TemplateRef
+		if templateRef == nil || templateRef.Name != new.Name ||
+			cluster.DeletionTimestamp != nil {
+			continue
+		}
+		rawSpec, err := GetRawClusterSpec(
+			context.Background(), v.k8sReader, cluster.Namespace, cluster.Name)
+		if err != nil {
+			return fmt.Errorf(
+				"failed to get the spec of cluster %v: %v", cluster.Name, err)
+		}
+		newCluster, err := GetTemplatedCluster(cluster, rawSpec, new)
+		if err != nil {
+			return fmt.Errorf(
+				"failed to merge the template with cluster %v: %v",
+				cluster.Name, err)
+		}
+		// The merged clusters are validated without looking up the template
+		// again.
+		newCluster.Spec.TemplateRef = nil
+		if old == nil {
+			err = v.ValidateCreate(newCluster)
+		} else {
+			var oldCluster *FlinkCluster
+			oldCluster, err = GetTemplatedCluster(cluster, rawSpec, old)
+			if err == nil {
+				oldCluster.Spec.TemplateRef = nil
+				err = v.ValidateUpdate(oldCluster, newCluster)
+			}
+		}
+		if err != nil {
+			return fmt.Errorf(
+				"invalid template for cluster %v: %v", cluster.Name, err)
+		}
+	}
+	return nil
+}
+
 func (v *Validator) validateMeta(meta *metav1.ObjectMeta) error {
 	if len(meta.Name) == 0 {
 		return fmt.Errorf("cluster name is unspecified")
@@ -151,6 +554,118 @@ func (v *Validator) validateMeta(meta *metav1.ObjectMeta) error {
 	return nil
 }
 
+// The naming prefix is used in the names of all the resources of the cluster
+// instead of the cluster name.
+func (v *Validator) validateNamingPrefix(namingPrefix string) error {
+	if len(namingPrefix) == 0 {
+		return nil
+	}
+	var errs = validation.IsDNS1123Label(namingPrefix)
+	if len(errs) > 0 {
+		return fmt.Errorf(
+			"invalid namingPrefix: %v", strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+// Gets the prefix of the names of the resources of the cluster.
+func getNamingPrefix(cluster *FlinkCluster) string {
+	if len(cluster.Spec.NamingPrefix) > 0 {
+		return cluster.Spec.NamingPrefix
+	}
+	return cluster.Name
+}
+
+// The naming prefix of the cluster must differ from the naming prefixes and
+// the names of the other clusters in the namespace, otherwise the clusters
+// would share their resources.
+func (v *Validator) validateNamingPrefixUnique(cluster *FlinkCluster) error {
+	if v.k8sReader == nil {
+		return nil
+	}
+	var clusters = FlinkClusterList{}
+	var err = v.k8sReader.List(
+		context.Background(), &clusters, client.InNamespace(cluster.Namespace))
+	if err != nil {
+		return fmt.Errorf("failed to list the clusters: %v", err)
+	}
+	var prefix = getNamingPrefix(cluster)
+	for i := range clusters.Items {
+		var other = &clusters.Items[i]
+		if other.Name == cluster.Name {
+			continue
+		}
+		if prefix == getNamingPrefix(other) || prefix == other.Name {
+			return fmt.Errorf(
+				"naming prefix %v collides with the resources of cluster %v",
+				prefix, other.Name)
+		}
+	}
+	return nil
+}
+
+// In native mode, Flink deploys an application cluster for the JAR file of
+// the job, so the features which rely on the deployments, the services or the
+// job submitter of the operator are not supported.
+func (v *Validator) validateDeploymentMode(cluster *FlinkCluster) error {
+	var spec = &cluster.Spec
+	switch spec.DeploymentMode {
+	case "", DeploymentModeOperator:
+		return nil
+	case DeploymentModeNative:
+	default:
+		return fmt.Errorf("invalid deploymentMode: %v", spec.DeploymentMode)
+	}
+
+	var version, ok = getFlinkVersion(spec.Image.Name)
+	if ok && version.lessThan(nativeModeMinFlinkVersion) {
+		return fmt.Errorf(
+			"native deploymentMode requires Flink %v or later, but image %v is Flink %v",
+			nativeModeMinFlinkVersion, spec.Image.Name, version)
+	}
+	var jobSpec = spec.Job
+	if jobSpec == nil {
+		return fmt.Errorf("native deploymentMode requires a job")
+	}
+	if len(jobSpec.JarFile) == 0 || len(jobSpec.JarURI) > 0 ||
+		len(jobSpec.PythonScript) > 0 || jobSpec.SQLJob != nil ||
+		len(jobSpec.StreamGraphJSON) > 0 || jobSpec.SubmissionRetry != nil {
+		return fmt.Errorf(
+			"native deploymentMode requires job jarFile without jarURI, pythonScript, sqlJob, streamGraphJSON and submissionRetry")
+	}
+	if strings.Contains(jobSpec.JarFile, "://") &&
+		!strings.HasPrefix(jobSpec.JarFile, "local://") {
+		return fmt.Errorf(
+			"native deploymentMode requires job jarFile in the image: %v",
+			jobSpec.JarFile)
+	}
+	// The failed job is restarted by Flink according to its restart strategy.
+	if jobSpec.RestartPolicy != nil &&
+		*jobSpec.RestartPolicy != JobRestartPolicyNever {
+		return fmt.Errorf(
+			"native deploymentMode requires job restartPolicy Never")
+	}
+	if len(spec.TaskManager.Pools) > 0 ||
+		len(spec.TaskManager.VolumeClaimTemplates) > 0 {
+		return fmt.Errorf(
+			"native deploymentMode does not support TaskManager pools and volumeClaimTemplates")
+	}
+	if spec.JobManagerProxy != nil {
+		return fmt.Errorf(
+			"native deploymentMode does not support jobManagerProxy")
+	}
+	if spec.Suspend {
+		return fmt.Errorf("native deploymentMode does not support suspend")
+	}
+	if spec.Networking != nil && spec.Networking.ServiceMesh != nil &&
+		spec.Networking.ServiceMesh.TrafficSplitting != nil &&
+		spec.Networking.ServiceMesh.TrafficSplitting.Enabled {
+		return fmt.Errorf(
+			"native deploymentMode does not support traffic splitting")
+	}
+	return nil
+}
+
 func (v *Validator) validateHadoopConfig(hadoopConfig *HadoopConfig) error {
 	if hadoopConfig == nil {
 		return nil
@@ -200,11 +715,103 @@ func (v *Validator) validateImage(imageSpec *ImageSpec) error {
 	return nil
 }
 
-func (v *Validator) validateJobManager(jmSpec *JobManagerSpec) error {
+// Checks that the referenced image pull secrets exist, so that a cluster with
+// a missing secret is rejected instead of its pods failing to pull the image.
+func (v *Validator) validatePullSecrets(
+	namespace string, imageSpec *ImageSpec) error {
+	if v.k8sReader == nil {
+		return nil
+	}
+	for _, pullSecret := range imageSpec.PullSecrets {
+		var secret = corev1.Secret{}
+		var err = v.k8sReader.Get(
+			context.Background(),
+			types.NamespacedName{Namespace: namespace, Name: pullSecret.Name},
+			&secret)
+		if errors.IsNotFound(err) {
+			return fmt.Errorf(
+				"image pull secret %v does not exist in namespace %v",
+				pullSecret.Name, namespace)
+		}
+		if err != nil {
+			return fmt.Errorf(
+				"failed to get image pull secret %v: %v", pullSecret.Name, err)
+		}
+	}
+	return nil
+}
+
+// Checks the Kubernetes high availability, which needs Flink 1.12+ and a
+// storage directory for the JobManager metadata.
+func (v *Validator) validateKubernetesHA(cluster *FlinkCluster) error {
+	var properties = cluster.Spec.FlinkProperties
+	if !IsKubernetesHAEnabled(properties) {
+		return nil
+	}
+	var imageName = cluster.Spec.Image.Name
+	var version, ok = getFlinkVersion(imageName)
+	if ok && version.lessThan(kubernetesHAMinFlinkVersion) {
+		return fmt.Errorf(
+			"Kubernetes high availability requires Flink %v or later, but image %v is Flink %v",
+			kubernetesHAMinFlinkVersion, imageName, version)
+	}
+	if len(properties["high-availability.storageDir"]) == 0 {
+		return fmt.Errorf(
+			"flink property high-availability.storageDir is required for Kubernetes high availability")
+	}
+	return nil
+}
+
+// Checks the Flink version of the image against the supported versions and
+// the Flink properties. The version is inferred from the image tag, e.g.,
+// "flink:1.8.1-scala_2.12"; images with a tag which is not a version (e.g.,
+// "latest" or custom builds) are not checked.
+func (v *Validator) validateFlinkVersion(
+	imageSpec *ImageSpec, properties map[string]string) error {
+	var version, ok = getFlinkVersion(imageSpec.Name)
+	if !ok {
+		return nil
+	}
+
+	var supported = false
+	for _, supportedVersion := range supportedFlinkVersions {
+		if version == supportedVersion {
+			supported = true
+			break
+		}
+	}
+	if !supported {
+		var versions []string
+		for _, supportedVersion := range supportedFlinkVersions {
+			versions = append(versions, supportedVersion.String())
+		}
+		return fmt.Errorf(
+			"unsupported Flink version %v in image %v, supported versions: %v",
+			version, imageSpec.Name, strings.Join(versions, ", "))
+	}
+
+	for key := range properties {
+		var minVersion, found = flinkPropertyMinVersions[key]
+		if found && version.lessThan(minVersion) {
+			return fmt.Errorf(
+				"flink property %v requires Flink %v or later, but image %v is Flink %v",
+				key, minVersion, imageSpec.Name, version)
+		}
+	}
+
+	return nil
+}
+
+func (v *Validator) validateJobManager(
+	jmSpec *JobManagerSpec, properties map[string]string) error {
 	var err error
 
-	// Replicas.
-	if jmSpec.Replicas == nil || *jmSpec.Replicas != 1 {
+	// Replicas, the standby replicas need Kubernetes high availability.
+	if IsKubernetesHAEnabled(properties) {
+		if jmSpec.Replicas == nil || *jmSpec.Replicas < 1 {
+			return fmt.Errorf("invalid JobManager replicas, it must be >= 1")
+		}
+	} else if jmSpec.Replicas == nil || *jmSpec.Replicas != 1 {
 		return fmt.Errorf("invalid JobManager replicas, it must be 1")
 	}
 
@@ -248,6 +855,12 @@ func (v *Validator) validateJobManager(jmSpec *JobManagerSpec) error {
 		return err
 	}
 
+	// Probes.
+	err = v.validateProbes(jmSpec.Probes, "jobmanager")
+	if err != nil {
+		return err
+	}
+
 	return nil
 }
 
@@ -257,6 +870,13 @@ func (v *Validator) validateTaskManager(tmSpec *TaskManagerSpec) error {
 		return fmt.Errorf("invalid TaskManager replicas, it must >= 1")
 	}
 
+	// SlotsPerTask.
+	if tmSpec.SlotsPerTask != nil && *tmSpec.SlotsPerTask < 1 {
+		return fmt.Errorf(
+			"invalid TaskManager slotsPerTask %v, it must >= 1",
+			*tmSpec.SlotsPerTask)
+	}
+
 	// Ports.
 	var err error
 	err = v.validatePort(tmSpec.Ports.RPC, "rpc", "taskmanager")
@@ -284,40 +904,416 @@ func (v *Validator) validateTaskManager(tmSpec *TaskManagerSpec) error {
 		return err
 	}
 
-	return nil
-}
-
-func (v *Validator) validateJob(jobSpec *JobSpec) error {
-	if jobSpec == nil {
-		return nil
+	// VolumeClaimTemplates.
+	err = v.validateVolumeClaimTemplates(tmSpec)
+	if err != nil {
+		return err
 	}
 
-	if len(jobSpec.JarFile) == 0 {
-		return fmt.Errorf("job jarFile is unspecified")
+	// EmptyDirVolumes.
+	err = v.validateEmptyDirVolumes(tmSpec)
+	if err != nil {
+		return err
 	}
 
-	if jobSpec.Parallelism == nil {
-		return fmt.Errorf("job parallelism is unspecified")
-	}
-	if *jobSpec.Parallelism < 1 {
-		return fmt.Errorf("job parallelism must be >= 1")
+	// MinReadySeconds
+	if tmSpec.MinReadySeconds < 0 || tmSpec.MinReadySeconds > 600 {
+		return fmt.Errorf(
+			"invalid TaskManager minReadySeconds %v, it must be between 0 and 600",
+			tmSpec.MinReadySeconds)
 	}
 
-	if jobSpec.RestartPolicy == nil {
-		return fmt.Errorf("job restartPolicy is unspecified")
-	}
-	switch *jobSpec.RestartPolicy {
-	case JobRestartPolicyNever:
-	case JobRestartPolicyFromSavepointOnFailure:
-	default:
-		return fmt.Errorf("invalid job restartPolicy: %v", *jobSpec.RestartPolicy)
+	// TerminationGracePeriodSeconds
+	var gracePeriod = tmSpec.TerminationGracePeriodSeconds
+	if gracePeriod != nil && *gracePeriod < 0 {
+		return fmt.Errorf(
+			"invalid TaskManager terminationGracePeriodSeconds %v, it must >= 0",
+			*gracePeriod)
 	}
 
-	if jobSpec.CleanupPolicy == nil {
-		return fmt.Errorf("job cleanupPolicy is unspecified")
+	// Autoscaling.
+	err = v.validateTaskManagerAutoscaling(tmSpec)
+	if err != nil {
+		return err
 	}
-	var err = v.validateCleanupAction(
-		"cleanupPolicy.afterJobSucceeds", jobSpec.CleanupPolicy.AfterJobSucceeds)
+
+	// Probes.
+	err = v.validateProbes(tmSpec.Probes, "taskmanager")
+	if err != nil {
+		return err
+	}
+
+	// Pools.
+	var poolNames = map[string]bool{}
+	for _, pool := range tmSpec.Pools {
+		err = v.validateTaskManagerPool(&pool, &tmSpec.MemoryOffHeapMin)
+		if err != nil {
+			return err
+		}
+		if poolNames[pool.Name] {
+			return fmt.Errorf("duplicate TaskManager pool name: %v", pool.Name)
+		}
+		poolNames[pool.Name] = true
+	}
+
+	return nil
+}
+
+// Checks that the total process memory of Flink fits in the memory limit of
+// the TaskManager container, otherwise the container is OOMKilled when Flink
+// uses the memory it is configured with.
+func (v *Validator) validateTaskManagerMemory(
+	tmSpec *TaskManagerSpec, properties map[string]string) error {
+	var processSize, found = properties["taskmanager.memory.process.size"]
+	if !found {
+		return nil
+	}
+	var limit, limited = tmSpec.Resources.Limits[corev1.ResourceMemory]
+	if !limited {
+		return nil
+	}
+	var processBytes, err = parseFlinkMemorySize(processSize)
+	if err != nil {
+		return fmt.Errorf(
+			"invalid flink property taskmanager.memory.process.size: %v", err)
+	}
+	if processBytes > limit.Value() {
+		return fmt.Errorf(
+			"flink property taskmanager.memory.process.size %v exceeds the TaskManager memory limit %v",
+			processSize, limit.String())
+	}
+	return nil
+}
+
+// Validates the volume claim templates of the TaskManagers, whose names must be
+// unique among the volumes of the pods.
+func (v *Validator) validateVolumeClaimTemplates(tmSpec *TaskManagerSpec) error {
+	var volumeNames = map[string]bool{}
+	for _, volume := range tmSpec.Volumes {
+		volumeNames[volume.Name] = true
+	}
+	for _, claim := range tmSpec.VolumeClaimTemplates {
+		if len(claim.Name) == 0 {
+			return fmt.Errorf("TaskManager volume claim template name is unspecified")
+		}
+		if volumeNames[claim.Name] {
+			return fmt.Errorf(
+				"duplicate TaskManager volume name: %v", claim.Name)
+		}
+		volumeNames[claim.Name] = true
+	}
+	return nil
+}
+
+// Validates the ephemeral volumes of the TaskManagers, whose names must be
+// unique among the volumes of the pods and whose mount paths must be unique
+// among the volume mounts of the containers.
+func (v *Validator) validateEmptyDirVolumes(tmSpec *TaskManagerSpec) error {
+	var volumeNames = map[string]bool{}
+	for _, volume := range tmSpec.Volumes {
+		volumeNames[volume.Name] = true
+	}
+	for _, claim := range tmSpec.VolumeClaimTemplates {
+		volumeNames[claim.Name] = true
+	}
+	var mountPaths = map[string]bool{}
+	for _, mount := range tmSpec.VolumeMounts {
+		mountPaths[mount.MountPath] = true
+	}
+	for _, volume := range tmSpec.EmptyDirVolumes {
+		if len(volume.Name) == 0 {
+			return fmt.Errorf("TaskManager emptyDir volume name is unspecified")
+		}
+		if volumeNames[volume.Name] {
+			return fmt.Errorf(
+				"duplicate TaskManager volume name: %v", volume.Name)
+		}
+		volumeNames[volume.Name] = true
+		if len(volume.MountPath) == 0 {
+			return fmt.Errorf(
+				"TaskManager emptyDir volume %v mountPath is unspecified",
+				volume.Name)
+		}
+		if mountPaths[volume.MountPath] {
+			return fmt.Errorf(
+				"duplicate TaskManager volume mount path: %v", volume.MountPath)
+		}
+		mountPaths[volume.MountPath] = true
+		if volume.SizeLimit.Sign() < 0 {
+			return fmt.Errorf(
+				"invalid TaskManager emptyDir volume %v sizeLimit, it must >= 0",
+				volume.Name)
+		}
+		switch volume.Medium {
+		case corev1.StorageMediumDefault, corev1.StorageMediumMemory:
+		default:
+			return fmt.Errorf(
+				"invalid TaskManager emptyDir volume %v medium: %v",
+				volume.Name, volume.Medium)
+		}
+	}
+	return nil
+}
+
+func (v *Validator) validateTaskManagerAutoscaling(
+	tmSpec *TaskManagerSpec) error {
+	if tmSpec.MaxReplicas == nil {
+		if tmSpec.MinReplicas != nil {
+			return fmt.Errorf(
+				"TaskManager minReplicas is specified without maxReplicas")
+		}
+		return nil
+	}
+	if tmSpec.MinReplicas == nil {
+		return fmt.Errorf("TaskManager minReplicas is unspecified")
+	}
+	if *tmSpec.MinReplicas < 1 {
+		return fmt.Errorf("invalid TaskManager minReplicas, it must >= 1")
+	}
+	if *tmSpec.MaxReplicas < *tmSpec.MinReplicas {
+		return fmt.Errorf(
+			"invalid TaskManager maxReplicas %v, it must >= minReplicas %v",
+			*tmSpec.MaxReplicas, *tmSpec.MinReplicas)
+	}
+	if tmSpec.AutoscaleCooldownSeconds == nil {
+		return fmt.Errorf("TaskManager autoscaleCooldownSeconds is unspecified")
+	}
+	if *tmSpec.AutoscaleCooldownSeconds < 0 {
+		return fmt.Errorf(
+			"invalid TaskManager autoscaleCooldownSeconds, it must >= 0")
+	}
+	return nil
+}
+
+func (v *Validator) validateTaskManagerPool(
+	pool *TaskManagerPoolSpec, memoryOffHeapMin *resource.Quantity) error {
+	if len(pool.Name) == 0 {
+		return fmt.Errorf("TaskManager pool name is unspecified")
+	}
+	if !taskManagerPoolNameRegex.MatchString(pool.Name) {
+		return fmt.Errorf("invalid TaskManager pool name: %v", pool.Name)
+	}
+	if pool.Replicas < 1 {
+		return fmt.Errorf(
+			"invalid TaskManager pool %v replicas, it must >= 1", pool.Name)
+	}
+	if pool.Resources != nil {
+		var err = v.validateMemoryOffHeapMin(
+			memoryOffHeapMin, pool.Resources.Limits.Memory(), "taskmanager")
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Checks that the TaskManagers can provide enough task slots for the job
+// parallelism when autoscaling, because the autoscaler never scales them
+// beyond maxReplicas. Without autoscaling, the replicas default to the
+// required number, and a shortfall of explicit replicas is reported in the
+// status.
+func (v *Validator) validateTaskSlots(cluster *FlinkCluster) error {
+	var jobSpec = cluster.Spec.Job
+	var tmSpec = &cluster.Spec.TaskManager
+	if jobSpec == nil || jobSpec.Parallelism == nil || tmSpec.MaxReplicas == nil {
+		return nil
+	}
+	var replicas = *tmSpec.MaxReplicas
+	for _, pool := range tmSpec.Pools {
+		replicas += pool.Replicas
+	}
+	var totalSlots = replicas * getTaskSlotsPerTaskManager(&cluster.Spec)
+	if totalSlots < *jobSpec.Parallelism {
+		return fmt.Errorf(
+			"job parallelism %v exceeds the %v task slots of the TaskManagers at maxReplicas",
+			*jobSpec.Parallelism, totalSlots)
+	}
+	return nil
+}
+
+// Gets the number of task slots of each TaskManager, which is
+// `taskmanager.numberOfTaskSlots` of the Flink properties if specified,
+// otherwise `taskManager.slotsPerTask`, default: 1.
+func getTaskSlotsPerTaskManager(spec *FlinkClusterSpec) int32 {
+	var slots, err = strconv.ParseInt(
+		spec.FlinkProperties["taskmanager.numberOfTaskSlots"], 10, 32)
+	if err == nil && slots >= 1 {
+		return int32(slots)
+	}
+	var slotsPerTask = spec.TaskManager.SlotsPerTask
+	if slotsPerTask != nil && *slotsPerTask >= 1 {
+		return *slotsPerTask
+	}
+	return 1
+}
+
+func (v *Validator) validateSQLJob(jobSpec *JobSpec) error {
+	if len(jobSpec.JarURI) > 0 {
+		return fmt.Errorf("job jarURI and sqlJob cannot be both specified")
+	}
+	if len(jobSpec.JarFile) > 0 || len(jobSpec.PythonScript) > 0 {
+		return fmt.Errorf(
+			"job sqlJob cannot be specified with jarFile or pythonScript")
+	}
+	if len(jobSpec.SQLJob.ConfigMapRef) == 0 {
+		return fmt.Errorf("job sqlJob configMapRef is unspecified")
+	}
+	if len(jobSpec.SQLJob.StatementFile) == 0 {
+		return fmt.Errorf("job sqlJob statementFile is unspecified")
+	}
+	return nil
+}
+
+// Validates that the image of a SQL job supports the SQL client. The version
+// is unknown if the image tag is not a version, which is allowed.
+func (v *Validator) validateSQLJobFlinkVersion(cluster *FlinkCluster) error {
+	var jobSpec = cluster.Spec.Job
+	if jobSpec == nil || jobSpec.SQLJob == nil {
+		return nil
+	}
+	var imageName = cluster.Spec.Image.Name
+	var version, ok = getFlinkVersion(imageName)
+	if ok && version.lessThan(sqlClientMinFlinkVersion) {
+		return fmt.Errorf(
+			"job sqlJob requires Flink %v or later, but image %v is Flink %v",
+			sqlClientMinFlinkVersion, imageName, version)
+	}
+	return nil
+}
+
+func (v *Validator) validateJob(jobSpec *JobSpec) error {
+	if jobSpec == nil {
+		return nil
+	}
+
+	if jobSpec.SQLJob != nil {
+		if err := v.validateSQLJob(jobSpec); err != nil {
+			return err
+		}
+	} else if len(jobSpec.JarFile) == 0 && len(jobSpec.PythonScript) == 0 {
+		return fmt.Errorf("job jarFile or pythonScript is unspecified")
+	}
+	if len(jobSpec.JarFile) > 0 && len(jobSpec.PythonScript) > 0 {
+		return fmt.Errorf("job jarFile and pythonScript cannot be both specified")
+	}
+	if len(jobSpec.PythonRequirements) > 0 && len(jobSpec.PythonScript) == 0 {
+		return fmt.Errorf("job pythonRequirements requires pythonScript")
+	}
+	if len(jobSpec.JarURI) > 0 {
+		if len(jobSpec.PythonScript) > 0 {
+			return fmt.Errorf("job jarURI and pythonScript cannot be both specified")
+		}
+		var uri = jobSpec.JarURI
+		if !strings.HasPrefix(uri, "gs://") && !strings.HasPrefix(uri, "s3://") &&
+			!strings.HasPrefix(uri, "http://") && !strings.HasPrefix(uri, "https://") {
+			return fmt.Errorf("invalid job jarURI: %v", uri)
+		}
+		// The JAR is downloaded to a file with the base name of the path.
+		var uriPath = strings.SplitN(uri, "?", 2)[0]
+		var fileName = path.Base(uriPath)
+		if strings.HasSuffix(uriPath, "/") || fileName == "." ||
+			fileName == ".." || !strings.Contains(
+			strings.SplitN(uriPath, "://", 2)[1], "/") {
+			return fmt.Errorf("job jarURI is not the URI of a file: %v", uri)
+		}
+		if len(jobSpec.JarFile) > 0 &&
+			jobSpec.JarFile != GetDownloadedJarFile(uri) {
+			return fmt.Errorf(
+				"job jarFile must be the downloaded file %v of jarURI, but it is %v",
+				GetDownloadedJarFile(uri), jobSpec.JarFile)
+		}
+		if len(jobSpec.JarDownloaderImage) == 0 {
+			return fmt.Errorf("job jarDownloaderImage is unspecified")
+		}
+	}
+	if len(jobSpec.StreamGraphJSON) > 0 {
+		if len(jobSpec.JarFile) == 0 {
+			return fmt.Errorf("job streamGraphJSON requires jarFile")
+		}
+		if err := v.validateStreamGraphJSON(jobSpec.StreamGraphJSON); err != nil {
+			return err
+		}
+	}
+
+	if jobSpec.Parallelism == nil {
+		return fmt.Errorf("job parallelism is unspecified")
+	}
+	if *jobSpec.Parallelism < 1 {
+		return fmt.Errorf("job parallelism must be >= 1")
+	}
+
+	if jobSpec.RestartPolicy == nil {
+		return fmt.Errorf("job restartPolicy is unspecified")
+	}
+	switch *jobSpec.RestartPolicy {
+	case JobRestartPolicyNever:
+	case JobRestartPolicyFromSavepointOnFailure:
+	case JobRestartPolicyOnFailure:
+	default:
+		return fmt.Errorf("invalid job restartPolicy: %v", *jobSpec.RestartPolicy)
+	}
+
+	if jobSpec.RestartBackoff != nil {
+		if jobSpec.RestartBackoff.MaxAttempts < 0 {
+			return fmt.Errorf("job restartBackoff.maxAttempts must be >= 0")
+		}
+		if jobSpec.RestartBackoff.InitialBackoffSeconds < 0 {
+			return fmt.Errorf(
+				"job restartBackoff.initialBackoffSeconds must be >= 0")
+		}
+		if jobSpec.RestartBackoff.BackoffMultiplier < 1 {
+			return fmt.Errorf("job restartBackoff.backoffMultiplier must be >= 1")
+		}
+	}
+
+	if jobSpec.SubmitJobTimeoutSeconds != nil &&
+		*jobSpec.SubmitJobTimeoutSeconds <= 0 {
+		return fmt.Errorf("job submitJobTimeoutSeconds must be > 0")
+	}
+
+	if jobSpec.SubmissionRetry != nil {
+		var retry = jobSpec.SubmissionRetry
+		if len(jobSpec.JarFile) == 0 || len(jobSpec.PythonScript) > 0 ||
+			jobSpec.SQLJob != nil || len(jobSpec.StreamGraphJSON) > 0 {
+			return fmt.Errorf(
+				"job submissionRetry requires jarFile without pythonScript, sqlJob and streamGraphJSON")
+		}
+		if retry.DeadlineSeconds <= 0 {
+			return fmt.Errorf("job submissionRetry.deadlineSeconds must be > 0")
+		}
+		if retry.InitialBackoffSeconds < 0 {
+			return fmt.Errorf(
+				"job submissionRetry.initialBackoffSeconds must be >= 0")
+		}
+		if retry.BackoffMultiplier < 1 {
+			return fmt.Errorf("job submissionRetry.backoffMultiplier must be >= 1")
+		}
+		if retry.MaxBackoffSeconds < retry.InitialBackoffSeconds {
+			return fmt.Errorf(
+				"job submissionRetry.maxBackoffSeconds must be >= initialBackoffSeconds")
+		}
+	}
+
+	if jobSpec.CheckpointHealth != nil {
+		if jobSpec.CheckpointHealth.MaxConsecutiveFailures < 1 {
+			return fmt.Errorf(
+				"job checkpointHealth.maxConsecutiveFailures must be >= 1")
+		}
+		if jobSpec.CheckpointHealth.MaxCheckpointAgeSeconds < 0 {
+			return fmt.Errorf(
+				"job checkpointHealth.maxCheckpointAgeSeconds must be >= 0")
+		}
+	}
+
+	if err := v.validateJobSuccessHooks(jobSpec.OnSuccess); err != nil {
+		return err
+	}
+
+	if jobSpec.CleanupPolicy == nil {
+		return fmt.Errorf("job cleanupPolicy is unspecified")
+	}
+	var err = v.validateCleanupAction(
+		"cleanupPolicy.afterJobSucceeds", jobSpec.CleanupPolicy.AfterJobSucceeds)
 	if err != nil {
 		return err
 	}
@@ -335,6 +1331,162 @@ func (v *Validator) validateJob(jobSpec *JobSpec) error {
 	return nil
 }
 
+func (v *Validator) validateJobSuccessHooks(onSuccess *JobSuccessHooks) error {
+	if onSuccess == nil {
+		return nil
+	}
+	if len(onSuccess.WebhookURL) == 0 && len(onSuccess.TriggerJobName) == 0 {
+		return fmt.Errorf("job onSuccess requires webhookURL or triggerJobName")
+	}
+	var url = onSuccess.WebhookURL
+	if len(url) > 0 && !strings.HasPrefix(url, "http://") &&
+		!strings.HasPrefix(url, "https://") {
+		return fmt.Errorf("invalid job onSuccess.webhookURL: %v", url)
+	}
+	if len(onSuccess.TriggerJobName) > 0 {
+		var errs = validation.IsDNS1123Subdomain(onSuccess.TriggerJobName)
+		if len(errs) > 0 {
+			return fmt.Errorf(
+				"invalid job onSuccess.triggerJobName: %v",
+				strings.Join(errs, "; "))
+		}
+	} else if len(onSuccess.Annotations) > 0 {
+		return fmt.Errorf("job onSuccess.annotations requires triggerJobName")
+	}
+	return nil
+}
+
+// streamGraph is the execution plan JSON of a Flink job, e.g.,
+// {"nodes":[{"id":1,...},{"id":2,...,"predecessors":[{"id":1,...}]}]}.
+type streamGraph struct {
+	Nodes []streamGraphNode `json:"nodes"`
+}
+
+type streamGraphNode struct {
+	ID           *int                  `json:"id"`
+	Predecessors []streamGraphNodeLink `json:"predecessors,omitempty"`
+}
+
+type streamGraphNodeLink struct {
+	ID int `json:"id"`
+}
+
+func (v *Validator) validateStreamGraphJSON(streamGraphJSON string) error {
+	var graph = streamGraph{}
+	var err = json.Unmarshal([]byte(streamGraphJSON), &graph)
+	if err != nil {
+		return fmt.Errorf("invalid job streamGraphJSON: %v", err)
+	}
+	if len(graph.Nodes) == 0 {
+		return fmt.Errorf("job streamGraphJSON has no nodes")
+	}
+	var nodeIDs = make(map[int]bool)
+	for i, node := range graph.Nodes {
+		if node.ID == nil {
+			return fmt.Errorf("job streamGraphJSON node %d has no id", i)
+		}
+		nodeIDs[*node.ID] = true
+	}
+	var hasRoot = false
+	for _, node := range graph.Nodes {
+		if len(node.Predecessors) == 0 {
+			hasRoot = true
+		}
+		for _, predecessor := range node.Predecessors {
+			if !nodeIDs[predecessor.ID] {
+				return fmt.Errorf(
+					"job streamGraphJSON node %d has unknown predecessor %d",
+					*node.ID, predecessor.ID)
+			}
+		}
+	}
+	if !hasRoot {
+		return fmt.Errorf(
+			"job streamGraphJSON has no root node without predecessors")
+	}
+	return nil
+}
+
+func (v *Validator) validateSecurity(security *SecuritySpec) error {
+	if security == nil {
+		return nil
+	}
+	if security.RESTTLS != nil && len(security.RESTTLS.SecretName) == 0 {
+		return fmt.Errorf("restTLS secretName is unspecified")
+	}
+	if security.SSOEnabled == nil || !*security.SSOEnabled {
+		return nil
+	}
+	var oidcConfig = security.OIDCConfig
+	if oidcConfig == nil {
+		return fmt.Errorf("OIDC config is unspecified")
+	}
+	if len(oidcConfig.IssuerURL) == 0 {
+		return fmt.Errorf("OIDC issuer URL is unspecified")
+	}
+	if len(oidcConfig.ClientID) == 0 {
+		return fmt.Errorf("OIDC client ID is unspecified")
+	}
+	if len(oidcConfig.ClientSecretRef.Name) == 0 ||
+		len(oidcConfig.ClientSecretRef.Key) == 0 {
+		return fmt.Errorf("OIDC client secret is unspecified")
+	}
+	if len(oidcConfig.CookieSecretRef.Name) == 0 ||
+		len(oidcConfig.CookieSecretRef.Key) == 0 {
+		return fmt.Errorf("OIDC cookie secret is unspecified")
+	}
+	if len(oidcConfig.ProxyImage) == 0 {
+		return fmt.Errorf("OAuth2 proxy image is unspecified")
+	}
+	return nil
+}
+
+func (v *Validator) validateJobManagerProxy(
+	proxy *ProxySpec, security *SecuritySpec) error {
+	if proxy == nil {
+		return nil
+	}
+	if security != nil && security.SSOEnabled != nil && *security.SSOEnabled {
+		return fmt.Errorf("jobManagerProxy cannot be used with SSO")
+	}
+	switch proxy.Type {
+	case ProxyTypeNginx:
+	default:
+		return fmt.Errorf("invalid jobManagerProxy type: %v", proxy.Type)
+	}
+	if proxy.RateLimitRPM == nil {
+		return fmt.Errorf("jobManagerProxy rateLimitRPM is unspecified")
+	}
+	if *proxy.RateLimitRPM < 1 {
+		return fmt.Errorf("jobManagerProxy rateLimitRPM must be >= 1")
+	}
+	if proxy.RateLimitBurst != nil && *proxy.RateLimitBurst < 0 {
+		return fmt.Errorf("jobManagerProxy rateLimitBurst must be >= 0")
+	}
+	if len(proxy.Image) == 0 {
+		return fmt.Errorf("jobManagerProxy image is unspecified")
+	}
+	if len(proxy.ConfigTemplate) > 0 {
+		// Render the template with sample values to catch unknown fields.
+		var configTemplate, err = template.New("nginx.conf").
+			Option("missingkey=error").
+			Parse(proxy.ConfigTemplate)
+		if err == nil {
+			err = configTemplate.Execute(ioutil.Discard, map[string]interface{}{
+				"ProxyPort":      8081,
+				"UpstreamPort":   18081,
+				"RateLimitRPM":   *proxy.RateLimitRPM,
+				"RateLimitBurst": 10,
+				"WAF":            true,
+			})
+		}
+		if err != nil {
+			return fmt.Errorf("invalid jobManagerProxy configTemplate: %v", err)
+		}
+	}
+	return nil
+}
+
 func (v *Validator) validatePort(
 	port *int32, name string, component string) error {
 	if port == nil {
@@ -381,3 +1533,236 @@ func (v *Validator) validateMemoryOffHeapMin(
 	}
 	return nil
 }
+
+func (v *Validator) validateNetworking(
+	networking *NetworkingSpec, jobSpec *JobSpec) error {
+	if networking != nil && networking.NetworkPolicy != nil {
+		for _, namespace := range networking.NetworkPolicy.AllowedNamespaces {
+			if len(validation.IsDNS1123Label(namespace)) > 0 {
+				return fmt.Errorf(
+					"invalid network policy allowedNamespaces: %v", namespace)
+			}
+		}
+	}
+
+	if networking == nil || networking.ServiceMesh == nil ||
+		networking.ServiceMesh.TrafficSplitting == nil ||
+		!networking.ServiceMesh.TrafficSplitting.Enabled {
+		return nil
+	}
+	var trafficSplitting = networking.ServiceMesh.TrafficSplitting
+
+	if jobSpec != nil {
+		return fmt.Errorf("traffic splitting is not supported for job clusters")
+	}
+	if trafficSplitting.WeightA < 0 || trafficSplitting.WeightA > 100 {
+		return fmt.Errorf("traffic splitting weightA must be in [0, 100]")
+	}
+	var err = v.validateJob(&trafficSplitting.VersionA)
+	if err != nil {
+		return fmt.Errorf("traffic splitting versionA: %v", err)
+	}
+	err = v.validateJob(&trafficSplitting.VersionB)
+	if err != nil {
+		return fmt.Errorf("traffic splitting versionB: %v", err)
+	}
+	return nil
+}
+
+func (v *Validator) validateMonitoring(monitoring *MonitoringSpec) error {
+	if monitoring == nil || monitoring.GrafanaDashboard == nil {
+		return nil
+	}
+	var namespace = monitoring.GrafanaDashboard.Namespace
+	if len(namespace) > 0 && len(validation.IsDNS1123Label(namespace)) > 0 {
+		return fmt.Errorf("invalid Grafana dashboard namespace: %v", namespace)
+	}
+	return nil
+}
+
+func (v *Validator) validateServiceAccount(
+	serviceAccount *ServiceAccountSpec) error {
+	if serviceAccount == nil {
+		return nil
+	}
+	if len(serviceAccount.Name) == 0 {
+		return fmt.Errorf("service account name is unspecified")
+	}
+	if !serviceAccount.Create && len(serviceAccount.Annotations) > 0 {
+		return fmt.Errorf(
+			"service account annotations are only supported when create is true")
+	}
+	return nil
+}
+
+func (v *Validator) validateTable(table *TableSpec) error {
+	if table == nil {
+		return nil
+	}
+	switch table.SQLDialect {
+	case SQLDialectDefault:
+	case SQLDialectHive:
+		if len(table.HiveMetastoreURI) == 0 {
+			return fmt.Errorf(
+				"hiveMetastoreURI is required when sqlDialect is hive")
+		}
+	default:
+		return fmt.Errorf("invalid sqlDialect: %v", table.SQLDialect)
+	}
+	return nil
+}
+
+func (v *Validator) validateCheckpointStorage(
+	checkpointStorage *CheckpointStorageSpec) error {
+	if checkpointStorage == nil {
+		return nil
+	}
+	if len(checkpointStorage.PVCName) == 0 {
+		return fmt.Errorf("checkpoint storage pvcName is unspecified")
+	}
+	if !strings.HasPrefix(checkpointStorage.MountPath, "/") {
+		return fmt.Errorf(
+			"checkpoint storage mountPath must be an absolute path: %v",
+			checkpointStorage.MountPath)
+	}
+	switch checkpointStorage.AccessMode {
+	case "", corev1.ReadWriteMany, corev1.ReadWriteOnce:
+	default:
+		return fmt.Errorf(
+			"invalid checkpoint storage accessMode: %v",
+			checkpointStorage.AccessMode)
+	}
+	return nil
+}
+
+func (v *Validator) validateCheckpointConfig(
+	checkpointConfig *CheckpointConfig) error {
+	if checkpointConfig == nil {
+		return nil
+	}
+	if checkpointConfig.IntervalMillis < 0 {
+		return fmt.Errorf("checkpointConfig intervalMillis must be >= 0")
+	}
+	if checkpointConfig.MinPauseBetweenCheckpointsMillis < 0 {
+		return fmt.Errorf(
+			"checkpointConfig minPauseBetweenCheckpointsMillis must be >= 0")
+	}
+	if checkpointConfig.MaxConcurrentCheckpoints < 0 {
+		return fmt.Errorf("checkpointConfig maxConcurrentCheckpoints must be >= 0")
+	}
+	switch checkpointConfig.StateBackend {
+	case "", StateBackendFilesystem, StateBackendRocksDB, StateBackendMemory:
+	default:
+		return fmt.Errorf(
+			"invalid checkpointConfig stateBackend: %v",
+			checkpointConfig.StateBackend)
+	}
+	return nil
+}
+
+func (v *Validator) validateDiagnosticsBundle(
+	diagnosticsBundle *DiagnosticsBundleSpec) error {
+	if diagnosticsBundle == nil {
+		return nil
+	}
+	if len(diagnosticsBundle.TriggerOnState) == 0 {
+		return fmt.Errorf("diagnosticsBundle triggerOnState is unspecified")
+	}
+	for _, state := range diagnosticsBundle.TriggerOnState {
+		switch state {
+		case ClusterStateCreating, ClusterStateRunning, ClusterStateReconciling,
+			ClusterStateStopping, ClusterStatePartiallyStopped,
+			ClusterStateStopped, ClusterStateFailed, ClusterStateSuspending,
+			ClusterStateSuspended, ClusterStateDegraded:
+		default:
+			return fmt.Errorf(
+				"invalid diagnosticsBundle triggerOnState: %v", state)
+		}
+	}
+	var uri = diagnosticsBundle.UploadURI
+	if !strings.HasPrefix(uri, "gs://") && !strings.HasPrefix(uri, "s3://") &&
+		!strings.HasPrefix(uri, "http://") && !strings.HasPrefix(uri, "https://") {
+		return fmt.Errorf("invalid diagnosticsBundle uploadURI: %v", uri)
+	}
+	if len(diagnosticsBundle.Image) == 0 {
+		if strings.HasPrefix(uri, "s3://") {
+			return fmt.Errorf(
+				"diagnosticsBundle image with the aws CLI is required for s3:// uploadURI")
+		}
+		return fmt.Errorf("diagnosticsBundle image is unspecified")
+	}
+	return nil
+}
+
+// Only clusters in the same namespace can be cloned, so that the spec of a
+// cluster, e.g., its secrets, can't be copied by users of other namespaces.
+func (v *Validator) validateCloneFrom(
+	namespace string, cloneFrom *ClusterRef) error {
+	if len(cloneFrom.Name) == 0 {
+		return fmt.Errorf("cloneFrom cluster name is unspecified")
+	}
+	if len(cloneFrom.Namespace) > 0 && cloneFrom.Namespace != namespace {
+		return fmt.Errorf(
+			"cloneFrom cluster must be in the namespace of the cluster: %v",
+			cloneFrom.Namespace)
+	}
+	return nil
+}
+
+func (v *Validator) validateProbes(probes *ProbesSpec, component string) error {
+	if probes == nil {
+		return nil
+	}
+	var err = v.validateProbeThresholds(probes.Liveness, "liveness", component)
+	if err != nil {
+		return err
+	}
+	return v.validateProbeThresholds(probes.Readiness, "readiness", component)
+}
+
+func (v *Validator) validateProbeThresholds(
+	thresholds *ProbeThresholds, probe string, component string) error {
+	if thresholds == nil {
+		return nil
+	}
+	if thresholds.InitialDelaySeconds != nil &&
+		*thresholds.InitialDelaySeconds < 0 {
+		return fmt.Errorf(
+			"invalid %v %v probe initialDelaySeconds, it must be >= 0",
+			component, probe)
+	}
+	var positives = []struct {
+		name  string
+		value *int32
+	}{
+		{"periodSeconds", thresholds.PeriodSeconds},
+		{"timeoutSeconds", thresholds.TimeoutSeconds},
+		{"failureThreshold", thresholds.FailureThreshold},
+	}
+	for _, field := range positives {
+		if field.value != nil && *field.value <= 0 {
+			return fmt.Errorf(
+				"invalid %v %v probe %v, it must be > 0",
+				component, probe, field.name)
+		}
+	}
+	return nil
+}
+
+func (v *Validator) validateHealthCheck(healthCheck *HealthCheckSpec) error {
+	if healthCheck == nil {
+		return nil
+	}
+	if healthCheck.IntervalSeconds != nil && *healthCheck.IntervalSeconds <= 0 {
+		return fmt.Errorf("healthCheck intervalSeconds must be > 0")
+	}
+	if healthCheck.FailureThreshold != nil &&
+		*healthCheck.FailureThreshold <= 0 {
+		return fmt.Errorf("healthCheck failureThreshold must be > 0")
+	}
+	if healthCheck.SuccessThreshold != nil &&
+		*healthCheck.SuccessThreshold <= 0 {
+		return fmt.Errorf("healthCheck successThreshold must be > 0")
+	}
+	return nil
+}
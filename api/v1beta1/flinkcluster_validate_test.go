@@ -17,6 +17,7 @@ limitations under the License.
 package v1beta1
 
 import (
+	"strings"
 	"testing"
 
 	"k8s.io/apimachinery/pkg/api/resource"
@@ -24,6 +25,9 @@ import (
 	"gotest.tools/assert"
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
 )
 
 func TestValidateCreate(t *testing.T) {
@@ -96,6 +100,33 @@ func TestValidateCreate(t *testing.T) {
 	assert.NilError(t, err, "create validation failed unexpectedly")
 }
 
+func TestValidateSpec(t *testing.T) {
+	var cluster = FlinkCluster{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "mycluster",
+			Namespace: "default",
+		},
+	}
+	var validator = &Validator{}
+	var errs = validator.ValidateSpec(&cluster)
+	var messages []string
+	for _, err := range errs {
+		messages = append(messages, err.Error())
+	}
+	assert.DeepEqual(
+		t,
+		messages,
+		[]string{
+			"image name is unspecified",
+			"invalid JobManager replicas, it must be 1",
+			"invalid TaskManager replicas, it must >= 1",
+		})
+
+	// ValidateCreate returns the first error.
+	var err = validator.ValidateCreate(&cluster)
+	assert.Error(t, err, "image name is unspecified")
+}
+
 func TestInvalidImageSpec(t *testing.T) {
 	var validator = &Validator{}
 
@@ -344,6 +375,225 @@ func TestInvalidTaskManagerSpec(t *testing.T) {
 	assert.Equal(t, err.Error(), expectedErr)
 }
 
+func TestInvalidTaskManagerMinReadySeconds(t *testing.T) {
+	var validator = &Validator{}
+	var rpcPort int32 = 8001
+	var dataPort int32 = 8005
+	var queryPort int32 = 8002
+	var memoryOffHeapRatio int32 = 25
+	var tmSpec = TaskManagerSpec{
+		Replicas: 3,
+		Ports: TaskManagerPorts{
+			RPC:   &rpcPort,
+			Data:  &dataPort,
+			Query: &queryPort,
+		},
+		MemoryOffHeapRatio: &memoryOffHeapRatio,
+		MemoryOffHeapMin:   resource.MustParse("600M"),
+		MinReadySeconds:    601,
+	}
+	var err = validator.validateTaskManager(&tmSpec)
+	var expectedErr = "invalid TaskManager minReadySeconds 601, it must be between 0 and 600"
+	assert.Assert(t, err != nil, "err is not expected to be nil")
+	assert.Equal(t, err.Error(), expectedErr)
+
+	tmSpec.MinReadySeconds = 600
+	err = validator.validateTaskManager(&tmSpec)
+	assert.NilError(t, err)
+}
+
+func TestInvalidTaskManagerTerminationGracePeriod(t *testing.T) {
+	var validator = &Validator{}
+	var rpcPort int32 = 8001
+	var dataPort int32 = 8005
+	var queryPort int32 = 8002
+	var memoryOffHeapRatio int32 = 25
+	var gracePeriod int64 = -1
+	var tmSpec = TaskManagerSpec{
+		Replicas: 3,
+		Ports: TaskManagerPorts{
+			RPC:   &rpcPort,
+			Data:  &dataPort,
+			Query: &queryPort,
+		},
+		MemoryOffHeapRatio:            &memoryOffHeapRatio,
+		MemoryOffHeapMin:              resource.MustParse("600M"),
+		TerminationGracePeriodSeconds: &gracePeriod,
+	}
+	var err = validator.validateTaskManager(&tmSpec)
+	assert.Error(
+		t,
+		err,
+		"invalid TaskManager terminationGracePeriodSeconds -1, it must >= 0")
+
+	gracePeriod = 0
+	err = validator.validateTaskManager(&tmSpec)
+	assert.NilError(t, err)
+}
+
+func TestInvalidTaskManagerProbes(t *testing.T) {
+	var validator = &Validator{}
+	var rpcPort int32 = 8001
+	var dataPort int32 = 8005
+	var queryPort int32 = 8002
+	var memoryOffHeapRatio int32 = 25
+	var initialDelaySeconds int32 = -1
+	var periodSeconds int32 = 0
+	var tmSpec = TaskManagerSpec{
+		Replicas: 3,
+		Ports: TaskManagerPorts{
+			RPC:   &rpcPort,
+			Data:  &dataPort,
+			Query: &queryPort,
+		},
+		MemoryOffHeapRatio: &memoryOffHeapRatio,
+		MemoryOffHeapMin:   resource.MustParse("600M"),
+		Probes: &ProbesSpec{
+			Readiness: &ProbeThresholds{
+				InitialDelaySeconds: &initialDelaySeconds,
+			},
+		},
+	}
+	var err = validator.validateTaskManager(&tmSpec)
+	assert.Error(
+		t,
+		err,
+		"invalid taskmanager readiness probe initialDelaySeconds, it must be >= 0")
+
+	initialDelaySeconds = 0
+	tmSpec.Probes.Liveness = &ProbeThresholds{PeriodSeconds: &periodSeconds}
+	err = validator.validateTaskManager(&tmSpec)
+	assert.Error(
+		t, err, "invalid taskmanager liveness probe periodSeconds, it must be > 0")
+
+	periodSeconds = 30
+	err = validator.validateTaskManager(&tmSpec)
+	assert.NilError(t, err)
+}
+
+func TestInvalidTaskManagerSlotsPerTask(t *testing.T) {
+	var validator = &Validator{}
+	var rpcPort int32 = 8001
+	var dataPort int32 = 8005
+	var queryPort int32 = 8002
+	var memoryOffHeapRatio int32 = 25
+	var slotsPerTask int32 = 0
+	var tmSpec = TaskManagerSpec{
+		Replicas:     3,
+		SlotsPerTask: &slotsPerTask,
+		Ports: TaskManagerPorts{
+			RPC:   &rpcPort,
+			Data:  &dataPort,
+			Query: &queryPort,
+		},
+		MemoryOffHeapRatio: &memoryOffHeapRatio,
+		MemoryOffHeapMin:   resource.MustParse("600M"),
+	}
+	var err = validator.validateTaskManager(&tmSpec)
+	var expectedErr = "invalid TaskManager slotsPerTask 0, it must >= 1"
+	assert.Assert(t, err != nil, "err is not expected to be nil")
+	assert.Equal(t, err.Error(), expectedErr)
+
+	slotsPerTask = 4
+	err = validator.validateTaskManager(&tmSpec)
+	assert.NilError(t, err)
+}
+
+func TestInvalidTaskManagerVolumeClaimTemplates(t *testing.T) {
+	var validator = &Validator{}
+	var tmSpec = TaskManagerSpec{
+		Volumes: []corev1.Volume{{Name: "rocksdb"}},
+		VolumeClaimTemplates: []corev1.PersistentVolumeClaim{{
+			ObjectMeta: metav1.ObjectMeta{Name: "rocksdb"},
+		}},
+	}
+	var err = validator.validateVolumeClaimTemplates(&tmSpec)
+	assert.Equal(t, err.Error(), "duplicate TaskManager volume name: rocksdb")
+
+	tmSpec.VolumeClaimTemplates[0].Name = ""
+	err = validator.validateVolumeClaimTemplates(&tmSpec)
+	assert.Equal(
+		t, err.Error(), "TaskManager volume claim template name is unspecified")
+
+	tmSpec.VolumeClaimTemplates[0].Name = "rocksdb-state"
+	err = validator.validateVolumeClaimTemplates(&tmSpec)
+	assert.NilError(t, err)
+}
+
+func TestInvalidTaskManagerEmptyDirVolumes(t *testing.T) {
+	var validator = &Validator{}
+	var tmSpec = TaskManagerSpec{
+		Volumes:      []corev1.Volume{{Name: "rocksdb"}},
+		VolumeMounts: []corev1.VolumeMount{{Name: "rocksdb", MountPath: "/data"}},
+		EmptyDirVolumes: []EmptyDirVolumeSpec{{
+			Name:      "rocksdb",
+			MountPath: "/tmp/rocksdb",
+			SizeLimit: resource.MustParse("1Gi"),
+			Medium:    corev1.StorageMediumMemory,
+		}},
+	}
+	var err = validator.validateEmptyDirVolumes(&tmSpec)
+	assert.Equal(t, err.Error(), "duplicate TaskManager volume name: rocksdb")
+
+	tmSpec.EmptyDirVolumes[0].Name = ""
+	err = validator.validateEmptyDirVolumes(&tmSpec)
+	assert.Equal(
+		t, err.Error(), "TaskManager emptyDir volume name is unspecified")
+
+	tmSpec.EmptyDirVolumes[0].Name = "rocksdb-local"
+	tmSpec.EmptyDirVolumes[0].MountPath = "/data"
+	err = validator.validateEmptyDirVolumes(&tmSpec)
+	assert.Equal(
+		t, err.Error(), "duplicate TaskManager volume mount path: /data")
+
+	tmSpec.EmptyDirVolumes[0].MountPath = "/tmp/rocksdb"
+	tmSpec.EmptyDirVolumes[0].Medium = "HugePages"
+	err = validator.validateEmptyDirVolumes(&tmSpec)
+	assert.Equal(
+		t,
+		err.Error(),
+		"invalid TaskManager emptyDir volume rocksdb-local medium: HugePages")
+
+	tmSpec.EmptyDirVolumes[0].Medium = corev1.StorageMediumMemory
+	err = validator.validateEmptyDirVolumes(&tmSpec)
+	assert.NilError(t, err)
+}
+
+func TestInvalidTaskManagerMemory(t *testing.T) {
+	var validator = &Validator{}
+	var tmSpec = TaskManagerSpec{
+		Resources: corev1.ResourceRequirements{
+			Limits: map[corev1.ResourceName]resource.Quantity{
+				corev1.ResourceMemory: resource.MustParse("2Gi"),
+			},
+		},
+	}
+
+	var err = validator.validateTaskManagerMemory(
+		&tmSpec, map[string]string{"taskmanager.memory.process.size": "3g"})
+	var expectedErr = "flink property taskmanager.memory.process.size 3g " +
+		"exceeds the TaskManager memory limit 2Gi"
+	assert.Assert(t, err != nil, "err is not expected to be nil")
+	assert.Equal(t, err.Error(), expectedErr)
+
+	err = validator.validateTaskManagerMemory(
+		&tmSpec, map[string]string{"taskmanager.memory.process.size": "1x"})
+	expectedErr = "invalid flink property taskmanager.memory.process.size: " +
+		"invalid memory unit in 1x"
+	assert.Assert(t, err != nil, "err is not expected to be nil")
+	assert.Equal(t, err.Error(), expectedErr)
+
+	err = validator.validateTaskManagerMemory(
+		&tmSpec, map[string]string{"taskmanager.memory.process.size": "2048 mb"})
+	assert.NilError(t, err)
+
+	// Not checked without a memory limit.
+	tmSpec.Resources = corev1.ResourceRequirements{}
+	err = validator.validateTaskManagerMemory(
+		&tmSpec, map[string]string{"taskmanager.memory.process.size": "3g"})
+	assert.NilError(t, err)
+}
+
 func TestInvalidJobSpec(t *testing.T) {
 	var jmReplicas int32 = 1
 	var rpcPort int32 = 8001
@@ -397,7 +647,7 @@ func TestInvalidJobSpec(t *testing.T) {
 		},
 	}
 	var err = validator.ValidateCreate(&cluster)
-	var expectedErr = "job jarFile is unspecified"
+	var expectedErr = "job jarFile or pythonScript is unspecified"
 	assert.Equal(t, err.Error(), expectedErr)
 
 	cluster = FlinkCluster{
@@ -531,6 +781,256 @@ func TestInvalidJobSpec(t *testing.T) {
 	err = validator.ValidateCreate(&cluster)
 	expectedErr = "invalid cleanupPolicy.afterJobSucceeds: XXX"
 	assert.Equal(t, err.Error(), expectedErr)
+
+	cluster = FlinkCluster{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "mycluster",
+			Namespace: "default",
+		},
+		Spec: FlinkClusterSpec{
+			Image: ImageSpec{
+				Name:       "flink:1.8.1",
+				PullPolicy: corev1.PullPolicy("Always"),
+			},
+			JobManager: JobManagerSpec{
+				Replicas:    &jmReplicas,
+				AccessScope: AccessScopeVPC,
+				Ports: JobManagerPorts{
+					RPC:   &rpcPort,
+					Blob:  &blobPort,
+					Query: &queryPort,
+					UI:    &uiPort,
+				},
+				MemoryOffHeapRatio: &memoryOffHeapRatio,
+				MemoryOffHeapMin:   memoryOffHeapMin,
+			},
+			TaskManager: TaskManagerSpec{
+				Replicas: 3,
+				Ports: TaskManagerPorts{
+					RPC:   &rpcPort,
+					Data:  &dataPort,
+					Query: &queryPort,
+				},
+				MemoryOffHeapRatio: &memoryOffHeapRatio,
+				MemoryOffHeapMin:   memoryOffHeapMin,
+			},
+			Job: &JobSpec{
+				JarFile:       "gs://my-bucket/myjob.jar",
+				Parallelism:   &parallelism,
+				RestartPolicy: &restartPolicy,
+				RestartBackoff: &JobRestartBackoff{
+					MaxAttempts:           3,
+					InitialBackoffSeconds: 10,
+					BackoffMultiplier:     -1,
+				},
+			},
+		},
+	}
+	err = validator.ValidateCreate(&cluster)
+	expectedErr = "job restartBackoff.backoffMultiplier must be >= 1"
+	assert.Equal(t, err.Error(), expectedErr)
+}
+
+func TestInvalidPythonJobSpec(t *testing.T) {
+	var validator = &Validator{}
+	var parallelism int32 = 2
+	var restartPolicy = JobRestartPolicyNever
+
+	var jobSpec1 = JobSpec{
+		JarFile:       "gs://my-bucket/myjob.jar",
+		PythonScript:  "/opt/flink/job/wordcount.py",
+		Parallelism:   &parallelism,
+		RestartPolicy: &restartPolicy,
+	}
+	var err1 = validator.validateJob(&jobSpec1)
+	var expectedErr1 = "job jarFile and pythonScript cannot be both specified"
+	assert.Assert(t, err1 != nil, "err is not expected to be nil")
+	assert.Equal(t, err1.Error(), expectedErr1)
+
+	var jobSpec2 = JobSpec{
+		JarFile:            "gs://my-bucket/myjob.jar",
+		PythonRequirements: "apache-beam==2.19.0",
+		Parallelism:        &parallelism,
+		RestartPolicy:      &restartPolicy,
+	}
+	var err2 = validator.validateJob(&jobSpec2)
+	var expectedErr2 = "job pythonRequirements requires pythonScript"
+	assert.Assert(t, err2 != nil, "err is not expected to be nil")
+	assert.Equal(t, err2.Error(), expectedErr2)
+}
+
+func TestValidatePullSecrets(t *testing.T) {
+	var secret = corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "gcr-secret"},
+	}
+	var validator = &Validator{
+		k8sReader: fake.NewFakeClientWithScheme(scheme.Scheme, &secret),
+	}
+	var imageSpec = ImageSpec{
+		Name:        "gcr.io/my-project/flink:1.9.1",
+		PullSecrets: []corev1.LocalObjectReference{{Name: "gcr-secret"}},
+	}
+	var err = validator.validatePullSecrets("default", &imageSpec)
+	assert.NilError(t, err)
+
+	err = validator.validatePullSecrets("other", &imageSpec)
+	var expectedErr = "image pull secret gcr-secret does not exist in namespace other"
+	assert.Assert(t, err != nil, "err is not expected to be nil")
+	assert.Equal(t, err.Error(), expectedErr)
+
+	// Not checked without a reader.
+	validator = &Validator{}
+	err = validator.validatePullSecrets("other", &imageSpec)
+	assert.NilError(t, err)
+}
+
+func TestValidateTemplateRef(t *testing.T) {
+	var template = FlinkClusterTemplate{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "base"},
+		Spec: FlinkClusterSpec{
+			Image: ImageSpec{Name: "flink:1.9.1"},
+		},
+	}
+	var testScheme = runtime.NewScheme()
+	assert.NilError(t, AddToScheme(testScheme))
+	var validator = &Validator{
+		k8sReader: fake.NewFakeClientWithScheme(testScheme, &template),
+	}
+	var cluster = FlinkCluster{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "mycluster"},
+		Spec: FlinkClusterSpec{
+			TaskManager: TaskManagerSpec{Replicas: 2},
+			TemplateRef: &corev1.LocalObjectReference{Name: "base"},
+		},
+	}
+	var errs = validator.ValidateSpec(&cluster)
+	assert.Equal(t, len(errs), 0)
+
+	// The merged spec is validated.
+	var minReplicas int32 = 1
+	cluster.Spec.TaskManager.MinReplicas = &minReplicas
+	var err = validator.ValidateCreate(&cluster)
+	assert.Assert(t, err != nil, "err is not expected to be nil")
+	assert.Equal(
+		t,
+		err.Error(),
+		"TaskManager minReplicas is specified without maxReplicas")
+	cluster.Spec.TaskManager.MinReplicas = nil
+
+	cluster.Spec.TemplateRef.Name = "other"
+	err = validator.ValidateCreate(&cluster)
+	var expectedErr = "cluster template other does not exist in namespace default"
+	assert.Assert(t, err != nil, "err is not expected to be nil")
+	assert.Equal(t, err.Error(), expectedErr)
+
+	cluster.Spec.TemplateRef.Name = ""
+	err = validator.ValidateCreate(&cluster)
+	assert.Assert(t, err != nil, "err is not expected to be nil")
+	assert.Equal(t, err.Error(), "templateRef name is unspecified")
+}
+
+func TestValidateTemplateUpdate(t *testing.T) {
+	var template = FlinkClusterTemplate{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "base"},
+		Spec: FlinkClusterSpec{
+			Image:       ImageSpec{Name: "flink:1.9.1"},
+			TaskManager: TaskManagerSpec{Replicas: 2},
+		},
+	}
+	var cluster = FlinkCluster{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: GroupVersion.String(),
+			Kind:       "FlinkCluster",
+		},
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "mycluster"},
+		Spec: FlinkClusterSpec{
+			TemplateRef: &corev1.LocalObjectReference{Name: "base"},
+		},
+	}
+	var testScheme = runtime.NewScheme()
+	assert.NilError(t, AddToScheme(testScheme))
+	var validator = &Validator{
+		k8sReader: fake.NewFakeClientWithScheme(testScheme, &template, &cluster),
+	}
+
+	// The mutable fields of the clusters can be updated.
+	var newTemplate = template.DeepCopy()
+	newTemplate.Spec.TaskManager.Replicas = 4
+	assert.NilError(t, validator.ValidateTemplateUpdate(&template, newTemplate))
+
+	// The immutable fields of the clusters can't be updated.
+	newTemplate.Spec.Image.Name = "flink:1.10.0"
+	var err = validator.ValidateTemplateUpdate(&template, newTemplate)
+	assert.Assert(t, err != nil, "err is not expected to be nil")
+	assert.Assert(
+		t,
+		strings.HasPrefix(err.Error(), "invalid template for cluster mycluster: "),
+		err.Error())
+
+	// The template merged with the clusters must be valid.
+	newTemplate = template.DeepCopy()
+	var minReplicas int32 = 1
+	newTemplate.Spec.TaskManager.MinReplicas = &minReplicas
+	err = validator.ValidateTemplateCreate(newTemplate)
+	assert.Assert(t, err != nil, "err is not expected to be nil")
+	assert.Equal(
+		t,
+		err.Error(),
+		"invalid template for cluster mycluster: "+
+			"TaskManager minReplicas is specified without maxReplicas")
+}
+
+func TestValidateStreamGraphJSON(t *testing.T) {
+	var validator = &Validator{}
+
+	var err = validator.validateStreamGraphJSON(
+		`{"nodes":[{"id":1,"type":"Source"},` +
+			`{"id":2,"type":"Sink","predecessors":[{"id":1}]}]}`)
+	assert.NilError(t, err)
+
+	var invalidGraphs = []struct {
+		json        string
+		expectedErr string
+	}{
+		{
+			json:        `{"nodes":`,
+			expectedErr: "invalid job streamGraphJSON: unexpected end of JSON input",
+		},
+		{
+			json:        `{"nodes":[]}`,
+			expectedErr: "job streamGraphJSON has no nodes",
+		},
+		{
+			json:        `{"nodes":[{"type":"Source"}]}`,
+			expectedErr: "job streamGraphJSON node 0 has no id",
+		},
+		{
+			json:        `{"nodes":[{"id":1},{"id":2,"predecessors":[{"id":3}]}]}`,
+			expectedErr: "job streamGraphJSON node 2 has unknown predecessor 3",
+		},
+		{
+			json: `{"nodes":[{"id":1,"predecessors":[{"id":2}]},` +
+				`{"id":2,"predecessors":[{"id":1}]}]}`,
+			expectedErr: "job streamGraphJSON has no root node without predecessors",
+		},
+	}
+	for _, graph := range invalidGraphs {
+		err = validator.validateStreamGraphJSON(graph.json)
+		assert.Assert(t, err != nil, "err is not expected to be nil")
+		assert.Equal(t, err.Error(), graph.expectedErr)
+	}
+
+	var parallelism int32 = 2
+	var restartPolicy = JobRestartPolicyNever
+	var jobSpec = JobSpec{
+		PythonScript:    "/opt/flink/job/wordcount.py",
+		StreamGraphJSON: `{"nodes":[{"id":1}]}`,
+		Parallelism:     &parallelism,
+		RestartPolicy:   &restartPolicy,
+	}
+	err = validator.validateJob(&jobSpec)
+	assert.Assert(t, err != nil, "err is not expected to be nil")
+	assert.Equal(t, err.Error(), "job streamGraphJSON requires jarFile")
 }
 
 func TestUpdateStatusAllowed(t *testing.T) {
@@ -552,6 +1052,22 @@ func TestUpdateSpecNotAllowed(t *testing.T) {
 	assert.Equal(t, err.Error(), expectedErr)
 }
 
+func TestUpdateWithNewDefaults(t *testing.T) {
+	// A cluster created without the defaults of the current webhook.
+	var oldCluster = FlinkCluster{
+		Spec: FlinkClusterSpec{
+			Image:       ImageSpec{Name: "flink:1.9.1"},
+			TaskManager: TaskManagerSpec{Replicas: 3},
+		},
+	}
+	var newCluster = *oldCluster.DeepCopy()
+	newCluster.Default()
+	newCluster.Status.State = "Running"
+	var validator = &Validator{}
+	var err = validator.ValidateUpdate(&oldCluster, &newCluster)
+	assert.NilError(t, err, "updating status failed unexpectedly")
+}
+
 func TestUpdateSavepointGeneration(t *testing.T) {
 	var validator = &Validator{}
 
@@ -586,30 +1102,171 @@ func TestUpdateSavepointGeneration(t *testing.T) {
 	assert.Equal(t, err2, nil)
 }
 
-func TestInvalidGCPConfig(t *testing.T) {
-	var gcpConfig = GCPConfig{
-		ServiceAccount: &GCPServiceAccount{
-			SecretName: "my-secret",
-			KeyFile:    "my_service_account.json",
-			MountPath:  "/etc/gcp/my_service_account.json",
+func TestUpdateTaskManagerReplicas(t *testing.T) {
+	var validator = &Validator{}
+
+	var oldCluster = FlinkCluster{
+		Spec: FlinkClusterSpec{
+			Image:       ImageSpec{Name: "flink:1.8.1"},
+			TaskManager: TaskManagerSpec{Replicas: 2},
 		},
 	}
+	var newCluster1 = *oldCluster.DeepCopy()
+	newCluster1.Spec.TaskManager.Replicas = 5
+	var err1 = validator.ValidateUpdate(&oldCluster, &newCluster1)
+	assert.NilError(t, err1, "scaling TaskManagers failed unexpectedly")
+
+	var newCluster2 = *oldCluster.DeepCopy()
+	newCluster2.Spec.TaskManager.Replicas = -1
+	var err2 = validator.ValidateUpdate(&oldCluster, &newCluster2)
+	assert.Assert(t, err2 != nil, "err is not expected to be nil")
+	assert.Equal(t, err2.Error(), "invalid TaskManager replicas, it must >= 1")
+
+	// Other properties are still immutable.
+	var newCluster3 = *newCluster1.DeepCopy()
+	newCluster3.Spec.Image.Name = "flink:1.9.0"
+	var err3 = validator.ValidateUpdate(&oldCluster, &newCluster3)
+	assert.Assert(t, err3 != nil, "err is not expected to be nil")
+	assert.Equal(t, err3.Error(), "the cluster properties are immutable")
+}
+
+func TestUpdateJobParallelism(t *testing.T) {
 	var validator = &Validator{}
-	var err = validator.validateGCPConfig(&gcpConfig)
-	var expectedErr = "invalid GCP service account volume mount path"
-	assert.Assert(t, err != nil, "err is not expected to be nil")
-	assert.Equal(t, err.Error(), expectedErr)
+	var parallelism int32 = 2
+	var savepointsDir = "gs://my-bucket/savepoints/"
+
+	var oldCluster = FlinkCluster{
+		Spec: FlinkClusterSpec{
+			Image:       ImageSpec{Name: "flink:1.8.1"},
+			TaskManager: TaskManagerSpec{Replicas: 2},
+			Job: &JobSpec{
+				Parallelism:   &parallelism,
+				SavepointsDir: &savepointsDir,
+			},
+		},
+	}
+	var newCluster1 = *oldCluster.DeepCopy()
+	*newCluster1.Spec.Job.Parallelism = 4
+	var err1 = validator.ValidateUpdate(&oldCluster, &newCluster1)
+	assert.NilError(t, err1, "rescaling the job failed unexpectedly")
+
+	var newCluster2 = *oldCluster.DeepCopy()
+	*newCluster2.Spec.Job.Parallelism = 0
+	var err2 = validator.ValidateUpdate(&oldCluster, &newCluster2)
+	assert.Assert(t, err2 != nil, "err is not expected to be nil")
+	assert.Equal(t, err2.Error(), "job parallelism must be >= 1")
+
+	// The job is stopped with a savepoint.
+	var oldCluster3 = *oldCluster.DeepCopy()
+	oldCluster3.Spec.Job.SavepointsDir = nil
+	var newCluster3 = *oldCluster3.DeepCopy()
+	*newCluster3.Spec.Job.Parallelism = 4
+	var err3 = validator.ValidateUpdate(&oldCluster3, &newCluster3)
+	assert.Assert(t, err3 != nil, "err is not expected to be nil")
+	assert.Equal(
+		t, err3.Error(), "updating job parallelism requires savepointsDir")
+
+	// Other properties are still immutable.
+	var newCluster4 = *newCluster1.DeepCopy()
+	newCluster4.Spec.Image.Name = "flink:1.9.0"
+	var err4 = validator.ValidateUpdate(&oldCluster, &newCluster4)
+	assert.Assert(t, err4 != nil, "err is not expected to be nil")
+	assert.Equal(t, err4.Error(), "the cluster properties are immutable")
 }
 
-func TestInvalidHadoopConfig(t *testing.T) {
+func TestUpdateCloneFrom(t *testing.T) {
 	var validator = &Validator{}
 
-	var hadoopConfig1 = HadoopConfig{
-		ConfigMapName: "",
-		MountPath:     "/etc/hadoop/conf",
+	var oldCluster = FlinkCluster{
+		Spec: FlinkClusterSpec{Image: ImageSpec{Name: "flink:1.8.1"}}}
+	var newCluster1 = FlinkCluster{
+		Spec: FlinkClusterSpec{
+			Image:     ImageSpec{Name: "flink:1.8.1"},
+			CloneFrom: &ClusterRef{Name: "prod"},
+		},
 	}
-	var err1 = validator.validateHadoopConfig(&hadoopConfig1)
-	var expectedErr1 = "Hadoop ConfigMap name is unspecified"
+	var err1 = validator.ValidateUpdate(&oldCluster, &newCluster1)
+	var expectedErr1 = "cloneFrom is only allowed at creation time"
+	assert.Assert(t, err1 != nil, "err is not expected to be nil")
+	assert.Equal(t, err1.Error(), expectedErr1)
+
+	// Applying the clone replaces the spec and removes `cloneFrom`.
+	var meta = metav1.ObjectMeta{Name: "staging", Namespace: "default"}
+	var cloningCluster = FlinkCluster{
+		ObjectMeta: meta,
+		Spec:       FlinkClusterSpec{CloneFrom: &ClusterRef{Name: "prod"}}}
+	var newCluster2 = FlinkCluster{
+		ObjectMeta: meta,
+		Spec:       FlinkClusterSpec{Image: ImageSpec{Name: "flink:1.9.0"}}}
+	var err2 = validator.ValidateUpdate(&cloningCluster, &newCluster2)
+	assert.NilError(t, err2, "applying the clone failed unexpectedly")
+
+	// The applied spec is validated as on creation.
+	newCluster2.Spec.TaskManager.Replicas = -1
+	var err4 = validator.ValidateUpdate(&cloningCluster, &newCluster2)
+	assert.Assert(t, err4 != nil, "err is not expected to be nil")
+
+	var newCluster3 = FlinkCluster{
+		Spec: FlinkClusterSpec{CloneFrom: &ClusterRef{Name: "staging"}}}
+	var err3 = validator.ValidateUpdate(&cloningCluster, &newCluster3)
+	assert.Assert(t, err3 != nil, "err is not expected to be nil")
+	assert.Equal(t, err3.Error(), expectedErr1)
+}
+
+func TestValidateCreateCloneFrom(t *testing.T) {
+	var validator = &Validator{}
+
+	var cluster = FlinkCluster{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "mycluster",
+			Namespace: "default",
+		},
+		Spec: FlinkClusterSpec{CloneFrom: &ClusterRef{Name: "prod"}},
+	}
+	var err1 = validator.ValidateCreate(&cluster)
+	assert.NilError(t, err1, "create validation failed unexpectedly")
+
+	cluster.Spec.CloneFrom.Name = ""
+	var err2 = validator.ValidateCreate(&cluster)
+	var expectedErr2 = "cloneFrom cluster name is unspecified"
+	assert.Assert(t, err2 != nil, "err is not expected to be nil")
+	assert.Equal(t, err2.Error(), expectedErr2)
+
+	cluster.Spec.CloneFrom = &ClusterRef{Name: "prod", Namespace: "default"}
+	var err3 = validator.ValidateCreate(&cluster)
+	assert.NilError(t, err3, "create validation failed unexpectedly")
+
+	cluster.Spec.CloneFrom.Namespace = "prod"
+	var err4 = validator.ValidateCreate(&cluster)
+	var expectedErr4 = "cloneFrom cluster must be in the namespace of the cluster: prod"
+	assert.Assert(t, err4 != nil, "err is not expected to be nil")
+	assert.Equal(t, err4.Error(), expectedErr4)
+}
+
+func TestInvalidGCPConfig(t *testing.T) {
+	var gcpConfig = GCPConfig{
+		ServiceAccount: &GCPServiceAccount{
+			SecretName: "my-secret",
+			KeyFile:    "my_service_account.json",
+			MountPath:  "/etc/gcp/my_service_account.json",
+		},
+	}
+	var validator = &Validator{}
+	var err = validator.validateGCPConfig(&gcpConfig)
+	var expectedErr = "invalid GCP service account volume mount path"
+	assert.Assert(t, err != nil, "err is not expected to be nil")
+	assert.Equal(t, err.Error(), expectedErr)
+}
+
+func TestInvalidHadoopConfig(t *testing.T) {
+	var validator = &Validator{}
+
+	var hadoopConfig1 = HadoopConfig{
+		ConfigMapName: "",
+		MountPath:     "/etc/hadoop/conf",
+	}
+	var err1 = validator.validateHadoopConfig(&hadoopConfig1)
+	var expectedErr1 = "Hadoop ConfigMap name is unspecified"
 	assert.Assert(t, err1 != nil, "err is not expected to be nil")
 	assert.Equal(t, err1.Error(), expectedErr1)
 
@@ -622,3 +1279,957 @@ func TestInvalidHadoopConfig(t *testing.T) {
 	assert.Assert(t, err2 != nil, "err is not expected to be nil")
 	assert.Equal(t, err2.Error(), expectedErr2)
 }
+
+func TestInvalidSecurity(t *testing.T) {
+	var validator = &Validator{}
+	var ssoEnabled = true
+
+	var security1 = SecuritySpec{SSOEnabled: &ssoEnabled}
+	var err1 = validator.validateSecurity(&security1)
+	var expectedErr1 = "OIDC config is unspecified"
+	assert.Assert(t, err1 != nil, "err is not expected to be nil")
+	assert.Equal(t, err1.Error(), expectedErr1)
+
+	var security2 = SecuritySpec{
+		SSOEnabled: &ssoEnabled,
+		OIDCConfig: &OIDCConfig{
+			IssuerURL: "https://accounts.google.com",
+			ClientID:  "my-client-id",
+		},
+	}
+	var err2 = validator.validateSecurity(&security2)
+	var expectedErr2 = "OIDC client secret is unspecified"
+	assert.Assert(t, err2 != nil, "err is not expected to be nil")
+	assert.Equal(t, err2.Error(), expectedErr2)
+
+	// A complete OIDC config.
+	var security3 = SecuritySpec{
+		SSOEnabled: &ssoEnabled,
+		OIDCConfig: &OIDCConfig{
+			IssuerURL: "https://accounts.google.com",
+			ClientID:  "my-client-id",
+			ClientSecretRef: corev1.SecretKeySelector{
+				LocalObjectReference: corev1.LocalObjectReference{
+					Name: "oidc-secret",
+				},
+				Key: "client-secret",
+			},
+			CookieSecretRef: corev1.SecretKeySelector{
+				LocalObjectReference: corev1.LocalObjectReference{
+					Name: "oidc-secret",
+				},
+				Key: "cookie-secret",
+			},
+			ProxyImage: "quay.io/oauth2-proxy/oauth2-proxy:v7.0.1",
+		},
+	}
+	var err3 = validator.validateSecurity(&security3)
+	assert.NilError(t, err3)
+
+	var security4 = SecuritySpec{RESTTLS: &RESTTLSSpec{}}
+	var err4 = validator.validateSecurity(&security4)
+	var expectedErr4 = "restTLS secretName is unspecified"
+	assert.Assert(t, err4 != nil, "err is not expected to be nil")
+	assert.Equal(t, err4.Error(), expectedErr4)
+
+	var security5 = SecuritySpec{RESTTLS: &RESTTLSSpec{SecretName: "flink-tls"}}
+	var err5 = validator.validateSecurity(&security5)
+	assert.NilError(t, err5)
+}
+
+func TestInvalidTaskManagerAutoscaling(t *testing.T) {
+	var validator = &Validator{}
+	var zero int32 = 0
+	var one int32 = 1
+	var two int32 = 2
+	var negative int32 = -1
+
+	var tmSpec1 = TaskManagerSpec{MinReplicas: &one}
+	var err1 = validator.validateTaskManagerAutoscaling(&tmSpec1)
+	var expectedErr1 = "TaskManager minReplicas is specified without maxReplicas"
+	assert.Assert(t, err1 != nil, "err is not expected to be nil")
+	assert.Equal(t, err1.Error(), expectedErr1)
+
+	var tmSpec2 = TaskManagerSpec{MinReplicas: &zero, MaxReplicas: &two}
+	var err2 = validator.validateTaskManagerAutoscaling(&tmSpec2)
+	var expectedErr2 = "invalid TaskManager minReplicas, it must >= 1"
+	assert.Assert(t, err2 != nil, "err is not expected to be nil")
+	assert.Equal(t, err2.Error(), expectedErr2)
+
+	var tmSpec3 = TaskManagerSpec{MinReplicas: &two, MaxReplicas: &one}
+	var err3 = validator.validateTaskManagerAutoscaling(&tmSpec3)
+	var expectedErr3 = "invalid TaskManager maxReplicas 1, it must >= minReplicas 2"
+	assert.Assert(t, err3 != nil, "err is not expected to be nil")
+	assert.Equal(t, err3.Error(), expectedErr3)
+
+	var tmSpec4 = TaskManagerSpec{
+		MinReplicas:              &one,
+		MaxReplicas:              &two,
+		AutoscaleCooldownSeconds: &negative,
+	}
+	var err4 = validator.validateTaskManagerAutoscaling(&tmSpec4)
+	var expectedErr4 = "invalid TaskManager autoscaleCooldownSeconds, it must >= 0"
+	assert.Assert(t, err4 != nil, "err is not expected to be nil")
+	assert.Equal(t, err4.Error(), expectedErr4)
+}
+
+func TestInvalidTaskSlots(t *testing.T) {
+	var validator = &Validator{}
+	var parallelism int32 = 6
+	var one int32 = 1
+	var two int32 = 2
+	var cluster = FlinkCluster{
+		Spec: FlinkClusterSpec{
+			TaskManager: TaskManagerSpec{
+				Replicas:     1,
+				SlotsPerTask: &two,
+				MinReplicas:  &one,
+				MaxReplicas:  &two,
+			},
+			Job: &JobSpec{Parallelism: &parallelism},
+		},
+	}
+	var err = validator.validateTaskSlots(&cluster)
+	var expectedErr = "job parallelism 6 exceeds the 4 task slots of the TaskManagers at maxReplicas"
+	assert.Assert(t, err != nil, "err is not expected to be nil")
+	assert.Equal(t, err.Error(), expectedErr)
+
+	// The slots of the pools are counted.
+	cluster.Spec.TaskManager.Pools = []TaskManagerPoolSpec{
+		{Name: "highmem", Replicas: 1},
+	}
+	assert.NilError(t, validator.validateTaskSlots(&cluster))
+
+	// The Flink properties take precedence.
+	cluster.Spec.FlinkProperties = map[string]string{
+		"taskmanager.numberOfTaskSlots": "1",
+	}
+	assert.Assert(t, validator.validateTaskSlots(&cluster) != nil)
+
+	// The shortfall is reported in the status without autoscaling.
+	cluster.Spec.TaskManager.MinReplicas = nil
+	cluster.Spec.TaskManager.MaxReplicas = nil
+	assert.NilError(t, validator.validateTaskSlots(&cluster))
+}
+
+func TestInvalidJobManagerProxy(t *testing.T) {
+	var validator = &Validator{}
+	var ssoEnabled = true
+	var rateLimitRPM int32 = 60
+	var zero int32 = 0
+
+	var proxy1 = ProxySpec{Type: ProxyTypeNginx}
+	var err1 = validator.validateJobManagerProxy(
+		&proxy1, &SecuritySpec{SSOEnabled: &ssoEnabled})
+	var expectedErr1 = "jobManagerProxy cannot be used with SSO"
+	assert.Assert(t, err1 != nil, "err is not expected to be nil")
+	assert.Equal(t, err1.Error(), expectedErr1)
+
+	var proxy2 = ProxySpec{Type: "envoy"}
+	var err2 = validator.validateJobManagerProxy(&proxy2, nil)
+	var expectedErr2 = "invalid jobManagerProxy type: envoy"
+	assert.Assert(t, err2 != nil, "err is not expected to be nil")
+	assert.Equal(t, err2.Error(), expectedErr2)
+
+	var proxy3 = ProxySpec{Type: ProxyTypeNginx, RateLimitRPM: &zero}
+	var err3 = validator.validateJobManagerProxy(&proxy3, nil)
+	var expectedErr3 = "jobManagerProxy rateLimitRPM must be >= 1"
+	assert.Assert(t, err3 != nil, "err is not expected to be nil")
+	assert.Equal(t, err3.Error(), expectedErr3)
+
+	var proxy4 = ProxySpec{Type: ProxyTypeNginx, RateLimitRPM: &rateLimitRPM}
+	var err4 = validator.validateJobManagerProxy(&proxy4, nil)
+	var expectedErr4 = "jobManagerProxy image is unspecified"
+	assert.Assert(t, err4 != nil, "err is not expected to be nil")
+	assert.Equal(t, err4.Error(), expectedErr4)
+
+	var proxy5 = ProxySpec{
+		Type:           ProxyTypeNginx,
+		RateLimitRPM:   &rateLimitRPM,
+		Image:          "nginx:1.17",
+		ConfigTemplate: "listen {{.Port}};",
+	}
+	var err5 = validator.validateJobManagerProxy(&proxy5, nil)
+	assert.Assert(t, err5 != nil, "err is not expected to be nil")
+	assert.Assert(
+		t,
+		strings.HasPrefix(
+			err5.Error(), "invalid jobManagerProxy configTemplate: "),
+		err5.Error())
+
+	proxy5.ConfigTemplate = "listen {{.ProxyPort}};"
+	var err6 = validator.validateJobManagerProxy(&proxy5, nil)
+	assert.NilError(t, err6)
+
+	var negative int32 = -1
+	proxy5.RateLimitBurst = &negative
+	var err7 = validator.validateJobManagerProxy(&proxy5, nil)
+	var expectedErr7 = "jobManagerProxy rateLimitBurst must be >= 0"
+	assert.Assert(t, err7 != nil, "err is not expected to be nil")
+	assert.Equal(t, err7.Error(), expectedErr7)
+}
+
+func TestInvalidNetworking(t *testing.T) {
+	var validator = &Validator{}
+	var parallelism int32 = 2
+	var restartPolicy = JobRestartPolicyNever
+	var cleanupPolicy = CleanupPolicy{
+		AfterJobSucceeds: CleanupActionKeepCluster,
+		AfterJobFails:    CleanupActionKeepCluster,
+	}
+	var versionA = JobSpec{
+		JarFile:       "gs://my-bucket/myjob-a.jar",
+		Parallelism:   &parallelism,
+		RestartPolicy: &restartPolicy,
+		CleanupPolicy: &cleanupPolicy,
+	}
+
+	var networking1 = NetworkingSpec{
+		ServiceMesh: &ServiceMeshSpec{
+			TrafficSplitting: &TrafficSplittingSpec{
+				Enabled:  true,
+				VersionA: versionA,
+				VersionB: JobSpec{},
+				WeightA:  50,
+			},
+		},
+	}
+	var err1 = validator.validateNetworking(&networking1, nil)
+	var expectedErr1 = "traffic splitting versionB: job jarFile or pythonScript is unspecified"
+	assert.Assert(t, err1 != nil, "err is not expected to be nil")
+	assert.Equal(t, err1.Error(), expectedErr1)
+
+	var networking2 = NetworkingSpec{
+		ServiceMesh: &ServiceMeshSpec{
+			TrafficSplitting: &TrafficSplittingSpec{
+				Enabled:  true,
+				VersionA: versionA,
+				VersionB: versionA,
+				WeightA:  120,
+			},
+		},
+	}
+	var err2 = validator.validateNetworking(&networking2, nil)
+	var expectedErr2 = "traffic splitting weightA must be in [0, 100]"
+	assert.Assert(t, err2 != nil, "err is not expected to be nil")
+	assert.Equal(t, err2.Error(), expectedErr2)
+
+	var err3 = validator.validateNetworking(&networking2, &versionA)
+	var expectedErr3 = "traffic splitting is not supported for job clusters"
+	assert.Assert(t, err3 != nil, "err is not expected to be nil")
+	assert.Equal(t, err3.Error(), expectedErr3)
+
+	var networking4 = NetworkingSpec{
+		NetworkPolicy: &NetworkPolicySpec{
+			Enabled:           true,
+			AllowedNamespaces: []string{"monitoring", "My_Namespace"},
+		},
+	}
+	var err4 = validator.validateNetworking(&networking4, nil)
+	var expectedErr4 = "invalid network policy allowedNamespaces: My_Namespace"
+	assert.Assert(t, err4 != nil, "err is not expected to be nil")
+	assert.Equal(t, err4.Error(), expectedErr4)
+}
+
+func TestInvalidServiceAccount(t *testing.T) {
+	var validator = &Validator{}
+
+	var serviceAccount1 = ServiceAccountSpec{Create: false}
+	var err1 = validator.validateServiceAccount(&serviceAccount1)
+	var expectedErr1 = "service account name is unspecified"
+	assert.Assert(t, err1 != nil, "err is not expected to be nil")
+	assert.Equal(t, err1.Error(), expectedErr1)
+
+	var serviceAccount2 = ServiceAccountSpec{
+		Create: false,
+		Name:   "my-sa",
+		Annotations: map[string]string{
+			"iam.gke.io/gcp-service-account": "my-gsa@my-project.iam.gserviceaccount.com",
+		},
+	}
+	var err2 = validator.validateServiceAccount(&serviceAccount2)
+	var expectedErr2 = "service account annotations are only supported when create is true"
+	assert.Assert(t, err2 != nil, "err is not expected to be nil")
+	assert.Equal(t, err2.Error(), expectedErr2)
+}
+
+func TestGetFlinkVersion(t *testing.T) {
+	var version, ok = getFlinkVersion("flink:1.8.1")
+	assert.Assert(t, ok)
+	assert.Equal(t, version, flinkVersion{major: 1, minor: 8})
+
+	version, ok = getFlinkVersion("localhost:5000/flink:1.9.1-scala_2.12")
+	assert.Assert(t, ok)
+	assert.Equal(t, version, flinkVersion{major: 1, minor: 9})
+
+	version, ok = getFlinkVersion("gcr.io/my-project/flink:1.10@sha256:abc")
+	assert.Assert(t, ok)
+	assert.Equal(t, version, flinkVersion{major: 1, minor: 10})
+
+	_, ok = getFlinkVersion("flink:latest")
+	assert.Assert(t, !ok)
+
+	_, ok = getFlinkVersion("localhost:5000/flink")
+	assert.Assert(t, !ok)
+}
+
+func TestInvalidFlinkVersion(t *testing.T) {
+	var validator = &Validator{}
+
+	var image1 = ImageSpec{Name: "flink:1.5.6"}
+	var err1 = validator.validateFlinkVersion(&image1, nil)
+	var expectedErr1 = "unsupported Flink version 1.5 in image flink:1.5.6, " +
+		"supported versions: 1.7, 1.8, 1.9, 1.10"
+	assert.Assert(t, err1 != nil, "err is not expected to be nil")
+	assert.Equal(t, err1.Error(), expectedErr1)
+
+	var image2 = ImageSpec{Name: "flink:1.7.2"}
+	var properties = map[string]string{
+		"taskmanager.numberOfTaskSlots":   "2",
+		"taskmanager.memory.process.size": "2g",
+	}
+	var err2 = validator.validateFlinkVersion(&image2, properties)
+	var expectedErr2 = "flink property taskmanager.memory.process.size " +
+		"requires Flink 1.10 or later, but image flink:1.7.2 is Flink 1.7"
+	assert.Assert(t, err2 != nil, "err is not expected to be nil")
+	assert.Equal(t, err2.Error(), expectedErr2)
+
+	var image3 = ImageSpec{Name: "flink:1.10.0"}
+	var err3 = validator.validateFlinkVersion(&image3, properties)
+	assert.NilError(t, err3)
+
+	var image4 = ImageSpec{Name: "my-registry/my-flink:custom"}
+	var err4 = validator.validateFlinkVersion(&image4, properties)
+	assert.NilError(t, err4)
+}
+
+func TestInvalidTable(t *testing.T) {
+	var validator = &Validator{}
+
+	var table1 = TableSpec{SQLDialect: SQLDialectHive}
+	var err1 = validator.validateTable(&table1)
+	var expectedErr1 = "hiveMetastoreURI is required when sqlDialect is hive"
+	assert.Assert(t, err1 != nil, "err is not expected to be nil")
+	assert.Equal(t, err1.Error(), expectedErr1)
+
+	var table2 = TableSpec{SQLDialect: "mysql"}
+	var err2 = validator.validateTable(&table2)
+	var expectedErr2 = "invalid sqlDialect: mysql"
+	assert.Assert(t, err2 != nil, "err is not expected to be nil")
+	assert.Equal(t, err2.Error(), expectedErr2)
+
+	var table3 = TableSpec{
+		SQLDialect:       SQLDialectHive,
+		HiveMetastoreURI: "thrift://hive-metastore:9083",
+	}
+	assert.NilError(t, validator.validateTable(&table3))
+}
+
+func TestInvalidCheckpointStorage(t *testing.T) {
+	var validator = &Validator{}
+
+	var storage1 = CheckpointStorageSpec{MountPath: "/checkpoints"}
+	var err1 = validator.validateCheckpointStorage(&storage1)
+	var expectedErr1 = "checkpoint storage pvcName is unspecified"
+	assert.Assert(t, err1 != nil, "err is not expected to be nil")
+	assert.Equal(t, err1.Error(), expectedErr1)
+
+	var storage2 = CheckpointStorageSpec{
+		PVCName: "my-pvc", MountPath: "checkpoints"}
+	var err2 = validator.validateCheckpointStorage(&storage2)
+	var expectedErr2 = "checkpoint storage mountPath must be an absolute path: checkpoints"
+	assert.Assert(t, err2 != nil, "err is not expected to be nil")
+	assert.Equal(t, err2.Error(), expectedErr2)
+
+	var storage3 = CheckpointStorageSpec{
+		PVCName:    "my-pvc",
+		MountPath:  "/checkpoints",
+		AccessMode: corev1.ReadOnlyMany,
+	}
+	var err3 = validator.validateCheckpointStorage(&storage3)
+	var expectedErr3 = "invalid checkpoint storage accessMode: ReadOnlyMany"
+	assert.Assert(t, err3 != nil, "err is not expected to be nil")
+	assert.Equal(t, err3.Error(), expectedErr3)
+}
+
+func TestInvalidCheckpointConfig(t *testing.T) {
+	var validator = &Validator{}
+
+	var config1 = CheckpointConfig{IntervalMillis: -1}
+	var err1 = validator.validateCheckpointConfig(&config1)
+	var expectedErr1 = "checkpointConfig intervalMillis must be >= 0"
+	assert.Assert(t, err1 != nil, "err is not expected to be nil")
+	assert.Equal(t, err1.Error(), expectedErr1)
+
+	var config2 = CheckpointConfig{MaxConcurrentCheckpoints: -1}
+	var err2 = validator.validateCheckpointConfig(&config2)
+	var expectedErr2 = "checkpointConfig maxConcurrentCheckpoints must be >= 0"
+	assert.Assert(t, err2 != nil, "err is not expected to be nil")
+	assert.Equal(t, err2.Error(), expectedErr2)
+
+	var config3 = CheckpointConfig{StateBackend: "hashmap"}
+	var err3 = validator.validateCheckpointConfig(&config3)
+	var expectedErr3 = "invalid checkpointConfig stateBackend: hashmap"
+	assert.Assert(t, err3 != nil, "err is not expected to be nil")
+	assert.Equal(t, err3.Error(), expectedErr3)
+
+	var config4 = CheckpointConfig{
+		IntervalMillis: 60000,
+		StateBackend:   StateBackendRocksDB,
+	}
+	assert.NilError(t, validator.validateCheckpointConfig(&config4))
+}
+
+func TestInvalidTaskManagerPool(t *testing.T) {
+	var validator = &Validator{}
+	var memoryOffHeapMin = resource.MustParse("600M")
+
+	var pool1 = TaskManagerPoolSpec{Replicas: 1}
+	var err1 = validator.validateTaskManagerPool(&pool1, &memoryOffHeapMin)
+	var expectedErr1 = "TaskManager pool name is unspecified"
+	assert.Assert(t, err1 != nil, "err is not expected to be nil")
+	assert.Equal(t, err1.Error(), expectedErr1)
+
+	var pool2 = TaskManagerPoolSpec{Name: "CPU_Heavy", Replicas: 1}
+	var err2 = validator.validateTaskManagerPool(&pool2, &memoryOffHeapMin)
+	var expectedErr2 = "invalid TaskManager pool name: CPU_Heavy"
+	assert.Assert(t, err2 != nil, "err is not expected to be nil")
+	assert.Equal(t, err2.Error(), expectedErr2)
+
+	var pool3 = TaskManagerPoolSpec{Name: "cpu", Replicas: 0}
+	var err3 = validator.validateTaskManagerPool(&pool3, &memoryOffHeapMin)
+	var expectedErr3 = "invalid TaskManager pool cpu replicas, it must >= 1"
+	assert.Assert(t, err3 != nil, "err is not expected to be nil")
+	assert.Equal(t, err3.Error(), expectedErr3)
+}
+
+func TestInvalidDiagnosticsBundle(t *testing.T) {
+	var validator = &Validator{}
+
+	var bundle1 = DiagnosticsBundleSpec{
+		UploadURI: "gs://my-bucket/diagnostics",
+		Image:     "google/cloud-sdk",
+	}
+	var err1 = validator.validateDiagnosticsBundle(&bundle1)
+	var expectedErr1 = "diagnosticsBundle triggerOnState is unspecified"
+	assert.Assert(t, err1 != nil, "err is not expected to be nil")
+	assert.Equal(t, err1.Error(), expectedErr1)
+
+	var bundle2 = DiagnosticsBundleSpec{
+		TriggerOnState: []string{ClusterStateFailed, "Broken"},
+		UploadURI:      "gs://my-bucket/diagnostics",
+		Image:          "google/cloud-sdk",
+	}
+	var err2 = validator.validateDiagnosticsBundle(&bundle2)
+	var expectedErr2 = "invalid diagnosticsBundle triggerOnState: Broken"
+	assert.Assert(t, err2 != nil, "err is not expected to be nil")
+	assert.Equal(t, err2.Error(), expectedErr2)
+
+	var bundle3 = DiagnosticsBundleSpec{
+		TriggerOnState: []string{ClusterStateFailed},
+		UploadURI:      "/tmp/diagnostics",
+		Image:          "google/cloud-sdk",
+	}
+	var err3 = validator.validateDiagnosticsBundle(&bundle3)
+	var expectedErr3 = "invalid diagnosticsBundle uploadURI: /tmp/diagnostics"
+	assert.Assert(t, err3 != nil, "err is not expected to be nil")
+	assert.Equal(t, err3.Error(), expectedErr3)
+
+	// The default image has no aws CLI.
+	var bundle4 = DiagnosticsBundleSpec{
+		TriggerOnState: []string{ClusterStateFailed},
+		UploadURI:      "s3://my-bucket/diagnostics",
+	}
+	var err4 = validator.validateDiagnosticsBundle(&bundle4)
+	var expectedErr4 = "diagnosticsBundle image with the aws CLI is required for s3:// uploadURI"
+	assert.Assert(t, err4 != nil, "err is not expected to be nil")
+	assert.Equal(t, err4.Error(), expectedErr4)
+
+	var bundle5 = DiagnosticsBundleSpec{
+		TriggerOnState: []string{ClusterStateFailed},
+		UploadURI:      "s3://my-bucket/diagnostics",
+		Image:          "my-registry/diagnostics-aws",
+	}
+	assert.NilError(t, validator.validateDiagnosticsBundle(&bundle5))
+}
+
+func TestInvalidJobJarURI(t *testing.T) {
+	var validator = &Validator{}
+	var parallelism int32 = 1
+	var restartPolicy = JobRestartPolicyNever
+
+	var job1 = JobSpec{
+		JarURI:             "gs://my-bucket/wordcount.jar",
+		JarDownloaderImage: "google/cloud-sdk",
+		PythonScript:       "/opt/flink/job/wordcount.py",
+		Parallelism:        &parallelism,
+		RestartPolicy:      &restartPolicy,
+	}
+	var err1 = validator.validateJob(&job1)
+	var expectedErr1 = "job jarURI and pythonScript cannot be both specified"
+	assert.Assert(t, err1 != nil, "err is not expected to be nil")
+	assert.Equal(t, err1.Error(), expectedErr1)
+
+	var job2 = JobSpec{
+		JarURI:             "ftp://my-host/wordcount.jar",
+		JarFile:            "/opt/flink/job-jar/wordcount.jar",
+		JarDownloaderImage: "google/cloud-sdk",
+		Parallelism:        &parallelism,
+		RestartPolicy:      &restartPolicy,
+	}
+	var err2 = validator.validateJob(&job2)
+	var expectedErr2 = "invalid job jarURI: ftp://my-host/wordcount.jar"
+	assert.Assert(t, err2 != nil, "err is not expected to be nil")
+	assert.Equal(t, err2.Error(), expectedErr2)
+
+	var job3 = JobSpec{
+		JarURI:             "gs://my-bucket/jobs/",
+		JarFile:            "/opt/flink/job-jar/jobs",
+		JarDownloaderImage: "google/cloud-sdk",
+		Parallelism:        &parallelism,
+		RestartPolicy:      &restartPolicy,
+	}
+	var err3 = validator.validateJob(&job3)
+	var expectedErr3 = "job jarURI is not the URI of a file: gs://my-bucket/jobs/"
+	assert.Assert(t, err3 != nil, "err is not expected to be nil")
+	assert.Equal(t, err3.Error(), expectedErr3)
+
+	job3.JarURI = "https://repo.example.com?jar=wordcount.jar"
+	var err4 = validator.validateJob(&job3)
+	var expectedErr4 = "job jarURI is not the URI of a file: " +
+		"https://repo.example.com?jar=wordcount.jar"
+	assert.Assert(t, err4 != nil, "err is not expected to be nil")
+	assert.Equal(t, err4.Error(), expectedErr4)
+
+	// The job would not find the downloaded JAR.
+	var job5 = JobSpec{
+		JarURI:             "gs://my-bucket/jobs/wordcount.jar",
+		JarFile:            "/opt/flink/usrlib/wordcount.jar",
+		JarDownloaderImage: "google/cloud-sdk",
+		Parallelism:        &parallelism,
+		RestartPolicy:      &restartPolicy,
+	}
+	var err5 = validator.validateJob(&job5)
+	var expectedErr5 = "job jarFile must be the downloaded file " +
+		"/opt/flink/job-jar/wordcount.jar of jarURI, but it is " +
+		"/opt/flink/usrlib/wordcount.jar"
+	assert.Assert(t, err5 != nil, "err is not expected to be nil")
+	assert.Equal(t, err5.Error(), expectedErr5)
+
+	job5.JarFile = "/opt/flink/job-jar/wordcount.jar"
+	job5.CleanupPolicy = &CleanupPolicy{
+		AfterJobSucceeds: CleanupActionDeleteCluster,
+		AfterJobFails:    CleanupActionKeepCluster,
+	}
+	assert.NilError(t, validator.validateJob(&job5))
+}
+
+func TestInvalidSQLJob(t *testing.T) {
+	var validator = &Validator{}
+	var parallelism int32 = 1
+	var restartPolicy = JobRestartPolicyNever
+	var sqlJob = SQLJobSpec{
+		ConfigMapRef:  "wordcount-sql",
+		StatementFile: "wordcount.sql",
+	}
+	var cleanupPolicy = CleanupPolicy{
+		AfterJobSucceeds: CleanupActionDeleteCluster,
+		AfterJobFails:    CleanupActionKeepCluster,
+	}
+
+	var job1 = JobSpec{
+		SQLJob:        &sqlJob,
+		Parallelism:   &parallelism,
+		RestartPolicy: &restartPolicy,
+		CleanupPolicy: &cleanupPolicy,
+	}
+	assert.NilError(t, validator.validateJob(&job1))
+
+	var job2 = JobSpec{
+		SQLJob:             &sqlJob,
+		JarURI:             "gs://my-bucket/wordcount.jar",
+		JarFile:            "/opt/flink/job-jar/wordcount.jar",
+		JarDownloaderImage: "google/cloud-sdk",
+		Parallelism:        &parallelism,
+		RestartPolicy:      &restartPolicy,
+	}
+	var err2 = validator.validateJob(&job2)
+	var expectedErr2 = "job jarURI and sqlJob cannot be both specified"
+	assert.Assert(t, err2 != nil, "err is not expected to be nil")
+	assert.Equal(t, err2.Error(), expectedErr2)
+
+	var job3 = JobSpec{
+		SQLJob:        &sqlJob,
+		PythonScript:  "/opt/flink/job/wordcount.py",
+		Parallelism:   &parallelism,
+		RestartPolicy: &restartPolicy,
+	}
+	var err3 = validator.validateJob(&job3)
+	var expectedErr3 = "job sqlJob cannot be specified with jarFile or pythonScript"
+	assert.Assert(t, err3 != nil, "err is not expected to be nil")
+	assert.Equal(t, err3.Error(), expectedErr3)
+
+	var job4 = JobSpec{
+		SQLJob:        &SQLJobSpec{ConfigMapRef: "wordcount-sql"},
+		Parallelism:   &parallelism,
+		RestartPolicy: &restartPolicy,
+	}
+	var err4 = validator.validateJob(&job4)
+	var expectedErr4 = "job sqlJob statementFile is unspecified"
+	assert.Assert(t, err4 != nil, "err is not expected to be nil")
+	assert.Equal(t, err4.Error(), expectedErr4)
+}
+
+func TestInvalidSQLJobFlinkVersion(t *testing.T) {
+	var validator = &Validator{}
+	var cluster = FlinkCluster{
+		Spec: FlinkClusterSpec{
+			Image: ImageSpec{Name: "flink:1.13"},
+			Job: &JobSpec{
+				SQLJob: &SQLJobSpec{
+					ConfigMapRef:  "wordcount-sql",
+					StatementFile: "wordcount.sql",
+				},
+			},
+		},
+	}
+	assert.NilError(t, validator.validateSQLJobFlinkVersion(&cluster))
+
+	cluster.Spec.Image.Name = "flink:1.12"
+	assert.Error(
+		t,
+		validator.validateSQLJobFlinkVersion(&cluster),
+		"job sqlJob requires Flink 1.13 or later, but image flink:1.12 is Flink 1.12")
+
+	// The version of the image is unknown.
+	cluster.Spec.Image.Name = "my-registry/flink-sql:latest"
+	assert.NilError(t, validator.validateSQLJobFlinkVersion(&cluster))
+}
+
+func TestInvalidKubernetesHA(t *testing.T) {
+	var validator = &Validator{}
+	var jmReplicas int32 = 2
+	var memoryOffHeapRatio int32 = 25
+	var jmSpec = JobManagerSpec{
+		Replicas:    &jmReplicas,
+		AccessScope: AccessScopeCluster,
+		Ports: JobManagerPorts{
+			RPC:   &[]int32{6123}[0],
+			Blob:  &[]int32{6124}[0],
+			Query: &[]int32{6125}[0],
+			UI:    &[]int32{8081}[0],
+		},
+		MemoryOffHeapRatio: &memoryOffHeapRatio,
+		MemoryOffHeapMin:   resource.MustParse("600M"),
+	}
+	var properties = map[string]string{
+		"high-availability":            "kubernetes",
+		"high-availability.storageDir": "gs://my-bucket/ha",
+	}
+	var cluster = FlinkCluster{
+		Spec: FlinkClusterSpec{
+			Image:           ImageSpec{Name: "flink:1.13"},
+			JobManager:      jmSpec,
+			FlinkProperties: properties,
+		},
+	}
+
+	// Standby JobManager replicas.
+	assert.NilError(t, validator.validateJobManager(&jmSpec, properties))
+	assert.NilError(t, validator.validateKubernetesHA(&cluster))
+
+	// The supported standalone Flink versions are not checked.
+	for _, err := range validator.ValidateSpec(&cluster) {
+		assert.Assert(
+			t, !strings.HasPrefix(err.Error(), "unsupported Flink version"), err)
+	}
+
+	// Without Kubernetes high availability, e.g., with ZooKeeper.
+	assert.Error(
+		t,
+		validator.validateJobManager(
+			&jmSpec, map[string]string{"high-availability": "zookeeper"}),
+		"invalid JobManager replicas, it must be 1")
+
+	cluster.Spec.Image.Name = "flink:1.10"
+	assert.Error(
+		t,
+		validator.validateKubernetesHA(&cluster),
+		"Kubernetes high availability requires Flink 1.12 or later, but image flink:1.10 is Flink 1.10")
+
+	cluster.Spec.Image.Name = "flink:1.13"
+	cluster.Spec.FlinkProperties = map[string]string{
+		"high-availability.type": "KUBERNETES",
+	}
+	assert.Error(
+		t,
+		validator.validateKubernetesHA(&cluster),
+		"flink property high-availability.storageDir is required for Kubernetes high availability")
+}
+
+func TestInvalidJobCheckpointHealth(t *testing.T) {
+	var validator = &Validator{}
+	var parallelism int32 = 1
+	var restartPolicy = JobRestartPolicyNever
+
+	var job1 = JobSpec{
+		JarFile:          "gs://my-bucket/myjob.jar",
+		Parallelism:      &parallelism,
+		RestartPolicy:    &restartPolicy,
+		CheckpointHealth: &JobCheckpointHealth{MaxConsecutiveFailures: 0},
+	}
+	var err1 = validator.validateJob(&job1)
+	var expectedErr1 = "job checkpointHealth.maxConsecutiveFailures must be >= 1"
+	assert.Assert(t, err1 != nil, "err is not expected to be nil")
+	assert.Equal(t, err1.Error(), expectedErr1)
+
+	var job2 = JobSpec{
+		JarFile:       "gs://my-bucket/myjob.jar",
+		Parallelism:   &parallelism,
+		RestartPolicy: &restartPolicy,
+		CheckpointHealth: &JobCheckpointHealth{
+			MaxConsecutiveFailures:  3,
+			MaxCheckpointAgeSeconds: -1,
+		},
+	}
+	var err2 = validator.validateJob(&job2)
+	var expectedErr2 = "job checkpointHealth.maxCheckpointAgeSeconds must be >= 0"
+	assert.Assert(t, err2 != nil, "err is not expected to be nil")
+	assert.Equal(t, err2.Error(), expectedErr2)
+}
+
+func TestInvalidSubmitJobTimeout(t *testing.T) {
+	var validator = &Validator{}
+	var parallelism int32 = 1
+	var restartPolicy = JobRestartPolicyNever
+	var timeout int64 = 0
+
+	var job = JobSpec{
+		JarFile:                 "gs://my-bucket/myjob.jar",
+		Parallelism:             &parallelism,
+		RestartPolicy:           &restartPolicy,
+		SubmitJobTimeoutSeconds: &timeout,
+	}
+	var err = validator.validateJob(&job)
+	var expectedErr = "job submitJobTimeoutSeconds must be > 0"
+	assert.Assert(t, err != nil, "err is not expected to be nil")
+	assert.Equal(t, err.Error(), expectedErr)
+}
+
+func TestInvalidSubmissionRetry(t *testing.T) {
+	var validator = &Validator{}
+	var parallelism int32 = 1
+	var restartPolicy = JobRestartPolicyNever
+
+	var job = JobSpec{
+		PythonScript:  "/opt/flink/job/wordcount.py",
+		Parallelism:   &parallelism,
+		RestartPolicy: &restartPolicy,
+		SubmissionRetry: &JobSubmissionRetry{
+			DeadlineSeconds:       300,
+			InitialBackoffSeconds: 5,
+			BackoffMultiplier:     2,
+			MaxBackoffSeconds:     60,
+		},
+	}
+	var err = validator.validateJob(&job)
+	var expectedErr = "job submissionRetry requires jarFile without " +
+		"pythonScript, sqlJob and streamGraphJSON"
+	assert.Assert(t, err != nil, "err is not expected to be nil")
+	assert.Equal(t, err.Error(), expectedErr)
+
+	job.PythonScript = ""
+	job.JarFile = "/opt/flink/job/myjob.jar"
+	job.SubmissionRetry.MaxBackoffSeconds = 1
+	err = validator.validateJob(&job)
+	expectedErr = "job submissionRetry.maxBackoffSeconds must be >= " +
+		"initialBackoffSeconds"
+	assert.Assert(t, err != nil, "err is not expected to be nil")
+	assert.Equal(t, err.Error(), expectedErr)
+}
+
+func TestInvalidJobSuccessHooks(t *testing.T) {
+	var validator = &Validator{}
+
+	var err = validator.validateJobSuccessHooks(&JobSuccessHooks{})
+	assert.Error(t, err, "job onSuccess requires webhookURL or triggerJobName")
+
+	err = validator.validateJobSuccessHooks(
+		&JobSuccessHooks{WebhookURL: "ftp://example.com/notify"})
+	assert.Error(t, err, "invalid job onSuccess.webhookURL: ftp://example.com/notify")
+
+	err = validator.validateJobSuccessHooks(&JobSuccessHooks{
+		WebhookURL:  "https://example.com/notify",
+		Annotations: map[string]string{"team": "data"},
+	})
+	assert.Error(t, err, "job onSuccess.annotations requires triggerJobName")
+
+	err = validator.validateJobSuccessHooks(
+		&JobSuccessHooks{TriggerJobName: "Next_Step"})
+	assert.Assert(t, err != nil, "err is not expected to be nil")
+
+	err = validator.validateJobSuccessHooks(&JobSuccessHooks{
+		WebhookURL:     "https://example.com/notify",
+		TriggerJobName: "next-step",
+		Annotations:    map[string]string{"team": "data"},
+	})
+	assert.NilError(t, err)
+}
+
+func TestInvalidMonitoring(t *testing.T) {
+	var validator = &Validator{}
+
+	var monitoring = MonitoringSpec{
+		GrafanaDashboard: &GrafanaDashboardSpec{
+			Enabled:   true,
+			Namespace: "Monitoring_Namespace",
+		},
+	}
+	var err = validator.validateMonitoring(&monitoring)
+	var expectedErr = "invalid Grafana dashboard namespace: Monitoring_Namespace"
+	assert.Assert(t, err != nil, "err is not expected to be nil")
+	assert.Equal(t, err.Error(), expectedErr)
+
+	// The namespace of the cluster by default.
+	monitoring.GrafanaDashboard.Namespace = ""
+	assert.NilError(t, validator.validateMonitoring(&monitoring))
+}
+
+func TestInvalidNamingPrefix(t *testing.T) {
+	var validator = &Validator{}
+
+	var err = validator.validateNamingPrefix("Tenant_1")
+	assert.ErrorContains(t, err, "invalid namingPrefix: ")
+
+	assert.NilError(t, validator.validateNamingPrefix(""))
+	assert.NilError(t, validator.validateNamingPrefix("tenant1-mc"))
+}
+
+func TestDuplicateNamingPrefix(t *testing.T) {
+	var prefixed = FlinkCluster{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "cluster-a"},
+		Spec:       FlinkClusterSpec{NamingPrefix: "tenant1"},
+	}
+	var unprefixed = FlinkCluster{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "cluster-b"},
+	}
+	var testScheme = runtime.NewScheme()
+	assert.NilError(t, AddToScheme(testScheme))
+	var validator = &Validator{
+		k8sReader: fake.NewFakeClientWithScheme(
+			testScheme, &prefixed, &unprefixed),
+	}
+	var getCluster = func(namespace, name, prefix string) *FlinkCluster {
+		return &FlinkCluster{
+			ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: name},
+			Spec:       FlinkClusterSpec{NamingPrefix: prefix},
+		}
+	}
+
+	// The same naming prefix as another cluster.
+	var err = validator.validateNamingPrefixUnique(
+		getCluster("default", "cluster-c", "tenant1"))
+	assert.Error(
+		t,
+		err,
+		"naming prefix tenant1 collides with the resources of cluster cluster-a")
+
+	// The name of another cluster, with or without its own prefix.
+	err = validator.validateNamingPrefixUnique(
+		getCluster("default", "cluster-c", "cluster-b"))
+	assert.Error(
+		t,
+		err,
+		"naming prefix cluster-b collides with the resources of cluster cluster-b")
+	err = validator.validateNamingPrefixUnique(
+		getCluster("default", "cluster-c", "cluster-a"))
+	assert.Error(
+		t,
+		err,
+		"naming prefix cluster-a collides with the resources of cluster cluster-a")
+
+	// The name of a cluster without a prefix is the prefix of another one.
+	err = validator.validateNamingPrefixUnique(
+		getCluster("default", "tenant1", ""))
+	assert.Error(
+		t,
+		err,
+		"naming prefix tenant1 collides with the resources of cluster cluster-a")
+
+	// The cluster itself, other prefixes and other namespaces are fine.
+	assert.NilError(t, validator.validateNamingPrefixUnique(&prefixed))
+	assert.NilError(t, validator.validateNamingPrefixUnique(
+		getCluster("default", "cluster-c", "tenant2")))
+	assert.NilError(t, validator.validateNamingPrefixUnique(
+		getCluster("other", "cluster-c", "tenant1")))
+}
+
+func TestInvalidHealthCheck(t *testing.T) {
+	var validator = &Validator{}
+	var zero int32 = 0
+
+	var err = validator.validateHealthCheck(
+		&HealthCheckSpec{Enabled: true, IntervalSeconds: &zero})
+	assert.Error(t, err, "healthCheck intervalSeconds must be > 0")
+
+	err = validator.validateHealthCheck(
+		&HealthCheckSpec{Enabled: true, FailureThreshold: &zero})
+	assert.Error(t, err, "healthCheck failureThreshold must be > 0")
+
+	err = validator.validateHealthCheck(
+		&HealthCheckSpec{Enabled: true, SuccessThreshold: &zero})
+	assert.Error(t, err, "healthCheck successThreshold must be > 0")
+
+	assert.NilError(t, validator.validateHealthCheck(&HealthCheckSpec{}))
+}
+
+func TestInvalidDeploymentMode(t *testing.T) {
+	var validator = &Validator{}
+	var restartPolicy = JobRestartPolicyNever
+	var cluster = FlinkCluster{
+		Spec: FlinkClusterSpec{
+			Image:          ImageSpec{Name: "flink:1.12"},
+			DeploymentMode: DeploymentModeNative,
+			Job: &JobSpec{
+				JarFile:       "/opt/flink/usrlib/wordcount.jar",
+				RestartPolicy: &restartPolicy,
+			},
+		},
+	}
+	assert.NilError(t, validator.validateDeploymentMode(&cluster))
+
+	cluster.Spec.Image.Name = "flink:1.10"
+	assert.Error(
+		t,
+		validator.validateDeploymentMode(&cluster),
+		"native deploymentMode requires Flink 1.12 or later, but image flink:1.10 is Flink 1.10")
+	cluster.Spec.Image.Name = "flink:1.12"
+
+	cluster.Spec.Job.JarFile = "gs://my-bucket/wordcount.jar"
+	assert.Error(
+		t,
+		validator.validateDeploymentMode(&cluster),
+		"native deploymentMode requires job jarFile in the image: gs://my-bucket/wordcount.jar")
+	cluster.Spec.Job.JarFile = "local:///opt/flink/usrlib/wordcount.jar"
+	assert.NilError(t, validator.validateDeploymentMode(&cluster))
+
+	var onFailure = JobRestartPolicyOnFailure
+	cluster.Spec.Job.RestartPolicy = &onFailure
+	assert.Error(
+		t,
+		validator.validateDeploymentMode(&cluster),
+		"native deploymentMode requires job restartPolicy Never")
+	cluster.Spec.Job.RestartPolicy = &restartPolicy
+
+	cluster.Spec.Job = nil
+	assert.Error(
+		t,
+		validator.validateDeploymentMode(&cluster),
+		"native deploymentMode requires a job")
+
+	cluster.Spec.DeploymentMode = "standalone"
+	assert.Error(
+		t,
+		validator.validateDeploymentMode(&cluster),
+		"invalid deploymentMode: standalone")
+}
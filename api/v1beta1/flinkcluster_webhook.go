@@ -18,10 +18,16 @@ limitations under the License.
 package v1beta1
 
 import (
+	"context"
+	"encoding/json"
+	"net/http"
+
+	admissionv1beta1 "k8s.io/api/admission/v1beta1"
 	"k8s.io/apimachinery/pkg/runtime"
 	ctrl "sigs.k8s.io/controller-runtime"
 	logf "sigs.k8s.io/controller-runtime/pkg/runtime/log"
 	"sigs.k8s.io/controller-runtime/pkg/webhook"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
 )
 
 // +kubebuilder:docs-gen:collapse=Go imports
@@ -30,6 +36,19 @@ var log = logf.Log.WithName("webhook")
 
 // SetupWebhookWithManager adds webhook for FlinkCluster.
 func (cluster *FlinkCluster) SetupWebhookWithManager(mgr ctrl.Manager) error {
+	// Read referenced resources directly from the API server, so that the
+	// webhook doesn't cache all the secrets.
+	validator.k8sReader = mgr.GetAPIReader()
+	// The webhooks handle the raw objects, so that the fields of a templated
+	// cluster set to zero values, which override the template, are neither
+	// dropped nor ignored. The builder skips the registered paths.
+	var server = mgr.GetWebhookServer()
+	server.Register(
+		"/mutate-flinkoperator-k8s-io-v1beta1-flinkcluster",
+		&webhook.Admission{Handler: &clusterDefaulter{}})
+	server.Register(
+		"/validate-flinkoperator-k8s-io-v1beta1-flinkcluster",
+		&webhook.Admission{Handler: &clusterValidator{}})
 	return ctrl.NewWebhookManagedBy(mgr).
 		For(cluster).
 		Complete()
@@ -55,10 +74,77 @@ var _ webhook.Defaulter = &FlinkCluster{}
 // type.
 func (cluster *FlinkCluster) Default() {
 	log.Info("default", "name", cluster.Name, "original", *cluster)
+	// The defaults of a templated cluster are set by clusterDefaulter, which
+	// reads the template.
+	if cluster.Spec.TemplateRef != nil {
+		return
+	}
 	_SetDefault(cluster)
 	log.Info("default", "name", cluster.Name, "augmented", *cluster)
 }
 
+// Sets the defaults of the clusters. The defaults of a templated cluster are
+// only set for the fields which neither the cluster nor the template sets,
+// and they are added to the raw object, so that the fields set to zero values
+// are kept. They are left to the operator if the template doesn't exist.
+type clusterDefaulter struct {
+	decoder *admission.Decoder
+}
+
+// InjectDecoder implements admission.DecoderInjector.
+func (d *clusterDefaulter) InjectDecoder(decoder *admission.Decoder) error {
+	d.decoder = decoder
+	return nil
+}
+
+// Handle implements admission.Handler.
+func (d *clusterDefaulter) Handle(
+	ctx context.Context, req admission.Request) admission.Response {
+	var cluster = &FlinkCluster{}
+	var err = d.decoder.Decode(req, cluster)
+	if err != nil {
+		return admission.Errored(http.StatusBadRequest, err)
+	}
+	if cluster.Spec.TemplateRef == nil {
+		cluster.Default()
+		var defaulted, err = json.Marshal(cluster)
+		if err != nil {
+			return admission.Errored(http.StatusInternalServerError, err)
+		}
+		return admission.PatchResponseFromRaw(req.Object.Raw, defaulted)
+	}
+
+	var object map[string]interface{}
+	err = json.Unmarshal(req.Object.Raw, &object)
+	if err != nil {
+		return admission.Errored(http.StatusBadRequest, err)
+	}
+	var spec, _ = object["spec"].(map[string]interface{})
+	if spec == nil {
+		spec = map[string]interface{}{}
+	}
+	rawSpec, err := json.Marshal(spec)
+	if err != nil {
+		return admission.Errored(http.StatusBadRequest, err)
+	}
+	template, err := validator.getTemplate(cluster)
+	if err != nil || template == nil {
+		return admission.Allowed("")
+	}
+	defaults, err := getTemplatedDefaults(cluster, rawSpec, template)
+	if err != nil {
+		return admission.Errored(http.StatusBadRequest, err)
+	}
+	log.Info("default", "name", cluster.Name, "templateDefaults", defaults)
+	mergeJSONObject(spec, defaults)
+	object["spec"] = spec
+	defaulted, err := json.Marshal(object)
+	if err != nil {
+		return admission.Errored(http.StatusInternalServerError, err)
+	}
+	return admission.PatchResponseFromRaw(req.Object.Raw, defaulted)
+}
+
 /*
 This marker is responsible for generating a validating webhook manifest.
 */
@@ -92,4 +178,51 @@ func (cluster *FlinkCluster) ValidateDelete() error {
 	return nil
 }
 
+// Validates the clusters with the raw spec, which a templated cluster is
+// merged with its template by.
+type clusterValidator struct {
+	decoder *admission.Decoder
+}
+
+// InjectDecoder implements admission.DecoderInjector.
+func (v *clusterValidator) InjectDecoder(decoder *admission.Decoder) error {
+	v.decoder = decoder
+	return nil
+}
+
+// Handle implements admission.Handler.
+func (v *clusterValidator) Handle(
+	ctx context.Context, req admission.Request) admission.Response {
+	var cluster = &FlinkCluster{}
+	var err = v.decoder.DecodeRaw(req.Object, cluster)
+	if err != nil {
+		return admission.Errored(http.StatusBadRequest, err)
+	}
+	var object struct {
+		Spec json.RawMessage `json:"spec"`
+	}
+	err = json.Unmarshal(req.Object.Raw, &object)
+	if err != nil {
+		return admission.Errored(http.StatusBadRequest, err)
+	}
+
+	switch req.Operation {
+	case admissionv1beta1.Create:
+		log.Info("Validate create", "name", cluster.Name)
+		err = validator.validateCreate(cluster, object.Spec)
+	case admissionv1beta1.Update:
+		log.Info("Validate update", "name", cluster.Name)
+		var oldCluster = &FlinkCluster{}
+		err = v.decoder.DecodeRaw(req.OldObject, oldCluster)
+		if err != nil {
+			return admission.Errored(http.StatusBadRequest, err)
+		}
+		err = validator.validateUpdate(oldCluster, cluster, object.Spec)
+	}
+	if err != nil {
+		return admission.Denied(err.Error())
+	}
+	return admission.Allowed("")
+}
+
 // +kubebuilder:docs-gen:collapse=Validate object name
@@ -0,0 +1,300 @@
+/*
+Copyright 2019 Google LLC.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1beta1
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// GetRawClusterSpec gets the JSON of the spec of the cluster as stored, which
+// keeps the fields explicitly set to zero values, unlike the typed cluster.
+func GetRawClusterSpec(
+	ctx context.Context,
+	reader client.Reader,
+	namespace string,
+	name string) ([]byte, error) {
+	var object = &unstructured.Unstructured{}
+	object.SetGroupVersionKind(GroupVersion.WithKind("FlinkCluster"))
+	var err = reader.Get(
+		ctx, types.NamespacedName{Namespace: namespace, Name: name}, object)
+	if err != nil {
+		return nil, err
+	}
+	var spec, _, _ = unstructured.NestedFieldNoCopy(object.Object, "spec")
+	return json.Marshal(spec)
+}
+
+// GetTemplatedCluster returns a copy of the cluster whose spec is the spec of
+// the template merged with the spec of the cluster, and sets the defaults for
+// the properties specified by neither of them. Only the defaults are set if
+// the template is nil, e.g., when it doesn't exist.
+//
+// The specs are merged in JSON: the fields set in the cluster take
+// precedence, objects and maps are merged per key, lists replace the lists of
+// the template and null removes the field of the template. rawSpec is the
+// JSON of the spec of the cluster as stored, so that the fields explicitly
+// set to zero values, e.g., `suspend: false` or `replicas: 0`, override the
+// template. If it is nil, only the non-zero values of the spec of the cluster
+// override the template.
+func GetTemplatedCluster(
+	cluster *FlinkCluster,
+	rawSpec []byte,
+	template *FlinkClusterTemplate) (*FlinkCluster, error) {
+	var templated = cluster.DeepCopy()
+	if template != nil {
+		var spec, err = mergeTemplateSpec(cluster, rawSpec, template)
+		if err != nil {
+			return nil, err
+		}
+		templated.Spec = *spec
+	}
+	_SetDefault(templated)
+	return templated, nil
+}
+
+// Gets the defaults of the templated cluster which are set by the mutating
+// webhook, i.e., of the fields set by neither the cluster nor the template, as
+// a JSON merge patch of the spec of the cluster.
+func getTemplatedDefaults(
+	cluster *FlinkCluster,
+	rawSpec []byte,
+	template *FlinkClusterTemplate) (map[string]interface{}, error) {
+	var spec, err = mergeTemplateSpec(cluster, rawSpec, template)
+	if err != nil {
+		return nil, err
+	}
+	var merged = cluster.DeepCopy()
+	merged.Spec = *spec
+	before, err := toJSONObject(&merged.Spec)
+	if err != nil {
+		return nil, err
+	}
+	_SetDefault(merged)
+	after, err := toJSONObject(&merged.Spec)
+	if err != nil {
+		return nil, err
+	}
+	return diffJSONObject(before, after), nil
+}
+
+// Merges the spec of the template with the spec of the cluster, without the
+// defaults.
+func mergeTemplateSpec(
+	cluster *FlinkCluster,
+	rawSpec []byte,
+	template *FlinkClusterTemplate) (*FlinkClusterSpec, error) {
+	if rawSpec == nil {
+		var spec = template.Spec.DeepCopy()
+		overlayValue(
+			reflect.ValueOf(spec).Elem(),
+			reflect.ValueOf(cluster.Spec.DeepCopy()).Elem())
+		return spec, nil
+	}
+	var clusterSpec map[string]interface{}
+	var err = json.Unmarshal(rawSpec, &clusterSpec)
+	if err != nil {
+		return nil, err
+	}
+	pruneUnsetFields(clusterSpec, reflect.TypeOf(FlinkClusterSpec{}))
+	templateSpec, err := toJSONObject(&template.Spec)
+	if err != nil {
+		return nil, err
+	}
+	mergeJSONObject(templateSpec, clusterSpec)
+	var merged, _ = json.Marshal(templateSpec)
+	var spec = &FlinkClusterSpec{}
+	err = json.Unmarshal(merged, spec)
+	if err != nil {
+		return nil, err
+	}
+	return spec, nil
+}
+
+// Removes the fields of the JSON object which are not omitted when empty and
+// have the zero value of their type, e.g., `image: {name: ""}`. Typed
+// clients, including the operator, write them back on every update, so they
+// don't mean that the field is set.
+func pruneUnsetFields(object map[string]interface{}, objectType reflect.Type) {
+	var fields = map[string]reflect.StructField{}
+	getJSONFields(objectType, fields)
+	for key, value := range object {
+		var field, ok = fields[key]
+		if !ok {
+			continue
+		}
+		var fieldType = field.Type
+		if fieldType.Kind() == reflect.Ptr {
+			fieldType = fieldType.Elem()
+		}
+		var valueObject, isObject = value.(map[string]interface{})
+		if isObject && fieldType.Kind() == reflect.Struct &&
+			!hasUnexportedFields(fieldType) {
+			pruneUnsetFields(valueObject, fieldType)
+		}
+		if strings.Contains(field.Tag.Get("json"), ",omitempty") {
+			continue
+		}
+		var zero, _ = json.Marshal(reflect.Zero(field.Type).Interface())
+		var zeroValue interface{}
+		json.Unmarshal(zero, &zeroValue)
+		if reflect.DeepEqual(value, zeroValue) ||
+			(isObject && len(valueObject) == 0) {
+			delete(object, key)
+		}
+	}
+}
+
+// Gets the fields of the struct type by their JSON names, including the
+// fields of the embedded structs.
+func getJSONFields(
+	structType reflect.Type, fields map[string]reflect.StructField) {
+	for i := 0; i < structType.NumField(); i++ {
+		var field = structType.Field(i)
+		var name = strings.Split(field.Tag.Get("json"), ",")[0]
+		if name == "-" {
+			continue
+		}
+		if field.Anonymous && len(name) == 0 &&
+			field.Type.Kind() == reflect.Struct {
+			getJSONFields(field.Type, fields)
+			continue
+		}
+		if len(name) == 0 {
+			name = field.Name
+		}
+		fields[name] = field
+	}
+}
+
+// Gets the JSON object of the value.
+func toJSONObject(value interface{}) (map[string]interface{}, error) {
+	var data, err = json.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+	var object map[string]interface{}
+	err = json.Unmarshal(data, &object)
+	return object, err
+}
+
+// Merges src into dst like a JSON merge patch (RFC 7386).
+func mergeJSONObject(dst map[string]interface{}, src map[string]interface{}) {
+	for key, srcValue := range src {
+		if srcValue == nil {
+			delete(dst, key)
+			continue
+		}
+		var srcObject, srcIsObject = srcValue.(map[string]interface{})
+		var dstObject, dstIsObject = dst[key].(map[string]interface{})
+		if srcIsObject && dstIsObject {
+			mergeJSONObject(dstObject, srcObject)
+			continue
+		}
+		dst[key] = srcValue
+	}
+}
+
+// Gets the fields of the JSON object after which are added or changed from
+// the object before, as a JSON merge patch without removals.
+func diffJSONObject(
+	before map[string]interface{},
+	after map[string]interface{}) map[string]interface{} {
+	var diff = map[string]interface{}{}
+	for key, afterValue := range after {
+		var beforeValue, found = before[key]
+		var afterObject, afterIsObject = afterValue.(map[string]interface{})
+		var beforeObject, beforeIsObject = beforeValue.(map[string]interface{})
+		if found && afterIsObject && beforeIsObject {
+			var objectDiff = diffJSONObject(beforeObject, afterObject)
+			if len(objectDiff) > 0 {
+				diff[key] = objectDiff
+			}
+			continue
+		}
+		if !found || !reflect.DeepEqual(beforeValue, afterValue) {
+			diff[key] = afterValue
+		}
+	}
+	return diff
+}
+
+// Overlays dst with the non-zero values in src. Structs and pointers to
+// structs are merged field by field, maps are merged per key, non-empty
+// slices replace the slices in dst. Structs with unexported fields, e.g.,
+// resource quantities, are replaced as a whole.
+func overlayValue(dst reflect.Value, src reflect.Value) {
+	switch src.Kind() {
+	case reflect.Struct:
+		if hasUnexportedFields(src.Type()) {
+			if !isZeroValue(src) {
+				dst.Set(src)
+			}
+			return
+		}
+		for i := 0; i < src.NumField(); i++ {
+			overlayValue(dst.Field(i), src.Field(i))
+		}
+	case reflect.Ptr:
+		if src.IsNil() {
+			return
+		}
+		if dst.IsNil() || src.Elem().Kind() != reflect.Struct {
+			dst.Set(src)
+			return
+		}
+		overlayValue(dst.Elem(), src.Elem())
+	case reflect.Map:
+		if src.Len() == 0 {
+			return
+		}
+		if dst.IsNil() {
+			dst.Set(reflect.MakeMap(src.Type()))
+		}
+		for _, key := range src.MapKeys() {
+			dst.SetMapIndex(key, src.MapIndex(key))
+		}
+	case reflect.Slice:
+		if src.Len() > 0 {
+			dst.Set(src)
+		}
+	default:
+		if !isZeroValue(src) {
+			dst.Set(src)
+		}
+	}
+}
+
+func hasUnexportedFields(structType reflect.Type) bool {
+	for i := 0; i < structType.NumField(); i++ {
+		if len(structType.Field(i).PkgPath) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+func isZeroValue(value reflect.Value) bool {
+	return reflect.DeepEqual(
+		value.Interface(), reflect.Zero(value.Type()).Interface())
+}
@@ -0,0 +1,179 @@
+/*
+Copyright 2019 Google LLC.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1beta1
+
+import (
+	"testing"
+
+	"gotest.tools/assert"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestGetTemplatedCluster(t *testing.T) {
+	var templateReplicas int32 = 3
+	var template = FlinkClusterTemplate{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "base"},
+		Spec: FlinkClusterSpec{
+			Image: ImageSpec{
+				Name:       "flink:1.9.1",
+				PullPolicy: corev1.PullIfNotPresent,
+			},
+			JobManager: JobManagerSpec{
+				Resources: corev1.ResourceRequirements{
+					Limits: corev1.ResourceList{
+						corev1.ResourceMemory: resource.MustParse("1Gi"),
+					},
+				},
+			},
+			TaskManager: TaskManagerSpec{
+				Replicas: templateReplicas,
+				NodeSelector: map[string]string{
+					"pool": "flink",
+				},
+			},
+			FlinkProperties: map[string]string{
+				"taskmanager.numberOfTaskSlots": "2",
+				"state.backend":                 "rocksdb",
+			},
+			ExtraClassPath: []string{"/opt/flink/extra/a.jar"},
+		},
+	}
+	var cluster = FlinkCluster{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "mycluster"},
+		Spec: FlinkClusterSpec{
+			Image: ImageSpec{Name: "flink:1.10.0"},
+			JobManager: JobManagerSpec{
+				Resources: corev1.ResourceRequirements{
+					Limits: corev1.ResourceList{
+						corev1.ResourceMemory: resource.MustParse("2Gi"),
+					},
+				},
+			},
+			FlinkProperties: map[string]string{
+				"taskmanager.numberOfTaskSlots": "4",
+			},
+			TemplateRef: &corev1.LocalObjectReference{Name: "base"},
+		},
+	}
+
+	var templated, err = GetTemplatedCluster(&cluster, nil, &template)
+	assert.NilError(t, err)
+
+	// The cluster spec takes precedence.
+	assert.Equal(t, templated.Spec.Image.Name, "flink:1.10.0")
+	assert.Equal(t, templated.Spec.FlinkVersion, "1.10")
+	var jmMemory = templated.Spec.JobManager.Resources.Limits[corev1.ResourceMemory]
+	assert.Equal(t, jmMemory.String(), "2Gi")
+	// The unset fields are inherited from the template.
+	assert.Equal(t, templated.Spec.Image.PullPolicy, corev1.PullIfNotPresent)
+	assert.Equal(t, templated.Spec.TaskManager.Replicas, templateReplicas)
+	assert.DeepEqual(
+		t,
+		templated.Spec.TaskManager.NodeSelector,
+		map[string]string{"pool": "flink"})
+	assert.DeepEqual(
+		t, templated.Spec.ExtraClassPath, []string{"/opt/flink/extra/a.jar"})
+	// Maps are merged per key.
+	assert.DeepEqual(
+		t,
+		templated.Spec.FlinkProperties,
+		map[string]string{
+			"taskmanager.numberOfTaskSlots": "4",
+			"state.backend":                 "rocksdb",
+		})
+	// The defaults are set after merging.
+	assert.Assert(t, templated.Spec.JobManager.Replicas != nil)
+	assert.Assert(t, templated.Spec.JobManager.Ports.UI != nil)
+	// Neither the cluster nor the template is modified.
+	assert.Equal(t, cluster.Spec.Image.PullPolicy, corev1.PullPolicy(""))
+	assert.Equal(t, len(cluster.Spec.FlinkProperties), 1)
+	assert.Equal(t, template.Spec.FlinkProperties["taskmanager.numberOfTaskSlots"], "2")
+	assert.Assert(t, template.Spec.JobManager.Replicas == nil)
+
+	// Only the defaults are set without a template.
+	templated, err = GetTemplatedCluster(&cluster, nil, nil)
+	assert.NilError(t, err)
+	assert.Equal(t, templated.Spec.Image.PullPolicy, corev1.PullAlways)
+	assert.Equal(t, templated.Spec.TaskManager.Replicas, int32(2))
+}
+
+func TestGetTemplatedClusterWithRawSpec(t *testing.T) {
+	var template = FlinkClusterTemplate{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "base"},
+		Spec: FlinkClusterSpec{
+			Image: ImageSpec{Name: "flink:1.9.1"},
+			TaskManager: TaskManagerSpec{
+				Replicas:    3,
+				PreStopHook: true,
+				NodeSelector: map[string]string{
+					"pool": "flink",
+				},
+			},
+			FlinkProperties: map[string]string{
+				"taskmanager.numberOfTaskSlots": "2",
+				"state.backend":                 "rocksdb",
+			},
+			Suspend: true,
+		},
+	}
+	var cluster = FlinkCluster{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "mycluster"},
+		Spec: FlinkClusterSpec{
+			TemplateRef: &corev1.LocalObjectReference{Name: "base"},
+		},
+	}
+	var rawSpec = []byte(`{
+		"templateRef": {"name": "base"},
+		"image": {"name": ""},
+		"suspend": false,
+		"taskManager": {"preStopHook": false, "nodeSelector": null},
+		"flinkProperties": {"state.backend": null}
+	}`)
+
+	var templated, err = GetTemplatedCluster(&cluster, rawSpec, &template)
+	assert.NilError(t, err)
+
+	// The fields set to zero values or null override the template.
+	assert.Equal(t, templated.Spec.Suspend, false)
+	assert.Equal(t, templated.Spec.TaskManager.PreStopHook, false)
+	assert.Assert(t, templated.Spec.TaskManager.NodeSelector == nil)
+	assert.DeepEqual(
+		t,
+		templated.Spec.FlinkProperties,
+		map[string]string{"taskmanager.numberOfTaskSlots": "2"})
+	// The other fields are inherited from the template, including the fields
+	// which are not omitted when empty, and written by typed clients.
+	assert.Equal(t, templated.Spec.Image.Name, "flink:1.9.1")
+	assert.Equal(t, templated.Spec.TaskManager.Replicas, int32(3))
+	assert.Equal(t, template.Spec.Suspend, true)
+
+	// Only the fields set by neither the cluster nor the template are
+	// defaulted by the webhook.
+	defaults, err := getTemplatedDefaults(&cluster, rawSpec, &template)
+	assert.NilError(t, err)
+	var tmDefaults = defaults["taskManager"].(map[string]interface{})
+	var _, ok = tmDefaults["replicas"]
+	assert.Assert(t, !ok)
+	_, ok = defaults["image"].(map[string]interface{})["name"]
+	assert.Assert(t, !ok)
+	assert.Equal(
+		t,
+		defaults["jobManager"].(map[string]interface{})["replicas"],
+		float64(1))
+}
@@ -0,0 +1,48 @@
+/*
+Copyright 2019 Google LLC.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1beta1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// +kubebuilder:object:root=true
+
+// FlinkClusterTemplate is the Schema for the flinkclustertemplates API. It
+// holds a cluster spec shared by the FlinkClusters in the same namespace
+// which reference it by `templateRef`.
+type FlinkClusterTemplate struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	// The cluster spec of the template, the spec of a referencing cluster
+	// takes precedence over it.
+	Spec FlinkClusterSpec `json:"spec"`
+}
+
+// +kubebuilder:object:root=true
+
+// FlinkClusterTemplateList contains a list of FlinkClusterTemplate
+type FlinkClusterTemplateList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []FlinkClusterTemplate `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&FlinkClusterTemplate{}, &FlinkClusterTemplateList{})
+}
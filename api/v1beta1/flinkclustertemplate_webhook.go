@@ -0,0 +1,59 @@
+/*
+Copyright 2019 Google LLC.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+// +kubebuilder:docs-gen:collapse=Apache License
+package v1beta1
+
+import (
+	"k8s.io/apimachinery/pkg/runtime"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/webhook"
+)
+
+// SetupWebhookWithManager adds webhook for FlinkClusterTemplate.
+func (template *FlinkClusterTemplate) SetupWebhookWithManager(
+	mgr ctrl.Manager) error {
+	validator.k8sReader = mgr.GetAPIReader()
+	return ctrl.NewWebhookManagedBy(mgr).
+		For(template).
+		Complete()
+}
+
+// +kubebuilder:webhook:path=/validate-flinkoperator-k8s-io-v1beta1-flinkclustertemplate,mutating=false,failurePolicy=fail,groups=flinkoperator.k8s.io,resources=flinkclustertemplates,verbs=create;update,versions=v1beta1,name=vflinkclustertemplate.flinkoperator.k8s.io
+
+var _ webhook.Validator = &FlinkClusterTemplate{}
+
+// ValidateCreate implements webhook.Validator so a webhook will be registered
+// for the type.
+func (template *FlinkClusterTemplate) ValidateCreate() error {
+	log.Info("Validate template create", "name", template.Name)
+	return validator.ValidateTemplateCreate(template)
+}
+
+// ValidateUpdate implements webhook.Validator so a webhook will be registered
+// for the type.
+func (template *FlinkClusterTemplate) ValidateUpdate(old runtime.Object) error {
+	log.Info("Validate template update", "name", template.Name)
+	var oldTemplate = old.(*FlinkClusterTemplate)
+	return validator.ValidateTemplateUpdate(oldTemplate, template)
+}
+
+// ValidateDelete implements webhook.Validator so a webhook will be registered
+// for the type. The clusters referencing a deleted template keep running with
+// the last merged spec until they are updated.
+func (template *FlinkClusterTemplate) ValidateDelete() error {
+	log.Info("Validate template delete", "name", template.Name)
+	return nil
+}
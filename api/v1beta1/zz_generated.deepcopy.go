@@ -22,9 +22,41 @@ package v1beta1
 
 import (
 	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 )
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *CheckpointConfig) DeepCopyInto(out *CheckpointConfig) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CheckpointConfig.
+func (in *CheckpointConfig) DeepCopy() *CheckpointConfig {
+	if in == nil {
+		return nil
+	}
+	out := new(CheckpointConfig)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *CheckpointStorageSpec) DeepCopyInto(out *CheckpointStorageSpec) {
+	*out = *in
+	out.StorageSize = in.StorageSize.DeepCopy()
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CheckpointStorageSpec.
+func (in *CheckpointStorageSpec) DeepCopy() *CheckpointStorageSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(CheckpointStorageSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *CleanupPolicy) DeepCopyInto(out *CleanupPolicy) {
 	*out = *in
@@ -40,6 +72,64 @@ func (in *CleanupPolicy) DeepCopy() *CleanupPolicy {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ClusterRef) DeepCopyInto(out *ClusterRef) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ClusterRef.
+func (in *ClusterRef) DeepCopy() *ClusterRef {
+	if in == nil {
+		return nil
+	}
+	out := new(ClusterRef)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *DiagnosticsBundleSpec) DeepCopyInto(out *DiagnosticsBundleSpec) {
+	*out = *in
+	if in.TriggerOnState != nil {
+		in, out := &in.TriggerOnState, &out.TriggerOnState
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.ServiceAccountAnnotations != nil {
+		in, out := &in.ServiceAccountAnnotations, &out.ServiceAccountAnnotations
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new DiagnosticsBundleSpec.
+func (in *DiagnosticsBundleSpec) DeepCopy() *DiagnosticsBundleSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(DiagnosticsBundleSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *EmptyDirVolumeSpec) DeepCopyInto(out *EmptyDirVolumeSpec) {
+	*out = *in
+	out.SizeLimit = in.SizeLimit.DeepCopy()
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new EmptyDirVolumeSpec.
+func (in *EmptyDirVolumeSpec) DeepCopy() *EmptyDirVolumeSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(EmptyDirVolumeSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *FlinkCluster) DeepCopyInto(out *FlinkCluster) {
 	*out = *in
@@ -70,6 +160,11 @@ func (in *FlinkCluster) DeepCopyObject() runtime.Object {
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *FlinkClusterComponentState) DeepCopyInto(out *FlinkClusterComponentState) {
 	*out = *in
+	if in.Metrics != nil {
+		in, out := &in.Metrics, &out.Metrics
+		*out = new(JobManagerMetrics)
+		**out = **in
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new FlinkClusterComponentState.
@@ -85,18 +180,35 @@ func (in *FlinkClusterComponentState) DeepCopy() *FlinkClusterComponentState {
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *FlinkClusterComponentsStatus) DeepCopyInto(out *FlinkClusterComponentsStatus) {
 	*out = *in
-	out.ConfigMap = in.ConfigMap
-	out.JobManagerDeployment = in.JobManagerDeployment
+	in.ConfigMap.DeepCopyInto(&out.ConfigMap)
+	in.JobManagerDeployment.DeepCopyInto(&out.JobManagerDeployment)
 	out.JobManagerService = in.JobManagerService
 	if in.JobManagerIngress != nil {
 		in, out := &in.JobManagerIngress, &out.JobManagerIngress
 		*out = new(JobManagerIngressStatus)
 		(*in).DeepCopyInto(*out)
 	}
-	out.TaskManagerDeployment = in.TaskManagerDeployment
+	in.TaskManagerDeployment.DeepCopyInto(&out.TaskManagerDeployment)
+	if in.TaskManagerPools != nil {
+		in, out := &in.TaskManagerPools, &out.TaskManagerPools
+		*out = make(map[string]FlinkClusterComponentState, len(*in))
+		for key, val := range *in {
+			(*out)[key] = *val.DeepCopy()
+		}
+	}
 	if in.Job != nil {
 		in, out := &in.Job, &out.Job
 		*out = new(JobStatus)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.TrafficSplitting != nil {
+		in, out := &in.TrafficSplitting, &out.TrafficSplitting
+		*out = new(TrafficSplittingStatus)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.GrafanaDashboard != nil {
+		in, out := &in.GrafanaDashboard, &out.GrafanaDashboard
+		*out = new(GrafanaDashboardStatus)
 		**out = **in
 	}
 }
@@ -111,6 +223,21 @@ func (in *FlinkClusterComponentsStatus) DeepCopy() *FlinkClusterComponentsStatus
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *FlinkClusterCondition) DeepCopyInto(out *FlinkClusterCondition) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new FlinkClusterCondition.
+func (in *FlinkClusterCondition) DeepCopy() *FlinkClusterCondition {
+	if in == nil {
+		return nil
+	}
+	out := new(FlinkClusterCondition)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *FlinkClusterList) DeepCopyInto(out *FlinkClusterList) {
 	*out = *in
@@ -178,6 +305,81 @@ func (in *FlinkClusterSpec) DeepCopyInto(out *FlinkClusterSpec) {
 		*out = new(GCPConfig)
 		(*in).DeepCopyInto(*out)
 	}
+	if in.Security != nil {
+		in, out := &in.Security, &out.Security
+		*out = new(SecuritySpec)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.JobManagerProxy != nil {
+		in, out := &in.JobManagerProxy, &out.JobManagerProxy
+		*out = new(ProxySpec)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Networking != nil {
+		in, out := &in.Networking, &out.Networking
+		*out = new(NetworkingSpec)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Monitoring != nil {
+		in, out := &in.Monitoring, &out.Monitoring
+		*out = new(MonitoringSpec)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.ServiceAccount != nil {
+		in, out := &in.ServiceAccount, &out.ServiceAccount
+		*out = new(ServiceAccountSpec)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.ExtraClassPath != nil {
+		in, out := &in.ExtraClassPath, &out.ExtraClassPath
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.Table != nil {
+		in, out := &in.Table, &out.Table
+		*out = new(TableSpec)
+		**out = **in
+	}
+	if in.CheckpointStorage != nil {
+		in, out := &in.CheckpointStorage, &out.CheckpointStorage
+		*out = new(CheckpointStorageSpec)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.CheckpointConfig != nil {
+		in, out := &in.CheckpointConfig, &out.CheckpointConfig
+		*out = new(CheckpointConfig)
+		**out = **in
+	}
+	if in.CloneFrom != nil {
+		in, out := &in.CloneFrom, &out.CloneFrom
+		*out = new(ClusterRef)
+		**out = **in
+	}
+	if in.TemplateRef != nil {
+		in, out := &in.TemplateRef, &out.TemplateRef
+		*out = new(v1.LocalObjectReference)
+		**out = **in
+	}
+	if in.InheritNamespaceLabels != nil {
+		in, out := &in.InheritNamespaceLabels, &out.InheritNamespaceLabels
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.DiagnosticsBundle != nil {
+		in, out := &in.DiagnosticsBundle, &out.DiagnosticsBundle
+		*out = new(DiagnosticsBundleSpec)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.ReadinessTimeoutSeconds != nil {
+		in, out := &in.ReadinessTimeoutSeconds, &out.ReadinessTimeoutSeconds
+		*out = new(int64)
+		**out = **in
+	}
+	if in.HealthCheck != nil {
+		in, out := &in.HealthCheck, &out.HealthCheck
+		*out = new(HealthCheckSpec)
+		(*in).DeepCopyInto(*out)
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new FlinkClusterSpec.
@@ -194,6 +396,38 @@ func (in *FlinkClusterSpec) DeepCopy() *FlinkClusterSpec {
 func (in *FlinkClusterStatus) DeepCopyInto(out *FlinkClusterStatus) {
 	*out = *in
 	in.Components.DeepCopyInto(&out.Components)
+	if in.BackpressureStatus != nil {
+		in, out := &in.BackpressureStatus, &out.BackpressureStatus
+		*out = make([]VertexBackpressure, len(*in))
+		copy(*out, *in)
+	}
+	if in.JobMetrics != nil {
+		in, out := &in.JobMetrics, &out.JobMetrics
+		*out = new(JobMetrics)
+		**out = **in
+	}
+	if in.Flink != nil {
+		in, out := &in.Flink, &out.Flink
+		*out = new(FlinkStatus)
+		**out = **in
+	}
+	if in.Conditions != nil {
+		in, out := &in.Conditions, &out.Conditions
+		*out = make([]FlinkClusterCondition, len(*in))
+		copy(*out, *in)
+	}
+	if in.EffectiveConfig != nil {
+		in, out := &in.EffectiveConfig, &out.EffectiveConfig
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+	if in.History != nil {
+		in, out := &in.History, &out.History
+		*out = make([]StatusTransition, len(*in))
+		copy(*out, *in)
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new FlinkClusterStatus.
@@ -206,6 +440,79 @@ func (in *FlinkClusterStatus) DeepCopy() *FlinkClusterStatus {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *FlinkClusterTemplate) DeepCopyInto(out *FlinkClusterTemplate) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	in.Spec.DeepCopyInto(&out.Spec)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new FlinkClusterTemplate.
+func (in *FlinkClusterTemplate) DeepCopy() *FlinkClusterTemplate {
+	if in == nil {
+		return nil
+	}
+	out := new(FlinkClusterTemplate)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *FlinkClusterTemplate) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *FlinkClusterTemplateList) DeepCopyInto(out *FlinkClusterTemplateList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	out.ListMeta = in.ListMeta
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]FlinkClusterTemplate, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new FlinkClusterTemplateList.
+func (in *FlinkClusterTemplateList) DeepCopy() *FlinkClusterTemplateList {
+	if in == nil {
+		return nil
+	}
+	out := new(FlinkClusterTemplateList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *FlinkClusterTemplateList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *FlinkStatus) DeepCopyInto(out *FlinkStatus) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new FlinkStatus.
+func (in *FlinkStatus) DeepCopy() *FlinkStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(FlinkStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *GCPConfig) DeepCopyInto(out *GCPConfig) {
 	*out = *in
@@ -241,6 +548,36 @@ func (in *GCPServiceAccount) DeepCopy() *GCPServiceAccount {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *GrafanaDashboardSpec) DeepCopyInto(out *GrafanaDashboardSpec) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new GrafanaDashboardSpec.
+func (in *GrafanaDashboardSpec) DeepCopy() *GrafanaDashboardSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(GrafanaDashboardSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *GrafanaDashboardStatus) DeepCopyInto(out *GrafanaDashboardStatus) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new GrafanaDashboardStatus.
+func (in *GrafanaDashboardStatus) DeepCopy() *GrafanaDashboardStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(GrafanaDashboardStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *HadoopConfig) DeepCopyInto(out *HadoopConfig) {
 	*out = *in
@@ -256,6 +593,36 @@ func (in *HadoopConfig) DeepCopy() *HadoopConfig {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *HealthCheckSpec) DeepCopyInto(out *HealthCheckSpec) {
+	*out = *in
+	if in.IntervalSeconds != nil {
+		in, out := &in.IntervalSeconds, &out.IntervalSeconds
+		*out = new(int32)
+		**out = **in
+	}
+	if in.FailureThreshold != nil {
+		in, out := &in.FailureThreshold, &out.FailureThreshold
+		*out = new(int32)
+		**out = **in
+	}
+	if in.SuccessThreshold != nil {
+		in, out := &in.SuccessThreshold, &out.SuccessThreshold
+		*out = new(int32)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new HealthCheckSpec.
+func (in *HealthCheckSpec) DeepCopy() *HealthCheckSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(HealthCheckSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *ImageSpec) DeepCopyInto(out *ImageSpec) {
 	*out = *in
@@ -276,6 +643,21 @@ func (in *ImageSpec) DeepCopy() *ImageSpec {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *JobCheckpointHealth) DeepCopyInto(out *JobCheckpointHealth) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new JobCheckpointHealth.
+func (in *JobCheckpointHealth) DeepCopy() *JobCheckpointHealth {
+	if in == nil {
+		return nil
+	}
+	out := new(JobCheckpointHealth)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *JobManagerIngressSpec) DeepCopyInto(out *JobManagerIngressSpec) {
 	*out = *in
@@ -333,6 +715,21 @@ func (in *JobManagerIngressStatus) DeepCopy() *JobManagerIngressStatus {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *JobManagerMetrics) DeepCopyInto(out *JobManagerMetrics) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new JobManagerMetrics.
+func (in *JobManagerMetrics) DeepCopy() *JobManagerMetrics {
+	if in == nil {
+		return nil
+	}
+	out := new(JobManagerMetrics)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *JobManagerPorts) DeepCopyInto(out *JobManagerPorts) {
 	*out = *in
@@ -410,8 +807,51 @@ func (in *JobManagerSpec) DeepCopyInto(out *JobManagerSpec) {
 			(*out)[key] = val
 		}
 	}
-}
-
+	if in.Affinity != nil {
+		in, out := &in.Affinity, &out.Affinity
+		*out = new(v1.Affinity)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Tolerations != nil {
+		in, out := &in.Tolerations, &out.Tolerations
+		*out = make([]v1.Toleration, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.Env != nil {
+		in, out := &in.Env, &out.Env
+		*out = make([]v1.EnvVar, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.EnvFrom != nil {
+		in, out := &in.EnvFrom, &out.EnvFrom
+		*out = make([]v1.EnvFromSource, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.Sidecars != nil {
+		in, out := &in.Sidecars, &out.Sidecars
+		*out = make([]v1.Container, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.GracefulShutdownTimeout != nil {
+		in, out := &in.GracefulShutdownTimeout, &out.GracefulShutdownTimeout
+		*out = new(metav1.Duration)
+		**out = **in
+	}
+	if in.Probes != nil {
+		in, out := &in.Probes, &out.Probes
+		*out = new(ProbesSpec)
+		(*in).DeepCopyInto(*out)
+	}
+}
+
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new JobManagerSpec.
 func (in *JobManagerSpec) DeepCopy() *JobManagerSpec {
 	if in == nil {
@@ -422,9 +862,59 @@ func (in *JobManagerSpec) DeepCopy() *JobManagerSpec {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *JobMetrics) DeepCopyInto(out *JobMetrics) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new JobMetrics.
+func (in *JobMetrics) DeepCopy() *JobMetrics {
+	if in == nil {
+		return nil
+	}
+	out := new(JobMetrics)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *JobRestartBackoff) DeepCopyInto(out *JobRestartBackoff) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new JobRestartBackoff.
+func (in *JobRestartBackoff) DeepCopy() *JobRestartBackoff {
+	if in == nil {
+		return nil
+	}
+	out := new(JobRestartBackoff)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *JobRescaleStatus) DeepCopyInto(out *JobRescaleStatus) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new JobRescaleStatus.
+func (in *JobRescaleStatus) DeepCopy() *JobRescaleStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(JobRescaleStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *JobSpec) DeepCopyInto(out *JobSpec) {
 	*out = *in
+	if in.SQLJob != nil {
+		in, out := &in.SQLJob, &out.SQLJob
+		*out = new(SQLJobSpec)
+		**out = **in
+	}
 	if in.ClassName != nil {
 		in, out := &in.ClassName, &out.ClassName
 		*out = new(string)
@@ -491,6 +981,31 @@ func (in *JobSpec) DeepCopyInto(out *JobSpec) {
 		*out = new(string)
 		**out = **in
 	}
+	if in.RestartBackoff != nil {
+		in, out := &in.RestartBackoff, &out.RestartBackoff
+		*out = new(JobRestartBackoff)
+		**out = **in
+	}
+	if in.SubmitJobTimeoutSeconds != nil {
+		in, out := &in.SubmitJobTimeoutSeconds, &out.SubmitJobTimeoutSeconds
+		*out = new(int64)
+		**out = **in
+	}
+	if in.SubmissionRetry != nil {
+		in, out := &in.SubmissionRetry, &out.SubmissionRetry
+		*out = new(JobSubmissionRetry)
+		**out = **in
+	}
+	if in.CheckpointHealth != nil {
+		in, out := &in.CheckpointHealth, &out.CheckpointHealth
+		*out = new(JobCheckpointHealth)
+		**out = **in
+	}
+	if in.OnSuccess != nil {
+		in, out := &in.OnSuccess, &out.OnSuccess
+		*out = new(JobSuccessHooks)
+		(*in).DeepCopyInto(*out)
+	}
 	if in.CleanupPolicy != nil {
 		in, out := &in.CleanupPolicy, &out.CleanupPolicy
 		*out = new(CleanupPolicy)
@@ -516,6 +1031,11 @@ func (in *JobSpec) DeepCopy() *JobSpec {
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *JobStatus) DeepCopyInto(out *JobStatus) {
 	*out = *in
+	if in.Rescale != nil {
+		in, out := &in.Rescale, &out.Rescale
+		*out = new(JobRescaleStatus)
+		**out = **in
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new JobStatus.
@@ -528,6 +1048,374 @@ func (in *JobStatus) DeepCopy() *JobStatus {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *JobSubmissionRetry) DeepCopyInto(out *JobSubmissionRetry) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new JobSubmissionRetry.
+func (in *JobSubmissionRetry) DeepCopy() *JobSubmissionRetry {
+	if in == nil {
+		return nil
+	}
+	out := new(JobSubmissionRetry)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *JobSuccessHooks) DeepCopyInto(out *JobSuccessHooks) {
+	*out = *in
+	if in.Annotations != nil {
+		in, out := &in.Annotations, &out.Annotations
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new JobSuccessHooks.
+func (in *JobSuccessHooks) DeepCopy() *JobSuccessHooks {
+	if in == nil {
+		return nil
+	}
+	out := new(JobSuccessHooks)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *MonitoringSpec) DeepCopyInto(out *MonitoringSpec) {
+	*out = *in
+	if in.GrafanaDashboard != nil {
+		in, out := &in.GrafanaDashboard, &out.GrafanaDashboard
+		*out = new(GrafanaDashboardSpec)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new MonitoringSpec.
+func (in *MonitoringSpec) DeepCopy() *MonitoringSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(MonitoringSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *NetworkPolicySpec) DeepCopyInto(out *NetworkPolicySpec) {
+	*out = *in
+	if in.AllowedNamespaces != nil {
+		in, out := &in.AllowedNamespaces, &out.AllowedNamespaces
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new NetworkPolicySpec.
+func (in *NetworkPolicySpec) DeepCopy() *NetworkPolicySpec {
+	if in == nil {
+		return nil
+	}
+	out := new(NetworkPolicySpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *NetworkingSpec) DeepCopyInto(out *NetworkingSpec) {
+	*out = *in
+	if in.ServiceMesh != nil {
+		in, out := &in.ServiceMesh, &out.ServiceMesh
+		*out = new(ServiceMeshSpec)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.NetworkPolicy != nil {
+		in, out := &in.NetworkPolicy, &out.NetworkPolicy
+		*out = new(NetworkPolicySpec)
+		(*in).DeepCopyInto(*out)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new NetworkingSpec.
+func (in *NetworkingSpec) DeepCopy() *NetworkingSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(NetworkingSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *OIDCConfig) DeepCopyInto(out *OIDCConfig) {
+	*out = *in
+	in.ClientSecretRef.DeepCopyInto(&out.ClientSecretRef)
+	in.CookieSecretRef.DeepCopyInto(&out.CookieSecretRef)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new OIDCConfig.
+func (in *OIDCConfig) DeepCopy() *OIDCConfig {
+	if in == nil {
+		return nil
+	}
+	out := new(OIDCConfig)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ProbeThresholds) DeepCopyInto(out *ProbeThresholds) {
+	*out = *in
+	if in.InitialDelaySeconds != nil {
+		in, out := &in.InitialDelaySeconds, &out.InitialDelaySeconds
+		*out = new(int32)
+		**out = **in
+	}
+	if in.PeriodSeconds != nil {
+		in, out := &in.PeriodSeconds, &out.PeriodSeconds
+		*out = new(int32)
+		**out = **in
+	}
+	if in.TimeoutSeconds != nil {
+		in, out := &in.TimeoutSeconds, &out.TimeoutSeconds
+		*out = new(int32)
+		**out = **in
+	}
+	if in.FailureThreshold != nil {
+		in, out := &in.FailureThreshold, &out.FailureThreshold
+		*out = new(int32)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ProbeThresholds.
+func (in *ProbeThresholds) DeepCopy() *ProbeThresholds {
+	if in == nil {
+		return nil
+	}
+	out := new(ProbeThresholds)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ProbesSpec) DeepCopyInto(out *ProbesSpec) {
+	*out = *in
+	if in.Liveness != nil {
+		in, out := &in.Liveness, &out.Liveness
+		*out = new(ProbeThresholds)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Readiness != nil {
+		in, out := &in.Readiness, &out.Readiness
+		*out = new(ProbeThresholds)
+		(*in).DeepCopyInto(*out)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ProbesSpec.
+func (in *ProbesSpec) DeepCopy() *ProbesSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(ProbesSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ProxySpec) DeepCopyInto(out *ProxySpec) {
+	*out = *in
+	if in.RateLimitRPM != nil {
+		in, out := &in.RateLimitRPM, &out.RateLimitRPM
+		*out = new(int32)
+		**out = **in
+	}
+	if in.RateLimitBurst != nil {
+		in, out := &in.RateLimitBurst, &out.RateLimitBurst
+		*out = new(int32)
+		**out = **in
+	}
+	if in.WAF != nil {
+		in, out := &in.WAF, &out.WAF
+		*out = new(bool)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ProxySpec.
+func (in *ProxySpec) DeepCopy() *ProxySpec {
+	if in == nil {
+		return nil
+	}
+	out := new(ProxySpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *RESTTLSSpec) DeepCopyInto(out *RESTTLSSpec) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new RESTTLSSpec.
+func (in *RESTTLSSpec) DeepCopy() *RESTTLSSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(RESTTLSSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *SQLJobSpec) DeepCopyInto(out *SQLJobSpec) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SQLJobSpec.
+func (in *SQLJobSpec) DeepCopy() *SQLJobSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(SQLJobSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *SecuritySpec) DeepCopyInto(out *SecuritySpec) {
+	*out = *in
+	if in.SSOEnabled != nil {
+		in, out := &in.SSOEnabled, &out.SSOEnabled
+		*out = new(bool)
+		**out = **in
+	}
+	if in.OIDCConfig != nil {
+		in, out := &in.OIDCConfig, &out.OIDCConfig
+		*out = new(OIDCConfig)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.RESTTLS != nil {
+		in, out := &in.RESTTLS, &out.RESTTLS
+		*out = new(RESTTLSSpec)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SecuritySpec.
+func (in *SecuritySpec) DeepCopy() *SecuritySpec {
+	if in == nil {
+		return nil
+	}
+	out := new(SecuritySpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ServiceAccountSpec) DeepCopyInto(out *ServiceAccountSpec) {
+	*out = *in
+	if in.Annotations != nil {
+		in, out := &in.Annotations, &out.Annotations
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ServiceAccountSpec.
+func (in *ServiceAccountSpec) DeepCopy() *ServiceAccountSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(ServiceAccountSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ServiceMeshSpec) DeepCopyInto(out *ServiceMeshSpec) {
+	*out = *in
+	if in.TrafficSplitting != nil {
+		in, out := &in.TrafficSplitting, &out.TrafficSplitting
+		*out = new(TrafficSplittingSpec)
+		(*in).DeepCopyInto(*out)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ServiceMeshSpec.
+func (in *ServiceMeshSpec) DeepCopy() *ServiceMeshSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(ServiceMeshSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *StatusTransition) DeepCopyInto(out *StatusTransition) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new StatusTransition.
+func (in *StatusTransition) DeepCopy() *StatusTransition {
+	if in == nil {
+		return nil
+	}
+	out := new(StatusTransition)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *TableSpec) DeepCopyInto(out *TableSpec) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new TableSpec.
+func (in *TableSpec) DeepCopy() *TableSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(TableSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *TaskManagerPoolSpec) DeepCopyInto(out *TaskManagerPoolSpec) {
+	*out = *in
+	if in.Resources != nil {
+		in, out := &in.Resources, &out.Resources
+		*out = new(v1.ResourceRequirements)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.NodeSelector != nil {
+		in, out := &in.NodeSelector, &out.NodeSelector
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new TaskManagerPoolSpec.
+func (in *TaskManagerPoolSpec) DeepCopy() *TaskManagerPoolSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(TaskManagerPoolSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *TaskManagerPorts) DeepCopyInto(out *TaskManagerPorts) {
 	*out = *in
@@ -561,6 +1449,11 @@ func (in *TaskManagerPorts) DeepCopy() *TaskManagerPorts {
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *TaskManagerSpec) DeepCopyInto(out *TaskManagerSpec) {
 	*out = *in
+	if in.SlotsPerTask != nil {
+		in, out := &in.SlotsPerTask, &out.SlotsPerTask
+		*out = new(int32)
+		**out = **in
+	}
 	in.Ports.DeepCopyInto(&out.Ports)
 	in.Resources.DeepCopyInto(&out.Resources)
 	if in.MemoryOffHeapRatio != nil {
@@ -583,6 +1476,20 @@ func (in *TaskManagerSpec) DeepCopyInto(out *TaskManagerSpec) {
 			(*in)[i].DeepCopyInto(&(*out)[i])
 		}
 	}
+	if in.EmptyDirVolumes != nil {
+		in, out := &in.EmptyDirVolumes, &out.EmptyDirVolumes
+		*out = make([]EmptyDirVolumeSpec, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.VolumeClaimTemplates != nil {
+		in, out := &in.VolumeClaimTemplates, &out.VolumeClaimTemplates
+		*out = make([]v1.PersistentVolumeClaim, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
 	if in.NodeSelector != nil {
 		in, out := &in.NodeSelector, &out.NodeSelector
 		*out = make(map[string]string, len(*in))
@@ -590,6 +1497,32 @@ func (in *TaskManagerSpec) DeepCopyInto(out *TaskManagerSpec) {
 			(*out)[key] = val
 		}
 	}
+	if in.Affinity != nil {
+		in, out := &in.Affinity, &out.Affinity
+		*out = new(v1.Affinity)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Tolerations != nil {
+		in, out := &in.Tolerations, &out.Tolerations
+		*out = make([]v1.Toleration, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.Env != nil {
+		in, out := &in.Env, &out.Env
+		*out = make([]v1.EnvVar, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.EnvFrom != nil {
+		in, out := &in.EnvFrom, &out.EnvFrom
+		*out = make([]v1.EnvFromSource, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
 	if in.Sidecars != nil {
 		in, out := &in.Sidecars, &out.Sidecars
 		*out = make([]v1.Container, len(*in))
@@ -597,6 +1530,43 @@ func (in *TaskManagerSpec) DeepCopyInto(out *TaskManagerSpec) {
 			(*in)[i].DeepCopyInto(&(*out)[i])
 		}
 	}
+	if in.TerminationGracePeriodSeconds != nil {
+		in, out := &in.TerminationGracePeriodSeconds, &out.TerminationGracePeriodSeconds
+		*out = new(int64)
+		**out = **in
+	}
+	if in.DrainTimeoutSeconds != nil {
+		in, out := &in.DrainTimeoutSeconds, &out.DrainTimeoutSeconds
+		*out = new(int32)
+		**out = **in
+	}
+	if in.Pools != nil {
+		in, out := &in.Pools, &out.Pools
+		*out = make([]TaskManagerPoolSpec, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.MinReplicas != nil {
+		in, out := &in.MinReplicas, &out.MinReplicas
+		*out = new(int32)
+		**out = **in
+	}
+	if in.MaxReplicas != nil {
+		in, out := &in.MaxReplicas, &out.MaxReplicas
+		*out = new(int32)
+		**out = **in
+	}
+	if in.AutoscaleCooldownSeconds != nil {
+		in, out := &in.AutoscaleCooldownSeconds, &out.AutoscaleCooldownSeconds
+		*out = new(int32)
+		**out = **in
+	}
+	if in.Probes != nil {
+		in, out := &in.Probes, &out.Probes
+		*out = new(ProbesSpec)
+		(*in).DeepCopyInto(*out)
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new TaskManagerSpec.
@@ -609,6 +1579,41 @@ func (in *TaskManagerSpec) DeepCopy() *TaskManagerSpec {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *TrafficSplittingSpec) DeepCopyInto(out *TrafficSplittingSpec) {
+	*out = *in
+	in.VersionA.DeepCopyInto(&out.VersionA)
+	in.VersionB.DeepCopyInto(&out.VersionB)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new TrafficSplittingSpec.
+func (in *TrafficSplittingSpec) DeepCopy() *TrafficSplittingSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(TrafficSplittingSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *TrafficSplittingStatus) DeepCopyInto(out *TrafficSplittingStatus) {
+	*out = *in
+	in.VirtualService.DeepCopyInto(&out.VirtualService)
+	in.VersionA.DeepCopyInto(&out.VersionA)
+	in.VersionB.DeepCopyInto(&out.VersionB)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new TrafficSplittingStatus.
+func (in *TrafficSplittingStatus) DeepCopy() *TrafficSplittingStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(TrafficSplittingStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *Validator) DeepCopyInto(out *Validator) {
 	*out = *in
@@ -623,3 +1628,18 @@ func (in *Validator) DeepCopy() *Validator {
 	in.DeepCopyInto(out)
 	return out
 }
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *VertexBackpressure) DeepCopyInto(out *VertexBackpressure) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new VertexBackpressure.
+func (in *VertexBackpressure) DeepCopy() *VertexBackpressure {
+	if in == nil {
+		return nil
+	}
+	out := new(VertexBackpressure)
+	in.DeepCopyInto(out)
+	return out
+}
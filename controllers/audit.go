@@ -0,0 +1,286 @@
+/*
+Copyright 2019 Google LLC.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+// Audit log of the changes of the child resources of the clusters made by
+// the operator. The Kubernetes client of the reconciles is wrapped, so that
+// each create, update, patch or delete which succeeded is sent to the audit
+// logger as an event. The writes of the FlinkCluster itself, e.g., its status
+// and finalizers, are not audited.
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/go-logr/logr"
+	v1beta1 "github.com/googlecloudplatform/flink-operator/api/v1beta1"
+	"github.com/prometheus/client_golang/prometheus"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+// AuditEvent is a change of a child resource of a cluster made by the
+// operator.
+type AuditEvent struct {
+	// The time of the change.
+	Timestamp time.Time `json:"timestamp"`
+
+	// The action, one of "create", "update", "patch", "delete" and
+	// "deleteAllOf".
+	Action string `json:"action"`
+
+	// The name and namespace of the cluster of the resource.
+	ClusterName string `json:"clusterName"`
+	Namespace   string `json:"namespace"`
+
+	// The service account the operator runs as, e.g.,
+	// "system:serviceaccount:flink-operator-system:flink-operator", empty if
+	// it is unknown.
+	ActorServiceAccount string `json:"actorServiceAccount,omitempty"`
+
+	// The kind and name of the changed resource, e.g.,
+	// "Deployment mycluster-jobmanager".
+	ChangeDetail string `json:"changeDetail"`
+}
+
+// AuditLogger records the audit events, e.g., in an external audit system.
+type AuditLogger interface {
+	Log(ctx context.Context, event AuditEvent) error
+}
+
+// NoopAuditLogger discards the audit events, it is the default.
+type NoopAuditLogger struct{}
+
+// Log discards the event.
+func (logger NoopAuditLogger) Log(ctx context.Context, event AuditEvent) error {
+	return nil
+}
+
+// The default size of the queue of the webhook audit logger.
+const defaultAuditQueueSize = 1000
+
+// The default number of retries of an audit event, and the interval before
+// the first retry, which doubles with each retry.
+const (
+	defaultAuditMaxRetries    = 3
+	defaultAuditRetryInterval = 1 * time.Second
+)
+
+var auditEventsDropped = prometheus.NewCounter(
+	prometheus.CounterOpts{
+		Name: "flink_operator_audit_events_dropped_total",
+		Help: "Number of audit events dropped, because the queue was full " +
+			"or the webhook kept failing.",
+	},
+)
+
+func init() {
+	metrics.Registry.MustRegister(auditEventsDropped)
+}
+
+// WebhookAuditLogger POSTs each audit event as JSON to the URL. The events
+// are queued and sent in the background, so that a slow or unavailable
+// webhook doesn't block the reconciles. A failed request is retried, the
+// events which don't fit in the queue or which failed all the retries are
+// dropped and counted in the flink_operator_audit_events_dropped_total
+// metric.
+type WebhookAuditLogger struct {
+	URL string
+
+	// The timeout of each request, default: 10s.
+	Timeout time.Duration
+
+	// The number of events which can wait to be sent, default: 1000.
+	QueueSize int
+
+	// The number of retries of a failed request, default: 3.
+	MaxRetries int
+
+	// The interval before the first retry, doubled with each retry,
+	// default: 1s.
+	RetryInterval time.Duration
+
+	// Logs the dropped events, optional.
+	Logger logr.Logger
+
+	start sync.Once
+	queue chan AuditEvent
+}
+
+// Log queues the event to be sent to the webhook, it fails without blocking
+// if the queue is full.
+func (logger *WebhookAuditLogger) Log(
+	ctx context.Context, event AuditEvent) error {
+	logger.start.Do(logger.startSending)
+	select {
+	case logger.queue <- event:
+		return nil
+	default:
+		auditEventsDropped.Inc()
+		return fmt.Errorf("audit event queue is full, the event is dropped")
+	}
+}
+
+func (logger *WebhookAuditLogger) startSending() {
+	var queueSize = logger.QueueSize
+	if queueSize <= 0 {
+		queueSize = defaultAuditQueueSize
+	}
+	logger.queue = make(chan AuditEvent, queueSize)
+	go func() {
+		for event := range logger.queue {
+			var err = logger.send(event)
+			if err != nil {
+				auditEventsDropped.Inc()
+				if logger.Logger != nil {
+					logger.Logger.Error(
+						err,
+						"Dropped audit event",
+						"action", event.Action,
+						"resource", event.ChangeDetail)
+				}
+			}
+		}
+	}()
+}
+
+// Sends the event, retrying the failed requests. The URL is stripped from
+// the errors, because it might contain a token.
+func (logger *WebhookAuditLogger) send(event AuditEvent) error {
+	var body, err = json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	var sender = &httpWebhookSender{
+		timeout:         logger.Timeout,
+		allowAllTargets: true,
+	}
+	var maxRetries = logger.MaxRetries
+	if maxRetries <= 0 {
+		maxRetries = defaultAuditMaxRetries
+	}
+	var interval = logger.RetryInterval
+	if interval <= 0 {
+		interval = defaultAuditRetryInterval
+	}
+	for retry := 0; ; retry++ {
+		err = sender.Post(logger.URL, body)
+		if err == nil || retry >= maxRetries {
+			return err
+		}
+		time.Sleep(interval)
+		interval *= 2
+	}
+}
+
+// Gets the identity of the service account the operator runs as, empty if
+// the service account is unknown.
+func getAuditActor(namespace string, serviceAccount string) string {
+	if len(namespace) == 0 || len(serviceAccount) == 0 {
+		return ""
+	}
+	return fmt.Sprintf("system:serviceaccount:%v:%v", namespace, serviceAccount)
+}
+
+// A Kubernetes client which sends an audit event after each successful
+// write of a child resource of the cluster. A failed audit doesn't fail the
+// write, which has been applied already, it is logged instead.
+type auditingClient struct {
+	client.Client
+	logger    AuditLogger
+	log       logr.Logger
+	cluster   string
+	namespace string
+	actor     string
+}
+
+func (c *auditingClient) Create(
+	ctx context.Context, obj runtime.Object, opts ...client.CreateOption) error {
+	var err = c.Client.Create(ctx, obj, opts...)
+	if err == nil {
+		c.audit(ctx, "create", obj)
+	}
+	return err
+}
+
+func (c *auditingClient) Update(
+	ctx context.Context, obj runtime.Object, opts ...client.UpdateOption) error {
+	var err = c.Client.Update(ctx, obj, opts...)
+	if err == nil {
+		c.audit(ctx, "update", obj)
+	}
+	return err
+}
+
+func (c *auditingClient) Patch(
+	ctx context.Context,
+	obj runtime.Object,
+	patch client.Patch,
+	opts ...client.PatchOption) error {
+	var err = c.Client.Patch(ctx, obj, patch, opts...)
+	if err == nil {
+		c.audit(ctx, "patch", obj)
+	}
+	return err
+}
+
+func (c *auditingClient) Delete(
+	ctx context.Context, obj runtime.Object, opts ...client.DeleteOption) error {
+	var err = c.Client.Delete(ctx, obj, opts...)
+	if err == nil {
+		c.audit(ctx, "delete", obj)
+	}
+	return err
+}
+
+func (c *auditingClient) DeleteAllOf(
+	ctx context.Context,
+	obj runtime.Object,
+	opts ...client.DeleteAllOfOption) error {
+	var err = c.Client.DeleteAllOf(ctx, obj, opts...)
+	if err == nil {
+		c.audit(ctx, "deleteAllOf", obj)
+	}
+	return err
+}
+
+func (c *auditingClient) audit(
+	ctx context.Context, action string, obj runtime.Object) {
+	if _, ok := obj.(*v1beta1.FlinkCluster); ok {
+		return
+	}
+	var event = AuditEvent{
+		Timestamp:           time.Now().UTC(),
+		Action:              action,
+		ClusterName:         c.cluster,
+		Namespace:           c.namespace,
+		ActorServiceAccount: c.actor,
+		ChangeDetail:        getObjectDescription(obj),
+	}
+	var err = c.logger.Log(ctx, event)
+	if err != nil {
+		c.log.Error(
+			err,
+			"Failed to send audit event",
+			"action", action,
+			"resource", event.ChangeDetail)
+	}
+}
@@ -0,0 +1,205 @@
+/*
+Copyright 2019 Google LLC.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	v1beta1 "github.com/googlecloudplatform/flink-operator/api/v1beta1"
+	"gotest.tools/assert"
+	appsv1 "k8s.io/api/apps/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+// Records the audit events, and fails if err is set.
+type fakeAuditLogger struct {
+	events []AuditEvent
+	err    error
+}
+
+func (logger *fakeAuditLogger) Log(ctx context.Context, event AuditEvent) error {
+	logger.events = append(logger.events, event)
+	return logger.err
+}
+
+func TestAuditingClient(t *testing.T) {
+	var testScheme = runtime.NewScheme()
+	assert.NilError(t, scheme.AddToScheme(testScheme))
+	assert.NilError(t, v1beta1.AddToScheme(testScheme))
+	var cluster = getTestSessionCluster()
+	var logger = &fakeAuditLogger{}
+	var k8sClient = &auditingClient{
+		Client:    fake.NewFakeClientWithScheme(testScheme, cluster),
+		logger:    logger,
+		log:       log.Log,
+		cluster:   "mycluster",
+		namespace: "default",
+		actor:     getAuditActor("flink-operator-system", "flink-operator"),
+	}
+	var deployment = &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: "default",
+			Name:      "mycluster-jobmanager",
+		},
+	}
+	var ctx = context.Background()
+
+	assert.NilError(t, k8sClient.Create(ctx, deployment))
+	var base = deployment.DeepCopy()
+	deployment.Labels = map[string]string{"team": "data"}
+	assert.NilError(t, k8sClient.Patch(ctx, deployment, client.MergeFrom(base)))
+	assert.NilError(t, k8sClient.Delete(ctx, deployment))
+	assert.Equal(t, len(logger.events), 3)
+	var event = logger.events[0]
+	assert.Assert(t, !event.Timestamp.IsZero())
+	event.Timestamp = time.Time{}
+	assert.DeepEqual(
+		t,
+		event,
+		AuditEvent{
+			Action:              "create",
+			ClusterName:         "mycluster",
+			Namespace:           "default",
+			ActorServiceAccount: "system:serviceaccount:flink-operator-system:flink-operator",
+			ChangeDetail:        "Deployment mycluster-jobmanager",
+		})
+	assert.Equal(t, logger.events[1].Action, "patch")
+	assert.Equal(t, logger.events[2].Action, "delete")
+
+	// A failed write is not audited.
+	logger.events = nil
+	assert.Assert(t, k8sClient.Delete(ctx, deployment) != nil)
+	assert.Equal(t, len(logger.events), 0)
+
+	// Neither are the writes of the cluster itself.
+	cluster.Annotations = map[string]string{"team": "data"}
+	assert.NilError(t, k8sClient.Update(ctx, cluster))
+	assert.Equal(t, len(logger.events), 0)
+
+	// A failed audit doesn't fail the write.
+	logger.err = fmt.Errorf("audit sink unavailable")
+	assert.NilError(t, k8sClient.Create(ctx, deployment.DeepCopy()))
+	assert.Equal(t, len(logger.events), 1)
+}
+
+// Gets the number of the dropped audit events.
+func getAuditEventsDropped(t *testing.T) float64 {
+	var families, err = metrics.Registry.Gather()
+	assert.NilError(t, err)
+	for _, family := range families {
+		if family.GetName() == "flink_operator_audit_events_dropped_total" {
+			return family.GetMetric()[0].GetCounter().GetValue()
+		}
+	}
+	return 0
+}
+
+func TestWebhookAuditLogger(t *testing.T) {
+	var received = make(chan AuditEvent, 1)
+	var failures = 1
+	var server = httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			var body, _ = ioutil.ReadAll(r.Body)
+			assert.Equal(t, r.Method, "POST")
+			assert.Equal(t, r.Header.Get("Content-Type"), "application/json")
+			// The first request fails, and is retried.
+			if failures > 0 {
+				failures--
+				w.WriteHeader(http.StatusServiceUnavailable)
+				return
+			}
+			var event AuditEvent
+			assert.NilError(t, json.Unmarshal(body, &event))
+			received <- event
+		}))
+	defer server.Close()
+	var logger AuditLogger = &WebhookAuditLogger{
+		URL:           server.URL,
+		RetryInterval: time.Millisecond,
+	}
+	var event = AuditEvent{
+		Timestamp:    time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC),
+		Action:       "delete",
+		ClusterName:  "mycluster",
+		Namespace:    "default",
+		ChangeDetail: "Service mycluster-jobmanager",
+	}
+
+	assert.NilError(t, logger.Log(context.Background(), event))
+	select {
+	case sent := <-received:
+		assert.DeepEqual(t, sent, event)
+	case <-time.After(10 * time.Second):
+		t.Fatal("the audit event was not sent")
+	}
+
+	// Without the service account.
+	assert.Equal(t, getAuditActor("", ""), "")
+}
+
+func TestWebhookAuditLoggerDropsEvents(t *testing.T) {
+	var requests = make(chan bool, 10)
+	var release = make(chan bool)
+	var server = httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			requests <- true
+			<-release
+			w.WriteHeader(http.StatusInternalServerError)
+		}))
+	defer server.Close()
+	var logger = &WebhookAuditLogger{
+		URL:           server.URL,
+		QueueSize:     1,
+		MaxRetries:    1,
+		RetryInterval: time.Millisecond,
+	}
+	var event = AuditEvent{Action: "create", ClusterName: "mycluster"}
+	var dropped = getAuditEventsDropped(t)
+
+	// The first event is being sent, the second one waits in the queue, the
+	// third one doesn't fit in the queue.
+	assert.NilError(t, logger.Log(context.Background(), event))
+	<-requests
+	assert.NilError(t, logger.Log(context.Background(), event))
+	assert.ErrorContains(
+		t, logger.Log(context.Background(), event), "queue is full")
+	assert.Equal(t, getAuditEventsDropped(t), dropped+1)
+
+	// The first event is dropped after the retry fails.
+	release <- true
+	<-requests
+	release <- true
+	<-requests
+	for i := 0; i < 100 && getAuditEventsDropped(t) < dropped+2; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	assert.Equal(t, getAuditEventsDropped(t), dropped+2)
+	close(release)
+}
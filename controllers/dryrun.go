@@ -0,0 +1,254 @@
+/*
+Copyright 2019 Google LLC.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+// Dry-run mode, in which the reconciles run as usual but their changes are
+// only validated by the API server with the dry-run option instead of being
+// persisted. The Flink job actions, e.g., submitting a job or taking a
+// savepoint, are skipped. Each planned change is logged, and the changes of a
+// reconcile are summarized in an event on the cluster.
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/go-logr/logr"
+	v1beta1 "github.com/googlecloudplatform/flink-operator/api/v1beta1"
+	"github.com/googlecloudplatform/flink-operator/controllers/flinkclient"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const dryRunLogPrefix = "[DRY-RUN] "
+
+// Collects the changes planned by a reconcile in dry-run mode.
+type dryRunPlan struct {
+	log     logr.Logger
+	changes []string
+}
+
+func (plan *dryRunPlan) add(change string) {
+	plan.log.Info(dryRunLogPrefix + change)
+	plan.changes = append(plan.changes, change)
+}
+
+// Emits an event on the cluster which lists the planned changes, if any.
+func (plan *dryRunPlan) report(
+	recorder record.EventRecorder, cluster *v1beta1.FlinkCluster) {
+	if cluster == nil || len(plan.changes) == 0 {
+		return
+	}
+	recorder.Event(
+		cluster,
+		"Normal",
+		"DryRun",
+		fmt.Sprintf(
+			"Planned changes: %v", strings.Join(plan.changes, "; ")))
+}
+
+// Describes an object by its kind and name, e.g., "Deployment mycluster-jobmanager".
+func getObjectDescription(obj runtime.Object) string {
+	var kind = obj.GetObjectKind().GroupVersionKind().Kind
+	if len(kind) == 0 {
+		var objType = reflect.TypeOf(obj)
+		if objType.Kind() == reflect.Ptr {
+			objType = objType.Elem()
+		}
+		kind = objType.Name()
+	}
+	var accessor, err = meta.Accessor(obj)
+	if err != nil {
+		return kind
+	}
+	return kind + " " + accessor.GetName()
+}
+
+// A Kubernetes client which sends the writes with the dry-run option.
+type dryRunClient struct {
+	client.Client
+	plan *dryRunPlan
+}
+
+func (c *dryRunClient) Create(
+	ctx context.Context, obj runtime.Object, opts ...client.CreateOption) error {
+	c.plan.add("create " + getObjectDescription(obj))
+	return c.Client.Create(ctx, obj, append(opts, client.DryRunAll)...)
+}
+
+func (c *dryRunClient) Update(
+	ctx context.Context, obj runtime.Object, opts ...client.UpdateOption) error {
+	c.plan.add("update " + getObjectDescription(obj))
+	return c.Client.Update(ctx, obj, append(opts, client.DryRunAll)...)
+}
+
+func (c *dryRunClient) Patch(
+	ctx context.Context,
+	obj runtime.Object,
+	patch client.Patch,
+	opts ...client.PatchOption) error {
+	c.plan.add("patch " + getObjectDescription(obj))
+	return c.Client.Patch(ctx, obj, patch, append(opts, client.DryRunAll)...)
+}
+
+func (c *dryRunClient) Delete(
+	ctx context.Context, obj runtime.Object, opts ...client.DeleteOption) error {
+	c.plan.add("delete " + getObjectDescription(obj))
+	return c.Client.Delete(ctx, obj, append(opts, client.DryRunAll)...)
+}
+
+// DeleteAllOf doesn't support the dry-run option, so it is not sent at all.
+func (c *dryRunClient) DeleteAllOf(
+	ctx context.Context,
+	obj runtime.Object,
+	opts ...client.DeleteAllOfOption) error {
+	c.plan.add("delete all of " + getObjectDescription(obj))
+	return nil
+}
+
+func (c *dryRunClient) Status() client.StatusWriter {
+	return &dryRunStatusWriter{StatusWriter: c.Client.Status(), plan: c.plan}
+}
+
+type dryRunStatusWriter struct {
+	client.StatusWriter
+	plan *dryRunPlan
+}
+
+func (w *dryRunStatusWriter) Update(
+	ctx context.Context, obj runtime.Object, opts ...client.UpdateOption) error {
+	w.plan.add("update status of " + getObjectDescription(obj))
+	return w.StatusWriter.Update(ctx, obj, append(opts, client.DryRunAll)...)
+}
+
+func (w *dryRunStatusWriter) Patch(
+	ctx context.Context,
+	obj runtime.Object,
+	patch client.Patch,
+	opts ...client.PatchOption) error {
+	w.plan.add("patch status of " + getObjectDescription(obj))
+	return w.StatusWriter.Patch(
+		ctx, obj, patch, append(opts, client.DryRunAll)...)
+}
+
+// A Flink client which skips the job actions. The reads are sent as usual.
+type dryRunFlinkClient struct {
+	flinkclient.FlinkClient
+	plan *dryRunPlan
+}
+
+func (c *dryRunFlinkClient) SubmitStreamGraph(
+	apiBaseURL string, jarID string, streamGraphJSON string) (
+	flinkclient.JarRunResponse, error) {
+	c.plan.add("submit stream graph of JAR " + jarID)
+	return flinkclient.JarRunResponse{}, nil
+}
+
+func (c *dryRunFlinkClient) RunJar(
+	apiBaseURL string, jarID string, request flinkclient.JarRunRequest) (
+	flinkclient.JarRunResponse, error) {
+	c.plan.add("run JAR " + jarID)
+	return flinkclient.JarRunResponse{}, nil
+}
+
+func (c *dryRunFlinkClient) StopJob(apiBaseURL string, jobID string) error {
+	c.plan.add("stop job " + jobID)
+	return nil
+}
+
+func (c *dryRunFlinkClient) TriggerSavepoint(
+	apiBaseURL string, jobID string, dir string) (
+	flinkclient.SavepointTriggerID, error) {
+	c.plan.add("trigger savepoint of job " + jobID)
+	return flinkclient.SavepointTriggerID{}, nil
+}
+
+func (c *dryRunFlinkClient) StopJobWithSavepoint(
+	apiBaseURL string, jobID string, dir string) (
+	flinkclient.SavepointTriggerID, error) {
+	c.plan.add("stop job " + jobID + " with savepoint")
+	return flinkclient.SavepointTriggerID{}, nil
+}
+
+// The savepoint is reported as not completed.
+func (c *dryRunFlinkClient) TakeSavepoint(
+	apiBaseURL string, jobID string, dir string) (
+	flinkclient.SavepointStatus, error) {
+	c.plan.add("take savepoint of job " + jobID)
+	return flinkclient.SavepointStatus{JobID: jobID}, nil
+}
+
+func (c *dryRunFlinkClient) WithTLSConfig(
+	tlsConfig *tls.Config) flinkclient.FlinkClient {
+	return &dryRunFlinkClient{
+		FlinkClient: c.FlinkClient.WithTLSConfig(tlsConfig),
+		plan:        c.plan,
+	}
+}
+
+// A webhook sender which skips the notifications.
+type dryRunWebhookSender struct {
+	plan *dryRunPlan
+}
+
+func (s *dryRunWebhookSender) Post(url string, body []byte) error {
+	s.plan.add("send webhook notification")
+	return nil
+}
+
+// An event recorder which only logs the events, the planned changes are
+// reported by the summary event instead.
+type dryRunEventRecorder struct {
+	log logr.Logger
+}
+
+func (r *dryRunEventRecorder) Event(
+	object runtime.Object, eventtype, reason, message string) {
+	r.log.Info(
+		dryRunLogPrefix+"event",
+		"type", eventtype,
+		"reason", reason,
+		"message", message)
+}
+
+func (r *dryRunEventRecorder) Eventf(
+	object runtime.Object,
+	eventtype, reason, messageFmt string,
+	args ...interface{}) {
+	r.Event(object, eventtype, reason, fmt.Sprintf(messageFmt, args...))
+}
+
+func (r *dryRunEventRecorder) PastEventf(
+	object runtime.Object,
+	timestamp metav1.Time,
+	eventtype, reason, messageFmt string,
+	args ...interface{}) {
+	r.Event(object, eventtype, reason, fmt.Sprintf(messageFmt, args...))
+}
+
+func (r *dryRunEventRecorder) AnnotatedEventf(
+	object runtime.Object,
+	annotations map[string]string,
+	eventtype, reason, messageFmt string,
+	args ...interface{}) {
+	r.Event(object, eventtype, reason, fmt.Sprintf(messageFmt, args...))
+}
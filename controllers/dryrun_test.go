@@ -0,0 +1,141 @@
+/*
+Copyright 2019 Google LLC.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"testing"
+
+	"github.com/googlecloudplatform/flink-operator/controllers/flinkclient"
+	"gotest.tools/assert"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// Records the dry-run option of each write instead of sending it.
+type dryRunSpyClient struct {
+	client.Client
+	dryRuns [][]string
+}
+
+func (c *dryRunSpyClient) Create(
+	ctx context.Context, obj runtime.Object, opts ...client.CreateOption) error {
+	c.dryRuns = append(
+		c.dryRuns, (&client.CreateOptions{}).ApplyOptions(opts).DryRun)
+	return nil
+}
+
+func (c *dryRunSpyClient) Update(
+	ctx context.Context, obj runtime.Object, opts ...client.UpdateOption) error {
+	c.dryRuns = append(
+		c.dryRuns, (&client.UpdateOptions{}).ApplyOptions(opts).DryRun)
+	return nil
+}
+
+func (c *dryRunSpyClient) Delete(
+	ctx context.Context, obj runtime.Object, opts ...client.DeleteOption) error {
+	c.dryRuns = append(
+		c.dryRuns, (&client.DeleteOptions{}).ApplyOptions(opts).DryRun)
+	return nil
+}
+
+// Fails the test on any job action.
+type failingFlinkClient struct {
+	flinkclient.FlinkClient
+	t *testing.T
+}
+
+func (c *failingFlinkClient) StopJob(apiBaseURL string, jobID string) error {
+	c.t.Fatalf("StopJob is not expected to be called")
+	return nil
+}
+
+func TestDryRunClient(t *testing.T) {
+	var spy = &dryRunSpyClient{Client: fake.NewFakeClientWithScheme(scheme.Scheme)}
+	var plan = &dryRunPlan{log: log.Log}
+	var k8sClient = &dryRunClient{Client: spy, plan: plan}
+	var deployment = &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: "default",
+			Name:      "mycluster-jobmanager",
+		},
+	}
+	var service = &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: "default",
+			Name:      "mycluster-jobmanager",
+		},
+	}
+
+	assert.NilError(t, k8sClient.Create(context.Background(), deployment))
+	assert.NilError(t, k8sClient.Update(context.Background(), deployment))
+	assert.NilError(t, k8sClient.Delete(context.Background(), service))
+	assert.NilError(t, k8sClient.DeleteAllOf(context.Background(), service))
+
+	assert.DeepEqual(
+		t,
+		spy.dryRuns,
+		[][]string{
+			{metav1.DryRunAll}, {metav1.DryRunAll}, {metav1.DryRunAll}})
+	assert.DeepEqual(
+		t,
+		plan.changes,
+		[]string{
+			"create Deployment mycluster-jobmanager",
+			"update Deployment mycluster-jobmanager",
+			"delete Service mycluster-jobmanager",
+			"delete all of Service mycluster-jobmanager",
+		})
+}
+
+func TestDryRunFlinkClient(t *testing.T) {
+	var plan = &dryRunPlan{log: log.Log}
+	var flinkClient flinkclient.FlinkClient = &dryRunFlinkClient{
+		FlinkClient: &failingFlinkClient{t: t},
+		plan:        plan,
+	}
+
+	assert.NilError(t, flinkClient.StopJob("http://localhost:8081", "1234"))
+	assert.DeepEqual(t, plan.changes, []string{"stop job 1234"})
+}
+
+func TestDryRunPlanReport(t *testing.T) {
+	var cluster = getTestSessionCluster()
+	var recorder = record.NewFakeRecorder(10)
+
+	// No event without changes.
+	var plan = &dryRunPlan{log: log.Log}
+	plan.report(recorder, cluster)
+	assert.Equal(t, len(recorder.Events), 0)
+
+	plan.add("create Deployment mycluster-jobmanager")
+	plan.add("create Service mycluster-jobmanager")
+	plan.report(recorder, cluster)
+	assert.Equal(
+		t,
+		<-recorder.Events,
+		"Normal DryRun Planned changes: "+
+			"create Deployment mycluster-jobmanager; "+
+			"create Service mycluster-jobmanager")
+}
@@ -0,0 +1,150 @@
+/*
+Copyright 2019 Google LLC.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/go-logr/logr"
+	v1beta1 "github.com/googlecloudplatform/flink-operator/api/v1beta1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/util/retry"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// FinalizerManager adds and removes the finalizers of clusters, so that
+// several finalizers, e.g., of the cleanup of the child resources, can be
+// managed independently without overwriting each other.
+//
+// The finalizers are set with JSON patches instead of updating the cluster,
+// because the observed spec of a templated cluster is merged with its
+// template. A merge patch isn't used, because it removes the field with a
+// null once the last finalizer is removed, the JSON patch replaces the list
+// with an empty one instead. The patches also set the resource version the
+// cluster was read with, so that a patch of a stale cluster fails with a
+// conflict, and it is retried on the latest cluster read from the API
+// server.
+type FinalizerManager struct {
+	k8sClient client.Client
+	apiReader client.Reader
+	log       logr.Logger
+}
+
+// EnsureFinalizerAdded adds the finalizer to the cluster if it is absent.
+func (manager *FinalizerManager) EnsureFinalizerAdded(
+	ctx context.Context, cluster *v1beta1.FlinkCluster, name string) error {
+	if hasFinalizer(cluster, name) {
+		return nil
+	}
+	var err = manager.patchFinalizers(ctx, cluster, name, true)
+	if err != nil {
+		manager.log.Error(err, "Failed to add finalizer", "finalizer", name)
+		return err
+	}
+	manager.log.Info("Finalizer added", "finalizer", name)
+	return nil
+}
+
+// EnsureFinalizerRemoved removes the finalizer from the cluster if it is
+// present.
+func (manager *FinalizerManager) EnsureFinalizerRemoved(
+	ctx context.Context, cluster *v1beta1.FlinkCluster, name string) error {
+	if !hasFinalizer(cluster, name) {
+		return nil
+	}
+	var err = manager.patchFinalizers(ctx, cluster, name, false)
+	if err != nil {
+		manager.log.Error(err, "Failed to remove finalizer", "finalizer", name)
+		return err
+	}
+	manager.log.Info("Finalizer removed", "finalizer", name)
+	return nil
+}
+
+// Adds or removes the finalizer with a merge patch, retrying on conflicts.
+// Only the finalizers and the resource version of the cluster are updated.
+func (manager *FinalizerManager) patchFinalizers(
+	ctx context.Context,
+	cluster *v1beta1.FlinkCluster,
+	name string,
+	add bool) error {
+	var current = cluster
+	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		var patched = current.DeepCopy()
+		if add && !hasFinalizer(patched, name) {
+			patched.ObjectMeta.Finalizers = append(
+				patched.ObjectMeta.Finalizers, name)
+		} else if !add {
+			removeFinalizer(patched, name)
+		}
+
+		var patch, err = getFinalizersPatch(
+			patched.ObjectMeta.Finalizers, current.ObjectMeta.ResourceVersion)
+		if err != nil {
+			return err
+		}
+		err = manager.k8sClient.Patch(ctx, patched, patch)
+		if errors.IsConflict(err) {
+			var latest = &v1beta1.FlinkCluster{}
+			var getErr = manager.apiReader.Get(
+				ctx,
+				types.NamespacedName{
+					Namespace: cluster.ObjectMeta.Namespace,
+					Name:      cluster.ObjectMeta.Name,
+				},
+				latest)
+			if getErr != nil {
+				return getErr
+			}
+			current = latest
+			return err
+		}
+		if err != nil {
+			return err
+		}
+		cluster.ObjectMeta.Finalizers = patched.ObjectMeta.Finalizers
+		cluster.ObjectMeta.ResourceVersion = patched.ObjectMeta.ResourceVersion
+		return nil
+	})
+}
+
+// An operation of a JSON patch.
+type jsonPatchOperation struct {
+	Op    string      `json:"op"`
+	Path  string      `json:"path"`
+	Value interface{} `json:"value"`
+}
+
+// Gets the JSON patch which replaces the finalizers of the cluster, with an
+// empty list rather than removing the field when the last one is removed.
+// It carries the resource version, so that it fails on conflict.
+func getFinalizersPatch(
+	finalizers []string, resourceVersion string) (client.Patch, error) {
+	if finalizers == nil {
+		finalizers = []string{}
+	}
+	var data, err = json.Marshal([]jsonPatchOperation{
+		{Op: "add", Path: "/metadata/finalizers", Value: finalizers},
+		{Op: "add", Path: "/metadata/resourceVersion", Value: resourceVersion},
+	})
+	if err != nil {
+		return nil, err
+	}
+	return client.ConstantPatch(types.JSONPatchType, data), nil
+}
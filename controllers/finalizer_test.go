@@ -0,0 +1,182 @@
+/*
+Copyright 2019 Google LLC.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"testing"
+
+	v1beta1 "github.com/googlecloudplatform/flink-operator/api/v1beta1"
+	"gotest.tools/assert"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// Adds a finalizer of another controller to the cluster before the first
+// patch, which then fails with a conflict like a stale resource version.
+type conflictingClient struct {
+	client.Client
+	key       types.NamespacedName
+	conflicts int
+}
+
+func (c *conflictingClient) Patch(
+	ctx context.Context,
+	obj runtime.Object,
+	patch client.Patch,
+	opts ...client.PatchOption) error {
+	if c.conflicts > 0 {
+		c.conflicts--
+		var cluster = &v1beta1.FlinkCluster{}
+		var err = c.Client.Get(ctx, c.key, cluster)
+		if err != nil {
+			return err
+		}
+		cluster.Finalizers = append(cluster.Finalizers, "example.com/other")
+		err = c.Client.Update(ctx, cluster)
+		if err != nil {
+			return err
+		}
+		return errors.NewConflict(
+			schema.GroupResource{Resource: "flinkclusters"}, c.key.Name, nil)
+	}
+	return c.Client.Patch(ctx, obj, patch, opts...)
+}
+
+func newTestFinalizerManager(
+	objects ...runtime.Object) (*FinalizerManager, client.Client) {
+	var testScheme = runtime.NewScheme()
+	_ = v1beta1.AddToScheme(testScheme)
+	var k8sClient = fake.NewFakeClientWithScheme(testScheme, objects...)
+	var manager = &FinalizerManager{
+		k8sClient: k8sClient,
+		apiReader: k8sClient,
+		log:       log.Log,
+	}
+	return manager, k8sClient
+}
+
+func getTestStoredCluster(
+	t *testing.T, k8sClient client.Client) *v1beta1.FlinkCluster {
+	var cluster = &v1beta1.FlinkCluster{}
+	var err = k8sClient.Get(
+		context.Background(),
+		types.NamespacedName{
+			Namespace: "default",
+			Name:      "flinksessioncluster-sample",
+		},
+		cluster)
+	assert.NilError(t, err)
+	return cluster
+}
+
+func TestEnsureFinalizerAdded(t *testing.T) {
+	var cluster = getTestSessionCluster()
+	var manager, k8sClient = newTestFinalizerManager(cluster)
+
+	assert.NilError(
+		t,
+		manager.EnsureFinalizerAdded(
+			context.Background(), cluster, clusterFinalizer))
+	assert.NilError(
+		t,
+		manager.EnsureFinalizerAdded(
+			context.Background(), cluster, clusterFinalizer))
+	assert.DeepEqual(t, cluster.Finalizers, []string{clusterFinalizer})
+	assert.DeepEqual(
+		t,
+		getTestStoredCluster(t, k8sClient).Finalizers,
+		[]string{clusterFinalizer})
+}
+
+func TestEnsureFinalizerRemoved(t *testing.T) {
+	var cluster = getTestSessionCluster()
+	cluster.Finalizers = []string{"example.com/other", clusterFinalizer}
+	var manager, k8sClient = newTestFinalizerManager(cluster)
+
+	assert.NilError(
+		t,
+		manager.EnsureFinalizerRemoved(
+			context.Background(), cluster, clusterFinalizer))
+	assert.NilError(
+		t,
+		manager.EnsureFinalizerRemoved(
+			context.Background(), cluster, clusterFinalizer))
+	assert.DeepEqual(t, cluster.Finalizers, []string{"example.com/other"})
+	assert.DeepEqual(
+		t,
+		getTestStoredCluster(t, k8sClient).Finalizers,
+		[]string{"example.com/other"})
+
+	// The last finalizer is removed.
+	assert.NilError(
+		t,
+		manager.EnsureFinalizerRemoved(
+			context.Background(), cluster, "example.com/other"))
+	assert.Equal(t, len(getTestStoredCluster(t, k8sClient).Finalizers), 0)
+}
+
+// A conflicting patch is retried on the latest cluster, keeping the finalizer
+// which was added concurrently.
+func TestEnsureFinalizerAddedConflict(t *testing.T) {
+	var cluster = getTestSessionCluster()
+	var manager, k8sClient = newTestFinalizerManager(cluster)
+	manager.k8sClient = &conflictingClient{
+		Client: k8sClient,
+		key: types.NamespacedName{
+			Namespace: cluster.Namespace,
+			Name:      cluster.Name,
+		},
+		conflicts: 1,
+	}
+
+	assert.NilError(
+		t,
+		manager.EnsureFinalizerAdded(
+			context.Background(), cluster, clusterFinalizer))
+	var expected = []string{"example.com/other", clusterFinalizer}
+	assert.DeepEqual(t, cluster.Finalizers, expected)
+	assert.DeepEqual(t, getTestStoredCluster(t, k8sClient).Finalizers, expected)
+}
+
+// The merged spec of a templated cluster is not written back.
+func TestEnsureFinalizerAddedTemplatedCluster(t *testing.T) {
+	var cluster = getTestSessionCluster()
+	cluster.Spec.TemplateRef = &corev1.LocalObjectReference{Name: "base"}
+	var manager, k8sClient = newTestFinalizerManager(cluster)
+
+	var templated = cluster.DeepCopy()
+	templated.Spec.FlinkProperties = map[string]string{"state.backend": "rocksdb"}
+	assert.NilError(
+		t,
+		manager.EnsureFinalizerAdded(
+			context.Background(), templated, clusterFinalizer))
+	assert.DeepEqual(t, templated.Finalizers, []string{clusterFinalizer})
+	assert.Equal(t, templated.Spec.FlinkProperties["state.backend"], "rocksdb")
+
+	var updated = getTestStoredCluster(t, k8sClient)
+	assert.DeepEqual(t, updated.Finalizers, []string{clusterFinalizer})
+	assert.Equal(t, updated.ResourceVersion, templated.ResourceVersion)
+	var _, found = updated.Spec.FlinkProperties["state.backend"]
+	assert.Assert(t, !found)
+}
@@ -17,8 +17,12 @@ limitations under the License.
 package flinkclient
 
 import (
+	"crypto/tls"
 	"encoding/json"
 	"fmt"
+	"io"
+	"path"
+	"strings"
 	"time"
 
 	"github.com/go-logr/logr"
@@ -29,16 +33,79 @@ const (
 	savepointStateCompleted  = "COMPLETED"
 )
 
-// FlinkClient - Flink API client.
-type FlinkClient struct {
+// FlinkClient - Flink API client. It is an interface, so that tests can
+// inject a fake.
+type FlinkClient interface {
+	GetJobStatusList(apiBaseURL string, jobStatusList *JobStatusList) error
+	GetClusterOverview(apiBaseURL string) (ClusterOverview, error)
+	GetTaskManagers(apiBaseURL string) (TaskManagerList, error)
+	GetJobDetails(apiBaseURL string, jobID string) (JobDetails, error)
+	GetCheckpointStatistics(
+		apiBaseURL string, jobID string) (CheckpointStatistics, error)
+	GetJarID(apiBaseURL string, jarName string) (string, error)
+	UploadJar(apiBaseURL string, jarName string, jar io.Reader) (string, error)
+	SubmitStreamGraph(
+		apiBaseURL string, jarID string, streamGraphJSON string) (
+		JarRunResponse, error)
+	RunJar(apiBaseURL string, jarID string, request JarRunRequest) (
+		JarRunResponse, error)
+	GetVertexBackpressure(
+		apiBaseURL string, jobID string, vertexID string) (
+		VertexBackpressure, error)
+	GetJobManagerMetrics(apiBaseURL string) ([]Metric, error)
+	GetVertexMetrics(
+		apiBaseURL string, jobID string, vertexID string, ids []string) (
+		[]AggregatedMetric, error)
+	StopJob(apiBaseURL string, jobID string) error
+	TriggerSavepoint(
+		apiBaseURL string, jobID string, dir string) (SavepointTriggerID, error)
+	GetSavepointStatus(
+		apiBaseURL string, jobID string, triggerID string) (
+		SavepointStatus, error)
+	TakeSavepoint(
+		apiBaseURL string, jobID string, dir string) (SavepointStatus, error)
+	StopJobWithSavepoint(
+		apiBaseURL string, jobID string, dir string) (SavepointTriggerID, error)
+	// Returns a copy of the client which sends HTTPS requests with the TLS
+	// config.
+	WithTLSConfig(tlsConfig *tls.Config) FlinkClient
+}
+
+// RESTClient - FlinkClient implementation on the Flink REST API.
+type RESTClient struct {
 	Log        logr.Logger
 	HTTPClient HTTPClient
 }
 
-// JobStatus defines Flink job status.
+// NewFlinkClient creates a Flink API client, each request of which times out
+// after the timeout, and failed reads of which are retried at most maxRetries
+// times. 0 timeout means the default timeout.
+func NewFlinkClient(
+	log logr.Logger, timeout time.Duration, maxRetries int) FlinkClient {
+	return &RESTClient{
+		Log: log,
+		HTTPClient: HTTPClient{
+			Log:        log,
+			Timeout:    timeout,
+			MaxRetries: maxRetries,
+		},
+	}
+}
+
+// WithTLSConfig returns a copy of the client with the TLS config.
+func (c *RESTClient) WithTLSConfig(tlsConfig *tls.Config) FlinkClient {
+	var copied = *c
+	copied.HTTPClient.TLSConfig = tlsConfig
+	return &copied
+}
+
+// JobStatus defines Flink job status, from the job overview.
 type JobStatus struct {
-	ID     string
-	Status string
+	ID     string `json:"jid"`
+	Name   string `json:"name,omitempty"`
+	Status string `json:"state"`
+	// The start time of the job in milliseconds since the epoch.
+	StartTime int64 `json:"start-time,omitempty"`
 }
 
 // JobStatusList defines Flink job status list.
@@ -46,6 +113,143 @@ type JobStatusList struct {
 	Jobs []JobStatus
 }
 
+// ClusterOverview defines the overview of a Flink cluster.
+type ClusterOverview struct {
+	TaskManagers   int32 `json:"taskmanagers"`
+	SlotsTotal     int32 `json:"slots-total"`
+	SlotsAvailable int32 `json:"slots-available"`
+	JobsRunning    int32 `json:"jobs-running"`
+	JobsFinished   int32 `json:"jobs-finished"`
+	JobsCancelled  int32 `json:"jobs-cancelled"`
+	JobsFailed     int32 `json:"jobs-failed"`
+}
+
+// TaskManagerInfo defines a TaskManager registered with the JobManager.
+type TaskManagerInfo struct {
+	ID string `json:"id"`
+	// The actor path, which contains the address of the TaskManager, e.g.,
+	// akka.tcp://flink@10.8.0.5:6122/user/taskmanager_0.
+	Path        string `json:"path"`
+	SlotsNumber int32  `json:"slotsNumber"`
+	FreeSlots   int32  `json:"freeSlots"`
+}
+
+// TaskManagerList defines the TaskManagers of a Flink cluster.
+type TaskManagerList struct {
+	TaskManagers []TaskManagerInfo `json:"taskmanagers"`
+}
+
+// JobVertex defines a vertex of a Flink job.
+type JobVertex struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+// JobDetails defines the details of a Flink job.
+type JobDetails struct {
+	ID       string      `json:"jid"`
+	Name     string      `json:"name"`
+	State    string      `json:"state"`
+	Vertices []JobVertex `json:"vertices"`
+}
+
+// Jar defines a JAR file uploaded to the JobManager.
+type Jar struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+// JarList defines the list of the JAR files uploaded to the JobManager.
+type JarList struct {
+	Files []Jar `json:"files"`
+}
+
+// JarRunRequest defines the request to run an uploaded JAR file.
+type JarRunRequest struct {
+	EntryClass            string   `json:"entryClass,omitempty"`
+	ProgramArgsList       []string `json:"programArgsList,omitempty"`
+	Parallelism           *int32   `json:"parallelism,omitempty"`
+	SavepointPath         string   `json:"savepointPath,omitempty"`
+	AllowNonRestoredState bool     `json:"allowNonRestoredState,omitempty"`
+	JobID                 string   `json:"jobId,omitempty"`
+}
+
+// JarUploadResponse defines the response of uploading a JAR file.
+type JarUploadResponse struct {
+	FileName string `json:"filename"`
+	Status   string `json:"status"`
+}
+
+// JarRunResponse defines the response of running an uploaded JAR file.
+type JarRunResponse struct {
+	JobID string `json:"jobid"`
+}
+
+// SubtaskBackpressure defines the backpressure of a subtask of a job vertex.
+type SubtaskBackpressure struct {
+	Subtask int     `json:"subtask"`
+	Level   string  `json:"backpressure-level"`
+	Ratio   float64 `json:"ratio"`
+}
+
+// BackpressureStatusOK is the status of the backpressure of a job vertex
+// when the sampling result is available.
+const BackpressureStatusOK = "ok"
+
+// VertexBackpressure defines the backpressure of a job vertex.
+type VertexBackpressure struct {
+	// "ok" when the sampling result is available, "deprecated" when the
+	// sampling is still in progress.
+	Status   string                `json:"status"`
+	Level    string                `json:"backpressure-level"`
+	Subtasks []SubtaskBackpressure `json:"subtasks"`
+}
+
+// Metric defines a metric of a Flink component. The value is absent when
+// only the IDs of the metrics are listed.
+type Metric struct {
+	ID    string `json:"id"`
+	Value string `json:"value,omitempty"`
+}
+
+// AggregatedMetric defines a metric aggregated over the subtasks of a job
+// vertex.
+type AggregatedMetric struct {
+	ID  string  `json:"id"`
+	Sum float64 `json:"sum"`
+}
+
+// CheckpointCounts defines the numbers of the checkpoints of a job.
+type CheckpointCounts struct {
+	Completed  int32 `json:"completed"`
+	Failed     int32 `json:"failed"`
+	InProgress int32 `json:"in_progress"`
+}
+
+// Checkpoint defines a checkpoint of a job. The timestamps are in
+// milliseconds since the epoch.
+type Checkpoint struct {
+	ID                 int64  `json:"id"`
+	Status             string `json:"status"`
+	IsSavepoint        bool   `json:"is_savepoint"`
+	TriggerTimestamp   int64  `json:"trigger_timestamp"`
+	LatestAckTimestamp int64  `json:"latest_ack_timestamp"`
+}
+
+// LatestCheckpoints defines the latest checkpoints of a job.
+type LatestCheckpoints struct {
+	Completed *Checkpoint `json:"completed"`
+	Failed    *Checkpoint `json:"failed"`
+}
+
+// CheckpointStatistics defines the checkpoint statistics of a job.
+type CheckpointStatistics struct {
+	Counts CheckpointCounts  `json:"counts"`
+	Latest LatestCheckpoints `json:"latest"`
+	// The recent checkpoints, the most recent first.
+	History []Checkpoint `json:"history"`
+}
+
 // SavepointTriggerID defines trigger ID of an async savepoint operation.
 type SavepointTriggerID struct {
 	RequestID string `json:"request-id"`
@@ -76,14 +280,169 @@ type SavepointStatus struct {
 	FailureCause SavepointFailureCause
 }
 
-// GetJobStatusList gets Flink job status list.
-func (c *FlinkClient) GetJobStatusList(
+// GetJobStatusList gets Flink job status list. It is read from the job
+// overview, which has the names and the start times of the jobs too.
+func (c *RESTClient) GetJobStatusList(
 	apiBaseURL string, jobStatusList *JobStatusList) error {
-	return c.HTTPClient.Get(apiBaseURL+"/jobs", jobStatusList)
+	return c.HTTPClient.Get(apiBaseURL+"/jobs/overview", jobStatusList)
+}
+
+// GetClusterOverview gets the overview of the cluster.
+func (c *RESTClient) GetClusterOverview(
+	apiBaseURL string) (ClusterOverview, error) {
+	var overview = ClusterOverview{}
+	var err = c.HTTPClient.Get(apiBaseURL+"/overview", &overview)
+	return overview, err
+}
+
+// GetTaskManagers gets the TaskManagers of the cluster.
+func (c *RESTClient) GetTaskManagers(
+	apiBaseURL string) (TaskManagerList, error) {
+	var taskManagers = TaskManagerList{}
+	var err = c.HTTPClient.Get(apiBaseURL+"/taskmanagers", &taskManagers)
+	return taskManagers, err
+}
+
+// GetJobDetails gets the details of a job.
+func (c *RESTClient) GetJobDetails(
+	apiBaseURL string, jobID string) (JobDetails, error) {
+	var details = JobDetails{}
+	var err = c.HTTPClient.Get(
+		fmt.Sprintf("%s/jobs/%s", apiBaseURL, jobID), &details)
+	return details, err
+}
+
+// GetCheckpointStatistics gets the checkpoint statistics of a job.
+func (c *RESTClient) GetCheckpointStatistics(
+	apiBaseURL string, jobID string) (CheckpointStatistics, error) {
+	var statistics = CheckpointStatistics{}
+	var err = c.HTTPClient.Get(
+		fmt.Sprintf("%s/jobs/%s/checkpoints", apiBaseURL, jobID), &statistics)
+	return statistics, err
+}
+
+// GetJarID gets the ID of the uploaded JAR file with the name, empty if there
+// is no such JAR file.
+func (c *RESTClient) GetJarID(
+	apiBaseURL string, jarName string) (string, error) {
+	var jarList = JarList{}
+	var err = c.HTTPClient.Get(apiBaseURL+"/jars", &jarList)
+	if err != nil {
+		return "", err
+	}
+	for _, jar := range jarList.Files {
+		if jar.Name == jarName {
+			return jar.ID, nil
+		}
+	}
+	return "", nil
+}
+
+// UploadJar uploads the JAR file with the name and the content, and returns
+// the ID of the uploaded JAR file, which is the base name of the file stored
+// by the JobManager.
+func (c *RESTClient) UploadJar(
+	apiBaseURL string, jarName string, jar io.Reader) (string, error) {
+	var resp = JarUploadResponse{}
+	var err = c.HTTPClient.PostFile(
+		apiBaseURL+"/jars/upload", "jarfile", jarName, jar, &resp)
+	if err != nil {
+		return "", err
+	}
+	return path.Base(resp.FileName), nil
+}
+
+// SubmitStreamGraph runs the uploaded JAR file with the stream graph JSON as
+// the request body, and returns the ID of the submitted job. The plan
+// endpoint only shows the plan without running it. The request is not
+// retried, since the job might have been submitted when the response is lost.
+func (c *RESTClient) SubmitStreamGraph(
+	apiBaseURL string, jarID string, streamGraphJSON string) (
+	JarRunResponse, error) {
+	var resp = JarRunResponse{}
+	var err = c.HTTPClient.Post(
+		fmt.Sprintf("%s/jars/%s/run", apiBaseURL, jarID),
+		[]byte(streamGraphJSON),
+		&resp)
+	return resp, err
+}
+
+// RunJar runs the uploaded JAR file, and returns the ID of the submitted job.
+// The request is not retried, since the job might have been submitted when
+// the response is lost.
+func (c *RESTClient) RunJar(
+	apiBaseURL string, jarID string, request JarRunRequest) (
+	JarRunResponse, error) {
+	var resp = JarRunResponse{}
+	var body, err = json.Marshal(request)
+	if err != nil {
+		return resp, err
+	}
+	err = c.HTTPClient.Post(
+		fmt.Sprintf("%s/jars/%s/run", apiBaseURL, jarID), body, &resp)
+	return resp, err
+}
+
+// GetVertexBackpressure gets the backpressure of a job vertex. The first
+// request triggers the sampling, so the result might not be available yet.
+func (c *RESTClient) GetVertexBackpressure(
+	apiBaseURL string, jobID string, vertexID string) (
+	VertexBackpressure, error) {
+	var backpressure = VertexBackpressure{}
+	var err = c.HTTPClient.Get(
+		fmt.Sprintf(
+			"%s/jobs/%s/vertices/%s/backpressure", apiBaseURL, jobID, vertexID),
+		&backpressure)
+	return backpressure, err
+}
+
+// GetJobManagerMetrics gets the values of the JVM heap and garbage collector
+// metrics of the JobManager. The available metric IDs are listed first, since
+// the garbage collector names depend on the JVM.
+func (c *RESTClient) GetJobManagerMetrics(
+	apiBaseURL string) ([]Metric, error) {
+	var available = []Metric{}
+	var err = c.HTTPClient.Get(apiBaseURL+"/jobmanager/metrics", &available)
+	if err != nil {
+		return nil, err
+	}
+	var ids []string
+	for _, metric := range available {
+		if strings.HasPrefix(metric.ID, "Status.JVM.Memory.Heap.") ||
+			strings.HasPrefix(metric.ID, "Status.JVM.GarbageCollector.") {
+			ids = append(ids, metric.ID)
+		}
+	}
+	if len(ids) == 0 {
+		return []Metric{}, nil
+	}
+	var metrics = []Metric{}
+	err = c.HTTPClient.Get(
+		fmt.Sprintf(
+			"%s/jobmanager/metrics?get=%s", apiBaseURL, strings.Join(ids, ",")),
+		&metrics)
+	return metrics, err
+}
+
+// GetVertexMetrics gets the metrics of a job vertex summed up over its
+// subtasks.
+func (c *RESTClient) GetVertexMetrics(
+	apiBaseURL string, jobID string, vertexID string, ids []string) (
+	[]AggregatedMetric, error) {
+	var metrics = []AggregatedMetric{}
+	var err = c.HTTPClient.Get(
+		fmt.Sprintf(
+			"%s/jobs/%s/vertices/%s/subtasks/metrics?get=%s&agg=sum",
+			apiBaseURL,
+			jobID,
+			vertexID,
+			strings.Join(ids, ",")),
+		&metrics)
+	return metrics, err
 }
 
 // StopJob stops a job.
-func (c *FlinkClient) StopJob(
+func (c *RESTClient) StopJob(
 	apiBaseURL string, jobID string) error {
 	var resp = struct{}{}
 	return c.HTTPClient.Patch(
@@ -91,7 +450,7 @@ func (c *FlinkClient) StopJob(
 }
 
 // TriggerSavepoint triggers an async savepoint operation.
-func (c *FlinkClient) TriggerSavepoint(
+func (c *RESTClient) TriggerSavepoint(
 	apiBaseURL string, jobID string, dir string) (SavepointTriggerID, error) {
 	var url = fmt.Sprintf("%s/jobs/%s/savepoints", apiBaseURL, jobID)
 	var jsonStr = fmt.Sprintf(`{
@@ -103,6 +462,21 @@ func (c *FlinkClient) TriggerSavepoint(
 	return triggerID, err
 }
 
+// StopJobWithSavepoint triggers an async savepoint operation which stops the
+// job once the savepoint completes, its status is returned by
+// GetSavepointStatus like the status of other savepoints.
+func (c *RESTClient) StopJobWithSavepoint(
+	apiBaseURL string, jobID string, dir string) (SavepointTriggerID, error) {
+	var url = fmt.Sprintf("%s/jobs/%s/stop", apiBaseURL, jobID)
+	var jsonStr = fmt.Sprintf(`{
+		"targetDirectory" : "%s",
+		"drain" : false
+	}`, dir)
+	var triggerID = SavepointTriggerID{}
+	var err = c.HTTPClient.Post(url, []byte(jsonStr), &triggerID)
+	return triggerID, err
+}
+
 // GetSavepointStatus returns savepoint status.
 //
 // Flink API response examples:
@@ -127,7 +501,7 @@ func (c *FlinkClient) TriggerSavepoint(
 //      }
 //    }
 // }
-func (c *FlinkClient) GetSavepointStatus(
+func (c *RESTClient) GetSavepointStatus(
 	apiBaseURL string, jobID string, triggerID string) (SavepointStatus, error) {
 	var url = fmt.Sprintf(
 		"%s/jobs/%s/savepoints/%s", apiBaseURL, jobID, triggerID)
@@ -175,7 +549,7 @@ func (c *FlinkClient) GetSavepointStatus(
 }
 
 // TakeSavepoint takes savepoint, blocks until it suceeds or fails.
-func (c *FlinkClient) TakeSavepoint(
+func (c *RESTClient) TakeSavepoint(
 	apiBaseURL string, jobID string, dir string) (SavepointStatus, error) {
 	var triggerID = SavepointTriggerID{}
 	var status = SavepointStatus{JobID: jobID}
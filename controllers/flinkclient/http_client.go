@@ -18,18 +18,44 @@ package flinkclient
 
 import (
 	"bytes"
+	"crypto/tls"
 	"encoding/json"
 	"fmt"
+	"io"
 	"io/ioutil"
+	"mime/multipart"
 	"net/http"
 	"time"
 
 	"github.com/go-logr/logr"
 )
 
+// The timeout of a request if not specified.
+const defaultTimeout = 30 * time.Second
+
+// The timeout of a file upload, which is longer than that of other requests,
+// since the file, e.g., the JAR of a job, can be large.
+const uploadTimeout = 5 * time.Minute
+
+// The delay before retrying a failed request.
+var retryInterval = 1 * time.Second
+
 // HTTPClient - HTTP client.
 type HTTPClient struct {
 	Log logr.Logger
+
+	// The timeout of each request, default: 30s.
+	Timeout time.Duration
+
+	// The number of retries of a failed GET request, either because the
+	// server is unreachable or because of a server error. Other requests are
+	// not retried, because they are not idempotent, e.g., triggering a
+	// savepoint. 0 means no retries.
+	MaxRetries int
+
+	// (Optional) TLS config of HTTPS requests, e.g., with the CA bundle of
+	// the server and the client certificate. nil means the default config.
+	TLSConfig *tls.Config
 }
 
 // Get - HTTP GET.
@@ -49,25 +75,117 @@ func (c *HTTPClient) Patch(
 	return c.doHTTP("PATCH", url, body, outStructPtr)
 }
 
+// PostFile - HTTP POST of a multipart form with the content as the file field,
+// e.g., to upload a JAR file. The content is streamed, so the request is not
+// retried.
+func (c *HTTPClient) PostFile(
+	url string,
+	field string,
+	fileName string,
+	content io.Reader,
+	outStructPtr interface{}) error {
+	var bodyReader, bodyWriter = io.Pipe()
+	defer bodyReader.Close()
+	var form = multipart.NewWriter(bodyWriter)
+	go func() {
+		var part, err = form.CreateFormFile(field, fileName)
+		if err == nil {
+			_, err = io.Copy(part, content)
+		}
+		if err == nil {
+			err = form.Close()
+		}
+		bodyWriter.CloseWithError(err)
+	}()
+
+	req, err := http.NewRequest("POST", url, bodyReader)
+	c.Log.Info("HTTPClient", "url", url, "method", "POST", "error", err)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("User-Agent", "flink-operator")
+	req.Header.Set("Content-Type", form.FormDataContentType())
+	var httpClient = c.newHTTPClient(uploadTimeout)
+	if transport, ok := httpClient.Transport.(*http.Transport); ok {
+		defer transport.CloseIdleConnections()
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	c.Log.Info("HTTPClient", "status", resp.Status, "url", url)
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		resp.Body.Close()
+		return fmt.Errorf("%v", resp.Status)
+	}
+	return c.readResponse(resp, outStructPtr)
+}
+
+// Creates an HTTP client with the timeout, and with the TLS config if any.
+func (c *HTTPClient) newHTTPClient(timeout time.Duration) *http.Client {
+	httpClient := &http.Client{Timeout: timeout}
+	if c.TLSConfig != nil {
+		httpClient.Transport = &http.Transport{
+			Proxy:           http.ProxyFromEnvironment,
+			TLSClientConfig: c.TLSConfig,
+		}
+	}
+	return httpClient
+}
+
 func (c *HTTPClient) doHTTP(
 	method string, url string, body []byte, outStructPtr interface{}) error {
-	httpClient := &http.Client{Timeout: 30 * time.Second}
+	var timeout = c.Timeout
+	if timeout == 0 {
+		timeout = defaultTimeout
+	}
+	var httpClient = c.newHTTPClient(timeout)
+	if transport, ok := httpClient.Transport.(*http.Transport); ok {
+		defer transport.CloseIdleConnections()
+	}
+	var maxRetries = 0
+	if method == "GET" {
+		maxRetries = c.MaxRetries
+	}
+	var err error
+	for attempt := 0; ; attempt++ {
+		var retriable bool
+		retriable, err = c.doHTTPOnce(httpClient, method, url, body, outStructPtr)
+		if err == nil || !retriable || attempt >= maxRetries {
+			return err
+		}
+		c.Log.Info(
+			"HTTPClient retrying", "url", url, "attempt", attempt+1, "error", err)
+		time.Sleep(retryInterval)
+	}
+}
+
+// Sends the request once, returns whether the request can be retried if it
+// failed.
+func (c *HTTPClient) doHTTPOnce(
+	httpClient *http.Client,
+	method string,
+	url string,
+	body []byte,
+	outStructPtr interface{}) (bool, error) {
 	req, err := c.createRequest(method, url, body)
 	c.Log.Info("HTTPClient", "url", url, "method", method, "error", err)
 	if err != nil {
-		return err
+		return false, err
 	}
 	resp, err := httpClient.Do(req)
 	if err != nil {
-		return err
+		return true, err
 	}
 	c.Log.Info(
 		"HTTPClient", "status", resp.Status, "body", outStructPtr, "error", err)
 	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		resp.Body.Close()
 		err = fmt.Errorf("%v", resp.Status)
-		return err
+		return resp.StatusCode >= 500, err
 	}
-	return c.readResponse(resp, outStructPtr)
+	return false, c.readResponse(resp, outStructPtr)
 }
 
 func (c *HTTPClient) createRequest(
@@ -0,0 +1,115 @@
+/*
+Copyright 2019 Google LLC.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package flinkclient
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"gotest.tools/assert"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// Starts a server which fails the first failures requests with the status,
+// and counts the requests.
+func newFlakyServer(
+	failures int, status int, requests *int) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			*requests++
+			if *requests <= failures {
+				w.WriteHeader(status)
+				return
+			}
+			fmt.Fprint(w, `{"taskmanagers": 2}`)
+		}))
+}
+
+func TestHTTPClientRetry(t *testing.T) {
+	retryInterval = 0
+	var client = HTTPClient{Log: log.Log, MaxRetries: 2}
+	var requests = 0
+	var overview = ClusterOverview{}
+
+	// Server errors of reads are retried.
+	var server = newFlakyServer(2, http.StatusServiceUnavailable, &requests)
+	var err = client.Get(server.URL+"/overview", &overview)
+	server.Close()
+	assert.NilError(t, err)
+	assert.Equal(t, requests, 3)
+	assert.Equal(t, overview.TaskManagers, int32(2))
+
+	// Up to the limit.
+	requests = 0
+	server = newFlakyServer(3, http.StatusServiceUnavailable, &requests)
+	err = client.Get(server.URL+"/overview", &overview)
+	server.Close()
+	assert.Error(t, err, "503 Service Unavailable")
+	assert.Equal(t, requests, 3)
+
+	// Client errors are not retried.
+	requests = 0
+	server = newFlakyServer(1, http.StatusNotFound, &requests)
+	err = client.Get(server.URL+"/overview", &overview)
+	server.Close()
+	assert.Error(t, err, "404 Not Found")
+	assert.Equal(t, requests, 1)
+
+	// Writes are not retried.
+	requests = 0
+	server = newFlakyServer(1, http.StatusServiceUnavailable, &requests)
+	err = client.Post(server.URL+"/jobs/job1/savepoints", []byte{}, &overview)
+	server.Close()
+	assert.Error(t, err, "503 Service Unavailable")
+	assert.Equal(t, requests, 1)
+}
+
+func TestUploadJar(t *testing.T) {
+	var uploaded string
+	var server = httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			if r.Method != "POST" || r.URL.Path != "/jars/upload" {
+				http.NotFound(w, r)
+				return
+			}
+			var file, header, err = r.FormFile("jarfile")
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			var content, _ = ioutil.ReadAll(file)
+			uploaded = header.Filename + ": " + string(content)
+			fmt.Fprint(w, `{"filename": "/tmp/flink-web-upload/`+
+				`5f1d_wordcount.jar", "status": "success"}`)
+		}))
+	defer server.Close()
+	var client = NewFlinkClient(log.Log, 0, 0)
+
+	var jarID, err = client.UploadJar(
+		server.URL, "wordcount.jar", strings.NewReader("jar content"))
+	assert.NilError(t, err)
+	assert.Equal(t, jarID, "5f1d_wordcount.jar")
+	assert.Equal(t, uploaded, "wordcount.jar: jar content")
+
+	_, err = client.UploadJar(
+		server.URL+"/missing", "wordcount.jar", strings.NewReader(""))
+	assert.Error(t, err, "404 Not Found")
+}
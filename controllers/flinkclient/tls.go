@@ -0,0 +1,64 @@
+/*
+Copyright 2019 Google LLC.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package flinkclient
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+)
+
+// NewTLSConfig creates the TLS config of the Flink REST API from the
+// PEM-encoded CA bundle, and the optional client certificate and key for
+// mutual TLS. The CA bundle is required unless insecureSkipVerify is true,
+// in which case the server certificate is not verified at all.
+func NewTLSConfig(
+	caBundle []byte,
+	clientCert []byte,
+	clientKey []byte,
+	insecureSkipVerify bool) (*tls.Config, error) {
+	var tlsConfig = &tls.Config{
+		MinVersion:         tls.VersionTLS12,
+		InsecureSkipVerify: insecureSkipVerify,
+	}
+
+	if len(caBundle) > 0 {
+		var pool = x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(caBundle) {
+			return nil, fmt.Errorf("no valid PEM certificate in the CA bundle")
+		}
+		tlsConfig.RootCAs = pool
+	} else if !insecureSkipVerify {
+		return nil, fmt.Errorf("CA bundle is unspecified")
+	}
+
+	if len(clientCert) > 0 || len(clientKey) > 0 {
+		if len(clientCert) == 0 {
+			return nil, fmt.Errorf("client key is specified without certificate")
+		}
+		if len(clientKey) == 0 {
+			return nil, fmt.Errorf("client certificate is specified without key")
+		}
+		var cert, err = tls.X509KeyPair(clientCert, clientKey)
+		if err != nil {
+			return nil, fmt.Errorf("invalid client certificate: %v", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	return tlsConfig, nil
+}
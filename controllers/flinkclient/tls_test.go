@@ -0,0 +1,146 @@
+/*
+Copyright 2019 Google LLC.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package flinkclient
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"gotest.tools/assert"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+func newTestTLSServer() *httptest.Server {
+	return httptest.NewTLSServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprint(w, `{"taskmanagers": 2}`)
+		}))
+}
+
+func encodeCertificate(cert *x509.Certificate) []byte {
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw})
+}
+
+// Generates a self-signed client certificate and its key in PEM.
+func newTestClientCertificate(t *testing.T) ([]byte, []byte) {
+	var key, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NilError(t, err)
+	var template = x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "flink-operator"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(
+		rand.Reader, &template, &template, &key.PublicKey, key)
+	assert.NilError(t, err)
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	assert.NilError(t, err)
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+}
+
+func TestHTTPClientTLS(t *testing.T) {
+	var server = newTestTLSServer()
+	defer server.Close()
+	var overview = ClusterOverview{}
+
+	// The server certificate is verified with the CA bundle.
+	var tlsConfig, err = NewTLSConfig(
+		encodeCertificate(server.Certificate()), nil, nil, false)
+	assert.NilError(t, err)
+	var client = HTTPClient{Log: log.Log, TLSConfig: tlsConfig}
+	err = client.Get(server.URL+"/overview", &overview)
+	assert.NilError(t, err)
+	assert.Equal(t, overview.TaskManagers, int32(2))
+
+	// The verification fails without the CA bundle.
+	client = HTTPClient{Log: log.Log, TLSConfig: &tls.Config{}}
+	err = client.Get(server.URL+"/overview", &overview)
+	assert.ErrorContains(t, err, "certificate")
+
+	// Unless it is skipped explicitly.
+	tlsConfig, err = NewTLSConfig(nil, nil, nil, true)
+	assert.NilError(t, err)
+	client = HTTPClient{Log: log.Log, TLSConfig: tlsConfig}
+	err = client.Get(server.URL+"/overview", &overview)
+	assert.NilError(t, err)
+}
+
+func TestHTTPClientMutualTLS(t *testing.T) {
+	var clientCert, clientKey = newTestClientCertificate(t)
+	var clientCAs = x509.NewCertPool()
+	clientCAs.AppendCertsFromPEM(clientCert)
+	var server = httptest.NewUnstartedServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprint(w, `{"taskmanagers": 2}`)
+		}))
+	server.TLS = &tls.Config{
+		ClientAuth: tls.RequireAndVerifyClientCert,
+		ClientCAs:  clientCAs,
+	}
+	server.StartTLS()
+	defer server.Close()
+	var caBundle = encodeCertificate(server.Certificate())
+	var overview = ClusterOverview{}
+
+	var tlsConfig, err = NewTLSConfig(caBundle, clientCert, clientKey, false)
+	assert.NilError(t, err)
+	var client = HTTPClient{Log: log.Log, TLSConfig: tlsConfig}
+	err = client.Get(server.URL+"/overview", &overview)
+	assert.NilError(t, err)
+	assert.Equal(t, overview.TaskManagers, int32(2))
+
+	// The server rejects the connection without the client certificate.
+	tlsConfig, err = NewTLSConfig(caBundle, nil, nil, false)
+	assert.NilError(t, err)
+	client = HTTPClient{Log: log.Log, TLSConfig: tlsConfig}
+	err = client.Get(server.URL+"/overview", &overview)
+	assert.Assert(t, err != nil, "err is not expected to be nil")
+}
+
+func TestNewTLSConfigInvalid(t *testing.T) {
+	var clientCert, clientKey = newTestClientCertificate(t)
+
+	var _, err1 = NewTLSConfig(nil, nil, nil, false)
+	assert.Error(t, err1, "CA bundle is unspecified")
+
+	var _, err2 = NewTLSConfig([]byte("not a certificate"), nil, nil, false)
+	assert.Error(t, err2, "no valid PEM certificate in the CA bundle")
+
+	var _, err3 = NewTLSConfig(clientCert, clientCert, nil, false)
+	assert.Error(t, err3, "client certificate is specified without key")
+
+	var _, err4 = NewTLSConfig(clientCert, nil, clientKey, false)
+	assert.Error(t, err4, "client key is specified without certificate")
+
+	var _, err5 = NewTLSConfig(clientCert, clientKey, clientCert, false)
+	assert.ErrorContains(t, err5, "invalid client certificate: ")
+}
@@ -0,0 +1,298 @@
+/*
+Copyright 2019 Google LLC.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+// TaskManager autoscaler. The updater decides the desired number of
+// TaskManager replicas from the slot utilization and the backpressure observed
+// through the Flink API and records it in the status, then the converter uses
+// it as the replicas of the TaskManager deployment in the next reconciliation.
+// Without autoscaling, the replicas of the spec are used as is, their default
+// provides enough task slots for the parallelism of the job. Before the replicas are reduced, the TaskManagers
+// are drained: the Flink API has no way to move the tasks off a TaskManager, so
+// the reconciler waits until enough TaskManagers are idle, i.e., all their
+// slots are free, and removes exactly their pods. When the autoscaler scales up
+// for high backpressure, it also raises the parallelism of the job to fill the
+// new slots, and the job is rescaled to it with a savepoint.
+
+import (
+	"strconv"
+	"time"
+
+	v1beta1 "github.com/googlecloudplatform/flink-operator/api/v1beta1"
+)
+
+const (
+	// Scale up by one TaskManager when the ratio of used slots is at least
+	// this value.
+	scaleUpSlotUtilization = 0.9
+
+	// Scale down by one TaskManager when the ratio of used slots is at most
+	// this value.
+	scaleDownSlotUtilization = 0.5
+
+	backpressureLevelHigh = "HIGH"
+
+	// How long a scale-down waits for the TaskManagers to be drained by
+	// default.
+	defaultDrainTimeoutSeconds int32 = 600
+)
+
+func isAutoscalingEnabled(tmSpec *v1beta1.TaskManagerSpec) bool {
+	return tmSpec.MaxReplicas != nil && tmSpec.MinReplicas != nil
+}
+
+// Gets the number of replicas of the TaskManager deployment, which is the
+// recorded decision of the autoscaler if autoscaling is enabled, otherwise the
+// replicas of the spec. The decision of the autoscaler is overridden when the
+// replicas of the spec are edited.
+func getTaskManagerReplicas(cluster *v1beta1.FlinkCluster) int32 {
+	var tmSpec = &cluster.Spec.TaskManager
+	if !isAutoscalingEnabled(tmSpec) {
+		return tmSpec.Replicas
+	}
+	var replicas = tmSpec.Replicas
+	if isAutoscalingDecisionValid(cluster) {
+		replicas = cluster.Status.Components.TaskManagerDeployment.DesiredReplicas
+	}
+	return clampReplicas(replicas, *tmSpec.MinReplicas, *tmSpec.MaxReplicas)
+}
+
+// Whether the recorded decision of the autoscaler applies to the spec, i.e.,
+// it has decided and the replicas of the spec are unchanged since then.
+func isAutoscalingDecisionValid(cluster *v1beta1.FlinkCluster) bool {
+	var tmStatus = &cluster.Status.Components.TaskManagerDeployment
+	return tmStatus.DesiredReplicas > 0 &&
+		tmStatus.SpecReplicas == cluster.Spec.TaskManager.Replicas
+}
+
+// Gets the parallelism which the job should run with, i.e., the parallelism of
+// the spec, or the parallelism which fills the task slots added by the
+// autoscaler for high backpressure if more. Nil if the spec leaves the
+// parallelism to Flink.
+func getDesiredParallelism(cluster *v1beta1.FlinkCluster) *int32 {
+	var jobSpec = cluster.Spec.Job
+	if jobSpec == nil || jobSpec.Parallelism == nil {
+		return nil
+	}
+	var autoscaled = cluster.Status.Components.TaskManagerDeployment.AutoscaledParallelism
+	if isAutoscalingEnabled(&cluster.Spec.TaskManager) &&
+		isAutoscalingDecisionValid(cluster) &&
+		autoscaled > *jobSpec.Parallelism {
+		return &autoscaled
+	}
+	return jobSpec.Parallelism
+}
+
+// Gets the total number of TaskManagers of the pools of the spec.
+func getTaskManagerPoolReplicas(cluster *v1beta1.FlinkCluster) int32 {
+	var replicas int32
+	for _, pool := range cluster.Spec.TaskManager.Pools {
+		replicas += pool.Replicas
+	}
+	return replicas
+}
+
+// Whether the TaskManager deployment or StatefulSet is being scaled down, in
+// which case the TaskManagers are drained before the replicas are reduced.
+// The TaskManagers of a suspended cluster are stopped without draining, and
+// so are those which can't be matched with their pods through the Flink API.
+func isTaskManagerScalingDown(observed *ObservedClusterState) bool {
+	var replicas = getObservedTaskManagerReplicas(observed)
+	if observed.cluster == nil || observed.cluster.Spec.Suspend ||
+		replicas == nil ||
+		!isTaskManagerResourceIDSupported(&observed.cluster.Spec) {
+		return false
+	}
+	return *replicas > getTaskManagerReplicas(observed.cluster)
+}
+
+// Gets the number of task slots of each TaskManager, which is
+// `taskmanager.numberOfTaskSlots` of the Flink properties if specified,
+// otherwise `taskManager.slotsPerTask`, default: 1.
+func getTaskSlotsPerTaskManager(cluster *v1beta1.FlinkCluster) int32 {
+	var slots, err = strconv.ParseInt(
+		cluster.Spec.FlinkProperties["taskmanager.numberOfTaskSlots"], 10, 32)
+	if err == nil && slots >= 1 {
+		return int32(slots)
+	}
+	var slotsPerTask = cluster.Spec.TaskManager.SlotsPerTask
+	if slotsPerTask != nil && *slotsPerTask >= 1 {
+		return *slotsPerTask
+	}
+	return 1
+}
+
+// Gets the parallelism which the job can run with on the observed TaskManager
+// deployment or StatefulSet and the pools, i.e., the job parallelism capped by
+// their task slots, 0 for session clusters.
+func getEffectiveParallelism(observed *ObservedClusterState) int {
+	var jobSpec = observed.cluster.Spec.Job
+	var slots = getObservedTaskSlots(observed)
+	if jobSpec == nil || slots == nil {
+		return 0
+	}
+	var parallelism = int32(1)
+	if jobSpec.Parallelism != nil {
+		parallelism = *jobSpec.Parallelism
+	}
+	if *slots < parallelism {
+		return int(*slots)
+	}
+	return int(parallelism)
+}
+
+// Whether the observed TaskManagers, including the pools, provide fewer task
+// slots than the job parallelism, in which case the job can't be scheduled.
+func hasInsufficientSlots(observed *ObservedClusterState) bool {
+	var jobSpec = observed.cluster.Spec.Job
+	var slots = getObservedTaskSlots(observed)
+	if jobSpec == nil || jobSpec.Parallelism == nil || slots == nil {
+		return false
+	}
+	return *slots < *jobSpec.Parallelism
+}
+
+// Gets the task slots of the observed TaskManager StatefulSet or deployment
+// and the pools, nil if neither the StatefulSet nor the deployment exists.
+func getObservedTaskSlots(observed *ObservedClusterState) *int32 {
+	var replicas = getObservedTaskManagerReplicas(observed)
+	if replicas == nil {
+		return nil
+	}
+	var totalReplicas = *replicas
+	for _, pool := range observed.tmPools {
+		if pool != nil && pool.Spec.Replicas != nil {
+			totalReplicas += *pool.Spec.Replicas
+		}
+	}
+	var slots = totalReplicas * getTaskSlotsPerTaskManager(observed.cluster)
+	return &slots
+}
+
+// Gets the replicas of the observed TaskManager StatefulSet or deployment, nil
+// if neither exists.
+func getObservedTaskManagerReplicas(observed *ObservedClusterState) *int32 {
+	if observed.tmStatefulSet != nil {
+		return observed.tmStatefulSet.Spec.Replicas
+	}
+	if observed.tmDeployment != nil {
+		return observed.tmDeployment.Spec.Replicas
+	}
+	return nil
+}
+
+func clampReplicas(replicas int32, min int32, max int32) int32 {
+	if replicas < min {
+		return min
+	}
+	if replicas > max {
+		return max
+	}
+	return replicas
+}
+
+// Derives the autoscaling status of the TaskManager deployment. A new decision
+// is only made after the cooldown of the last one, and when all the desired
+// TaskManagers, including those of the pools, have registered with the
+// JobManager, so that the utilization reflects the last decision. The pools
+// are not scaled, but their slots count for the utilization. Scaling down
+// never removes the slots in use by the running jobs. Scaling up for high
+// backpressure raises the parallelism of the job to fill the new slots.
+func deriveTaskManagerAutoscaling(
+	recorded v1beta1.FlinkClusterComponentState,
+	observed *ObservedClusterState,
+	status *v1beta1.FlinkClusterComponentState,
+	now time.Time) {
+	var cluster = observed.cluster
+	var tmSpec = &cluster.Spec.TaskManager
+	if !isAutoscalingEnabled(tmSpec) {
+		return
+	}
+	var current = getTaskManagerReplicas(cluster)
+	status.DesiredReplicas = current
+	status.SpecReplicas = tmSpec.Replicas
+	status.ScaleReason = recorded.ScaleReason
+	status.LastScaleTime = recorded.LastScaleTime
+	if isAutoscalingDecisionValid(cluster) {
+		status.AutoscaledParallelism = recorded.AutoscaledParallelism
+	}
+
+	var poolReplicas = getTaskManagerPoolReplicas(cluster)
+	var overview = observed.flinkOverview
+	if overview == nil || overview.SlotsTotal == 0 ||
+		overview.TaskManagers != current+poolReplicas {
+		return
+	}
+	if len(recorded.LastScaleTime) > 0 {
+		var tc = &TimeConverter{}
+		var cooldown = time.Duration(*tmSpec.AutoscaleCooldownSeconds) * time.Second
+		if now.Before(tc.FromString(recorded.LastScaleTime).Add(cooldown)) {
+			return
+		}
+	}
+
+	var usedSlots = overview.SlotsTotal - overview.SlotsAvailable
+	var utilization = float64(usedSlots) / float64(overview.SlotsTotal)
+	var target = current
+	var reason string
+	if isBackpressureHigh(observed.flinkBackpressure) {
+		target = current + 1
+		reason = v1beta1.ScaleReasonHighBackpressure
+	} else if utilization >= scaleUpSlotUtilization {
+		target = current + 1
+		reason = v1beta1.ScaleReasonHighSlotUtilization
+	} else if utilization <= scaleDownSlotUtilization {
+		target = current - 1
+		reason = v1beta1.ScaleReasonLowSlotUtilization
+		// Keep enough TaskManagers for the slots in use, which might be
+		// those of the pools.
+		var slotsPerTaskManager = getTaskSlotsPerTaskManager(cluster)
+		var usedSlotsOutsidePools = usedSlots - poolReplicas*slotsPerTaskManager
+		var neededReplicas = (usedSlotsOutsidePools + slotsPerTaskManager - 1) /
+			slotsPerTaskManager
+		if target < neededReplicas {
+			target = neededReplicas
+		}
+	}
+	target = clampReplicas(target, *tmSpec.MinReplicas, *tmSpec.MaxReplicas)
+	if target == current {
+		return
+	}
+
+	var tc = &TimeConverter{}
+	status.DesiredReplicas = target
+	status.ScaleReason = reason
+	status.LastScaleTime = tc.ToString(now)
+
+	// Fill the new slots with the job, which is rescaled to it.
+	if reason == v1beta1.ScaleReasonHighBackpressure {
+		var parallelism = (target + poolReplicas) * getTaskSlotsPerTaskManager(cluster)
+		var desired = getDesiredParallelism(cluster)
+		if desired != nil && parallelism > *desired {
+			status.AutoscaledParallelism = parallelism
+		}
+	}
+}
+
+func isBackpressureHigh(backpressure []v1beta1.VertexBackpressure) bool {
+	for _, vertex := range backpressure {
+		if vertex.Level == backpressureLevelHigh {
+			return true
+		}
+	}
+	return false
+}
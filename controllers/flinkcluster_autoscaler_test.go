@@ -0,0 +1,332 @@
+/*
+Copyright 2019 Google LLC.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"testing"
+	"time"
+
+	v1beta1 "github.com/googlecloudplatform/flink-operator/api/v1beta1"
+	"github.com/googlecloudplatform/flink-operator/controllers/flinkclient"
+	"gotest.tools/assert"
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+)
+
+func getTestAutoscalingObserved(
+	replicas int32, slotsTotal int32, slotsAvailable int32) *ObservedClusterState {
+	var minReplicas int32 = 1
+	var maxReplicas int32 = 4
+	var cooldownSeconds int32 = 300
+	var observed = getTestObservedSessionCluster(replicas)
+	observed.cluster.Spec.TaskManager = v1beta1.TaskManagerSpec{
+		Replicas:                 2,
+		MinReplicas:              &minReplicas,
+		MaxReplicas:              &maxReplicas,
+		AutoscaleCooldownSeconds: &cooldownSeconds,
+	}
+	observed.cluster.Spec.FlinkProperties = map[string]string{
+		"taskmanager.numberOfTaskSlots": "2",
+	}
+	observed.cluster.Status.Components.TaskManagerDeployment.DesiredReplicas =
+		replicas
+	observed.cluster.Status.Components.TaskManagerDeployment.SpecReplicas = 2
+	observed.flinkOverview = &flinkclient.ClusterOverview{
+		TaskManagers:   replicas,
+		SlotsTotal:     slotsTotal,
+		SlotsAvailable: slotsAvailable,
+	}
+	return &observed
+}
+
+func deriveTestAutoscaling(
+	observed *ObservedClusterState,
+	now time.Time) v1beta1.FlinkClusterComponentState {
+	var status = v1beta1.FlinkClusterComponentState{}
+	deriveTaskManagerAutoscaling(
+		observed.cluster.Status.Components.TaskManagerDeployment,
+		observed,
+		&status,
+		now)
+	return status
+}
+
+func TestTaskManagerAutoscalingDisabled(t *testing.T) {
+	var observed = getTestObservedSessionCluster(2)
+	observed.cluster.Spec.TaskManager.Replicas = 2
+	observed.flinkOverview = &flinkclient.ClusterOverview{
+		TaskManagers: 2, SlotsTotal: 2, SlotsAvailable: 0}
+
+	var status = deriveTestAutoscaling(&observed, time.Now())
+	assert.Equal(t, status.DesiredReplicas, int32(0))
+	assert.Equal(t, getTaskManagerReplicas(observed.cluster), int32(2))
+}
+
+func TestTaskManagerAutoscalingScaleUp(t *testing.T) {
+	var now = time.Now()
+	var tc = &TimeConverter{}
+
+	// High slot utilization.
+	var observed = getTestAutoscalingObserved(2, 4, 0)
+	var status = deriveTestAutoscaling(observed, now)
+	assert.Equal(t, status.DesiredReplicas, int32(3))
+	assert.Equal(t, status.ScaleReason, v1beta1.ScaleReasonHighSlotUtilization)
+	assert.Equal(t, status.LastScaleTime, tc.ToString(now))
+
+	// High backpressure.
+	observed = getTestAutoscalingObserved(2, 4, 4)
+	observed.flinkBackpressure = []v1beta1.VertexBackpressure{
+		{VertexName: "Source", Ratio: 10, Level: "OK"},
+		{VertexName: "Sink", Ratio: 80, Level: "HIGH"},
+	}
+	status = deriveTestAutoscaling(observed, now)
+	assert.Equal(t, status.DesiredReplicas, int32(3))
+	assert.Equal(t, status.ScaleReason, v1beta1.ScaleReasonHighBackpressure)
+
+	// Not above the max replicas.
+	observed = getTestAutoscalingObserved(4, 8, 0)
+	status = deriveTestAutoscaling(observed, now)
+	assert.Equal(t, status.DesiredReplicas, int32(4))
+	assert.Equal(t, status.LastScaleTime, "")
+}
+
+func TestTaskManagerAutoscalingScaleDown(t *testing.T) {
+	var now = time.Now()
+
+	// Low slot utilization.
+	var observed = getTestAutoscalingObserved(4, 8, 8)
+	var status = deriveTestAutoscaling(observed, now)
+	assert.Equal(t, status.DesiredReplicas, int32(3))
+	assert.Equal(t, status.ScaleReason, v1beta1.ScaleReasonLowSlotUtilization)
+
+	// One TaskManager at a time, the remaining ones hold the slots in use.
+	observed = getTestAutoscalingObserved(3, 6, 3)
+	status = deriveTestAutoscaling(observed, now)
+	assert.Equal(t, status.DesiredReplicas, int32(2))
+
+	// Not below the min replicas.
+	observed = getTestAutoscalingObserved(1, 2, 2)
+	status = deriveTestAutoscaling(observed, now)
+	assert.Equal(t, status.DesiredReplicas, int32(1))
+	assert.Equal(t, status.LastScaleTime, "")
+}
+
+func TestTaskManagerAutoscalingCooldown(t *testing.T) {
+	var now = time.Now()
+	var tc = &TimeConverter{}
+	var lastScaleTime = tc.ToString(now.Add(-60 * time.Second))
+
+	// Within the cooldown, the recorded decision is kept.
+	var observed = getTestAutoscalingObserved(2, 4, 0)
+	var recorded = &observed.cluster.Status.Components.TaskManagerDeployment
+	recorded.LastScaleTime = lastScaleTime
+	recorded.ScaleReason = v1beta1.ScaleReasonHighSlotUtilization
+	var status = deriveTestAutoscaling(observed, now)
+	assert.Equal(t, status.DesiredReplicas, int32(2))
+	assert.Equal(t, status.LastScaleTime, lastScaleTime)
+	assert.Equal(t, status.ScaleReason, v1beta1.ScaleReasonHighSlotUtilization)
+
+	// After the cooldown.
+	status = deriveTestAutoscaling(observed, now.Add(300*time.Second))
+	assert.Equal(t, status.DesiredReplicas, int32(3))
+}
+
+func TestTaskManagerAutoscalingWaitsForTaskManagers(t *testing.T) {
+	// The TaskManagers of the last decision have not all registered.
+	var observed = getTestAutoscalingObserved(3, 4, 0)
+	observed.flinkOverview.TaskManagers = 2
+	var status = deriveTestAutoscaling(observed, time.Now())
+	assert.Equal(t, status.DesiredReplicas, int32(3))
+	assert.Equal(t, status.LastScaleTime, "")
+
+	// The JobManager is unreachable.
+	observed.flinkOverview = nil
+	status = deriveTestAutoscaling(observed, time.Now())
+	assert.Equal(t, status.DesiredReplicas, int32(3))
+}
+
+func TestTaskManagerAutoscalingWithPools(t *testing.T) {
+	var now = time.Now()
+
+	// The TaskManagers of the pools have registered too.
+	var observed = getTestAutoscalingObserved(2, 6, 0)
+	observed.cluster.Spec.TaskManager.Pools = []v1beta1.TaskManagerPoolSpec{
+		{Name: "highmem", Replicas: 1}}
+	observed.flinkOverview.TaskManagers = 3
+	var status = deriveTestAutoscaling(observed, now)
+	assert.Equal(t, status.DesiredReplicas, int32(3))
+	assert.Equal(t, status.ScaleReason, v1beta1.ScaleReasonHighSlotUtilization)
+
+	// The slots in use might be those of the pools.
+	observed = getTestAutoscalingObserved(3, 8, 6)
+	observed.cluster.Spec.TaskManager.Pools = []v1beta1.TaskManagerPoolSpec{
+		{Name: "highmem", Replicas: 1}}
+	observed.flinkOverview.TaskManagers = 4
+	status = deriveTestAutoscaling(observed, now)
+	assert.Equal(t, status.DesiredReplicas, int32(2))
+}
+
+func TestTaskManagerAutoscalingRescalesJobForBackpressure(t *testing.T) {
+	var now = time.Now()
+	var parallelism int32 = 4
+	var savepointsDir = "gs://my-bucket/savepoints/"
+	var observed = getTestAutoscalingObserved(2, 4, 0)
+	observed.cluster.Spec.Job = &v1beta1.JobSpec{
+		JarFile:       "/opt/flink/job/wordcount.jar",
+		Parallelism:   &parallelism,
+		SavepointsDir: &savepointsDir,
+	}
+	observed.flinkBackpressure = []v1beta1.VertexBackpressure{
+		{VertexName: "Sink", Ratio: 80, Level: "HIGH"},
+	}
+
+	// The job fills the slots of the new TaskManager.
+	var status = deriveTestAutoscaling(observed, now)
+	assert.Equal(t, status.DesiredReplicas, int32(3))
+	assert.Equal(t, status.AutoscaledParallelism, int32(6))
+	observed.cluster.Status.Components.TaskManagerDeployment = status
+	assert.Equal(t, *getDesiredParallelism(observed.cluster), int32(6))
+
+	// The job runs with the spec parallelism, so it is rescaled.
+	observed.cluster.Status.Components.Job = &v1beta1.JobStatus{
+		State: v1beta1.JobStateRunning}
+	var observedJob = &batchv1.Job{}
+	observedJob.Spec.Template.Spec.Containers = []corev1.Container{
+		{Args: []string{"--parallelism", "4"}}}
+	assert.Assert(t, isRescaleRequired(observed.cluster, observedJob))
+
+	// A higher parallelism of the spec takes precedence.
+	parallelism = 8
+	assert.Equal(t, *getDesiredParallelism(observed.cluster), int32(8))
+
+	// The decision is discarded when the replicas of the spec are edited.
+	parallelism = 4
+	observed.cluster.Spec.TaskManager.Replicas = 3
+	assert.Equal(t, *getDesiredParallelism(observed.cluster), int32(4))
+}
+
+func TestGetDesiredClusterStateWithAutoscaling(t *testing.T) {
+	var minReplicas int32 = 1
+	var maxReplicas int32 = 3
+	var cooldownSeconds int32 = 300
+	var cluster = getTestSessionCluster()
+	cluster.Spec.TaskManager.MinReplicas = &minReplicas
+	cluster.Spec.TaskManager.MaxReplicas = &maxReplicas
+	cluster.Spec.TaskManager.AutoscaleCooldownSeconds = &cooldownSeconds
+
+	// Replicas in the spec before the first decision.
+	var desiredState = getDesiredClusterState(cluster, time.Now())
+	assert.Equal(t, *desiredState.TmDeployment.Spec.Replicas, int32(2))
+
+	// The recorded decision.
+	cluster.Status.Components.TaskManagerDeployment.DesiredReplicas = 3
+	cluster.Status.Components.TaskManagerDeployment.SpecReplicas = 2
+	desiredState = getDesiredClusterState(cluster, time.Now())
+	assert.Equal(t, *desiredState.TmDeployment.Spec.Replicas, int32(3))
+
+	// The replicas of the spec are edited.
+	cluster.Spec.TaskManager.Replicas = 1
+	desiredState = getDesiredClusterState(cluster, time.Now())
+	assert.Equal(t, *desiredState.TmDeployment.Spec.Replicas, int32(1))
+	cluster.Spec.TaskManager.Replicas = 2
+
+	// Clamped after the max replicas is lowered.
+	maxReplicas = 1
+	desiredState = getDesiredClusterState(cluster, time.Now())
+	assert.Equal(t, *desiredState.TmDeployment.Spec.Replicas, int32(1))
+}
+
+func TestTaskManagerReplicasForParallelism(t *testing.T) {
+	var parallelism int32 = 5
+	var observed = getTestObservedSessionCluster(2)
+	var cluster = observed.cluster
+	cluster.Spec.TaskManager.Replicas = 2
+	cluster.Spec.FlinkProperties = map[string]string{
+		"taskmanager.numberOfTaskSlots": "2",
+	}
+
+	// Session cluster.
+	assert.Equal(t, getTaskManagerReplicas(cluster), int32(2))
+
+	// The replicas of the spec are not raised for the parallelism, but the
+	// shortfall is reported.
+	cluster.Spec.Job = &v1beta1.JobSpec{Parallelism: &parallelism}
+	assert.Equal(t, getTaskManagerReplicas(cluster), int32(2))
+	assert.Assert(t, hasInsufficientSlots(&observed))
+
+	// The slots of the pools are counted.
+	var poolReplicas int32 = 1
+	observed.tmPools = map[string]*appsv1.Deployment{
+		"highmem": {Spec: appsv1.DeploymentSpec{Replicas: &poolReplicas}},
+	}
+	assert.Assert(t, !hasInsufficientSlots(&observed))
+	assert.Equal(t, getEffectiveParallelism(&observed), 5)
+}
+
+func TestTaskSlotsPerTaskManager(t *testing.T) {
+	var slotsPerTask int32 = 2
+	var cluster = getTestSessionCluster()
+
+	// One slot per TaskManager by default.
+	assert.Equal(t, getTaskSlotsPerTaskManager(cluster), int32(1))
+
+	cluster.Spec.TaskManager.SlotsPerTask = &slotsPerTask
+	assert.Equal(t, getTaskSlotsPerTaskManager(cluster), int32(2))
+
+	// The Flink properties take precedence.
+	cluster.Spec.FlinkProperties = map[string]string{
+		"taskmanager.numberOfTaskSlots": "3",
+	}
+	assert.Equal(t, getTaskSlotsPerTaskManager(cluster), int32(3))
+}
+
+func TestEffectiveParallelism(t *testing.T) {
+	var parallelism int32 = 5
+	var observed = getTestObservedSessionCluster(2)
+	observed.cluster.Spec.FlinkProperties = map[string]string{
+		"taskmanager.numberOfTaskSlots": "2",
+	}
+	assert.Equal(t, getEffectiveParallelism(&observed), 0)
+
+	// Capped by the slots of the observed deployment.
+	observed.cluster.Spec.Job = &v1beta1.JobSpec{Parallelism: &parallelism}
+	assert.Equal(t, getEffectiveParallelism(&observed), 4)
+
+	var replicas int32 = 3
+	observed.tmDeployment.Spec.Replicas = &replicas
+	assert.Equal(t, getEffectiveParallelism(&observed), 5)
+}
+
+func TestHasInsufficientSlots(t *testing.T) {
+	var parallelism int32 = 5
+	var observed = getTestObservedSessionCluster(2)
+	observed.cluster.Spec.FlinkProperties = map[string]string{
+		"taskmanager.numberOfTaskSlots": "2",
+	}
+	assert.Assert(t, !hasInsufficientSlots(&observed))
+
+	observed.cluster.Spec.Job = &v1beta1.JobSpec{Parallelism: &parallelism}
+	assert.Assert(t, hasInsufficientSlots(&observed))
+
+	// The slots of the pools are counted.
+	var poolReplicas int32 = 1
+	var pool = observed.tmDeployment.DeepCopy()
+	pool.Spec.Replicas = &poolReplicas
+	observed.tmPools = map[string]*appsv1.Deployment{"highmem": pool}
+	assert.Assert(t, !hasInsufficientSlots(&observed))
+}
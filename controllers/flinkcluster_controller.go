@@ -18,6 +18,8 @@ package controllers
 
 import (
 	"context"
+	"fmt"
+	"runtime/debug"
 	"time"
 
 	"github.com/go-logr/logr"
@@ -26,81 +28,457 @@ import (
 	appsv1 "k8s.io/api/apps/v1"
 	batchv1 "k8s.io/api/batch/v1"
 	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/version"
 	"k8s.io/client-go/tools/record"
+	"k8s.io/client-go/util/workqueue"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/source"
 )
 
+// The status message of a cluster whose reconcile panicked.
+const internalErrorMessage = "internal error, see logs"
+
 // FlinkClusterReconciler reconciles a FlinkCluster object
 type FlinkClusterReconciler struct {
-	Client         client.Client
-	Log            logr.Logger
-	Mgr            ctrl.Manager
-	WatchNamespace string
+	Client client.Client
+	Log    logr.Logger
+	Mgr    ctrl.Manager
+	// The namespaces of the clusters to reconcile, empty means all
+	// namespaces.
+	WatchNamespaces []string
+	// The operator is granted Roles in the watched namespaces instead of a
+	// ClusterRole, so the cluster-scoped namespaces are not watched.
+	NamespaceScopedRBAC bool
+	// The namespace the operator runs in, empty if it does not run in a
+	// cluster.
+	OperatorNamespace string
+	// Minor status changes within the window after a status write are
+	// skipped, 0 disables debouncing.
+	StatusDebounceWindow time.Duration
+	// Status changes which keep the cluster state are written at most once
+	// per interval, 0 disables batching.
+	StatusBatchInterval time.Duration
+	// Requeue interval while a cluster exceeds the resource quota of its
+	// namespace.
+	QuotaRequeueInterval time.Duration
+	// Timeout of each request to the Flink API, 0 means the default.
+	FlinkAPITimeout time.Duration
+	// Maximum retries of a failed read from the Flink API.
+	FlinkAPIMaxRetries int
+	// The JobManager metrics are sampled once every this many reconciles of
+	// a running cluster, 0 disables sampling.
+	JobManagerMetricsInterval int
+	// The JobManager is flagged NotReady when its heap usage stays above this
+	// ratio of the maximum heap, 0 disables it.
+	JobManagerMemoryPressureRatio float64
+	// The throughput of the running job is polled into the status at most
+	// once per this interval, 0 disables polling.
+	MetricsPollInterval time.Duration
+	// Intervals of polling the clusters depending on their states when no
+	// action is pending.
+	RequeuePolicy RequeuePolicy
+	// Maximum number of clusters reconciled concurrently, default: 1.
+	// Reconciles of the same cluster never run concurrently.
+	MaxConcurrentReconciles int
+	// Backoff of retrying the failed reconciles of each cluster. The backoff
+	// of the controller's work queue is used if it is nil.
+	RetryRateLimiter workqueue.RateLimiter
+	// Preview the changes of the reconciles without applying them, see
+	// dryrun.go.
+	DryRun bool
+	// Records the changes of the child resources of the clusters, see
+	// audit.go, default: NoopAuditLogger. The changes previewed in dry-run
+	// mode are not recorded.
+	AuditLogger AuditLogger
+	// The service account the operator runs as, which is recorded as the
+	// actor of the audit events.
+	OperatorServiceAccount string
+	// The namespaces the Grafana dashboards may be created in, besides the
+	// namespaces of the clusters.
+	GrafanaDashboardNamespaces []string
+	// The hosts the webhooks of the success hooks may target at private and
+	// link-local addresses, e.g., services in the cluster.
+	WebhookAllowedHosts []string
+
+	backoff   RequeueBackoff
+	debouncer StatusDebouncer
+	batcher   StatusBatcher
+	specs     SpecTracker
+	sampler   MetricsSampler
+	poller    MetricsPoller
+
+	healthChecker ClusterHealthChecker
+
+	// The version of the Kubernetes API server, nil if it is unknown.
+	serverVersion *version.Version
 }
 
 // +kubebuilder:rbac:groups=flinkoperator.k8s.io,resources=flinkclusters,verbs=get;list;watch;create;update;patch;delete
 // +kubebuilder:rbac:groups=flinkoperator.k8s.io,resources=flinkclusters/status,verbs=get;update;patch
+// +kubebuilder:rbac:groups=flinkoperator.k8s.io,resources=flinkclustertemplates,verbs=get;list;watch
 // +kubebuilder:rbac:groups=apps,resources=deployments,verbs=get;list;watch;create;update;patch;delete
 // +kubebuilder:rbac:groups=apps,resources=deployments/status,verbs=get
-// +kubebuilder:rbac:groups=core,resources=pods,verbs=get;list;watch
+// +kubebuilder:rbac:groups=apps,resources=statefulsets,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups=apps,resources=statefulsets/status,verbs=get
+// +kubebuilder:rbac:groups=core,resources=pods,verbs=get;list;watch;create;update;patch;delete
 // +kubebuilder:rbac:groups=core,resources=pods/status,verbs=get
+// +kubebuilder:rbac:groups=core,resources=pods/log,verbs=get
+// +kubebuilder:rbac:groups=core,resources=pods/exec,verbs=create
 // +kubebuilder:rbac:groups=core,resources=services,verbs=get;list;watch;create;update;patch;delete
 // +kubebuilder:rbac:groups=core,resources=services/status,verbs=get
 // +kubebuilder:rbac:groups=core,resources=events,verbs=get;list;watch;create;update;patch;delete
 // +kubebuilder:rbac:groups=core,resources=events/status,verbs=get
 // +kubebuilder:rbac:groups=core,resources=configmaps,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups=core,resources=namespaces,verbs=get;list;watch
+// +kubebuilder:rbac:groups=core,resources=secrets,verbs=get
+// +kubebuilder:rbac:groups=core,resources=resourcequotas;limitranges,verbs=get;list;watch
 // +kubebuilder:rbac:groups=batch,resources=jobs,verbs=get;list;watch;create;update;patch;delete
 // +kubebuilder:rbac:groups=batch,resources=jobs/status,verbs=get
+// +kubebuilder:rbac:groups=batch,resources=cronjobs,verbs=get
 // +kubebuilder:rbac:groups=extensions,resources=ingresses,verbs=get;list;watch;create;update;patch;delete
 // +kubebuilder:rbac:groups=extensions,resources=ingresses/status,verbs=get
+// +kubebuilder:rbac:groups=core,resources=serviceaccounts,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups=core,resources=persistentvolumeclaims,verbs=get;list;watch;create
+// +kubebuilder:rbac:groups=rbac.authorization.k8s.io,resources=roles;rolebindings,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups=networking.k8s.io,resources=networkpolicies,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups=scheduling.k8s.io,resources=priorityclasses,verbs=get
+// +kubebuilder:rbac:groups=networking.istio.io,resources=virtualservices,verbs=get;list;watch;create;update;patch;delete
 
 // Reconcile the observed state towards the desired state for a FlinkCluster custom resource.
 func (reconciler *FlinkClusterReconciler) Reconcile(
 	request ctrl.Request) (ctrl.Result, error) {
 	var log = reconciler.Log.WithValues(
-		"cluster", request.NamespacedName)
+		"cluster", request.Name, "namespace", request.Namespace)
+	// The clusters in the other namespaces are neither observed nor is their
+	// status updated, even if an event of them got through the cache.
+	if !isNamespaceWatched(reconciler.WatchNamespaces, request.Namespace) {
+		log.Info(
+			"Ignore the custom resource.",
+			"watchNamespaces", reconciler.WatchNamespaces)
+		return ctrl.Result{}, nil
+	}
 	var handler = FlinkClusterHandler{
-		watchNamespace: reconciler.WatchNamespace,
-		k8sClient:      reconciler.Client,
-		flinkClient: flinkclient.FlinkClient{
-			Log:        log,
-			HTTPClient: flinkclient.HTTPClient{Log: log},
+		watchNamespaces: reconciler.WatchNamespaces,
+		k8sClient:       reconciler.Client,
+		apiReader:       reconciler.Mgr.GetAPIReader(),
+		flinkClient: flinkclient.NewFlinkClient(
+			log, reconciler.FlinkAPITimeout, reconciler.FlinkAPIMaxRetries),
+		request:   request,
+		context:   context.Background(),
+		log:       log,
+		recorder:  reconciler.Mgr.GetEventRecorderFor("FlinkOperator"),
+		observed:  ObservedClusterState{},
+		backoff:   &reconciler.backoff,
+		debouncer: &reconciler.debouncer,
+		batcher:   &reconciler.batcher,
+		specs:     &reconciler.specs,
+		sampler:   &reconciler.sampler,
+		poller:    &reconciler.poller,
+
+		healthChecker: &reconciler.healthChecker,
+		webhookSender: &httpWebhookSender{
+			allowedHosts: reconciler.WebhookAllowedHosts,
 		},
-		request:  request,
-		context:  context.Background(),
-		log:      log,
-		recorder: reconciler.Mgr.GetEventRecorderFor("FlinkOperator"),
-		observed: ObservedClusterState{},
+		quotaRequeueInterval: reconciler.QuotaRequeueInterval,
+		memoryPressureRatio:  reconciler.JobManagerMemoryPressureRatio,
+		operatorNamespace:    reconciler.OperatorNamespace,
+		serverVersion:        reconciler.serverVersion,
+
+		grafanaDashboardNamespaces: reconciler.GrafanaDashboardNamespaces,
 	}
-	return handler.reconcile(request)
+	if !reconciler.DryRun {
+		handler.k8sClient = &auditingClient{
+			Client:    handler.k8sClient,
+			logger:    reconciler.AuditLogger,
+			log:       log,
+			cluster:   request.Name,
+			namespace: request.Namespace,
+			actor: getAuditActor(
+				reconciler.OperatorNamespace, reconciler.OperatorServiceAccount),
+		}
+		var result, err = handler.reconcileAndRecover(request)
+		return reconciler.retryWithBackoff(request, result, err)
+	}
+
+	var plan = &dryRunPlan{log: log}
+	var recorder = handler.recorder
+	handler.k8sClient = &dryRunClient{Client: handler.k8sClient, plan: plan}
+	handler.flinkClient = &dryRunFlinkClient{
+		FlinkClient: handler.flinkClient, plan: plan}
+	handler.webhookSender = &dryRunWebhookSender{plan: plan}
+	handler.recorder = &dryRunEventRecorder{log: log}
+	var result, err = handler.reconcileAndRecover(request)
+	plan.report(recorder, handler.observed.cluster)
+	return reconciler.retryWithBackoff(request, result, err)
+}
+
+// Turns a failed reconcile into a requeue after the backoff of the cluster,
+// and resets the backoff after a successful reconcile.
+func (reconciler *FlinkClusterReconciler) retryWithBackoff(
+	request ctrl.Request, result ctrl.Result, err error) (ctrl.Result, error) {
+	var rateLimiter = reconciler.RetryRateLimiter
+	if rateLimiter == nil {
+		return result, err
+	}
+	if err != nil {
+		var retryAfter = rateLimiter.When(request)
+		reconciler.Log.Info(
+			"Retry the failed reconcile",
+			"cluster", request.Name,
+			"namespace", request.Namespace,
+			"after", retryAfter)
+		return ctrl.Result{Requeue: true, RequeueAfter: retryAfter}, nil
+	}
+	rateLimiter.Forget(request)
+	return result, nil
 }
 
 // SetupWithManager registers this reconciler with the controller manager and
-// starts watching FlinkCluster, Deployment and Service resources.
+// starts watching FlinkCluster, Deployment and Service resources, namespaces
+// whose labels might be inherited by the clusters, cluster templates and the
+// external Flink ConfigMaps referenced by `flinkConfigMap`. It
+// also adds the health checker of the clusters to the manager.
+// Namespaces are not watched with namespace-scoped RBAC, which can't grant
+// watching them.
 func (reconciler *FlinkClusterReconciler) SetupWithManager(
 	mgr ctrl.Manager) error {
 	reconciler.Mgr = mgr
-	return ctrl.NewControllerManagedBy(mgr).
+	reconciler.debouncer.Window = reconciler.StatusDebounceWindow
+	reconciler.batcher.Interval = reconciler.StatusBatchInterval
+	reconciler.sampler.Every = reconciler.JobManagerMetricsInterval
+	reconciler.poller.Interval = reconciler.MetricsPollInterval
+	reconciler.backoff.Policy = reconciler.RequeuePolicy
+	if reconciler.AuditLogger == nil {
+		reconciler.AuditLogger = NoopAuditLogger{}
+	}
+	reconciler.healthChecker = ClusterHealthChecker{
+		watchNamespaces: reconciler.WatchNamespaces,
+		k8sClient:       mgr.GetClient(),
+		apiReader:       mgr.GetAPIReader(),
+		flinkClient: flinkclient.NewFlinkClient(
+			reconciler.Log.WithName("HealthCheck"),
+			reconciler.FlinkAPITimeout,
+			reconciler.FlinkAPIMaxRetries),
+		recorder: mgr.GetEventRecorderFor("FlinkOperator"),
+		log:      reconciler.Log.WithName("HealthCheck"),
+		events:   make(chan event.GenericEvent, healthCheckEventBuffer),
+	}
+	if reconciler.DryRun {
+		reconciler.healthChecker.recorder = &dryRunEventRecorder{
+			log: reconciler.healthChecker.log}
+	}
+	var err = mgr.Add(&reconciler.healthChecker)
+	if err != nil {
+		return err
+	}
+	reconciler.serverVersion, err = getServerVersion(mgr.GetConfig())
+	if err != nil {
+		return err
+	}
+	var builder = ctrl.NewControllerManagedBy(mgr).
+		WithOptions(controller.Options{
+			MaxConcurrentReconciles: reconciler.MaxConcurrentReconciles,
+		}).
 		For(&v1beta1.FlinkCluster{}).
+		Owns(&v1beta1.FlinkCluster{}).
 		Owns(&appsv1.Deployment{}).
+		Owns(&appsv1.StatefulSet{}).
 		Owns(&corev1.Service{}).
 		Owns(&batchv1.Job{}).
-		Complete(reconciler)
+		Owns(&networkingv1.NetworkPolicy{}).
+		Watches(
+			&source.Kind{Type: &v1beta1.FlinkClusterTemplate{}},
+			&handler.EnqueueRequestsFromMapFunc{
+				ToRequests: handler.ToRequestsFunc(
+					reconciler.getClustersUsingTemplate),
+			}).
+		Watches(
+			&source.Kind{Type: &corev1.ConfigMap{}},
+			&handler.EnqueueRequestsFromMapFunc{
+				ToRequests: handler.ToRequestsFunc(
+					reconciler.getClustersUsingFlinkConfigMap),
+			}).
+		Watches(
+			&source.Channel{Source: reconciler.healthChecker.events},
+			&handler.EnqueueRequestForObject{})
+	if !reconciler.NamespaceScopedRBAC {
+		builder = builder.Watches(
+			&source.Kind{Type: &corev1.Namespace{}},
+			&handler.EnqueueRequestsFromMapFunc{
+				ToRequests: handler.ToRequestsFunc(
+					reconciler.getClustersInheritingLabels),
+			})
+	}
+	return builder.Complete(reconciler)
+}
+
+// Gets the reconcile requests of the clusters in the namespace which inherit
+// its labels.
+func (reconciler *FlinkClusterReconciler) getClustersInheritingLabels(
+	namespace handler.MapObject) []ctrl.Request {
+	if !isNamespaceWatched(
+		reconciler.WatchNamespaces, namespace.Meta.GetName()) {
+		return nil
+	}
+	var clusters = v1beta1.FlinkClusterList{}
+	var err = reconciler.Client.List(
+		context.Background(),
+		&clusters,
+		client.InNamespace(namespace.Meta.GetName()))
+	if err != nil {
+		reconciler.Log.Error(
+			err, "Failed to list clusters", "namespace", namespace.Meta.GetName())
+		return nil
+	}
+	var requests = []ctrl.Request{}
+	for _, cluster := range clusters.Items {
+		if len(cluster.Spec.InheritNamespaceLabels) == 0 {
+			continue
+		}
+		requests = append(requests, ctrl.Request{
+			NamespacedName: types.NamespacedName{
+				Namespace: cluster.Namespace,
+				Name:      cluster.Name,
+			},
+		})
+	}
+	return requests
+}
+
+// Gets the reconcile requests of the clusters which reference the template,
+// so that the updates of the template are applied to them.
+func (reconciler *FlinkClusterReconciler) getClustersUsingTemplate(
+	template handler.MapObject) []ctrl.Request {
+	var clusters = v1beta1.FlinkClusterList{}
+	var err = reconciler.Client.List(
+		context.Background(),
+		&clusters,
+		client.InNamespace(template.Meta.GetNamespace()))
+	if err != nil {
+		reconciler.Log.Error(
+			err, "Failed to list clusters", "namespace", template.Meta.GetNamespace())
+		return nil
+	}
+	var requests = []ctrl.Request{}
+	for _, cluster := range clusters.Items {
+		var templateRef = cluster.Spec.TemplateRef
+		if templateRef == nil || templateRef.Name != template.Meta.GetName() {
+			continue
+		}
+		requests = append(requests, ctrl.Request{
+			NamespacedName: types.NamespacedName{
+				Namespace: cluster.Namespace,
+				Name:      cluster.Name,
+			},
+		})
+	}
+	return requests
+}
+
+// Gets the reconcile requests of the clusters which reference the ConfigMap
+// as their external Flink config, so that its changes restart their pods.
+func (reconciler *FlinkClusterReconciler) getClustersUsingFlinkConfigMap(
+	configMap handler.MapObject) []ctrl.Request {
+	var clusters = v1beta1.FlinkClusterList{}
+	var err = reconciler.Client.List(
+		context.Background(),
+		&clusters,
+		client.InNamespace(configMap.Meta.GetNamespace()))
+	if err != nil {
+		reconciler.Log.Error(
+			err, "Failed to list clusters", "namespace", configMap.Meta.GetNamespace())
+		return nil
+	}
+	var requests = []ctrl.Request{}
+	for _, cluster := range clusters.Items {
+		if cluster.Spec.FlinkConfigMap != configMap.Meta.GetName() {
+			continue
+		}
+		requests = append(requests, ctrl.Request{
+			NamespacedName: types.NamespacedName{
+				Namespace: cluster.Namespace,
+				Name:      cluster.Name,
+			},
+		})
+	}
+	return requests
 }
 
 // FlinkClusterHandler holds the context and state for a
 // reconcile request.
 type FlinkClusterHandler struct {
-	watchNamespace string
-	k8sClient      client.Client
-	flinkClient    flinkclient.FlinkClient
-	request        ctrl.Request
-	context        context.Context
-	log            logr.Logger
-	recorder       record.EventRecorder
-	observed       ObservedClusterState
-	desired        DesiredClusterState
+	watchNamespaces []string
+	k8sClient       client.Client
+	apiReader       client.Reader
+	flinkClient     flinkclient.FlinkClient
+	webhookSender   webhookSender
+	request         ctrl.Request
+	context         context.Context
+	log             logr.Logger
+	recorder        record.EventRecorder
+	observed        ObservedClusterState
+	desired         DesiredClusterState
+	backoff         *RequeueBackoff
+	debouncer       *StatusDebouncer
+	batcher         *StatusBatcher
+	specs           *SpecTracker
+	sampler         *MetricsSampler
+	poller          *MetricsPoller
+	healthChecker   *ClusterHealthChecker
+
+	quotaRequeueInterval time.Duration
+	memoryPressureRatio  float64
+	operatorNamespace    string
+	serverVersion        *version.Version
+
+	grafanaDashboardNamespaces []string
+}
+
+// Runs the reconcile and recovers from its panics, e.g., a nil pointer in a
+// new code path of the updater, so that a broken cluster doesn't crash the
+// operator. The panic is logged with its stack trace and returned as an error,
+// and the cluster gets a Warning event and an internal error status message,
+// so that the problem shows up in `kubectl describe`.
+func (handler *FlinkClusterHandler) reconcileAndRecover(
+	request ctrl.Request) (result ctrl.Result, err error) {
+	defer func() {
+		var recovered = recover()
+		if recovered == nil {
+			return
+		}
+		err = fmt.Errorf("reconcile panicked: %v", recovered)
+		handler.log.Error(err, "Recovered from panic", "stack", string(debug.Stack()))
+		handler.reportInternalError()
+		result = ctrl.Result{}
+	}()
+	return handler.reconcile(request)
+}
+
+// Reports an internal error of the operator on the cluster. The status message
+// is derived again by the next successful reconcile.
+func (handler *FlinkClusterHandler) reportInternalError() {
+	var cluster = handler.observed.cluster
+	if cluster == nil {
+		return
+	}
+	handler.recorder.Event(
+		cluster,
+		"Warning",
+		"InternalError",
+		"The operator failed to reconcile the cluster, see its logs")
+	var updated = cluster.DeepCopy()
+	updated.Status.Message = internalErrorMessage
+	setTimestamp(&updated.Status.LastUpdateTime)
+	var err = handler.k8sClient.Status().Update(handler.context, updated)
+	if err != nil {
+		handler.log.Error(err, "Failed to report internal error in status")
+	}
 }
 
 func (handler *FlinkClusterHandler) reconcile(
@@ -115,10 +493,10 @@ func (handler *FlinkClusterHandler) reconcile(
 	var err error
 
 	log.Info("============================================================")
-	if handler.watchNamespace != "" &&
-		handler.watchNamespace != request.Namespace {
+	if !isNamespaceWatched(handler.watchNamespaces, request.Namespace) {
 		log.Info(
-			"Ignore the custom resource.", "watchNamespace", handler.watchNamespace)
+			"Ignore the custom resource.",
+			"watchNamespaces", handler.watchNamespaces)
 		return ctrl.Result{}, nil
 	}
 
@@ -126,16 +504,51 @@ func (handler *FlinkClusterHandler) reconcile(
 
 	var observer = ClusterStateObserver{
 		k8sClient:   k8sClient,
+		apiReader:   handler.apiReader,
 		flinkClient: flinkClient,
 		request:     request,
 		context:     context,
 		log:         log,
+
+		metricsSampler:   handler.sampler,
+		jobMetricsPoller: handler.poller,
+		healthChecker:    handler.healthChecker,
 	}
 	err = observer.observe(observed)
 	if err != nil {
 		log.Error(err, "Failed to observe the current state")
 		return ctrl.Result{}, err
 	}
+	// The observer configures the TLS of the Flink client for the cluster.
+	flinkClient = observer.flinkClient
+	if observed.cluster == nil {
+		handler.backoff.Forget(request.NamespacedName)
+		handler.debouncer.Forget(request.NamespacedName)
+		handler.specs.Forget(request.NamespacedName)
+		handler.sampler.Forget(request.NamespacedName)
+		handler.poller.Forget(request.NamespacedName)
+		handler.healthChecker.Forget(request.NamespacedName)
+		deleteBackpressureMetrics(request.NamespacedName)
+	} else {
+		// The UID correlates the logs of the same cluster across reconciles,
+		// even if it is deleted and recreated with the same name.
+		log = log.WithValues("uid", observed.cluster.UID)
+		handler.log = log
+	}
+	if observed.cluster != nil &&
+		observed.cluster.ObjectMeta.DeletionTimestamp != nil {
+		return handler.finalizeCluster(observed.cluster)
+	}
+	if observed.cluster != nil && observed.cluster.Spec.CloneFrom != nil {
+		return handler.cloneCluster(observed.cluster)
+	}
+	if observed.cluster != nil {
+		err = handler.getFinalizerManager().EnsureFinalizerAdded(
+			handler.context, observed.cluster, clusterFinalizer)
+		if err != nil {
+			return ctrl.Result{}, err
+		}
+	}
 
 	log.Info("---------- 2. Update cluster status ----------")
 
@@ -145,6 +558,10 @@ func (handler *FlinkClusterHandler) reconcile(
 		log:       handler.log,
 		recorder:  handler.recorder,
 		observed:  handler.observed,
+		debouncer: handler.debouncer,
+		batcher:   handler.batcher,
+
+		memoryPressureRatio: handler.memoryPressureRatio,
 	}
 	statusChanged, err = updater.updateStatusIfChanged()
 	if err != nil {
@@ -163,7 +580,55 @@ func (handler *FlinkClusterHandler) reconcile(
 
 	log.Info("---------- 3. Compute the desired state ----------")
 
-	*desired = getDesiredClusterState(observed.cluster, time.Now())
+	if observed.cluster != nil {
+		var lastSpec = handler.specs.Update(
+			request.NamespacedName, &observed.cluster.Spec)
+		if lastSpec != nil {
+			var diff = specDiff(*lastSpec, observed.cluster.Spec)
+			if len(diff) > 0 {
+				log.V(1).Info("Spec changed", "diff", diff)
+			}
+		}
+	}
+
+	// The desired state of an invalid spec is not computed, the reconciler
+	// only reports the validation errors. The desired state of a deleted
+	// cluster is empty.
+	if observed.cluster != nil && len(observed.specErrors) == 0 {
+		*desired = getDesiredClusterState(observed.cluster, time.Now())
+		var overridden = getOverriddenFlinkProperties(observed.cluster)
+		if len(overridden) > 0 {
+			log.Info(
+				"Warning: flinkProperties are overridden by checkpointConfig",
+				"properties", overridden)
+		}
+		addInheritedLabels(
+			desired, getInheritedLabels(observed.cluster, observed.namespace))
+		addFlinkConfigChecksum(desired, observed.flinkConfigMap)
+		addRestartedAt(desired, observed.cluster)
+		allowOperatorNamespace(
+			desired.NetworkPolicy, observed.cluster, handler.operatorNamespace)
+		// Without the name label of the namespaces, the policy would block
+		// the allowed namespaces and the operator, so it is not created.
+		if desired.NetworkPolicy != nil &&
+			usesNamespaceNameLabel(desired.NetworkPolicy) &&
+			!isNamespaceNameLabelSupported(handler.serverVersion) {
+			log.Info(
+				"Warning: the network policy is not created, selecting other "+
+					"namespaces requires Kubernetes 1.21+",
+				"serverVersion", handler.serverVersion.String())
+			desired.NetworkPolicy = nil
+		}
+		if desired.GrafanaDashboard != nil &&
+			!isGrafanaDashboardNamespaceAllowed(
+				observed.cluster, handler.grafanaDashboardNamespaces) {
+			log.Info(
+				"Warning: the Grafana dashboard is not created, its namespace "+
+					"is not allowed by --grafana-dashboard-namespaces",
+				"namespace", desired.GrafanaDashboard.Namespace)
+			desired.GrafanaDashboard = nil
+		}
+	}
 	if desired.ConfigMap != nil {
 		log.Info("Desired state", "ConfigMap", *desired.ConfigMap)
 	} else {
@@ -189,6 +654,11 @@ func (handler *FlinkClusterHandler) reconcile(
 	} else {
 		log.Info("Desired state", "TaskManager deployment", "nil")
 	}
+	if desired.TmStatefulSet != nil {
+		log.Info("Desired state", "TaskManager StatefulSet", *desired.TmStatefulSet)
+	} else {
+		log.Info("Desired state", "TaskManager StatefulSet", "nil")
+	}
 	if desired.Job != nil {
 		log.Info("Desired state", "Job", *desired.Job)
 	} else {
@@ -202,16 +672,83 @@ func (handler *FlinkClusterHandler) reconcile(
 		flinkClient: flinkClient,
 		context:     handler.context,
 		log:         handler.log,
+		recorder:    handler.recorder,
 		observed:    handler.observed,
 		desired:     handler.desired,
+
+		webhookSender:        handler.webhookSender,
+		quotaRequeueInterval: handler.quotaRequeueInterval,
 	}
 	result, err := reconciler.reconcile()
 	if err != nil {
 		log.Error(err, "Failed to reconcile")
 	}
+	// Keep polling the cluster even when no action is pending, more often in
+	// transitional states and less often in stable states. The interval
+	// follows the state just derived, which might not have been written.
+	if err == nil && result.RequeueAfter == 0 && observed.cluster != nil {
+		result = ctrl.Result{
+			Requeue: true,
+			RequeueAfter: handler.backoff.Next(
+				request.NamespacedName, updater.derivedState),
+		}
+	}
+	// Write the skipped status change when the debounce window or the
+	// batching interval ends.
+	if err == nil && updater.debounceRemaining > 0 &&
+		(result.RequeueAfter == 0 ||
+			result.RequeueAfter > updater.debounceRemaining) {
+		result = ctrl.Result{
+			Requeue: true, RequeueAfter: updater.debounceRemaining,
+		}
+	}
 	if result.RequeueAfter > 0 {
 		log.Info("Requeue reconcile request", "after", result.RequeueAfter)
 	}
 
 	return result, err
 }
+
+// Copies the spec and labels of the source cluster to a cluster created with
+// `cloneFrom`. No resources are created for the cluster until the clone is
+// applied.
+func (handler *FlinkClusterHandler) cloneCluster(
+	cluster *v1beta1.FlinkCluster) (ctrl.Result, error) {
+	var log = handler.log
+	var cloneFrom = cluster.Spec.CloneFrom
+	// Only clusters in the same namespace can be cloned, which is also
+	// enforced here in case the validating webhook is not deployed.
+	var sourceName = types.NamespacedName{
+		Namespace: cluster.Namespace,
+		Name:      cloneFrom.Name,
+	}
+	if len(cloneFrom.Namespace) > 0 && cloneFrom.Namespace != cluster.Namespace {
+		var err = fmt.Errorf(
+			"cloneFrom cluster must be in the namespace of the cluster: %v",
+			cloneFrom.Namespace)
+		log.Error(err, "Failed to clone cluster")
+		handler.recorder.Event(cluster, "Warning", "CloneFailed", err.Error())
+		return ctrl.Result{}, nil
+	}
+
+	var source = new(v1beta1.FlinkCluster)
+	var err = handler.k8sClient.Get(handler.context, sourceName, source)
+	if err != nil {
+		log.Error(err, "Failed to get the source cluster", "source", sourceName)
+		return ctrl.Result{}, err
+	}
+
+	var cloned = getClonedCluster(cluster, source)
+	log.Info("Cloning cluster", "source", sourceName)
+	err = handler.k8sClient.Update(handler.context, cloned)
+	if err != nil {
+		log.Error(err, "Failed to clone cluster", "source", sourceName)
+		return ctrl.Result{}, err
+	}
+	handler.recorder.Event(
+		cluster,
+		"Normal",
+		"Cloned",
+		fmt.Sprintf("Cloned from cluster %v", sourceName))
+	return ctrl.Result{}, nil
+}
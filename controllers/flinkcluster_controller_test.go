@@ -0,0 +1,292 @@
+/*
+Copyright 2019 Google LLC.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	v1beta1 "github.com/googlecloudplatform/flink-operator/api/v1beta1"
+	"gotest.tools/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/client-go/util/workqueue"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+func TestRetryWithBackoff(t *testing.T) {
+	var reconciler = FlinkClusterReconciler{
+		Log: log.Log,
+		RetryRateLimiter: workqueue.NewItemExponentialFailureRateLimiter(
+			1*time.Second, 4*time.Second),
+	}
+	var request = ctrl.Request{
+		NamespacedName: types.NamespacedName{
+			Namespace: "default", Name: "mycluster"}}
+	var failure = fmt.Errorf("conflict")
+
+	var result, err = reconciler.retryWithBackoff(request, ctrl.Result{}, failure)
+	assert.NilError(t, err)
+	assert.Equal(t, result.RequeueAfter, 1*time.Second)
+	result, err = reconciler.retryWithBackoff(request, ctrl.Result{}, failure)
+	assert.NilError(t, err)
+	assert.Equal(t, result.RequeueAfter, 2*time.Second)
+
+	// The backoff is reset by a successful reconcile.
+	var success = ctrl.Result{RequeueAfter: 60 * time.Second}
+	result, err = reconciler.retryWithBackoff(request, success, nil)
+	assert.NilError(t, err)
+	assert.Equal(t, result, success)
+	result, err = reconciler.retryWithBackoff(request, ctrl.Result{}, failure)
+	assert.NilError(t, err)
+	assert.Equal(t, result.RequeueAfter, 1*time.Second)
+
+	// The error is returned as is without a rate limiter.
+	reconciler.RetryRateLimiter = nil
+	_, err = reconciler.retryWithBackoff(request, ctrl.Result{}, failure)
+	assert.Equal(t, err, failure)
+}
+
+// Panics when a ConfigMap is read, i.e., after the cluster is observed.
+type panickingClient struct {
+	client.Client
+}
+
+func (c *panickingClient) Get(
+	ctx context.Context, key client.ObjectKey, obj runtime.Object) error {
+	if _, ok := obj.(*corev1.ConfigMap); ok {
+		panic("unexpected nil pointer")
+	}
+	return c.Client.Get(ctx, key, obj)
+}
+
+func TestReconcileRecoversFromPanic(t *testing.T) {
+	var cluster = getTestSessionCluster()
+	var testScheme = runtime.NewScheme()
+	assert.NilError(t, scheme.AddToScheme(testScheme))
+	assert.NilError(t, v1beta1.AddToScheme(testScheme))
+	var k8sClient = fake.NewFakeClientWithScheme(testScheme, cluster)
+	var recorder = record.NewFakeRecorder(10)
+	var request = ctrl.Request{
+		NamespacedName: types.NamespacedName{
+			Namespace: cluster.Namespace, Name: cluster.Name}}
+	var handler = FlinkClusterHandler{
+		k8sClient: &panickingClient{Client: k8sClient},
+		apiReader: k8sClient,
+		request:   request,
+		context:   context.Background(),
+		log:       log.Log,
+		recorder:  recorder,
+		backoff:   &RequeueBackoff{},
+		debouncer: &StatusDebouncer{},
+		specs:     &SpecTracker{},
+		sampler:   &MetricsSampler{},
+		poller:    &MetricsPoller{},
+
+		healthChecker: &ClusterHealthChecker{},
+	}
+
+	var _, err = handler.reconcileAndRecover(request)
+	assert.Assert(t, err != nil, "err is not expected to be nil")
+	assert.Equal(t, err.Error(), "reconcile panicked: unexpected nil pointer")
+	assert.Equal(
+		t,
+		<-recorder.Events,
+		"Warning InternalError The operator failed to reconcile the cluster, "+
+			"see its logs")
+	var updated = &v1beta1.FlinkCluster{}
+	err = k8sClient.Get(context.Background(), request.NamespacedName, updated)
+	assert.NilError(t, err)
+	assert.Equal(t, updated.Status.Message, internalErrorMessage)
+}
+
+func TestReconcileDeletedCluster(t *testing.T) {
+	var testScheme = runtime.NewScheme()
+	assert.NilError(t, scheme.AddToScheme(testScheme))
+	assert.NilError(t, v1beta1.AddToScheme(testScheme))
+	var k8sClient = fake.NewFakeClientWithScheme(testScheme)
+	var request = ctrl.Request{
+		NamespacedName: types.NamespacedName{
+			Namespace: "default", Name: "deleted"}}
+	var handler = FlinkClusterHandler{
+		k8sClient: k8sClient,
+		apiReader: k8sClient,
+		request:   request,
+		context:   context.Background(),
+		log:       log.Log,
+		recorder:  record.NewFakeRecorder(10),
+		backoff:   &RequeueBackoff{},
+		debouncer: &StatusDebouncer{},
+		specs:     &SpecTracker{},
+		sampler:   &MetricsSampler{},
+		poller:    &MetricsPoller{},
+
+		healthChecker: &ClusterHealthChecker{},
+	}
+
+	var result, err = handler.reconcileAndRecover(request)
+	assert.NilError(t, err)
+	assert.DeepEqual(t, result, ctrl.Result{})
+}
+
+func TestReconcileIgnoresUnwatchedNamespace(t *testing.T) {
+	var cluster = getTestSessionCluster()
+	cluster.Namespace = "team-b"
+	var testScheme = runtime.NewScheme()
+	assert.NilError(t, scheme.AddToScheme(testScheme))
+	assert.NilError(t, v1beta1.AddToScheme(testScheme))
+	var k8sClient = fake.NewFakeClientWithScheme(testScheme, cluster)
+	// Without a manager, the reconcile would panic if it got past the
+	// namespace check.
+	var reconciler = FlinkClusterReconciler{
+		Client:          k8sClient,
+		Log:             log.Log,
+		WatchNamespaces: []string{"team-a"},
+	}
+	var request = ctrl.Request{
+		NamespacedName: types.NamespacedName{
+			Namespace: cluster.Namespace, Name: cluster.Name}}
+
+	var result, err = reconciler.Reconcile(request)
+	assert.NilError(t, err)
+	assert.DeepEqual(t, result, ctrl.Result{})
+	var observed = &v1beta1.FlinkCluster{}
+	err = k8sClient.Get(context.Background(), request.NamespacedName, observed)
+	assert.NilError(t, err)
+	assert.DeepEqual(t, observed.Status, cluster.Status)
+}
+
+func TestSharedStateConcurrentReconciles(t *testing.T) {
+	var reconciler = FlinkClusterReconciler{
+		RetryRateLimiter: workqueue.NewItemExponentialFailureRateLimiter(
+			1*time.Second, 1000*time.Second),
+	}
+	var waitGroup sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		waitGroup.Add(1)
+		go func(i int) {
+			defer waitGroup.Done()
+			var cluster = types.NamespacedName{
+				Namespace: "default", Name: fmt.Sprintf("cluster-%d", i)}
+			var spec = v1beta1.FlinkClusterSpec{
+				Image: v1beta1.ImageSpec{Name: fmt.Sprintf("flink:1.%d", i)}}
+			for j := 0; j < 3; j++ {
+				reconciler.backoff.Next(cluster, v1beta1.ClusterStateCreating)
+				reconciler.specs.Update(cluster, &spec)
+				reconciler.RetryRateLimiter.When(ctrl.Request{NamespacedName: cluster})
+			}
+		}(i)
+	}
+	waitGroup.Wait()
+
+	for i := 0; i < 20; i++ {
+		var cluster = types.NamespacedName{
+			Namespace: "default", Name: fmt.Sprintf("cluster-%d", i)}
+		assert.Equal(
+			t,
+			reconciler.backoff.Next(cluster, v1beta1.ClusterStateCreating),
+			16*time.Second)
+		var lastSpec = reconciler.specs.Update(cluster, &v1beta1.FlinkClusterSpec{})
+		assert.Equal(t, lastSpec.Image.Name, fmt.Sprintf("flink:1.%d", i))
+		assert.Equal(
+			t,
+			reconciler.RetryRateLimiter.NumRequeues(ctrl.Request{NamespacedName: cluster}),
+			3)
+	}
+}
+
+// Observes the Flink API of many clusters with a number of workers, the
+// throughput grows with the workers because the observation mostly waits for
+// the JobManagers to respond, e.g.,
+// `go test ./controllers -run x -bench ConcurrentObserve`.
+func BenchmarkConcurrentObserve(b *testing.B) {
+	var server = httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			time.Sleep(5 * time.Millisecond)
+			fmt.Fprint(w, `{"taskmanagers": 2, "slots-total": 4}`)
+		}))
+	defer server.Close()
+	const clusters = 32
+
+	for _, workers := range []int{1, 4, 16} {
+		b.Run(fmt.Sprintf("workers=%d", workers), func(b *testing.B) {
+			for n := 0; n < b.N; n++ {
+				var queue = make(chan int, clusters)
+				for i := 0; i < clusters; i++ {
+					queue <- i
+				}
+				close(queue)
+				var waitGroup sync.WaitGroup
+				for w := 0; w < workers; w++ {
+					waitGroup.Add(1)
+					go func() {
+						defer waitGroup.Done()
+						var observer = newTestObserver()
+						for range queue {
+							var observed = ObservedClusterState{}
+							observer.observeFlinkOverview(server.URL, &observed)
+						}
+					}()
+				}
+				waitGroup.Wait()
+			}
+		})
+	}
+}
+
+func TestGetClustersUsingFlinkConfigMap(t *testing.T) {
+	var cluster = getTestSessionCluster()
+	cluster.Spec.FlinkConfigMap = "my-flink-config"
+	var other = getTestSessionCluster()
+	other.Name = "other"
+	var testScheme = runtime.NewScheme()
+	assert.NilError(t, scheme.AddToScheme(testScheme))
+	assert.NilError(t, v1beta1.AddToScheme(testScheme))
+	var reconciler = FlinkClusterReconciler{
+		Client: fake.NewFakeClientWithScheme(testScheme, cluster, other),
+		Log:    log.Log,
+	}
+	var configMap = &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: cluster.Namespace,
+			Name:      "my-flink-config",
+		},
+	}
+
+	var requests = reconciler.getClustersUsingFlinkConfigMap(
+		handler.MapObject{Meta: configMap, Object: configMap})
+	assert.DeepEqual(
+		t,
+		requests,
+		[]ctrl.Request{{NamespacedName: types.NamespacedName{
+			Namespace: cluster.Namespace,
+			Name:      cluster.Name,
+		}}})
+}
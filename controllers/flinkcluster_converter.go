@@ -17,12 +17,16 @@ limitations under the License.
 package controllers
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
 	"fmt"
 	"math"
 	"regexp"
 	"sort"
 	"strconv"
 	"strings"
+	"text/template"
 	"time"
 
 	"k8s.io/apimachinery/pkg/api/resource"
@@ -32,7 +36,11 @@ import (
 	batchv1 "k8s.io/api/batch/v1"
 	corev1 "k8s.io/api/core/v1"
 	extensionsv1beta1 "k8s.io/api/extensions/v1beta1"
+	networkingv1 "k8s.io/api/networking/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/apimachinery/pkg/util/intstr"
 )
 
@@ -45,24 +53,159 @@ const (
 	flinkConfigMapVolume            = "flink-config-volume"
 	gcpServiceAccountVolume         = "gcp-service-account-volume"
 	hadoopConfigVolume              = "hadoop-config-volume"
+	checkpointStorageVolume         = "checkpoint-storage-volume"
+	pythonRequirementsVolume        = "python-requirements-volume"
+	pythonRequirementsFile          = "requirements.txt"
+	pythonRequirementsPath          = "/opt/flink/job/python"
+	sqlJobVolume                    = "sql-job-volume"
+	sqlJobPath                      = "/opt/flink/job/sql"
+	ssoProxyConfigFile              = "oauth2-proxy.cfg"
+	ssoProxyConfigPath              = "/etc/oauth2-proxy"
+	ssoProxyPortName                = "sso-proxy"
+	ssoProxyPort              int32 = 4180
+	flinkLogVolume                  = "flink-log-volume"
+	flinkLogPath                    = "/opt/flink/log"
+	jmProxyConfigFile               = "nginx.conf"
+	jmProxyConfigPath               = "/etc/nginx/flink"
+	jmProxyPortName                 = "ui-proxy"
+	jobJarVolume                    = "job-jar-volume"
+	jarDownloaderContainer          = "download-jar"
+	zoneTopologyKey                 = "topology.kubernetes.io/zone"
+	nodeTopologyKey                 = "kubernetes.io/hostname"
+	// The annotation of the pod templates with the checksum of the data of
+	// the external Flink ConfigMap, which restarts the pods when it changes.
+	flinkConfigChecksumAnnotation = "flinkoperator.k8s.io/flink-config-checksum"
+	// The annotation of the cluster which restarts the pods when its value
+	// changes, e.g., to the current time, it is propagated to the pod
+	// templates like `kubectl rollout restart`.
+	restartedAtAnnotation = "flinkoperator.k8s.io/restartedAt"
+	// The annotation of the deployments and StatefulSets with the replicas
+	// last applied by the operator, which tells the replicas changed outside
+	// of the operator apart from the changes of the desired replicas.
+	appliedReplicasAnnotation = "flinkoperator.k8s.io/applied-replicas"
+	// The annotation of the resources with the keys of the labels inherited
+	// from the namespace, which tells the inherited labels removed from the
+	// namespace apart from the labels added outside of the operator.
+	inheritedLabelsAnnotation = "flinkoperator.k8s.io/inherited-labels"
+	// The port of the Flink REST server behind the JobManager proxy.
+	jmProxyUpstreamPort int32 = 18081
+	// The internal port of the JobManager service, on which the operator and
+	// the job submitter reach the Flink REST API without the proxy in front
+	// of the UI port.
+	jmRESTPortName       = "rest"
+	jmRESTPort     int32 = 18081
 )
 
+// The defaults of the probes of the Flink containers. The liveness probe is
+// lenient, so that a busy JobManager or TaskManager is not restarted, while
+// the readiness probe tells soon when Flink is serving.
+var defaultLivenessProbe = corev1.Probe{
+	TimeoutSeconds:      10,
+	InitialDelaySeconds: 30,
+	PeriodSeconds:       60,
+	FailureThreshold:    5,
+}
+var defaultReadinessProbe = corev1.Probe{
+	TimeoutSeconds:      5,
+	InitialDelaySeconds: 10,
+	PeriodSeconds:       10,
+	FailureThreshold:    3,
+}
+
+// The script of the init container downloading the job JAR.
+var jarDownloaderScript = `set -e
+case "$JAR_URI" in
+  gs://*) gsutil cp "$JAR_URI" "$JAR_FILE" ;;
+  s3://*) aws s3 cp "$JAR_URI" "$JAR_FILE" ;;
+  *) curl -s -f -L -o "$JAR_FILE" "$JAR_URI" ;;
+esac
+`
+
+// The default nginx.conf template of the JobManager proxy. Requests other than
+// GET to the endpoints for uploading JARs and submitting or modifying jobs are
+// rate-limited per client IP with a burst, GET requests, e.g., polling job
+// status by the operator, are not. With the WAF, requests with other methods
+// than those of the Flink REST API and requests whose URI contains common
+// attack patterns are rejected.
+var jmProxyDefaultConfigTemplate = `events {}
+http {
+  map $request_method $limit_key {
+    GET "";
+    HEAD "";
+    default $binary_remote_addr;
+  }
+  limit_req_zone $limit_key zone=flink_api:10m rate={{.RateLimitRPM}}r/m;
+  limit_req_status 429;
+  client_max_body_size 0;
+  server {
+    listen {{.ProxyPort}};
+{{- if .WAF}}
+    if ($request_method !~ ^(GET|HEAD|POST|PUT|PATCH|DELETE|OPTIONS)$) {
+      return 405;
+    }
+    if ($request_uri ~* "(\.\./|\.\.%2f|%2e%2e|<script|%3cscript|javascript:|union(\s|%20|\+)+select|/etc/passwd)") {
+      return 403;
+    }
+{{- end}}
+    location /jars/upload {
+      limit_req zone=flink_api burst={{.RateLimitBurst}} nodelay;
+      proxy_pass http://127.0.0.1:{{.UpstreamPort}};
+    }
+    location /jobs {
+      limit_req zone=flink_api burst={{.RateLimitBurst}} nodelay;
+      proxy_pass http://127.0.0.1:{{.UpstreamPort}};
+    }
+    location / {
+      proxy_pass http://127.0.0.1:{{.UpstreamPort}};
+    }
+  }
+}
+`
+
+// The GroupVersionKind of Istio VirtualService.
+var virtualServiceGVK = schema.GroupVersionKind{
+	Group:   "networking.istio.io",
+	Version: "v1alpha3",
+	Kind:    "VirtualService",
+}
+
 var flinkSysProps = map[string]struct{}{
 	"jobmanager.rpc.address": {},
 	"jobmanager.rpc.port":    {},
 	"blob.server.port":       {},
 	"query.server.port":      {},
 	"rest.port":              {},
+	"kubernetes.cluster-id":  {},
+	"kubernetes.namespace":   {},
 }
 
 // DesiredClusterState holds desired state of a cluster.
 type DesiredClusterState struct {
-	JmDeployment *appsv1.Deployment
-	JmService    *corev1.Service
-	JmIngress    *extensionsv1beta1.Ingress
-	TmDeployment *appsv1.Deployment
-	ConfigMap    *corev1.ConfigMap
-	Job          *batchv1.Job
+	JmDeployment   *appsv1.Deployment
+	JmService      *corev1.Service
+	JmIngress      *extensionsv1beta1.Ingress
+	TmDeployment   *appsv1.Deployment
+	TmStatefulSet  *appsv1.StatefulSet
+	TmPools        map[string]*appsv1.Deployment
+	ConfigMap      *corev1.ConfigMap
+	Job            *batchv1.Job
+	ClusterA       *v1beta1.FlinkCluster
+	ClusterB       *v1beta1.FlinkCluster
+	VirtualService *unstructured.Unstructured
+	ServiceAccount *corev1.ServiceAccount
+	Role           *rbacv1.Role
+	RoleBinding    *rbacv1.RoleBinding
+	CheckpointPVC  *corev1.PersistentVolumeClaim
+	DiagnosticsJob *batchv1.Job
+	NetworkPolicy  *networkingv1.NetworkPolicy
+
+	// The service account of the diagnostics bundle collector and its RBAC.
+	DiagnosticsServiceAccount *corev1.ServiceAccount
+	DiagnosticsRole           *rbacv1.Role
+	DiagnosticsRoleBinding    *rbacv1.RoleBinding
+
+	// The Grafana dashboard ConfigMap, which might be in another namespace.
+	GrafanaDashboard *corev1.ConfigMap
 }
 
 // Gets the desired state of a cluster.
@@ -73,13 +216,110 @@ func getDesiredClusterState(
 	if cluster == nil {
 		return DesiredClusterState{}
 	}
+	// In native mode, Flink deploys the JobManager and TaskManagers itself.
+	if isNativeMode(cluster) {
+		return DesiredClusterState{
+			ConfigMap:      getDesiredConfigMap(cluster),
+			Job:            getDesiredJob(cluster),
+			ServiceAccount: getDesiredServiceAccount(cluster),
+			Role:           getDesiredRole(cluster),
+			RoleBinding:    getDesiredRoleBinding(cluster),
+		}
+	}
 	return DesiredClusterState{
-		ConfigMap:    getDesiredConfigMap(cluster),
-		JmDeployment: getDesiredJobManagerDeployment(cluster),
-		JmService:    getDesiredJobManagerService(cluster),
-		JmIngress:    getDesiredJobManagerIngress(cluster),
-		TmDeployment: getDesiredTaskManagerDeployment(cluster),
-		Job:          getDesiredJob(cluster),
+		ConfigMap:      getDesiredConfigMap(cluster),
+		JmDeployment:   getDesiredJobManagerDeployment(cluster),
+		JmService:      getDesiredJobManagerService(cluster),
+		JmIngress:      getDesiredJobManagerIngress(cluster),
+		TmDeployment:   getDesiredTaskManagerDeployment(cluster),
+		TmStatefulSet:  getDesiredTaskManagerStatefulSet(cluster),
+		TmPools:        getDesiredTaskManagerPoolDeployments(cluster),
+		Job:            getDesiredJob(cluster),
+		ClusterA:       getDesiredVersionCluster(cluster, "a"),
+		ClusterB:       getDesiredVersionCluster(cluster, "b"),
+		VirtualService: getDesiredVirtualService(cluster),
+		ServiceAccount: getDesiredServiceAccount(cluster),
+		Role:           getDesiredRole(cluster),
+		RoleBinding:    getDesiredRoleBinding(cluster),
+		CheckpointPVC:  getDesiredCheckpointPVC(cluster),
+		DiagnosticsJob: getDesiredDiagnosticsJob(cluster, now),
+		NetworkPolicy:  getDesiredNetworkPolicy(cluster),
+
+		DiagnosticsServiceAccount: getDesiredDiagnosticsServiceAccount(cluster),
+		DiagnosticsRole:           getDesiredDiagnosticsRole(cluster),
+		DiagnosticsRoleBinding:    getDesiredDiagnosticsRoleBinding(cluster),
+
+		GrafanaDashboard: getDesiredGrafanaDashboard(cluster),
+	}
+}
+
+// Adds the labels inherited from the namespace to the desired resources and
+// the pod templates, and records their keys in an annotation of the resources.
+// The label maps are replaced rather than modified, because they might be
+// shared with the selectors.
+func addInheritedLabels(
+	desired *DesiredClusterState, inheritedLabels map[string]string) {
+	if len(inheritedLabels) == 0 {
+		return
+	}
+	var objects = []metav1.Object{}
+	for _, deployment := range []*appsv1.Deployment{
+		desired.JmDeployment, desired.TmDeployment} {
+		if deployment != nil {
+			objects = append(objects, deployment, &deployment.Spec.Template)
+		}
+	}
+	for _, deployment := range desired.TmPools {
+		objects = append(objects, deployment, &deployment.Spec.Template)
+	}
+	if desired.TmStatefulSet != nil {
+		objects = append(
+			objects, desired.TmStatefulSet, &desired.TmStatefulSet.Spec.Template)
+	}
+	if desired.Job != nil {
+		objects = append(objects, desired.Job, &desired.Job.Spec.Template)
+	}
+	if desired.JmService != nil {
+		objects = append(objects, desired.JmService)
+	}
+	if desired.JmIngress != nil {
+		objects = append(objects, desired.JmIngress)
+	}
+	if desired.ConfigMap != nil {
+		objects = append(objects, desired.ConfigMap)
+	}
+	if desired.VirtualService != nil {
+		objects = append(objects, desired.VirtualService)
+	}
+	if desired.ServiceAccount != nil {
+		objects = append(objects, desired.ServiceAccount)
+	}
+	if desired.Role != nil {
+		objects = append(objects, desired.Role)
+	}
+	if desired.RoleBinding != nil {
+		objects = append(objects, desired.RoleBinding)
+	}
+	if desired.CheckpointPVC != nil {
+		objects = append(objects, desired.CheckpointPVC)
+	}
+	if desired.NetworkPolicy != nil {
+		objects = append(objects, desired.NetworkPolicy)
+	}
+	var keys = make([]string, 0, len(inheritedLabels))
+	for key := range inheritedLabels {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, obj := range objects {
+		obj.SetLabels(mergeLabels(obj.GetLabels(), inheritedLabels))
+		if _, ok := obj.(*corev1.PodTemplateSpec); !ok {
+			obj.SetAnnotations(mergeLabels(
+				obj.GetAnnotations(),
+				map[string]string{
+					inheritedLabelsAnnotation: strings.Join(keys, ","),
+				}))
+		}
 	}
 }
 
@@ -93,6 +333,7 @@ func getDesiredJobManagerDeployment(
 
 	var clusterNamespace = flinkCluster.ObjectMeta.Namespace
 	var clusterName = flinkCluster.ObjectMeta.Name
+	var namer = NewResourceNamer(flinkCluster)
 	var clusterSpec = flinkCluster.Spec
 	var imageSpec = clusterSpec.Image
 	var jobManagerSpec = clusterSpec.JobManager
@@ -100,7 +341,11 @@ func getDesiredJobManagerDeployment(
 	var blobPort = corev1.ContainerPort{Name: "blob", ContainerPort: *jobManagerSpec.Ports.Blob}
 	var queryPort = corev1.ContainerPort{Name: "query", ContainerPort: *jobManagerSpec.Ports.Query}
 	var uiPort = corev1.ContainerPort{Name: "ui", ContainerPort: *jobManagerSpec.Ports.UI}
-	var jobManagerDeploymentName = getJobManagerDeploymentName(clusterName)
+	// With the proxy, the Flink REST server listens on an internal port.
+	if clusterSpec.JobManagerProxy != nil {
+		uiPort.ContainerPort = jmProxyUpstreamPort
+	}
+	var jobManagerDeploymentName = namer.JobManagerDeploymentName()
 	var labels = map[string]string{
 		"cluster":   clusterName,
 		"app":       "flink",
@@ -111,7 +356,7 @@ func getDesiredJobManagerDeployment(
 	var volumeMounts []corev1.VolumeMount
 	var confVol *corev1.Volume
 	var confMount *corev1.VolumeMount
-	confVol, confMount = convertFlinkConfig(clusterName)
+	confVol, confMount = convertFlinkConfig(flinkCluster)
 	volumes = append(jobManagerSpec.Volumes, *confVol)
 	volumeMounts = append(jobManagerSpec.VolumeMounts, *confMount)
 	var envVars = []corev1.EnvVar{
@@ -136,17 +381,36 @@ func getDesiredJobManagerDeployment(
 			},
 		},
 	}
-	var probe = corev1.Probe{
-		Handler: corev1.Handler{
+	// The liveness probe checks the RPC port, so that a JobManager whose REST
+	// API is slow is not restarted. The readiness probe requests the config
+	// from the REST API, which is only served once the JobManager is up. The
+	// kubelet has no client certificate, so the REST port is only checked to
+	// accept connections when the REST API requires client authentication.
+	var readinessHandler = corev1.Handler{
+		HTTPGet: &corev1.HTTPGetAction{
+			Path:   "/config",
+			Port:   intstr.FromInt(int(uiPort.ContainerPort)),
+			Scheme: corev1.URISchemeHTTP,
+		},
+	}
+	if clusterSpec.Security != nil && clusterSpec.Security.RESTTLS != nil {
+		readinessHandler.HTTPGet.Scheme = corev1.URISchemeHTTPS
+	}
+	if isRESTClientAuthEnabled(&clusterSpec) {
+		readinessHandler = corev1.Handler{
+			TCPSocket: &corev1.TCPSocketAction{
+				Port: intstr.FromInt(int(uiPort.ContainerPort)),
+			},
+		}
+	}
+	var livenessProbe, readinessProbe = convertProbes(
+		corev1.Handler{
 			TCPSocket: &corev1.TCPSocketAction{
 				Port: intstr.FromInt(int(*jobManagerSpec.Ports.RPC)),
 			},
 		},
-		TimeoutSeconds:      10,
-		InitialDelaySeconds: 30,
-		PeriodSeconds:       60,
-		FailureThreshold:    5,
-	}
+		readinessHandler,
+		jobManagerSpec.Probes)
 
 	// Hadoop config.
 	var hcVolume, hcMount, hcEnv = convertHadoopConfig(clusterSpec.HadoopConfig)
@@ -160,6 +424,13 @@ func getDesiredJobManagerDeployment(
 		envVars = append(envVars, *hcEnv)
 	}
 
+	// Checkpoint storage.
+	var csVolume, csMount = convertCheckpointStorage(clusterSpec.CheckpointStorage)
+	if csVolume != nil {
+		volumes = append(volumes, *csVolume)
+		volumeMounts = append(volumeMounts, *csMount)
+	}
+
 	// GCP service account config.
 	var saVolume, saMount, saEnv = convertGCPConfig(clusterSpec.GCPConfig)
 	if saVolume != nil {
@@ -172,26 +443,87 @@ func getDesiredJobManagerDeployment(
 		envVars = append(envVars, *saEnv)
 	}
 
+	// Extra classpath.
+	var classPathEnv = convertExtraClassPath(&clusterSpec)
+	if classPathEnv != nil {
+		envVars = append(envVars, *classPathEnv)
+	}
+
+	// Job JAR downloader.
+	var initContainers []corev1.Container
+	var jarDownloader, jarVolume, jarMount = convertJarDownloader(
+		clusterSpec.Job, clusterSpec.GCPConfig)
+	if jarDownloader != nil {
+		initContainers = append(initContainers, *jarDownloader)
+		volumes = append(volumes, *jarVolume)
+		volumeMounts = append(volumeMounts, *jarMount)
+	}
+
+	// With Kubernetes high availability, each JobManager binds to its pod IP,
+	// which is the leader address published to the TaskManagers and clients,
+	// instead of the service shared with the standby JobManagers.
+	var args = []string{"jobmanager"}
+	if v1beta1.IsKubernetesHAEnabled(clusterSpec.FlinkProperties) {
+		envVars = append(envVars, corev1.EnvVar{
+			Name: "POD_IP",
+			ValueFrom: &corev1.EnvVarSource{
+				FieldRef: &corev1.ObjectFieldSelector{FieldPath: "status.podIP"},
+			},
+		})
+		args = append(args, "$(POD_IP)")
+	}
+
 	envVars = append(envVars, flinkCluster.Spec.EnvVars...)
+	envVars = append(envVars, jobManagerSpec.Env...)
+	var containers = []corev1.Container{corev1.Container{
+		Name:            "jobmanager",
+		Image:           imageSpec.Name,
+		ImagePullPolicy: imageSpec.PullPolicy,
+		Args:            args,
+		Ports: []corev1.ContainerPort{
+			rpcPort, blobPort, queryPort, uiPort},
+		LivenessProbe:  livenessProbe,
+		ReadinessProbe: readinessProbe,
+		Resources:      jobManagerSpec.Resources,
+		Env:            envVars,
+		EnvFrom:        jobManagerSpec.EnvFrom,
+		VolumeMounts:   volumeMounts,
+		Lifecycle:      getJobManagerLifecycle(),
+	}}
+
+	// SSO proxy.
+	var ssoProxy = convertSSOProxy(clusterSpec.Security)
+	if ssoProxy != nil {
+		containers = append(containers, *ssoProxy)
+	}
+
+	// JobManager proxy.
+	var jmProxy = convertJobManagerProxy(
+		clusterSpec.JobManagerProxy, *jobManagerSpec.Ports.UI)
+	if jmProxy != nil {
+		containers = append(containers, *jmProxy)
+	}
+
 	var podSpec = corev1.PodSpec{
-		Containers: []corev1.Container{
-			corev1.Container{
-				Name:            "jobmanager",
-				Image:           imageSpec.Name,
-				ImagePullPolicy: imageSpec.PullPolicy,
-				Args:            []string{"jobmanager"},
-				Ports: []corev1.ContainerPort{
-					rpcPort, blobPort, queryPort, uiPort},
-				LivenessProbe:  &probe,
-				ReadinessProbe: &probe,
-				Resources:      jobManagerSpec.Resources,
-				Env:            envVars,
-				VolumeMounts:   volumeMounts,
-			},
-		},
-		Volumes:          volumes,
-		NodeSelector:     jobManagerSpec.NodeSelector,
-		ImagePullSecrets: imageSpec.PullSecrets,
+		InitContainers:     initContainers,
+		Containers:         containers,
+		Volumes:            volumes,
+		NodeSelector:       jobManagerSpec.NodeSelector,
+		Affinity:           jobManagerSpec.Affinity,
+		Tolerations:        jobManagerSpec.Tolerations,
+		PriorityClassName:  jobManagerSpec.PriorityClassName,
+		ImagePullSecrets:   imageSpec.PullSecrets,
+		ServiceAccountName: getServiceAccountName(clusterSpec.ServiceAccount),
+	}
+	addSidecars(&podSpec, jobManagerSpec.Sidecars)
+	if jobManagerSpec.GracefulShutdownTimeout != nil {
+		var gracePeriod = int64(
+			jobManagerSpec.GracefulShutdownTimeout.Duration.Seconds())
+		podSpec.TerminationGracePeriodSeconds = &gracePeriod
+	}
+	var replicas = jobManagerSpec.Replicas
+	if clusterSpec.Suspend {
+		replicas = new(int32)
 	}
 	var jobManagerDeployment = &appsv1.Deployment{
 		ObjectMeta: metav1.ObjectMeta{
@@ -201,7 +533,7 @@ func getDesiredJobManagerDeployment(
 			Labels:          labels,
 		},
 		Spec: appsv1.DeploymentSpec{
-			Replicas: jobManagerSpec.Replicas,
+			Replicas: replicas,
 			Selector: &metav1.LabelSelector{MatchLabels: labels},
 			Template: corev1.PodTemplateSpec{
 				ObjectMeta: metav1.ObjectMeta{
@@ -214,6 +546,87 @@ func getDesiredJobManagerDeployment(
 	return jobManagerDeployment
 }
 
+// Converts the probes spec to the liveness and readiness probes of a Flink
+// container with the given handlers, the unspecified thresholds take the
+// defaults of the probes.
+func convertProbes(
+	livenessHandler corev1.Handler,
+	readinessHandler corev1.Handler,
+	probes *v1beta1.ProbesSpec) (*corev1.Probe, *corev1.Probe) {
+	var liveness, readiness *v1beta1.ProbeThresholds
+	if probes != nil {
+		liveness = probes.Liveness
+		readiness = probes.Readiness
+	}
+	return convertProbe(livenessHandler, liveness, defaultLivenessProbe),
+		convertProbe(readinessHandler, readiness, defaultReadinessProbe)
+}
+
+// Checks whether the Flink REST API requires client certificates, i.e.,
+// mutual TLS with `security.ssl.rest.authentication-enabled`.
+func isRESTClientAuthEnabled(clusterSpec *v1beta1.FlinkClusterSpec) bool {
+	var value = clusterSpec.FlinkProperties["security.ssl.rest.authentication-enabled"]
+	return strings.EqualFold(strings.TrimSpace(value), "true")
+}
+
+func convertProbe(
+	handler corev1.Handler,
+	thresholds *v1beta1.ProbeThresholds,
+	defaults corev1.Probe) *corev1.Probe {
+	var probe = defaults
+	probe.Handler = handler
+	if thresholds == nil {
+		return &probe
+	}
+	if thresholds.InitialDelaySeconds != nil {
+		probe.InitialDelaySeconds = *thresholds.InitialDelaySeconds
+	}
+	if thresholds.PeriodSeconds != nil {
+		probe.PeriodSeconds = *thresholds.PeriodSeconds
+	}
+	if thresholds.TimeoutSeconds != nil {
+		probe.TimeoutSeconds = *thresholds.TimeoutSeconds
+	}
+	if thresholds.FailureThreshold != nil {
+		probe.FailureThreshold = *thresholds.FailureThreshold
+	}
+	return &probe
+}
+
+// Gets the lifecycle of the JobManager container, which stops the JobManager
+// and waits a while for it to hand off leadership before the container is
+// killed.
+func getJobManagerLifecycle() *corev1.Lifecycle {
+	return &corev1.Lifecycle{
+		PreStop: &corev1.Handler{
+			Exec: &corev1.ExecAction{
+				Command: []string{
+					"/bin/sh", "-c", "bin/jobmanager.sh stop; sleep 10"},
+			},
+		},
+	}
+}
+
+// Whether the TaskManagers can be started with their pod names as resource
+// IDs, i.e., with `taskmanager.resource-id` of Flink 1.12 or later.
+func isTaskManagerResourceIDSupported(clusterSpec *v1beta1.FlinkClusterSpec) bool {
+	var major, minor int
+	var _, err = fmt.Sscanf(clusterSpec.FlinkVersion, "%d.%d", &major, &minor)
+	return err == nil && (major > 1 || (major == 1 && minor >= 12))
+}
+
+// Gets the lifecycle of the TaskManager container, which stops the
+// TaskManager before the container is killed, so that it shuts down cleanly.
+func getTaskManagerLifecycle() *corev1.Lifecycle {
+	return &corev1.Lifecycle{
+		PreStop: &corev1.Handler{
+			Exec: &corev1.ExecAction{
+				Command: []string{"/bin/sh", "-c", "bin/taskmanager.sh stop"},
+			},
+		},
+	}
+}
+
 // Gets the desired JobManager service spec from a cluster spec.
 func getDesiredJobManagerService(
 	flinkCluster *v1beta1.FlinkCluster) *corev1.Service {
@@ -224,6 +637,7 @@ func getDesiredJobManagerService(
 
 	var clusterNamespace = flinkCluster.ObjectMeta.Namespace
 	var clusterName = flinkCluster.ObjectMeta.Name
+	var namer = NewResourceNamer(flinkCluster)
 	var jobManagerSpec = flinkCluster.Spec.JobManager
 	var rpcPort = corev1.ServicePort{
 		Name:       "rpc",
@@ -241,7 +655,21 @@ func getDesiredJobManagerService(
 		Name:       "ui",
 		Port:       *jobManagerSpec.Ports.UI,
 		TargetPort: intstr.FromString("ui")}
-	var jobManagerServiceName = getJobManagerServiceName(clusterName)
+	// With SSO, the UI and REST API are only accessible through the proxy.
+	if isSSOEnabled(flinkCluster.Spec.Security) {
+		uiPort.TargetPort = intstr.FromString(ssoProxyPortName)
+	}
+	if flinkCluster.Spec.JobManagerProxy != nil {
+		uiPort.TargetPort = intstr.FromString(jmProxyPortName)
+	}
+	var ports = []corev1.ServicePort{rpcPort, blobPort, queryPort, uiPort}
+	if isJobManagerUIProxied(flinkCluster) {
+		ports = append(ports, corev1.ServicePort{
+			Name:       jmRESTPortName,
+			Port:       jmRESTPort,
+			TargetPort: intstr.FromString("ui")})
+	}
+	var jobManagerServiceName = namer.JobManagerServiceName()
 	var labels = map[string]string{
 		"cluster":   clusterName,
 		"app":       "flink",
@@ -257,7 +685,7 @@ func getDesiredJobManagerService(
 		},
 		Spec: corev1.ServiceSpec{
 			Selector: labels,
-			Ports:    []corev1.ServicePort{rpcPort, blobPort, queryPort, uiPort},
+			Ports:    ports,
 		},
 	}
 	// This implementation is specific to GKE, see details at
@@ -295,9 +723,10 @@ func getDesiredJobManagerIngress(
 
 	var clusterNamespace = flinkCluster.ObjectMeta.Namespace
 	var clusterName = flinkCluster.ObjectMeta.Name
-	var jobManagerServiceName = getJobManagerServiceName(clusterName)
+	var namer = NewResourceNamer(flinkCluster)
+	var jobManagerServiceName = namer.JobManagerServiceName()
 	var jobManagerServiceUIPort = intstr.FromString("ui")
-	var ingressName = getJobManagerIngressName(clusterName)
+	var ingressName = namer.JobManagerIngressName()
 	var ingressAnnotations = jobManagerIngressSpec.Annotations
 	var ingressHost string
 	var ingressTLS []extensionsv1beta1.IngressTLS
@@ -360,33 +789,131 @@ func getDesiredJobManagerIngress(
 func getDesiredTaskManagerDeployment(
 	flinkCluster *v1beta1.FlinkCluster) *appsv1.Deployment {
 
-	if shouldCleanup(flinkCluster, "TaskManagerDeployment") {
+	if shouldCleanup(flinkCluster, "TaskManagerDeployment") ||
+		len(flinkCluster.Spec.TaskManager.VolumeClaimTemplates) > 0 {
+		return nil
+	}
+
+	return convertTaskManagerDeployment(flinkCluster, nil)
+}
+
+// Gets the desired TaskManager StatefulSet spec from a cluster spec, only when
+// the TaskManagers have volume claim templates. The pods are the same as those
+// of the deployment otherwise.
+func getDesiredTaskManagerStatefulSet(
+	flinkCluster *v1beta1.FlinkCluster) *appsv1.StatefulSet {
+	var claimTemplates = flinkCluster.Spec.TaskManager.VolumeClaimTemplates
+	if len(claimTemplates) == 0 ||
+		shouldCleanup(flinkCluster, "TaskManagerDeployment") {
+		return nil
+	}
+
+	var deployment = convertTaskManagerDeployment(flinkCluster, nil)
+	var statefulSetName = NewResourceNamer(flinkCluster).TaskManagerStatefulSetName()
+	var volumeClaimTemplates []corev1.PersistentVolumeClaim
+	for _, claimTemplate := range claimTemplates {
+		var claim = claimTemplate.DeepCopy()
+		claim.Labels = mergeLabels(claim.Labels, deployment.Labels)
+		volumeClaimTemplates = append(volumeClaimTemplates, *claim)
+	}
+	return &appsv1.StatefulSet{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace:       deployment.Namespace,
+			Name:            statefulSetName,
+			OwnerReferences: deployment.OwnerReferences,
+			Labels:          deployment.Labels,
+		},
+		Spec: appsv1.StatefulSetSpec{
+			Replicas: deployment.Spec.Replicas,
+			// The TaskManagers register with the JobManager by IP, so the
+			// governing service is not created.
+			ServiceName: statefulSetName,
+			// The TaskManagers don't depend on each other, so they are
+			// started and stopped all at once.
+			PodManagementPolicy:  appsv1.ParallelPodManagement,
+			Selector:             deployment.Spec.Selector,
+			Template:             deployment.Spec.Template,
+			VolumeClaimTemplates: volumeClaimTemplates,
+		},
+	}
+}
+
+// Gets the desired deployments of the additional TaskManager pools from a
+// cluster spec, keyed by pool name.
+func getDesiredTaskManagerPoolDeployments(
+	flinkCluster *v1beta1.FlinkCluster) map[string]*appsv1.Deployment {
+	var pools = flinkCluster.Spec.TaskManager.Pools
+	if len(pools) == 0 ||
+		shouldCleanup(flinkCluster, "TaskManagerDeployment") {
 		return nil
 	}
 
+	var deployments = map[string]*appsv1.Deployment{}
+	for i := range pools {
+		deployments[pools[i].Name] =
+			convertTaskManagerDeployment(flinkCluster, &pools[i])
+	}
+	return deployments
+}
+
+// Converts the TaskManager spec to the deployment of the default TaskManagers
+// if pool is nil, or of the TaskManagers in the pool otherwise.
+func convertTaskManagerDeployment(
+	flinkCluster *v1beta1.FlinkCluster,
+	pool *v1beta1.TaskManagerPoolSpec) *appsv1.Deployment {
 	var clusterNamespace = flinkCluster.ObjectMeta.Namespace
 	var clusterName = flinkCluster.ObjectMeta.Name
+	var namer = NewResourceNamer(flinkCluster)
 	var clusterSpec = flinkCluster.Spec
 	var imageSpec = flinkCluster.Spec.Image
 	var taskManagerSpec = flinkCluster.Spec.TaskManager
 	var dataPort = corev1.ContainerPort{Name: "data", ContainerPort: *taskManagerSpec.Ports.Data}
 	var rpcPort = corev1.ContainerPort{Name: "rpc", ContainerPort: *taskManagerSpec.Ports.RPC}
 	var queryPort = corev1.ContainerPort{Name: "query", ContainerPort: *taskManagerSpec.Ports.Query}
-	var taskManagerDeploymentName = getTaskManagerDeploymentName(clusterName)
+	var taskManagerDeploymentName = namer.TaskManagerDeploymentName()
 	var labels = map[string]string{
 		"cluster":   clusterName,
 		"app":       "flink",
 		"component": "taskmanager",
 	}
+	var replicas = getTaskManagerReplicas(flinkCluster)
+	// The replicas of the spec, which decide the pod template, so that
+	// autoscaling and suspension don't roll the pods.
+	var specReplicas = taskManagerSpec.Replicas
+	if taskManagerSpec.MaxReplicas != nil &&
+		*taskManagerSpec.MaxReplicas > specReplicas {
+		specReplicas = *taskManagerSpec.MaxReplicas
+	}
+	var resources = taskManagerSpec.Resources
+	var nodeSelector = taskManagerSpec.NodeSelector
+	if pool != nil {
+		taskManagerDeploymentName =
+			namer.TaskManagerPoolDeploymentName(pool.Name)
+		labels["pool"] = pool.Name
+		replicas = pool.Replicas
+		specReplicas = pool.Replicas
+		if pool.Resources != nil {
+			resources = *pool.Resources
+		}
+		if pool.NodeSelector != nil {
+			nodeSelector = pool.NodeSelector
+		}
+	}
 	// Make Volume, VolumeMount to use configMap data for flink-conf.yaml
 	var volumes []corev1.Volume
 	var volumeMounts []corev1.VolumeMount
 
 	// Flink config.
-	var confVol, confMount = convertFlinkConfig(clusterName)
+	var confVol, confMount = convertFlinkConfig(flinkCluster)
 	volumes = append(taskManagerSpec.Volumes, *confVol)
 	volumeMounts = append(taskManagerSpec.VolumeMounts, *confMount)
 
+	// Ephemeral volumes, e.g., a tmpfs for the local state of RocksDB.
+	var edVolumes, edMounts = convertEmptyDirVolumes(
+		taskManagerSpec.EmptyDirVolumes)
+	volumes = append(volumes, edVolumes...)
+	volumeMounts = append(volumeMounts, edMounts...)
+
 	var envVars = []corev1.EnvVar{
 		{
 			Name: "TASK_MANAGER_CPU_LIMIT",
@@ -409,17 +936,13 @@ func getDesiredTaskManagerDeployment(
 			},
 		},
 	}
-	var probe = corev1.Probe{
-		Handler: corev1.Handler{
-			TCPSocket: &corev1.TCPSocketAction{
-				Port: intstr.FromInt(int(*taskManagerSpec.Ports.RPC)),
-			},
+	var tmProbeHandler = corev1.Handler{
+		TCPSocket: &corev1.TCPSocketAction{
+			Port: intstr.FromInt(int(*taskManagerSpec.Ports.RPC)),
 		},
-		TimeoutSeconds:      10,
-		InitialDelaySeconds: 30,
-		PeriodSeconds:       60,
-		FailureThreshold:    5,
 	}
+	var livenessProbe, readinessProbe = convertProbes(
+		tmProbeHandler, tmProbeHandler, taskManagerSpec.Probes)
 
 	// Hadoop config.
 	var hcVolume, hcMount, hcEnv = convertHadoopConfig(clusterSpec.HadoopConfig)
@@ -433,6 +956,13 @@ func getDesiredTaskManagerDeployment(
 		envVars = append(envVars, *hcEnv)
 	}
 
+	// Checkpoint storage.
+	var csVolume, csMount = convertCheckpointStorage(clusterSpec.CheckpointStorage)
+	if csVolume != nil {
+		volumes = append(volumes, *csVolume)
+		volumeMounts = append(volumeMounts, *csMount)
+	}
+
 	// GCP service account config.
 	var saVolume, saMount, saEnv = convertGCPConfig(clusterSpec.GCPConfig)
 	if saVolume != nil {
@@ -444,27 +974,83 @@ func getDesiredTaskManagerDeployment(
 	if saEnv != nil {
 		envVars = append(envVars, *saEnv)
 	}
+
+	// Extra classpath.
+	var classPathEnv = convertExtraClassPath(&clusterSpec)
+	if classPathEnv != nil {
+		envVars = append(envVars, *classPathEnv)
+	}
+
+	// Heap size of the pool, which overrides the one in flink-conf.yaml
+	// calculated from the default TaskManager resources.
+	if pool != nil && pool.Resources != nil {
+		var heapEnv = convertTaskManagerPoolHeapSize(
+			&taskManagerSpec, pool.Resources)
+		if heapEnv != nil {
+			envVars = append(envVars, *heapEnv)
+		}
+	}
 	envVars = append(envVars, flinkCluster.Spec.EnvVars...)
+	envVars = append(envVars, taskManagerSpec.Env...)
+
+	// The pod name is the resource ID of the TaskManager, so that the
+	// TaskManagers in the Flink API are matched with their pods.
+	var args = []string{"taskmanager"}
+	if isTaskManagerResourceIDSupported(&clusterSpec) {
+		envVars = append([]corev1.EnvVar{{
+			Name: "POD_NAME",
+			ValueFrom: &corev1.EnvVarSource{
+				FieldRef: &corev1.ObjectFieldSelector{FieldPath: "metadata.name"},
+			},
+		}}, envVars...)
+		args = append(args, "-Dtaskmanager.resource-id=$(POD_NAME)")
+	}
 
 	var containers = []corev1.Container{corev1.Container{
 		Name:            "taskmanager",
 		Image:           imageSpec.Name,
 		ImagePullPolicy: imageSpec.PullPolicy,
-		Args:            []string{"taskmanager"},
+		Args:            args,
 		Ports: []corev1.ContainerPort{
 			dataPort, rpcPort, queryPort},
-		LivenessProbe:  &probe,
-		ReadinessProbe: &probe,
-		Resources:      taskManagerSpec.Resources,
+		LivenessProbe:  livenessProbe,
+		ReadinessProbe: readinessProbe,
+		Resources:      resources,
 		Env:            envVars,
+		EnvFrom:        taskManagerSpec.EnvFrom,
 		VolumeMounts:   volumeMounts,
 	}}
-	containers = append(containers, taskManagerSpec.Sidecars...)
+	if taskManagerSpec.PreStopHook {
+		containers[0].Lifecycle = getTaskManagerLifecycle()
+	}
+	if clusterSpec.Suspend {
+		replicas = 0
+	}
+	var affinity = taskManagerSpec.Affinity
+	if affinity == nil && specReplicas > 1 {
+		affinity = getSpreadAffinity(labels)
+	}
 	var podSpec = corev1.PodSpec{
-		Containers:       containers,
-		Volumes:          volumes,
-		NodeSelector:     taskManagerSpec.NodeSelector,
-		ImagePullSecrets: imageSpec.PullSecrets,
+		Containers:         containers,
+		Volumes:            volumes,
+		NodeSelector:       nodeSelector,
+		Affinity:           affinity,
+		Tolerations:        taskManagerSpec.Tolerations,
+		PriorityClassName:  taskManagerSpec.PriorityClassName,
+		ImagePullSecrets:   imageSpec.PullSecrets,
+		ServiceAccountName: getServiceAccountName(clusterSpec.ServiceAccount),
+	}
+	addSidecars(&podSpec, taskManagerSpec.Sidecars)
+	podSpec.TerminationGracePeriodSeconds =
+		taskManagerSpec.TerminationGracePeriodSeconds
+	// The default TaskManagers exclude the pods of the pools, which carry the
+	// same labels plus the pool label.
+	var selector = &metav1.LabelSelector{MatchLabels: labels}
+	if pool == nil {
+		selector.MatchExpressions = []metav1.LabelSelectorRequirement{{
+			Key:      "pool",
+			Operator: metav1.LabelSelectorOpDoesNotExist,
+		}}
 	}
 	var taskManagerDeployment = &appsv1.Deployment{
 		ObjectMeta: metav1.ObjectMeta{
@@ -475,8 +1061,9 @@ func getDesiredTaskManagerDeployment(
 			Labels: labels,
 		},
 		Spec: appsv1.DeploymentSpec{
-			Replicas: &taskManagerSpec.Replicas,
-			Selector: &metav1.LabelSelector{MatchLabels: labels},
+			Replicas:        &replicas,
+			MinReadySeconds: taskManagerSpec.MinReadySeconds,
+			Selector:        selector,
 			Template: corev1.PodTemplateSpec{
 				ObjectMeta: metav1.ObjectMeta{
 					Labels: labels,
@@ -488,6 +1075,70 @@ func getDesiredTaskManagerDeployment(
 	return taskManagerDeployment
 }
 
+// Annotates the pod templates of the JobManager and TaskManager deployments
+// with the checksum of the data of the external Flink ConfigMap, so that the
+// pods are restarted when it changes.
+func addFlinkConfigChecksum(
+	desired *DesiredClusterState, flinkConfigMap *corev1.ConfigMap) {
+	if flinkConfigMap == nil {
+		return
+	}
+	var checksum = getConfigMapChecksum(flinkConfigMap)
+	for _, template := range getDesiredPodTemplates(desired) {
+		if template.Annotations == nil {
+			template.Annotations = map[string]string{}
+		}
+		template.Annotations[flinkConfigChecksumAnnotation] = checksum
+	}
+}
+
+// Annotates the pod templates of the JobManager and TaskManager deployments
+// with the restartedAt annotation of the cluster, so that the pods are
+// restarted when its value changes.
+func addRestartedAt(
+	desired *DesiredClusterState, cluster *v1beta1.FlinkCluster) {
+	var restartedAt = cluster.Annotations[restartedAtAnnotation]
+	if len(restartedAt) == 0 {
+		return
+	}
+	for _, template := range getDesiredPodTemplates(desired) {
+		if template.Annotations == nil {
+			template.Annotations = map[string]string{}
+		}
+		template.Annotations[restartedAtAnnotation] = restartedAt
+	}
+}
+
+// Gets the pod templates of the desired JobManager and TaskManager
+// deployments, the TaskManager pools and the TaskManager StatefulSet.
+func getDesiredPodTemplates(
+	desired *DesiredClusterState) []*corev1.PodTemplateSpec {
+	var templates []*corev1.PodTemplateSpec
+	var deployments = []*appsv1.Deployment{
+		desired.JmDeployment, desired.TmDeployment}
+	for _, deployment := range desired.TmPools {
+		deployments = append(deployments, deployment)
+	}
+	for _, deployment := range deployments {
+		if deployment != nil {
+			templates = append(templates, &deployment.Spec.Template)
+		}
+	}
+	if desired.TmStatefulSet != nil {
+		templates = append(templates, &desired.TmStatefulSet.Spec.Template)
+	}
+	return templates
+}
+
+// Gets the SHA-256 checksum of the data of the ConfigMap in hex.
+func getConfigMapChecksum(configMap *corev1.ConfigMap) string {
+	// The keys of the maps are sorted by the JSON encoding.
+	var data, _ = json.Marshal(
+		[]interface{}{configMap.Data, configMap.BinaryData})
+	var checksum = sha256.Sum256(data)
+	return hex.EncodeToString(checksum[:])
+}
+
 // Gets the desired configMap.
 func getDesiredConfigMap(
 	flinkCluster *v1beta1.FlinkCluster) *corev1.ConfigMap {
@@ -498,10 +1149,11 @@ func getDesiredConfigMap(
 
 	var clusterNamespace = flinkCluster.ObjectMeta.Namespace
 	var clusterName = flinkCluster.ObjectMeta.Name
+	var namer = NewResourceNamer(flinkCluster)
 	var flinkProperties = flinkCluster.Spec.FlinkProperties
 	var jmPorts = flinkCluster.Spec.JobManager.Ports
 	var tmPorts = flinkCluster.Spec.TaskManager.Ports
-	var configMapName = getConfigMapName(clusterName)
+	var configMapName = namer.ConfigMapName()
 	var labels = map[string]string{
 		"cluster": clusterName,
 		"app":     "flink",
@@ -509,19 +1161,47 @@ func getDesiredConfigMap(
 	var flinkHeapSize = calFlinkHeapSize(flinkCluster)
 	// Properties which should be provided from real deployed environment.
 	var flinkProps = map[string]string{
-		"jobmanager.rpc.address": getJobManagerServiceName(clusterName),
+		"jobmanager.rpc.address": namer.JobManagerServiceName(),
 		"jobmanager.rpc.port":    strconv.FormatInt(int64(*jmPorts.RPC), 10),
 		"blob.server.port":       strconv.FormatInt(int64(*jmPorts.Blob), 10),
 		"query.server.port":      strconv.FormatInt(int64(*jmPorts.Query), 10),
 		"rest.port":              strconv.FormatInt(int64(*jmPorts.UI), 10),
 		"taskmanager.rpc.port":   strconv.FormatInt(int64(*tmPorts.RPC), 10),
 	}
+	if flinkCluster.Spec.JobManagerProxy != nil {
+		flinkProps["rest.port"] = strconv.FormatInt(int64(jmProxyUpstreamPort), 10)
+	}
 	if flinkHeapSize["jobmanager.heap.size"] != "" {
 		flinkProps["jobmanager.heap.size"] = flinkHeapSize["jobmanager.heap.size"]
 	}
 	if flinkHeapSize["taskmanager.heap.size"] != "" {
 		flinkProps["taskmanager.heap.size"] = flinkHeapSize["taskmanager.heap.size"]
 	}
+	var gracefulShutdownTimeout = flinkCluster.Spec.JobManager.GracefulShutdownTimeout
+	if gracefulShutdownTimeout != nil {
+		flinkProps["jobmanager.timeout"] = fmt.Sprintf(
+			"%d ms", gracefulShutdownTimeout.Duration.Milliseconds())
+	}
+	var checkpointStorage = flinkCluster.Spec.CheckpointStorage
+	if checkpointStorage != nil {
+		flinkProps["state.checkpoints.dir"] = "file://" + checkpointStorage.MountPath
+	}
+	// The JobManager address is set by Flink in native mode.
+	if isNativeMode(flinkCluster) {
+		delete(flinkProps, "jobmanager.rpc.address")
+		for k, v := range getNativeProperties(flinkCluster) {
+			flinkProps[k] = v
+		}
+	} else if v1beta1.IsKubernetesHAEnabled(flinkProperties) {
+		// The leader ConfigMaps are named after the cluster ID.
+		flinkProps["kubernetes.cluster-id"] = namer.HAClusterID()
+		flinkProps["kubernetes.namespace"] = clusterNamespace
+	}
+	var slotsPerTask = flinkCluster.Spec.TaskManager.SlotsPerTask
+	if slotsPerTask != nil {
+		flinkProps["taskmanager.numberOfTaskSlots"] =
+			strconv.FormatInt(int64(*slotsPerTask), 10)
+	}
 	// Add custom Flink properties.
 	for k, v := range flinkProperties {
 		// Do not allow to override properties from real deployment.
@@ -530,6 +1210,14 @@ func getDesiredConfigMap(
 		}
 		flinkProps[k] = v
 	}
+	// Checkpoint properties, which take precedence over the custom ones.
+	for k, v := range getCheckpointProperties(flinkCluster.Spec.CheckpointConfig) {
+		flinkProps[k] = v
+	}
+	// Table API and SQL properties.
+	for k, v := range getTableProperties(flinkCluster.Spec.Table) {
+		flinkProps[k] = v
+	}
 	// TODO: Provide logging options: log4j-console.properties and log4j.properties
 	var log4jPropName = "log4j-console.properties"
 	var logbackXMLName = "logback-console.xml"
@@ -541,11 +1229,27 @@ func getDesiredConfigMap(
 				toOwnerReference(flinkCluster)},
 			Labels: labels,
 		},
-		Data: map[string]string{
-			"flink-conf.yaml": getFlinkProperties(flinkProps),
-			log4jPropName:     getLogConf()[log4jPropName],
-			logbackXMLName:    getLogConf()[logbackXMLName],
-		},
+		Data: map[string]string{},
+	}
+	// The Flink config is not generated when an external one is mounted.
+	if len(flinkCluster.Spec.FlinkConfigMap) == 0 {
+		configMap.Data["flink-conf.yaml"] = getFlinkProperties(flinkProps)
+		configMap.Data[log4jPropName] = getLogConf()[log4jPropName]
+		configMap.Data[logbackXMLName] = getLogConf()[logbackXMLName]
+	}
+	var jobSpec = flinkCluster.Spec.Job
+	if jobSpec != nil && len(jobSpec.PythonRequirements) > 0 {
+		configMap.Data[pythonRequirementsFile] = jobSpec.PythonRequirements
+	}
+	if isSSOEnabled(flinkCluster.Spec.Security) {
+		configMap.Data[ssoProxyConfigFile] = getSSOProxyConfig(
+			flinkCluster.Spec.Security.OIDCConfig, *jmPorts.UI)
+	}
+	if flinkCluster.Spec.JobManagerProxy != nil {
+		// The config has been rendered by validateSpec, the desired state is
+		// not computed when it fails.
+		configMap.Data[jmProxyConfigFile], _ = getJobManagerProxyConfig(
+			flinkCluster.Spec.JobManagerProxy, *jmPorts.UI)
 	}
 
 	return configMap
@@ -564,26 +1268,110 @@ func getDesiredJob(
 		return nil
 	}
 
-	var clusterSpec = flinkCluster.Spec
-	var imageSpec = clusterSpec.Image
-	var jobManagerSpec = clusterSpec.JobManager
-	var clusterNamespace = flinkCluster.ObjectMeta.Namespace
+	// The stream graph and the jobs with submission retries are submitted by
+	// the operator through the REST API.
+	if isStreamGraphJob(flinkCluster) || isRESTSubmittedJob(flinkCluster) {
+		return nil
+	}
+
 	var clusterName = flinkCluster.ObjectMeta.Name
-	var jobName = getJobName(clusterName)
-	var jobManagerServiceName = clusterName + "-jobmanager"
-	var jobManagerAddress = fmt.Sprintf(
-		"%s:%d", jobManagerServiceName, *jobManagerSpec.Ports.UI)
+	var namer = NewResourceNamer(flinkCluster)
 	var labels = map[string]string{
 		"cluster": clusterName,
 		"app":     "flink",
 	}
+	return convertJob(
+		flinkCluster,
+		jobSpec,
+		flinkCluster.Status.Components.Job,
+		namer.JobName(),
+		labels)
+}
+
+// Gets the desired cluster of a version of traffic splitting. Each version
+// runs in its own job cluster owned by the cluster, so that the VirtualService
+// can route to the JobManager service of the version. The version cluster
+// inherits the spec of the cluster, except for the job and the settings which
+// must be unique in the namespace; it reuses the service account and the
+// checkpoint PVC of the cluster.
+func getDesiredVersionCluster(
+	flinkCluster *v1beta1.FlinkCluster, version string) *v1beta1.FlinkCluster {
+	var trafficSplitting = getTrafficSplitting(flinkCluster)
+	if trafficSplitting == nil {
+		return nil
+	}
+
+	var jobSpec = &trafficSplitting.VersionA
+	if version == "b" {
+		jobSpec = &trafficSplitting.VersionB
+	}
+	var namer = NewResourceNamer(flinkCluster)
+	var spec = flinkCluster.Spec.DeepCopy()
+	spec.Job = jobSpec.DeepCopy()
+	spec.Networking.ServiceMesh.TrafficSplitting = nil
+	spec.NamingPrefix = ""
+	spec.CloneFrom = nil
+	spec.TemplateRef = nil
+	spec.JobManager.Ingress = nil
+	if spec.ServiceAccount != nil {
+		spec.ServiceAccount = &v1beta1.ServiceAccountSpec{
+			Name: spec.ServiceAccount.Name,
+		}
+	}
+	if spec.CheckpointStorage != nil {
+		spec.CheckpointStorage.StorageClass = ""
+	}
+	return &v1beta1.FlinkCluster{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: v1beta1.GroupVersion.String(),
+			Kind:       "FlinkCluster",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: flinkCluster.ObjectMeta.Namespace,
+			Name:      namer.VersionClusterName(version),
+			OwnerReferences: []metav1.OwnerReference{
+				toOwnerReference(flinkCluster)},
+			Labels: map[string]string{
+				"app":     "flink",
+				"version": version,
+			},
+		},
+		Spec: *spec,
+	}
+}
+
+// Converts the job spec to a Kubernetes job which submits the job to the
+// cluster.
+func convertJob(
+	flinkCluster *v1beta1.FlinkCluster,
+	jobSpec *v1beta1.JobSpec,
+	jobStatus *v1beta1.JobStatus,
+	jobName string,
+	labels map[string]string) *batchv1.Job {
+	var clusterSpec = flinkCluster.Spec
+	var imageSpec = clusterSpec.Image
+	var clusterNamespace = flinkCluster.ObjectMeta.Namespace
+	var namer = NewResourceNamer(flinkCluster)
+	var jobManagerServiceName = namer.JobManagerServiceName()
+	var jobManagerAddress = fmt.Sprintf(
+		"%s:%d", jobManagerServiceName, getFlinkAPIPort(flinkCluster))
 	var jobArgs = []string{"/opt/flink/bin/flink", "run"}
-	jobArgs = append(jobArgs, "--jobmanager", jobManagerAddress)
+	if isNativeMode(flinkCluster) {
+		// The application cluster is deployed with the config mounted from
+		// the ConfigMap.
+		jobArgs = []string{
+			"/opt/flink/bin/flink",
+			"run-application",
+			"--target",
+			"kubernetes-application",
+		}
+	} else {
+		jobArgs = append(jobArgs, "--jobmanager", jobManagerAddress)
+	}
 	if jobSpec.ClassName != nil {
 		jobArgs = append(jobArgs, "--class", *jobSpec.ClassName)
 	}
 
-	var jobStatus = flinkCluster.Status.Components.Job
 	var fromSavepoint = convertFromSavepoint(jobSpec, jobStatus)
 	if fromSavepoint != nil {
 		jobArgs = append(jobArgs, "--fromSavepoint", *fromSavepoint)
@@ -593,9 +1381,8 @@ func getDesiredJob(
 		*jobSpec.AllowNonRestoredState == true {
 		jobArgs = append(jobArgs, "--allowNonRestoredState")
 	}
-	if jobSpec.Parallelism != nil {
-		jobArgs = append(
-			jobArgs, "--parallelism", fmt.Sprint(*jobSpec.Parallelism))
+	if parallelism := getDesiredParallelism(flinkCluster); parallelism != nil {
+		jobArgs = append(jobArgs, "--parallelism", fmt.Sprint(*parallelism))
 	}
 	if jobSpec.NoLoggingToStdout != nil &&
 		*jobSpec.NoLoggingToStdout == true {
@@ -603,27 +1390,72 @@ func getDesiredJob(
 	}
 
 	var envVars = []corev1.EnvVar{}
-
-	// If the JAR file is remote, put the URI in the env variable
-	// FLINK_JOB_JAR_URI and rewrite the JAR path to a local path. The entrypoint
-	// script of the container will download it before submitting it to Flink.
-	var jarPath = jobSpec.JarFile
-	if strings.Contains(jobSpec.JarFile, "://") {
-		var parts = strings.Split(jobSpec.JarFile, "/")
-		jarPath = "/opt/flink/job/" + parts[len(parts)-1]
-		envVars = append(envVars, corev1.EnvVar{
-			Name:  "FLINK_JOB_JAR_URI",
-			Value: jobSpec.JarFile,
-		})
-	}
-	jobArgs = append(jobArgs, jarPath)
-	jobArgs = append(jobArgs, jobSpec.Args...)
-
 	var volumes []corev1.Volume
 	var volumeMounts []corev1.VolumeMount
 	volumes = append(volumes, jobSpec.Volumes...)
 	volumeMounts = append(volumeMounts, jobSpec.VolumeMounts...)
 
+	if jobSpec.SQLJob != nil {
+		// SQL job, the SQL file is mounted from its ConfigMap and run by the
+		// SQL client instead of `flink run`. The client gets the JobManager
+		// address and the run options as dynamic properties, because the
+		// entrypoint of the image only applies FLINK_PROPERTIES to the
+		// JobManager and the TaskManagers.
+		var sqlVolume, sqlMount = convertSQLJobFile(jobSpec.SQLJob)
+		volumes = append(volumes, sqlVolume)
+		volumeMounts = append(volumeMounts, sqlMount)
+		jobArgs = []string{"/opt/flink/bin/sql-client.sh", "embedded"}
+		var properties = getSQLJobProperties(
+			jobManagerServiceName,
+			getFlinkAPIPort(flinkCluster),
+			jobSpec,
+			getDesiredParallelism(flinkCluster),
+			fromSavepoint)
+		var keys = make([]string, 0, len(properties))
+		for key := range properties {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			jobArgs = append(jobArgs, fmt.Sprintf("-D%v=%v", key, properties[key]))
+		}
+		jobArgs = append(
+			jobArgs, "-f", sqlJobPath+"/"+jobSpec.SQLJob.StatementFile)
+	} else if len(jobSpec.PythonScript) > 0 {
+		// PyFlink job, the requirements file is mounted from the ConfigMap.
+		jobArgs = append(jobArgs, "--python", jobSpec.PythonScript)
+		if len(jobSpec.PythonRequirements) > 0 {
+			var reqVolume, reqMount = convertPythonRequirements(namer.ConfigMapName())
+			volumes = append(volumes, reqVolume)
+			volumeMounts = append(volumeMounts, reqMount)
+			jobArgs = append(
+				jobArgs,
+				"--pyRequirements",
+				pythonRequirementsPath+"/"+pythonRequirementsFile)
+		}
+	} else {
+		// If the JAR file is remote, put the URI in the env variable
+		// FLINK_JOB_JAR_URI and rewrite the JAR path to a local path. The
+		// entrypoint script of the container will download it before submitting
+		// it to Flink.
+		var jarPath = jobSpec.JarFile
+		if isNativeMode(flinkCluster) {
+			// The JAR file is in the image of the application cluster.
+			if !strings.HasPrefix(jarPath, "local://") {
+				jarPath = "local://" + jarPath
+			}
+		} else if strings.Contains(jobSpec.JarFile, "://") {
+			var parts = strings.Split(jobSpec.JarFile, "/")
+			jarPath = "/opt/flink/job/" + parts[len(parts)-1]
+			envVars = append(envVars, corev1.EnvVar{
+				Name:  "FLINK_JOB_JAR_URI",
+				Value: jobSpec.JarFile,
+			})
+		}
+		jobArgs = append(jobArgs, jarPath)
+	}
+	jobArgs = append(jobArgs, jobSpec.Args...)
+
 	// Hadoop config.
 	var hcVolume, hcMount, hcEnv = convertHadoopConfig(clusterSpec.HadoopConfig)
 	if hcVolume != nil {
@@ -648,10 +1480,33 @@ func getDesiredJob(
 		envVars = append(envVars, *saEnv)
 	}
 
+	// Extra classpath.
+	var classPathEnv = convertExtraClassPath(&clusterSpec)
+	if classPathEnv != nil {
+		envVars = append(envVars, *classPathEnv)
+	}
+
+	// Job JAR downloader, before the user init containers.
+	var initContainers = convertJobInitContainers(jobSpec)
+	var jarDownloader, jarVolume, jarMount = convertJarDownloader(
+		jobSpec, clusterSpec.GCPConfig)
+	if jarDownloader != nil {
+		initContainers = append(
+			[]corev1.Container{*jarDownloader}, initContainers...)
+		volumes = append(volumes, *jarVolume)
+		volumeMounts = append(volumeMounts, *jarMount)
+	}
+
+	if isNativeMode(flinkCluster) {
+		var confVol, confMount = convertFlinkConfig(flinkCluster)
+		volumes = append(volumes, *confVol)
+		volumeMounts = append(volumeMounts, *confMount)
+	}
+
 	envVars = append(envVars, flinkCluster.Spec.EnvVars...)
 
 	var podSpec = corev1.PodSpec{
-		InitContainers: convertJobInitContainers(jobSpec),
+		InitContainers: initContainers,
 		Containers: []corev1.Container{
 			corev1.Container{
 				Name:            "main",
@@ -662,9 +1517,10 @@ func getDesiredJob(
 				VolumeMounts:    volumeMounts,
 			},
 		},
-		RestartPolicy:    corev1.RestartPolicyNever,
-		Volumes:          volumes,
-		ImagePullSecrets: imageSpec.PullSecrets,
+		RestartPolicy:      corev1.RestartPolicyNever,
+		Volumes:            volumes,
+		ImagePullSecrets:   imageSpec.PullSecrets,
+		ServiceAccountName: getServiceAccountName(clusterSpec.ServiceAccount),
 	}
 
 	// Disable the retry mechanism of k8s Job, all retires should be initiated
@@ -689,19 +1545,348 @@ func getDesiredJob(
 				Spec:       podSpec,
 			},
 			BackoffLimit: &backoffLimit,
+			// Cleared by the operator after the Flink job is running, because
+			// the submitter stays attached to the job until it finishes.
+			ActiveDeadlineSeconds: jobSpec.SubmitJobTimeoutSeconds,
 		},
 	}
+	// Tells the submitter of the rescaled job apart from the earlier ones.
+	if jobStatus != nil && jobStatus.Rescale != nil &&
+		jobStatus.Rescale.Phase == v1beta1.JobRescalePhaseResubmitting {
+		job.Annotations = map[string]string{
+			rescaleTriggerIDAnnotation: jobStatus.Rescale.TriggerID,
+		}
+	}
 	return job
 }
 
+// Converts the Python requirements in the ConfigMap to a volume and a mount
+// for the job container.
+func convertPythonRequirements(
+	configMapName string) (corev1.Volume, corev1.VolumeMount) {
+	var volume = corev1.Volume{
+		Name: pythonRequirementsVolume,
+		VolumeSource: corev1.VolumeSource{
+			ConfigMap: &corev1.ConfigMapVolumeSource{
+				LocalObjectReference: corev1.LocalObjectReference{
+					Name: configMapName,
+				},
+				Items: []corev1.KeyToPath{{
+					Key:  pythonRequirementsFile,
+					Path: pythonRequirementsFile,
+				}},
+			},
+		},
+	}
+	var mount = corev1.VolumeMount{
+		Name:      pythonRequirementsVolume,
+		MountPath: pythonRequirementsPath,
+	}
+	return volume, mount
+}
+
+// Converts the SQL file in the ConfigMap of the SQL job to a volume and a
+// mount for the job container.
+func convertSQLJobFile(
+	sqlJob *v1beta1.SQLJobSpec) (corev1.Volume, corev1.VolumeMount) {
+	var volume = corev1.Volume{
+		Name: sqlJobVolume,
+		VolumeSource: corev1.VolumeSource{
+			ConfigMap: &corev1.ConfigMapVolumeSource{
+				LocalObjectReference: corev1.LocalObjectReference{
+					Name: sqlJob.ConfigMapRef,
+				},
+				Items: []corev1.KeyToPath{{
+					Key:  sqlJob.StatementFile,
+					Path: sqlJob.StatementFile,
+				}},
+			},
+		},
+	}
+	var mount = corev1.VolumeMount{
+		Name:      sqlJobVolume,
+		MountPath: sqlJobPath,
+	}
+	return volume, mount
+}
+
+// Gets the Flink properties of the SQL client, which correspond to the
+// options of `flink run` for the other jobs.
+func getSQLJobProperties(
+	jobManagerServiceName string,
+	uiPort int32,
+	jobSpec *v1beta1.JobSpec,
+	parallelism *int32,
+	fromSavepoint *string) map[string]string {
+	var properties = map[string]string{
+		"jobmanager.rpc.address": jobManagerServiceName,
+		"rest.address":           jobManagerServiceName,
+		"rest.port":              fmt.Sprint(uiPort),
+	}
+	if parallelism != nil {
+		properties["parallelism.default"] = fmt.Sprint(*parallelism)
+	}
+	if fromSavepoint != nil {
+		properties["execution.savepoint.path"] = *fromSavepoint
+	}
+	if jobSpec.AllowNonRestoredState != nil && *jobSpec.AllowNonRestoredState {
+		properties["execution.savepoint.ignore-unclaimed-state"] = "true"
+	}
+	return properties
+}
+
 func convertFromSavepoint(
 	jobSpec *v1beta1.JobSpec, jobStatus *v1beta1.JobStatus) *string {
-	if shouldRestartJob(jobSpec.RestartPolicy, jobStatus) {
+	// The rescaled job is resubmitted from the savepoint of the stopped job.
+	if jobStatus != nil && jobStatus.Rescale != nil &&
+		jobStatus.Rescale.Phase == v1beta1.JobRescalePhaseResubmitting {
+		return &jobStatus.Rescale.SavepointLocation
+	}
+	if shouldRestartJob(jobSpec, jobStatus) &&
+		len(jobStatus.SavepointLocation) > 0 {
 		return &jobStatus.SavepointLocation
 	}
 	return jobSpec.FromSavepoint
 }
 
+// Gets the desired PersistentVolumeClaim for checkpoints, only when it should
+// be created by the operator. It has no owner reference, so that the
+// checkpoints survive the deletion of the cluster.
+func getDesiredCheckpointPVC(
+	flinkCluster *v1beta1.FlinkCluster) *corev1.PersistentVolumeClaim {
+	var checkpointStorage = flinkCluster.Spec.CheckpointStorage
+	if checkpointStorage == nil || len(checkpointStorage.StorageClass) == 0 {
+		return nil
+	}
+
+	var clusterName = flinkCluster.ObjectMeta.Name
+	var storageClass = checkpointStorage.StorageClass
+	return &corev1.PersistentVolumeClaim{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: flinkCluster.ObjectMeta.Namespace,
+			Name:      checkpointStorage.PVCName,
+			Labels: map[string]string{
+				"cluster": clusterName,
+				"app":     "flink",
+			},
+		},
+		Spec: corev1.PersistentVolumeClaimSpec{
+			// Shared by the JobManager and TaskManager pods.
+			AccessModes: []corev1.PersistentVolumeAccessMode{
+				checkpointStorage.AccessMode},
+			StorageClassName: &storageClass,
+			Resources: corev1.ResourceRequirements{
+				Requests: corev1.ResourceList{
+					corev1.ResourceStorage: checkpointStorage.StorageSize,
+				},
+			},
+		},
+	}
+}
+
+// Gets the desired service account of the cluster pods, only when it should
+// be created by the operator.
+func getDesiredServiceAccount(
+	flinkCluster *v1beta1.FlinkCluster) *corev1.ServiceAccount {
+	var serviceAccountSpec = flinkCluster.Spec.ServiceAccount
+	if serviceAccountSpec == nil || !serviceAccountSpec.Create {
+		return nil
+	}
+
+	var clusterName = flinkCluster.ObjectMeta.Name
+	return &corev1.ServiceAccount{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: flinkCluster.ObjectMeta.Namespace,
+			Name:      serviceAccountSpec.Name,
+			OwnerReferences: []metav1.OwnerReference{
+				toOwnerReference(flinkCluster)},
+			Labels: map[string]string{
+				"cluster": clusterName,
+				"app":     "flink",
+			},
+			Annotations: serviceAccountSpec.Annotations,
+		},
+	}
+}
+
+// Gets the desired Role of the created service account. It grants the
+// minimal permissions needed by the Flink pods, i.e., reading ConfigMaps and
+// pods in the namespace, and managing the leader ConfigMaps with Kubernetes
+// high availability.
+func getDesiredRole(flinkCluster *v1beta1.FlinkCluster) *rbacv1.Role {
+	var serviceAccountSpec = flinkCluster.Spec.ServiceAccount
+	if serviceAccountSpec == nil || !serviceAccountSpec.Create {
+		return nil
+	}
+
+	var clusterName = flinkCluster.ObjectMeta.Name
+	var namer = NewResourceNamer(flinkCluster)
+	var rules = []rbacv1.PolicyRule{
+		{
+			APIGroups: []string{""},
+			Resources: []string{"configmaps", "pods"},
+			Verbs:     []string{"get", "list", "watch"},
+		},
+	}
+	if v1beta1.IsKubernetesHAEnabled(flinkCluster.Spec.FlinkProperties) {
+		rules = []rbacv1.PolicyRule{
+			{
+				APIGroups: []string{""},
+				Resources: []string{"configmaps"},
+				Verbs: []string{
+					"get", "list", "watch", "create", "update", "patch", "delete"},
+			},
+			{
+				APIGroups: []string{""},
+				Resources: []string{"pods"},
+				Verbs:     []string{"get", "list", "watch"},
+			},
+		}
+	}
+	// In native mode, Flink creates the JobManager deployment, the services
+	// and the TaskManager pods of the application cluster.
+	if isNativeMode(flinkCluster) {
+		rules = []rbacv1.PolicyRule{
+			{
+				APIGroups: []string{""},
+				Resources: []string{"configmaps", "pods", "services"},
+				Verbs: []string{
+					"get", "list", "watch", "create", "update", "patch", "delete"},
+			},
+			{
+				APIGroups: []string{"apps"},
+				Resources: []string{"deployments"},
+				Verbs: []string{
+					"get", "list", "watch", "create", "update", "patch", "delete"},
+			},
+		}
+	}
+	return &rbacv1.Role{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: flinkCluster.ObjectMeta.Namespace,
+			Name:      namer.RoleName(),
+			OwnerReferences: []metav1.OwnerReference{
+				toOwnerReference(flinkCluster)},
+			Labels: map[string]string{
+				"cluster": clusterName,
+				"app":     "flink",
+			},
+		},
+		Rules: rules,
+	}
+}
+
+// Gets the desired RoleBinding which binds the Role to the created service
+// account.
+func getDesiredRoleBinding(
+	flinkCluster *v1beta1.FlinkCluster) *rbacv1.RoleBinding {
+	var serviceAccountSpec = flinkCluster.Spec.ServiceAccount
+	if serviceAccountSpec == nil || !serviceAccountSpec.Create {
+		return nil
+	}
+
+	var clusterNamespace = flinkCluster.ObjectMeta.Namespace
+	var clusterName = flinkCluster.ObjectMeta.Name
+	var namer = NewResourceNamer(flinkCluster)
+	return &rbacv1.RoleBinding{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: clusterNamespace,
+			Name:      namer.RoleBindingName(),
+			OwnerReferences: []metav1.OwnerReference{
+				toOwnerReference(flinkCluster)},
+			Labels: map[string]string{
+				"cluster": clusterName,
+				"app":     "flink",
+			},
+		},
+		Subjects: []rbacv1.Subject{
+			{
+				Kind:      rbacv1.ServiceAccountKind,
+				Name:      serviceAccountSpec.Name,
+				Namespace: clusterNamespace,
+			},
+		},
+		RoleRef: rbacv1.RoleRef{
+			APIGroup: rbacv1.GroupName,
+			Kind:     "Role",
+			Name:     namer.RoleName(),
+		},
+	}
+}
+
+// Gets the service account name of the cluster pods, empty for the default
+// service account.
+func getServiceAccountName(serviceAccount *v1beta1.ServiceAccountSpec) string {
+	if serviceAccount == nil {
+		return ""
+	}
+	return serviceAccount.Name
+}
+
+// Gets the desired Istio VirtualService which splits the traffic to the
+// JobManager service between the JobManager services of the two version
+// clusters of traffic splitting.
+func getDesiredVirtualService(
+	flinkCluster *v1beta1.FlinkCluster) *unstructured.Unstructured {
+	var trafficSplitting = getTrafficSplitting(flinkCluster)
+	if trafficSplitting == nil {
+		return nil
+	}
+
+	var clusterName = flinkCluster.ObjectMeta.Name
+	var namer = NewResourceNamer(flinkCluster)
+	var jobManagerServiceName = namer.JobManagerServiceName()
+	var weightA = int64(trafficSplitting.WeightA)
+	var getDestination = func(version string) map[string]interface{} {
+		var versionCluster = getDesiredVersionCluster(flinkCluster, version)
+		return map[string]interface{}{
+			"host": NewResourceNamer(versionCluster).JobManagerServiceName(),
+		}
+	}
+	var route = []interface{}{
+		map[string]interface{}{
+			"destination": getDestination("a"),
+			"weight":      weightA,
+		},
+		map[string]interface{}{
+			"destination": getDestination("b"),
+			"weight":      100 - weightA,
+		},
+	}
+	var virtualService = &unstructured.Unstructured{
+		Object: map[string]interface{}{
+			"spec": map[string]interface{}{
+				"hosts": []interface{}{jobManagerServiceName},
+				"http": []interface{}{
+					map[string]interface{}{"route": route},
+				},
+			},
+		},
+	}
+	virtualService.SetGroupVersionKind(virtualServiceGVK)
+	virtualService.SetNamespace(flinkCluster.ObjectMeta.Namespace)
+	virtualService.SetName(namer.VirtualServiceName())
+	virtualService.SetLabels(map[string]string{
+		"cluster": clusterName,
+		"app":     "flink",
+	})
+	virtualService.SetOwnerReferences(
+		[]metav1.OwnerReference{toOwnerReference(flinkCluster)})
+	return virtualService
+}
+
+// Gets the traffic splitting spec if it is enabled, otherwise nil.
+func getTrafficSplitting(
+	flinkCluster *v1beta1.FlinkCluster) *v1beta1.TrafficSplittingSpec {
+	var networking = flinkCluster.Spec.Networking
+	if networking == nil || networking.ServiceMesh == nil ||
+		networking.ServiceMesh.TrafficSplitting == nil ||
+		!networking.ServiceMesh.TrafficSplitting.Enabled {
+		return nil
+	}
+	return networking.ServiceMesh.TrafficSplitting
+}
+
 func convertJobInitContainers(jobSpec *v1beta1.JobSpec) []corev1.Container {
 	var initContainers = []corev1.Container{}
 	// Add jobSpec level volume mounts to each init container if there is no
@@ -725,6 +1910,53 @@ func convertJobInitContainers(jobSpec *v1beta1.JobSpec) []corev1.Container {
 	return initContainers
 }
 
+// Converts the `jarURI` of the job to an init container which downloads the
+// JAR into an emptyDir volume, and the volume mount of the JAR directory.
+func convertJarDownloader(
+	jobSpec *v1beta1.JobSpec, gcpConfig *v1beta1.GCPConfig) (
+	*corev1.Container, *corev1.Volume, *corev1.VolumeMount) {
+	if jobSpec == nil || len(jobSpec.JarURI) == 0 {
+		return nil, nil, nil
+	}
+
+	var jarVolume = &corev1.Volume{
+		Name: jobJarVolume,
+		VolumeSource: corev1.VolumeSource{
+			EmptyDir: &corev1.EmptyDirVolumeSource{},
+		},
+	}
+	var jarMount = &corev1.VolumeMount{
+		Name:      jobJarVolume,
+		MountPath: v1beta1.JobJarDirectory,
+	}
+	var envVars = []corev1.EnvVar{
+		{Name: "JAR_URI", Value: jobSpec.JarURI},
+		{
+			Name:  "JAR_FILE",
+			Value: v1beta1.GetDownloadedJarFile(jobSpec.JarURI),
+		},
+	}
+	var volumeMounts = []corev1.VolumeMount{*jarMount}
+
+	// GCP service account config, for downloading from GCS.
+	var saVolume, saMount, saEnv = convertGCPConfig(gcpConfig)
+	if saVolume != nil && saMount != nil {
+		volumeMounts = append(volumeMounts, *saMount)
+	}
+	if saEnv != nil {
+		envVars = append(envVars, *saEnv)
+	}
+
+	var downloader = &corev1.Container{
+		Name:         jarDownloaderContainer,
+		Image:        jobSpec.JarDownloaderImage,
+		Command:      []string{"/bin/sh", "-c", jarDownloaderScript},
+		Env:          envVars,
+		VolumeMounts: volumeMounts,
+	}
+	return downloader, jarVolume, jarMount
+}
+
 // Converts the FlinkCluster as owner reference for its child resources.
 func toOwnerReference(
 	flinkCluster *v1beta1.FlinkCluster) metav1.OwnerReference {
@@ -738,6 +1970,46 @@ func toOwnerReference(
 	}
 }
 
+// Gets the properties of the application cluster deployed by Flink in native
+// mode. The JobManager deployment is owned by the cluster, so that the
+// resources created by Flink are deleted with the cluster, and it is kept
+// after the job finishes, so that the final state of the job is observed.
+func getNativeProperties(flinkCluster *v1beta1.FlinkCluster) map[string]string {
+	var namer = NewResourceNamer(flinkCluster)
+	var imageSpec = flinkCluster.Spec.Image
+	var properties = map[string]string{
+		"kubernetes.cluster-id":                namer.NativeClusterID(),
+		"kubernetes.namespace":                 flinkCluster.Namespace,
+		"kubernetes.container.image":           imageSpec.Name,
+		"kubernetes.rest-service.exposed.type": "ClusterIP",
+		"kubernetes.jobmanager.owner.reference": fmt.Sprintf(
+			"apiVersion:%v,kind:%v,name:%v,uid:%v,blockOwnerDeletion:false",
+			flinkCluster.APIVersion,
+			flinkCluster.Kind,
+			flinkCluster.Name,
+			flinkCluster.UID),
+		"execution.shutdown-on-application-finish": "false",
+	}
+	if len(imageSpec.PullPolicy) > 0 {
+		properties["kubernetes.container.image.pull-policy"] =
+			string(imageSpec.PullPolicy)
+	}
+	if len(imageSpec.PullSecrets) > 0 {
+		var names []string
+		for _, secret := range imageSpec.PullSecrets {
+			names = append(names, secret.Name)
+		}
+		properties["kubernetes.container.image.pull-secrets"] =
+			strings.Join(names, ";")
+	}
+	var serviceAccountName = getServiceAccountName(
+		flinkCluster.Spec.ServiceAccount)
+	if len(serviceAccountName) > 0 {
+		properties["kubernetes.service-account"] = serviceAccountName
+	}
+	return properties
+}
+
 // Gets Flink properties
 func getFlinkProperties(properties map[string]string) string {
 	var keys = make([]string, len(properties))
@@ -767,8 +2039,8 @@ func shouldCleanup(
 	cluster *v1beta1.FlinkCluster, component string) bool {
 	var jobStatus = cluster.Status.Components.Job
 
-	// Session cluster.
-	if jobStatus == nil {
+	// Session cluster, whose job status might be observed from Flink.
+	if cluster.Spec.Job == nil || jobStatus == nil {
 		return false
 	}
 
@@ -777,6 +2049,12 @@ func shouldCleanup(
 	case v1beta1.JobStateSucceeded:
 		action = cluster.Spec.Job.CleanupPolicy.AfterJobSucceeds
 	case v1beta1.JobStateFailed:
+		// Keep the cluster for the pending restart.
+		if shouldRestartJob(cluster.Spec.Job, jobStatus) {
+			return false
+		}
+		action = cluster.Spec.Job.CleanupPolicy.AfterJobFails
+	case v1beta1.JobStateSubmitTimeout:
 		action = cluster.Spec.Job.CleanupPolicy.AfterJobFails
 	case v1beta1.JobStateCancelled:
 		action = cluster.Spec.Job.CleanupPolicy.AfterJobCancelled
@@ -826,6 +2104,28 @@ func calFlinkHeapSize(cluster *v1beta1.FlinkCluster) map[string]string {
 	return flinkHeapSize
 }
 
+// Gets the env variable which overrides the TaskManager heap size for a pool
+// with its own memory limit.
+func convertTaskManagerPoolHeapSize(
+	tmSpec *v1beta1.TaskManagerSpec,
+	resources *corev1.ResourceRequirements) *corev1.EnvVar {
+	var memLimitByte = resources.Limits.Memory().Value()
+	if tmSpec.MemoryOffHeapRatio == nil || memLimitByte <= 0 {
+		return nil
+	}
+	var heapSizeMB = calHeapSize(
+		memLimitByte,
+		tmSpec.MemoryOffHeapMin.Value(),
+		int64(*tmSpec.MemoryOffHeapRatio))
+	if heapSizeMB <= 0 {
+		return nil
+	}
+	return &corev1.EnvVar{
+		Name:  "FLINK_TM_HEAP",
+		Value: strconv.FormatInt(heapSizeMB, 10) + "m",
+	}
+}
+
 // Converts memory value to the format of divisor and returns ceiling of the value.
 func convertResourceMemoryToInt64(memory resource.Quantity, divisor resource.Quantity) int64 {
 	return int64(math.Ceil(float64(memory.Value()) / float64(divisor.Value())))
@@ -847,19 +2147,55 @@ func calHeapSize(memSize int64, offHeapMin int64, offHeapRatio int64) int64 {
 	return heapSizeMB
 }
 
-func convertFlinkConfig(clusterName string) (*corev1.Volume, *corev1.VolumeMount) {
+// Converts the Flink config to a volume and a mount. The config is the
+// ConfigMap generated by the operator, or the external `flinkConfigMap`, in
+// which case the proxy configs are still projected from the generated one.
+func convertFlinkConfig(
+	flinkCluster *v1beta1.FlinkCluster) (*corev1.Volume, *corev1.VolumeMount) {
 	var confVol *corev1.Volume
 	var confMount *corev1.VolumeMount
+	var configMapName = NewResourceNamer(flinkCluster).ConfigMapName()
 	confVol = &corev1.Volume{
 		Name: flinkConfigMapVolume,
 		VolumeSource: corev1.VolumeSource{
 			ConfigMap: &corev1.ConfigMapVolumeSource{
 				LocalObjectReference: corev1.LocalObjectReference{
-					Name: getConfigMapName(clusterName),
+					Name: configMapName,
 				},
 			},
 		},
 	}
+	if len(flinkCluster.Spec.FlinkConfigMap) > 0 {
+		var proxyConfigs = []corev1.KeyToPath{}
+		if isSSOEnabled(flinkCluster.Spec.Security) {
+			proxyConfigs = append(proxyConfigs, corev1.KeyToPath{
+				Key: ssoProxyConfigFile, Path: ssoProxyConfigFile})
+		}
+		if flinkCluster.Spec.JobManagerProxy != nil {
+			proxyConfigs = append(proxyConfigs, corev1.KeyToPath{
+				Key: jmProxyConfigFile, Path: jmProxyConfigFile})
+		}
+		var sources = []corev1.VolumeProjection{{
+			ConfigMap: &corev1.ConfigMapProjection{
+				LocalObjectReference: corev1.LocalObjectReference{
+					Name: flinkCluster.Spec.FlinkConfigMap,
+				},
+			},
+		}}
+		if len(proxyConfigs) > 0 {
+			sources = append(sources, corev1.VolumeProjection{
+				ConfigMap: &corev1.ConfigMapProjection{
+					LocalObjectReference: corev1.LocalObjectReference{
+						Name: configMapName,
+					},
+					Items: proxyConfigs,
+				},
+			})
+		}
+		confVol.VolumeSource = corev1.VolumeSource{
+			Projected: &corev1.ProjectedVolumeSource{Sources: sources},
+		}
+	}
 	confMount = &corev1.VolumeMount{
 		Name:      flinkConfigMapVolume,
 		MountPath: flinkConfigMapPath,
@@ -895,6 +2231,55 @@ func convertHadoopConfig(hadoopConfig *v1beta1.HadoopConfig) (
 	return volume, mount, env
 }
 
+func convertCheckpointStorage(
+	checkpointStorage *v1beta1.CheckpointStorageSpec) (
+	*corev1.Volume, *corev1.VolumeMount) {
+	if checkpointStorage == nil {
+		return nil, nil
+	}
+
+	var volume = &corev1.Volume{
+		Name: checkpointStorageVolume,
+		VolumeSource: corev1.VolumeSource{
+			PersistentVolumeClaim: &corev1.PersistentVolumeClaimVolumeSource{
+				ClaimName: checkpointStorage.PVCName,
+			},
+		},
+	}
+	var mount = &corev1.VolumeMount{
+		Name:      checkpointStorageVolume,
+		MountPath: checkpointStorage.MountPath,
+	}
+	return volume, mount
+}
+
+// Converts the emptyDir volume specs to the volumes of the pods and the
+// volume mounts of the containers.
+func convertEmptyDirVolumes(
+	emptyDirVolumes []v1beta1.EmptyDirVolumeSpec) (
+	[]corev1.Volume, []corev1.VolumeMount) {
+	var volumes []corev1.Volume
+	var mounts []corev1.VolumeMount
+	for _, emptyDirVolume := range emptyDirVolumes {
+		var source = &corev1.EmptyDirVolumeSource{
+			Medium: emptyDirVolume.Medium,
+		}
+		if !emptyDirVolume.SizeLimit.IsZero() {
+			var sizeLimit = emptyDirVolume.SizeLimit.DeepCopy()
+			source.SizeLimit = &sizeLimit
+		}
+		volumes = append(volumes, corev1.Volume{
+			Name:         emptyDirVolume.Name,
+			VolumeSource: corev1.VolumeSource{EmptyDir: source},
+		})
+		mounts = append(mounts, corev1.VolumeMount{
+			Name:      emptyDirVolume.Name,
+			MountPath: emptyDirVolume.MountPath,
+		})
+	}
+	return volumes, mounts
+}
+
 func convertGCPConfig(gcpConfig *v1beta1.GCPConfig) (*corev1.Volume, *corev1.VolumeMount, *corev1.EnvVar) {
 	if gcpConfig == nil {
 		return nil, nil, nil
@@ -924,6 +2309,291 @@ func convertGCPConfig(gcpConfig *v1beta1.GCPConfig) (*corev1.Volume, *corev1.Vol
 	return saVolume, saMount, saEnv
 }
 
+// Gets the env variable which appends the extra JAR files and the JAR files
+// required by the table config to the classpath. Flink appends
+// HADOOP_CLASSPATH to the classpath of all its processes.
+func convertExtraClassPath(clusterSpec *v1beta1.FlinkClusterSpec) *corev1.EnvVar {
+	var classPath = append([]string{}, clusterSpec.ExtraClassPath...)
+	var table = clusterSpec.Table
+	if table != nil && table.SQLDialect == v1beta1.SQLDialectHive &&
+		len(table.HiveConnectorJar) > 0 {
+		classPath = append(classPath, table.HiveConnectorJar)
+	}
+	if len(classPath) == 0 {
+		return nil
+	}
+	return &corev1.EnvVar{
+		Name:  "HADOOP_CLASSPATH",
+		Value: strings.Join(classPath, ":"),
+	}
+}
+
+// Gets the Flink properties of the table config.
+func getTableProperties(table *v1beta1.TableSpec) map[string]string {
+	if table == nil || table.SQLDialect != v1beta1.SQLDialectHive {
+		return nil
+	}
+	return map[string]string{
+		"table.sql.dialect":   v1beta1.SQLDialectHive,
+		"hive.metastore.uris": table.HiveMetastoreURI,
+	}
+}
+
+// Gets the Flink properties of the checkpoint config. The memory state backend
+// is called "jobmanager" in Flink.
+func getCheckpointProperties(
+	checkpointConfig *v1beta1.CheckpointConfig) map[string]string {
+	if checkpointConfig == nil {
+		return nil
+	}
+	var properties = map[string]string{}
+	if checkpointConfig.IntervalMillis > 0 {
+		properties["execution.checkpointing.interval"] = fmt.Sprintf(
+			"%d ms", checkpointConfig.IntervalMillis)
+	}
+	if checkpointConfig.MinPauseBetweenCheckpointsMillis > 0 {
+		properties["execution.checkpointing.min-pause"] = fmt.Sprintf(
+			"%d ms", checkpointConfig.MinPauseBetweenCheckpointsMillis)
+	}
+	if checkpointConfig.MaxConcurrentCheckpoints > 0 {
+		properties["execution.checkpointing.max-concurrent-checkpoints"] =
+			strconv.Itoa(checkpointConfig.MaxConcurrentCheckpoints)
+	}
+	switch checkpointConfig.StateBackend {
+	case "":
+	case v1beta1.StateBackendMemory:
+		properties["state.backend"] = "jobmanager"
+	default:
+		properties["state.backend"] = checkpointConfig.StateBackend
+	}
+	if len(checkpointConfig.StateBackendStoragePath) > 0 {
+		properties["state.checkpoints.dir"] =
+			checkpointConfig.StateBackendStoragePath
+	}
+	return properties
+}
+
+// Gets the sorted keys of the custom Flink properties which are overridden
+// with different values by the checkpoint config.
+func getOverriddenFlinkProperties(cluster *v1beta1.FlinkCluster) []string {
+	var overridden []string
+	var checkpointProperties = getCheckpointProperties(
+		cluster.Spec.CheckpointConfig)
+	for k, v := range checkpointProperties {
+		if custom, ok := cluster.Spec.FlinkProperties[k]; ok && custom != v {
+			overridden = append(overridden, k)
+		}
+	}
+	sort.Strings(overridden)
+	return overridden
+}
+
+// Gets the affinity which prefers to schedule the pods with the labels in
+// different zones, so that the loss of a zone takes down only a part of them,
+// and then on different nodes within a zone.
+func getSpreadAffinity(labels map[string]string) *corev1.Affinity {
+	var selector = &metav1.LabelSelector{MatchLabels: labels}
+	return &corev1.Affinity{
+		PodAntiAffinity: &corev1.PodAntiAffinity{
+			PreferredDuringSchedulingIgnoredDuringExecution: []corev1.WeightedPodAffinityTerm{
+				{
+					Weight: 100,
+					PodAffinityTerm: corev1.PodAffinityTerm{
+						LabelSelector: selector,
+						TopologyKey:   zoneTopologyKey,
+					},
+				},
+				{
+					Weight: 50,
+					PodAffinityTerm: corev1.PodAffinityTerm{
+						LabelSelector: selector,
+						TopologyKey:   nodeTopologyKey,
+					},
+				},
+			},
+		},
+	}
+}
+
+// Appends the sidecars to the pod, and shares an emptyDir volume for the Flink
+// log directory between the Flink container, i.e., the first container, and
+// the sidecars, so that the sidecars can ship the log files.
+func addSidecars(podSpec *corev1.PodSpec, sidecars []corev1.Container) {
+	if len(sidecars) == 0 {
+		return
+	}
+	var sidecarIndex = len(podSpec.Containers)
+	for _, sidecar := range sidecars {
+		podSpec.Containers = append(podSpec.Containers, *sidecar.DeepCopy())
+	}
+
+	var hasLogVolume = false
+	for _, volume := range podSpec.Volumes {
+		if volume.Name == flinkLogVolume {
+			hasLogVolume = true
+		}
+	}
+	if !hasLogVolume {
+		podSpec.Volumes = append(podSpec.Volumes, corev1.Volume{
+			Name: flinkLogVolume,
+			VolumeSource: corev1.VolumeSource{
+				EmptyDir: &corev1.EmptyDirVolumeSource{},
+			},
+		})
+	}
+
+	var logMount = corev1.VolumeMount{
+		Name:      flinkLogVolume,
+		MountPath: flinkLogPath,
+	}
+	addVolumeMount(&podSpec.Containers[0], logMount)
+	for i := sidecarIndex; i < len(podSpec.Containers); i++ {
+		addVolumeMount(&podSpec.Containers[i], logMount)
+	}
+}
+
+// Adds the volume mount to the container unless the volume or the path is
+// already mounted.
+func addVolumeMount(container *corev1.Container, mount corev1.VolumeMount) {
+	for _, existing := range container.VolumeMounts {
+		if existing.Name == mount.Name || existing.MountPath == mount.MountPath {
+			return
+		}
+	}
+	// Copy the mounts, they might share the backing array with the spec.
+	var mounts = make([]corev1.VolumeMount, 0, len(container.VolumeMounts)+1)
+	mounts = append(mounts, container.VolumeMounts...)
+	container.VolumeMounts = append(mounts, mount)
+}
+
+func isSSOEnabled(security *v1beta1.SecuritySpec) bool {
+	return security != nil && security.SSOEnabled != nil &&
+		*security.SSOEnabled && security.OIDCConfig != nil
+}
+
+// Whether the JobManager UI port is served by a proxy, which the operator and
+// the job submitter bypass through the internal REST port of the service.
+func isJobManagerUIProxied(flinkCluster *v1beta1.FlinkCluster) bool {
+	return isSSOEnabled(flinkCluster.Spec.Security)
+}
+
+// Converts the security config to an OAuth2 proxy container in front of the
+// JobManager UI port. The proxy reads its config from the Flink ConfigMap and
+// the client and cookie secrets from environment variables.
+func convertSSOProxy(security *v1beta1.SecuritySpec) *corev1.Container {
+	if !isSSOEnabled(security) {
+		return nil
+	}
+
+	var oidcConfig = security.OIDCConfig
+	return &corev1.Container{
+		Name:  "sso-proxy",
+		Image: oidcConfig.ProxyImage,
+		Args: []string{
+			"--config=" + ssoProxyConfigPath + "/" + ssoProxyConfigFile,
+		},
+		Ports: []corev1.ContainerPort{
+			{Name: ssoProxyPortName, ContainerPort: ssoProxyPort},
+		},
+		Env: []corev1.EnvVar{
+			{
+				Name: "OAUTH2_PROXY_CLIENT_SECRET",
+				ValueFrom: &corev1.EnvVarSource{
+					SecretKeyRef: oidcConfig.ClientSecretRef.DeepCopy(),
+				},
+			},
+			{
+				Name: "OAUTH2_PROXY_COOKIE_SECRET",
+				ValueFrom: &corev1.EnvVarSource{
+					SecretKeyRef: oidcConfig.CookieSecretRef.DeepCopy(),
+				},
+			},
+		},
+		VolumeMounts: []corev1.VolumeMount{
+			{
+				Name:      flinkConfigMapVolume,
+				MountPath: ssoProxyConfigPath,
+				ReadOnly:  true,
+			},
+		},
+	}
+}
+
+// Gets the OAuth2 proxy config which proxies authenticated requests to the
+// JobManager UI port in the same pod.
+func getSSOProxyConfig(oidcConfig *v1beta1.OIDCConfig, uiPort int32) string {
+	var builder strings.Builder
+	builder.WriteString(
+		fmt.Sprintf("http_address = \"0.0.0.0:%d\"\n", ssoProxyPort))
+	builder.WriteString(
+		fmt.Sprintf("upstreams = [ \"http://127.0.0.1:%d/\" ]\n", uiPort))
+	builder.WriteString("provider = \"oidc\"\n")
+	builder.WriteString(
+		fmt.Sprintf("oidc_issuer_url = \"%s\"\n", oidcConfig.IssuerURL))
+	builder.WriteString(
+		fmt.Sprintf("client_id = \"%s\"\n", oidcConfig.ClientID))
+	builder.WriteString("email_domains = [ \"*\" ]\n")
+	return builder.String()
+}
+
+// Converts the JobManager proxy spec to an NGINX container, which listens on
+// the JobManager UI port and reads nginx.conf from the Flink ConfigMap.
+func convertJobManagerProxy(
+	proxy *v1beta1.ProxySpec, uiPort int32) *corev1.Container {
+	if proxy == nil {
+		return nil
+	}
+	return &corev1.Container{
+		Name:  "jobmanager-proxy",
+		Image: proxy.Image,
+		Command: []string{
+			"nginx",
+			"-c", jmProxyConfigPath + "/" + jmProxyConfigFile,
+			"-g", "daemon off;",
+		},
+		Ports: []corev1.ContainerPort{
+			{Name: jmProxyPortName, ContainerPort: uiPort},
+		},
+		VolumeMounts: []corev1.VolumeMount{
+			{
+				Name:      flinkConfigMapVolume,
+				MountPath: jmProxyConfigPath,
+				ReadOnly:  true,
+			},
+		},
+	}
+}
+
+// Gets the nginx.conf of the JobManager proxy rendered from the template.
+func getJobManagerProxyConfig(
+	proxy *v1beta1.ProxySpec, uiPort int32) (string, error) {
+	var configTemplate = proxy.ConfigTemplate
+	if len(configTemplate) == 0 {
+		configTemplate = jmProxyDefaultConfigTemplate
+	}
+	var values = map[string]interface{}{
+		"ProxyPort":      uiPort,
+		"UpstreamPort":   jmProxyUpstreamPort,
+		"RateLimitRPM":   *proxy.RateLimitRPM,
+		"RateLimitBurst": int32(0),
+		"WAF":            proxy.WAF == nil || *proxy.WAF,
+	}
+	if proxy.RateLimitBurst != nil {
+		values["RateLimitBurst"] = *proxy.RateLimitBurst
+	}
+	var builder strings.Builder
+	var tmpl, err = template.New(jmProxyConfigFile).
+		Option("missingkey=error").
+		Parse(configTemplate)
+	if err == nil {
+		err = tmpl.Execute(&builder, values)
+	}
+	if err != nil {
+		return "", fmt.Errorf("invalid jobManagerProxy configTemplate: %v", err)
+	}
+	return builder.String(), nil
+}
+
 // TODO: Wouldn't it be better to create a file, put it in an operator image, and read from them?.
 // Provide logging profiles
 func getLogConf() map[string]string {
@@ -17,6 +17,8 @@ limitations under the License.
 package controllers
 
 import (
+	"encoding/json"
+	"strings"
 	"testing"
 	"time"
 
@@ -28,8 +30,10 @@ import (
 	corev1 "k8s.io/api/core/v1"
 	v1 "k8s.io/api/core/v1"
 	extensionsv1beta1 "k8s.io/api/extensions/v1beta1"
+	rbacv1 "k8s.io/api/rbac/v1"
 	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/util/intstr"
 )
 
@@ -52,7 +56,7 @@ func TestGetDesiredClusterState(t *testing.T) {
 	var memoryOffHeapRatio int32 = 25
 	var memoryOffHeapMin = resource.MustParse("600M")
 	var jobBackoffLimit int32 = 0
-	var jmProbe = corev1.Probe{
+	var jmLivenessProbe = corev1.Probe{
 		Handler: corev1.Handler{
 			TCPSocket: &corev1.TCPSocketAction{
 				Port: intstr.FromInt(int(jmRPCPort)),
@@ -63,7 +67,19 @@ func TestGetDesiredClusterState(t *testing.T) {
 		PeriodSeconds:       60,
 		FailureThreshold:    5,
 	}
-	var tmProbe = corev1.Probe{
+	var jmReadinessProbe = jmLivenessProbe
+	jmReadinessProbe.Handler = corev1.Handler{
+		HTTPGet: &corev1.HTTPGetAction{
+			Path:   "/config",
+			Port:   intstr.FromInt(int(jmUIPort)),
+			Scheme: corev1.URISchemeHTTP,
+		},
+	}
+	jmReadinessProbe.TimeoutSeconds = 5
+	jmReadinessProbe.InitialDelaySeconds = 10
+	jmReadinessProbe.PeriodSeconds = 10
+	jmReadinessProbe.FailureThreshold = 3
+	var tmLivenessProbe = corev1.Probe{
 		Handler: corev1.Handler{
 			TCPSocket: &corev1.TCPSocketAction{
 				Port: intstr.FromInt(int(tmRPCPort)),
@@ -74,6 +90,11 @@ func TestGetDesiredClusterState(t *testing.T) {
 		PeriodSeconds:       60,
 		FailureThreshold:    5,
 	}
+	var tmReadinessProbe = tmLivenessProbe
+	tmReadinessProbe.TimeoutSeconds = 5
+	tmReadinessProbe.InitialDelaySeconds = 10
+	tmReadinessProbe.PeriodSeconds = 10
+	tmReadinessProbe.FailureThreshold = 3
 	// Setup.
 	var cluster = &v1beta1.FlinkCluster{
 		TypeMeta: metav1.TypeMeta{
@@ -245,8 +266,19 @@ func TestGetDesiredClusterState(t *testing.T) {
 								{Name: "query", ContainerPort: jmQueryPort},
 								{Name: "ui", ContainerPort: jmUIPort},
 							},
-							LivenessProbe:  &jmProbe,
-							ReadinessProbe: &jmProbe,
+							LivenessProbe:  &jmLivenessProbe,
+							ReadinessProbe: &jmReadinessProbe,
+							Lifecycle: &corev1.Lifecycle{
+								PreStop: &corev1.Handler{
+									Exec: &corev1.ExecAction{
+										Command: []string{
+											"/bin/sh",
+											"-c",
+											"bin/jobmanager.sh stop; sleep 10",
+										},
+									},
+								},
+							},
 							Env: []corev1.EnvVar{
 								{
 									Name: "JOB_MANAGER_CPU_LIMIT",
@@ -471,6 +503,10 @@ func TestGetDesiredClusterState(t *testing.T) {
 					"cluster":   "flinkjobcluster-sample",
 					"component": "taskmanager",
 				},
+				MatchExpressions: []metav1.LabelSelectorRequirement{{
+					Key:      "pool",
+					Operator: metav1.LabelSelectorOpDoesNotExist,
+				}},
 			},
 			Template: corev1.PodTemplateSpec{
 				ObjectMeta: metav1.ObjectMeta{
@@ -491,8 +527,8 @@ func TestGetDesiredClusterState(t *testing.T) {
 								{Name: "rpc", ContainerPort: 6122},
 								{Name: "query", ContainerPort: 6125},
 							},
-							LivenessProbe:  &tmProbe,
-							ReadinessProbe: &tmProbe,
+							LivenessProbe:  &tmLivenessProbe,
+							ReadinessProbe: &tmReadinessProbe,
 							Env: []corev1.EnvVar{
 								{
 									Name: "TASK_MANAGER_CPU_LIMIT",
@@ -547,9 +583,16 @@ func TestGetDesiredClusterState(t *testing.T) {
 									MountPath: "/etc/gcp_service_account/",
 									ReadOnly:  true,
 								},
+								{Name: "flink-log-volume", MountPath: "/opt/flink/log"},
+							},
+						},
+						corev1.Container{
+							Name:  "sidecar",
+							Image: "alpine",
+							VolumeMounts: []corev1.VolumeMount{
+								{Name: "flink-log-volume", MountPath: "/opt/flink/log"},
 							},
 						},
-						corev1.Container{Name: "sidecar", Image: "alpine"},
 					},
 					Volumes: []corev1.Volume{
 						{
@@ -586,6 +629,44 @@ func TestGetDesiredClusterState(t *testing.T) {
 								},
 							},
 						},
+						{
+							Name: "flink-log-volume",
+							VolumeSource: corev1.VolumeSource{
+								EmptyDir: &corev1.EmptyDirVolumeSource{},
+							},
+						},
+					},
+					Affinity: &corev1.Affinity{
+						PodAntiAffinity: &corev1.PodAntiAffinity{
+							PreferredDuringSchedulingIgnoredDuringExecution: []corev1.WeightedPodAffinityTerm{
+								{
+									Weight: 100,
+									PodAffinityTerm: corev1.PodAffinityTerm{
+										LabelSelector: &metav1.LabelSelector{
+											MatchLabels: map[string]string{
+												"cluster":   "flinkjobcluster-sample",
+												"app":       "flink",
+												"component": "taskmanager",
+											},
+										},
+										TopologyKey: "topology.kubernetes.io/zone",
+									},
+								},
+								{
+									Weight: 50,
+									PodAffinityTerm: corev1.PodAffinityTerm{
+										LabelSelector: &metav1.LabelSelector{
+											MatchLabels: map[string]string{
+												"cluster":   "flinkjobcluster-sample",
+												"app":       "flink",
+												"component": "taskmanager",
+											},
+										},
+										TopologyKey: "kubernetes.io/hostname",
+									},
+								},
+							},
+						},
 					},
 				},
 			},
@@ -822,3 +903,1564 @@ func TestCalFlinkHeapSize(t *testing.T) {
 	flinkHeapSize = calFlinkHeapSize(cluster)
 	assert.Assert(t, len(flinkHeapSize) == 0)
 }
+
+// Gets a minimal session cluster with defaults applied.
+func getTestSessionCluster() *v1beta1.FlinkCluster {
+	var jmReplicas int32 = 1
+	var jmRPCPort int32 = 6123
+	var jmBlobPort int32 = 6124
+	var jmQueryPort int32 = 6125
+	var jmUIPort int32 = 8081
+	var tmDataPort int32 = 6121
+	var tmRPCPort int32 = 6122
+	var tmQueryPort int32 = 6125
+	var memoryOffHeapRatio int32 = 25
+	var memoryOffHeapMin = resource.MustParse("600M")
+	return &v1beta1.FlinkCluster{
+		TypeMeta: metav1.TypeMeta{
+			Kind:       "FlinkCluster",
+			APIVersion: "flinkoperator.k8s.io/v1beta1",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "flinksessioncluster-sample",
+			Namespace: "default",
+		},
+		Spec: v1beta1.FlinkClusterSpec{
+			Image: v1beta1.ImageSpec{Name: "flink:1.8.1"},
+			JobManager: v1beta1.JobManagerSpec{
+				Replicas:    &jmReplicas,
+				AccessScope: v1beta1.AccessScopeCluster,
+				Ports: v1beta1.JobManagerPorts{
+					RPC:   &jmRPCPort,
+					Blob:  &jmBlobPort,
+					Query: &jmQueryPort,
+					UI:    &jmUIPort,
+				},
+				MemoryOffHeapRatio: &memoryOffHeapRatio,
+				MemoryOffHeapMin:   memoryOffHeapMin,
+			},
+			TaskManager: v1beta1.TaskManagerSpec{
+				Replicas: 2,
+				Ports: v1beta1.TaskManagerPorts{
+					Data:  &tmDataPort,
+					RPC:   &tmRPCPort,
+					Query: &tmQueryPort,
+				},
+				MemoryOffHeapRatio: &memoryOffHeapRatio,
+				MemoryOffHeapMin:   memoryOffHeapMin,
+			},
+		},
+	}
+}
+
+func TestGetDesiredClusterStateWithSSO(t *testing.T) {
+	var ssoEnabled = true
+	var cluster = getTestSessionCluster()
+	cluster.Spec.Security = &v1beta1.SecuritySpec{
+		SSOEnabled: &ssoEnabled,
+		OIDCConfig: &v1beta1.OIDCConfig{
+			IssuerURL: "https://accounts.google.com",
+			ClientID:  "my-client-id",
+			ClientSecretRef: corev1.SecretKeySelector{
+				LocalObjectReference: corev1.LocalObjectReference{
+					Name: "oidc-secret",
+				},
+				Key: "client-secret",
+			},
+			CookieSecretRef: corev1.SecretKeySelector{
+				LocalObjectReference: corev1.LocalObjectReference{
+					Name: "oidc-secret",
+				},
+				Key: "cookie-secret",
+			},
+			ProxyImage: "quay.io/oauth2-proxy/oauth2-proxy:v5.1.0",
+		},
+	}
+
+	var desiredState = getDesiredClusterState(cluster, time.Now())
+
+	// Proxy sidecar.
+	var containers = desiredState.JmDeployment.Spec.Template.Spec.Containers
+	assert.Equal(t, len(containers), 2)
+	assert.DeepEqual(
+		t,
+		containers[1],
+		corev1.Container{
+			Name:  "sso-proxy",
+			Image: "quay.io/oauth2-proxy/oauth2-proxy:v5.1.0",
+			Args:  []string{"--config=/etc/oauth2-proxy/oauth2-proxy.cfg"},
+			Ports: []corev1.ContainerPort{
+				{Name: "sso-proxy", ContainerPort: 4180},
+			},
+			Env: []corev1.EnvVar{
+				{
+					Name: "OAUTH2_PROXY_CLIENT_SECRET",
+					ValueFrom: &corev1.EnvVarSource{
+						SecretKeyRef: &corev1.SecretKeySelector{
+							LocalObjectReference: corev1.LocalObjectReference{
+								Name: "oidc-secret",
+							},
+							Key: "client-secret",
+						},
+					},
+				},
+				{
+					Name: "OAUTH2_PROXY_COOKIE_SECRET",
+					ValueFrom: &corev1.EnvVarSource{
+						SecretKeyRef: &corev1.SecretKeySelector{
+							LocalObjectReference: corev1.LocalObjectReference{
+								Name: "oidc-secret",
+							},
+							Key: "cookie-secret",
+						},
+					},
+				},
+			},
+			VolumeMounts: []corev1.VolumeMount{
+				{
+					Name:      "flink-config-volume",
+					MountPath: "/etc/oauth2-proxy",
+					ReadOnly:  true,
+				},
+			},
+		})
+
+	// The UI port of the service targets the proxy.
+	var uiPort = desiredState.JmService.Spec.Ports[3]
+	assert.Equal(t, uiPort.Name, "ui")
+	assert.Equal(t, uiPort.Port, int32(8081))
+	assert.Equal(t, uiPort.TargetPort, intstr.FromString("sso-proxy"))
+
+	// The operator reaches the REST API on the internal port, which targets
+	// Flink directly.
+	var restPort = desiredState.JmService.Spec.Ports[4]
+	assert.Equal(t, restPort.Name, "rest")
+	assert.Equal(t, restPort.Port, int32(18081))
+	assert.Equal(t, restPort.TargetPort, intstr.FromString("ui"))
+	assert.Equal(
+		t,
+		getFlinkAPIBaseURL(cluster),
+		"http://flinksessioncluster-sample-jobmanager.default.svc.cluster.local:18081")
+
+	// Proxy config.
+	var expectedProxyConfig = `http_address = "0.0.0.0:4180"
+upstreams = [ "http://127.0.0.1:8081/" ]
+provider = "oidc"
+oidc_issuer_url = "https://accounts.google.com"
+client_id = "my-client-id"
+email_domains = [ "*" ]
+`
+	assert.Equal(
+		t,
+		desiredState.ConfigMap.Data["oauth2-proxy.cfg"],
+		expectedProxyConfig)
+}
+
+func TestGetDesiredClusterStateWithTrafficSplitting(t *testing.T) {
+	var parallelism int32 = 2
+	var restartPolicy = v1beta1.JobRestartPolicyNever
+	var cluster = getTestSessionCluster()
+	cluster.Spec.JobManager.Ingress = &v1beta1.JobManagerIngressSpec{}
+	cluster.Spec.Networking = &v1beta1.NetworkingSpec{
+		ServiceMesh: &v1beta1.ServiceMeshSpec{
+			TrafficSplitting: &v1beta1.TrafficSplittingSpec{
+				Enabled: true,
+				VersionA: v1beta1.JobSpec{
+					JarFile:       "gs://my-bucket/myjob-a.jar",
+					Parallelism:   &parallelism,
+					RestartPolicy: &restartPolicy,
+				},
+				VersionB: v1beta1.JobSpec{
+					JarFile:       "gs://my-bucket/myjob-b.jar",
+					Parallelism:   &parallelism,
+					RestartPolicy: &restartPolicy,
+				},
+				WeightA: 80,
+			},
+		},
+	}
+
+	var desiredState = getDesiredClusterState(cluster, time.Now())
+
+	// Clusters of version A and B.
+	assert.Assert(t, desiredState.Job == nil)
+	var clusterA = desiredState.ClusterA
+	assert.Equal(
+		t, clusterA.ObjectMeta.Name, "flinksessioncluster-sample-version-a")
+	assert.Equal(t, clusterA.ObjectMeta.Labels["version"], "a")
+	assert.Equal(
+		t, clusterA.ObjectMeta.OwnerReferences[0].Name, "flinksessioncluster-sample")
+	assert.Equal(t, clusterA.Spec.Job.JarFile, "gs://my-bucket/myjob-a.jar")
+	assert.Assert(t, clusterA.Spec.Networking.ServiceMesh.TrafficSplitting == nil)
+	assert.Assert(t, clusterA.Spec.JobManager.Ingress == nil)
+	var clusterB = desiredState.ClusterB
+	assert.Equal(
+		t, clusterB.ObjectMeta.Name, "flinksessioncluster-sample-version-b")
+	assert.Equal(t, clusterB.Spec.Job.JarFile, "gs://my-bucket/myjob-b.jar")
+
+	// The parent spec is not modified.
+	assert.Assert(t, cluster.Spec.Networking.ServiceMesh.TrafficSplitting != nil)
+	assert.Assert(t, cluster.Spec.JobManager.Ingress != nil)
+
+	// VirtualService.
+	var expectedVirtualService = unstructured.Unstructured{
+		Object: map[string]interface{}{
+			"apiVersion": "networking.istio.io/v1alpha3",
+			"kind":       "VirtualService",
+			"metadata": map[string]interface{}{
+				"name":      "flinksessioncluster-sample-traffic-split",
+				"namespace": "default",
+				"labels": map[string]interface{}{
+					"cluster": "flinksessioncluster-sample",
+					"app":     "flink",
+				},
+				"ownerReferences": []interface{}{
+					map[string]interface{}{
+						"apiVersion":         "flinkoperator.k8s.io/v1beta1",
+						"kind":               "FlinkCluster",
+						"name":               "flinksessioncluster-sample",
+						"uid":                "",
+						"controller":         true,
+						"blockOwnerDeletion": false,
+					},
+				},
+			},
+			"spec": map[string]interface{}{
+				"hosts": []interface{}{"flinksessioncluster-sample-jobmanager"},
+				"http": []interface{}{
+					map[string]interface{}{
+						"route": []interface{}{
+							map[string]interface{}{
+								"destination": map[string]interface{}{
+									"host": "flinksessioncluster-sample-version-a-jobmanager",
+								},
+								"weight": int64(80),
+							},
+							map[string]interface{}{
+								"destination": map[string]interface{}{
+									"host": "flinksessioncluster-sample-version-b-jobmanager",
+								},
+								"weight": int64(20),
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+	assert.DeepEqual(t, *desiredState.VirtualService, expectedVirtualService)
+
+	// Disabled.
+	cluster.Spec.Networking.ServiceMesh.TrafficSplitting.Enabled = false
+	desiredState = getDesiredClusterState(cluster, time.Now())
+	assert.Assert(t, desiredState.ClusterA == nil)
+	assert.Assert(t, desiredState.ClusterB == nil)
+	assert.Assert(t, desiredState.VirtualService == nil)
+}
+
+func TestGetDesiredClusterStateWithServiceAccount(t *testing.T) {
+	var cluster = getTestSessionCluster()
+	cluster.Spec.ServiceAccount = &v1beta1.ServiceAccountSpec{
+		Create: true,
+		Name:   "flinksessioncluster-sample-flink",
+		Annotations: map[string]string{
+			"iam.gke.io/gcp-service-account": "flink@my-project.iam.gserviceaccount.com",
+		},
+	}
+
+	var desiredState = getDesiredClusterState(cluster, time.Now())
+
+	// Service account.
+	assert.Equal(
+		t,
+		desiredState.ServiceAccount.ObjectMeta.Name,
+		"flinksessioncluster-sample-flink")
+	assert.DeepEqual(
+		t,
+		desiredState.ServiceAccount.ObjectMeta.Annotations,
+		cluster.Spec.ServiceAccount.Annotations)
+	assert.Equal(
+		t,
+		desiredState.ServiceAccount.ObjectMeta.OwnerReferences[0].Name,
+		"flinksessioncluster-sample")
+
+	// Role and role binding.
+	assert.Equal(
+		t, desiredState.Role.ObjectMeta.Name, "flinksessioncluster-sample-flink")
+	assert.DeepEqual(
+		t,
+		desiredState.RoleBinding.Subjects,
+		[]rbacv1.Subject{
+			{
+				Kind:      "ServiceAccount",
+				Name:      "flinksessioncluster-sample-flink",
+				Namespace: "default",
+			},
+		})
+	assert.DeepEqual(
+		t,
+		desiredState.RoleBinding.RoleRef,
+		rbacv1.RoleRef{
+			APIGroup: "rbac.authorization.k8s.io",
+			Kind:     "Role",
+			Name:     "flinksessioncluster-sample-flink",
+		})
+
+	// Pods run as the service account.
+	assert.Equal(
+		t,
+		desiredState.JmDeployment.Spec.Template.Spec.ServiceAccountName,
+		"flinksessioncluster-sample-flink")
+	assert.Equal(
+		t,
+		desiredState.TmDeployment.Spec.Template.Spec.ServiceAccountName,
+		"flinksessioncluster-sample-flink")
+
+	// Existing service account.
+	cluster.Spec.ServiceAccount = &v1beta1.ServiceAccountSpec{Name: "my-sa"}
+	desiredState = getDesiredClusterState(cluster, time.Now())
+	assert.Assert(t, desiredState.ServiceAccount == nil)
+	assert.Assert(t, desiredState.Role == nil)
+	assert.Assert(t, desiredState.RoleBinding == nil)
+	assert.Equal(
+		t,
+		desiredState.JmDeployment.Spec.Template.Spec.ServiceAccountName,
+		"my-sa")
+}
+
+func TestGetDesiredClusterStateWithKubernetesHA(t *testing.T) {
+	var cluster = getTestSessionCluster()
+	var jmReplicas int32 = 2
+	cluster.Spec.JobManager.Replicas = &jmReplicas
+	cluster.Spec.FlinkProperties = map[string]string{
+		"high-availability":            "kubernetes",
+		"high-availability.storageDir": "gs://my-bucket/ha",
+		"kubernetes.cluster-id":        "other",
+	}
+	cluster.Spec.ServiceAccount = &v1beta1.ServiceAccountSpec{Create: true}
+
+	var desiredState = getDesiredClusterState(cluster, time.Now())
+
+	// The leader ConfigMaps are named after the cluster.
+	var flinkConf = desiredState.ConfigMap.Data["flink-conf.yaml"]
+	assert.Assert(
+		t,
+		strings.Contains(
+			flinkConf, "kubernetes.cluster-id: flinksessioncluster-sample\n"))
+	assert.Assert(t, strings.Contains(flinkConf, "kubernetes.namespace: default\n"))
+
+	// The JobManagers bind to their pod IPs.
+	assert.Equal(t, *desiredState.JmDeployment.Spec.Replicas, int32(2))
+	var jmContainer = desiredState.JmDeployment.Spec.Template.Spec.Containers[0]
+	assert.DeepEqual(t, jmContainer.Args, []string{"jobmanager", "$(POD_IP)"})
+	var podIPEnv *corev1.EnvVar
+	for i := range jmContainer.Env {
+		if jmContainer.Env[i].Name == "POD_IP" {
+			podIPEnv = &jmContainer.Env[i]
+		}
+	}
+	assert.Assert(t, podIPEnv != nil)
+	assert.Equal(t, podIPEnv.ValueFrom.FieldRef.FieldPath, "status.podIP")
+
+	// The JobManagers manage the leader ConfigMaps.
+	assert.DeepEqual(
+		t,
+		desiredState.Role.Rules[0],
+		rbacv1.PolicyRule{
+			APIGroups: []string{""},
+			Resources: []string{"configmaps"},
+			Verbs: []string{
+				"get", "list", "watch", "create", "update", "patch", "delete"},
+		})
+
+	// Without Kubernetes high availability.
+	cluster.Spec.FlinkProperties = nil
+	desiredState = getDesiredClusterState(cluster, time.Now())
+	flinkConf = desiredState.ConfigMap.Data["flink-conf.yaml"]
+	assert.Assert(t, !strings.Contains(flinkConf, "kubernetes.cluster-id"))
+	jmContainer = desiredState.JmDeployment.Spec.Template.Spec.Containers[0]
+	assert.DeepEqual(t, jmContainer.Args, []string{"jobmanager"})
+}
+func TestGetDesiredClusterStateWithHiveDialect(t *testing.T) {
+	var cluster = getTestSessionCluster()
+	cluster.Spec.ExtraClassPath = []string{"/opt/flink/extra/udf.jar"}
+	cluster.Spec.Table = &v1beta1.TableSpec{
+		SQLDialect:       v1beta1.SQLDialectHive,
+		HiveMetastoreURI: "thrift://hive-metastore:9083",
+		HiveConnectorJar: "/opt/flink/opt/flink-connector-hive.jar",
+	}
+
+	var desiredState = getDesiredClusterState(cluster, time.Now())
+
+	// Flink properties.
+	var flinkConf = desiredState.ConfigMap.Data["flink-conf.yaml"]
+	assert.Assert(t, strings.Contains(flinkConf, "table.sql.dialect: hive\n"))
+	assert.Assert(
+		t,
+		strings.Contains(
+			flinkConf, "hive.metastore.uris: thrift://hive-metastore:9083\n"))
+
+	// Classpath.
+	var expectedEnv = corev1.EnvVar{
+		Name:  "HADOOP_CLASSPATH",
+		Value: "/opt/flink/extra/udf.jar:/opt/flink/opt/flink-connector-hive.jar",
+	}
+	assert.Assert(
+		t,
+		hasEnvVar(
+			desiredState.JmDeployment.Spec.Template.Spec.Containers[0].Env,
+			expectedEnv))
+	assert.Assert(
+		t,
+		hasEnvVar(
+			desiredState.TmDeployment.Spec.Template.Spec.Containers[0].Env,
+			expectedEnv))
+
+	// Default dialect.
+	cluster.Spec.ExtraClassPath = nil
+	cluster.Spec.Table = &v1beta1.TableSpec{SQLDialect: v1beta1.SQLDialectDefault}
+	desiredState = getDesiredClusterState(cluster, time.Now())
+	flinkConf = desiredState.ConfigMap.Data["flink-conf.yaml"]
+	assert.Assert(t, !strings.Contains(flinkConf, "table.sql.dialect"))
+	for _, env := range desiredState.JmDeployment.Spec.Template.Spec.Containers[0].Env {
+		assert.Assert(t, env.Name != "HADOOP_CLASSPATH")
+	}
+}
+
+func hasEnvVar(envVars []corev1.EnvVar, expected corev1.EnvVar) bool {
+	for _, env := range envVars {
+		if env.Name == expected.Name && env.Value == expected.Value {
+			return true
+		}
+	}
+	return false
+}
+
+func TestGetDesiredClusterStateWithCheckpointStorage(t *testing.T) {
+	var cluster = getTestSessionCluster()
+	cluster.Spec.CheckpointStorage = &v1beta1.CheckpointStorageSpec{
+		PVCName:      "flinksessioncluster-sample-checkpoints",
+		MountPath:    "/checkpoints",
+		StorageClass: "standard",
+		StorageSize:  resource.MustParse("10Gi"),
+		AccessMode:   corev1.ReadWriteOnce,
+	}
+
+	var desiredState = getDesiredClusterState(cluster, time.Now())
+
+	// PVC.
+	var storageClass = "standard"
+	var pvc = desiredState.CheckpointPVC
+	assert.Equal(
+		t, pvc.ObjectMeta.Name, "flinksessioncluster-sample-checkpoints")
+	assert.Assert(t, len(pvc.ObjectMeta.OwnerReferences) == 0)
+	assert.DeepEqual(t, pvc.Spec.StorageClassName, &storageClass)
+	assert.DeepEqual(
+		t,
+		pvc.Spec.AccessModes,
+		[]corev1.PersistentVolumeAccessMode{corev1.ReadWriteOnce})
+	var storageSize = pvc.Spec.Resources.Requests[corev1.ResourceStorage]
+	assert.Equal(t, storageSize.String(), "10Gi")
+
+	// Volume and mount.
+	var expectedVolume = corev1.Volume{
+		Name: "checkpoint-storage-volume",
+		VolumeSource: corev1.VolumeSource{
+			PersistentVolumeClaim: &corev1.PersistentVolumeClaimVolumeSource{
+				ClaimName: "flinksessioncluster-sample-checkpoints",
+			},
+		},
+	}
+	var expectedMount = corev1.VolumeMount{
+		Name:      "checkpoint-storage-volume",
+		MountPath: "/checkpoints",
+	}
+	for _, podSpec := range []corev1.PodSpec{
+		desiredState.JmDeployment.Spec.Template.Spec,
+		desiredState.TmDeployment.Spec.Template.Spec,
+	} {
+		var volumes = podSpec.Volumes
+		assert.DeepEqual(t, volumes[len(volumes)-1], expectedVolume)
+		var mounts = podSpec.Containers[0].VolumeMounts
+		assert.DeepEqual(t, mounts[len(mounts)-1], expectedMount)
+	}
+
+	// Flink properties.
+	assert.Assert(
+		t,
+		strings.Contains(
+			desiredState.ConfigMap.Data["flink-conf.yaml"],
+			"state.checkpoints.dir: file:///checkpoints\n"))
+
+	// Existing PVC.
+	cluster.Spec.CheckpointStorage.StorageClass = ""
+	desiredState = getDesiredClusterState(cluster, time.Now())
+	assert.Assert(t, desiredState.CheckpointPVC == nil)
+}
+
+func TestGetDesiredClusterStateWithCheckpointConfig(t *testing.T) {
+	var cluster = getTestSessionCluster()
+	cluster.Spec.CheckpointStorage = &v1beta1.CheckpointStorageSpec{
+		PVCName:   "flinksessioncluster-sample-checkpoints",
+		MountPath: "/checkpoints",
+	}
+	cluster.Spec.FlinkProperties = map[string]string{
+		"state.backend":                     "filesystem",
+		"execution.checkpointing.interval":  "10 s",
+		"execution.checkpointing.min-pause": "1000 ms",
+	}
+	cluster.Spec.CheckpointConfig = &v1beta1.CheckpointConfig{
+		IntervalMillis:                   60000,
+		MinPauseBetweenCheckpointsMillis: 1000,
+		MaxConcurrentCheckpoints:         2,
+		StateBackend:                     v1beta1.StateBackendRocksDB,
+		StateBackendStoragePath:          "gs://my-bucket/checkpoints",
+	}
+
+	var desiredState = getDesiredClusterState(cluster, time.Now())
+
+	var flinkConf = desiredState.ConfigMap.Data["flink-conf.yaml"]
+	for _, expected := range []string{
+		"execution.checkpointing.interval: 60000 ms\n",
+		"execution.checkpointing.min-pause: 1000 ms\n",
+		"execution.checkpointing.max-concurrent-checkpoints: 2\n",
+		"state.backend: rocksdb\n",
+		"state.checkpoints.dir: gs://my-bucket/checkpoints\n",
+	} {
+		assert.Assert(t, strings.Contains(flinkConf, expected), expected)
+	}
+	// Only the properties with different values are reported.
+	assert.DeepEqual(
+		t,
+		getOverriddenFlinkProperties(cluster),
+		[]string{"execution.checkpointing.interval", "state.backend"})
+
+	// The memory state backend.
+	cluster.Spec.CheckpointConfig = &v1beta1.CheckpointConfig{
+		StateBackend: v1beta1.StateBackendMemory,
+	}
+	assert.DeepEqual(
+		t,
+		getCheckpointProperties(cluster.Spec.CheckpointConfig),
+		map[string]string{"state.backend": "jobmanager"})
+	assert.Assert(t, getOverriddenFlinkProperties(cluster) != nil)
+}
+
+func TestGetDesiredClusterStateWithSlotsPerTask(t *testing.T) {
+	var slotsPerTask int32 = 4
+	var cluster = getTestSessionCluster()
+	cluster.Spec.FlinkProperties = nil
+	cluster.Spec.TaskManager.SlotsPerTask = &slotsPerTask
+
+	var desiredState = getDesiredClusterState(cluster, time.Now())
+	var flinkConf = desiredState.ConfigMap.Data["flink-conf.yaml"]
+	assert.Assert(
+		t, strings.Contains(flinkConf, "taskmanager.numberOfTaskSlots: 4\n"))
+
+	// The Flink properties take precedence.
+	cluster.Spec.FlinkProperties = map[string]string{
+		"taskmanager.numberOfTaskSlots": "2",
+	}
+	desiredState = getDesiredClusterState(cluster, time.Now())
+	flinkConf = desiredState.ConfigMap.Data["flink-conf.yaml"]
+	assert.Assert(
+		t, strings.Contains(flinkConf, "taskmanager.numberOfTaskSlots: 2\n"))
+}
+
+func TestGetDesiredClusterStateWithVolumeClaimTemplates(t *testing.T) {
+	var cluster = getTestSessionCluster()
+	cluster.Spec.TaskManager.VolumeClaimTemplates = []corev1.PersistentVolumeClaim{{
+		ObjectMeta: metav1.ObjectMeta{Name: "rocksdb"},
+		Spec: corev1.PersistentVolumeClaimSpec{
+			AccessModes: []corev1.PersistentVolumeAccessMode{
+				corev1.ReadWriteOnce},
+			Resources: corev1.ResourceRequirements{
+				Requests: corev1.ResourceList{
+					corev1.ResourceStorage: resource.MustParse("100Gi"),
+				},
+			},
+		},
+	}}
+	cluster.Spec.TaskManager.VolumeMounts = []corev1.VolumeMount{
+		{Name: "rocksdb", MountPath: "/var/lib/rocksdb"},
+	}
+
+	// The TaskManagers run as a StatefulSet instead of a deployment.
+	var desiredState = getDesiredClusterState(cluster, time.Now())
+	assert.Assert(t, desiredState.TmDeployment == nil)
+	var statefulSet = desiredState.TmStatefulSet
+	assert.Assert(t, statefulSet != nil)
+	assert.Equal(t, statefulSet.Name, "flinksessioncluster-sample-taskmanager")
+	assert.Equal(t, *statefulSet.Spec.Replicas, int32(2))
+	assert.Equal(
+		t, statefulSet.Spec.PodManagementPolicy, appsv1.ParallelPodManagement)
+	assert.Equal(t, len(statefulSet.Spec.VolumeClaimTemplates), 1)
+	var claim = statefulSet.Spec.VolumeClaimTemplates[0]
+	assert.Equal(t, claim.Name, "rocksdb")
+	assert.Equal(t, claim.Labels["cluster"], "flinksessioncluster-sample")
+	var container = statefulSet.Spec.Template.Spec.Containers[0]
+	assert.Equal(t, container.Name, "taskmanager")
+	assert.DeepEqual(
+		t,
+		container.VolumeMounts[0],
+		corev1.VolumeMount{Name: "rocksdb", MountPath: "/var/lib/rocksdb"})
+}
+
+func TestGetDesiredClusterStateWithTaskManagerGracePeriod(t *testing.T) {
+	var cluster = getTestSessionCluster()
+	var gracePeriod int64 = 90
+	cluster.Spec.TaskManager.TerminationGracePeriodSeconds = &gracePeriod
+
+	var desiredState = getDesiredClusterState(cluster, time.Now())
+	var podSpec = desiredState.TmDeployment.Spec.Template.Spec
+	assert.DeepEqual(t, podSpec.TerminationGracePeriodSeconds, &gracePeriod)
+	assert.Assert(t, podSpec.Containers[0].Lifecycle == nil)
+
+	// The pre-stop hook stops the TaskManager.
+	cluster.Spec.TaskManager.PreStopHook = true
+	desiredState = getDesiredClusterState(cluster, time.Now())
+	podSpec = desiredState.TmDeployment.Spec.Template.Spec
+	assert.DeepEqual(
+		t,
+		podSpec.Containers[0].Lifecycle.PreStop.Exec.Command,
+		[]string{"/bin/sh", "-c", "bin/taskmanager.sh stop"})
+}
+
+func TestGetDesiredClusterStateWithGracefulShutdownTimeout(t *testing.T) {
+	var cluster = getTestSessionCluster()
+	cluster.Spec.JobManager.GracefulShutdownTimeout = &metav1.Duration{
+		Duration: 90 * time.Second,
+	}
+
+	var desiredState = getDesiredClusterState(cluster, time.Now())
+
+	var podSpec = desiredState.JmDeployment.Spec.Template.Spec
+	var expectedGracePeriod int64 = 90
+	assert.DeepEqual(
+		t, podSpec.TerminationGracePeriodSeconds, &expectedGracePeriod)
+	assert.DeepEqual(
+		t,
+		podSpec.Containers[0].Lifecycle.PreStop.Exec.Command,
+		[]string{"/bin/sh", "-c", "bin/jobmanager.sh stop; sleep 10"})
+	assert.Assert(
+		t,
+		strings.Contains(
+			desiredState.ConfigMap.Data["flink-conf.yaml"],
+			"jobmanager.timeout: 90000 ms\n"))
+}
+
+func TestGetDesiredClusterStateWithProbes(t *testing.T) {
+	var cluster = getTestSessionCluster()
+	var periodSeconds int32 = 5
+	var failureThreshold int32 = 10
+	cluster.Spec.JobManager.Probes = &v1beta1.ProbesSpec{
+		Readiness: &v1beta1.ProbeThresholds{PeriodSeconds: &periodSeconds},
+	}
+	cluster.Spec.TaskManager.Probes = &v1beta1.ProbesSpec{
+		Liveness: &v1beta1.ProbeThresholds{FailureThreshold: &failureThreshold},
+	}
+	cluster.Spec.Security = &v1beta1.SecuritySpec{
+		RESTTLS: &v1beta1.RESTTLSSpec{SecretName: "flink-rest-tls"},
+	}
+
+	var desiredState = getDesiredClusterState(cluster, time.Now())
+
+	// The JobManager liveness probe connects to the RPC port, the readiness
+	// probe requests the config from the REST API.
+	var jmContainer = desiredState.JmDeployment.Spec.Template.Spec.Containers[0]
+	var jmHandler = corev1.Handler{
+		HTTPGet: &corev1.HTTPGetAction{
+			Path:   "/config",
+			Port:   intstr.FromInt(8081),
+			Scheme: corev1.URISchemeHTTPS,
+		},
+	}
+	assert.DeepEqual(
+		t,
+		jmContainer.LivenessProbe,
+		&corev1.Probe{
+			Handler: corev1.Handler{
+				TCPSocket: &corev1.TCPSocketAction{Port: intstr.FromInt(6123)},
+			},
+			TimeoutSeconds:      10,
+			InitialDelaySeconds: 30,
+			PeriodSeconds:       60,
+			FailureThreshold:    5,
+		})
+	assert.DeepEqual(
+		t,
+		jmContainer.ReadinessProbe,
+		&corev1.Probe{
+			Handler:             jmHandler,
+			TimeoutSeconds:      5,
+			InitialDelaySeconds: 10,
+			PeriodSeconds:       5,
+			FailureThreshold:    3,
+		})
+
+	// The kubelet has no client certificate for mutual TLS, the readiness
+	// probe only connects to the REST port.
+	cluster.Spec.FlinkProperties = map[string]string{
+		"security.ssl.rest.authentication-enabled": "true",
+	}
+	desiredState = getDesiredClusterState(cluster, time.Now())
+	jmContainer = desiredState.JmDeployment.Spec.Template.Spec.Containers[0]
+	assert.DeepEqual(
+		t,
+		jmContainer.ReadinessProbe.Handler,
+		corev1.Handler{
+			TCPSocket: &corev1.TCPSocketAction{Port: intstr.FromInt(8081)},
+		})
+	cluster.Spec.FlinkProperties = nil
+	desiredState = getDesiredClusterState(cluster, time.Now())
+
+	// The TaskManager probes connect to the RPC port.
+	var tmContainer = desiredState.TmDeployment.Spec.Template.Spec.Containers[0]
+	var tmHandler = corev1.Handler{
+		TCPSocket: &corev1.TCPSocketAction{Port: intstr.FromInt(6122)},
+	}
+	assert.DeepEqual(
+		t,
+		tmContainer.LivenessProbe,
+		&corev1.Probe{
+			Handler:             tmHandler,
+			TimeoutSeconds:      10,
+			InitialDelaySeconds: 30,
+			PeriodSeconds:       60,
+			FailureThreshold:    10,
+		})
+	assert.DeepEqual(
+		t,
+		tmContainer.ReadinessProbe,
+		&corev1.Probe{
+			Handler:             tmHandler,
+			TimeoutSeconds:      5,
+			InitialDelaySeconds: 10,
+			PeriodSeconds:       10,
+			FailureThreshold:    3,
+		})
+
+	// With the proxy, the probes request the internal REST port.
+	var rateLimitRPM int32 = 30
+	cluster.Spec.Security = nil
+	cluster.Spec.JobManagerProxy = &v1beta1.ProxySpec{
+		Type:         v1beta1.ProxyTypeNginx,
+		RateLimitRPM: &rateLimitRPM,
+	}
+	desiredState = getDesiredClusterState(cluster, time.Now())
+	jmContainer = desiredState.JmDeployment.Spec.Template.Spec.Containers[0]
+	assert.DeepEqual(
+		t,
+		jmContainer.ReadinessProbe.HTTPGet,
+		&corev1.HTTPGetAction{
+			Path:   "/config",
+			Port:   intstr.FromInt(18081),
+			Scheme: corev1.URISchemeHTTP,
+		})
+}
+
+func TestGetDesiredClusterStateWithPythonJob(t *testing.T) {
+	var cluster = getTestSessionCluster()
+	var parallelism int32 = 2
+	cluster.Spec.Job = &v1beta1.JobSpec{
+		PythonScript:       "/opt/flink/job/wordcount.py",
+		PythonRequirements: "apache-beam==2.19.0\n",
+		Args:               []string{"--input", "./README.txt"},
+		Parallelism:        &parallelism,
+	}
+
+	var desiredState = getDesiredClusterState(cluster, time.Now())
+
+	// Requirements in the ConfigMap.
+	assert.Equal(
+		t,
+		desiredState.ConfigMap.Data["requirements.txt"],
+		"apache-beam==2.19.0\n")
+
+	// Job args, volume and mount.
+	var podSpec = desiredState.Job.Spec.Template.Spec
+	assert.DeepEqual(
+		t,
+		podSpec.Containers[0].Args,
+		[]string{
+			"/opt/flink/bin/flink",
+			"run",
+			"--jobmanager",
+			"flinksessioncluster-sample-jobmanager:8081",
+			"--parallelism",
+			"2",
+			"--python",
+			"/opt/flink/job/wordcount.py",
+			"--pyRequirements",
+			"/opt/flink/job/python/requirements.txt",
+			"--input",
+			"./README.txt",
+		})
+	var expectedVolume = corev1.Volume{
+		Name: "python-requirements-volume",
+		VolumeSource: corev1.VolumeSource{
+			ConfigMap: &corev1.ConfigMapVolumeSource{
+				LocalObjectReference: corev1.LocalObjectReference{
+					Name: "flinksessioncluster-sample-configmap",
+				},
+				Items: []corev1.KeyToPath{{
+					Key:  "requirements.txt",
+					Path: "requirements.txt",
+				}},
+			},
+		},
+	}
+	assert.DeepEqual(t, podSpec.Volumes[0], expectedVolume)
+	assert.DeepEqual(
+		t,
+		podSpec.Containers[0].VolumeMounts[0],
+		corev1.VolumeMount{
+			Name:      "python-requirements-volume",
+			MountPath: "/opt/flink/job/python",
+		})
+}
+
+func TestGetDesiredClusterStateWithSQLJob(t *testing.T) {
+	var cluster = getTestSessionCluster()
+	var parallelism int32 = 2
+	var fromSavepoint = "gs://my-bucket/savepoints/savepoint-1"
+	cluster.Spec.Job = &v1beta1.JobSpec{
+		SQLJob: &v1beta1.SQLJobSpec{
+			ConfigMapRef:  "wordcount-sql",
+			StatementFile: "wordcount.sql",
+		},
+		FromSavepoint: &fromSavepoint,
+		Parallelism:   &parallelism,
+	}
+
+	var desiredState = getDesiredClusterState(cluster, time.Now())
+
+	// Job args, properties, volume and mount.
+	var podSpec = desiredState.Job.Spec.Template.Spec
+	assert.DeepEqual(
+		t,
+		podSpec.Containers[0].Args,
+		[]string{
+			"/opt/flink/bin/sql-client.sh",
+			"embedded",
+			"-Dexecution.savepoint.path=gs://my-bucket/savepoints/savepoint-1",
+			"-Djobmanager.rpc.address=flinksessioncluster-sample-jobmanager",
+			"-Dparallelism.default=2",
+			"-Drest.address=flinksessioncluster-sample-jobmanager",
+			"-Drest.port=8081",
+			"-f",
+			"/opt/flink/job/sql/wordcount.sql",
+		})
+	for _, envVar := range podSpec.Containers[0].Env {
+		assert.Assert(t, envVar.Name != "FLINK_PROPERTIES")
+	}
+	var expectedVolume = corev1.Volume{
+		Name: "sql-job-volume",
+		VolumeSource: corev1.VolumeSource{
+			ConfigMap: &corev1.ConfigMapVolumeSource{
+				LocalObjectReference: corev1.LocalObjectReference{
+					Name: "wordcount-sql",
+				},
+				Items: []corev1.KeyToPath{{
+					Key:  "wordcount.sql",
+					Path: "wordcount.sql",
+				}},
+			},
+		},
+	}
+	assert.DeepEqual(t, podSpec.Volumes[0], expectedVolume)
+	assert.DeepEqual(
+		t,
+		podSpec.Containers[0].VolumeMounts[0],
+		corev1.VolumeMount{
+			Name:      "sql-job-volume",
+			MountPath: "/opt/flink/job/sql",
+		})
+}
+
+func TestGetDesiredClusterStateWithJarURI(t *testing.T) {
+	var cluster = getTestSessionCluster()
+	var parallelism int32 = 2
+	cluster.Spec.Job = &v1beta1.JobSpec{
+		JarURI:             "gs://my-bucket/jobs/wordcount.jar",
+		JarFile:            "/opt/flink/job-jar/wordcount.jar",
+		JarDownloaderImage: "google/cloud-sdk",
+		Parallelism:        &parallelism,
+		InitContainers:     []corev1.Container{{Name: "user-init"}},
+	}
+
+	var desiredState = getDesiredClusterState(cluster, time.Now())
+
+	var expectedDownloader = corev1.Container{
+		Name:    "download-jar",
+		Image:   "google/cloud-sdk",
+		Command: []string{"/bin/sh", "-c", jarDownloaderScript},
+		Env: []corev1.EnvVar{
+			{Name: "JAR_URI", Value: "gs://my-bucket/jobs/wordcount.jar"},
+			{Name: "JAR_FILE", Value: "/opt/flink/job-jar/wordcount.jar"},
+		},
+		VolumeMounts: []corev1.VolumeMount{
+			{Name: "job-jar-volume", MountPath: "/opt/flink/job-jar"},
+		},
+	}
+	var expectedVolume = corev1.Volume{
+		Name: "job-jar-volume",
+		VolumeSource: corev1.VolumeSource{
+			EmptyDir: &corev1.EmptyDirVolumeSource{},
+		},
+	}
+
+	// The JobManager downloads the JAR before it starts.
+	var jmPodSpec = desiredState.JmDeployment.Spec.Template.Spec
+	assert.DeepEqual(t, jmPodSpec.InitContainers, []corev1.Container{expectedDownloader})
+	assert.DeepEqual(t, jmPodSpec.Volumes[len(jmPodSpec.Volumes)-1], expectedVolume)
+	var jmMounts = jmPodSpec.Containers[0].VolumeMounts
+	assert.DeepEqual(t, jmMounts[len(jmMounts)-1], expectedDownloader.VolumeMounts[0])
+
+	// The job submitter downloads the JAR before the user init containers.
+	var jobPodSpec = desiredState.Job.Spec.Template.Spec
+	assert.Equal(t, len(jobPodSpec.InitContainers), 2)
+	assert.DeepEqual(t, jobPodSpec.InitContainers[0], expectedDownloader)
+	assert.Equal(t, jobPodSpec.InitContainers[1].Name, "user-init")
+	assert.DeepEqual(t, jobPodSpec.Volumes, []corev1.Volume{expectedVolume})
+	var args = jobPodSpec.Containers[0].Args
+	assert.Equal(t, args[len(args)-1], "/opt/flink/job-jar/wordcount.jar")
+}
+
+func TestGetDesiredClusterStateWithMinReadySeconds(t *testing.T) {
+	var cluster = getTestSessionCluster()
+	cluster.Spec.TaskManager.MinReadySeconds = 30
+	cluster.Spec.TaskManager.Pools = []v1beta1.TaskManagerPoolSpec{
+		{Name: "memory", Replicas: 1},
+	}
+
+	var desiredState = getDesiredClusterState(cluster, time.Now())
+
+	assert.Equal(t, desiredState.TmDeployment.Spec.MinReadySeconds, int32(30))
+	assert.Equal(
+		t, desiredState.TmPools["memory"].Spec.MinReadySeconds, int32(30))
+	assert.Equal(t, desiredState.JmDeployment.Spec.MinReadySeconds, int32(0))
+}
+
+func TestGetDesiredClusterStateWithAffinity(t *testing.T) {
+	var cluster = getTestSessionCluster()
+	cluster.Spec.TaskManager.Replicas = 3
+	var nodeAffinity = &corev1.Affinity{
+		NodeAffinity: &corev1.NodeAffinity{
+			RequiredDuringSchedulingIgnoredDuringExecution: &corev1.NodeSelector{
+				NodeSelectorTerms: []corev1.NodeSelectorTerm{
+					{
+						MatchExpressions: []corev1.NodeSelectorRequirement{
+							{
+								Key:      "cloud.google.com/gke-nodepool",
+								Operator: corev1.NodeSelectorOpIn,
+								Values:   []string{"flink"},
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+	cluster.Spec.JobManager.Affinity = nodeAffinity
+
+	// The TaskManagers are spread across zones and nodes by default.
+	var desiredState = getDesiredClusterState(cluster, time.Now())
+	assert.DeepEqual(
+		t, desiredState.JmDeployment.Spec.Template.Spec.Affinity, nodeAffinity)
+	var tmAffinity = desiredState.TmDeployment.Spec.Template.Spec.Affinity
+	assert.Assert(t, tmAffinity != nil && tmAffinity.PodAntiAffinity != nil)
+	var terms = tmAffinity.PodAntiAffinity.
+		PreferredDuringSchedulingIgnoredDuringExecution
+	assert.Equal(t, len(terms), 2)
+	assert.Equal(t, terms[0].Weight, int32(100))
+	assert.Equal(
+		t, terms[0].PodAffinityTerm.TopologyKey, "topology.kubernetes.io/zone")
+	assert.Equal(t, terms[1].Weight, int32(50))
+	assert.Equal(
+		t, terms[1].PodAffinityTerm.TopologyKey, "kubernetes.io/hostname")
+	for _, term := range terms {
+		assert.DeepEqual(
+			t,
+			term.PodAffinityTerm.LabelSelector.MatchLabels,
+			desiredState.TmDeployment.Spec.Selector.MatchLabels)
+	}
+
+	// The TaskManager affinity in the spec replaces the default.
+	cluster.Spec.TaskManager.Affinity = nodeAffinity
+	desiredState = getDesiredClusterState(cluster, time.Now())
+	assert.DeepEqual(
+		t, desiredState.TmDeployment.Spec.Template.Spec.Affinity, nodeAffinity)
+
+	// The affinity doesn't change with suspension.
+	cluster.Spec.TaskManager.Affinity = nil
+	desiredState = getDesiredClusterState(cluster, time.Now())
+	var affinity = desiredState.TmDeployment.Spec.Template.Spec.Affinity
+	cluster.Spec.Suspend = true
+	desiredState = getDesiredClusterState(cluster, time.Now())
+	assert.Equal(t, *desiredState.TmDeployment.Spec.Replicas, int32(0))
+	assert.DeepEqual(
+		t, desiredState.TmDeployment.Spec.Template.Spec.Affinity, affinity)
+	cluster.Spec.Suspend = false
+
+	// No spreading for a single TaskManager.
+	cluster.Spec.TaskManager.Replicas = 1
+	desiredState = getDesiredClusterState(cluster, time.Now())
+	assert.Assert(t, desiredState.TmDeployment.Spec.Template.Spec.Affinity == nil)
+
+	// Unless it is autoscaled up to more TaskManagers.
+	var maxReplicas int32 = 4
+	cluster.Spec.TaskManager.MaxReplicas = &maxReplicas
+	desiredState = getDesiredClusterState(cluster, time.Now())
+	assert.Assert(t, desiredState.TmDeployment.Spec.Template.Spec.Affinity != nil)
+}
+
+func TestGetDesiredClusterStateWithTolerations(t *testing.T) {
+	var cluster = getTestSessionCluster()
+	var tolerations = []corev1.Toleration{
+		{
+			Key:      "flink",
+			Operator: corev1.TolerationOpEqual,
+			Value:    "true",
+			Effect:   corev1.TaintEffectNoSchedule,
+		},
+	}
+	var nodeSelector = map[string]string{"dedicated": "flink"}
+	cluster.Spec.JobManager.Tolerations = tolerations
+	cluster.Spec.JobManager.NodeSelector = nodeSelector
+	cluster.Spec.TaskManager.Tolerations = tolerations
+	cluster.Spec.TaskManager.NodeSelector = nodeSelector
+	cluster.Spec.TaskManager.Pools = []v1beta1.TaskManagerPoolSpec{
+		{Name: "highmem", Replicas: 1}}
+
+	var desiredState = getDesiredClusterState(cluster, time.Now())
+	var jmPodSpec = desiredState.JmDeployment.Spec.Template.Spec
+	assert.DeepEqual(t, jmPodSpec.Tolerations, tolerations)
+	assert.DeepEqual(t, jmPodSpec.NodeSelector, nodeSelector)
+	var tmPodSpec = desiredState.TmDeployment.Spec.Template.Spec
+	assert.DeepEqual(t, tmPodSpec.Tolerations, tolerations)
+	assert.DeepEqual(t, tmPodSpec.NodeSelector, nodeSelector)
+
+	// The pools inherit them from the TaskManager spec.
+	var poolPodSpec = desiredState.TmPools["highmem"].Spec.Template.Spec
+	assert.DeepEqual(t, poolPodSpec.Tolerations, tolerations)
+	assert.DeepEqual(t, poolPodSpec.NodeSelector, nodeSelector)
+}
+
+func TestGetDesiredClusterStateWithTaskManagerPools(t *testing.T) {
+	var cluster = getTestSessionCluster()
+	cluster.Spec.TaskManager.Pools = []v1beta1.TaskManagerPoolSpec{
+		{
+			Name:     "cpu",
+			Replicas: 2,
+			Resources: &corev1.ResourceRequirements{
+				Limits: corev1.ResourceList{
+					corev1.ResourceCPU:    resource.MustParse("4"),
+					corev1.ResourceMemory: resource.MustParse("2Gi"),
+				},
+			},
+		},
+		{
+			Name:         "memory",
+			Replicas:     1,
+			NodeSelector: map[string]string{"pool": "highmem"},
+		},
+	}
+
+	var desiredState = getDesiredClusterState(cluster, time.Now())
+	assert.Equal(t, len(desiredState.TmPools), 2)
+
+	// Pool with its own resources.
+	var cpuPool = desiredState.TmPools["cpu"]
+	assert.Equal(
+		t, cpuPool.ObjectMeta.Name, "flinksessioncluster-sample-taskmanager-cpu")
+	assert.Equal(t, *cpuPool.Spec.Replicas, int32(2))
+	var expectedLabels = map[string]string{
+		"cluster":   "flinksessioncluster-sample",
+		"app":       "flink",
+		"component": "taskmanager",
+		"pool":      "cpu",
+	}
+	assert.DeepEqual(t, cpuPool.Spec.Selector.MatchLabels, expectedLabels)
+	assert.DeepEqual(
+		t, cpuPool.Spec.Template.ObjectMeta.Labels, expectedLabels)
+	var cpuContainer = cpuPool.Spec.Template.Spec.Containers[0]
+	assert.Equal(t, cpuContainer.Resources.Limits.Cpu().String(), "4")
+	assert.Equal(t, cpuContainer.Resources.Limits.Memory().String(), "2Gi")
+	assert.Assert(
+		t,
+		hasEnvVar(
+			cpuContainer.Env,
+			corev1.EnvVar{Name: "FLINK_TM_HEAP", Value: "1548m"}))
+	assert.DeepEqual(
+		t,
+		cpuPool.Spec.Template.Spec.NodeSelector,
+		cluster.Spec.TaskManager.NodeSelector)
+
+	// Pool inheriting the resources.
+	var memoryPool = desiredState.TmPools["memory"]
+	assert.Equal(
+		t,
+		memoryPool.ObjectMeta.Name,
+		"flinksessioncluster-sample-taskmanager-memory")
+	assert.Equal(
+		t,
+		memoryPool.Spec.Template.Spec.Containers[0].Resources.Limits.Memory().String(),
+		cluster.Spec.TaskManager.Resources.Limits.Memory().String())
+	assert.DeepEqual(
+		t,
+		memoryPool.Spec.Template.Spec.NodeSelector,
+		map[string]string{"pool": "highmem"})
+
+	// The default TaskManager deployment is unchanged.
+	assert.Equal(
+		t,
+		desiredState.TmDeployment.ObjectMeta.Name,
+		"flinksessioncluster-sample-taskmanager")
+	_, ok := desiredState.TmDeployment.Spec.Selector.MatchLabels["pool"]
+	assert.Assert(t, !ok)
+}
+
+func TestGetDesiredClusterStateSuspended(t *testing.T) {
+	var cluster = getTestSessionCluster()
+	cluster.Spec.TaskManager.Pools = []v1beta1.TaskManagerPoolSpec{
+		{Name: "cpu", Replicas: 2},
+	}
+	cluster.Spec.Suspend = true
+
+	var desiredState = getDesiredClusterState(cluster, time.Now())
+	assert.Equal(t, *desiredState.JmDeployment.Spec.Replicas, int32(0))
+	assert.Equal(t, *desiredState.TmDeployment.Spec.Replicas, int32(0))
+	assert.Equal(t, *desiredState.TmPools["cpu"].Spec.Replicas, int32(0))
+	assert.Equal(t, *cluster.Spec.JobManager.Replicas, int32(1))
+
+	// Resumed.
+	cluster.Spec.Suspend = false
+	desiredState = getDesiredClusterState(cluster, time.Now())
+	assert.Equal(t, *desiredState.JmDeployment.Spec.Replicas, int32(1))
+	assert.Equal(
+		t,
+		*desiredState.TmDeployment.Spec.Replicas,
+		cluster.Spec.TaskManager.Replicas)
+	assert.Equal(t, *desiredState.TmPools["cpu"].Spec.Replicas, int32(2))
+}
+
+func TestAddInheritedLabels(t *testing.T) {
+	var cluster = getTestSessionCluster()
+	var desiredState = getDesiredClusterState(cluster, time.Now())
+	var selector = desiredState.TmDeployment.Spec.Selector.MatchLabels["component"]
+
+	addInheritedLabels(&desiredState, map[string]string{"team": "data"})
+
+	assert.Equal(t, desiredState.JmDeployment.Labels["team"], "data")
+	assert.Equal(
+		t, desiredState.JmDeployment.Spec.Template.Labels["team"], "data")
+	assert.Equal(t, desiredState.TmDeployment.Labels["team"], "data")
+	assert.Equal(
+		t, desiredState.TmDeployment.Spec.Template.Labels["team"], "data")
+	assert.Equal(t, desiredState.JmService.Labels["team"], "data")
+	assert.Equal(t, desiredState.ConfigMap.Labels["team"], "data")
+	assert.Equal(
+		t,
+		desiredState.TmDeployment.Annotations[inheritedLabelsAnnotation],
+		"team")
+	var _, inherited = desiredState.TmDeployment.Spec.Template.Annotations[inheritedLabelsAnnotation]
+	assert.Assert(t, !inherited)
+
+	// Selectors are not changed.
+	var _, ok = desiredState.TmDeployment.Spec.Selector.MatchLabels["team"]
+	assert.Assert(t, !ok)
+	assert.Equal(
+		t,
+		desiredState.TmDeployment.Spec.Selector.MatchLabels["component"],
+		selector)
+}
+
+func TestGetDesiredClusterStateWithFlinkConfigMap(t *testing.T) {
+	var cluster = getTestSessionCluster()
+	cluster.Spec.FlinkConfigMap = "my-flink-config"
+
+	// The external ConfigMap is mounted instead of the generated config.
+	var desiredState = getDesiredClusterState(cluster, time.Now())
+	var _, ok = desiredState.ConfigMap.Data["flink-conf.yaml"]
+	assert.Assert(t, !ok)
+	for _, deployment := range []*appsv1.Deployment{
+		desiredState.JmDeployment, desiredState.TmDeployment} {
+		var volumes = deployment.Spec.Template.Spec.Volumes
+		var confVol = volumes[len(volumes)-1]
+		assert.Equal(t, confVol.Name, "flink-config-volume")
+		assert.DeepEqual(
+			t,
+			confVol.VolumeSource,
+			corev1.VolumeSource{
+				Projected: &corev1.ProjectedVolumeSource{
+					Sources: []corev1.VolumeProjection{{
+						ConfigMap: &corev1.ConfigMapProjection{
+							LocalObjectReference: corev1.LocalObjectReference{
+								Name: "my-flink-config",
+							},
+						},
+					}},
+				},
+			})
+	}
+
+	// The proxy config is still projected from the generated ConfigMap.
+	var rateLimitRPM int32 = 30
+	cluster.Spec.JobManagerProxy = &v1beta1.ProxySpec{
+		Type:         v1beta1.ProxyTypeNginx,
+		RateLimitRPM: &rateLimitRPM,
+		Image:        "nginx:1.17",
+	}
+	desiredState = getDesiredClusterState(cluster, time.Now())
+	assert.Assert(t, len(desiredState.ConfigMap.Data["nginx.conf"]) > 0)
+	var volumes = desiredState.JmDeployment.Spec.Template.Spec.Volumes
+	var sources = volumes[len(volumes)-1].Projected.Sources
+	assert.Equal(t, len(sources), 2)
+	assert.DeepEqual(
+		t,
+		*sources[1].ConfigMap,
+		corev1.ConfigMapProjection{
+			LocalObjectReference: corev1.LocalObjectReference{
+				Name: "flinksessioncluster-sample-configmap",
+			},
+			Items: []corev1.KeyToPath{{Key: "nginx.conf", Path: "nginx.conf"}},
+		})
+}
+
+func TestAddFlinkConfigChecksum(t *testing.T) {
+	var cluster = getTestSessionCluster()
+	cluster.Spec.FlinkConfigMap = "my-flink-config"
+	var configMap = &corev1.ConfigMap{
+		Data: map[string]string{
+			"flink-conf.yaml":          "taskmanager.numberOfTaskSlots: 1\n",
+			"log4j-console.properties": "rootLogger.level = INFO\n",
+		},
+	}
+
+	var desiredState = getDesiredClusterState(cluster, time.Now())
+	addFlinkConfigChecksum(&desiredState, configMap)
+	var checksum = desiredState.JmDeployment.Spec.Template.Annotations[flinkConfigChecksumAnnotation]
+	assert.Equal(t, len(checksum), 64)
+	assert.Equal(
+		t,
+		desiredState.TmDeployment.Spec.Template.Annotations[flinkConfigChecksumAnnotation],
+		checksum)
+
+	// The checksum changes with the data.
+	configMap.Data["flink-conf.yaml"] = "taskmanager.numberOfTaskSlots: 2\n"
+	assert.Assert(t, getConfigMapChecksum(configMap) != checksum)
+
+	// No checksum without the external ConfigMap.
+	desiredState = getDesiredClusterState(cluster, time.Now())
+	addFlinkConfigChecksum(&desiredState, nil)
+	var _, ok = desiredState.JmDeployment.Spec.Template.Annotations[flinkConfigChecksumAnnotation]
+	assert.Assert(t, !ok)
+}
+
+func TestGetDesiredTaskManagerDeploymentWithEmptyDirVolumes(t *testing.T) {
+	var cluster = getTestSessionCluster()
+	cluster.Spec.TaskManager.EmptyDirVolumes = []v1beta1.EmptyDirVolumeSpec{
+		{
+			Name:      "rocksdb-local",
+			MountPath: "/tmp/rocksdb",
+			SizeLimit: resource.MustParse("1Gi"),
+			Medium:    corev1.StorageMediumMemory,
+		},
+		{Name: "scratch", MountPath: "/tmp/scratch"},
+	}
+
+	var deployment = getDesiredTaskManagerDeployment(cluster)
+	var volumes = map[string]corev1.Volume{}
+	for _, volume := range deployment.Spec.Template.Spec.Volumes {
+		volumes[volume.Name] = volume
+	}
+	var emptyDir = volumes["rocksdb-local"].EmptyDir
+	assert.Equal(t, emptyDir.Medium, corev1.StorageMediumMemory)
+	assert.Equal(t, emptyDir.SizeLimit.String(), "1Gi")
+	emptyDir = volumes["scratch"].EmptyDir
+	assert.Equal(t, emptyDir.Medium, corev1.StorageMediumDefault)
+	assert.Assert(t, emptyDir.SizeLimit == nil)
+	var mounts = map[string]string{}
+	for _, mount := range deployment.Spec.Template.Spec.Containers[0].VolumeMounts {
+		mounts[mount.Name] = mount.MountPath
+	}
+	assert.Equal(t, mounts["rocksdb-local"], "/tmp/rocksdb")
+	assert.Equal(t, mounts["scratch"], "/tmp/scratch")
+
+	// The medium is serialized in the manifest of the deployment.
+	var manifest, err = json.Marshal(deployment)
+	assert.NilError(t, err)
+	assert.Assert(
+		t,
+		strings.Contains(
+			string(manifest),
+			`"emptyDir":{"medium":"Memory","sizeLimit":"1Gi"}`))
+}
+
+func TestGetDesiredTaskManagerDeploymentWithResourceID(t *testing.T) {
+	var cluster = getTestSessionCluster()
+	var container = getDesiredTaskManagerDeployment(cluster).
+		Spec.Template.Spec.Containers[0]
+	assert.DeepEqual(t, container.Args, []string{"taskmanager"})
+
+	// Flink 1.12 or later uses the pod name as the resource ID.
+	cluster.Spec.FlinkVersion = "1.12"
+	container = getDesiredTaskManagerDeployment(cluster).
+		Spec.Template.Spec.Containers[0]
+	assert.DeepEqual(
+		t,
+		container.Args,
+		[]string{"taskmanager", "-Dtaskmanager.resource-id=$(POD_NAME)"})
+	assert.Equal(t, container.Env[0].Name, "POD_NAME")
+	assert.Equal(t, container.Env[0].ValueFrom.FieldRef.FieldPath, "metadata.name")
+}
+
+func TestAddRestartedAt(t *testing.T) {
+	var cluster = getTestSessionCluster()
+	var desiredState = getDesiredClusterState(cluster, time.Now())
+	addRestartedAt(&desiredState, cluster)
+	var _, ok = desiredState.JmDeployment.Spec.Template.Annotations[restartedAtAnnotation]
+	assert.Assert(t, !ok)
+
+	cluster.Annotations = map[string]string{
+		restartedAtAnnotation: "2020-01-01T00:00:00Z",
+	}
+	desiredState = getDesiredClusterState(cluster, time.Now())
+	addRestartedAt(&desiredState, cluster)
+	assert.Equal(
+		t,
+		desiredState.JmDeployment.Spec.Template.Annotations[restartedAtAnnotation],
+		"2020-01-01T00:00:00Z")
+	assert.Equal(
+		t,
+		desiredState.TmDeployment.Spec.Template.Annotations[restartedAtAnnotation],
+		"2020-01-01T00:00:00Z")
+}
+
+func TestGetDesiredClusterStateWithStreamGraph(t *testing.T) {
+	var parallelism int32 = 2
+	var restartPolicy = v1beta1.JobRestartPolicyNever
+	var cluster = getTestSessionCluster()
+	cluster.Spec.Job = &v1beta1.JobSpec{
+		JarFile:         "/opt/flink/job/wordcount.jar",
+		StreamGraphJSON: `{"nodes":[{"id":1}]}`,
+		Parallelism:     &parallelism,
+		RestartPolicy:   &restartPolicy,
+	}
+
+	var desiredState = getDesiredClusterState(cluster, time.Now())
+
+	// No job submitter, the stream graph is submitted by the operator.
+	assert.Assert(t, desiredState.Job == nil)
+	assert.Assert(t, desiredState.JmDeployment != nil)
+}
+
+func TestGetDesiredClusterStateWithSidecars(t *testing.T) {
+	var cluster = getTestSessionCluster()
+	cluster.Spec.JobManager.Sidecars = []corev1.Container{
+		{Name: "fluentd", Image: "fluentd"},
+	}
+	cluster.Spec.TaskManager.Sidecars = []corev1.Container{
+		{
+			Name:  "filebeat",
+			Image: "filebeat",
+			VolumeMounts: []corev1.VolumeMount{
+				{Name: "flink-log-volume", MountPath: "/var/log/flink"},
+			},
+		},
+	}
+
+	var desiredState = getDesiredClusterState(cluster, time.Now())
+
+	var jmPodSpec = desiredState.JmDeployment.Spec.Template.Spec
+	assert.Equal(t, len(jmPodSpec.Containers), 2)
+	assert.Equal(t, jmPodSpec.Containers[1].Name, "fluentd")
+	var logMount = corev1.VolumeMount{
+		Name: "flink-log-volume", MountPath: "/opt/flink/log"}
+	assert.DeepEqual(
+		t,
+		jmPodSpec.Containers[0].VolumeMounts[len(jmPodSpec.Containers[0].VolumeMounts)-1],
+		logMount)
+	assert.DeepEqual(
+		t, jmPodSpec.Containers[1].VolumeMounts, []corev1.VolumeMount{logMount})
+
+	// The volume mount in the sidecar spec is kept.
+	var tmPodSpec = desiredState.TmDeployment.Spec.Template.Spec
+	assert.DeepEqual(
+		t,
+		tmPodSpec.Containers[1].VolumeMounts,
+		cluster.Spec.TaskManager.Sidecars[0].VolumeMounts)
+
+	// The spec is not modified.
+	assert.Assert(t, cluster.Spec.JobManager.Sidecars[0].VolumeMounts == nil)
+}
+
+func TestGetDesiredClusterStateWithJobManagerProxy(t *testing.T) {
+	var rateLimitRPM int32 = 30
+	var rateLimitBurst int32 = 5
+	var cluster = getTestSessionCluster()
+	cluster.Spec.JobManagerProxy = &v1beta1.ProxySpec{
+		Type:           v1beta1.ProxyTypeNginx,
+		RateLimitRPM:   &rateLimitRPM,
+		RateLimitBurst: &rateLimitBurst,
+		Image:          "nginx:1.17",
+	}
+
+	var desiredState = getDesiredClusterState(cluster, time.Now())
+
+	// The Flink REST server listens on the internal port.
+	var containers = desiredState.JmDeployment.Spec.Template.Spec.Containers
+	assert.Equal(t, len(containers), 2)
+	assert.DeepEqual(
+		t,
+		containers[0].Ports[3],
+		corev1.ContainerPort{Name: "ui", ContainerPort: 18081})
+
+	// Proxy sidecar.
+	assert.DeepEqual(
+		t,
+		containers[1],
+		corev1.Container{
+			Name:  "jobmanager-proxy",
+			Image: "nginx:1.17",
+			Command: []string{
+				"nginx", "-c", "/etc/nginx/flink/nginx.conf", "-g", "daemon off;"},
+			Ports: []corev1.ContainerPort{
+				{Name: "ui-proxy", ContainerPort: 8081},
+			},
+			VolumeMounts: []corev1.VolumeMount{
+				{
+					Name:      "flink-config-volume",
+					MountPath: "/etc/nginx/flink",
+					ReadOnly:  true,
+				},
+			},
+		})
+
+	// The UI port of the service targets the proxy.
+	var uiPort = desiredState.JmService.Spec.Ports[3]
+	assert.Equal(t, uiPort.Name, "ui")
+	assert.Equal(t, uiPort.Port, int32(8081))
+	assert.Equal(t, uiPort.TargetPort, intstr.FromString("ui-proxy"))
+
+	// Flink and proxy config.
+	var configData = desiredState.ConfigMap.Data
+	assert.Assert(
+		t, strings.Contains(configData["flink-conf.yaml"], "rest.port: 18081\n"))
+	var proxyConfig = configData["nginx.conf"]
+	for _, expected := range []string{
+		"limit_req_zone $limit_key zone=flink_api:10m rate=30r/m;",
+		"listen 8081;",
+		"location /jars/upload {\n      limit_req zone=flink_api burst=5 nodelay;\n      proxy_pass http://127.0.0.1:18081;",
+		"location /jobs {\n      limit_req zone=flink_api burst=5 nodelay;\n      proxy_pass http://127.0.0.1:18081;",
+		"if ($request_method !~ ^(GET|HEAD|POST|PUT|PATCH|DELETE|OPTIONS)$) {\n      return 405;",
+		"<script",
+	} {
+		assert.Assert(
+			t,
+			strings.Contains(proxyConfig, expected),
+			"nginx.conf does not contain %q:\n%v", expected, proxyConfig)
+	}
+
+	// Without the WAF.
+	var waf = false
+	cluster.Spec.JobManagerProxy.WAF = &waf
+	desiredState = getDesiredClusterState(cluster, time.Now())
+	proxyConfig = desiredState.ConfigMap.Data["nginx.conf"]
+	assert.Assert(t, !strings.Contains(proxyConfig, "return 403;"), proxyConfig)
+	assert.Assert(t, strings.Contains(proxyConfig, "listen 8081;\n    location /jars/upload {"), proxyConfig)
+}
+
+func TestGetDesiredClusterStateWithJobManagerProxyConfigTemplate(t *testing.T) {
+	var rateLimitRPM int32 = 10
+	var cluster = getTestSessionCluster()
+	cluster.Spec.JobManagerProxy = &v1beta1.ProxySpec{
+		Type:           v1beta1.ProxyTypeNginx,
+		ConfigTemplate: "listen {{.ProxyPort}}; upstream {{.UpstreamPort}}; rate {{.RateLimitRPM}}r/m;",
+		RateLimitRPM:   &rateLimitRPM,
+		Image:          "nginx:1.17",
+	}
+
+	var desiredState = getDesiredClusterState(cluster, time.Now())
+
+	assert.Equal(
+		t,
+		desiredState.ConfigMap.Data["nginx.conf"],
+		"listen 8081; upstream 18081; rate 10r/m;")
+
+	// A template which fails to render is an error.
+	cluster.Spec.JobManagerProxy.ConfigTemplate = "listen {{.Port}};"
+	var _, err = getJobManagerProxyConfig(cluster.Spec.JobManagerProxy, 8081)
+	assert.Assert(t, err != nil, "err is not expected to be nil")
+	assert.Assert(
+		t,
+		strings.HasPrefix(err.Error(), "invalid jobManagerProxy configTemplate: "),
+		err.Error())
+}
+
+func TestGetDesiredClusterStateWithNativeMode(t *testing.T) {
+	var parallelism int32 = 2
+	var restartPolicy = v1beta1.JobRestartPolicyNever
+	var cluster = getTestSessionCluster()
+	cluster.Spec.Image.Name = "flink:1.12"
+	cluster.Spec.DeploymentMode = v1beta1.DeploymentModeNative
+	cluster.Spec.ServiceAccount = &v1beta1.ServiceAccountSpec{
+		Name:   "flink",
+		Create: true,
+	}
+	cluster.Spec.Job = &v1beta1.JobSpec{
+		JarFile:       "/opt/flink/job-jar/wordcount.jar",
+		Parallelism:   &parallelism,
+		RestartPolicy: &restartPolicy,
+	}
+
+	var desiredState = getDesiredClusterState(cluster, time.Now())
+
+	// Only the ConfigMap, the job submitter and the RBAC resources.
+	assert.Assert(t, desiredState.JmDeployment == nil)
+	assert.Assert(t, desiredState.JmService == nil)
+	assert.Assert(t, desiredState.TmDeployment == nil)
+	assert.Assert(t, desiredState.ServiceAccount != nil)
+	assert.Assert(t, desiredState.RoleBinding != nil)
+	assert.DeepEqual(
+		t,
+		desiredState.Role.Rules[1],
+		rbacv1.PolicyRule{
+			APIGroups: []string{"apps"},
+			Resources: []string{"deployments"},
+			Verbs: []string{
+				"get", "list", "watch", "create", "update", "patch", "delete"},
+		})
+
+	// The properties of the application cluster.
+	var flinkConf = parseFlinkConfig(
+		desiredState.ConfigMap.Data["flink-conf.yaml"])
+	assert.Equal(
+		t, flinkConf["kubernetes.cluster-id"], "flinksessioncluster-sample")
+	assert.Equal(t, flinkConf["kubernetes.namespace"], "default")
+	assert.Equal(t, flinkConf["kubernetes.container.image"], "flink:1.12")
+	assert.Equal(t, flinkConf["kubernetes.service-account"], "flink")
+	assert.Equal(t, flinkConf["jobmanager.rpc.address"], "")
+
+	// The submitter deploys the application cluster with the mounted config.
+	var jobContainer = desiredState.Job.Spec.Template.Spec.Containers[0]
+	assert.DeepEqual(
+		t,
+		jobContainer.Args,
+		[]string{
+			"/opt/flink/bin/flink",
+			"run-application",
+			"--target",
+			"kubernetes-application",
+			"--parallelism",
+			"2",
+			"local:///opt/flink/job-jar/wordcount.jar",
+		})
+	assert.DeepEqual(
+		t,
+		jobContainer.VolumeMounts,
+		[]corev1.VolumeMount{
+			{Name: "flink-config-volume", MountPath: "/opt/flink/conf"},
+		})
+}
@@ -0,0 +1,300 @@
+/*
+Copyright 2019 Google LLC.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+// Collection of diagnostics bundles. When the cluster enters one of the
+// trigger states, a collector job dumps the threads and the heaps of the
+// JVMs of the cluster pods, reads their logs and the Flink REST metrics, and
+// uploads them as a tarball. The job is kept while the cluster stays in the
+// trigger state, so that the bundle is collected only once, and deleted after
+// the cluster leaves it, so that the next entry triggers a new collection.
+// The collector runs with its own service account, the Flink pods are not
+// allowed to exec into each other.
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	v1beta1 "github.com/googlecloudplatform/flink-operator/api/v1beta1"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// The annotation of the collector job recording the URI of the bundle.
+const diagnosticsBundleURIAnnotation = "flinkoperator.k8s.io/diagnostics-bundle-uri"
+
+// The script of the collector. Each step is best effort, e.g., the
+// JobManager REST API is unavailable when the JobManager is down, what can be
+// collected is still uploaded. The JVM is found through /proc, because the
+// Flink images are based on a JRE, which has no jps, jstack or jmap. Without
+// jstack, the JVM prints the thread dump to the log on SIGQUIT, so the logs
+// are read after it; without jmap, the heap is not dumped.
+var diagnosticsBundleScript = `set -u
+bundle="/tmp/$(basename "$BUNDLE_URI" .tar.gz)"
+mkdir -p "$bundle/pods" "$bundle/metrics"
+pods=$(kubectl get pods -n "$NAMESPACE" \
+  -l "cluster=$CLUSTER_NAME,app=flink,component!=diagnostics" \
+  -o jsonpath='{.items[*].metadata.name}')
+for pod in $pods; do
+  kubectl get pod -n "$NAMESPACE" "$pod" -o yaml > "$bundle/pods/$pod.yaml"
+  pid=$(kubectl exec -n "$NAMESPACE" "$pod" -- sh -c \
+    'for d in /proc/[0-9]*; do
+       case "$(readlink "$d/exe" 2>/dev/null)" in
+         */java) echo "${d#/proc/}"; break ;;
+       esac
+     done')
+  if [ -n "$pid" ]; then
+    if kubectl exec -n "$NAMESPACE" "$pod" -- sh -c 'command -v jstack' \
+      > /dev/null; then
+      kubectl exec -n "$NAMESPACE" "$pod" -- jstack -l "$pid" \
+        > "$bundle/pods/$pod.jstack"
+    else
+      kubectl exec -n "$NAMESPACE" "$pod" -- kill -3 "$pid" && sleep 2
+    fi
+    if kubectl exec -n "$NAMESPACE" "$pod" -- sh -c 'command -v jmap' \
+      > /dev/null; then
+      kubectl exec -n "$NAMESPACE" "$pod" -- \
+        jmap -dump:live,format=b,file=/tmp/heap.hprof "$pid" \
+        && kubectl exec -n "$NAMESPACE" "$pod" -- \
+          sh -c 'cat /tmp/heap.hprof && rm -f /tmp/heap.hprof' \
+          > "$bundle/pods/$pod.hprof"
+    fi
+  fi
+  kubectl logs -n "$NAMESPACE" "$pod" --all-containers > "$bundle/pods/$pod.log"
+  kubectl logs -n "$NAMESPACE" "$pod" --all-containers --previous \
+    > "$bundle/pods/$pod.previous.log" 2>/dev/null
+done
+for path in overview jobs/overview taskmanagers jobmanager/config; do
+  curl -s -f "$JOBMANAGER_URL/$path" \
+    > "$bundle/metrics/$(echo "$path" | tr / _).json"
+done
+ids=$(curl -s -f "$JOBMANAGER_URL/jobmanager/metrics" \
+  | tr ',' '\n' | sed -n 's/.*"id":"\([^"]*\)".*/\1/p' | paste -s -d , -)
+curl -s -f "$JOBMANAGER_URL/jobmanager/metrics?get=$ids" \
+  > "$bundle/metrics/jobmanager_metrics.json"
+tar -czf "$bundle.tar.gz" -C /tmp "$(basename "$bundle")"
+case "$BUNDLE_URI" in
+  gs://*) gsutil cp "$bundle.tar.gz" "$BUNDLE_URI" ;;
+  s3://*) aws s3 cp "$bundle.tar.gz" "$BUNDLE_URI" ;;
+  *) curl -s -f -T "$bundle.tar.gz" "$BUNDLE_URI" ;;
+esac
+`
+
+// Checks whether the cluster is in a state triggering the collection of a
+// diagnostics bundle.
+func isDiagnosticsBundleTriggered(cluster *v1beta1.FlinkCluster) bool {
+	var diagnosticsBundle = cluster.Spec.DiagnosticsBundle
+	if diagnosticsBundle == nil {
+		return false
+	}
+	for _, state := range diagnosticsBundle.TriggerOnState {
+		if state == cluster.Status.State {
+			return true
+		}
+	}
+	return false
+}
+
+// Gets the URI of a new diagnostics bundle, unique for the cluster, the
+// state and the time of the collection.
+func getDiagnosticsBundleURI(cluster *v1beta1.FlinkCluster, now time.Time) string {
+	return fmt.Sprintf(
+		"%v/%v-%v-%v.tar.gz",
+		strings.TrimSuffix(cluster.Spec.DiagnosticsBundle.UploadURI, "/"),
+		cluster.ObjectMeta.Name,
+		strings.ToLower(cluster.Status.State),
+		now.UTC().Format("20060102-150405"))
+}
+
+// Gets the desired collector job of the diagnostics bundle, nil if the
+// cluster is not in a trigger state.
+func getDesiredDiagnosticsJob(
+	cluster *v1beta1.FlinkCluster, now time.Time) *batchv1.Job {
+	if !isDiagnosticsBundleTriggered(cluster) {
+		return nil
+	}
+
+	var clusterSpec = cluster.Spec
+	var clusterName = cluster.ObjectMeta.Name
+	var bundleURI = getDiagnosticsBundleURI(cluster, now)
+	var labels = map[string]string{
+		"cluster":   clusterName,
+		"app":       "flink",
+		"component": "diagnostics",
+	}
+	var jobManagerURL = fmt.Sprintf(
+		"http://%s:%d",
+		NewResourceNamer(cluster).JobManagerServiceName(),
+		getFlinkAPIPort(cluster))
+	var envVars = []corev1.EnvVar{
+		{Name: "CLUSTER_NAME", Value: clusterName},
+		{Name: "NAMESPACE", Value: cluster.ObjectMeta.Namespace},
+		{Name: "JOBMANAGER_URL", Value: jobManagerURL},
+		{Name: "BUNDLE_URI", Value: bundleURI},
+	}
+	var volumes []corev1.Volume
+	var volumeMounts []corev1.VolumeMount
+
+	// GCP service account config, for uploading to GCS.
+	var saVolume, saMount, saEnv = convertGCPConfig(clusterSpec.GCPConfig)
+	if saVolume != nil {
+		volumes = append(volumes, *saVolume)
+	}
+	if saMount != nil {
+		volumeMounts = append(volumeMounts, *saMount)
+	}
+	if saEnv != nil {
+		envVars = append(envVars, *saEnv)
+	}
+
+	// The bundle is collected once, a failed collection is not retried.
+	var backoffLimit int32 = 0
+	return &batchv1.Job{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: cluster.ObjectMeta.Namespace,
+			Name:      NewResourceNamer(cluster).DiagnosticsJobName(),
+			OwnerReferences: []metav1.OwnerReference{
+				toOwnerReference(cluster)},
+			Labels: labels,
+			Annotations: map[string]string{
+				diagnosticsBundleURIAnnotation: bundleURI,
+			},
+		},
+		Spec: batchv1.JobSpec{
+			Template: corev1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{Labels: labels},
+				Spec: corev1.PodSpec{
+					Containers: []corev1.Container{
+						{
+							Name:         "collector",
+							Image:        clusterSpec.DiagnosticsBundle.Image,
+							Command:      []string{"/bin/sh", "-c", diagnosticsBundleScript},
+							Env:          envVars,
+							VolumeMounts: volumeMounts,
+						},
+					},
+					RestartPolicy:      corev1.RestartPolicyNever,
+					Volumes:            volumes,
+					ServiceAccountName: NewResourceNamer(cluster).DiagnosticsServiceAccountName(),
+				},
+			},
+			BackoffLimit: &backoffLimit,
+		},
+	}
+}
+
+// Gets the desired service account of the collector, which is created
+// regardless of the service account of the cluster.
+func getDesiredDiagnosticsServiceAccount(
+	cluster *v1beta1.FlinkCluster) *corev1.ServiceAccount {
+	var diagnosticsBundle = cluster.Spec.DiagnosticsBundle
+	if diagnosticsBundle == nil {
+		return nil
+	}
+	return &corev1.ServiceAccount{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: cluster.ObjectMeta.Namespace,
+			Name:      NewResourceNamer(cluster).DiagnosticsServiceAccountName(),
+			OwnerReferences: []metav1.OwnerReference{
+				toOwnerReference(cluster)},
+			Labels: map[string]string{
+				"cluster": cluster.ObjectMeta.Name,
+				"app":     "flink",
+			},
+			Annotations: diagnosticsBundle.ServiceAccountAnnotations,
+		},
+	}
+}
+
+// Gets the desired Role of the collector, which lists the pods, reads their
+// logs and execs into them.
+func getDesiredDiagnosticsRole(cluster *v1beta1.FlinkCluster) *rbacv1.Role {
+	if cluster.Spec.DiagnosticsBundle == nil {
+		return nil
+	}
+	return &rbacv1.Role{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: cluster.ObjectMeta.Namespace,
+			Name:      NewResourceNamer(cluster).DiagnosticsRoleName(),
+			OwnerReferences: []metav1.OwnerReference{
+				toOwnerReference(cluster)},
+			Labels: map[string]string{
+				"cluster": cluster.ObjectMeta.Name,
+				"app":     "flink",
+			},
+		},
+		Rules: []rbacv1.PolicyRule{
+			{
+				APIGroups: []string{""},
+				Resources: []string{"pods"},
+				Verbs:     []string{"get", "list"},
+			},
+			{
+				APIGroups: []string{""},
+				Resources: []string{"pods/log"},
+				Verbs:     []string{"get"},
+			},
+			{
+				APIGroups: []string{""},
+				Resources: []string{"pods/exec"},
+				Verbs:     []string{"create"},
+			},
+		},
+	}
+}
+
+// Gets the desired RoleBinding which binds the Role of the collector to its
+// service account.
+func getDesiredDiagnosticsRoleBinding(
+	cluster *v1beta1.FlinkCluster) *rbacv1.RoleBinding {
+	if cluster.Spec.DiagnosticsBundle == nil {
+		return nil
+	}
+	var namer = NewResourceNamer(cluster)
+	return &rbacv1.RoleBinding{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: cluster.ObjectMeta.Namespace,
+			Name:      namer.DiagnosticsRoleBindingName(),
+			OwnerReferences: []metav1.OwnerReference{
+				toOwnerReference(cluster)},
+			Labels: map[string]string{
+				"cluster": cluster.ObjectMeta.Name,
+				"app":     "flink",
+			},
+		},
+		Subjects: []rbacv1.Subject{
+			{
+				Kind:      rbacv1.ServiceAccountKind,
+				Name:      namer.DiagnosticsServiceAccountName(),
+				Namespace: cluster.ObjectMeta.Namespace,
+			},
+		},
+		RoleRef: rbacv1.RoleRef{
+			APIGroup: rbacv1.GroupName,
+			Kind:     "Role",
+			Name:     namer.DiagnosticsRoleName(),
+		},
+	}
+}
+
+// Checks whether the job has succeeded or failed.
+func isJobFinished(job *batchv1.Job) bool {
+	return job.Status.Succeeded > 0 || job.Status.Failed > 0
+}
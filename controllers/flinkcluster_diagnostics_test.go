@@ -0,0 +1,189 @@
+/*
+Copyright 2019 Google LLC.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	v1beta1 "github.com/googlecloudplatform/flink-operator/api/v1beta1"
+	"gotest.tools/assert"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+func getTestDiagnosticsCluster() *v1beta1.FlinkCluster {
+	var cluster = getTestSessionCluster()
+	cluster.Spec.DiagnosticsBundle = &v1beta1.DiagnosticsBundleSpec{
+		TriggerOnState: []string{v1beta1.ClusterStateFailed},
+		UploadURI:      "gs://my-bucket/diagnostics/",
+		Image:          "google/cloud-sdk",
+	}
+	// The service account of the cluster is not created by the operator.
+	cluster.Spec.ServiceAccount = &v1beta1.ServiceAccountSpec{
+		Name: "flink",
+	}
+	cluster.Status.State = v1beta1.ClusterStateFailed
+	return cluster
+}
+
+func TestGetDesiredDiagnosticsJob(t *testing.T) {
+	var now = time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	var cluster = getTestDiagnosticsCluster()
+
+	var job = getDesiredDiagnosticsJob(cluster, now)
+	assert.Assert(t, job != nil)
+	var bundleURI = "gs://my-bucket/diagnostics/" +
+		"flinksessioncluster-sample-failed-20200102-030405.tar.gz"
+	assert.Equal(t, job.Name, "flinksessioncluster-sample-diagnostics")
+	assert.Equal(t, job.Annotations[diagnosticsBundleURIAnnotation], bundleURI)
+	assert.Equal(t, job.Labels["component"], "diagnostics")
+	assert.Equal(t, *job.Spec.BackoffLimit, int32(0))
+	var podSpec = job.Spec.Template.Spec
+	assert.Equal(
+		t, podSpec.ServiceAccountName, "flinksessioncluster-sample-diagnostics")
+	assert.Equal(t, podSpec.RestartPolicy, corev1.RestartPolicyNever)
+	assert.Equal(t, podSpec.Containers[0].Image, "google/cloud-sdk")
+	assert.DeepEqual(
+		t,
+		podSpec.Containers[0].Env,
+		[]corev1.EnvVar{
+			{Name: "CLUSTER_NAME", Value: "flinksessioncluster-sample"},
+			{Name: "NAMESPACE", Value: "default"},
+			{
+				Name:  "JOBMANAGER_URL",
+				Value: "http://flinksessioncluster-sample-jobmanager:8081",
+			},
+			{Name: "BUNDLE_URI", Value: bundleURI},
+		})
+
+	// Only the service account of the collector can exec into pods.
+	var serviceAccount = getDesiredDiagnosticsServiceAccount(cluster)
+	assert.Equal(t, serviceAccount.Name, podSpec.ServiceAccountName)
+	var role = getDesiredDiagnosticsRole(cluster)
+	assert.Equal(t, len(role.Rules), 3)
+	assert.DeepEqual(t, role.Rules[2].Resources, []string{"pods/exec"})
+	var roleBinding = getDesiredDiagnosticsRoleBinding(cluster)
+	assert.Equal(t, roleBinding.RoleRef.Name, role.Name)
+	assert.Equal(t, roleBinding.Subjects[0].Name, serviceAccount.Name)
+	cluster.Spec.ServiceAccount.Create = true
+	assert.Equal(t, len(getDesiredRole(cluster).Rules), 1)
+
+	// Not a trigger state.
+	cluster.Status.State = v1beta1.ClusterStateRunning
+	assert.Assert(t, getDesiredDiagnosticsJob(cluster, now) == nil)
+
+	// Not enabled.
+	cluster.Status.State = v1beta1.ClusterStateFailed
+	cluster.Spec.DiagnosticsBundle = nil
+	assert.Assert(t, getDesiredDiagnosticsJob(cluster, now) == nil)
+	assert.Assert(t, getDesiredDiagnosticsServiceAccount(cluster) == nil)
+	assert.Assert(t, getDesiredDiagnosticsRole(cluster) == nil)
+	assert.Assert(t, getDesiredDiagnosticsRoleBinding(cluster) == nil)
+}
+
+func TestReconcileDiagnosticsBundle(t *testing.T) {
+	var cluster = getTestDiagnosticsCluster()
+	var testScheme = runtime.NewScheme()
+	assert.NilError(t, scheme.AddToScheme(testScheme))
+	assert.NilError(t, v1beta1.AddToScheme(testScheme))
+	var k8sClient = fake.NewFakeClientWithScheme(testScheme, cluster)
+	var recorder = record.NewFakeRecorder(10)
+	var reconciler = ClusterReconciler{
+		k8sClient: k8sClient,
+		context:   context.Background(),
+		log:       log.Log,
+		recorder:  recorder,
+		observed:  ObservedClusterState{cluster: cluster},
+		desired:   getDesiredClusterState(cluster, time.Now()),
+	}
+	var getJob = func() (*batchv1.Job, error) {
+		var job = &batchv1.Job{}
+		var err = k8sClient.Get(
+			context.Background(),
+			types.NamespacedName{
+				Namespace: "default",
+				Name:      "flinksessioncluster-sample-diagnostics",
+			},
+			job)
+		return job, err
+	}
+
+	// The cluster enters the Failed state, the collector runs with its own
+	// service account.
+	assert.NilError(t, reconciler.reconcileDiagnosticsBundle())
+	var job, err = getJob()
+	assert.NilError(t, err)
+	var serviceAccount = &corev1.ServiceAccount{}
+	var role = &rbacv1.Role{}
+	var roleBinding = &rbacv1.RoleBinding{}
+	for _, obj := range []runtime.Object{serviceAccount, role, roleBinding} {
+		err = k8sClient.Get(
+			context.Background(),
+			types.NamespacedName{
+				Namespace: "default",
+				Name:      "flinksessioncluster-sample-diagnostics",
+			},
+			obj)
+		assert.NilError(t, err)
+	}
+	reconciler.observed.diagnosticsSA = serviceAccount
+	reconciler.observed.diagnosticsRole = role
+	reconciler.observed.diagnosticsRoleBinding = roleBinding
+	var bundleURI = job.Annotations[diagnosticsBundleURIAnnotation]
+	var updated = &v1beta1.FlinkCluster{}
+	err = k8sClient.Get(
+		context.Background(),
+		types.NamespacedName{Namespace: "default", Name: cluster.Name},
+		updated)
+	assert.NilError(t, err)
+	assert.Equal(t, updated.Status.LastDiagnosticsBundleURI, bundleURI)
+	// The observed cluster is refreshed for the later status writes.
+	assert.Equal(
+		t,
+		reconciler.observed.cluster.ResourceVersion,
+		updated.ResourceVersion)
+	assert.Equal(
+		t, reconciler.observed.cluster.Status.LastDiagnosticsBundleURI, bundleURI)
+	assert.Equal(
+		t,
+		<-recorder.Events,
+		"Normal DiagnosticsBundle Collecting diagnostics bundle to "+bundleURI)
+
+	// The bundle is collected once while the cluster stays Failed.
+	job.Status.Succeeded = 1
+	reconciler.observed.diagnosticsJob = job
+	assert.NilError(t, reconciler.reconcileDiagnosticsBundle())
+	assert.Equal(t, len(recorder.Events), 0)
+
+	// The finished job is deleted after the cluster leaves the Failed state.
+	updated.Status.State = v1beta1.ClusterStateRunning
+	reconciler.observed.cluster = updated
+	reconciler.desired = getDesiredClusterState(updated, time.Now())
+	assert.NilError(t, reconciler.reconcileDiagnosticsBundle())
+	_, err = getJob()
+	assert.Assert(t, errors.IsNotFound(err))
+}
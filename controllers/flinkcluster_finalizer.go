@@ -0,0 +1,262 @@
+/*
+Copyright 2019 Google LLC.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+// Cleanup of the child resources on cluster deletion. Garbage collection by
+// owner references is not enough when the operator crashes in the middle of a
+// reconcile, e.g., after creating a resource but before recording it in the
+// status, so the finalizer sweeps the child resources explicitly and is only
+// removed after a sweep confirms that none is left.
+
+import (
+	"fmt"
+	"time"
+
+	v1beta1 "github.com/googlecloudplatform/flink-operator/api/v1beta1"
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	extensionsv1beta1 "k8s.io/api/extensions/v1beta1"
+	networkingv1 "k8s.io/api/networking/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	clusterFinalizer = "flinkoperator.k8s.io/cleanup"
+
+	// Interval of the sweeps while waiting for the child resources to be
+	// deleted.
+	cleanupRequeueInterval = 5 * time.Second
+)
+
+// A kind of the child resources, with the labels which select the child
+// resources of the cluster among those of the namespace.
+type childResourceKind struct {
+	list   runtime.Object
+	labels map[string]string
+}
+
+// Gets the kinds of the child resources with empty lists. The checkpoint PVC is
+// not included, because checkpoints survive the deletion of the cluster. The
+// version clusters of traffic splitting are not labeled by the name of the
+// cluster, so they are selected among the version clusters of the namespace.
+func getChildResourceKinds(cluster *v1beta1.FlinkCluster) []childResourceKind {
+	var labels = map[string]string{
+		"cluster": cluster.Name,
+		"app":     "flink",
+	}
+	var virtualServices = &unstructured.UnstructuredList{}
+	virtualServices.SetGroupVersionKind(
+		virtualServiceGVK.GroupVersion().WithKind(virtualServiceGVK.Kind + "List"))
+	return []childResourceKind{
+		{list: &appsv1.DeploymentList{}, labels: labels},
+		{list: &appsv1.StatefulSetList{}, labels: labels},
+		{list: &corev1.ServiceList{}, labels: labels},
+		{list: &corev1.ConfigMapList{}, labels: labels},
+		{list: &batchv1.JobList{}, labels: labels},
+		{list: &extensionsv1beta1.IngressList{}, labels: labels},
+		{list: &networkingv1.NetworkPolicyList{}, labels: labels},
+		{list: &corev1.ServiceAccountList{}, labels: labels},
+		{list: &rbacv1.RoleList{}, labels: labels},
+		{list: &rbacv1.RoleBindingList{}, labels: labels},
+		{list: virtualServices, labels: labels},
+		{list: &v1beta1.FlinkClusterList{}, labels: map[string]string{"app": "flink"}},
+	}
+}
+
+func hasFinalizer(cluster *v1beta1.FlinkCluster, finalizer string) bool {
+	for _, f := range cluster.ObjectMeta.Finalizers {
+		if f == finalizer {
+			return true
+		}
+	}
+	return false
+}
+
+func removeFinalizer(cluster *v1beta1.FlinkCluster, finalizer string) {
+	var finalizers []string
+	for _, f := range cluster.ObjectMeta.Finalizers {
+		if f != finalizer {
+			finalizers = append(finalizers, f)
+		}
+	}
+	cluster.ObjectMeta.Finalizers = finalizers
+}
+
+// Checks whether the object is a child resource of the cluster, either owned
+// by the cluster or labeled by the operator for the cluster and not owned at
+// all. The objects owned by others, e.g., by a previous cluster of the same
+// name, are left to the garbage collector.
+func isChildResource(cluster *v1beta1.FlinkCluster, object metav1.Object) bool {
+	var owners = object.GetOwnerReferences()
+	for _, owner := range owners {
+		if owner.UID == cluster.UID {
+			return true
+		}
+	}
+	return len(owners) == 0 && hasLabels(object.GetLabels(), map[string]string{
+		"cluster": cluster.Name,
+		"app":     "flink",
+	})
+}
+
+// Gets the manager of the finalizers, which writes through the client of the
+// handler, e.g., the dry-run client.
+func (handler *FlinkClusterHandler) getFinalizerManager() *FinalizerManager {
+	return &FinalizerManager{
+		k8sClient: handler.k8sClient,
+		apiReader: handler.apiReader,
+		log:       handler.log,
+	}
+}
+
+// Cleans up the cluster being deleted. The cluster is in the Stopping state
+// until the sweep of the child resources confirms that none is left, then the
+// finalizer is removed so that the cluster can be deleted.
+func (handler *FlinkClusterHandler) finalizeCluster(
+	cluster *v1beta1.FlinkCluster) (ctrl.Result, error) {
+	var log = handler.log
+	if !hasFinalizer(cluster, clusterFinalizer) {
+		return ctrl.Result{}, nil
+	}
+
+	if cluster.Status.State != v1beta1.ClusterStateStopping {
+		cluster.Status.State = v1beta1.ClusterStateStopping
+		var err = handler.k8sClient.Status().Update(handler.context, cluster)
+		if err != nil {
+			log.Error(err, "Failed to update cluster status")
+			return ctrl.Result{}, err
+		}
+	}
+
+	var remaining, err = handler.deleteChildResources(cluster)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	err = handler.deleteGrafanaDashboards(cluster)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	if remaining > 0 {
+		log.Info(
+			"Waiting for child resources to be deleted", "remaining", remaining)
+		return ctrl.Result{
+			Requeue: true, RequeueAfter: cleanupRequeueInterval}, nil
+	}
+
+	err = handler.getFinalizerManager().EnsureFinalizerRemoved(
+		handler.context, cluster, clusterFinalizer)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	if handler.batcher != nil {
+		handler.batcher.Forget(cluster.UID)
+	}
+	log.Info("Child resources deleted, finalizer removed")
+	return ctrl.Result{}, nil
+}
+
+// Sweeps the child resources of the cluster through the API server instead of
+// the cache, and deletes those which are not being deleted yet. The API server
+// doesn't support the owner index of the cache, so the child resources are
+// listed by their labels. Returns the number of child resources found, which
+// are all gone when it is 0.
+func (handler *FlinkClusterHandler) deleteChildResources(
+	cluster *v1beta1.FlinkCluster) (int, error) {
+	var log = handler.log
+	var remaining = 0
+	var propagation = client.PropagationPolicy(metav1.DeletePropagationBackground)
+	for _, kind := range getChildResourceKinds(cluster) {
+		var list = kind.list
+		var err = handler.apiReader.List(
+			handler.context,
+			list,
+			client.InNamespace(cluster.Namespace),
+			client.MatchingLabels(kind.labels))
+		// The kind is not served, e.g., Istio is not installed.
+		if meta.IsNoMatchError(err) {
+			continue
+		}
+		if err != nil {
+			log.Error(err, "Failed to list child resources")
+			return 0, err
+		}
+		objects, err := meta.ExtractList(list)
+		if err != nil {
+			return 0, err
+		}
+		for _, object := range objects {
+			var accessor, err = meta.Accessor(object)
+			if err != nil {
+				return 0, err
+			}
+			if !isChildResource(cluster, accessor) {
+				continue
+			}
+			remaining++
+			if accessor.GetDeletionTimestamp() != nil {
+				continue
+			}
+			log.Info(
+				"Deleting child resource",
+				"type", fmt.Sprintf("%T", object),
+				"name", accessor.GetName())
+			err = handler.k8sClient.Delete(handler.context, object, propagation)
+			err = client.IgnoreNotFound(err)
+			if err != nil {
+				log.Error(
+					err, "Failed to delete child resource", "name", accessor.GetName())
+				return 0, err
+			}
+		}
+	}
+	return remaining, nil
+}
+
+// Deletes the Grafana dashboard ConfigMaps of the cluster, which are not
+// swept with the child resources because they might be in other namespaces,
+// where they are found by the names in the spec and the status instead.
+func (handler *FlinkClusterHandler) deleteGrafanaDashboards(
+	cluster *v1beta1.FlinkCluster) error {
+	var log = handler.log
+	var dashboards, err = getGrafanaDashboards(
+		handler.context, handler.apiReader, cluster)
+	if err != nil {
+		log.Error(err, "Failed to get Grafana dashboards")
+		return err
+	}
+	for i := range dashboards {
+		var dashboard = &dashboards[i]
+		log.Info(
+			"Deleting Grafana dashboard",
+			"namespace", dashboard.Namespace,
+			"name", dashboard.Name)
+		err = handler.k8sClient.Delete(handler.context, dashboard)
+		err = client.IgnoreNotFound(err)
+		if err != nil {
+			log.Error(err, "Failed to delete Grafana dashboard")
+			return err
+		}
+	}
+	return nil
+}
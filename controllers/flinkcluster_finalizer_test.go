@@ -0,0 +1,204 @@
+/*
+Copyright 2019 Google LLC.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	v1beta1 "github.com/googlecloudplatform/flink-operator/api/v1beta1"
+	"gotest.tools/assert"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// Fails to list the VirtualServices like the API server without Istio.
+type noIstioReader struct {
+	client.Reader
+}
+
+func (r noIstioReader) List(
+	ctx context.Context, list runtime.Object, opts ...client.ListOption) error {
+	if _, ok := list.(*unstructured.UnstructuredList); ok {
+		return &meta.NoKindMatchError{
+			GroupKind: virtualServiceGVK.GroupKind(),
+		}
+	}
+	return r.Reader.List(ctx, list, opts...)
+}
+
+func TestFinalizeClusterDeletesOrphans(t *testing.T) {
+	var now = metav1.Now()
+	var cluster = getTestSessionCluster()
+	cluster.UID = "cluster-uid"
+	cluster.Finalizers = []string{clusterFinalizer}
+	cluster.DeletionTimestamp = &now
+	cluster.Status.State = v1beta1.ClusterStateRunning
+
+	var clusterLabels = map[string]string{
+		"cluster": cluster.Name,
+		"app":     "flink",
+	}
+	// Not referenced by the status and not owned by the cluster.
+	var orphanService = &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: "default",
+			Name:      "flinksessioncluster-sample-jobmanager",
+			Labels:    clusterLabels,
+		},
+	}
+	// Owned by the cluster.
+	var ownedDeployment = &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace:       "default",
+			Name:            "flinksessioncluster-sample-taskmanager",
+			Labels:          clusterLabels,
+			OwnerReferences: []metav1.OwnerReference{toOwnerReference(cluster)},
+		},
+	}
+	var ownedStatefulSet = &appsv1.StatefulSet{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace:       "default",
+			Name:            "flinksessioncluster-sample-taskmanager",
+			Labels:          clusterLabels,
+			OwnerReferences: []metav1.OwnerReference{toOwnerReference(cluster)},
+		},
+	}
+	var ownedNetworkPolicy = &networkingv1.NetworkPolicy{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace:       "default",
+			Name:            "flinksessioncluster-sample",
+			Labels:          clusterLabels,
+			OwnerReferences: []metav1.OwnerReference{toOwnerReference(cluster)},
+		},
+	}
+	var versionCluster = &v1beta1.FlinkCluster{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace:       "default",
+			Name:            "flinksessioncluster-sample-a",
+			Labels:          map[string]string{"app": "flink", "version": "a"},
+			OwnerReferences: []metav1.OwnerReference{toOwnerReference(cluster)},
+		},
+	}
+	// Of a previous cluster of the same name.
+	var previousConfigMap = &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: "default",
+			Name:      "flinksessioncluster-sample-configmap",
+			Labels:    clusterLabels,
+			OwnerReferences: []metav1.OwnerReference{
+				{Kind: "FlinkCluster", Name: cluster.Name, UID: "previous-uid"}},
+		},
+	}
+	// Labeled like a version cluster, but not owned by the cluster.
+	var unownedCluster = &v1beta1.FlinkCluster{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: "default",
+			Name:      "unowned",
+			Labels:    map[string]string{"app": "flink"},
+		},
+	}
+	// Of another cluster.
+	var otherService = &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: "default",
+			Name:      "other-jobmanager",
+			Labels:    map[string]string{"cluster": "other", "app": "flink"},
+		},
+	}
+	// Checkpoints survive the deletion of the cluster.
+	var checkpointPVC = &corev1.PersistentVolumeClaim{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: "default",
+			Name:      "flinksessioncluster-sample-checkpoints",
+			Labels:    clusterLabels,
+		},
+	}
+
+	var testScheme = runtime.NewScheme()
+	assert.NilError(t, scheme.AddToScheme(testScheme))
+	assert.NilError(t, v1beta1.AddToScheme(testScheme))
+	var k8sClient = fake.NewFakeClientWithScheme(
+		testScheme,
+		cluster,
+		orphanService,
+		ownedDeployment,
+		ownedStatefulSet,
+		ownedNetworkPolicy,
+		versionCluster,
+		previousConfigMap,
+		unownedCluster,
+		otherService,
+		checkpointPVC)
+	var handler = FlinkClusterHandler{
+		k8sClient: k8sClient,
+		apiReader: noIstioReader{k8sClient},
+		context:   context.Background(),
+		log:       log.Log,
+	}
+	var exists = func(obj runtime.Object, name string) bool {
+		var err = k8sClient.Get(
+			context.Background(),
+			types.NamespacedName{Namespace: "default", Name: name},
+			obj)
+		if errors.IsNotFound(err) {
+			return false
+		}
+		assert.NilError(t, err)
+		return true
+	}
+
+	// The first sweep deletes the child resources and waits for confirmation.
+	var result, err = handler.finalizeCluster(cluster)
+	assert.NilError(t, err)
+	assert.Equal(t, result.RequeueAfter, cleanupRequeueInterval)
+	assert.Assert(t, !exists(&corev1.Service{}, orphanService.Name))
+	assert.Assert(t, !exists(&appsv1.Deployment{}, ownedDeployment.Name))
+	assert.Assert(t, !exists(&appsv1.StatefulSet{}, ownedStatefulSet.Name))
+	assert.Assert(
+		t, !exists(&networkingv1.NetworkPolicy{}, ownedNetworkPolicy.Name))
+	assert.Assert(t, !exists(&v1beta1.FlinkCluster{}, versionCluster.Name))
+	assert.Assert(t, exists(&corev1.ConfigMap{}, previousConfigMap.Name))
+	assert.Assert(t, exists(&v1beta1.FlinkCluster{}, unownedCluster.Name))
+	assert.Assert(t, exists(&corev1.Service{}, otherService.Name))
+	assert.Assert(
+		t, exists(&corev1.PersistentVolumeClaim{}, checkpointPVC.Name))
+	var updated = &v1beta1.FlinkCluster{}
+	assert.Assert(t, exists(updated, cluster.Name))
+	assert.Equal(t, updated.Status.State, v1beta1.ClusterStateStopping)
+	assert.DeepEqual(t, updated.Finalizers, []string{clusterFinalizer})
+
+	// The second sweep finds no child resources and removes the finalizer.
+	result, err = handler.finalizeCluster(updated)
+	assert.NilError(t, err)
+	assert.Equal(t, result.RequeueAfter, time.Duration(0))
+	updated = &v1beta1.FlinkCluster{}
+	assert.Assert(t, exists(updated, cluster.Name))
+	assert.Assert(t, !hasFinalizer(updated, clusterFinalizer))
+}
@@ -0,0 +1,297 @@
+/*
+Copyright 2019 Google LLC.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+// Grafana dashboard of the cluster. The dashboard ConfigMap might be in
+// another namespace than the cluster, which owner references can't cross, so
+// it is labeled with the name and namespace of the cluster instead, recorded
+// in the status, and deleted explicitly when the cluster is deleted.
+
+import (
+	"context"
+	"strings"
+
+	v1beta1 "github.com/googlecloudplatform/flink-operator/api/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	// The label of the ConfigMaps which the Grafana sidecar loads dashboards
+	// from.
+	grafanaDashboardLabel = "grafana_dashboard"
+
+	// The labels of the dashboard ConfigMap with the cluster it belongs to.
+	dashboardClusterNameLabel      = "flinkoperator.k8s.io/cluster-name"
+	dashboardClusterNamespaceLabel = "flinkoperator.k8s.io/cluster-namespace"
+
+	// The key of the dashboard JSON in the ConfigMap.
+	grafanaDashboardKey = "flink-cluster.json"
+)
+
+// The dashboard JSON, ${CLUSTER_NAME}, ${CLUSTER_NAMESPACE},
+// ${RESOURCE_PREFIX} and ${FLINK_API_URL} are substituted for each
+// cluster. The panels query
+// the metrics of the Flink Prometheus reporter scraped from the pods of the
+// cluster.
+const grafanaDashboardTemplate = `{
+  "title": "Flink cluster ${CLUSTER_NAMESPACE}/${CLUSTER_NAME}",
+  "uid": "flink-${CLUSTER_NAMESPACE}-${CLUSTER_NAME}",
+  "tags": ["flink", "flink-operator"],
+  "timezone": "browser",
+  "schemaVersion": 16,
+  "refresh": "30s",
+  "time": {"from": "now-1h", "to": "now"},
+  "links": [
+    {
+      "title": "Flink web UI",
+      "type": "link",
+      "url": "${FLINK_API_URL}"
+    }
+  ],
+  "panels": [
+    {
+      "id": 1,
+      "title": "Running jobs",
+      "type": "singlestat",
+      "gridPos": {"x": 0, "y": 0, "w": 6, "h": 4},
+      "targets": [
+        {
+          "expr": "sum(flink_jobmanager_numRunningJobs{namespace=\"${CLUSTER_NAMESPACE}\", pod=~\"${RESOURCE_PREFIX}-jobmanager-.*\"})"
+        }
+      ]
+    },
+    {
+      "id": 2,
+      "title": "Registered TaskManagers",
+      "type": "singlestat",
+      "gridPos": {"x": 6, "y": 0, "w": 6, "h": 4},
+      "targets": [
+        {
+          "expr": "sum(flink_jobmanager_numRegisteredTaskManagers{namespace=\"${CLUSTER_NAMESPACE}\", pod=~\"${RESOURCE_PREFIX}-jobmanager-.*\"})"
+        }
+      ]
+    },
+    {
+      "id": 3,
+      "title": "Available task slots",
+      "type": "singlestat",
+      "gridPos": {"x": 12, "y": 0, "w": 6, "h": 4},
+      "targets": [
+        {
+          "expr": "sum(flink_jobmanager_taskSlotsAvailable{namespace=\"${CLUSTER_NAMESPACE}\", pod=~\"${RESOURCE_PREFIX}-jobmanager-.*\"})"
+        }
+      ]
+    },
+    {
+      "id": 4,
+      "title": "Job restarts",
+      "type": "singlestat",
+      "gridPos": {"x": 18, "y": 0, "w": 6, "h": 4},
+      "targets": [
+        {
+          "expr": "sum(flink_jobmanager_job_numRestarts{namespace=\"${CLUSTER_NAMESPACE}\", pod=~\"${RESOURCE_PREFIX}-jobmanager-.*\"})"
+        }
+      ]
+    },
+    {
+      "id": 5,
+      "title": "Records per second",
+      "type": "graph",
+      "gridPos": {"x": 0, "y": 4, "w": 12, "h": 8},
+      "targets": [
+        {
+          "expr": "sum(flink_taskmanager_job_task_numRecordsInPerSecond{namespace=\"${CLUSTER_NAMESPACE}\", pod=~\"${RESOURCE_PREFIX}-taskmanager-.*\"}) by (task_name)",
+          "legendFormat": "{{task_name}} in"
+        },
+        {
+          "expr": "sum(flink_taskmanager_job_task_numRecordsOutPerSecond{namespace=\"${CLUSTER_NAMESPACE}\", pod=~\"${RESOURCE_PREFIX}-taskmanager-.*\"}) by (task_name)",
+          "legendFormat": "{{task_name}} out"
+        }
+      ]
+    },
+    {
+      "id": 6,
+      "title": "Heap used",
+      "type": "graph",
+      "gridPos": {"x": 12, "y": 4, "w": 12, "h": 8},
+      "targets": [
+        {
+          "expr": "sum(flink_jobmanager_Status_JVM_Memory_Heap_Used{namespace=\"${CLUSTER_NAMESPACE}\", pod=~\"${RESOURCE_PREFIX}-jobmanager-.*\"})",
+          "legendFormat": "JobManager"
+        },
+        {
+          "expr": "sum(flink_taskmanager_Status_JVM_Memory_Heap_Used{namespace=\"${CLUSTER_NAMESPACE}\", pod=~\"${RESOURCE_PREFIX}-taskmanager-.*\"}) by (pod)",
+          "legendFormat": "{{pod}}"
+        }
+      ]
+    },
+    {
+      "id": 7,
+      "title": "Last checkpoint duration",
+      "type": "graph",
+      "gridPos": {"x": 0, "y": 12, "w": 12, "h": 8},
+      "targets": [
+        {
+          "expr": "max(flink_jobmanager_job_lastCheckpointDuration{namespace=\"${CLUSTER_NAMESPACE}\", pod=~\"${RESOURCE_PREFIX}-jobmanager-.*\"})"
+        }
+      ]
+    },
+    {
+      "id": 8,
+      "title": "Garbage collection time",
+      "type": "graph",
+      "gridPos": {"x": 12, "y": 12, "w": 12, "h": 8},
+      "targets": [
+        {
+          "expr": "sum(rate(flink_taskmanager_Status_JVM_GarbageCollector_G1_Young_Generation_Time{namespace=\"${CLUSTER_NAMESPACE}\", pod=~\"${RESOURCE_PREFIX}-taskmanager-.*\"}[1m])) by (pod)",
+          "legendFormat": "{{pod}}"
+        }
+      ]
+    }
+  ]
+}
+`
+
+// Gets the namespace of the Grafana dashboard ConfigMap, the namespace of the
+// cluster unless another one is specified.
+func getGrafanaDashboardNamespace(cluster *v1beta1.FlinkCluster) string {
+	var monitoring = cluster.Spec.Monitoring
+	if monitoring != nil && monitoring.GrafanaDashboard != nil &&
+		len(monitoring.GrafanaDashboard.Namespace) > 0 {
+		return monitoring.GrafanaDashboard.Namespace
+	}
+	return cluster.ObjectMeta.Namespace
+}
+
+// Gets the desired Grafana dashboard ConfigMap of the cluster, nil if it is
+// not enabled.
+func getDesiredGrafanaDashboard(
+	cluster *v1beta1.FlinkCluster) *corev1.ConfigMap {
+	var monitoring = cluster.Spec.Monitoring
+	if monitoring == nil || monitoring.GrafanaDashboard == nil ||
+		!monitoring.GrafanaDashboard.Enabled {
+		return nil
+	}
+
+	var clusterNamespace = cluster.ObjectMeta.Namespace
+	var clusterName = cluster.ObjectMeta.Name
+	var namer = NewResourceNamer(cluster)
+	var replacer = strings.NewReplacer(
+		"${CLUSTER_NAME}", clusterName,
+		"${CLUSTER_NAMESPACE}", clusterNamespace,
+		"${RESOURCE_PREFIX}", namer.Prefix(),
+		"${FLINK_API_URL}", getFlinkAPIBaseURL(cluster))
+	return &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: getGrafanaDashboardNamespace(cluster),
+			Name:      namer.GrafanaDashboardName(),
+			Labels: map[string]string{
+				grafanaDashboardLabel:          "1",
+				dashboardClusterNameLabel:      clusterName,
+				dashboardClusterNamespaceLabel: clusterNamespace,
+			},
+		},
+		Data: map[string]string{
+			grafanaDashboardKey: replacer.Replace(grafanaDashboardTemplate),
+		},
+	}
+}
+
+// Whether the Grafana dashboard of the cluster may be created in its
+// namespace, which is the namespace of the cluster or one of the namespaces
+// allowed by the operator.
+func isGrafanaDashboardNamespaceAllowed(
+	cluster *v1beta1.FlinkCluster, allowedNamespaces []string) bool {
+	var namespace = getGrafanaDashboardNamespace(cluster)
+	if namespace == cluster.ObjectMeta.Namespace {
+		return true
+	}
+	for _, allowed := range allowedNamespaces {
+		if namespace == allowed {
+			return true
+		}
+	}
+	return false
+}
+
+// Gets the key of the Grafana dashboard ConfigMap of the spec, false if the
+// dashboard is not enabled.
+func getGrafanaDashboardKey(
+	cluster *v1beta1.FlinkCluster) (types.NamespacedName, bool) {
+	var monitoring = cluster.Spec.Monitoring
+	if monitoring == nil || monitoring.GrafanaDashboard == nil ||
+		!monitoring.GrafanaDashboard.Enabled {
+		return types.NamespacedName{}, false
+	}
+	return types.NamespacedName{
+		Namespace: getGrafanaDashboardNamespace(cluster),
+		Name:      NewResourceNamer(cluster).GrafanaDashboardName(),
+	}, true
+}
+
+// Gets the keys of the Grafana dashboard ConfigMaps the cluster might have:
+// the one of the spec if the dashboard is enabled, and the one recorded in
+// the status, e.g., in the previous namespace after the dashboard namespace
+// changed or after it was disabled.
+func getGrafanaDashboardKeys(
+	cluster *v1beta1.FlinkCluster) []types.NamespacedName {
+	var keys []types.NamespacedName
+	var key, enabled = getGrafanaDashboardKey(cluster)
+	if enabled {
+		keys = append(keys, key)
+	}
+	var recorded = cluster.Status.Components.GrafanaDashboard
+	if recorded != nil {
+		var recordedKey = types.NamespacedName{
+			Namespace: recorded.Namespace, Name: recorded.Name}
+		if !enabled || recordedKey != key {
+			keys = append(keys, recordedKey)
+		}
+	}
+	return keys
+}
+
+// Gets the Grafana dashboard ConfigMaps of the cluster by name, so that the
+// ConfigMaps of all the namespaces are not listed. The ConfigMaps without the
+// labels of the cluster, e.g., created by someone else with the same name, are
+// ignored.
+func getGrafanaDashboards(
+	ctx context.Context,
+	reader client.Reader,
+	cluster *v1beta1.FlinkCluster) ([]corev1.ConfigMap, error) {
+	var dashboards []corev1.ConfigMap
+	for _, key := range getGrafanaDashboardKeys(cluster) {
+		var dashboard = corev1.ConfigMap{}
+		var err = reader.Get(ctx, key, &dashboard)
+		if errors.IsNotFound(err) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		if dashboard.Labels[dashboardClusterNameLabel] != cluster.Name ||
+			dashboard.Labels[dashboardClusterNamespaceLabel] != cluster.Namespace {
+			continue
+		}
+		dashboards = append(dashboards, dashboard)
+	}
+	return dashboards, nil
+}
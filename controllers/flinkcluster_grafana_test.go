@@ -0,0 +1,217 @@
+/*
+Copyright 2019 Google LLC.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	v1beta1 "github.com/googlecloudplatform/flink-operator/api/v1beta1"
+	"gotest.tools/assert"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+func getTestGrafanaDashboardCluster() *v1beta1.FlinkCluster {
+	var cluster = getTestSessionCluster()
+	cluster.Spec.Monitoring = &v1beta1.MonitoringSpec{
+		GrafanaDashboard: &v1beta1.GrafanaDashboardSpec{
+			Enabled:   true,
+			Namespace: "monitoring",
+		},
+	}
+	return cluster
+}
+
+func TestGetDesiredGrafanaDashboard(t *testing.T) {
+	var cluster = getTestGrafanaDashboardCluster()
+
+	var dashboard = getDesiredGrafanaDashboard(cluster)
+	assert.Assert(t, dashboard != nil)
+	assert.Equal(t, dashboard.Namespace, "monitoring")
+	assert.Equal(
+		t, dashboard.Name, "default-flinksessioncluster-sample-grafana-dashboard")
+	assert.DeepEqual(
+		t,
+		dashboard.Labels,
+		map[string]string{
+			"grafana_dashboard":                      "1",
+			"flinkoperator.k8s.io/cluster-name":      "flinksessioncluster-sample",
+			"flinkoperator.k8s.io/cluster-namespace": "default",
+		})
+	assert.Equal(t, len(dashboard.OwnerReferences), 0)
+
+	var content = dashboard.Data["flink-cluster.json"]
+	assert.Assert(t, json.Valid([]byte(content)))
+	assert.Assert(t, !strings.Contains(content, "${"))
+	assert.Assert(
+		t,
+		strings.Contains(
+			content,
+			"http://flinksessioncluster-sample-jobmanager.default.svc.cluster.local:8081"))
+
+	// The namespace of the cluster by default.
+	cluster.Spec.Monitoring.GrafanaDashboard.Namespace = ""
+	dashboard = getDesiredGrafanaDashboard(cluster)
+	assert.Equal(t, dashboard.Namespace, "default")
+
+	// Not enabled.
+	cluster.Spec.Monitoring.GrafanaDashboard.Enabled = false
+	assert.Assert(t, getDesiredGrafanaDashboard(cluster) == nil)
+}
+
+func TestReconcileGrafanaDashboard(t *testing.T) {
+	var cluster = getTestGrafanaDashboardCluster()
+	var testScheme = runtime.NewScheme()
+	assert.NilError(t, scheme.AddToScheme(testScheme))
+	assert.NilError(t, v1beta1.AddToScheme(testScheme))
+	var k8sClient = fake.NewFakeClientWithScheme(testScheme, cluster)
+	var reconciler = ClusterReconciler{
+		k8sClient: k8sClient,
+		context:   context.Background(),
+		log:       log.Log,
+		recorder:  record.NewFakeRecorder(10),
+		observed:  ObservedClusterState{cluster: cluster},
+		desired:   getDesiredClusterState(cluster, time.Now()),
+	}
+	var getDashboard = func(namespace string) (*corev1.ConfigMap, error) {
+		var dashboard = &corev1.ConfigMap{}
+		var err = k8sClient.Get(
+			context.Background(),
+			types.NamespacedName{
+				Namespace: namespace,
+				Name:      "default-flinksessioncluster-sample-grafana-dashboard",
+			},
+			dashboard)
+		return dashboard, err
+	}
+
+	// Created in the target namespace.
+	assert.NilError(t, reconciler.reconcileGrafanaDashboard())
+	var dashboard, err = getDashboard("monitoring")
+	assert.NilError(t, err)
+	assert.Equal(t, dashboard.Labels["grafana_dashboard"], "1")
+
+	// Moved when the target namespace changes.
+	reconciler.observed.grafanaDashboards = []corev1.ConfigMap{*dashboard}
+	cluster.Spec.Monitoring.GrafanaDashboard.Namespace = "grafana"
+	reconciler.desired = getDesiredClusterState(cluster, time.Now())
+	assert.NilError(t, reconciler.reconcileGrafanaDashboard())
+	_, err = getDashboard("monitoring")
+	assert.Assert(t, errors.IsNotFound(err))
+	dashboard, err = getDashboard("grafana")
+	assert.NilError(t, err)
+
+	// Deleted when disabled.
+	reconciler.observed.grafanaDashboards = []corev1.ConfigMap{*dashboard}
+	cluster.Spec.Monitoring.GrafanaDashboard.Enabled = false
+	reconciler.desired = getDesiredClusterState(cluster, time.Now())
+	assert.NilError(t, reconciler.reconcileGrafanaDashboard())
+	_, err = getDashboard("grafana")
+	assert.Assert(t, errors.IsNotFound(err))
+}
+
+func TestIsGrafanaDashboardNamespaceAllowed(t *testing.T) {
+	var cluster = getTestGrafanaDashboardCluster()
+	assert.Assert(t, !isGrafanaDashboardNamespaceAllowed(cluster, nil))
+	assert.Assert(
+		t, isGrafanaDashboardNamespaceAllowed(cluster, []string{"monitoring"}))
+
+	// The namespace of the cluster is always allowed.
+	cluster.Spec.Monitoring.GrafanaDashboard.Namespace = "default"
+	assert.Assert(t, isGrafanaDashboardNamespaceAllowed(cluster, nil))
+}
+
+func TestGetGrafanaDashboards(t *testing.T) {
+	var cluster = getTestGrafanaDashboardCluster()
+	var dashboard = getDesiredGrafanaDashboard(cluster)
+	var recorded = dashboard.DeepCopy()
+	recorded.Namespace = "grafana"
+	var foreign = dashboard.DeepCopy()
+	foreign.Namespace = "other"
+	foreign.Labels = map[string]string{"grafana_dashboard": "1"}
+	var k8sClient = fake.NewFakeClientWithScheme(
+		scheme.Scheme, dashboard, recorded, foreign)
+	var getNamespaces = func() []string {
+		var dashboards, err = getGrafanaDashboards(
+			context.Background(), k8sClient, cluster)
+		assert.NilError(t, err)
+		var namespaces = []string{}
+		for _, dashboard := range dashboards {
+			namespaces = append(namespaces, dashboard.Namespace)
+		}
+		return namespaces
+	}
+
+	// Only the dashboard of the spec.
+	assert.DeepEqual(t, getNamespaces(), []string{"monitoring"})
+
+	// And the recorded one.
+	cluster.Status.Components.GrafanaDashboard = &v1beta1.GrafanaDashboardStatus{
+		Namespace: "grafana",
+		Name:      "default-flinksessioncluster-sample-grafana-dashboard",
+	}
+	assert.DeepEqual(t, getNamespaces(), []string{"monitoring", "grafana"})
+
+	// Only the recorded one when the dashboard is disabled.
+	cluster.Spec.Monitoring.GrafanaDashboard.Enabled = false
+	assert.DeepEqual(t, getNamespaces(), []string{"grafana"})
+
+	// A ConfigMap without the labels of the cluster is ignored.
+	cluster.Status.Components.GrafanaDashboard.Namespace = "other"
+	assert.DeepEqual(t, getNamespaces(), []string{})
+
+	// Nothing is read when the dashboard is neither enabled nor recorded.
+	cluster.Status.Components.GrafanaDashboard = nil
+	assert.Equal(t, len(getGrafanaDashboardKeys(cluster)), 0)
+}
+
+func TestDeriveGrafanaDashboardStatus(t *testing.T) {
+	var cluster = getTestGrafanaDashboardCluster()
+	var dashboard = *getDesiredGrafanaDashboard(cluster)
+	var observed = &ObservedClusterState{cluster: cluster}
+	assert.Assert(t, deriveGrafanaDashboardStatus(observed) == nil)
+
+	observed.grafanaDashboards = []corev1.ConfigMap{dashboard}
+	assert.DeepEqual(
+		t,
+		deriveGrafanaDashboardStatus(observed),
+		&v1beta1.GrafanaDashboardStatus{
+			Namespace: "monitoring",
+			Name:      "default-flinksessioncluster-sample-grafana-dashboard",
+		})
+
+	// The dashboard in the previous namespace is recorded until it is
+	// deleted.
+	cluster.Spec.Monitoring.GrafanaDashboard.Namespace = "grafana"
+	var moved = dashboard
+	moved.Namespace = "grafana"
+	observed.grafanaDashboards = []corev1.ConfigMap{moved, dashboard}
+	assert.Equal(
+		t, deriveGrafanaDashboardStatus(observed).Namespace, "monitoring")
+	observed.grafanaDashboards = []corev1.ConfigMap{moved}
+	assert.Equal(t, deriveGrafanaDashboardStatus(observed).Namespace, "grafana")
+}
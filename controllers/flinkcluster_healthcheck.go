@@ -0,0 +1,391 @@
+/*
+Copyright 2019 Google LLC.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+// Health check of the Flink REST API of the running clusters. The state of a
+// cluster only reflects its Kubernetes resources, so a cluster whose
+// JobManager pod is ready but whose REST API is unresponsive would still be
+// Running. The checker runs in the background instead of in the reconciles,
+// which are not triggered while the resources of a running cluster don't
+// change, and sends the clusters whose health changed to the reconciler,
+// which derives the Degraded state.
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/go-logr/logr"
+	v1beta1 "github.com/googlecloudplatform/flink-operator/api/v1beta1"
+	"github.com/googlecloudplatform/flink-operator/controllers/flinkclient"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+)
+
+const (
+	// The interval of looking for the clusters which are due to be checked.
+	healthCheckTickInterval = time.Second
+
+	// The capacity of the channel of the clusters whose health changed.
+	healthCheckEventBuffer = 100
+
+	// The maximum number of clusters checked concurrently.
+	healthCheckConcurrency = 10
+
+	// The defaults of the health check when the webhook didn't set them.
+	defaultHealthCheckInterval         = 30 * time.Second
+	defaultHealthCheckFailureThreshold = 3
+	defaultHealthCheckSuccessThreshold = 1
+)
+
+// ClusterHealthChecker periodically requests the overview of the running
+// clusters which enable the health check from their Flink REST API. A cluster
+// is unhealthy after the consecutive failures of its failure threshold, and
+// healthy again after the consecutive successes of its success threshold.
+// It is added to the controller manager as a runnable, so that only the
+// leader checks the clusters.
+type ClusterHealthChecker struct {
+	watchNamespaces []string
+	k8sClient       client.Client
+	apiReader       client.Reader
+	flinkClient     flinkclient.FlinkClient
+	recorder        record.EventRecorder
+	log             logr.Logger
+
+	// The clusters whose health changed, which are reconciled through a
+	// channel source of the controller.
+	events chan event.GenericEvent
+
+	mutex   sync.Mutex
+	records map[types.NamespacedName]*healthRecord
+
+	// The clusters whose checks are running, each cluster is checked once at
+	// a time, and the bound of the checks running concurrently, so that
+	// unresponsive clusters don't delay the checks of the others.
+	checking map[types.NamespacedName]bool
+	slots    chan struct{}
+	running  sync.WaitGroup
+}
+
+// The results of the recent health checks of a cluster.
+type healthRecord struct {
+	lastCheck time.Time
+	failures  int
+	successes int
+	unhealthy bool
+}
+
+// Start checks the clusters until the manager is stopped.
+func (checker *ClusterHealthChecker) Start(stop <-chan struct{}) error {
+	var ticker = time.NewTicker(healthCheckTickInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			checker.running.Wait()
+			return nil
+		case <-ticker.C:
+			checker.checkClusters(time.Now())
+		}
+	}
+}
+
+// IsUnhealthy returns whether the cluster failed the health check. Before it
+// is checked, e.g., after the operator restarted, a Degraded cluster stays
+// unhealthy until it passes the check.
+func (checker *ClusterHealthChecker) IsUnhealthy(
+	cluster *v1beta1.FlinkCluster) bool {
+	checker.mutex.Lock()
+	defer checker.mutex.Unlock()
+	var key = types.NamespacedName{
+		Namespace: cluster.Namespace,
+		Name:      cluster.Name,
+	}
+	if record, ok := checker.records[key]; ok {
+		return record.unhealthy
+	}
+	var healthCheck = cluster.Spec.HealthCheck
+	return healthCheck != nil && healthCheck.Enabled &&
+		cluster.Status.State == v1beta1.ClusterStateDegraded
+}
+
+// Forget clears the record of the cluster, e.g., after it has been deleted.
+func (checker *ClusterHealthChecker) Forget(cluster types.NamespacedName) {
+	checker.mutex.Lock()
+	defer checker.mutex.Unlock()
+	delete(checker.records, cluster)
+}
+
+// Starts the checks of the clusters which are due in the background, up to
+// the concurrency bound, and forgets the records of those which are no longer
+// checked. The clusters which are due but exceed the bound, or whose previous
+// check is still running, are checked in a later tick.
+func (checker *ClusterHealthChecker) checkClusters(now time.Time) {
+	if checker.slots == nil {
+		checker.slots = make(chan struct{}, healthCheckConcurrency)
+	}
+	var clusters = v1beta1.FlinkClusterList{}
+	var err = checker.k8sClient.List(context.Background(), &clusters)
+	if err != nil {
+		checker.log.Error(err, "Failed to list clusters for health check")
+		return
+	}
+	var checked = make(map[types.NamespacedName]bool)
+	for i := range clusters.Items {
+		if !isNamespaceWatched(
+			checker.watchNamespaces, clusters.Items[i].Namespace) {
+			continue
+		}
+		var cluster = checker.getTemplatedCluster(&clusters.Items[i])
+		var healthCheck = cluster.Spec.HealthCheck
+		if healthCheck == nil || !healthCheck.Enabled ||
+			(cluster.Status.State != v1beta1.ClusterStateRunning &&
+				cluster.Status.State != v1beta1.ClusterStateDegraded) {
+			continue
+		}
+		var key = types.NamespacedName{
+			Namespace: cluster.Namespace,
+			Name:      cluster.Name,
+		}
+		checked[key] = true
+		if !checker.isDue(key, getHealthCheckInterval(healthCheck), now) {
+			continue
+		}
+		select {
+		case checker.slots <- struct{}{}:
+		default:
+			continue
+		}
+		checker.setChecking(key, true)
+		checker.running.Add(1)
+		go func(cluster *v1beta1.FlinkCluster, key types.NamespacedName) {
+			defer checker.running.Done()
+			defer func() { <-checker.slots }()
+			defer checker.setChecking(key, false)
+			checker.checkCluster(cluster, now)
+		}(cluster, key)
+	}
+
+	checker.mutex.Lock()
+	defer checker.mutex.Unlock()
+	for key := range checker.records {
+		if !checked[key] {
+			delete(checker.records, key)
+		}
+	}
+}
+
+// Gets the cluster merged with its template, with the defaults set.
+func (checker *ClusterHealthChecker) getTemplatedCluster(
+	cluster *v1beta1.FlinkCluster) *v1beta1.FlinkCluster {
+	var templateRef = cluster.Spec.TemplateRef
+	if templateRef == nil || len(templateRef.Name) == 0 {
+		var templated, _ = v1beta1.GetTemplatedCluster(cluster, nil, nil)
+		return templated
+	}
+	var template = &v1beta1.FlinkClusterTemplate{}
+	var err = checker.k8sClient.Get(
+		context.Background(),
+		types.NamespacedName{
+			Namespace: cluster.Namespace,
+			Name:      templateRef.Name,
+		},
+		template)
+	if err != nil {
+		template = nil
+	}
+	var rawSpec []byte
+	if checker.apiReader != nil {
+		rawSpec, _ = v1beta1.GetRawClusterSpec(
+			context.Background(), checker.apiReader, cluster.Namespace,
+			cluster.Name)
+	}
+	var templated *v1beta1.FlinkCluster
+	templated, err = v1beta1.GetTemplatedCluster(cluster, rawSpec, template)
+	if err != nil {
+		templated, _ = v1beta1.GetTemplatedCluster(cluster, nil, template)
+	}
+	return templated
+}
+
+func (checker *ClusterHealthChecker) isDue(
+	key types.NamespacedName, interval time.Duration, now time.Time) bool {
+	checker.mutex.Lock()
+	defer checker.mutex.Unlock()
+	if checker.checking[key] {
+		return false
+	}
+	var record, ok = checker.records[key]
+	return !ok || now.Sub(record.lastCheck) >= interval
+}
+
+// Marks whether a check of the cluster is running.
+func (checker *ClusterHealthChecker) setChecking(
+	key types.NamespacedName, checking bool) {
+	checker.mutex.Lock()
+	defer checker.mutex.Unlock()
+	if checker.checking == nil {
+		checker.checking = make(map[types.NamespacedName]bool)
+	}
+	if checking {
+		checker.checking[key] = true
+	} else {
+		delete(checker.checking, key)
+	}
+}
+
+// Requests the overview of the cluster, and reconciles the cluster when its
+// health changed.
+func (checker *ClusterHealthChecker) checkCluster(
+	cluster *v1beta1.FlinkCluster, now time.Time) {
+	var log = checker.log.WithValues(
+		"cluster", cluster.Name, "namespace", cluster.Namespace)
+	var flinkClient = checker.flinkClient
+	if cluster.Spec.Security != nil && cluster.Spec.Security.RESTTLS != nil {
+		var tlsConfig, err = checker.getTLSConfig(cluster)
+		if err != nil {
+			// The misconfiguration is reported by the reconciler.
+			log.Info("Skip health check", "error", err)
+			return
+		}
+		flinkClient = flinkClient.WithTLSConfig(tlsConfig)
+	}
+
+	var _, err = flinkClient.GetClusterOverview(getFlinkAPIBaseURL(cluster))
+	var key = types.NamespacedName{
+		Namespace: cluster.Namespace,
+		Name:      cluster.Name,
+	}
+	var healthCheck = cluster.Spec.HealthCheck
+	var changed, failures = checker.record(
+		key,
+		err == nil,
+		getHealthCheckThreshold(
+			healthCheck.FailureThreshold, defaultHealthCheckFailureThreshold),
+		getHealthCheckThreshold(
+			healthCheck.SuccessThreshold, defaultHealthCheckSuccessThreshold),
+		cluster.Status.State == v1beta1.ClusterStateDegraded,
+		now)
+	if err != nil {
+		log.Info("Health check failed", "failures", failures, "error", err)
+	}
+	if !changed {
+		return
+	}
+
+	if err != nil {
+		checker.recorder.Event(
+			cluster,
+			"Warning",
+			"Unhealthy",
+			fmt.Sprintf(
+				"Flink REST API failed %v consecutive health checks: %v",
+				failures, err))
+	} else {
+		checker.recorder.Event(
+			cluster,
+			"Normal",
+			"Healthy",
+			"Flink REST API passed the health check")
+	}
+	select {
+	case checker.events <- event.GenericEvent{Meta: cluster, Object: cluster}:
+	default:
+		// The cluster is reconciled by its periodic requeue instead.
+		log.Info("Health check events are full, skip reconcile")
+	}
+}
+
+// Records the result of a health check, and returns whether the health of the
+// cluster changed and the number of consecutive failures. The first record of
+// a cluster which is Degraded starts unhealthy.
+func (checker *ClusterHealthChecker) record(
+	key types.NamespacedName,
+	healthy bool,
+	failureThreshold int,
+	successThreshold int,
+	degraded bool,
+	now time.Time) (bool, int) {
+	checker.mutex.Lock()
+	defer checker.mutex.Unlock()
+	if checker.records == nil {
+		checker.records = make(map[types.NamespacedName]*healthRecord)
+	}
+	var record, ok = checker.records[key]
+	if !ok {
+		record = &healthRecord{unhealthy: degraded}
+		checker.records[key] = record
+	}
+	record.lastCheck = now
+	if healthy {
+		record.failures = 0
+		record.successes++
+		if record.unhealthy && record.successes >= successThreshold {
+			record.unhealthy = false
+			return true, 0
+		}
+		return false, 0
+	}
+	record.successes = 0
+	record.failures++
+	if !record.unhealthy && record.failures >= failureThreshold {
+		record.unhealthy = true
+		return true, record.failures
+	}
+	return false, record.failures
+}
+
+// Gets the TLS config of the Flink REST API from the secret of the cluster.
+func (checker *ClusterHealthChecker) getTLSConfig(
+	cluster *v1beta1.FlinkCluster) (*tls.Config, error) {
+	var restTLS = cluster.Spec.Security.RESTTLS
+	var secret = new(corev1.Secret)
+	var err = checker.apiReader.Get(
+		context.Background(),
+		types.NamespacedName{
+			Namespace: cluster.Namespace,
+			Name:      restTLS.SecretName,
+		},
+		secret)
+	if err != nil {
+		return nil, err
+	}
+	return flinkclient.NewTLSConfig(
+		secret.Data[corev1.ServiceAccountRootCAKey],
+		secret.Data[corev1.TLSCertKey],
+		secret.Data[corev1.TLSPrivateKeyKey],
+		restTLS.InsecureSkipVerify)
+}
+
+func getHealthCheckInterval(healthCheck *v1beta1.HealthCheckSpec) time.Duration {
+	if healthCheck.IntervalSeconds == nil || *healthCheck.IntervalSeconds <= 0 {
+		return defaultHealthCheckInterval
+	}
+	return time.Duration(*healthCheck.IntervalSeconds) * time.Second
+}
+
+func getHealthCheckThreshold(threshold *int32, defaultThreshold int) int {
+	if threshold == nil || *threshold <= 0 {
+		return defaultThreshold
+	}
+	return int(*threshold)
+}
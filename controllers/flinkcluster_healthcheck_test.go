@@ -0,0 +1,196 @@
+/*
+Copyright 2019 Google LLC.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"sort"
+	"testing"
+	"time"
+
+	v1beta1 "github.com/googlecloudplatform/flink-operator/api/v1beta1"
+	"github.com/googlecloudplatform/flink-operator/controllers/flinkclient"
+	"gotest.tools/assert"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+func TestHealthCheckerRecord(t *testing.T) {
+	var checker = &ClusterHealthChecker{}
+	var key = types.NamespacedName{Namespace: "default", Name: "mycluster"}
+	var now = time.Now()
+
+	// Unhealthy after 2 consecutive failures.
+	var changed, failures = checker.record(key, false, 2, 2, false, now)
+	assert.Assert(t, !changed)
+	assert.Equal(t, failures, 1)
+	changed, _ = checker.record(key, true, 2, 2, false, now)
+	assert.Assert(t, !changed)
+	changed, _ = checker.record(key, false, 2, 2, false, now)
+	assert.Assert(t, !changed)
+	changed, failures = checker.record(key, false, 2, 2, false, now)
+	assert.Assert(t, changed)
+	assert.Equal(t, failures, 2)
+	changed, _ = checker.record(key, false, 2, 2, false, now)
+	assert.Assert(t, !changed)
+
+	// Healthy after 2 consecutive successes.
+	changed, _ = checker.record(key, true, 2, 2, false, now)
+	assert.Assert(t, !changed)
+	changed, _ = checker.record(key, true, 2, 2, false, now)
+	assert.Assert(t, changed)
+
+	// A Degraded cluster starts unhealthy.
+	checker.Forget(key)
+	changed, _ = checker.record(key, true, 2, 1, true, now)
+	assert.Assert(t, changed)
+}
+
+func TestHealthCheckerCheckClusters(t *testing.T) {
+	var failureThreshold int32 = 2
+	var cluster = getTestSessionCluster()
+	cluster.Spec.HealthCheck = &v1beta1.HealthCheckSpec{
+		Enabled:          true,
+		FailureThreshold: &failureThreshold,
+	}
+	cluster.Status.State = v1beta1.ClusterStateRunning
+	var testScheme = runtime.NewScheme()
+	assert.NilError(t, v1beta1.AddToScheme(testScheme))
+	var flinkClient = &fakeFlinkClient{}
+	var recorder = record.NewFakeRecorder(10)
+	var checker = &ClusterHealthChecker{
+		k8sClient:   fake.NewFakeClientWithScheme(testScheme, cluster),
+		flinkClient: flinkClient,
+		recorder:    recorder,
+		log:         log.Log,
+		events:      make(chan event.GenericEvent, 10),
+	}
+	var now = time.Now()
+
+	// The first failure.
+	checker.checkClusters(now)
+	checker.running.Wait()
+	assert.Assert(t, !checker.IsUnhealthy(cluster))
+
+	// Not checked again before the interval.
+	checker.checkClusters(now.Add(10 * time.Second))
+	checker.running.Wait()
+	assert.Assert(t, !checker.IsUnhealthy(cluster))
+	assert.Equal(t, len(checker.events), 0)
+
+	// Unhealthy after the second failure.
+	checker.checkClusters(now.Add(30 * time.Second))
+	checker.running.Wait()
+	assert.Assert(t, checker.IsUnhealthy(cluster))
+	assert.Equal(
+		t,
+		<-recorder.Events,
+		"Warning Unhealthy Flink REST API failed 2 consecutive health checks: "+
+			"connection refused")
+	assert.Equal(t, (<-checker.events).Meta.GetName(), cluster.Name)
+
+	// Healthy again.
+	flinkClient.overview = &flinkclient.ClusterOverview{TaskManagers: 2}
+	checker.checkClusters(now.Add(60 * time.Second))
+	checker.running.Wait()
+	assert.Assert(t, !checker.IsUnhealthy(cluster))
+	assert.Equal(
+		t, <-recorder.Events, "Normal Healthy Flink REST API passed the health check")
+	assert.Equal(t, (<-checker.events).Meta.GetName(), cluster.Name)
+}
+
+// Blocks the health checks until it is released.
+type blockingFlinkClient struct {
+	flinkclient.FlinkClient
+	started chan string
+	release chan struct{}
+}
+
+func (c *blockingFlinkClient) GetClusterOverview(
+	apiBaseURL string) (flinkclient.ClusterOverview, error) {
+	c.started <- apiBaseURL
+	<-c.release
+	return flinkclient.ClusterOverview{}, nil
+}
+
+func TestHealthCheckerChecksConcurrently(t *testing.T) {
+	var testScheme = runtime.NewScheme()
+	assert.NilError(t, v1beta1.AddToScheme(testScheme))
+	var clusters []runtime.Object
+	for _, name := range []string{"cluster-a", "cluster-b"} {
+		var cluster = getTestSessionCluster()
+		cluster.Name = name
+		cluster.Spec.HealthCheck = &v1beta1.HealthCheckSpec{Enabled: true}
+		cluster.Status.State = v1beta1.ClusterStateRunning
+		clusters = append(clusters, cluster)
+	}
+	var flinkClient = &blockingFlinkClient{
+		started: make(chan string, 10),
+		release: make(chan struct{}),
+	}
+	var checker = &ClusterHealthChecker{
+		k8sClient:   fake.NewFakeClientWithScheme(testScheme, clusters...),
+		flinkClient: flinkClient,
+		recorder:    record.NewFakeRecorder(10),
+		log:         log.Log,
+		events:      make(chan event.GenericEvent, 10),
+	}
+	var getStarted = func() []string {
+		var started = []string{<-flinkClient.started, <-flinkClient.started}
+		sort.Strings(started)
+		return started
+	}
+	var expected = []string{
+		"http://cluster-a-jobmanager.default.svc.cluster.local:8081",
+		"http://cluster-b-jobmanager.default.svc.cluster.local:8081",
+	}
+	var now = time.Now()
+
+	// Both clusters are checked at once.
+	checker.checkClusters(now)
+	assert.DeepEqual(t, getStarted(), expected)
+
+	// The running checks are not started again, even when they are due.
+	checker.checkClusters(now.Add(time.Minute))
+	select {
+	case url := <-flinkClient.started:
+		t.Fatalf("unexpected check of %v", url)
+	default:
+	}
+
+	close(flinkClient.release)
+	checker.running.Wait()
+	checker.checkClusters(now.Add(time.Minute))
+	assert.DeepEqual(t, getStarted(), expected)
+	checker.running.Wait()
+}
+
+func TestHealthCheckerIsUnhealthyDegraded(t *testing.T) {
+	var checker = &ClusterHealthChecker{}
+	var cluster = getTestSessionCluster()
+	cluster.Status.State = v1beta1.ClusterStateDegraded
+
+	// The health check is disabled.
+	assert.Assert(t, !checker.IsUnhealthy(cluster))
+
+	// Not checked yet after the operator restarted.
+	cluster.Spec.HealthCheck = &v1beta1.HealthCheckSpec{Enabled: true}
+	assert.Assert(t, checker.IsUnhealthy(cluster))
+}
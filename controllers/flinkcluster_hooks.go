@@ -0,0 +1,371 @@
+/*
+Copyright 2019 Google LLC.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+// Hooks executed when the job succeeds, i.e., a webhook notification and a
+// Kubernetes Job created from the job template of a CronJob. The updater
+// records the completion time of the job, and the status update requeues the
+// reconcile which executes the hooks. The result is recorded in the
+// SuccessHooksExecuted condition, whose transition after the completion time
+// prevents the hooks from being executed again.
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"syscall"
+	"time"
+
+	v1beta1 "github.com/googlecloudplatform/flink-operator/api/v1beta1"
+	batchv1 "k8s.io/api/batch/v1"
+	batchv1beta1 "k8s.io/api/batch/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// The timeout of the webhook notification.
+const successWebhookTimeout = 10 * time.Second
+
+// The label which a CronJob must have with the value "true" to be used as
+// the job template of the success hooks, so that a cluster can't trigger
+// arbitrary CronJobs of its namespace.
+const successHookTemplateLabel = "flinkoperator.k8s.io/success-hook-template"
+
+// The addresses which the webhooks of the clusters can't target unless their
+// hosts are allowed, i.e., loopback, private, shared, link-local (including
+// the cloud metadata servers), unspecified and multicast addresses.
+var blockedWebhookNetworks = parseCIDRs(
+	"0.0.0.0/8",
+	"10.0.0.0/8",
+	"100.64.0.0/10",
+	"127.0.0.0/8",
+	"169.254.0.0/16",
+	"172.16.0.0/12",
+	"192.168.0.0/16",
+	"224.0.0.0/4",
+	"::/128",
+	"::1/128",
+	"fc00::/7",
+	"fe80::/10",
+	"ff00::/8",
+)
+
+func parseCIDRs(cidrs ...string) []*net.IPNet {
+	var networks []*net.IPNet
+	for _, cidr := range cidrs {
+		var _, network, err = net.ParseCIDR(cidr)
+		if err != nil {
+			panic(err)
+		}
+		networks = append(networks, network)
+	}
+	return networks
+}
+
+// Checks whether the webhooks of the clusters can't target the IP address.
+func isBlockedWebhookIP(ip net.IP) bool {
+	if ip4 := ip.To4(); ip4 != nil {
+		ip = ip4
+	}
+	for _, network := range blockedWebhookNetworks {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// Rejects the connections to blocked addresses. It is checked when dialing,
+// after the host name is resolved, so that a host name resolving to a
+// blocked address is rejected too.
+func dialWebhookControl(
+	network string, address string, conn syscall.RawConn) error {
+	var host, _, err = net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	var ip = net.ParseIP(host)
+	if ip == nil || isBlockedWebhookIP(ip) {
+		return fmt.Errorf("webhook address %v is not allowed", host)
+	}
+	return nil
+}
+
+// Sends the webhook notifications, so that they can be skipped in dry-run
+// mode.
+type webhookSender interface {
+	Post(url string, body []byte) error
+}
+
+// Sends the webhook notifications with HTTP POST. Redirects are not followed,
+// and the webhooks can't target private and link-local addresses unless their
+// hosts are allowed, because the URLs are specified by the users of the
+// clusters, who must not reach the internal endpoints through the operator.
+type httpWebhookSender struct {
+	timeout time.Duration
+	// The hosts which can be targeted at any address, e.g., services in the
+	// cluster, see --webhook-allowed-hosts.
+	allowedHosts []string
+	// Whether any address can be targeted, for the URLs configured by the
+	// operator itself, e.g., the audit webhook.
+	allowAllTargets bool
+}
+
+// Checks whether the webhook can target the host at any address.
+func (sender *httpWebhookSender) isHostAllowed(host string) bool {
+	if sender.allowAllTargets {
+		return true
+	}
+	for _, allowed := range sender.allowedHosts {
+		if strings.EqualFold(allowed, host) {
+			return true
+		}
+	}
+	return false
+}
+
+// The body of the webhook notification.
+type successNotification struct {
+	Cluster        string `json:"cluster"`
+	Namespace      string `json:"namespace"`
+	JobID          string `json:"jobID,omitempty"`
+	CompletionTime string `json:"completionTime"`
+}
+
+// Post sends the JSON body to the URL, the response body is ignored. A
+// redirect is an error. The URL is stripped from the errors, because it might
+// contain a token.
+func (sender *httpWebhookSender) Post(webhookURL string, body []byte) error {
+	var timeout = sender.timeout
+	if timeout == 0 {
+		timeout = successWebhookTimeout
+	}
+	var req, err = http.NewRequest("POST", webhookURL, bytes.NewBuffer(body))
+	if err != nil ||
+		(req.URL.Scheme != "http" && req.URL.Scheme != "https") {
+		return fmt.Errorf("invalid webhook URL")
+	}
+	// The connection to a host which is not allowed is checked when dialing,
+	// so it is not made through a proxy.
+	var dialer = &net.Dialer{Timeout: timeout}
+	var transport = &http.Transport{DialContext: dialer.DialContext}
+	if sender.isHostAllowed(req.URL.Hostname()) {
+		transport.Proxy = http.ProxyFromEnvironment
+	} else {
+		dialer.Control = dialWebhookControl
+	}
+	defer transport.CloseIdleConnections()
+	var httpClient = &http.Client{
+		Timeout:   timeout,
+		Transport: transport,
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "flink-operator")
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		if urlErr, ok := err.(*url.Error); ok {
+			return urlErr.Err
+		}
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("%v", resp.Status)
+	}
+	return nil
+}
+
+// Checks whether the success hooks of the cluster are configured and have
+// not been executed since the job succeeded.
+func isSuccessHooksDue(cluster *v1beta1.FlinkCluster) bool {
+	var jobSpec = cluster.Spec.Job
+	if jobSpec == nil || jobSpec.OnSuccess == nil ||
+		len(cluster.Status.CompletionTime) == 0 {
+		return false
+	}
+	var condition = getCondition(
+		cluster.Status.Conditions, v1beta1.ClusterConditionSuccessHooksExecuted)
+	if condition == nil {
+		return true
+	}
+	var tc = &TimeConverter{}
+	return tc.FromString(condition.LastTransitionTime).Before(
+		tc.FromString(cluster.Status.CompletionTime))
+}
+
+// Gets the name of the Job triggered by the success hooks, which is unique
+// for each completion of the job.
+func getSuccessHookJobName(clusterName string, completionTime string) string {
+	var tc = &TimeConverter{}
+	return fmt.Sprintf(
+		"%v-on-success-%v", clusterName, tc.FromString(completionTime).Unix())
+}
+
+// Gets the Job created from the job template of the CronJob, like
+// `kubectl create job --from=cronjob/<name>`, with the annotations of the
+// success hooks.
+func getSuccessHookJob(
+	cluster *v1beta1.FlinkCluster, cronJob *batchv1beta1.CronJob) *batchv1.Job {
+	var template = cronJob.Spec.JobTemplate
+	var onSuccess = cluster.Spec.Job.OnSuccess
+	var annotations = map[string]string{
+		"cronjob.kubernetes.io/instantiate": "manual",
+	}
+	for name, value := range template.Annotations {
+		annotations[name] = value
+	}
+	for name, value := range onSuccess.Annotations {
+		annotations[name] = value
+	}
+	var labels = map[string]string{}
+	for name, value := range template.Labels {
+		labels[name] = value
+	}
+	return &batchv1.Job{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: cluster.Namespace,
+			Name: getSuccessHookJobName(
+				cluster.Name, cluster.Status.CompletionTime),
+			Labels:      labels,
+			Annotations: annotations,
+			OwnerReferences: []metav1.OwnerReference{{
+				APIVersion: batchv1beta1.SchemeGroupVersion.String(),
+				Kind:       "CronJob",
+				Name:       cronJob.Name,
+				UID:        cronJob.UID,
+			}},
+		},
+		Spec: *template.Spec.DeepCopy(),
+	}
+}
+
+// Executes the success hooks once after the job succeeded, and records the
+// result in the SuccessHooksExecuted condition. A failed hook doesn't fail
+// the reconcile, it is reported in the condition and an event instead.
+func (reconciler *ClusterReconciler) reconcileSuccessHooks() error {
+	var log = reconciler.log
+	var cluster = reconciler.observed.cluster
+	if !isSuccessHooksDue(cluster) {
+		return nil
+	}
+
+	var onSuccess = cluster.Spec.Job.OnSuccess
+	var failures []string
+	if len(onSuccess.WebhookURL) > 0 {
+		var err = reconciler.sendSuccessWebhook(onSuccess.WebhookURL)
+		if err != nil {
+			log.Info("Success webhook failed", "error", err)
+			failures = append(failures, fmt.Sprintf("webhook failed: %v", err))
+		}
+	}
+	if len(onSuccess.TriggerJobName) > 0 {
+		var err = reconciler.triggerSuccessJob()
+		if err != nil {
+			log.Info("Success job trigger failed", "error", err)
+			failures = append(failures, fmt.Sprintf(
+				"triggering job from CronJob %v failed: %v",
+				onSuccess.TriggerJobName, err))
+		}
+	}
+
+	var condition = v1beta1.FlinkClusterCondition{
+		Type:    v1beta1.ClusterConditionSuccessHooksExecuted,
+		Status:  corev1.ConditionTrue,
+		Reason:  "Executed",
+		Message: "Executed the success hooks of the job",
+	}
+	if len(failures) > 0 {
+		condition.Status = corev1.ConditionFalse
+		condition.Reason = "HookFailed"
+		condition.Message = strings.Join(failures, "; ")
+		reconciler.recorder.Event(
+			cluster, "Warning", "SuccessHookFailed", condition.Message)
+	} else {
+		reconciler.recorder.Event(
+			cluster, "Normal", "SuccessHooksExecuted", condition.Message)
+	}
+
+	// The condition is replaced, so that its transition time is after the
+	// completion time even if its status didn't change since the last
+	// completion.
+	var updated = cluster.DeepCopy()
+	var conditions = []v1beta1.FlinkClusterCondition{}
+	for _, existing := range updated.Status.Conditions {
+		if existing.Type != condition.Type {
+			conditions = append(conditions, existing)
+		}
+	}
+	setCondition(&conditions, condition, time.Now())
+	updated.Status.Conditions = conditions
+	setTimestamp(&updated.Status.LastUpdateTime)
+	var err = reconciler.k8sClient.Status().Update(reconciler.context, updated)
+	if err != nil {
+		log.Error(err, "Failed to record the result of the success hooks")
+		return err
+	}
+	updated.Spec = cluster.Spec
+	reconciler.observed.cluster = updated
+	return nil
+}
+
+// POSTs the notification of the job completion to the webhook.
+func (reconciler *ClusterReconciler) sendSuccessWebhook(
+	webhookURL string) error {
+	var cluster = reconciler.observed.cluster
+	var notification = successNotification{
+		Cluster:        cluster.Name,
+		Namespace:      cluster.Namespace,
+		CompletionTime: cluster.Status.CompletionTime,
+	}
+	if cluster.Status.Components.Job != nil {
+		notification.JobID = cluster.Status.Components.Job.ID
+	}
+	var body, err = json.Marshal(notification)
+	if err != nil {
+		return err
+	}
+	reconciler.log.Info("Sending success webhook")
+	return reconciler.webhookSender.Post(webhookURL, body)
+}
+
+// Creates a Job from the job template of the observed CronJob, which must
+// opt in with the success hook template label. The Job which already exists
+// for the completion is not created again.
+func (reconciler *ClusterReconciler) triggerSuccessJob() error {
+	var cronJob = reconciler.observed.successHookTemplate
+	if cronJob == nil {
+		return fmt.Errorf("CronJob not found")
+	}
+	if cronJob.Labels[successHookTemplateLabel] != "true" {
+		return fmt.Errorf(
+			"CronJob is not labeled %v=true", successHookTemplateLabel)
+	}
+	var job = getSuccessHookJob(reconciler.observed.cluster, cronJob)
+	var err = reconciler.createObject(job, "SuccessHookJob")
+	if errors.IsAlreadyExists(err) {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,285 @@
+/*
+Copyright 2019 Google LLC.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	v1beta1 "github.com/googlecloudplatform/flink-operator/api/v1beta1"
+	"gotest.tools/assert"
+	batchv1 "k8s.io/api/batch/v1"
+	batchv1beta1 "k8s.io/api/batch/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+func getTestSuccessHooksCluster(webhookURL string) *v1beta1.FlinkCluster {
+	var cluster = getTestSessionCluster()
+	cluster.Spec.Job = &v1beta1.JobSpec{
+		JarFile: "/opt/flink/job/wordcount.jar",
+		OnSuccess: &v1beta1.JobSuccessHooks{
+			WebhookURL:     webhookURL,
+			TriggerJobName: "next-step",
+			Annotations:    map[string]string{"pipeline/step": "2"},
+		},
+	}
+	cluster.Status.State = v1beta1.ClusterStateStopped
+	cluster.Status.Components.Job = &v1beta1.JobStatus{
+		ID:    "job1",
+		State: v1beta1.JobStateSucceeded,
+	}
+	cluster.Status.CompletionTime = "2019-10-23T05:20:00Z"
+	return cluster
+}
+
+func TestIsSuccessHooksDue(t *testing.T) {
+	var cluster = getTestSuccessHooksCluster("http://example.com/notify")
+	assert.Assert(t, isSuccessHooksDue(cluster))
+
+	// Executed after the completion.
+	cluster.Status.Conditions = []v1beta1.FlinkClusterCondition{{
+		Type:               v1beta1.ClusterConditionSuccessHooksExecuted,
+		Status:             corev1.ConditionFalse,
+		LastTransitionTime: "2019-10-23T05:20:05Z",
+	}}
+	assert.Assert(t, !isSuccessHooksDue(cluster))
+
+	// The job succeeded again.
+	cluster.Status.CompletionTime = "2019-10-24T05:20:00Z"
+	assert.Assert(t, isSuccessHooksDue(cluster))
+
+	// The job has not succeeded.
+	cluster.Status.CompletionTime = ""
+	assert.Assert(t, !isSuccessHooksDue(cluster))
+}
+
+func TestReconcileSuccessHooks(t *testing.T) {
+	var notifications [][]byte
+	var server = httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			var body, _ = ioutil.ReadAll(r.Body)
+			notifications = append(notifications, body)
+		}))
+	defer server.Close()
+	var cluster = getTestSuccessHooksCluster(server.URL)
+	var cronJob = &batchv1beta1.CronJob{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: cluster.Namespace,
+			Name:      "next-step",
+			Labels:    map[string]string{successHookTemplateLabel: "true"},
+		},
+		Spec: batchv1beta1.CronJobSpec{
+			Schedule: "0 0 * * *",
+			JobTemplate: batchv1beta1.JobTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{
+					Labels: map[string]string{"app": "next-step"},
+				},
+				Spec: batchv1.JobSpec{
+					Template: corev1.PodTemplateSpec{
+						Spec: corev1.PodSpec{
+							Containers: []corev1.Container{
+								{Name: "main", Image: "busybox"},
+							},
+							RestartPolicy: corev1.RestartPolicyNever,
+						},
+					},
+				},
+			},
+		},
+	}
+	var testScheme = runtime.NewScheme()
+	assert.NilError(t, scheme.AddToScheme(testScheme))
+	assert.NilError(t, v1beta1.AddToScheme(testScheme))
+	var k8sClient = fake.NewFakeClientWithScheme(testScheme, cluster)
+	var recorder = record.NewFakeRecorder(10)
+	var reconciler = ClusterReconciler{
+		k8sClient:     k8sClient,
+		context:       context.Background(),
+		log:           log.Log,
+		recorder:      recorder,
+		webhookSender: &httpWebhookSender{allowedHosts: []string{"127.0.0.1"}},
+		observed: ObservedClusterState{
+			cluster:             cluster,
+			successHookTemplate: cronJob,
+		},
+	}
+	var getHooksCondition = func() *v1beta1.FlinkClusterCondition {
+		var updated = &v1beta1.FlinkCluster{}
+		var err = k8sClient.Get(
+			context.Background(),
+			types.NamespacedName{Namespace: cluster.Namespace, Name: cluster.Name},
+			updated)
+		assert.NilError(t, err)
+		return getCondition(
+			updated.Status.Conditions,
+			v1beta1.ClusterConditionSuccessHooksExecuted)
+	}
+
+	// The webhook is notified and the job is created.
+	assert.NilError(t, reconciler.reconcileSuccessHooks())
+	assert.Equal(t, len(notifications), 1)
+	var notification = successNotification{}
+	assert.NilError(t, json.Unmarshal(notifications[0], &notification))
+	assert.DeepEqual(
+		t,
+		notification,
+		successNotification{
+			Cluster:        "flinksessioncluster-sample",
+			Namespace:      "default",
+			JobID:          "job1",
+			CompletionTime: "2019-10-23T05:20:00Z",
+		})
+	var job = &batchv1.Job{}
+	var err = k8sClient.Get(
+		context.Background(),
+		types.NamespacedName{
+			Namespace: "default",
+			Name:      "flinksessioncluster-sample-on-success-1571808000",
+		},
+		job)
+	assert.NilError(t, err)
+	assert.Equal(t, job.Annotations["pipeline/step"], "2")
+	assert.Equal(t, job.Annotations["cronjob.kubernetes.io/instantiate"], "manual")
+	assert.Equal(t, job.Labels["app"], "next-step")
+	assert.Equal(t, job.OwnerReferences[0].Kind, "CronJob")
+	assert.Equal(t, job.Spec.Template.Spec.Containers[0].Image, "busybox")
+	assert.Equal(t, getHooksCondition().Status, corev1.ConditionTrue)
+	assert.Equal(
+		t,
+		<-recorder.Events,
+		"Normal SuccessHooksExecuted Executed the success hooks of the job")
+
+	// Not executed again for the same completion.
+	assert.NilError(t, reconciler.reconcileSuccessHooks())
+	assert.Equal(t, len(notifications), 1)
+	assert.Equal(t, len(recorder.Events), 0)
+}
+
+func TestReconcileSuccessHooksFailed(t *testing.T) {
+	var server = httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}))
+	defer server.Close()
+	var cluster = getTestSuccessHooksCluster(server.URL)
+	var testScheme = runtime.NewScheme()
+	assert.NilError(t, scheme.AddToScheme(testScheme))
+	assert.NilError(t, v1beta1.AddToScheme(testScheme))
+	var k8sClient = fake.NewFakeClientWithScheme(testScheme, cluster)
+	var recorder = record.NewFakeRecorder(10)
+	var reconciler = ClusterReconciler{
+		k8sClient:     k8sClient,
+		context:       context.Background(),
+		log:           log.Log,
+		recorder:      recorder,
+		webhookSender: &httpWebhookSender{allowedHosts: []string{"127.0.0.1"}},
+		observed:      ObservedClusterState{cluster: cluster},
+	}
+
+	// Both hooks fail, the CronJob doesn't exist.
+	assert.NilError(t, reconciler.reconcileSuccessHooks())
+	var message = "webhook failed: 503 Service Unavailable; " +
+		"triggering job from CronJob next-step failed: CronJob not found"
+	assert.Equal(t, <-recorder.Events, "Warning SuccessHookFailed "+message)
+	var condition = getCondition(
+		reconciler.observed.cluster.Status.Conditions,
+		v1beta1.ClusterConditionSuccessHooksExecuted)
+	assert.Equal(t, condition.Status, corev1.ConditionFalse)
+	assert.Equal(t, condition.Reason, "HookFailed")
+	assert.Equal(t, condition.Message, message)
+
+	// Not retried.
+	assert.Assert(t, !isSuccessHooksDue(reconciler.observed.cluster))
+}
+
+func TestHTTPWebhookSenderTargets(t *testing.T) {
+	var requests = 0
+	var server = httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			requests++
+			if r.URL.Path == "/redirect" {
+				http.Redirect(w, r, "/notify", http.StatusFound)
+			}
+		}))
+	defer server.Close()
+
+	// The loopback address is rejected unless the host is allowed.
+	var sender = &httpWebhookSender{}
+	var err = sender.Post(server.URL+"/notify", []byte("{}"))
+	assert.ErrorContains(t, err, "is not allowed")
+	assert.Equal(t, requests, 0)
+	sender.allowedHosts = []string{"127.0.0.1"}
+	assert.NilError(t, sender.Post(server.URL+"/notify", []byte("{}")))
+	assert.Equal(t, requests, 1)
+
+	// Redirects are not followed.
+	err = sender.Post(server.URL+"/redirect", []byte("{}"))
+	assert.Error(t, err, "302 Found")
+	assert.Equal(t, requests, 2)
+
+	// Other schemes are invalid.
+	err = sender.Post("file:///etc/passwd", []byte("{}"))
+	assert.Error(t, err, "invalid webhook URL")
+}
+
+func TestIsBlockedWebhookIP(t *testing.T) {
+	for _, ip := range []string{
+		"127.0.0.1", "10.1.2.3", "172.16.0.1", "192.168.1.1",
+		"169.254.169.254", "100.64.0.1", "0.0.0.0", "::1", "fd00::1",
+		"fe80::1", "::ffff:10.0.0.1"} {
+		assert.Assert(t, isBlockedWebhookIP(net.ParseIP(ip)), ip)
+	}
+	for _, ip := range []string{"8.8.8.8", "172.32.0.1", "2001:4860::8888"} {
+		assert.Assert(t, !isBlockedWebhookIP(net.ParseIP(ip)), ip)
+	}
+}
+
+func TestTriggerSuccessJobRequiresLabel(t *testing.T) {
+	var cluster = getTestSuccessHooksCluster("")
+	var testScheme = runtime.NewScheme()
+	assert.NilError(t, scheme.AddToScheme(testScheme))
+	var reconciler = ClusterReconciler{
+		k8sClient: fake.NewFakeClientWithScheme(testScheme),
+		context:   context.Background(),
+		log:       log.Log,
+		observed: ObservedClusterState{
+			cluster: cluster,
+			successHookTemplate: &batchv1beta1.CronJob{
+				ObjectMeta: metav1.ObjectMeta{
+					Namespace: cluster.Namespace,
+					Name:      "next-step",
+				},
+			},
+		},
+	}
+	assert.Error(
+		t,
+		reconciler.triggerSuccessJob(),
+		"CronJob is not labeled flinkoperator.k8s.io/success-hook-template=true")
+}
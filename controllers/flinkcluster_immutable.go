@@ -0,0 +1,186 @@
+/*
+Copyright 2019 Google LLC.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+// Immutability of the spec fields which can't be changed on a running cluster
+// without losing its state, e.g., the state backend. The validating webhook
+// rejects these changes, but it can be bypassed, so the reconciler records
+// the fields of the last applied spec in an annotation of the cluster and
+// stops reconciling when they differ from the current spec.
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	v1beta1 "github.com/googlecloudplatform/flink-operator/api/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// The annotation of the cluster with the immutable fields of the last applied
+// spec, in JSON.
+const lastAppliedSpecAnnotation = "flinkoperator.k8s.io/last-applied-spec"
+
+// The spec fields which can't be changed after the cluster is created, they
+// identify the state of the cluster in the high availability services and
+// the checkpoint storage.
+type immutableSpecFields struct {
+	// The high availability mode, `high-availability`.
+	HighAvailabilityMode string `json:"highAvailabilityMode,omitempty"`
+	// The cluster ID of the high availability services,
+	// `high-availability.cluster-id`.
+	ClusterID string `json:"clusterID,omitempty"`
+	// The state backend, `checkpointConfig.stateBackend` or `state.backend`.
+	StateBackend string `json:"stateBackend,omitempty"`
+}
+
+// Gets the immutable fields of the spec of the cluster.
+func getImmutableSpecFields(
+	cluster *v1beta1.FlinkCluster) immutableSpecFields {
+	var properties = cluster.Spec.FlinkProperties
+	var fields = immutableSpecFields{
+		HighAvailabilityMode: properties["high-availability"],
+		ClusterID:            properties["high-availability.cluster-id"],
+		StateBackend:         properties["state.backend"],
+	}
+	var checkpointConfig = cluster.Spec.CheckpointConfig
+	if checkpointConfig != nil && len(checkpointConfig.StateBackend) > 0 {
+		fields.StateBackend = checkpointConfig.StateBackend
+	}
+	return fields
+}
+
+// Gets the immutable fields recorded in the last applied spec annotation,
+// nil if the cluster has not been applied yet or the annotation is malformed.
+func getLastAppliedSpecFields(
+	cluster *v1beta1.FlinkCluster) *immutableSpecFields {
+	var annotation, ok = cluster.Annotations[lastAppliedSpecAnnotation]
+	if !ok {
+		return nil
+	}
+	var fields = &immutableSpecFields{}
+	if json.Unmarshal([]byte(annotation), fields) != nil {
+		return nil
+	}
+	return fields
+}
+
+// Gets the messages of the immutable fields which differ between the last
+// applied spec and the current spec, empty if there are none.
+func getImmutableFieldChanges(
+	last immutableSpecFields, current immutableSpecFields) []string {
+	var changes []string
+	var check = func(name string, lastValue string, currentValue string) {
+		if lastValue != currentValue {
+			changes = append(changes, fmt.Sprintf(
+				"%v changed from %q to %q", name, lastValue, currentValue))
+		}
+	}
+	check("high-availability", last.HighAvailabilityMode,
+		current.HighAvailabilityMode)
+	check("high-availability.cluster-id", last.ClusterID, current.ClusterID)
+	check("state backend", last.StateBackend, current.StateBackend)
+	return changes
+}
+
+// Checks whether the immutable fields of the spec have changed since it was
+// last applied, and records the result in the SpecImmutableViolation
+// condition. The cluster is not reconciled while they differ, except for the
+// requests to stop the job or the cluster, the user has to revert the change
+// or delete and recreate the cluster. Otherwise the fields
+// of the current spec are recorded as the last applied spec.
+func (reconciler *ClusterReconciler) checkSpecImmutable() (bool, error) {
+	var log = reconciler.log
+	var cluster = reconciler.observed.cluster
+	var current = getImmutableSpecFields(cluster)
+	var last = getLastAppliedSpecFields(cluster)
+	var changes []string
+	if last != nil {
+		changes = getImmutableFieldChanges(*last, current)
+	}
+
+	var condition = v1beta1.FlinkClusterCondition{
+		Type:   v1beta1.ClusterConditionSpecImmutableViolation,
+		Status: corev1.ConditionFalse,
+	}
+	if len(changes) > 0 {
+		condition.Status = corev1.ConditionTrue
+		condition.Reason = "ImmutableFieldChanged"
+		condition.Message = strings.Join(changes, "; ") +
+			", delete and recreate the cluster to apply the change"
+		log.Info("Immutable fields of the spec changed", "changes", changes)
+	}
+
+	var recorded = getCondition(cluster.Status.Conditions, condition.Type)
+	if recorded != nil || len(changes) > 0 {
+		var updated = cluster.DeepCopy()
+		if setCondition(&updated.Status.Conditions, condition, time.Now()) {
+			if len(changes) > 0 {
+				reconciler.recorder.Event(
+					cluster, "Warning", condition.Type, condition.Message)
+			}
+			setTimestamp(&updated.Status.LastUpdateTime)
+			var err = reconciler.k8sClient.Status().Update(
+				reconciler.context, updated)
+			if err != nil {
+				return false, err
+			}
+			updated.Spec = cluster.Spec
+			reconciler.observed.cluster = updated
+		}
+	}
+	if len(changes) > 0 {
+		return false, nil
+	}
+	if last != nil && *last == current {
+		return true, nil
+	}
+	return true, reconciler.setLastAppliedSpec(current)
+}
+
+// Records the immutable fields in the last applied spec annotation with a
+// merge patch, so that the spec of a templated cluster is not written back.
+func (reconciler *ClusterReconciler) setLastAppliedSpec(
+	fields immutableSpecFields) error {
+	var log = reconciler.log
+	var cluster = reconciler.observed.cluster
+	var annotation, err = json.Marshal(fields)
+	if err != nil {
+		return err
+	}
+
+	var base = cluster.DeepCopy()
+	var patched = cluster.DeepCopy()
+	if patched.Annotations == nil {
+		patched.Annotations = make(map[string]string)
+	}
+	patched.Annotations[lastAppliedSpecAnnotation] = string(annotation)
+	err = reconciler.k8sClient.Patch(
+		reconciler.context, patched, client.MergeFrom(base))
+	if err != nil {
+		log.Error(err, "Failed to record the last applied spec")
+		return err
+	}
+	log.Info("Recorded the last applied spec", "fields", string(annotation))
+	var updated = cluster.DeepCopy()
+	updated.Annotations = patched.Annotations
+	updated.ResourceVersion = patched.ResourceVersion
+	reconciler.observed.cluster = updated
+	return nil
+}
@@ -0,0 +1,198 @@
+/*
+Copyright 2019 Google LLC.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"testing"
+
+	v1beta1 "github.com/googlecloudplatform/flink-operator/api/v1beta1"
+	"gotest.tools/assert"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+func TestGetImmutableSpecFields(t *testing.T) {
+	var cluster = getTestSessionCluster()
+	cluster.Spec.FlinkProperties = map[string]string{
+		"high-availability":            "zookeeper",
+		"high-availability.cluster-id": "my-cluster",
+		"state.backend":                "filesystem",
+	}
+	assert.DeepEqual(
+		t,
+		getImmutableSpecFields(cluster),
+		immutableSpecFields{
+			HighAvailabilityMode: "zookeeper",
+			ClusterID:            "my-cluster",
+			StateBackend:         "filesystem",
+		})
+
+	// The state backend of the checkpoint config takes precedence.
+	cluster.Spec.CheckpointConfig = &v1beta1.CheckpointConfig{
+		StateBackend: "rocksdb",
+	}
+	assert.Equal(t, getImmutableSpecFields(cluster).StateBackend, "rocksdb")
+}
+
+func TestCheckSpecImmutable(t *testing.T) {
+	var cluster = getTestSessionCluster()
+	cluster.Spec.FlinkProperties = map[string]string{
+		"state.backend": "filesystem",
+	}
+	var testScheme = runtime.NewScheme()
+	assert.NilError(t, scheme.AddToScheme(testScheme))
+	assert.NilError(t, v1beta1.AddToScheme(testScheme))
+	var k8sClient = fake.NewFakeClientWithScheme(testScheme, cluster)
+	var recorder = record.NewFakeRecorder(10)
+	var reconciler = ClusterReconciler{
+		k8sClient: k8sClient,
+		context:   context.Background(),
+		log:       log.Log,
+		recorder:  recorder,
+		observed:  ObservedClusterState{cluster: cluster},
+	}
+	var getCluster = func() *v1beta1.FlinkCluster {
+		var updated = &v1beta1.FlinkCluster{}
+		var err = k8sClient.Get(
+			context.Background(),
+			types.NamespacedName{Namespace: cluster.Namespace, Name: cluster.Name},
+			updated)
+		assert.NilError(t, err)
+		return updated
+	}
+
+	// The fields are recorded when the cluster is first applied.
+	var specImmutable, err = reconciler.checkSpecImmutable()
+	assert.NilError(t, err)
+	assert.Assert(t, specImmutable)
+	assert.Equal(
+		t,
+		getCluster().Annotations[lastAppliedSpecAnnotation],
+		`{"stateBackend":"filesystem"}`)
+	assert.Assert(
+		t,
+		getCondition(
+			getCluster().Status.Conditions,
+			v1beta1.ClusterConditionSpecImmutableViolation) == nil)
+
+	// The state backend is changed.
+	var changed = getCluster()
+	changed.Spec.FlinkProperties["state.backend"] = "rocksdb"
+	reconciler.observed.cluster = changed
+	specImmutable, err = reconciler.checkSpecImmutable()
+	assert.NilError(t, err)
+	assert.Assert(t, !specImmutable)
+	var message = `state backend changed from "filesystem" to "rocksdb", ` +
+		"delete and recreate the cluster to apply the change"
+	var condition = getCondition(
+		getCluster().Status.Conditions,
+		v1beta1.ClusterConditionSpecImmutableViolation)
+	assert.Equal(t, condition.Status, corev1.ConditionTrue)
+	assert.Equal(t, condition.Reason, "ImmutableFieldChanged")
+	assert.Equal(t, condition.Message, message)
+	assert.Equal(
+		t, <-recorder.Events, "Warning SpecImmutableViolation "+message)
+	assert.Equal(
+		t,
+		getCluster().Annotations[lastAppliedSpecAnnotation],
+		`{"stateBackend":"filesystem"}`)
+
+	// The event is emitted once while the change stays the same.
+	specImmutable, err = reconciler.checkSpecImmutable()
+	assert.NilError(t, err)
+	assert.Assert(t, !specImmutable)
+	assert.Equal(t, len(recorder.Events), 0)
+
+	// The change is reverted.
+	var reverted = getCluster()
+	reverted.Spec.FlinkProperties["state.backend"] = "filesystem"
+	reconciler.observed.cluster = reverted
+	specImmutable, err = reconciler.checkSpecImmutable()
+	assert.NilError(t, err)
+	assert.Assert(t, specImmutable)
+	condition = getCondition(
+		getCluster().Status.Conditions,
+		v1beta1.ClusterConditionSpecImmutableViolation)
+	assert.Equal(t, condition.Status, corev1.ConditionFalse)
+}
+
+func TestReconcileSuspensionWithImmutableViolation(t *testing.T) {
+	var cluster = getTestSessionCluster()
+	cluster.Annotations = map[string]string{
+		lastAppliedSpecAnnotation: `{"stateBackend":"filesystem"}`,
+	}
+	cluster.Spec.FlinkProperties = map[string]string{
+		"state.backend": "rocksdb",
+	}
+	cluster.Spec.Suspend = true
+	var replicas int32 = 2
+	var tmDeployment = &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace:       "default",
+			Name:            "flinksessioncluster-sample-taskmanager",
+			OwnerReferences: []metav1.OwnerReference{toOwnerReference(cluster)},
+		},
+		Spec: appsv1.DeploymentSpec{Replicas: &replicas},
+	}
+	var testScheme = runtime.NewScheme()
+	assert.NilError(t, scheme.AddToScheme(testScheme))
+	assert.NilError(t, v1beta1.AddToScheme(testScheme))
+	var k8sClient = fake.NewFakeClientWithScheme(
+		testScheme, cluster, tmDeployment)
+	var reconciler = ClusterReconciler{
+		k8sClient: k8sClient,
+		context:   context.Background(),
+		log:       log.Log,
+		recorder:  record.NewFakeRecorder(10),
+		observed: ObservedClusterState{
+			cluster:      cluster,
+			tmDeployment: tmDeployment,
+		},
+	}
+
+	// The cluster is suspended, though the state backend changed.
+	var _, err = reconciler.reconcile()
+	assert.NilError(t, err)
+	var updated = &v1beta1.FlinkCluster{}
+	err = k8sClient.Get(
+		context.Background(),
+		types.NamespacedName{Namespace: cluster.Namespace, Name: cluster.Name},
+		updated)
+	assert.NilError(t, err)
+	var condition = getCondition(
+		updated.Status.Conditions,
+		v1beta1.ClusterConditionSpecImmutableViolation)
+	assert.Equal(t, condition.Status, corev1.ConditionTrue)
+	var deployment = &appsv1.Deployment{}
+	err = k8sClient.Get(
+		context.Background(),
+		types.NamespacedName{
+			Namespace: "default",
+			Name:      "flinksessioncluster-sample-taskmanager",
+		},
+		deployment)
+	assert.NilError(t, err)
+	assert.Equal(t, *deployment.Spec.Replicas, int32(0))
+}
@@ -0,0 +1,82 @@
+/*
+Copyright 2019 Google LLC.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+// Prometheus metrics exposed by the operator through the metrics endpoint of
+// the controller manager.
+
+import (
+	"sync"
+
+	v1beta1 "github.com/googlecloudplatform/flink-operator/api/v1beta1"
+	"github.com/prometheus/client_golang/prometheus"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+var vertexBackpressureRatio = prometheus.NewGaugeVec(
+	prometheus.GaugeOpts{
+		Name: "flink_operator_vertex_backpressure_ratio",
+		Help: "Backpressure ratio of a vertex of the Flink job of a cluster.",
+	},
+	[]string{"namespace", "cluster", "vertex"},
+)
+
+// The vertices of each cluster with a backpressure ratio gauge, so that the
+// gauges can be removed with the vertices or the cluster.
+var backpressureVertices = struct {
+	sync.Mutex
+	vertices map[types.NamespacedName][]string
+}{vertices: map[types.NamespacedName][]string{}}
+
+func init() {
+	metrics.Registry.MustRegister(vertexBackpressureRatio)
+}
+
+// Updates the backpressure ratio gauges of the cluster, removing the gauges
+// of the vertices which are no longer observed.
+func updateBackpressureMetrics(
+	cluster types.NamespacedName, updated []v1beta1.VertexBackpressure) {
+	backpressureVertices.Lock()
+	defer backpressureVertices.Unlock()
+	var updatedVertices = map[string]bool{}
+	var vertices []string
+	for _, vertex := range updated {
+		updatedVertices[vertex.VertexName] = true
+		vertices = append(vertices, vertex.VertexName)
+		vertexBackpressureRatio.WithLabelValues(
+			cluster.Namespace, cluster.Name, vertex.VertexName).Set(
+			float64(vertex.Ratio) / 100)
+	}
+	for _, vertex := range backpressureVertices.vertices[cluster] {
+		if !updatedVertices[vertex] {
+			vertexBackpressureRatio.DeleteLabelValues(
+				cluster.Namespace, cluster.Name, vertex)
+		}
+	}
+	if len(vertices) > 0 {
+		backpressureVertices.vertices[cluster] = vertices
+	} else {
+		delete(backpressureVertices.vertices, cluster)
+	}
+}
+
+// Removes the backpressure ratio gauges of the cluster, e.g., after it has
+// been deleted.
+func deleteBackpressureMetrics(cluster types.NamespacedName) {
+	updateBackpressureMetrics(cluster, nil)
+}
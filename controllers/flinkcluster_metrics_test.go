@@ -0,0 +1,126 @@
+/*
+Copyright 2019 Google LLC.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	v1beta1 "github.com/googlecloudplatform/flink-operator/api/v1beta1"
+	"gotest.tools/assert"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+// Gets the backpressure ratio gauges as "namespace/cluster/vertex" to ratio.
+func getBackpressureGauges(t *testing.T) map[string]float64 {
+	var families, err = metrics.Registry.Gather()
+	assert.NilError(t, err)
+	var gauges = map[string]float64{}
+	for _, family := range families {
+		if family.GetName() != "flink_operator_vertex_backpressure_ratio" {
+			continue
+		}
+		for _, metric := range family.GetMetric() {
+			var labels = map[string]string{}
+			for _, label := range metric.GetLabel() {
+				labels[label.GetName()] = label.GetValue()
+			}
+			var key = fmt.Sprintf(
+				"%v/%v/%v", labels["namespace"], labels["cluster"], labels["vertex"])
+			gauges[key] = metric.GetGauge().GetValue()
+		}
+	}
+	return gauges
+}
+
+func TestBackpressureMetrics(t *testing.T) {
+	var clusterA = types.NamespacedName{Namespace: "team-a", Name: "mycluster"}
+	var clusterB = types.NamespacedName{Namespace: "team-b", Name: "mycluster"}
+	defer deleteBackpressureMetrics(clusterA)
+	defer deleteBackpressureMetrics(clusterB)
+
+	// The clusters with the same name in different namespaces have their
+	// own gauges.
+	updateBackpressureMetrics(clusterA, []v1beta1.VertexBackpressure{
+		{VertexName: "Source", Ratio: 50},
+		{VertexName: "Sink", Ratio: 10},
+	})
+	updateBackpressureMetrics(clusterB, []v1beta1.VertexBackpressure{
+		{VertexName: "Source", Ratio: 90},
+	})
+	assert.DeepEqual(t, getBackpressureGauges(t), map[string]float64{
+		"team-a/mycluster/Source": 0.5,
+		"team-a/mycluster/Sink":   0.1,
+		"team-b/mycluster/Source": 0.9,
+	})
+
+	// The gauges of the vertices which are no longer observed are removed.
+	updateBackpressureMetrics(clusterB, nil)
+	assert.DeepEqual(t, getBackpressureGauges(t), map[string]float64{
+		"team-a/mycluster/Source": 0.5,
+		"team-a/mycluster/Sink":   0.1,
+	})
+
+	// The gauges of a deleted cluster are removed.
+	updateBackpressureMetrics(clusterB, []v1beta1.VertexBackpressure{
+		{VertexName: "Source", Ratio: 90},
+	})
+	deleteBackpressureMetrics(clusterA)
+	assert.DeepEqual(t, getBackpressureGauges(t), map[string]float64{
+		"team-b/mycluster/Source": 0.9,
+	})
+}
+
+func TestReconcileDeletedClusterRemovesBackpressureMetrics(t *testing.T) {
+	var cluster = types.NamespacedName{Namespace: "default", Name: "deleted"}
+	updateBackpressureMetrics(cluster, []v1beta1.VertexBackpressure{
+		{VertexName: "Source", Ratio: 50},
+	})
+	var testScheme = runtime.NewScheme()
+	assert.NilError(t, scheme.AddToScheme(testScheme))
+	assert.NilError(t, v1beta1.AddToScheme(testScheme))
+	var k8sClient = fake.NewFakeClientWithScheme(testScheme)
+	var request = ctrl.Request{NamespacedName: cluster}
+	var handler = FlinkClusterHandler{
+		k8sClient: k8sClient,
+		apiReader: k8sClient,
+		request:   request,
+		context:   context.Background(),
+		log:       log.Log,
+		recorder:  record.NewFakeRecorder(10),
+		backoff:   &RequeueBackoff{},
+		debouncer: &StatusDebouncer{},
+		specs:     &SpecTracker{},
+		sampler:   &MetricsSampler{},
+		poller:    &MetricsPoller{},
+
+		healthChecker: &ClusterHealthChecker{},
+	}
+
+	var _, err = handler.reconcileAndRecover(request)
+	assert.NilError(t, err)
+	var _, found = getBackpressureGauges(t)["default/deleted/Source"]
+	assert.Assert(t, !found)
+}
@@ -0,0 +1,287 @@
+/*
+Copyright 2019 Google LLC.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+// Network policy isolating the JobManager and TaskManager pods. The pods of
+// the cluster reach each other on all ports, e.g., for the data exchange
+// between TaskManagers, while the JobManager RPC and UI ports are also open to
+// the allowed namespaces. The Flink REST server behind a proxy of the UI port
+// is only open to the operator, which polls the Flink API.
+
+import (
+	v1beta1 "github.com/googlecloudplatform/flink-operator/api/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/apimachinery/pkg/util/version"
+	"k8s.io/client-go/discovery"
+	"k8s.io/client-go/rest"
+)
+
+// The label of a namespace with its name, set by Kubernetes since 1.21.
+const namespaceNameLabel = "kubernetes.io/metadata.name"
+
+// The labels of the operator pods.
+var operatorPodLabels = map[string]string{
+	"control-plane": "controller-manager",
+}
+
+// Gets the desired network policy of the cluster, nil if it is not enabled.
+func getDesiredNetworkPolicy(
+	flinkCluster *v1beta1.FlinkCluster) *networkingv1.NetworkPolicy {
+	var networking = flinkCluster.Spec.Networking
+	if networking == nil || networking.NetworkPolicy == nil ||
+		!networking.NetworkPolicy.Enabled {
+		return nil
+	}
+
+	var clusterName = flinkCluster.ObjectMeta.Name
+	var clusterNamespace = flinkCluster.ObjectMeta.Namespace
+	var labels = map[string]string{
+		"cluster": clusterName,
+		"app":     "flink",
+	}
+	var clusterPeer = networkingv1.NetworkPolicyPeer{
+		PodSelector: &metav1.LabelSelector{MatchLabels: labels},
+	}
+
+	// The pods in the namespace of the cluster by default.
+	var allowedPeers = []networkingv1.NetworkPolicyPeer{
+		{PodSelector: &metav1.LabelSelector{}},
+	}
+	var allowedNamespaces = networking.NetworkPolicy.AllowedNamespaces
+	if len(allowedNamespaces) > 0 {
+		allowedPeers = []networkingv1.NetworkPolicyPeer{
+			getNamespacePeer(allowedNamespaces...),
+		}
+	}
+
+	var tcp = corev1.ProtocolTCP
+	var publicPorts = []networkingv1.NetworkPolicyPort{
+		newNetworkPolicyPort(tcp, *flinkCluster.Spec.JobManager.Ports.RPC),
+		newNetworkPolicyPort(tcp, getJobManagerUIPodPort(flinkCluster)),
+	}
+	if isSSOEnabled(flinkCluster.Spec.Security) &&
+		getJobManagerUIPodPort(flinkCluster) != ssoProxyPort {
+		publicPorts = append(publicPorts, newNetworkPolicyPort(tcp, ssoProxyPort))
+	}
+
+	var policyTypes = []networkingv1.PolicyType{networkingv1.PolicyTypeIngress}
+	var egress []networkingv1.NetworkPolicyEgressRule
+	if networking.NetworkPolicy.RestrictEgress {
+		var udp = corev1.ProtocolUDP
+		policyTypes = append(policyTypes, networkingv1.PolicyTypeEgress)
+		egress = []networkingv1.NetworkPolicyEgressRule{
+			{To: []networkingv1.NetworkPolicyPeer{clusterPeer}},
+			// DNS.
+			{
+				Ports: []networkingv1.NetworkPolicyPort{
+					newNetworkPolicyPort(udp, 53),
+					newNetworkPolicyPort(tcp, 53),
+				},
+			},
+		}
+	}
+
+	return &networkingv1.NetworkPolicy{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: clusterNamespace,
+			Name:      NewResourceNamer(flinkCluster).NetworkPolicyName(),
+			OwnerReferences: []metav1.OwnerReference{
+				toOwnerReference(flinkCluster)},
+			Labels: labels,
+		},
+		Spec: networkingv1.NetworkPolicySpec{
+			PodSelector: metav1.LabelSelector{
+				MatchLabels: labels,
+				MatchExpressions: []metav1.LabelSelectorRequirement{
+					{
+						Key:      "component",
+						Operator: metav1.LabelSelectorOpIn,
+						Values:   []string{"jobmanager", "taskmanager"},
+					},
+				},
+			},
+			Ingress: []networkingv1.NetworkPolicyIngressRule{
+				{From: []networkingv1.NetworkPolicyPeer{clusterPeer}},
+				{Ports: publicPorts, From: allowedPeers},
+			},
+			Egress:      egress,
+			PolicyTypes: policyTypes,
+		},
+	}
+}
+
+// Gets the port of a network policy rule.
+func newNetworkPolicyPort(
+	protocol corev1.Protocol, port int32) networkingv1.NetworkPolicyPort {
+	var portValue = intstr.FromInt(int(port))
+	return networkingv1.NetworkPolicyPort{Protocol: &protocol, Port: &portValue}
+}
+
+// Gets the port of the JobManager pod behind the UI port of the service, which
+// is the port of the proxy in front of the Flink REST server if any.
+func getJobManagerUIPodPort(flinkCluster *v1beta1.FlinkCluster) int32 {
+	if flinkCluster.Spec.JobManagerProxy == nil &&
+		isSSOEnabled(flinkCluster.Spec.Security) {
+		return ssoProxyPort
+	}
+	return *flinkCluster.Spec.JobManager.Ports.UI
+}
+
+// Gets the port of the JobManager pod on which the operator reaches the Flink
+// API, see getFlinkAPIPort.
+func getFlinkAPIPodPort(flinkCluster *v1beta1.FlinkCluster) int32 {
+	if isJobManagerUIProxied(flinkCluster) &&
+		flinkCluster.Spec.JobManagerProxy != nil {
+		return jmProxyUpstreamPort
+	}
+	return *flinkCluster.Spec.JobManager.Ports.UI
+}
+
+// Gets the peer selecting all the pods in the namespaces.
+func getNamespacePeer(namespaces ...string) networkingv1.NetworkPolicyPeer {
+	return networkingv1.NetworkPolicyPeer{
+		NamespaceSelector: &metav1.LabelSelector{
+			MatchExpressions: []metav1.LabelSelectorRequirement{
+				{
+					Key:      namespaceNameLabel,
+					Operator: metav1.LabelSelectorOpIn,
+					Values:   namespaces,
+				},
+			},
+		},
+	}
+}
+
+// Gets the namespaces selected by their names by the peer, nil if the peer
+// doesn't select namespaces by their names.
+func getPeerNamespaces(peer networkingv1.NetworkPolicyPeer) []string {
+	if peer.NamespaceSelector == nil {
+		return nil
+	}
+	for _, expression := range peer.NamespaceSelector.MatchExpressions {
+		if expression.Key == namespaceNameLabel &&
+			expression.Operator == metav1.LabelSelectorOpIn {
+			return expression.Values
+		}
+	}
+	return nil
+}
+
+// Whether the rule allows all the pods in the namespace to reach the port.
+func isPortAllowedFromNamespace(
+	rule networkingv1.NetworkPolicyIngressRule,
+	port int32,
+	clusterNamespace string,
+	namespace string) bool {
+	var portAllowed = len(rule.Ports) == 0
+	for _, rulePort := range rule.Ports {
+		if rulePort.Port != nil && rulePort.Port.IntValue() == int(port) {
+			portAllowed = true
+		}
+	}
+	if !portAllowed {
+		return false
+	}
+	for _, peer := range rule.From {
+		var allPods = peer.PodSelector == nil ||
+			(len(peer.PodSelector.MatchLabels) == 0 &&
+				len(peer.PodSelector.MatchExpressions) == 0)
+		if !allPods || peer.IPBlock != nil {
+			continue
+		}
+		if peer.NamespaceSelector == nil && namespace == clusterNamespace {
+			return true
+		}
+		for _, peerNamespace := range getPeerNamespaces(peer) {
+			if peerNamespace == namespace {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Allows the operator pods in the namespace to reach the Flink API, unless the
+// namespace is already allowed. Empty if the operator does not run
+// in a cluster, e.g., during development.
+func allowOperatorNamespace(
+	networkPolicy *networkingv1.NetworkPolicy,
+	flinkCluster *v1beta1.FlinkCluster,
+	operatorNamespace string) {
+	if networkPolicy == nil || len(operatorNamespace) == 0 {
+		return
+	}
+	var clusterNamespace = flinkCluster.ObjectMeta.Namespace
+	var restPort = getFlinkAPIPodPort(flinkCluster)
+	for _, rule := range networkPolicy.Spec.Ingress {
+		if isPortAllowedFromNamespace(
+			rule, restPort, clusterNamespace, operatorNamespace) {
+			return
+		}
+	}
+	var operatorPeer = networkingv1.NetworkPolicyPeer{
+		PodSelector: &metav1.LabelSelector{MatchLabels: operatorPodLabels},
+	}
+	if operatorNamespace != clusterNamespace {
+		operatorPeer.NamespaceSelector = getNamespacePeer(
+			operatorNamespace).NamespaceSelector
+	}
+	networkPolicy.Spec.Ingress = append(
+		networkPolicy.Spec.Ingress,
+		networkingv1.NetworkPolicyIngressRule{
+			Ports: []networkingv1.NetworkPolicyPort{
+				newNetworkPolicyPort(corev1.ProtocolTCP, restPort),
+			},
+			From: []networkingv1.NetworkPolicyPeer{operatorPeer},
+		})
+}
+
+// Whether the network policy selects namespaces by their names.
+func usesNamespaceNameLabel(networkPolicy *networkingv1.NetworkPolicy) bool {
+	for _, rule := range networkPolicy.Spec.Ingress {
+		for _, peer := range rule.From {
+			if getPeerNamespaces(peer) != nil {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Whether the server sets the name label of the namespaces, which the network
+// policies select the namespaces by. The server is assumed to set it if its
+// version is unknown.
+func isNamespaceNameLabelSupported(serverVersion *version.Version) bool {
+	return serverVersion == nil ||
+		serverVersion.AtLeast(version.MustParseGeneric("1.21"))
+}
+
+// Gets the version of the Kubernetes API server.
+func getServerVersion(config *rest.Config) (*version.Version, error) {
+	var discoveryClient, err = discovery.NewDiscoveryClientForConfig(config)
+	if err != nil {
+		return nil, err
+	}
+	info, err := discoveryClient.ServerVersion()
+	if err != nil {
+		return nil, err
+	}
+	return version.ParseGeneric(info.GitVersion)
+}
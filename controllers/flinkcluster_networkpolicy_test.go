@@ -0,0 +1,233 @@
+/*
+Copyright 2019 Google LLC.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	v1beta1 "github.com/googlecloudplatform/flink-operator/api/v1beta1"
+	"gotest.tools/assert"
+	networkingv1 "k8s.io/api/networking/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/version"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+func getTestNetworkPolicyCluster() *v1beta1.FlinkCluster {
+	var cluster = getTestSessionCluster()
+	cluster.Spec.Networking = &v1beta1.NetworkingSpec{
+		NetworkPolicy: &v1beta1.NetworkPolicySpec{Enabled: true},
+	}
+	return cluster
+}
+
+func TestGetDesiredNetworkPolicy(t *testing.T) {
+	var cluster = getTestNetworkPolicyCluster()
+
+	var policy = getDesiredNetworkPolicy(cluster)
+	assert.Assert(t, policy != nil)
+	assert.Equal(t, policy.Name, "flinksessioncluster-sample-network-policy")
+	assert.Equal(t, policy.Spec.PodSelector.MatchLabels["cluster"], cluster.Name)
+	assert.DeepEqual(
+		t,
+		policy.Spec.PodSelector.MatchExpressions[0].Values,
+		[]string{"jobmanager", "taskmanager"})
+	assert.Equal(t, len(policy.Spec.Ingress), 2)
+	assert.Equal(t, len(policy.Spec.Ingress[0].Ports), 0)
+	assert.Equal(t, policy.Spec.Ingress[1].Ports[0].Port.IntValue(), 6123)
+	assert.Equal(t, policy.Spec.Ingress[1].Ports[1].Port.IntValue(), 8081)
+	// The namespace of the cluster by default.
+	assert.Equal(t, len(policy.Spec.Ingress[1].From), 1)
+	assert.Assert(t, policy.Spec.Ingress[1].From[0].NamespaceSelector == nil)
+	assert.Assert(t, !usesNamespaceNameLabel(policy))
+	// Egress is not restricted by default.
+	assert.Equal(t, len(policy.Spec.Egress), 0)
+	assert.DeepEqual(
+		t,
+		policy.Spec.PolicyTypes,
+		[]networkingv1.PolicyType{networkingv1.PolicyTypeIngress})
+
+	// The operator in the namespace of the cluster is already allowed.
+	allowOperatorNamespace(policy, cluster, "default")
+	assert.Equal(t, len(policy.Spec.Ingress), 2)
+
+	// The operator pods in another namespace are allowed.
+	allowOperatorNamespace(policy, cluster, "flink-operator-system")
+	assert.Equal(t, len(policy.Spec.Ingress), 3)
+	var operatorRule = policy.Spec.Ingress[2]
+	assert.Equal(t, operatorRule.Ports[0].Port.IntValue(), 8081)
+	assert.DeepEqual(
+		t,
+		operatorRule.From[0].PodSelector.MatchLabels,
+		map[string]string{"control-plane": "controller-manager"})
+	assert.DeepEqual(
+		t,
+		getPeerNamespaces(operatorRule.From[0]),
+		[]string{"flink-operator-system"})
+	assert.Assert(t, usesNamespaceNameLabel(policy))
+
+	// Allowed namespaces.
+	cluster.Spec.Networking.NetworkPolicy.AllowedNamespaces =
+		[]string{"monitoring", "flink-operator-system"}
+	policy = getDesiredNetworkPolicy(cluster)
+	assert.Equal(t, len(policy.Spec.Ingress[1].From), 1)
+	assert.DeepEqual(
+		t,
+		getPeerNamespaces(policy.Spec.Ingress[1].From[0]),
+		[]string{"monitoring", "flink-operator-system"})
+	allowOperatorNamespace(policy, cluster, "flink-operator-system")
+	assert.Equal(t, len(policy.Spec.Ingress), 2)
+
+	// Restricted egress.
+	cluster.Spec.Networking.NetworkPolicy.RestrictEgress = true
+	policy = getDesiredNetworkPolicy(cluster)
+	assert.Equal(t, len(policy.Spec.Egress), 2)
+	assert.Equal(t, policy.Spec.Egress[1].Ports[0].Port.IntValue(), 53)
+	assert.DeepEqual(
+		t,
+		policy.Spec.PolicyTypes,
+		[]networkingv1.PolicyType{
+			networkingv1.PolicyTypeIngress, networkingv1.PolicyTypeEgress})
+
+	// Not enabled.
+	cluster.Spec.Networking.NetworkPolicy.Enabled = false
+	assert.Assert(t, getDesiredNetworkPolicy(cluster) == nil)
+}
+
+func TestGetDesiredNetworkPolicyWithSSO(t *testing.T) {
+	var cluster = getTestNetworkPolicyCluster()
+	var ssoEnabled = true
+	cluster.Spec.Security = &v1beta1.SecuritySpec{
+		SSOEnabled: &ssoEnabled,
+		OIDCConfig: &v1beta1.OIDCConfig{},
+	}
+
+	// The SSO proxy port is public, the Flink REST server only accepts
+	// traffic from the operator, even in the same namespace.
+	var policy = getDesiredNetworkPolicy(cluster)
+	var publicPorts []int
+	for _, port := range policy.Spec.Ingress[1].Ports {
+		publicPorts = append(publicPorts, port.Port.IntValue())
+	}
+	assert.DeepEqual(t, publicPorts, []int{6123, 4180})
+	allowOperatorNamespace(policy, cluster, "default")
+	assert.Equal(t, len(policy.Spec.Ingress), 3)
+	var operatorRule = policy.Spec.Ingress[2]
+	assert.Equal(t, operatorRule.Ports[0].Port.IntValue(), 8081)
+	assert.Assert(t, operatorRule.From[0].NamespaceSelector == nil)
+	assert.Assert(t, operatorRule.From[0].PodSelector != nil)
+
+	// With the JobManager proxy, the Flink REST server listens on the
+	// internal port.
+	cluster.Spec.JobManagerProxy = &v1beta1.ProxySpec{}
+	policy = getDesiredNetworkPolicy(cluster)
+	publicPorts = nil
+	for _, port := range policy.Spec.Ingress[1].Ports {
+		publicPorts = append(publicPorts, port.Port.IntValue())
+	}
+	assert.DeepEqual(t, publicPorts, []int{6123, 8081, 4180})
+	allowOperatorNamespace(policy, cluster, "default")
+	assert.Equal(t, policy.Spec.Ingress[2].Ports[0].Port.IntValue(), 18081)
+}
+
+func TestIsNamespaceNameLabelSupported(t *testing.T) {
+	assert.Assert(t, isNamespaceNameLabelSupported(nil))
+	assert.Assert(t, isNamespaceNameLabelSupported(
+		version.MustParseGeneric("v1.21.0")))
+	assert.Assert(t, isNamespaceNameLabelSupported(
+		version.MustParseGeneric("v1.22.3-gke.700")))
+	assert.Assert(t, !isNamespaceNameLabelSupported(
+		version.MustParseGeneric("v1.20.9")))
+}
+
+func TestReconcileNetworkPolicy(t *testing.T) {
+	var cluster = getTestNetworkPolicyCluster()
+	var testScheme = runtime.NewScheme()
+	assert.NilError(t, scheme.AddToScheme(testScheme))
+	assert.NilError(t, v1beta1.AddToScheme(testScheme))
+	var k8sClient = fake.NewFakeClientWithScheme(testScheme, cluster)
+	var reconciler = ClusterReconciler{
+		k8sClient: k8sClient,
+		context:   context.Background(),
+		log:       log.Log,
+		recorder:  record.NewFakeRecorder(10),
+		observed:  ObservedClusterState{cluster: cluster},
+		desired:   getDesiredClusterState(cluster, time.Now()),
+	}
+	var getPolicy = func() (*networkingv1.NetworkPolicy, error) {
+		var policy = &networkingv1.NetworkPolicy{}
+		var err = k8sClient.Get(
+			context.Background(),
+			types.NamespacedName{
+				Namespace: "default",
+				Name:      "flinksessioncluster-sample-network-policy",
+			},
+			policy)
+		return policy, err
+	}
+
+	// Created.
+	assert.NilError(t, reconciler.reconcileNetworkPolicy())
+	var policy, err = getPolicy()
+	assert.NilError(t, err)
+	assert.Equal(t, len(policy.Spec.Ingress[1].From), 1)
+
+	// Updated when the allowed namespaces change.
+	reconciler.observed.networkPolicy = policy
+	cluster.Spec.Networking.NetworkPolicy.AllowedNamespaces =
+		[]string{"monitoring"}
+	reconciler.desired = getDesiredClusterState(cluster, time.Now())
+	assert.NilError(t, reconciler.reconcileNetworkPolicy())
+	policy, err = getPolicy()
+	assert.NilError(t, err)
+	assert.Assert(t, policy.Spec.Ingress[1].From[0].NamespaceSelector != nil)
+
+	// A policy controlled by another owner is not updated.
+	policy.OwnerReferences = []metav1.OwnerReference{{
+		APIVersion: "flinkoperator.k8s.io/v1beta1",
+		Kind:       "FlinkCluster",
+		Name:       "other",
+		UID:        "other-uid",
+		Controller: &[]bool{true}[0],
+	}}
+	assert.NilError(t, k8sClient.Update(context.Background(), policy))
+	reconciler.observed.networkPolicy = policy
+	cluster.Spec.Networking.NetworkPolicy.AllowedNamespaces = nil
+	reconciler.desired = getDesiredClusterState(cluster, time.Now())
+	assert.NilError(t, reconciler.reconcileNetworkPolicy())
+	policy, err = getPolicy()
+	assert.NilError(t, err)
+	assert.Assert(t, policy.Spec.Ingress[1].From[0].NamespaceSelector != nil)
+	policy.OwnerReferences = []metav1.OwnerReference{toOwnerReference(cluster)}
+	assert.NilError(t, k8sClient.Update(context.Background(), policy))
+
+	// Deleted when disabled.
+	reconciler.observed.networkPolicy = policy
+	cluster.Spec.Networking.NetworkPolicy.Enabled = false
+	reconciler.desired = getDesiredClusterState(cluster, time.Now())
+	assert.NilError(t, reconciler.reconcileNetworkPolicy())
+	_, err = getPolicy()
+	assert.Assert(t, errors.IsNotFound(err))
+}
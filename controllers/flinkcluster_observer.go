@@ -19,40 +19,106 @@ package controllers
 import (
 	"context"
 	"errors"
+	"fmt"
+	"strings"
+	"time"
 
 	"github.com/go-logr/logr"
 	v1beta1 "github.com/googlecloudplatform/flink-operator/api/v1beta1"
 	"github.com/googlecloudplatform/flink-operator/controllers/flinkclient"
 	appsv1 "k8s.io/api/apps/v1"
 	batchv1 "k8s.io/api/batch/v1"
+	batchv1beta1 "k8s.io/api/batch/v1beta1"
 	corev1 "k8s.io/api/core/v1"
 	extensionsv1beta1 "k8s.io/api/extensions/v1beta1"
+	networkingv1 "k8s.io/api/networking/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	schedulingv1 "k8s.io/api/scheduling/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 )
 
+// The key of the REST server leader in the high availability ConfigMap of
+// Flink 1.15 and later.
+const haRESTServerLeaderKey = "org.apache.flink.k8s.leader.restserver"
+
 // ClusterStateObserver gets the observed state of the cluster.
 type ClusterStateObserver struct {
 	k8sClient   client.Client
+	apiReader   client.Reader
 	flinkClient flinkclient.FlinkClient
 	request     ctrl.Request
 	context     context.Context
 	log         logr.Logger
+
+	// Decides in which reconciles the JobManager metrics are sampled, they
+	// are never sampled if it is nil.
+	metricsSampler *MetricsSampler
+
+	// Decides when the job metrics are polled, they are never polled if it is
+	// nil.
+	jobMetricsPoller *MetricsPoller
+
+	// Tells whether the cluster failed the health check of its Flink REST
+	// API, it is never unhealthy if it is nil.
+	healthChecker *ClusterHealthChecker
+
+	// Names the resources of the cluster, set once the cluster is observed.
+	namer ResourceNamer
 }
 
 // ObservedClusterState holds observed state of a cluster.
 type ObservedClusterState struct {
-	cluster            *v1beta1.FlinkCluster
-	configMap          *corev1.ConfigMap
-	jmDeployment       *appsv1.Deployment
-	jmService          *corev1.Service
-	jmIngress          *extensionsv1beta1.Ingress
-	tmDeployment       *appsv1.Deployment
-	job                *batchv1.Job
-	flinkJobList       *flinkclient.JobStatusList
-	flinkRunningJobIDs []string
-	flinkJobID         *string
+	cluster                *v1beta1.FlinkCluster
+	configMap              *corev1.ConfigMap
+	flinkConfigMap         *corev1.ConfigMap
+	jmDeployment           *appsv1.Deployment
+	jmPods                 []corev1.Pod
+	jmLeaderAddress        string
+	jmService              *corev1.Service
+	jmIngress              *extensionsv1beta1.Ingress
+	tmDeployment           *appsv1.Deployment
+	tmStatefulSet          *appsv1.StatefulSet
+	tmPods                 []corev1.Pod
+	tmPools                map[string]*appsv1.Deployment
+	job                    *batchv1.Job
+	jobPods                []corev1.Pod
+	clusterA               *v1beta1.FlinkCluster
+	clusterB               *v1beta1.FlinkCluster
+	virtualService         *unstructured.Unstructured
+	serviceAccount         *corev1.ServiceAccount
+	role                   *rbacv1.Role
+	roleBinding            *rbacv1.RoleBinding
+	checkpointPVC          *corev1.PersistentVolumeClaim
+	diagnosticsJob         *batchv1.Job
+	diagnosticsSA          *corev1.ServiceAccount
+	diagnosticsRole        *rbacv1.Role
+	diagnosticsRoleBinding *rbacv1.RoleBinding
+	successHookTemplate    *batchv1beta1.CronJob
+	networkPolicy          *networkingv1.NetworkPolicy
+	grafanaDashboards      []corev1.ConfigMap
+	namespace              *corev1.Namespace
+	missingPullSecrets     []string
+	missingPriorityClasses []string
+	specErrors             []string
+	resourceQuotas         []corev1.ResourceQuota
+	limitRanges            []corev1.LimitRange
+	flinkJobList           *flinkclient.JobStatusList
+	flinkRunningJobIDs     []string
+	flinkJobID             *string
+	flinkBackpressure      []v1beta1.VertexBackpressure
+	flinkOverview          *flinkclient.ClusterOverview
+	flinkTaskManagers      *flinkclient.TaskManagerList
+	flinkCheckpoints       *flinkclient.CheckpointStatistics
+	jmMetrics              *v1beta1.JobManagerMetrics
+	flinkJobMetrics        *v1beta1.JobMetrics
+	flinkTLSError          string
+	unhealthy              bool
+	orphans                []runtime.Object
 }
 
 // Observes the state of the cluster and its components.
@@ -74,7 +140,44 @@ func (observer *ClusterStateObserver) observe(
 		observedCluster = nil
 	} else {
 		log.Info("Observed cluster", "cluster", *observedCluster)
+		var templateErrors []string
+		var templateRef = observedCluster.Spec.TemplateRef
+		if templateRef != nil && len(templateRef.Name) > 0 {
+			var template *v1beta1.FlinkClusterTemplate
+			template, err = observer.observeClusterTemplate(observedCluster)
+			if err != nil {
+				return err
+			}
+			if template == nil {
+				templateErrors = append(templateErrors, fmt.Sprintf(
+					"cluster template %v does not exist in namespace %v",
+					templateRef.Name, observedCluster.Namespace))
+			}
+			var rawSpec []byte
+			rawSpec, err = observer.observeRawClusterSpec(observedCluster)
+			if err != nil {
+				return err
+			}
+			observedCluster, err = v1beta1.GetTemplatedCluster(
+				observedCluster, rawSpec, template)
+			if err != nil {
+				return err
+			}
+		}
 		observed.cluster = observedCluster
+		observed.specErrors = append(
+			templateErrors, validateSpec(observedCluster)...)
+	}
+
+	// The resources of a deleted cluster are looked up by the name of the
+	// cluster.
+	if observed.cluster != nil {
+		observer.namer = NewResourceNamer(observed.cluster)
+	} else {
+		observer.namer = ResourceNamer{
+			namespace: observer.request.Namespace,
+			prefix:    observer.request.Name,
+		}
 	}
 
 	// ConfigMap.
@@ -97,97 +200,885 @@ func (observer *ClusterStateObserver) observe(
 	err = observer.observeJobManagerDeployment(observedJmDeployment)
 	if err != nil {
 		if client.IgnoreNotFound(err) != nil {
-			log.Error(err, "Failed to get JobManager deployment")
+			log.Error(err, "Failed to get JobManager deployment")
+			return err
+		}
+		log.Info("Observed JobManager deployment", "state", "nil")
+		observedJmDeployment = nil
+	} else {
+		log.Info("Observed JobManager deployment", "state", *observedJmDeployment)
+		observed.jmDeployment = observedJmDeployment
+	}
+
+	// JobManager pods.
+	err = observer.observeJobManagerPods(observed)
+	if err != nil {
+		return err
+	}
+
+	// (Optional) JobManager leader of Kubernetes high availability.
+	err = observer.observeJobManagerLeader(observed)
+	if err != nil {
+		return err
+	}
+
+	// JobManager service.
+	var observedJmService = new(corev1.Service)
+	err = observer.observeJobManagerService(observedJmService)
+	if err != nil {
+		if client.IgnoreNotFound(err) != nil {
+			log.Error(err, "Failed to get JobManager service")
+			return err
+		}
+		log.Info("Observed JobManager service", "state", "nil")
+		observedJmService = nil
+	} else {
+		log.Info("Observed JobManager service", "state", *observedJmService)
+		observed.jmService = observedJmService
+	}
+
+	// (Optional) JobManager ingress.
+	var observedJmIngress = new(extensionsv1beta1.Ingress)
+	err = observer.observeJobManagerIngress(observedJmIngress)
+	if err != nil {
+		if client.IgnoreNotFound(err) != nil {
+			log.Error(err, "Failed to get JobManager ingress")
+			return err
+		}
+		log.Info("Observed JobManager ingress", "state", "nil")
+		observedJmIngress = nil
+	} else {
+		log.Info("Observed JobManager ingress", "state", *observedJmIngress)
+		observed.jmIngress = observedJmIngress
+	}
+
+	// TaskManager deployment.
+	var observedTmDeployment = new(appsv1.Deployment)
+	err = observer.observeTaskManagerDeployment(observedTmDeployment)
+	if err != nil {
+		if client.IgnoreNotFound(err) != nil {
+			log.Error(err, "Failed to get TaskManager deployment")
+			return err
+		}
+		log.Info("Observed TaskManager deployment", "state", "nil")
+		observedTmDeployment = nil
+	} else {
+		log.Info("Observed TaskManager deployment", "state", *observedTmDeployment)
+		observed.tmDeployment = observedTmDeployment
+	}
+
+	// (Optional) TaskManager StatefulSet, instead of the deployment when the
+	// TaskManagers have volume claim templates.
+	var observedTmStatefulSet = new(appsv1.StatefulSet)
+	err = observer.observeTaskManagerStatefulSet(observedTmStatefulSet)
+	if err != nil {
+		if client.IgnoreNotFound(err) != nil {
+			log.Error(err, "Failed to get TaskManager StatefulSet")
+			return err
+		}
+		log.Info("Observed TaskManager StatefulSet", "state", "nil")
+		observedTmStatefulSet = nil
+	} else {
+		log.Info("Observed TaskManager StatefulSet", "state", *observedTmStatefulSet)
+		observed.tmStatefulSet = observedTmStatefulSet
+	}
+
+	// TaskManager pods.
+	err = observer.observeTaskManagerPods(observed)
+	if err != nil {
+		return err
+	}
+
+	// TaskManager pool deployments.
+	err = observer.observeTaskManagerPools(observed)
+	if err != nil {
+		return err
+	}
+
+	// (Optional) service account and RBAC.
+	err = observer.observeServiceAccount(observed)
+	if err != nil {
+		return err
+	}
+
+	// (Optional) checkpoint storage.
+	err = observer.observeCheckpointPVC(observed)
+	if err != nil {
+		return err
+	}
+
+	// (Optional) namespace, whose labels are inherited.
+	err = observer.observeNamespace(observed)
+	if err != nil {
+		return err
+	}
+
+	// Image pull secrets.
+	err = observer.observePullSecrets(observed)
+	if err != nil {
+		return err
+	}
+
+	// Priority classes.
+	err = observer.observePriorityClasses(observed)
+	if err != nil {
+		return err
+	}
+
+	// (Optional) external Flink ConfigMap.
+	err = observer.observeFlinkConfigMap(observed)
+	if err != nil {
+		return err
+	}
+
+	// Resource quotas and limit ranges of the namespace.
+	err = observer.observeResourceQuotas(observed)
+	if err != nil {
+		return err
+	}
+
+	// (Optional) TLS of the Flink REST API.
+	err = observer.observeFlinkTLS(observed)
+	if err != nil {
+		return err
+	}
+
+	// Health of the Flink REST API, checked in the background.
+	if observed.cluster != nil && observer.healthChecker != nil {
+		observed.unhealthy = observer.healthChecker.IsUnhealthy(observed.cluster)
+	}
+
+	// Flink cluster overview, available only when the cluster is running.
+	if observed.cluster != nil &&
+		observed.cluster.Status.State == v1beta1.ClusterStateRunning &&
+		len(observed.flinkTLSError) == 0 {
+		observer.observeFlinkOverview(
+			getFlinkAPIBaseURL(observed.cluster), observed)
+	}
+
+	// (Optional) JobManager metrics, sampled periodically when the cluster is
+	// running.
+	if observed.cluster != nil &&
+		observed.cluster.Status.State == v1beta1.ClusterStateRunning &&
+		len(observed.flinkTLSError) == 0 &&
+		observer.metricsSampler != nil &&
+		observer.metricsSampler.ShouldSample(observer.request.NamespacedName) {
+		observer.observeJobManagerMetrics(
+			getFlinkAPIBaseURL(observed.cluster), observed)
+	}
+
+	// TaskManagers, to count their free slots when the cluster is running and
+	// to drain them before scaling down.
+	if observed.cluster != nil &&
+		(observed.cluster.Status.State == v1beta1.ClusterStateRunning ||
+			isTaskManagerScalingDown(observed)) &&
+		len(observed.flinkTLSError) == 0 {
+		observer.observeFlinkTaskManagers(
+			getFlinkAPIBaseURL(observed.cluster), observed)
+	}
+
+	// (Optional) job.
+	err = observer.observeJob(observed)
+	if err != nil {
+		return err
+	}
+
+	// (Optional) traffic splitting.
+	err = observer.observeTrafficSplitting(observed)
+	if err != nil {
+		return err
+	}
+
+	// (Optional) diagnostics bundle collector.
+	err = observer.observeDiagnosticsJob(observed)
+	if err != nil {
+		return err
+	}
+
+	// (Optional) job template of the success hooks.
+	err = observer.observeSuccessHookTemplate(observed)
+	if err != nil {
+		return err
+	}
+
+	// (Optional) network policy.
+	err = observer.observeNetworkPolicy(observed)
+	if err != nil {
+		return err
+	}
+
+	// (Optional) Grafana dashboard.
+	err = observer.observeGrafanaDashboards(observed)
+
+	return err
+}
+
+func (observer *ClusterStateObserver) observeJob(
+	observed *ObservedClusterState) error {
+	var err error
+	var log = observer.log
+
+	if observed.cluster == nil {
+		return nil
+	}
+	// A session cluster, which might have an orphaned job.
+	if observed.cluster.Spec.Job == nil {
+		if observed.cluster.Spec.ObserveSessionJobs {
+			observer.observeFlinkJobs(observed)
+		}
+		return observer.observeOrphanJob(observed)
+	}
+
+	// Flink job status list can be available before there is any job
+	// submitted.
+	observer.observeFlinkJobs(observed)
+
+	// Job resource.
+	var observedJob = new(batchv1.Job)
+	err = observer.observeJobResource(observedJob)
+	if err != nil {
+		if client.IgnoreNotFound(err) != nil {
+			log.Error(err, "Failed to get job")
+			return err
+		}
+		log.Info("Observed job", "state", "nil")
+		observedJob = nil
+	} else {
+		log.Info("Observed job", "state", *observedJob)
+		observed.job = observedJob
+	}
+
+	// The pods of the job, only for the failures of the JAR downloader.
+	if observed.job != nil && len(observed.cluster.Spec.Job.JarURI) > 0 {
+		err = observer.observeJobPods(observed)
+	}
+
+	return err
+}
+
+// Observes the pods of the job submitter, which are labeled by the UID of the
+// job by the job controller.
+func (observer *ClusterStateObserver) observeJobPods(
+	observed *ObservedClusterState) error {
+	var log = observer.log
+
+	var pods = new(corev1.PodList)
+	var err = observer.k8sClient.List(
+		observer.context,
+		pods,
+		client.InNamespace(observer.request.Namespace),
+		client.MatchingLabels{"controller-uid": string(observed.job.UID)})
+	if err != nil {
+		log.Error(err, "Failed to list job pods")
+		return err
+	}
+
+	observed.jobPods = pods.Items
+	log.Info("Observed job pods", "pods", len(observed.jobPods))
+	return nil
+}
+
+// Observes the image pull secrets referenced by the cluster, the missing ones
+// are recorded. Secrets are read from the API server directly, so that the
+// operator doesn't cache all the secrets.
+func (observer *ClusterStateObserver) observePullSecrets(
+	observed *ObservedClusterState) error {
+	var log = observer.log
+
+	if observed.cluster == nil || observer.apiReader == nil {
+		return nil
+	}
+
+	for _, pullSecret := range observed.cluster.Spec.Image.PullSecrets {
+		var secret = new(corev1.Secret)
+		var err = observer.apiReader.Get(
+			observer.context,
+			types.NamespacedName{
+				Namespace: observer.request.Namespace,
+				Name:      pullSecret.Name,
+			},
+			secret)
+		if err != nil {
+			if client.IgnoreNotFound(err) != nil {
+				log.Error(err, "Failed to get image pull secret")
+				return err
+			}
+			log.Info("Image pull secret not found", "secret", pullSecret.Name)
+			observed.missingPullSecrets = append(
+				observed.missingPullSecrets, pullSecret.Name)
+		}
+	}
+	return nil
+}
+
+// Observes the PriorityClasses referenced by the JobManager and TaskManager
+// specs, the missing ones are recorded. PriorityClasses are cluster-scoped, so
+// they are read from the API server directly, which also works when the cache
+// is restricted to a namespace. A PriorityClass the operator is not allowed
+// to read is unknown, not missing, so the pods are created and the API server
+// checks it.
+func (observer *ClusterStateObserver) observePriorityClasses(
+	observed *ObservedClusterState) error {
+	var log = observer.log
+
+	if observed.cluster == nil || observer.apiReader == nil {
+		return nil
+	}
+
+	var jmPriorityClass = observed.cluster.Spec.JobManager.PriorityClassName
+	var tmPriorityClass = observed.cluster.Spec.TaskManager.PriorityClassName
+	var names = []string{}
+	if len(jmPriorityClass) > 0 {
+		names = append(names, jmPriorityClass)
+	}
+	if len(tmPriorityClass) > 0 && tmPriorityClass != jmPriorityClass {
+		names = append(names, tmPriorityClass)
+	}
+	for _, name := range names {
+		var priorityClass = new(schedulingv1.PriorityClass)
+		var err = observer.apiReader.Get(
+			observer.context, types.NamespacedName{Name: name}, priorityClass)
+		if err != nil {
+			if k8serrors.IsForbidden(err) {
+				log.Info(
+					"Not allowed to get priority class, assuming it exists",
+					"priorityClass", name)
+				continue
+			}
+			if client.IgnoreNotFound(err) != nil {
+				log.Error(err, "Failed to get priority class")
+				return err
+			}
+			log.Info("Priority class not found", "priorityClass", name)
+			observed.missingPriorityClasses = append(
+				observed.missingPriorityClasses, name)
+		}
+	}
+	return nil
+}
+
+// Observes the external Flink ConfigMap referenced by the cluster, which is
+// nil if it does not exist.
+func (observer *ClusterStateObserver) observeFlinkConfigMap(
+	observed *ObservedClusterState) error {
+	var log = observer.log
+
+	if observed.cluster == nil || len(observed.cluster.Spec.FlinkConfigMap) == 0 {
+		return nil
+	}
+
+	var configMap = new(corev1.ConfigMap)
+	var err = observer.k8sClient.Get(
+		observer.context,
+		types.NamespacedName{
+			Namespace: observer.request.Namespace,
+			Name:      observed.cluster.Spec.FlinkConfigMap,
+		},
+		configMap)
+	if err != nil {
+		if client.IgnoreNotFound(err) != nil {
+			log.Error(err, "Failed to get Flink configMap")
+			return err
+		}
+		log.Info(
+			"Flink configMap not found",
+			"configMap",
+			observed.cluster.Spec.FlinkConfigMap)
+		return nil
+	}
+	log.Info("Observed Flink configMap", "name", configMap.Name)
+	observed.flinkConfigMap = configMap
+	return nil
+}
+
+// Observes the Secret of the Flink REST API TLS and configures the Flink
+// client with it. A misconfiguration, e.g., a missing Secret or an invalid
+// certificate, is recorded in flinkTLSError instead of being returned, so that
+// it is reported in the status rather than as a connection error of each
+// Flink API request.
+func (observer *ClusterStateObserver) observeFlinkTLS(
+	observed *ObservedClusterState) error {
+	var log = observer.log
+
+	if observed.cluster == nil || observer.apiReader == nil {
+		return nil
+	}
+	var security = observed.cluster.Spec.Security
+	if security == nil || security.RESTTLS == nil {
+		return nil
+	}
+
+	var restTLS = security.RESTTLS
+	var secret = new(corev1.Secret)
+	var err = observer.apiReader.Get(
+		observer.context,
+		types.NamespacedName{
+			Namespace: observer.request.Namespace,
+			Name:      restTLS.SecretName,
+		},
+		secret)
+	if err != nil {
+		if client.IgnoreNotFound(err) != nil {
+			log.Error(err, "Failed to get Flink REST TLS secret")
+			return err
+		}
+		observed.flinkTLSError = fmt.Sprintf(
+			"secret %v does not exist", restTLS.SecretName)
+		log.Info("Flink REST TLS misconfigured", "error", observed.flinkTLSError)
+		return nil
+	}
+
+	tlsConfig, err := flinkclient.NewTLSConfig(
+		secret.Data[corev1.ServiceAccountRootCAKey],
+		secret.Data[corev1.TLSCertKey],
+		secret.Data[corev1.TLSPrivateKeyKey],
+		restTLS.InsecureSkipVerify)
+	if err != nil {
+		observed.flinkTLSError = fmt.Sprintf(
+			"secret %v: %v", restTLS.SecretName, err)
+		log.Info("Flink REST TLS misconfigured", "error", observed.flinkTLSError)
+		return nil
+	}
+	observer.flinkClient = observer.flinkClient.WithTLSConfig(tlsConfig)
+	log.Info("Observed Flink REST TLS secret", "secret", restTLS.SecretName)
+	return nil
+}
+
+// Observes the namespace of the cluster, only when some of its labels should
+// be inherited. Namespaces are cluster-scoped, so it is read from the API
+// server directly, which also works when the cache is restricted to the
+// watched namespaces.
+func (observer *ClusterStateObserver) observeNamespace(
+	observed *ObservedClusterState) error {
+	var log = observer.log
+
+	if observed.cluster == nil || observer.apiReader == nil ||
+		len(observed.cluster.Spec.InheritNamespaceLabels) == 0 {
+		return nil
+	}
+
+	var observedNamespace = new(corev1.Namespace)
+	var err = observer.apiReader.Get(
+		observer.context,
+		types.NamespacedName{Name: observer.request.Namespace},
+		observedNamespace)
+	if err != nil {
+		if client.IgnoreNotFound(err) != nil {
+			log.Error(err, "Failed to get namespace")
+			return err
+		}
+		log.Info("Observed namespace", "state", "nil")
+	} else {
+		log.Info("Observed namespace", "labels", observedNamespace.Labels)
+		observed.namespace = observedNamespace
+	}
+	return nil
+}
+
+func (observer *ClusterStateObserver) observeCheckpointPVC(
+	observed *ObservedClusterState) error {
+	var log = observer.log
+
+	// Only the PVC created by the operator is observed.
+	if observed.cluster == nil ||
+		observed.cluster.Spec.CheckpointStorage == nil ||
+		len(observed.cluster.Spec.CheckpointStorage.StorageClass) == 0 {
+		return nil
+	}
+
+	var observedPVC = new(corev1.PersistentVolumeClaim)
+	var err = observer.k8sClient.Get(
+		observer.context,
+		types.NamespacedName{
+			Namespace: observer.request.Namespace,
+			Name:      observed.cluster.Spec.CheckpointStorage.PVCName,
+		},
+		observedPVC)
+	if err != nil {
+		if client.IgnoreNotFound(err) != nil {
+			log.Error(err, "Failed to get checkpoint PVC")
+			return err
+		}
+		log.Info("Observed checkpoint PVC", "state", "nil")
+	} else {
+		log.Info("Observed checkpoint PVC", "state", *observedPVC)
+		observed.checkpointPVC = observedPVC
+	}
+	return nil
+}
+
+// Observes the network policy even if it is not enabled, so that it is
+// deleted after it is disabled.
+func (observer *ClusterStateObserver) observeNetworkPolicy(
+	observed *ObservedClusterState) error {
+	var log = observer.log
+
+	if observed.cluster == nil {
+		return nil
+	}
+
+	var observedPolicy = new(networkingv1.NetworkPolicy)
+	var err = observer.k8sClient.Get(
+		observer.context,
+		types.NamespacedName{
+			Namespace: observer.request.Namespace,
+			Name:      observer.namer.NetworkPolicyName(),
+		},
+		observedPolicy)
+	if err != nil {
+		if client.IgnoreNotFound(err) != nil {
+			log.Error(err, "Failed to get network policy")
+			return err
+		}
+		log.Info("Observed network policy", "state", "nil")
+	} else {
+		log.Info("Observed network policy", "state", *observedPolicy)
+		observed.networkPolicy = observedPolicy
+	}
+	return nil
+}
+
+// Observes the Grafana dashboard ConfigMaps of the cluster, the one of the
+// spec and the one recorded in the status, so that the recorded one is deleted
+// after the dashboard is disabled or moved to another namespace. They are read
+// through the API server, because their namespaces might not be watched.
+func (observer *ClusterStateObserver) observeGrafanaDashboards(
+	observed *ObservedClusterState) error {
+	var log = observer.log
+
+	if observed.cluster == nil || observer.apiReader == nil {
+		return nil
+	}
+
+	var dashboards, err = getGrafanaDashboards(
+		observer.context, observer.apiReader, observed.cluster)
+	if err != nil {
+		log.Error(err, "Failed to get Grafana dashboards")
+		return err
+	}
+
+	observed.grafanaDashboards = dashboards
+	log.Info("Observed Grafana dashboards", "dashboards", len(dashboards))
+	return nil
+}
+
+func (observer *ClusterStateObserver) observeDiagnosticsJob(
+	observed *ObservedClusterState) error {
+	var log = observer.log
+
+	if observed.cluster == nil || observed.cluster.Spec.DiagnosticsBundle == nil {
+		return nil
+	}
+
+	var observedJob = new(batchv1.Job)
+	var err = observer.k8sClient.Get(
+		observer.context,
+		types.NamespacedName{
+			Namespace: observer.request.Namespace,
+			Name:      observer.namer.DiagnosticsJobName(),
+		},
+		observedJob)
+	if err != nil {
+		if client.IgnoreNotFound(err) != nil {
+			log.Error(err, "Failed to get diagnostics job")
+			return err
+		}
+		log.Info("Observed diagnostics job", "state", "nil")
+	} else {
+		log.Info("Observed diagnostics job", "state", *observedJob)
+		observed.diagnosticsJob = observedJob
+	}
+
+	// The service account of the collector and its RBAC.
+	var observedServiceAccount = new(corev1.ServiceAccount)
+	err = observer.k8sClient.Get(
+		observer.context,
+		types.NamespacedName{
+			Namespace: observer.request.Namespace,
+			Name:      observer.namer.DiagnosticsServiceAccountName(),
+		},
+		observedServiceAccount)
+	if err != nil {
+		if client.IgnoreNotFound(err) != nil {
+			log.Error(err, "Failed to get diagnostics service account")
+			return err
+		}
+		log.Info("Observed diagnostics service account", "state", "nil")
+	} else {
+		log.Info("Observed diagnostics service account", "state", *observedServiceAccount)
+		observed.diagnosticsSA = observedServiceAccount
+	}
+
+	var observedRole = new(rbacv1.Role)
+	err = observer.k8sClient.Get(
+		observer.context,
+		types.NamespacedName{
+			Namespace: observer.request.Namespace,
+			Name:      observer.namer.DiagnosticsRoleName(),
+		},
+		observedRole)
+	if err != nil {
+		if client.IgnoreNotFound(err) != nil {
+			log.Error(err, "Failed to get diagnostics role")
+			return err
+		}
+		log.Info("Observed diagnostics role", "state", "nil")
+	} else {
+		log.Info("Observed diagnostics role", "state", *observedRole)
+		observed.diagnosticsRole = observedRole
+	}
+
+	var observedRoleBinding = new(rbacv1.RoleBinding)
+	err = observer.k8sClient.Get(
+		observer.context,
+		types.NamespacedName{
+			Namespace: observer.request.Namespace,
+			Name:      observer.namer.DiagnosticsRoleBindingName(),
+		},
+		observedRoleBinding)
+	if err != nil {
+		if client.IgnoreNotFound(err) != nil {
+			log.Error(err, "Failed to get diagnostics role binding")
+			return err
+		}
+		log.Info("Observed diagnostics role binding", "state", "nil")
+	} else {
+		log.Info("Observed diagnostics role binding", "state", *observedRoleBinding)
+		observed.diagnosticsRoleBinding = observedRoleBinding
+	}
+	return nil
+}
+
+// Observes the CronJob whose job template is triggered by the success hooks,
+// only while the hooks are due. It is read from the API server directly, so
+// that the CronJobs of the namespace are not cached.
+func (observer *ClusterStateObserver) observeSuccessHookTemplate(
+	observed *ObservedClusterState) error {
+	var log = observer.log
+
+	if observed.cluster == nil || observer.apiReader == nil ||
+		!isSuccessHooksDue(observed.cluster) {
+		return nil
+	}
+	var name = observed.cluster.Spec.Job.OnSuccess.TriggerJobName
+	if len(name) == 0 {
+		return nil
+	}
+
+	var cronJob = new(batchv1beta1.CronJob)
+	var err = observer.apiReader.Get(
+		observer.context,
+		types.NamespacedName{
+			Namespace: observer.request.Namespace,
+			Name:      name,
+		},
+		cronJob)
+	if err != nil {
+		if client.IgnoreNotFound(err) != nil {
+			log.Error(err, "Failed to get the job template of the success hooks")
+			return err
+		}
+		log.Info("Job template of the success hooks not found", "cronJob", name)
+		return nil
+	}
+	log.Info("Observed job template of the success hooks", "cronJob", name)
+	observed.successHookTemplate = cronJob
+	return nil
+}
+
+func (observer *ClusterStateObserver) observeServiceAccount(
+	observed *ObservedClusterState) error {
+	var log = observer.log
+	var clusterNamespace = observer.request.Namespace
+
+	// Only the service account created by the operator is observed, an
+	// existing one referenced by the cluster is not managed.
+	if observed.cluster == nil || observed.cluster.Spec.ServiceAccount == nil ||
+		!observed.cluster.Spec.ServiceAccount.Create {
+		return nil
+	}
+
+	// Service account.
+	var observedServiceAccount = new(corev1.ServiceAccount)
+	var err = observer.k8sClient.Get(
+		observer.context,
+		types.NamespacedName{
+			Namespace: clusterNamespace,
+			Name:      observed.cluster.Spec.ServiceAccount.Name,
+		},
+		observedServiceAccount)
+	if err != nil {
+		if client.IgnoreNotFound(err) != nil {
+			log.Error(err, "Failed to get service account")
+			return err
+		}
+		log.Info("Observed service account", "state", "nil")
+	} else {
+		log.Info("Observed service account", "state", *observedServiceAccount)
+		observed.serviceAccount = observedServiceAccount
+	}
+
+	// Role.
+	var observedRole = new(rbacv1.Role)
+	err = observer.k8sClient.Get(
+		observer.context,
+		types.NamespacedName{
+			Namespace: clusterNamespace,
+			Name:      observer.namer.RoleName(),
+		},
+		observedRole)
+	if err != nil {
+		if client.IgnoreNotFound(err) != nil {
+			log.Error(err, "Failed to get role")
+			return err
+		}
+		log.Info("Observed role", "state", "nil")
+	} else {
+		log.Info("Observed role", "state", *observedRole)
+		observed.role = observedRole
+	}
+
+	// Role binding.
+	var observedRoleBinding = new(rbacv1.RoleBinding)
+	err = observer.k8sClient.Get(
+		observer.context,
+		types.NamespacedName{
+			Namespace: clusterNamespace,
+			Name:      observer.namer.RoleBindingName(),
+		},
+		observedRoleBinding)
+	if err != nil {
+		if client.IgnoreNotFound(err) != nil {
+			log.Error(err, "Failed to get role binding")
 			return err
 		}
-		log.Info("Observed JobManager deployment", "state", "nil")
-		observedJmDeployment = nil
+		log.Info("Observed role binding", "state", "nil")
 	} else {
-		log.Info("Observed JobManager deployment", "state", *observedJmDeployment)
-		observed.jmDeployment = observedJmDeployment
+		log.Info("Observed role binding", "state", *observedRoleBinding)
+		observed.roleBinding = observedRoleBinding
 	}
 
-	// JobManager service.
-	var observedJmService = new(corev1.Service)
-	err = observer.observeJobManagerService(observedJmService)
+	return nil
+}
+
+func (observer *ClusterStateObserver) observeTrafficSplitting(
+	observed *ObservedClusterState) error {
+	var log = observer.log
+
+	// The VirtualService is observed only when traffic splitting is enabled
+	// or its resources are recorded in the status, so that clusters without
+	// Istio installed are not affected.
+	if observed.cluster == nil ||
+		(getTrafficSplitting(observed.cluster) == nil &&
+			observed.cluster.Status.Components.TrafficSplitting == nil) {
+		return nil
+	}
+
+	// Cluster of version A.
+	var observedClusterA = new(v1beta1.FlinkCluster)
+	var err = observer.observeVersionCluster("a", observedClusterA)
 	if err != nil {
 		if client.IgnoreNotFound(err) != nil {
-			log.Error(err, "Failed to get JobManager service")
+			log.Error(err, "Failed to get cluster of version A")
 			return err
 		}
-		log.Info("Observed JobManager service", "state", "nil")
-		observedJmService = nil
+		log.Info("Observed cluster of version A", "state", "nil")
 	} else {
-		log.Info("Observed JobManager service", "state", *observedJmService)
-		observed.jmService = observedJmService
+		log.Info("Observed cluster of version A", "state", *observedClusterA)
+		observed.clusterA = observedClusterA
 	}
 
-	// (Optional) JobManager ingress.
-	var observedJmIngress = new(extensionsv1beta1.Ingress)
-	err = observer.observeJobManagerIngress(observedJmIngress)
+	// Cluster of version B.
+	var observedClusterB = new(v1beta1.FlinkCluster)
+	err = observer.observeVersionCluster("b", observedClusterB)
 	if err != nil {
 		if client.IgnoreNotFound(err) != nil {
-			log.Error(err, "Failed to get JobManager ingress")
+			log.Error(err, "Failed to get cluster of version B")
 			return err
 		}
-		log.Info("Observed JobManager ingress", "state", "nil")
-		observedJmIngress = nil
+		log.Info("Observed cluster of version B", "state", "nil")
 	} else {
-		log.Info("Observed JobManager ingress", "state", *observedJmIngress)
-		observed.jmIngress = observedJmIngress
+		log.Info("Observed cluster of version B", "state", *observedClusterB)
+		observed.clusterB = observedClusterB
 	}
 
-	// TaskManager deployment.
-	var observedTmDeployment = new(appsv1.Deployment)
-	err = observer.observeTaskManagerDeployment(observedTmDeployment)
+	// VirtualService.
+	var observedVirtualService = new(unstructured.Unstructured)
+	observedVirtualService.SetGroupVersionKind(virtualServiceGVK)
+	err = observer.k8sClient.Get(
+		observer.context,
+		types.NamespacedName{
+			Namespace: observer.request.Namespace,
+			Name:      observer.namer.VirtualServiceName(),
+		},
+		observedVirtualService)
 	if err != nil {
 		if client.IgnoreNotFound(err) != nil {
-			log.Error(err, "Failed to get TaskManager deployment")
+			log.Error(err, "Failed to get VirtualService")
 			return err
 		}
-		log.Info("Observed TaskManager deployment", "state", "nil")
-		observedTmDeployment = nil
+		log.Info("Observed VirtualService", "state", "nil")
 	} else {
-		log.Info("Observed TaskManager deployment", "state", *observedTmDeployment)
-		observed.tmDeployment = observedTmDeployment
+		log.Info("Observed VirtualService", "state", *observedVirtualService)
+		observed.virtualService = observedVirtualService
 	}
 
-	// (Optional) job.
-	err = observer.observeJob(observed)
-
-	return err
+	return nil
 }
 
-func (observer *ClusterStateObserver) observeJob(
-	observed *ObservedClusterState) error {
-	var err error
+// Observes the overview of the Flink cluster through Flink API, it is left nil
+// when the JobManager is unreachable.
+func (observer *ClusterStateObserver) observeFlinkOverview(
+	apiBaseURL string,
+	observed *ObservedClusterState) {
 	var log = observer.log
 
-	// Either the cluster has been deleted or it is a session cluster.
-	if observed.cluster == nil || observed.cluster.Spec.Job == nil {
-		return nil
+	var overview, err = observer.flinkClient.GetClusterOverview(apiBaseURL)
+	if err != nil {
+		log.Info("Failed to get Flink cluster overview.", "error", err)
+		return
 	}
+	observed.flinkOverview = &overview
+	log.Info("Observed Flink cluster overview", "overview", overview)
+}
 
-	// Flink job status list can be available before there is any job
-	// submitted.
-	observer.observeFlinkJobs(observed)
+// Observes the heap and garbage collector metrics of the JobManager through
+// Flink API, they are left nil when the JobManager is unreachable or the
+// metrics are not available.
+func (observer *ClusterStateObserver) observeJobManagerMetrics(
+	apiBaseURL string,
+	observed *ObservedClusterState) {
+	var log = observer.log
 
-	// Job resource.
-	var observedJob = new(batchv1.Job)
-	err = observer.observeJobResource(observedJob)
+	var metrics, err = observer.flinkClient.GetJobManagerMetrics(apiBaseURL)
 	if err != nil {
-		if client.IgnoreNotFound(err) != nil {
-			log.Error(err, "Failed to get job")
-			return err
-		}
-		log.Info("Observed job", "state", "nil")
-		observedJob = nil
-	} else {
-		log.Info("Observed job", "state", *observedJob)
-		observed.job = observedJob
+		log.Info("Failed to get JobManager metrics.", "error", err)
+		return
+	}
+	var snapshot = getJobManagerMetricsSnapshot(metrics)
+	if snapshot == nil {
+		log.Info("JobManager heap metrics are not available.")
+		return
 	}
+	setTimestamp(&snapshot.ObservedTime)
+	observed.jmMetrics = snapshot
+	log.Info("Observed JobManager metrics", "metrics", *snapshot)
+}
 
-	return nil
+// Observes the TaskManagers registered with the JobManager through Flink API,
+// they are left nil when the JobManager is unreachable.
+func (observer *ClusterStateObserver) observeFlinkTaskManagers(
+	apiBaseURL string,
+	observed *ObservedClusterState) {
+	var log = observer.log
+
+	var taskManagers, err = observer.flinkClient.GetTaskManagers(apiBaseURL)
+	if err != nil {
+		log.Info("Failed to get Flink TaskManagers.", "error", err)
+		return
+	}
+	observed.flinkTaskManagers = &taskManagers
+	log.Info("Observed Flink TaskManagers", "taskManagers", taskManagers)
 }
 
 // Observes Flink jobs through Flink API (instead of Kubernetes jobs through
@@ -209,6 +1100,13 @@ func (observer *ClusterStateObserver) observeFlinkJobs(
 			observed.cluster.Status.State)
 		return
 	}
+	if len(observed.flinkTLSError) > 0 {
+		log.Info(
+			"Skip getting Flink job status.",
+			"tlsError",
+			observed.flinkTLSError)
+		return
+	}
 
 	// Get Flink job status list.
 	var jobList = &flinkclient.JobStatusList{}
@@ -235,6 +1133,12 @@ func (observer *ClusterStateObserver) observeFlinkJobs(
 		}
 	}
 
+	// The jobs of a session cluster are submitted by its users, any number of
+	// them might be running.
+	if observed.cluster.Spec.Job == nil {
+		return
+	}
+
 	// Extract Flink job ID.
 	// It is okay if there are multiple jobs, but at most one of them is
 	// expected to be running. This is typically caused by job client
@@ -261,6 +1165,122 @@ func (observer *ClusterStateObserver) observeFlinkJobs(
 	if flinkJobID != nil {
 		log.Info("Observed Flink job ID", "ID", *flinkJobID)
 	}
+
+	// Get the checkpoints of the running job, and poll its throughput and the
+	// backpressure of its vertices, which take a request per vertex.
+	if len(observed.flinkRunningJobIDs) == 1 {
+		var apiBaseURL = getFlinkAPIBaseURL(observed.cluster)
+		var jobID = observed.flinkRunningJobIDs[0]
+		observer.observeFlinkCheckpoints(apiBaseURL, jobID, observed)
+		if observer.jobMetricsPoller != nil &&
+			observer.jobMetricsPoller.ShouldPoll(
+				observer.request.NamespacedName, time.Now()) {
+			var details, err = observer.flinkClient.GetJobDetails(
+				apiBaseURL, jobID)
+			if err != nil {
+				log.Info("Failed to get Flink job details.", "error", err)
+				return
+			}
+			observer.observeFlinkJobMetrics(apiBaseURL, details, observed)
+			observer.observeFlinkBackpressure(apiBaseURL, details, observed)
+		}
+	}
+}
+
+// Observes the throughput of the running Flink job, i.e., the records emitted
+// by its source vertex and received by its sink vertex. The vertices of the
+// job details are in topological order. The result is left nil if it cannot
+// be observed.
+func (observer *ClusterStateObserver) observeFlinkJobMetrics(
+	apiBaseURL string,
+	details flinkclient.JobDetails,
+	observed *ObservedClusterState) {
+	var log = observer.log
+	var jobID = details.ID
+
+	if len(details.Vertices) == 0 {
+		return
+	}
+
+	var source = details.Vertices[0]
+	var sink = details.Vertices[len(details.Vertices)-1]
+	sourceMetrics, err := observer.flinkClient.GetVertexMetrics(
+		apiBaseURL, jobID, source.ID, []string{"numRecordsOutPerSecond"})
+	if err != nil {
+		log.Info("Failed to get Flink vertex metrics.",
+			"vertex", source.Name,
+			"error", err)
+		return
+	}
+	sinkMetrics, err := observer.flinkClient.GetVertexMetrics(
+		apiBaseURL, jobID, sink.ID, []string{"numRecordsInPerSecond"})
+	if err != nil {
+		log.Info("Failed to get Flink vertex metrics.",
+			"vertex", sink.Name,
+			"error", err)
+		return
+	}
+
+	var jobMetrics = &v1beta1.JobMetrics{
+		RecordsPerSecondIn: getAggregatedMetricSum(
+			sourceMetrics, "numRecordsOutPerSecond"),
+		RecordsPerSecondOut: getAggregatedMetricSum(
+			sinkMetrics, "numRecordsInPerSecond"),
+	}
+	setTimestamp(&jobMetrics.ObservedTime)
+	observed.flinkJobMetrics = jobMetrics
+	log.Info("Observed Flink job metrics", "metrics", *jobMetrics)
+}
+
+// Observes the checkpoint statistics of the running Flink job, it is left nil
+// when the JobManager is unreachable.
+func (observer *ClusterStateObserver) observeFlinkCheckpoints(
+	apiBaseURL string,
+	jobID string,
+	observed *ObservedClusterState) {
+	var log = observer.log
+
+	var checkpoints, err = observer.flinkClient.GetCheckpointStatistics(
+		apiBaseURL, jobID)
+	if err != nil {
+		log.Info("Failed to get Flink job checkpoints.", "error", err)
+		return
+	}
+	observed.flinkCheckpoints = &checkpoints
+	log.Info("Observed Flink job checkpoints", "counts", checkpoints.Counts)
+}
+
+// Observes the backpressure of all the vertices of the running Flink job.
+// The result is left nil if it cannot be fully observed, or the sampling of a
+// vertex is still in progress.
+func (observer *ClusterStateObserver) observeFlinkBackpressure(
+	apiBaseURL string,
+	details flinkclient.JobDetails,
+	observed *ObservedClusterState) {
+	var log = observer.log
+
+	var backpressureList = []v1beta1.VertexBackpressure{}
+	for _, vertex := range details.Vertices {
+		var backpressure, err = observer.flinkClient.GetVertexBackpressure(
+			apiBaseURL, details.ID, vertex.ID)
+		if err != nil {
+			log.Info(
+				"Failed to get Flink vertex backpressure.",
+				"vertex", vertex.Name,
+				"error", err)
+			return
+		}
+		if backpressure.Status != flinkclient.BackpressureStatusOK {
+			log.Info(
+				"Flink vertex backpressure sampling in progress.",
+				"vertex", vertex.Name)
+			return
+		}
+		backpressureList = append(
+			backpressureList, getVertexBackpressure(vertex.Name, backpressure))
+	}
+	observed.flinkBackpressure = backpressureList
+	log.Info("Observed Flink job backpressure", "vertices", backpressureList)
 }
 
 func (observer *ClusterStateObserver) observeCluster(
@@ -269,16 +1289,56 @@ func (observer *ClusterStateObserver) observeCluster(
 		observer.context, observer.request.NamespacedName, cluster)
 }
 
+// Observes the spec of the cluster as it is stored, which keeps the fields set
+// to zero values that override the template. It is nil without the API reader.
+func (observer *ClusterStateObserver) observeRawClusterSpec(
+	cluster *v1beta1.FlinkCluster) ([]byte, error) {
+	if observer.apiReader == nil {
+		return nil, nil
+	}
+	var rawSpec, err = v1beta1.GetRawClusterSpec(
+		observer.context, observer.apiReader, cluster.Namespace, cluster.Name)
+	if err != nil {
+		observer.log.Error(err, "Failed to get the raw cluster spec")
+		return nil, err
+	}
+	return rawSpec, nil
+}
+
+// Gets the template referenced by the cluster, returns nil if it doesn't
+// exist.
+func (observer *ClusterStateObserver) observeClusterTemplate(
+	cluster *v1beta1.FlinkCluster) (*v1beta1.FlinkClusterTemplate, error) {
+	var log = observer.log
+	var template = new(v1beta1.FlinkClusterTemplate)
+	var err = observer.k8sClient.Get(
+		observer.context,
+		types.NamespacedName{
+			Namespace: cluster.Namespace,
+			Name:      cluster.Spec.TemplateRef.Name,
+		},
+		template)
+	if err != nil {
+		if client.IgnoreNotFound(err) != nil {
+			log.Error(err, "Failed to get cluster template")
+			return nil, err
+		}
+		log.Info("Observed cluster template", "state", "nil")
+		return nil, nil
+	}
+	log.Info("Observed cluster template", "name", template.Name)
+	return template, nil
+}
+
 func (observer *ClusterStateObserver) observeConfigMap(
 	observedConfigMap *corev1.ConfigMap) error {
 	var clusterNamespace = observer.request.Namespace
-	var clusterName = observer.request.Name
 
 	return observer.k8sClient.Get(
 		observer.context,
 		types.NamespacedName{
 			Namespace: clusterNamespace,
-			Name:      getConfigMapName(clusterName),
+			Name:      observer.namer.ConfigMapName(),
 		},
 		observedConfigMap)
 }
@@ -286,8 +1346,7 @@ func (observer *ClusterStateObserver) observeConfigMap(
 func (observer *ClusterStateObserver) observeJobManagerDeployment(
 	observedDeployment *appsv1.Deployment) error {
 	var clusterNamespace = observer.request.Namespace
-	var clusterName = observer.request.Name
-	var jmDeploymentName = getJobManagerDeploymentName(clusterName)
+	var jmDeploymentName = observer.namer.JobManagerDeploymentName()
 	return observer.observeDeployment(
 		clusterNamespace, jmDeploymentName, "JobManager", observedDeployment)
 }
@@ -295,12 +1354,218 @@ func (observer *ClusterStateObserver) observeJobManagerDeployment(
 func (observer *ClusterStateObserver) observeTaskManagerDeployment(
 	observedDeployment *appsv1.Deployment) error {
 	var clusterNamespace = observer.request.Namespace
-	var clusterName = observer.request.Name
-	var tmDeploymentName = getTaskManagerDeploymentName(clusterName)
+	var tmDeploymentName = observer.namer.TaskManagerDeploymentName()
 	return observer.observeDeployment(
 		clusterNamespace, tmDeploymentName, "TaskManager", observedDeployment)
 }
 
+func (observer *ClusterStateObserver) observeTaskManagerStatefulSet(
+	observedStatefulSet *appsv1.StatefulSet) error {
+	var clusterNamespace = observer.request.Namespace
+	return observer.k8sClient.Get(
+		observer.context,
+		types.NamespacedName{
+			Namespace: clusterNamespace,
+			Name:      observer.namer.TaskManagerStatefulSetName(),
+		},
+		observedStatefulSet)
+}
+
+// Observes the resource quotas and limit ranges of the namespace, which are
+// checked before creating the cluster.
+func (observer *ClusterStateObserver) observeResourceQuotas(
+	observed *ObservedClusterState) error {
+	var log = observer.log
+	var clusterNamespace = observer.request.Namespace
+
+	var quotas = new(corev1.ResourceQuotaList)
+	var err = observer.k8sClient.List(
+		observer.context, quotas, client.InNamespace(clusterNamespace))
+	if err != nil {
+		log.Error(err, "Failed to list resource quotas")
+		return err
+	}
+	observed.resourceQuotas = quotas.Items
+
+	var limitRanges = new(corev1.LimitRangeList)
+	err = observer.k8sClient.List(
+		observer.context, limitRanges, client.InNamespace(clusterNamespace))
+	if err != nil {
+		log.Error(err, "Failed to list limit ranges")
+		return err
+	}
+	observed.limitRanges = limitRanges.Items
+
+	log.Info(
+		"Observed resource quotas",
+		"quotas", len(observed.resourceQuotas),
+		"limitRanges", len(observed.limitRanges))
+	return nil
+}
+
+// Observes the pods of the JobManager deployment.
+func (observer *ClusterStateObserver) observeJobManagerPods(
+	observed *ObservedClusterState) error {
+	var log = observer.log
+	var clusterNamespace = observer.request.Namespace
+	var clusterName = observer.request.Name
+
+	var labels = map[string]string{
+		"cluster":   clusterName,
+		"app":       "flink",
+		"component": "jobmanager",
+	}
+	if isNativeMode(observed.cluster) {
+		labels = getNativePodLabels(observer.namer, "jobmanager")
+	}
+	var pods = new(corev1.PodList)
+	var err = observer.k8sClient.List(
+		observer.context,
+		pods,
+		client.InNamespace(clusterNamespace),
+		client.MatchingLabels(labels))
+	if err != nil {
+		log.Error(err, "Failed to list JobManager pods")
+		return err
+	}
+
+	observed.jmPods = pods.Items
+	log.Info("Observed JobManager pods", "pods", len(observed.jmPods))
+	return nil
+}
+
+// Observes the address of the JobManager leader elected by Flink Kubernetes
+// high availability in the leader ConfigMaps. Flink 1.15 and later record the
+// leaders of all the components in a single ConfigMap, the earlier versions
+// in one ConfigMap per component. The address is empty until a leader is
+// elected.
+func (observer *ClusterStateObserver) observeJobManagerLeader(
+	observed *ObservedClusterState) error {
+	var log = observer.log
+
+	if observed.cluster == nil ||
+		!v1beta1.IsKubernetesHAEnabled(observed.cluster.Spec.FlinkProperties) {
+		return nil
+	}
+
+	var configMap = new(corev1.ConfigMap)
+	var err = observer.k8sClient.Get(
+		observer.context,
+		types.NamespacedName{
+			Namespace: observer.request.Namespace,
+			Name:      observer.namer.HAConfigMapName(),
+		},
+		configMap)
+	if err == nil {
+		// The value is "<session ID>,<address>".
+		var leader = configMap.Data[haRESTServerLeaderKey]
+		if i := strings.Index(leader, ","); i >= 0 {
+			observed.jmLeaderAddress = leader[i+1:]
+		}
+	} else if client.IgnoreNotFound(err) != nil {
+		log.Error(err, "Failed to get the high availability ConfigMap")
+		return err
+	} else {
+		err = observer.k8sClient.Get(
+			observer.context,
+			types.NamespacedName{
+				Namespace: observer.request.Namespace,
+				Name:      observer.namer.HARESTServerLeaderConfigMapName(),
+			},
+			configMap)
+		if err != nil {
+			if client.IgnoreNotFound(err) != nil {
+				log.Error(err, "Failed to get the REST server leader ConfigMap")
+				return err
+			}
+		} else {
+			observed.jmLeaderAddress = configMap.Data["address"]
+		}
+	}
+
+	log.Info("Observed JobManager leader", "address", observed.jmLeaderAddress)
+	return nil
+}
+
+// Observes the pods of the TaskManager deployment, excluding those of the
+// TaskManager pools.
+func (observer *ClusterStateObserver) observeTaskManagerPods(
+	observed *ObservedClusterState) error {
+	var log = observer.log
+	var clusterNamespace = observer.request.Namespace
+	var clusterName = observer.request.Name
+
+	var labels = map[string]string{
+		"cluster":   clusterName,
+		"app":       "flink",
+		"component": "taskmanager",
+	}
+	if isNativeMode(observed.cluster) {
+		labels = getNativePodLabels(observer.namer, "taskmanager")
+	}
+	var pods = new(corev1.PodList)
+	var err = observer.k8sClient.List(
+		observer.context,
+		pods,
+		client.InNamespace(clusterNamespace),
+		client.MatchingLabels(labels))
+	if err != nil {
+		log.Error(err, "Failed to list TaskManager pods")
+		return err
+	}
+
+	observed.tmPods = nil
+	for _, pod := range pods.Items {
+		if _, ok := pod.ObjectMeta.Labels["pool"]; ok {
+			continue
+		}
+		observed.tmPods = append(observed.tmPods, pod)
+	}
+	log.Info("Observed TaskManager pods", "pods", len(observed.tmPods))
+	return nil
+}
+
+// Observes the deployments of the TaskManager pools, including those of the
+// pools which have been removed from the spec, so that they can be deleted.
+// They are looked up among the deployments owned by the cluster through the
+// owner index of the cache.
+func (observer *ClusterStateObserver) observeTaskManagerPools(
+	observed *ObservedClusterState) error {
+	var log = observer.log
+	var clusterNamespace = observer.request.Namespace
+
+	if observed.cluster == nil {
+		return nil
+	}
+
+	var deployments = new(appsv1.DeploymentList)
+	var err = observer.k8sClient.List(
+		observer.context,
+		deployments,
+		client.InNamespace(clusterNamespace),
+		client.MatchingFields{
+			OwnerUIDIndexField: string(observed.cluster.UID),
+		})
+	if err != nil {
+		log.Error(err, "Failed to list TaskManager pool deployments")
+		return err
+	}
+
+	for i := range deployments.Items {
+		var deployment = &deployments.Items[i]
+		var poolName, ok = deployment.ObjectMeta.Labels["pool"]
+		if !ok || deployment.ObjectMeta.Labels["component"] != "taskmanager" {
+			continue
+		}
+		if observed.tmPools == nil {
+			observed.tmPools = map[string]*appsv1.Deployment{}
+		}
+		observed.tmPools[poolName] = deployment
+	}
+	log.Info("Observed TaskManager pool deployments", "pools", len(observed.tmPools))
+	return nil
+}
+
 func (observer *ClusterStateObserver) observeDeployment(
 	namespace string,
 	name string,
@@ -327,13 +1592,12 @@ func (observer *ClusterStateObserver) observeDeployment(
 func (observer *ClusterStateObserver) observeJobManagerService(
 	observedService *corev1.Service) error {
 	var clusterNamespace = observer.request.Namespace
-	var clusterName = observer.request.Name
 
 	return observer.k8sClient.Get(
 		observer.context,
 		types.NamespacedName{
 			Namespace: clusterNamespace,
-			Name:      getJobManagerServiceName(clusterName),
+			Name:      observer.namer.JobManagerServiceName(),
 		},
 		observedService)
 }
@@ -341,27 +1605,57 @@ func (observer *ClusterStateObserver) observeJobManagerService(
 func (observer *ClusterStateObserver) observeJobManagerIngress(
 	observedIngress *extensionsv1beta1.Ingress) error {
 	var clusterNamespace = observer.request.Namespace
-	var clusterName = observer.request.Name
 
 	return observer.k8sClient.Get(
 		observer.context,
 		types.NamespacedName{
 			Namespace: clusterNamespace,
-			Name:      getJobManagerIngressName(clusterName),
+			Name:      observer.namer.JobManagerIngressName(),
 		},
 		observedIngress)
 }
 
+// Observes the job of a cluster whose job spec has been removed, e.g., by an
+// update of its template, which is orphaned until the reconciler deletes it.
+func (observer *ClusterStateObserver) observeOrphanJob(
+	observed *ObservedClusterState) error {
+	var log = observer.log
+	var orphanJob = new(batchv1.Job)
+	var err = observer.observeJobResource(orphanJob)
+	if err != nil {
+		if client.IgnoreNotFound(err) != nil {
+			log.Error(err, "Failed to get job")
+			return err
+		}
+		return nil
+	}
+	log.Info("Observed orphaned job", "job", orphanJob.Name)
+	observed.orphans = append(observed.orphans, orphanJob)
+	return nil
+}
+
 func (observer *ClusterStateObserver) observeJobResource(
 	observedJob *batchv1.Job) error {
 	var clusterNamespace = observer.request.Namespace
-	var clusterName = observer.request.Name
 
 	return observer.k8sClient.Get(
 		observer.context,
 		types.NamespacedName{
 			Namespace: clusterNamespace,
-			Name:      getJobName(clusterName),
+			Name:      observer.namer.JobName(),
 		},
 		observedJob)
 }
+
+func (observer *ClusterStateObserver) observeVersionCluster(
+	version string, observedCluster *v1beta1.FlinkCluster) error {
+	var clusterNamespace = observer.request.Namespace
+
+	return observer.k8sClient.Get(
+		observer.context,
+		types.NamespacedName{
+			Namespace: clusterNamespace,
+			Name:      observer.namer.VersionClusterName(version),
+		},
+		observedCluster)
+}
@@ -0,0 +1,575 @@
+/*
+Copyright 2019 Google LLC.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	v1beta1 "github.com/googlecloudplatform/flink-operator/api/v1beta1"
+	"github.com/googlecloudplatform/flink-operator/controllers/flinkclient"
+	"gotest.tools/assert"
+	corev1 "k8s.io/api/core/v1"
+	schedulingv1 "k8s.io/api/scheduling/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/scheme"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+func newTestFlinkAPIServer(responses map[string]string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			var response, ok = responses[r.URL.Path]
+			if !ok {
+				http.NotFound(w, r)
+				return
+			}
+			fmt.Fprint(w, response)
+		}))
+}
+
+func newTestObserver() *ClusterStateObserver {
+	var logger = log.Log
+	return &ClusterStateObserver{
+		flinkClient: flinkclient.NewFlinkClient(logger, 0, 0),
+		log:         logger,
+	}
+}
+
+// A fake Flink client, the methods which are not overridden panic.
+type fakeFlinkClient struct {
+	flinkclient.FlinkClient
+	overview *flinkclient.ClusterOverview
+	jarID    string
+	jobID    string
+	runErr   error
+	runs     []flinkclient.JarRunRequest
+	uploaded map[string]string
+}
+
+func (c *fakeFlinkClient) GetClusterOverview(
+	apiBaseURL string) (flinkclient.ClusterOverview, error) {
+	if c.overview == nil {
+		return flinkclient.ClusterOverview{}, fmt.Errorf("connection refused")
+	}
+	return *c.overview, nil
+}
+
+func (c *fakeFlinkClient) GetJarID(
+	apiBaseURL string, jarName string) (string, error) {
+	return c.jarID, nil
+}
+
+func (c *fakeFlinkClient) UploadJar(
+	apiBaseURL string, jarName string, jar io.Reader) (string, error) {
+	var content, err = ioutil.ReadAll(jar)
+	if err != nil {
+		return "", err
+	}
+	if c.uploaded == nil {
+		c.uploaded = map[string]string{}
+	}
+	c.uploaded[jarName] = string(content)
+	c.jarID = "uploaded_" + jarName
+	return c.jarID, nil
+}
+
+func (c *fakeFlinkClient) RunJar(
+	apiBaseURL string, jarID string, request flinkclient.JarRunRequest) (
+	flinkclient.JarRunResponse, error) {
+	c.runs = append(c.runs, request)
+	if c.runErr != nil {
+		return flinkclient.JarRunResponse{}, c.runErr
+	}
+	if len(c.jobID) == 0 {
+		return flinkclient.JarRunResponse{JobID: request.JobID}, nil
+	}
+	return flinkclient.JarRunResponse{JobID: c.jobID}, nil
+}
+
+func TestObserveFlinkOverviewWithFakeClient(t *testing.T) {
+	var flinkClient = &fakeFlinkClient{
+		overview: &flinkclient.ClusterOverview{TaskManagers: 3, SlotsTotal: 6},
+	}
+	var observer = &ClusterStateObserver{flinkClient: flinkClient, log: log.Log}
+
+	var observed = ObservedClusterState{}
+	observer.observeFlinkOverview("http://jobmanager:8081", &observed)
+	assert.DeepEqual(t, observed.flinkOverview, flinkClient.overview)
+
+	flinkClient.overview = nil
+	observed = ObservedClusterState{}
+	observer.observeFlinkOverview("http://jobmanager:8081", &observed)
+	assert.Assert(t, observed.flinkOverview == nil)
+}
+
+func TestObserveJobManagerMetrics(t *testing.T) {
+	var server = newTestFlinkAPIServer(map[string]string{
+		"/jobmanager/metrics": `[
+			{"id": "Status.JVM.Memory.Heap.Used", "value": "100"},
+			{"id": "Status.JVM.Memory.Heap.Max", "value": "400"},
+			{"id": "Status.JVM.GarbageCollector.G1_Young_Generation.Count", "value": "3"},
+			{"id": "Status.JVM.GarbageCollector.G1_Young_Generation.Time", "value": "30"},
+			{"id": "Status.JVM.GarbageCollector.G1_Old_Generation.Count", "value": "1"},
+			{"id": "Status.JVM.GarbageCollector.G1_Old_Generation.Time", "value": "20"},
+			{"id": "Status.JVM.CPU.Load", "value": "0.1"}]`,
+	})
+	defer server.Close()
+
+	var observed = ObservedClusterState{}
+	newTestObserver().observeJobManagerMetrics(server.URL, &observed)
+
+	assert.Assert(t, observed.jmMetrics != nil)
+	assert.Assert(t, len(observed.jmMetrics.ObservedTime) > 0)
+	observed.jmMetrics.ObservedTime = ""
+	var expected = &v1beta1.JobManagerMetrics{
+		HeapUsed: 100, HeapMax: 400, GCCount: 4, GCTimeMillis: 50}
+	assert.DeepEqual(t, observed.jmMetrics, expected)
+}
+
+func TestObserveJobManagerMetricsMissing(t *testing.T) {
+	var server = newTestFlinkAPIServer(map[string]string{})
+	defer server.Close()
+
+	var observed = ObservedClusterState{}
+	newTestObserver().observeJobManagerMetrics(server.URL, &observed)
+	assert.Assert(t, observed.jmMetrics == nil)
+}
+
+func TestObserveFlinkJobMetrics(t *testing.T) {
+	var server = newTestFlinkAPIServer(map[string]string{
+		"/jobs/job1": `{"jid": "job1", "name": "wordcount", "state": "RUNNING",
+			"vertices": [
+				{"id": "v1", "name": "Source"},
+				{"id": "v2", "name": "Map"},
+				{"id": "v3", "name": "Sink"}]}`,
+		"/jobs/job1/vertices/v1/subtasks/metrics": `[
+			{"id": "numRecordsOutPerSecond", "sum": 120.5}]`,
+		"/jobs/job1/vertices/v3/subtasks/metrics": `[
+			{"id": "numRecordsInPerSecond", "sum": 100}]`,
+	})
+	defer server.Close()
+
+	var observed = ObservedClusterState{}
+	var details, err = newTestObserver().flinkClient.GetJobDetails(
+		server.URL, "job1")
+	assert.NilError(t, err)
+	newTestObserver().observeFlinkJobMetrics(server.URL, details, &observed)
+
+	assert.Assert(t, observed.flinkJobMetrics != nil)
+	assert.Assert(t, len(observed.flinkJobMetrics.ObservedTime) > 0)
+	observed.flinkJobMetrics.ObservedTime = ""
+	var expected = &v1beta1.JobMetrics{
+		RecordsPerSecondIn: 121, RecordsPerSecondOut: 100}
+	assert.DeepEqual(t, observed.flinkJobMetrics, expected)
+}
+
+func TestObserveFlinkBackpressure(t *testing.T) {
+	var server = newTestFlinkAPIServer(map[string]string{
+		"/jobs/job1": `{"jid": "job1", "name": "wordcount", "state": "RUNNING",
+			"vertices": [
+				{"id": "v1", "name": "Source"},
+				{"id": "v2", "name": "Map"},
+				{"id": "v3", "name": "Sink"}]}`,
+		"/jobs/job1/vertices/v1/backpressure": `{"status": "ok",
+			"backpressure-level": "high",
+			"subtasks": [
+				{"subtask": 0, "backpressure-level": "high", "ratio": 0.9},
+				{"subtask": 1, "backpressure-level": "low", "ratio": 0.3}]}`,
+		"/jobs/job1/vertices/v2/backpressure": `{"status": "ok",
+			"backpressure-level": "low",
+			"subtasks": [
+				{"subtask": 0, "backpressure-level": "low", "ratio": 0.2}]}`,
+		"/jobs/job1/vertices/v3/backpressure": `{"status": "ok",
+			"backpressure-level": "ok",
+			"subtasks": [
+				{"subtask": 0, "backpressure-level": "ok", "ratio": 0}]}`,
+	})
+	defer server.Close()
+
+	var observed = ObservedClusterState{}
+	var details, err = newTestObserver().flinkClient.GetJobDetails(
+		server.URL, "job1")
+	assert.NilError(t, err)
+	newTestObserver().observeFlinkBackpressure(server.URL, details, &observed)
+
+	var expected = []v1beta1.VertexBackpressure{
+		{VertexName: "Source", Ratio: 90, Level: v1beta1.BackpressureLevelHigh},
+		{VertexName: "Map", Ratio: 20, Level: v1beta1.BackpressureLevelLow},
+		{VertexName: "Sink", Ratio: 0, Level: v1beta1.BackpressureLevelOK},
+	}
+	assert.DeepEqual(t, observed.flinkBackpressure, expected)
+}
+
+func TestObserveFlinkBackpressureFailed(t *testing.T) {
+	var server = newTestFlinkAPIServer(map[string]string{
+		"/jobs/job1": `{"jid": "job1", "name": "wordcount", "state": "RUNNING",
+			"vertices": [
+				{"id": "v1", "name": "Source"},
+				{"id": "v2", "name": "Sink"}]}`,
+		"/jobs/job1/vertices/v1/backpressure": `{"status": "ok",
+			"backpressure-level": "ok",
+			"subtasks": [
+				{"subtask": 0, "backpressure-level": "ok", "ratio": 0.01}]}`,
+	})
+	defer server.Close()
+
+	var observed = ObservedClusterState{}
+	var details, err = newTestObserver().flinkClient.GetJobDetails(
+		server.URL, "job1")
+	assert.NilError(t, err)
+	newTestObserver().observeFlinkBackpressure(server.URL, details, &observed)
+
+	assert.Assert(t, observed.flinkBackpressure == nil)
+}
+
+func TestObserveFlinkBackpressureInProgress(t *testing.T) {
+	var server = newTestFlinkAPIServer(map[string]string{
+		"/jobs/job1": `{"jid": "job1", "name": "wordcount", "state": "RUNNING",
+			"vertices": [
+				{"id": "v1", "name": "Source"},
+				{"id": "v2", "name": "Sink"}]}`,
+		"/jobs/job1/vertices/v1/backpressure": `{"status": "ok",
+			"backpressure-level": "ok",
+			"subtasks": [
+				{"subtask": 0, "backpressure-level": "ok", "ratio": 0.01}]}`,
+		"/jobs/job1/vertices/v2/backpressure": `{"status": "deprecated"}`,
+	})
+	defer server.Close()
+
+	var observed = ObservedClusterState{}
+	var details, err = newTestObserver().flinkClient.GetJobDetails(
+		server.URL, "job1")
+	assert.NilError(t, err)
+	newTestObserver().observeFlinkBackpressure(server.URL, details, &observed)
+
+	assert.Assert(t, observed.flinkBackpressure == nil)
+}
+
+func TestObserveFlinkOverview(t *testing.T) {
+	var server = newTestFlinkAPIServer(map[string]string{
+		"/overview": `{"taskmanagers": 2, "slots-total": 4,
+			"slots-available": 1, "jobs-running": 1, "jobs-finished": 3,
+			"jobs-cancelled": 1, "jobs-failed": 2,
+			"flink-version": "1.9.1"}`,
+	})
+	defer server.Close()
+
+	var observed = ObservedClusterState{}
+	newTestObserver().observeFlinkOverview(server.URL, &observed)
+
+	var expected = flinkclient.ClusterOverview{
+		TaskManagers:   2,
+		SlotsTotal:     4,
+		SlotsAvailable: 1,
+		JobsRunning:    1,
+		JobsFinished:   3,
+		JobsCancelled:  1,
+		JobsFailed:     2,
+	}
+	assert.DeepEqual(t, observed.flinkOverview, &expected)
+}
+
+func TestObserveFlinkOverviewFailed(t *testing.T) {
+	var server = newTestFlinkAPIServer(map[string]string{})
+	defer server.Close()
+
+	var observed = ObservedClusterState{}
+	newTestObserver().observeFlinkOverview(server.URL, &observed)
+
+	assert.Assert(t, observed.flinkOverview == nil)
+}
+
+func TestObserveFlinkCheckpoints(t *testing.T) {
+	var server = newTestFlinkAPIServer(map[string]string{
+		"/jobs/job1/checkpoints": `{
+			"counts": {"restored": 0, "total": 3, "in_progress": 0,
+				"completed": 2, "failed": 1},
+			"latest": {
+				"completed": {"id": 2, "status": "COMPLETED",
+					"is_savepoint": false, "trigger_timestamp": 1577934240000,
+					"latest_ack_timestamp": 1577934245000},
+				"failed": null},
+			"history": [
+				{"id": 3, "status": "FAILED", "is_savepoint": false,
+					"trigger_timestamp": 1577934300000,
+					"latest_ack_timestamp": -1},
+				{"id": 2, "status": "COMPLETED", "is_savepoint": false,
+					"trigger_timestamp": 1577934240000,
+					"latest_ack_timestamp": 1577934245000}]}`,
+	})
+	defer server.Close()
+
+	var observed = ObservedClusterState{}
+	newTestObserver().observeFlinkCheckpoints(server.URL, "job1", &observed)
+
+	assert.Assert(t, observed.flinkCheckpoints != nil)
+	assert.DeepEqual(
+		t,
+		observed.flinkCheckpoints.Counts,
+		flinkclient.CheckpointCounts{Completed: 2, Failed: 1})
+	assert.Equal(
+		t,
+		observed.flinkCheckpoints.Latest.Completed.LatestAckTimestamp,
+		int64(1577934245000))
+	assert.Equal(t, len(observed.flinkCheckpoints.History), 2)
+	assert.Equal(t, observed.flinkCheckpoints.History[0].Status, "FAILED")
+
+	// The JobManager is unreachable.
+	observed = ObservedClusterState{}
+	newTestObserver().observeFlinkCheckpoints(server.URL, "job2", &observed)
+	assert.Assert(t, observed.flinkCheckpoints == nil)
+}
+
+func TestObserveTaskManagerPods(t *testing.T) {
+	var newPod = func(name string, labels map[string]string) *corev1.Pod {
+		return &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      name,
+				Namespace: "default",
+				Labels:    labels,
+			},
+		}
+	}
+	var tmLabels = map[string]string{
+		"cluster": "mycluster", "app": "flink", "component": "taskmanager"}
+	var poolLabels = map[string]string{
+		"cluster":   "mycluster",
+		"app":       "flink",
+		"component": "taskmanager",
+		"pool":      "highmem",
+	}
+	var jmLabels = map[string]string{
+		"cluster": "mycluster", "app": "flink", "component": "jobmanager"}
+	var observer = newTestObserver()
+	observer.k8sClient = fake.NewFakeClientWithScheme(
+		scheme.Scheme,
+		newPod("mycluster-taskmanager-1", tmLabels),
+		newPod("mycluster-taskmanager-highmem-1", poolLabels),
+		newPod("mycluster-jobmanager-1", jmLabels))
+	observer.request = ctrl.Request{
+		NamespacedName: types.NamespacedName{
+			Namespace: "default", Name: "mycluster"}}
+	observer.context = context.Background()
+
+	var observed = &ObservedClusterState{}
+	var err = observer.observeTaskManagerPods(observed)
+	assert.NilError(t, err)
+	assert.Equal(t, len(observed.tmPods), 1)
+	assert.Equal(t, observed.tmPods[0].Name, "mycluster-taskmanager-1")
+}
+
+func TestObserveJobManagerLeader(t *testing.T) {
+	var cluster = &v1beta1.FlinkCluster{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "mycluster"},
+		Spec: v1beta1.FlinkClusterSpec{
+			FlinkProperties: map[string]string{
+				"high-availability": "kubernetes",
+			},
+		},
+	}
+	var haConfigMap = &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: "default", Name: "mycluster-cluster-config-map"},
+		Data: map[string]string{
+			haRESTServerLeaderKey: "6e2a0f3c-0c3a-4a1e-9b8e-3f6f1b2c1d00,http://10.8.0.5:8081",
+		},
+	}
+	var restServerLeaderConfigMap = &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: "default", Name: "mycluster-restserver-leader"},
+		Data: map[string]string{
+			"address":   "http://10.8.0.6:8081",
+			"sessionId": "6e2a0f3c-0c3a-4a1e-9b8e-3f6f1b2c1d00",
+		},
+	}
+	var observe = func(objects ...runtime.Object) *ObservedClusterState {
+		var observer = newTestObserver()
+		observer.k8sClient = fake.NewFakeClientWithScheme(
+			scheme.Scheme, objects...)
+		observer.request = ctrl.Request{
+			NamespacedName: types.NamespacedName{
+				Namespace: "default", Name: "mycluster"}}
+		observer.context = context.Background()
+		observer.namer = NewResourceNamer(cluster)
+		var observed = &ObservedClusterState{cluster: cluster}
+		assert.NilError(t, observer.observeJobManagerLeader(observed))
+		return observed
+	}
+
+	// Flink 1.15 and later.
+	assert.Equal(t, observe(haConfigMap).jmLeaderAddress, "http://10.8.0.5:8081")
+
+	// Flink 1.12 to 1.14.
+	assert.Equal(
+		t,
+		observe(restServerLeaderConfigMap).jmLeaderAddress,
+		"http://10.8.0.6:8081")
+
+	// No leader is elected yet.
+	assert.Equal(t, observe().jmLeaderAddress, "")
+
+	// Without Kubernetes high availability.
+	cluster.Spec.FlinkProperties = nil
+	assert.Equal(t, observe(haConfigMap).jmLeaderAddress, "")
+}
+
+func TestObserveClusterTemplate(t *testing.T) {
+	var template = &v1beta1.FlinkClusterTemplate{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "base"},
+		Spec: v1beta1.FlinkClusterSpec{
+			Image: v1beta1.ImageSpec{Name: "flink:1.9.1"},
+		},
+	}
+	var testScheme = runtime.NewScheme()
+	assert.NilError(t, v1beta1.AddToScheme(testScheme))
+	var observer = newTestObserver()
+	observer.k8sClient = fake.NewFakeClientWithScheme(testScheme, template)
+	observer.context = context.Background()
+	var cluster = &v1beta1.FlinkCluster{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "mycluster"},
+		Spec: v1beta1.FlinkClusterSpec{
+			TemplateRef: &corev1.LocalObjectReference{Name: "base"},
+		},
+	}
+
+	var observed, err = observer.observeClusterTemplate(cluster)
+	assert.NilError(t, err)
+	assert.Assert(t, observed != nil)
+	assert.Equal(t, observed.Spec.Image.Name, "flink:1.9.1")
+
+	cluster.Spec.TemplateRef.Name = "other"
+	observed, err = observer.observeClusterTemplate(cluster)
+	assert.NilError(t, err)
+	assert.Assert(t, observed == nil)
+}
+
+func TestObserveFlinkTLS(t *testing.T) {
+	var server = httptest.NewTLSServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprint(w, `{"taskmanagers": 2}`)
+		}))
+	defer server.Close()
+	var secret = &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "flink-tls"},
+		Data: map[string][]byte{
+			"ca.crt": pem.EncodeToMemory(&pem.Block{
+				Type: "CERTIFICATE", Bytes: server.Certificate().Raw}),
+		},
+	}
+	var invalidSecret = &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "invalid-tls"},
+		Data:       map[string][]byte{"tls.crt": []byte("not a certificate")},
+	}
+	var newObserver = func() *ClusterStateObserver {
+		var observer = newTestObserver()
+		observer.apiReader = fake.NewFakeClientWithScheme(
+			scheme.Scheme, secret, invalidSecret)
+		observer.request = ctrl.Request{
+			NamespacedName: types.NamespacedName{
+				Namespace: "default", Name: "mycluster"}}
+		observer.context = context.Background()
+		return observer
+	}
+	var newObserved = func(secretName string) *ObservedClusterState {
+		return &ObservedClusterState{
+			cluster: &v1beta1.FlinkCluster{
+				Spec: v1beta1.FlinkClusterSpec{
+					Security: &v1beta1.SecuritySpec{
+						RESTTLS: &v1beta1.RESTTLSSpec{SecretName: secretName},
+					},
+				},
+			},
+		}
+	}
+
+	// The Flink client verifies the server with the CA bundle of the secret.
+	var observer = newObserver()
+	var observed = newObserved("flink-tls")
+	var err = observer.observeFlinkTLS(observed)
+	assert.NilError(t, err)
+	assert.Equal(t, observed.flinkTLSError, "")
+	observer.observeFlinkOverview(server.URL, observed)
+	assert.Assert(t, observed.flinkOverview != nil)
+	assert.Equal(t, observed.flinkOverview.TaskManagers, int32(2))
+
+	// Misconfigurations are reported with the reason.
+	observer = newObserver()
+	observed = newObserved("other-tls")
+	err = observer.observeFlinkTLS(observed)
+	assert.NilError(t, err)
+	assert.Equal(
+		t, observed.flinkTLSError, "secret other-tls does not exist")
+
+	observed = newObserved("invalid-tls")
+	err = observer.observeFlinkTLS(observed)
+	assert.NilError(t, err)
+	assert.Equal(
+		t,
+		observed.flinkTLSError,
+		"secret invalid-tls: CA bundle is unspecified")
+}
+
+func TestObservePriorityClasses(t *testing.T) {
+	var priorityClass = &schedulingv1.PriorityClass{
+		ObjectMeta: metav1.ObjectMeta{Name: "high-priority"},
+		Value:      1000000,
+	}
+	var observer = newTestObserver()
+	observer.apiReader = fake.NewFakeClientWithScheme(
+		scheme.Scheme, priorityClass)
+	observer.context = context.Background()
+	var cluster = getTestSessionCluster()
+	cluster.Spec.JobManager.PriorityClassName = "high-priority"
+	cluster.Spec.TaskManager.PriorityClassName = "medium-priority"
+	var observed = &ObservedClusterState{cluster: cluster}
+
+	var err = observer.observePriorityClasses(observed)
+	assert.NilError(t, err)
+	assert.DeepEqual(t, observed.missingPriorityClasses, []string{"medium-priority"})
+
+	// The priority classes which are not allowed to be read are not missing.
+	observer.apiReader = forbiddenReader{}
+	observed = &ObservedClusterState{cluster: cluster}
+	err = observer.observePriorityClasses(observed)
+	assert.NilError(t, err)
+	assert.Equal(t, len(observed.missingPriorityClasses), 0)
+}
+
+// Denies all the reads.
+type forbiddenReader struct {
+	client.Reader
+}
+
+func (forbiddenReader) Get(
+	ctx context.Context, key client.ObjectKey, obj runtime.Object) error {
+	return errors.NewForbidden(
+		schema.GroupResource{Resource: "priorityclasses"}, key.Name, nil)
+}
@@ -0,0 +1,178 @@
+/*
+Copyright 2019 Google LLC.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+// Preflight check of the resource quotas of the namespace. Without it, the
+// pods of a cluster exceeding the quota are rejected by the ReplicaSet
+// controller, which is only visible in the events of the ReplicaSets.
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// The compute resources of resource quotas, "cpu" and "memory" are the same as
+// "requests.cpu" and "requests.memory".
+var quotaResourceNames = []corev1.ResourceName{
+	corev1.ResourceCPU,
+	corev1.ResourceMemory,
+	corev1.ResourceRequestsCPU,
+	corev1.ResourceRequestsMemory,
+	corev1.ResourceLimitsCPU,
+	corev1.ResourceLimitsMemory,
+}
+
+// Gets the total compute resources of the pods of the deployments, in the
+// resource names of resource quotas.
+func getDeploymentsQuotaUsage(
+	deployments []*appsv1.Deployment,
+	limitRanges []corev1.LimitRange) corev1.ResourceList {
+	var usage = corev1.ResourceList{}
+	for _, deployment := range deployments {
+		if deployment == nil {
+			continue
+		}
+		var replicas int32 = 1
+		if deployment.Spec.Replicas != nil {
+			replicas = *deployment.Spec.Replicas
+		}
+		var podUsage = getPodQuotaUsage(
+			&deployment.Spec.Template.Spec, limitRanges)
+		for name, quantity := range podUsage {
+			var total = usage[name]
+			for i := int32(0); i < replicas; i++ {
+				total.Add(quantity)
+			}
+			usage[name] = total
+		}
+	}
+	return usage
+}
+
+// Gets the compute resources of a pod, in the resource names of resource
+// quotas. The init containers run one at a time before the containers, so the
+// pod uses the larger of the largest init container and the sum of the
+// containers, as the quota admission does. The defaults of the limit ranges
+// are applied to the containers without requests or limits, as the LimitRanger
+// admission controller does.
+func getPodQuotaUsage(
+	podSpec *corev1.PodSpec,
+	limitRanges []corev1.LimitRange) corev1.ResourceList {
+	var getUsage = func(container corev1.Container) corev1.ResourceList {
+		var usage = corev1.ResourceList{}
+		var requests, limits = getContainerResources(container, limitRanges)
+		for _, name := range []corev1.ResourceName{
+			corev1.ResourceCPU, corev1.ResourceMemory} {
+			if quantity, ok := requests[name]; ok {
+				usage[name] = quantity
+				usage[corev1.ResourceName("requests."+name)] = quantity
+			}
+			if quantity, ok := limits[name]; ok {
+				usage[corev1.ResourceName("limits."+name)] = quantity
+			}
+		}
+		return usage
+	}
+	var usage = corev1.ResourceList{}
+	for _, container := range podSpec.Containers {
+		for name, quantity := range getUsage(container) {
+			var total = usage[name]
+			total.Add(quantity)
+			usage[name] = total
+		}
+	}
+	for _, container := range podSpec.InitContainers {
+		for name, quantity := range getUsage(container) {
+			if total, ok := usage[name]; !ok || quantity.Cmp(total) > 0 {
+				usage[name] = quantity
+			}
+		}
+	}
+	return usage
+}
+
+// Gets the requests and limits of the container with the defaults of the
+// limit ranges. A request without default falls back to the limit.
+func getContainerResources(
+	container corev1.Container,
+	limitRanges []corev1.LimitRange) (corev1.ResourceList, corev1.ResourceList) {
+	var requests = corev1.ResourceList{}
+	var limits = corev1.ResourceList{}
+	for name, quantity := range container.Resources.Requests {
+		requests[name] = quantity
+	}
+	for name, quantity := range container.Resources.Limits {
+		limits[name] = quantity
+	}
+	for _, limitRange := range limitRanges {
+		for _, item := range limitRange.Spec.Limits {
+			if item.Type != corev1.LimitTypeContainer {
+				continue
+			}
+			for name, quantity := range item.Default {
+				if _, ok := limits[name]; !ok {
+					limits[name] = quantity
+				}
+			}
+			for name, quantity := range item.DefaultRequest {
+				if _, ok := requests[name]; !ok {
+					requests[name] = quantity
+				}
+			}
+		}
+	}
+	for name, quantity := range limits {
+		if _, ok := requests[name]; !ok {
+			requests[name] = quantity
+		}
+	}
+	return requests, limits
+}
+
+// Gets the message describing how the usage exceeds the available resources
+// of the quotas, empty if it does not exceed any of them.
+func getQuotaExceededMessage(
+	quotas []corev1.ResourceQuota, usage corev1.ResourceList) string {
+	var messages []string
+	for _, quota := range quotas {
+		for _, name := range quotaResourceNames {
+			var hard, ok = quota.Status.Hard[name]
+			if !ok {
+				continue
+			}
+			var required, requiredOk = usage[name]
+			if !requiredOk {
+				continue
+			}
+			var available = hard.DeepCopy()
+			if used, ok := quota.Status.Used[name]; ok {
+				available.Sub(used)
+			}
+			if required.Cmp(available) > 0 {
+				messages = append(messages, fmt.Sprintf(
+					"%v %v exceeds the available %v of ResourceQuota %v",
+					name, required.String(), available.String(), quota.Name))
+			}
+		}
+	}
+	sort.Strings(messages)
+	return strings.Join(messages, "; ")
+}
@@ -0,0 +1,252 @@
+/*
+Copyright 2019 Google LLC.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	v1beta1 "github.com/googlecloudplatform/flink-operator/api/v1beta1"
+	"gotest.tools/assert"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+func getTestQuota(hard string, used string) corev1.ResourceQuota {
+	return corev1.ResourceQuota{
+		ObjectMeta: metav1.ObjectMeta{Name: "compute-quota"},
+		Status: corev1.ResourceQuotaStatus{
+			Hard: corev1.ResourceList{
+				corev1.ResourceRequestsCPU: resource.MustParse(hard),
+			},
+			Used: corev1.ResourceList{
+				corev1.ResourceRequestsCPU: resource.MustParse(used),
+			},
+		},
+	}
+}
+
+func TestGetDeploymentsQuotaUsage(t *testing.T) {
+	var replicas int32 = 2
+	var deployment = &appsv1.Deployment{
+		Spec: appsv1.DeploymentSpec{
+			Replicas: &replicas,
+			Template: corev1.PodTemplateSpec{
+				Spec: corev1.PodSpec{
+					Containers: []corev1.Container{
+						{
+							Name: "taskmanager",
+							Resources: corev1.ResourceRequirements{
+								Requests: corev1.ResourceList{
+									corev1.ResourceCPU:    resource.MustParse("1"),
+									corev1.ResourceMemory: resource.MustParse("1Gi"),
+								},
+								Limits: corev1.ResourceList{
+									corev1.ResourceMemory: resource.MustParse("2Gi"),
+								},
+							},
+						},
+						// Defaults from the limit range.
+						{Name: "sidecar"},
+					},
+				},
+			},
+		},
+	}
+	var limitRanges = []corev1.LimitRange{
+		{
+			Spec: corev1.LimitRangeSpec{
+				Limits: []corev1.LimitRangeItem{
+					{
+						Type: corev1.LimitTypeContainer,
+						Default: corev1.ResourceList{
+							corev1.ResourceCPU: resource.MustParse("500m"),
+						},
+						DefaultRequest: corev1.ResourceList{
+							corev1.ResourceMemory: resource.MustParse("128Mi"),
+						},
+					},
+				},
+			},
+		},
+	}
+
+	var usage = getDeploymentsQuotaUsage(
+		[]*appsv1.Deployment{deployment, nil}, limitRanges)
+
+	var expectQuantity = func(name corev1.ResourceName, expected string) {
+		var quantity = usage[name]
+		assert.Equal(t, quantity.Cmp(resource.MustParse(expected)), 0,
+			"%v: %v != %v", name, quantity.String(), expected)
+	}
+	// The request of the sidecar falls back to the default limit.
+	expectQuantity(corev1.ResourceRequestsCPU, "3")
+	expectQuantity(corev1.ResourceCPU, "3")
+	expectQuantity(corev1.ResourceLimitsCPU, "2")
+	expectQuantity(corev1.ResourceRequestsMemory, "2304Mi")
+	expectQuantity(corev1.ResourceLimitsMemory, "4Gi")
+}
+
+func TestGetDeploymentsQuotaUsageWithInitContainers(t *testing.T) {
+	var newContainer = func(name string, cpu string) corev1.Container {
+		return corev1.Container{
+			Name: name,
+			Resources: corev1.ResourceRequirements{
+				Requests: corev1.ResourceList{
+					corev1.ResourceCPU: resource.MustParse(cpu),
+				},
+			},
+		}
+	}
+	var deployment = &appsv1.Deployment{
+		Spec: appsv1.DeploymentSpec{
+			Template: corev1.PodTemplateSpec{
+				Spec: corev1.PodSpec{
+					InitContainers: []corev1.Container{
+						newContainer("download", "2"),
+						newContainer("setup", "500m"),
+					},
+					Containers: []corev1.Container{
+						newContainer("jobmanager", "1"),
+						newContainer("sidecar", "500m"),
+					},
+				},
+			},
+		},
+	}
+
+	// The largest init container is larger than the containers.
+	var usage = getDeploymentsQuotaUsage(
+		[]*appsv1.Deployment{deployment}, nil)
+	var quantity = usage[corev1.ResourceRequestsCPU]
+	assert.Equal(t, quantity.String(), "2")
+
+	// The containers are larger than any init container.
+	deployment.Spec.Template.Spec.InitContainers[0] =
+		newContainer("download", "1")
+	usage = getDeploymentsQuotaUsage([]*appsv1.Deployment{deployment}, nil)
+	quantity = usage[corev1.ResourceRequestsCPU]
+	assert.Equal(t, quantity.String(), "1500m")
+}
+
+func TestGetQuotaExceededMessage(t *testing.T) {
+	var usage = corev1.ResourceList{
+		corev1.ResourceRequestsCPU: resource.MustParse("3"),
+	}
+
+	var quotas = []corev1.ResourceQuota{getTestQuota("4", "2")}
+	assert.Equal(
+		t,
+		getQuotaExceededMessage(quotas, usage),
+		"requests.cpu 3 exceeds the available 2 of ResourceQuota compute-quota")
+
+	quotas = []corev1.ResourceQuota{getTestQuota("8", "2")}
+	assert.Equal(t, getQuotaExceededMessage(quotas, usage), "")
+
+	// Resources not in the usage are not limited.
+	assert.Equal(t, getQuotaExceededMessage(quotas, corev1.ResourceList{}), "")
+}
+
+func TestCheckResourceQuota(t *testing.T) {
+	var cluster = getTestSessionCluster()
+	cluster.Spec.JobManager.Resources.Requests = corev1.ResourceList{
+		corev1.ResourceCPU: resource.MustParse("1"),
+	}
+	cluster.Spec.TaskManager.Resources.Requests = corev1.ResourceList{
+		corev1.ResourceCPU: resource.MustParse("2"),
+	}
+	var testScheme = runtime.NewScheme()
+	assert.NilError(t, scheme.AddToScheme(testScheme))
+	assert.NilError(t, v1beta1.AddToScheme(testScheme))
+	var k8sClient = fake.NewFakeClientWithScheme(testScheme, cluster)
+	var recorder = record.NewFakeRecorder(10)
+	var reconciler = ClusterReconciler{
+		k8sClient: k8sClient,
+		context:   context.Background(),
+		log:       log.Log,
+		recorder:  recorder,
+		observed: ObservedClusterState{
+			cluster:        cluster,
+			resourceQuotas: []corev1.ResourceQuota{getTestQuota("4", "0")},
+		},
+		desired: getDesiredClusterState(cluster, time.Now()),
+	}
+	var getCluster = func() *v1beta1.FlinkCluster {
+		var updated = &v1beta1.FlinkCluster{}
+		var err = k8sClient.Get(
+			context.Background(),
+			types.NamespacedName{Namespace: cluster.Namespace, Name: cluster.Name},
+			updated)
+		assert.NilError(t, err)
+		return updated
+	}
+
+	// 1 JobManager and 2 TaskManagers request 5 CPUs.
+	var exceeded, err = reconciler.checkResourceQuota()
+	assert.NilError(t, err)
+	assert.Assert(t, exceeded)
+	var condition = getCondition(
+		getCluster().Status.Conditions, v1beta1.ClusterConditionQuotaExceeded)
+	assert.Assert(t, condition != nil)
+	assert.Equal(t, condition.Status, corev1.ConditionTrue)
+	assert.Equal(
+		t,
+		condition.Message,
+		"requests.cpu 5 exceeds the available 4 of ResourceQuota compute-quota")
+	assert.Equal(
+		t,
+		<-recorder.Events,
+		"Warning QuotaExceeded "+
+			"requests.cpu 5 exceeds the available 4 of ResourceQuota compute-quota")
+
+	// The reconcile does not create any resources.
+	reconciler.quotaRequeueInterval = 30 * time.Second
+	result, err := reconciler.reconcile()
+	assert.NilError(t, err)
+	assert.Equal(t, result.RequeueAfter, 30*time.Second)
+	var deployments = &appsv1.DeploymentList{}
+	assert.NilError(t, k8sClient.List(context.Background(), deployments))
+	assert.Equal(t, len(deployments.Items), 0)
+
+	// The quota is raised.
+	reconciler.observed.cluster = getCluster()
+	reconciler.observed.resourceQuotas =
+		[]corev1.ResourceQuota{getTestQuota("8", "0")}
+	exceeded, err = reconciler.checkResourceQuota()
+	assert.NilError(t, err)
+	assert.Assert(t, !exceeded)
+	condition = getCondition(
+		getCluster().Status.Conditions, v1beta1.ClusterConditionQuotaExceeded)
+	assert.Equal(t, condition.Status, corev1.ConditionFalse)
+
+	// No check after the deployments are created.
+	reconciler.observed.resourceQuotas =
+		[]corev1.ResourceQuota{getTestQuota("1", "1")}
+	reconciler.observed.jmDeployment = reconciler.desired.JmDeployment
+	exceeded, err = reconciler.checkResourceQuota()
+	assert.NilError(t, err)
+	assert.Assert(t, !exceeded)
+}
@@ -19,6 +19,10 @@ package controllers
 import (
 	"context"
 	"fmt"
+	"net/http"
+	"path"
+	"reflect"
+	"strings"
 	"time"
 
 	"github.com/go-logr/logr"
@@ -28,6 +32,10 @@ import (
 	batchv1 "k8s.io/api/batch/v1"
 	corev1 "k8s.io/api/core/v1"
 	extensionsv1beta1 "k8s.io/api/extensions/v1beta1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/record"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 )
@@ -39,12 +47,21 @@ type ClusterReconciler struct {
 	flinkClient flinkclient.FlinkClient
 	context     context.Context
 	log         logr.Logger
+	recorder    record.EventRecorder
 	observed    ObservedClusterState
 	desired     DesiredClusterState
+	// Sends the webhook notifications of the success hooks.
+	webhookSender webhookSender
+	// Requeue interval while the cluster exceeds the resource quota.
+	quotaRequeueInterval time.Duration
 }
 
 var requeueResult = ctrl.Result{RequeueAfter: 10 * time.Second, Requeue: true}
 
+// The timeout of downloading the JAR file of a job submitted through the REST
+// API from its `jarURI`.
+const jarDownloadTimeout = 5 * time.Minute
+
 // Compares the desired state and the observed state, if there is a difference,
 // takes actions to drive the observed state towards the desired state.
 func (reconciler *ClusterReconciler) reconcile() (ctrl.Result, error) {
@@ -56,6 +73,84 @@ func (reconciler *ClusterReconciler) reconcile() (ctrl.Result, error) {
 		return ctrl.Result{}, nil
 	}
 
+	// No resources are reconciled until the spec is fixed, except for the
+	// requests to stop the job or the cluster.
+	specValid, err := reconciler.checkSpecValid()
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	if !specValid {
+		return reconciler.reconcileStopRequests()
+	}
+
+	// No resources are reconciled until the immutable fields are reverted,
+	// except for the requests to stop the job or the cluster.
+	specImmutable, err := reconciler.checkSpecImmutable()
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	if !specImmutable {
+		return reconciler.reconcileStopRequests()
+	}
+
+	// No resources are created for the cluster which failed to become ready
+	// in time until its spec is updated, except the diagnostics bundle of the
+	// failure.
+	var status = reconciler.observed.cluster.Status
+	if status.State == v1beta1.ClusterStateFailed &&
+		status.Reason == v1beta1.ClusterReasonReadinessTimeout {
+		reconciler.log.Info(
+			"The cluster failed by readiness timeout, skip reconciling until the spec is updated")
+		return ctrl.Result{}, reconciler.reconcileDiagnosticsBundle()
+	}
+
+	// No resources are created while the cluster exceeds the resource quota.
+	quotaExceeded, err := reconciler.checkResourceQuota()
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	if quotaExceeded {
+		return ctrl.Result{
+			Requeue: true, RequeueAfter: reconciler.quotaRequeueInterval}, nil
+	}
+
+	err = reconciler.checkPriorityClasses()
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+
+	err = reconciler.reconcileServiceAccount()
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+
+	err = reconciler.reconcileDiagnosticsBundle()
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+
+	err = reconciler.reconcileNetworkPolicy()
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+
+	err = reconciler.reconcileGrafanaDashboard()
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+
+	if reconciler.observed.cluster.Spec.Suspend {
+		err = reconciler.takeSavepointBeforeSuspension()
+		if err != nil {
+			return ctrl.Result{}, err
+		}
+	}
+
+	err = reconciler.reconcileCheckpointPVC()
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+
 	err = reconciler.reconcileConfigMap()
 	if err != nil {
 		return ctrl.Result{}, err
@@ -81,11 +176,305 @@ func (reconciler *ClusterReconciler) reconcile() (ctrl.Result, error) {
 		return ctrl.Result{}, err
 	}
 
+	err = reconciler.reconcileTaskManagerStatefulSet()
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+
+	err = reconciler.reconcileTaskManagerPools()
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+
+	err = reconciler.reconcileNativeCluster()
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+
+	err = reconciler.reconcileTrafficSplitting()
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+
+	err = reconciler.reconcileOrphans()
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+
+	err = reconciler.reconcileSuccessHooks()
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+
+	// The job cannot make progress while the cluster is suspended, it is
+	// reconciled after the cluster is resumed.
+	if reconciler.observed.cluster.Spec.Suspend {
+		reconciler.log.Info("The cluster is suspended, skip reconciling job")
+		return ctrl.Result{}, nil
+	}
+
 	result, err := reconciler.reconcileJob()
 
 	return result, nil
 }
 
+// Checks whether the cluster to be created exceeds the available resource
+// quota of the namespace, and records the result in the QuotaExceeded
+// condition. The check only applies before the deployments are created,
+// because the quota usage includes the pods of the existing deployments.
+func (reconciler *ClusterReconciler) checkResourceQuota() (bool, error) {
+	var log = reconciler.log
+	var observed = reconciler.observed
+	var desired = reconciler.desired
+	var cluster = observed.cluster
+	var condition = getCondition(
+		cluster.Status.Conditions, v1beta1.ClusterConditionQuotaExceeded)
+	if observed.jmDeployment != nil || observed.tmDeployment != nil ||
+		observed.tmStatefulSet != nil || desired.JmDeployment == nil {
+		return false, nil
+	}
+
+	var deployments = []*appsv1.Deployment{desired.JmDeployment, desired.TmDeployment}
+	for _, pool := range desired.TmPools {
+		deployments = append(deployments, pool)
+	}
+	// The pods of the StatefulSet use the same quota as those of a deployment.
+	if desired.TmStatefulSet != nil {
+		deployments = append(deployments, &appsv1.Deployment{
+			Spec: appsv1.DeploymentSpec{
+				Replicas: desired.TmStatefulSet.Spec.Replicas,
+				Template: desired.TmStatefulSet.Spec.Template,
+			},
+		})
+	}
+	var usage = getDeploymentsQuotaUsage(deployments, observed.limitRanges)
+	var message = getQuotaExceededMessage(observed.resourceQuotas, usage)
+	if len(message) == 0 {
+		if condition == nil || condition.Status == corev1.ConditionFalse {
+			return false, nil
+		}
+		log.Info("The cluster fits in the resource quota")
+		return false, reconciler.setQuotaExceededCondition(
+			corev1.ConditionFalse, "")
+	}
+
+	log.Info("The cluster exceeds the resource quota", "message", message)
+	if condition == nil || condition.Status != corev1.ConditionTrue ||
+		condition.Message != message {
+		reconciler.recorder.Event(
+			cluster, "Warning", v1beta1.ClusterConditionQuotaExceeded, message)
+		var err = reconciler.setQuotaExceededCondition(
+			corev1.ConditionTrue, message)
+		if err != nil {
+			return true, err
+		}
+	}
+	return true, nil
+}
+
+// Records the PriorityClasses referenced by the spec which don't exist in the
+// PriorityClassNotFound condition, the workloads using them are not created
+// until they exist. The warning event is only emitted when the missing
+// PriorityClasses change, not on every reconcile while they are missing.
+func (reconciler *ClusterReconciler) checkPriorityClasses() error {
+	var cluster = reconciler.observed.cluster
+	var missing = reconciler.observed.missingPriorityClasses
+	var current = getCondition(
+		cluster.Status.Conditions, v1beta1.ClusterConditionPriorityClassNotFound)
+	var condition = v1beta1.FlinkClusterCondition{
+		Type:   v1beta1.ClusterConditionPriorityClassNotFound,
+		Status: corev1.ConditionFalse,
+	}
+	if len(missing) > 0 {
+		condition.Status = corev1.ConditionTrue
+		condition.Reason = v1beta1.ClusterConditionPriorityClassNotFound
+		condition.Message = fmt.Sprintf(
+			"Priority classes %v do not exist, waiting to create the pods using them",
+			strings.Join(missing, ", "))
+	} else if current == nil {
+		return nil
+	}
+
+	var updated = cluster.DeepCopy()
+	if !setCondition(&updated.Status.Conditions, condition, time.Now()) {
+		return nil
+	}
+	if len(missing) > 0 {
+		reconciler.recorder.Event(
+			cluster, "Warning", condition.Reason, condition.Message)
+	}
+	setTimestamp(&updated.Status.LastUpdateTime)
+	var err = reconciler.k8sClient.Status().Update(reconciler.context, updated)
+	if err != nil {
+		return err
+	}
+	updated.Spec = cluster.Spec
+	reconciler.observed.cluster = updated
+	return nil
+}
+
+// Validates the spec of the cluster, which is normally done by the validating
+// webhook, but the webhook can be bypassed, e.g., when it is not deployed.
+// The configs rendered from the templates of the spec are checked too.
+// Returns the messages of all the validation errors.
+func validateSpec(cluster *v1beta1.FlinkCluster) []string {
+	var validator = &v1beta1.Validator{}
+	var messages []string
+	for _, err := range validator.ValidateSpec(cluster) {
+		messages = append(messages, err.Error())
+	}
+	if len(messages) == 0 && cluster.Spec.JobManagerProxy != nil {
+		var _, err = getJobManagerProxyConfig(
+			cluster.Spec.JobManagerProxy, *cluster.Spec.JobManager.Ports.UI)
+		if err != nil {
+			messages = append(messages, err.Error())
+		}
+	}
+	return messages
+}
+
+// Records the result of the spec validation in the SpecValid condition, and
+// emits a warning event when the spec becomes invalid.
+func (reconciler *ClusterReconciler) checkSpecValid() (bool, error) {
+	var log = reconciler.log
+	var cluster = reconciler.observed.cluster
+	var specErrors = reconciler.observed.specErrors
+	var condition = v1beta1.FlinkClusterCondition{
+		Type:   v1beta1.ClusterConditionSpecValid,
+		Status: corev1.ConditionTrue,
+	}
+	if len(specErrors) > 0 {
+		condition.Status = corev1.ConditionFalse
+		condition.Reason = "InvalidSpec"
+		condition.Message = strings.Join(specErrors, "; ")
+		log.Info("The cluster spec is invalid", "errors", specErrors)
+	}
+
+	var updated = cluster.DeepCopy()
+	if !setCondition(&updated.Status.Conditions, condition, time.Now()) {
+		return len(specErrors) == 0, nil
+	}
+	if len(specErrors) > 0 {
+		reconciler.recorder.Event(
+			cluster, "Warning", condition.Reason, condition.Message)
+	}
+	setTimestamp(&updated.Status.LastUpdateTime)
+	var err = reconciler.k8sClient.Status().Update(reconciler.context, updated)
+	if err != nil {
+		return false, err
+	}
+	// The following status updates are based on the new resource version,
+	// keeping the observed spec which is merged with the cluster template.
+	updated.Spec = cluster.Spec
+	reconciler.observed.cluster = updated
+	return len(specErrors) == 0, nil
+}
+
+// Runs the requests of the spec which stop the job or the cluster while the
+// rest of the spec is not reconciled, so that they don't wait for the spec to
+// be fixed. Their desired state is not computed, the job is cancelled and the
+// workloads are scaled to zero from the observed state. The deletion of the
+// cluster is handled by the finalizer.
+func (reconciler *ClusterReconciler) reconcileStopRequests() (
+	ctrl.Result, error) {
+	var log = reconciler.log
+	var observed = reconciler.observed
+	var jobSpec = observed.cluster.Spec.Job
+
+	if jobSpec != nil && jobSpec.CancelRequested != nil &&
+		*jobSpec.CancelRequested {
+		var jobID = reconciler.getFlinkJobID()
+		if len(jobID) > 0 && !reconciler.isJobStopped() {
+			log.Info("Cancelling job", "jobID", jobID)
+			var err = reconciler.cancelFlinkJob(jobID, true /* takeSavepoint */)
+			if err != nil {
+				log.Error(err, "Failed to cancel job", "jobID", jobID)
+				return requeueResult, nil
+			}
+		}
+		if observed.job != nil {
+			var err = reconciler.deleteJob(observed.job)
+			if err != nil {
+				return ctrl.Result{}, err
+			}
+		}
+	}
+
+	if observed.cluster.Spec.Suspend {
+		var err = reconciler.takeSavepointBeforeSuspension()
+		if err != nil {
+			return ctrl.Result{}, err
+		}
+		var zero int32
+		var deployments = map[string]*appsv1.Deployment{
+			"JobManager":  observed.jmDeployment,
+			"TaskManager": observed.tmDeployment,
+		}
+		for name, deployment := range observed.tmPools {
+			deployments["TaskManagerPool/"+name] = deployment
+		}
+		for component, deployment := range deployments {
+			if deployment == nil ||
+				isReplicasEqual(deployment.Spec.Replicas, &zero) {
+				continue
+			}
+			var owned bool
+			owned, err = reconciler.verifyOwnerReference(
+				deployment, component+" deployment")
+			if err != nil {
+				return ctrl.Result{}, err
+			}
+			if !owned {
+				continue
+			}
+			var updated = deployment.DeepCopy()
+			updated.Spec.Replicas = &zero
+			setAppliedReplicas(&updated.ObjectMeta, updated.Spec.Replicas)
+			err = reconciler.updateDeployment(deployment, updated, component)
+			if err != nil {
+				return ctrl.Result{}, err
+			}
+		}
+		var statefulSet = observed.tmStatefulSet
+		if statefulSet != nil &&
+			!isReplicasEqual(statefulSet.Spec.Replicas, &zero) {
+			var owned bool
+			owned, err = reconciler.verifyOwnerReference(
+				statefulSet, "TaskManager StatefulSet")
+			if !owned || err != nil {
+				return ctrl.Result{}, err
+			}
+			var updated = statefulSet.DeepCopy()
+			updated.Spec.Replicas = &zero
+			setAppliedReplicas(&updated.ObjectMeta, updated.Spec.Replicas)
+			log.Info("Updating StatefulSet", "statefulSet", updated)
+			err = reconciler.k8sClient.Patch(
+				reconciler.context, updated, client.MergeFrom(statefulSet))
+			if err != nil {
+				log.Error(err, "Failed to update StatefulSet")
+				return ctrl.Result{}, err
+			}
+		}
+	}
+	return ctrl.Result{}, nil
+}
+
+func (reconciler *ClusterReconciler) setQuotaExceededCondition(
+	status corev1.ConditionStatus, message string) error {
+	var updated = reconciler.observed.cluster.DeepCopy()
+	var condition = v1beta1.FlinkClusterCondition{
+		Type:    v1beta1.ClusterConditionQuotaExceeded,
+		Status:  status,
+		Message: message,
+	}
+	if status == corev1.ConditionTrue {
+		condition.Reason = "InsufficientQuota"
+	}
+	setCondition(&updated.Status.Conditions, condition, time.Now())
+	setTimestamp(&updated.Status.LastUpdateTime)
+	return reconciler.k8sClient.Status().Update(reconciler.context, updated)
+}
+
 func (reconciler *ClusterReconciler) reconcileJobManagerDeployment() error {
 	return reconciler.reconcileDeployment(
 		"JobManager",
@@ -94,245 +483,1238 @@ func (reconciler *ClusterReconciler) reconcileJobManagerDeployment() error {
 }
 
 func (reconciler *ClusterReconciler) reconcileTaskManagerDeployment() error {
+	var desiredDeployment = reconciler.desired.TmDeployment
+	var observedDeployment = reconciler.observed.tmDeployment
+	if desiredDeployment != nil && observedDeployment != nil &&
+		isTaskManagerScalingDown(&reconciler.observed) {
+		var drained, err = reconciler.drainTaskManagers(
+			*observedDeployment.Spec.Replicas - *desiredDeployment.Spec.Replicas)
+		if err != nil {
+			return err
+		}
+		// Keep the replicas until enough TaskManagers are drained.
+		if !drained {
+			desiredDeployment = desiredDeployment.DeepCopy()
+			desiredDeployment.Spec.Replicas = observedDeployment.Spec.Replicas
+		}
+	}
 	return reconciler.reconcileDeployment(
-		"TaskManager",
-		reconciler.desired.TmDeployment,
-		reconciler.observed.tmDeployment)
+		"TaskManager", desiredDeployment, observedDeployment)
 }
 
-func (reconciler *ClusterReconciler) reconcileDeployment(
-	component string,
-	desiredDeployment *appsv1.Deployment,
-	observedDeployment *appsv1.Deployment) error {
-	var log = reconciler.log.WithValues("component", component)
+// Reconciles the StatefulSet of the TaskManagers with volume claim templates.
+// Before a scale-down, the reconciler waits for the TaskManagers with the
+// highest ordinals, which the StatefulSet removes, to be drained.
+func (reconciler *ClusterReconciler) reconcileTaskManagerStatefulSet() error {
+	var log = reconciler.log.WithValues("component", "TaskManager")
+	var desiredStatefulSet = reconciler.desired.TmStatefulSet
+	var observedStatefulSet = reconciler.observed.tmStatefulSet
+
+	if desiredStatefulSet != nil && observedStatefulSet == nil {
+		var priorityClass = desiredStatefulSet.Spec.Template.Spec.PriorityClassName
+		if isPriorityClassMissing(&reconciler.observed, priorityClass) {
+			log.Info(
+				"Priority class does not exist, waiting to create the TaskManager StatefulSet",
+				"priorityClass", priorityClass)
+			return nil
+		}
+		if reconciler.isRecordedComponent(
+			"StatefulSet", desiredStatefulSet.Name) {
+			reconciler.recordDriftCorrected(fmt.Sprintf(
+				"The TaskManager StatefulSet %v is missing, recreating it",
+				desiredStatefulSet.Name))
+		}
+		var statefulSet = desiredStatefulSet.DeepCopy()
+		setAppliedReplicas(&statefulSet.ObjectMeta, statefulSet.Spec.Replicas)
+		log.Info("Creating StatefulSet", "statefulSet", *statefulSet)
+		var err = reconciler.k8sClient.Create(reconciler.context, statefulSet)
+		if err != nil {
+			log.Error(err, "Failed to create StatefulSet")
+		} else {
+			log.Info("StatefulSet created")
+		}
+		return err
+	}
 
-	if desiredDeployment != nil && observedDeployment == nil {
-		return reconciler.createDeployment(desiredDeployment, component)
+	if observedStatefulSet != nil {
+		var owned, err = reconciler.verifyOwnerReference(
+			observedStatefulSet, "TaskManager StatefulSet")
+		if !owned || err != nil {
+			return err
+		}
 	}
 
-	if desiredDeployment != nil && observedDeployment != nil {
-		log.Info("Deployment already exists, no action")
-		return nil
-		// TODO(dagang): compare and update if needed.
+	if desiredStatefulSet != nil && observedStatefulSet != nil {
+		var updated = observedStatefulSet.DeepCopy()
+		var changed = false
+		// Replicas change when the cluster is scaled, suspended or resumed, or
+		// when they were changed outside of the operator.
+		// Keep the replicas until the TaskManagers to be removed are drained.
+		if isTaskManagerScalingDown(&reconciler.observed) &&
+			!reconciler.drainTaskManagerStatefulSet(
+				observedStatefulSet, *desiredStatefulSet.Spec.Replicas) {
+			desiredStatefulSet = desiredStatefulSet.DeepCopy()
+			desiredStatefulSet.Spec.Replicas = observedStatefulSet.Spec.Replicas
+		}
+		if !isReplicasEqual(
+			desiredStatefulSet.Spec.Replicas, observedStatefulSet.Spec.Replicas) {
+			if isReplicasDrifted(
+				observedStatefulSet.ObjectMeta, observedStatefulSet.Spec.Replicas) {
+				reconciler.recordDriftCorrected(fmt.Sprintf(
+					"The replicas of the TaskManager StatefulSet were changed to %v, restoring them to %v",
+					*observedStatefulSet.Spec.Replicas,
+					*desiredStatefulSet.Spec.Replicas))
+			}
+			updated.Spec.Replicas = desiredStatefulSet.Spec.Replicas
+			setAppliedReplicas(&updated.ObjectMeta, updated.Spec.Replicas)
+			changed = true
+		} else if !hasAppliedReplicas(observedStatefulSet.ObjectMeta) {
+			// Created before the operator recorded the applied replicas.
+			setAppliedReplicas(&updated.ObjectMeta, updated.Spec.Replicas)
+			changed = true
+		}
+		// Labels change when the inherited namespace labels change.
+		if !isLabelsSynced(updated, desiredStatefulSet) {
+			updated.Labels, updated.Annotations = getSyncedLabels(
+				updated, desiredStatefulSet)
+			changed = true
+		}
+		// The pods are restarted when the external Flink config changes or
+		// the cluster is restarted.
+		if updateRestartAnnotations(
+			&desiredStatefulSet.Spec.Template, &updated.Spec.Template) {
+			changed = true
+		}
+		if !changed {
+			log.Info("StatefulSet already exists, no action")
+			return nil
+		}
+		log.Info("Updating StatefulSet", "statefulSet", updated)
+		var err = reconciler.k8sClient.Patch(
+			reconciler.context, updated, client.MergeFrom(observedStatefulSet))
+		if err != nil {
+			log.Error(err, "Failed to update StatefulSet")
+		} else {
+			log.Info("StatefulSet updated")
+		}
+		return err
 	}
 
-	if desiredDeployment == nil && observedDeployment != nil {
-		return reconciler.deleteDeployment(observedDeployment, component)
+	if desiredStatefulSet == nil && observedStatefulSet != nil {
+		log.Info("Deleting StatefulSet", "statefulSet", observedStatefulSet)
+		var err = reconciler.k8sClient.Delete(
+			reconciler.context, observedStatefulSet)
+		err = client.IgnoreNotFound(err)
+		if err != nil {
+			log.Error(err, "Failed to delete StatefulSet")
+		} else {
+			log.Info("StatefulSet deleted")
+		}
+		return err
 	}
 
 	return nil
 }
 
-func (reconciler *ClusterReconciler) createDeployment(
-	deployment *appsv1.Deployment, component string) error {
-	var context = reconciler.context
-	var log = reconciler.log.WithValues("component", component)
-	var k8sClient = reconciler.k8sClient
+// Drains the TaskManagers to be removed by a scale-down of the deployment.
+// Flink cannot move the tasks off a TaskManager, so the idle TaskManagers,
+// whose slots are all free, are picked and their pods are deleted. Deleting
+// them before the replicas are reduced makes the ReplicaSet remove their not
+// yet ready replacements instead of the busy pods. Returns false while there
+// are not enough idle TaskManagers, until the drain timeout.
+func (reconciler *ClusterReconciler) drainTaskManagers(count int32) (
+	bool, error) {
+	var log = reconciler.log.WithValues("component", "TaskManager")
+	if reconciler.isDrainTimedOut() {
+		return true, nil
+	}
+	var idle = getIdleTaskManagers(reconciler.observed.flinkTaskManagers)
+	if idle == nil {
+		log.Info("Waiting for the TaskManagers from Flink API to drain them")
+		return false, nil
+	}
 
-	log.Info("Creating deployment", "deployment", *deployment)
-	var err = k8sClient.Create(context, deployment)
-	if err != nil {
-		log.Error(err, "Failed to create deployment")
-	} else {
-		log.Info("Deployment created")
+	var idlePods = []*corev1.Pod{}
+	for i := range reconciler.observed.tmPods {
+		var pod = &reconciler.observed.tmPods[i]
+		if pod.DeletionTimestamp == nil && idle[pod.Name] {
+			idlePods = append(idlePods, pod)
+		}
+	}
+	if int32(len(idlePods)) < count {
+		log.Info(
+			"Waiting for the TaskManagers to drain",
+			"toRemove", count,
+			"idle", len(idlePods))
+		return false, nil
 	}
-	return err
-}
 
-func (reconciler *ClusterReconciler) updateDeployment(
-	deployment *appsv1.Deployment, component string) error {
-	var context = reconciler.context
-	var log = reconciler.log.WithValues("component", component)
-	var k8sClient = reconciler.k8sClient
+	for _, pod := range idlePods[:count] {
+		log.Info("Deleting drained TaskManager pod", "pod", pod.Name)
+		var err = reconciler.k8sClient.Delete(reconciler.context, pod)
+		if client.IgnoreNotFound(err) != nil {
+			log.Error(err, "Failed to delete TaskManager pod", "pod", pod.Name)
+			return false, err
+		}
+	}
+	return true, nil
+}
 
-	log.Info("Updating deployment", "deployment", deployment)
-	var err = k8sClient.Update(context, deployment)
-	if err != nil {
-		log.Error(err, "Failed to update deployment")
-	} else {
-		log.Info("Deployment updated")
+// Drains the TaskManagers to be removed by a scale-down of the StatefulSet,
+// which always removes the pods with the highest ordinals. Returns false while
+// any of them is not idle, until the drain timeout.
+func (reconciler *ClusterReconciler) drainTaskManagerStatefulSet(
+	statefulSet *appsv1.StatefulSet, replicas int32) bool {
+	var log = reconciler.log.WithValues("component", "TaskManager")
+	if reconciler.isDrainTimedOut() {
+		return true
 	}
-	return err
+	var idle = getIdleTaskManagers(reconciler.observed.flinkTaskManagers)
+	if idle == nil {
+		log.Info("Waiting for the TaskManagers from Flink API to drain them")
+		return false
+	}
+	var pods = map[string]bool{}
+	for _, pod := range reconciler.observed.tmPods {
+		pods[pod.Name] = true
+	}
+	for ordinal := replicas; ordinal < *statefulSet.Spec.Replicas; ordinal++ {
+		// A missing pod runs no tasks.
+		var name = fmt.Sprintf("%v-%v", statefulSet.Name, ordinal)
+		if pods[name] && !idle[name] {
+			log.Info("Waiting for the TaskManager to drain", "pod", name)
+			return false
+		}
+	}
+	return true
 }
 
-func (reconciler *ClusterReconciler) deleteDeployment(
-	deployment *appsv1.Deployment, component string) error {
-	var context = reconciler.context
-	var log = reconciler.log.WithValues("component", component)
-	var k8sClient = reconciler.k8sClient
+// Whether the TaskManagers have been drained for longer than the drain
+// timeout, in which case they are removed even if they are not idle.
+func (reconciler *ClusterReconciler) isDrainTimedOut() bool {
+	var cluster = reconciler.observed.cluster
+	var startTime = cluster.Status.Components.TaskManagerDeployment.DrainStartTime
+	if len(startTime) == 0 {
+		return false
+	}
+	var timeout = defaultDrainTimeoutSeconds
+	if cluster.Spec.TaskManager.DrainTimeoutSeconds != nil {
+		timeout = *cluster.Spec.TaskManager.DrainTimeoutSeconds
+	}
+	var tc = &TimeConverter{}
+	var deadline = tc.FromString(startTime).Add(
+		time.Duration(timeout) * time.Second)
+	if time.Now().Before(deadline) {
+		return false
+	}
+	var message = fmt.Sprintf(
+		"The TaskManagers were not idle after %vs, removing them anyway", timeout)
+	reconciler.log.Info(message)
+	reconciler.recorder.Event(cluster, "Warning", "DrainTimeout", message)
+	return true
+}
 
-	log.Info("Deleting deployment", "deployment", deployment)
-	var err = k8sClient.Delete(context, deployment)
-	err = client.IgnoreNotFound(err)
-	if err != nil {
-		log.Error(err, "Failed to delete deployment")
-	} else {
-		log.Info("Deployment deleted")
+// Gets the IDs of the idle TaskManagers, whose slots are all free. The
+// TaskManagers are started with their pod names as resource IDs, so the IDs
+// are pod names. Nil if the TaskManagers are unknown.
+func getIdleTaskManagers(
+	taskManagers *flinkclient.TaskManagerList) map[string]bool {
+	if taskManagers == nil {
+		return nil
 	}
-	return err
+	var idle = map[string]bool{}
+	for _, taskManager := range taskManagers.TaskManagers {
+		if taskManager.FreeSlots == taskManager.SlotsNumber {
+			idle[taskManager.ID] = true
+		}
+	}
+	return idle
 }
 
-func (reconciler *ClusterReconciler) reconcileJobManagerService() error {
-	var desiredJmService = reconciler.desired.JmService
-	var observedJmService = reconciler.observed.jmService
+// Creates the deployments of the desired TaskManager pools and deletes those
+// of the pools which are no longer desired.
+func (reconciler *ClusterReconciler) reconcileTaskManagerPools() error {
+	var desiredPools = reconciler.desired.TmPools
+	var observedPools = reconciler.observed.tmPools
 
-	if desiredJmService != nil && observedJmService == nil {
-		return reconciler.createService(desiredJmService, "JobManager")
+	for name, desiredDeployment := range desiredPools {
+		var err = reconciler.reconcileDeployment(
+			"TaskManagerPool/"+name, desiredDeployment, observedPools[name])
+		if err != nil {
+			return err
+		}
+	}
+	for name, observedDeployment := range observedPools {
+		if _, ok := desiredPools[name]; ok {
+			continue
+		}
+		var err = reconciler.reconcileDeployment(
+			"TaskManagerPool/"+name, nil, observedDeployment)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (reconciler *ClusterReconciler) reconcileDeployment(
+	component string,
+	desiredDeployment *appsv1.Deployment,
+	observedDeployment *appsv1.Deployment) error {
+	var log = reconciler.log.WithValues("component", component)
+
+	if desiredDeployment != nil && observedDeployment == nil {
+		var priorityClass = desiredDeployment.Spec.Template.Spec.PriorityClassName
+		if isPriorityClassMissing(&reconciler.observed, priorityClass) {
+			log.Info(
+				"Priority class does not exist, waiting to create the deployment",
+				"priorityClass", priorityClass)
+			return nil
+		}
+		if reconciler.isRecordedComponent(
+			"Deployment", desiredDeployment.Name) {
+			reconciler.recordDriftCorrected(fmt.Sprintf(
+				"The %v deployment %v is missing, recreating it",
+				component,
+				desiredDeployment.Name))
+		}
+		var deployment = desiredDeployment.DeepCopy()
+		setAppliedReplicas(&deployment.ObjectMeta, deployment.Spec.Replicas)
+		return reconciler.createDeployment(deployment, component)
+	}
+
+	if observedDeployment != nil {
+		var owned, err = reconciler.verifyOwnerReference(
+			observedDeployment, component+" deployment")
+		if !owned || err != nil {
+			return err
+		}
+	}
+
+	if desiredDeployment != nil && observedDeployment != nil {
+		var updated = observedDeployment.DeepCopy()
+		var changed = false
+		// Replicas change when the cluster is suspended or resumed, or when
+		// they were changed outside of the operator.
+		if !isReplicasEqual(
+			desiredDeployment.Spec.Replicas, observedDeployment.Spec.Replicas) {
+			if isReplicasDrifted(
+				observedDeployment.ObjectMeta, observedDeployment.Spec.Replicas) {
+				reconciler.recordDriftCorrected(fmt.Sprintf(
+					"The replicas of the %v deployment were changed to %v, restoring them to %v",
+					component,
+					*observedDeployment.Spec.Replicas,
+					*desiredDeployment.Spec.Replicas))
+			}
+			updated.Spec.Replicas = desiredDeployment.Spec.Replicas
+			setAppliedReplicas(&updated.ObjectMeta, updated.Spec.Replicas)
+			changed = true
+		} else if !hasAppliedReplicas(observedDeployment.ObjectMeta) {
+			// Created before the operator recorded the applied replicas.
+			setAppliedReplicas(&updated.ObjectMeta, updated.Spec.Replicas)
+			changed = true
+		}
+		// Labels change when the inherited namespace labels change.
+		if !isLabelsSynced(updated, desiredDeployment) {
+			updated.Labels, updated.Annotations = getSyncedLabels(
+				updated, desiredDeployment)
+			changed = true
+		}
+		// The pods are restarted when the external Flink config changes or
+		// the cluster is restarted.
+		if updateRestartAnnotations(
+			&desiredDeployment.Spec.Template, &updated.Spec.Template) {
+			changed = true
+		}
+		if changed {
+			return reconciler.updateDeployment(
+				observedDeployment, updated, component)
+		}
+		log.Info("Deployment already exists, no action")
+		return nil
+		// TODO(dagang): compare and update if needed.
+	}
+
+	if desiredDeployment == nil && observedDeployment != nil {
+		return reconciler.deleteDeployment(observedDeployment, component)
+	}
+
+	return nil
+}
+
+// Whether the child resource of the kind with the name has been recorded in
+// the status of the cluster, i.e., it existed before and is missing because
+// it was deleted outside of the operator. The kind is compared too, because
+// the JobManager deployment and service have the same name.
+func (reconciler *ClusterReconciler) isRecordedComponent(
+	kind string, name string) bool {
+	var cluster = reconciler.observed.cluster
+	if cluster == nil {
+		return false
+	}
+	var components = cluster.Status.Components
+	switch kind {
+	case "ConfigMap":
+		return components.ConfigMap.Name == name
+	case "Service":
+		return components.JobManagerService.Name == name
+	case "Deployment", "StatefulSet":
+		if components.JobManagerDeployment.Name == name ||
+			components.TaskManagerDeployment.Name == name {
+			return true
+		}
+		for _, pool := range components.TaskManagerPools {
+			if pool.Name == name {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Verifies that an observed child resource is controlled by the cluster before
+// it is updated or deleted. A resource whose owner reference was removed
+// outside of the operator is adopted again, and it is updated in the next
+// reconcile. A resource controlled by another owner, e.g., a resource with the
+// same name created by someone else, is left untouched. Returns whether the
+// resource can be updated.
+func (reconciler *ClusterReconciler) verifyOwnerReference(
+	obj runtime.Object, component string) (bool, error) {
+	var cluster = reconciler.observed.cluster
+	if cluster == nil {
+		return true, nil
+	}
+	var accessor, err = meta.Accessor(obj)
+	if err != nil {
+		return false, err
+	}
+	if metav1.IsControlledBy(accessor, cluster) {
+		return true, nil
+	}
+	if owner := metav1.GetControllerOf(accessor); owner != nil {
+		var message = fmt.Sprintf(
+			"The %v %v is controlled by %v %v, not updating it",
+			component, accessor.GetName(), owner.Kind, owner.Name)
+		reconciler.log.Info(message)
+		reconciler.recorder.Event(cluster, "Warning", "NotOwned", message)
+		return false, nil
+	}
+
+	reconciler.recordDriftCorrected(fmt.Sprintf(
+		"The owner reference of the %v %v was removed, restoring it",
+		component, accessor.GetName()))
+	var updated = obj.DeepCopyObject()
+	accessor, _ = meta.Accessor(updated)
+	accessor.SetOwnerReferences(append(
+		accessor.GetOwnerReferences(), toOwnerReference(cluster)))
+	err = reconciler.k8sClient.Patch(
+		reconciler.context, updated, client.MergeFrom(obj))
+	if err != nil {
+		reconciler.log.Error(err, "Failed to restore the owner reference")
+	}
+	return false, err
+}
+
+// Records a Warning event when a child resource which was changed or deleted
+// outside of the operator is restored to the desired state.
+func (reconciler *ClusterReconciler) recordDriftCorrected(message string) {
+	reconciler.log.Info(message)
+	reconciler.recorder.Event(
+		reconciler.observed.cluster, "Warning", "DriftCorrected", message)
+}
+
+// Records the replicas applied by the operator in the annotation of the
+// resource.
+func setAppliedReplicas(objMeta *metav1.ObjectMeta, replicas *int32) {
+	if replicas == nil {
+		return
+	}
+	if objMeta.Annotations == nil {
+		objMeta.Annotations = map[string]string{}
+	}
+	objMeta.Annotations[appliedReplicasAnnotation] = fmt.Sprint(*replicas)
+}
+
+// Whether the replicas applied by the operator are recorded in the annotation
+// of the resource.
+func hasAppliedReplicas(objMeta metav1.ObjectMeta) bool {
+	var _, ok = objMeta.Annotations[appliedReplicasAnnotation]
+	return ok
+}
+
+// Whether the replicas of the resource differ from the replicas which were
+// last applied by the operator, i.e., they were changed by someone else, e.g.,
+// `kubectl scale`.
+func isReplicasDrifted(objMeta metav1.ObjectMeta, replicas *int32) bool {
+	var applied, ok = objMeta.Annotations[appliedReplicasAnnotation]
+	return ok && replicas != nil && applied != fmt.Sprint(*replicas)
+}
+
+// Whether the service ports are equal, ignoring the node ports allocated by
+// Kubernetes and the default protocol.
+func isServicePortsEqual(desired []corev1.ServicePort, observed []corev1.ServicePort) bool {
+	if len(desired) != len(observed) {
+		return false
+	}
+	for i := range desired {
+		var desiredPort = desired[i]
+		var observedPort = observed[i]
+		if desiredPort.Name != observedPort.Name ||
+			desiredPort.Port != observedPort.Port ||
+			desiredPort.TargetPort != observedPort.TargetPort ||
+			getServicePortProtocol(desiredPort) != getServicePortProtocol(observedPort) ||
+			(desiredPort.NodePort != 0 && desiredPort.NodePort != observedPort.NodePort) {
+			return false
+		}
+	}
+	return true
+}
+
+func getServicePortProtocol(port corev1.ServicePort) corev1.Protocol {
+	if len(port.Protocol) == 0 {
+		return corev1.ProtocolTCP
+	}
+	return port.Protocol
+}
+
+// Gets the checksum of the external Flink config of the pods of the
+// deployment, empty if there is none.
+func getFlinkConfigChecksum(deployment *appsv1.Deployment) string {
+	return deployment.Spec.Template.Annotations[flinkConfigChecksumAnnotation]
+}
+
+// Copies the annotations of the desired pod template which restart the pods
+// when they change, i.e., the checksum of the external Flink config and the
+// restartedAt annotation of the cluster, to the updated pod template. An
+// annotation removed from the desired template is kept, so that removing it
+// doesn't restart the pods. Returns whether any of them changed.
+func updateRestartAnnotations(
+	desired *corev1.PodTemplateSpec, updated *corev1.PodTemplateSpec) bool {
+	var changed = false
+	for _, annotation := range []string{
+		flinkConfigChecksumAnnotation, restartedAtAnnotation} {
+		var value = desired.Annotations[annotation]
+		if len(value) == 0 || value == updated.Annotations[annotation] {
+			continue
+		}
+		if updated.Annotations == nil {
+			updated.Annotations = map[string]string{}
+		}
+		updated.Annotations[annotation] = value
+		changed = true
+	}
+	return changed
+}
+
+// Whether the priority class is referenced by the spec but does not exist.
+func isPriorityClassMissing(
+	observed *ObservedClusterState, priorityClass string) bool {
+	for _, missing := range observed.missingPriorityClasses {
+		if missing == priorityClass {
+			return true
+		}
+	}
+	return false
+}
+
+// Deletes the application cluster deployed by Flink in native mode according
+// to the cleanup policy. The TaskManager pods, the services and the ConfigMaps
+// created by Flink are owned by its JobManager deployment.
+func (reconciler *ClusterReconciler) reconcileNativeCluster() error {
+	var cluster = reconciler.observed.cluster
+	if !isNativeMode(cluster) || len(reconciler.observed.jmPods) == 0 ||
+		!shouldCleanup(cluster, "JobManagerDeployment") {
+		return nil
+	}
+	var deployment = &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: cluster.Namespace,
+			Name:      NewResourceNamer(cluster).NativeClusterID(),
+		},
+	}
+	return reconciler.deleteDeployment(deployment, "NativeJobManager")
+}
+
+func (reconciler *ClusterReconciler) createDeployment(
+	deployment *appsv1.Deployment, component string) error {
+	var context = reconciler.context
+	var log = reconciler.log.WithValues("component", component)
+	var k8sClient = reconciler.k8sClient
+
+	log.Info("Creating deployment", "deployment", *deployment)
+	var err = k8sClient.Create(context, deployment)
+	if err != nil {
+		log.Error(err, "Failed to create deployment")
+	} else {
+		log.Info("Deployment created")
+	}
+	return err
+}
+
+// Patches the observed deployment to the updated one, only the changed fields
+// are sent, so that the fields set by other controllers and webhooks are kept.
+func (reconciler *ClusterReconciler) updateDeployment(
+	observed *appsv1.Deployment,
+	updated *appsv1.Deployment,
+	component string) error {
+	var context = reconciler.context
+	var log = reconciler.log.WithValues("component", component)
+	var k8sClient = reconciler.k8sClient
+
+	log.Info("Updating deployment", "deployment", updated)
+	var err = k8sClient.Patch(context, updated, client.MergeFrom(observed))
+	if err != nil {
+		log.Error(err, "Failed to update deployment")
+	} else {
+		log.Info("Deployment updated")
+	}
+	return err
+}
+
+func (reconciler *ClusterReconciler) deleteDeployment(
+	deployment *appsv1.Deployment, component string) error {
+	var context = reconciler.context
+	var log = reconciler.log.WithValues("component", component)
+	var k8sClient = reconciler.k8sClient
+
+	log.Info("Deleting deployment", "deployment", deployment)
+	var err = k8sClient.Delete(context, deployment)
+	err = client.IgnoreNotFound(err)
+	if err != nil {
+		log.Error(err, "Failed to delete deployment")
+	} else {
+		log.Info("Deployment deleted")
+	}
+	return err
+}
+
+func (reconciler *ClusterReconciler) reconcileJobManagerService() error {
+	var desiredJmService = reconciler.desired.JmService
+	var observedJmService = reconciler.observed.jmService
+
+	if desiredJmService != nil && observedJmService == nil {
+		if reconciler.isRecordedComponent(
+			"Service", desiredJmService.Name) {
+			reconciler.recordDriftCorrected(fmt.Sprintf(
+				"The JobManager service %v is missing, recreating it",
+				desiredJmService.Name))
+		}
+		return reconciler.createService(desiredJmService, "JobManager")
+	}
+
+	if observedJmService != nil {
+		var owned, err = reconciler.verifyOwnerReference(
+			observedJmService, "JobManager service")
+		if !owned || err != nil {
+			return err
+		}
 	}
 
 	if desiredJmService != nil && observedJmService != nil {
+		if !isServicePortsEqual(
+			desiredJmService.Spec.Ports, observedJmService.Spec.Ports) {
+			reconciler.recordDriftCorrected(
+				"The ports of the JobManager service were changed, restoring them to the spec")
+			return reconciler.updateServicePorts(
+				observedJmService, desiredJmService.Spec.Ports, "JobManager")
+		}
+		if !isLabelsSynced(observedJmService, desiredJmService) {
+			return reconciler.updateLabels(
+				observedJmService, desiredJmService, "JobManagerService")
+		}
 		reconciler.log.Info("JobManager service already exists, no action")
 		return nil
-		// TODO(dagang): compare and update if needed.
+		// TODO(dagang): compare and update if needed.
+	}
+
+	if desiredJmService == nil && observedJmService != nil {
+		return reconciler.deleteService(observedJmService, "JobManager")
+		// TODO(dagang): compare and update if needed.
+	}
+
+	return nil
+}
+
+func (reconciler *ClusterReconciler) createService(
+	service *corev1.Service, component string) error {
+	var context = reconciler.context
+	var log = reconciler.log.WithValues("component", component)
+	var k8sClient = reconciler.k8sClient
+
+	log.Info("Creating service", "resource", *service)
+	var err = k8sClient.Create(context, service)
+	if err != nil {
+		log.Info("Failed to create service", "error", err)
+	} else {
+		log.Info("Service created")
+	}
+	return err
+}
+
+// Restores the ports of an existing service, keeping the node ports allocated
+// to the ports with the same names.
+func (reconciler *ClusterReconciler) updateServicePorts(
+	service *corev1.Service, ports []corev1.ServicePort, component string) error {
+	var context = reconciler.context
+	var log = reconciler.log.WithValues("component", component)
+	var k8sClient = reconciler.k8sClient
+
+	var nodePorts = map[string]int32{}
+	for _, port := range service.Spec.Ports {
+		nodePorts[port.Name] = port.NodePort
+	}
+	var updated = service.DeepCopy()
+	updated.Spec.Ports = nil
+	for _, port := range ports {
+		if port.NodePort == 0 {
+			port.NodePort = nodePorts[port.Name]
+		}
+		updated.Spec.Ports = append(updated.Spec.Ports, port)
+	}
+	log.Info("Updating service ports", "ports", updated.Spec.Ports)
+	var err = k8sClient.Update(context, updated)
+	if err != nil {
+		log.Error(err, "Failed to update service ports")
+	} else {
+		log.Info("Service ports updated")
+	}
+	return err
+}
+
+func (reconciler *ClusterReconciler) deleteService(
+	service *corev1.Service, component string) error {
+	var context = reconciler.context
+	var log = reconciler.log.WithValues("component", component)
+	var k8sClient = reconciler.k8sClient
+
+	log.Info("Deleting service", "service", service)
+	var err = k8sClient.Delete(context, service)
+	err = client.IgnoreNotFound(err)
+	if err != nil {
+		log.Error(err, "Failed to delete service")
+	} else {
+		log.Info("service deleted")
+	}
+	return err
+}
+
+func (reconciler *ClusterReconciler) reconcileJobManagerIngress() error {
+	var desiredJmIngress = reconciler.desired.JmIngress
+	var observedJmIngress = reconciler.observed.jmIngress
+
+	if desiredJmIngress != nil && observedJmIngress == nil {
+		return reconciler.createIngress(desiredJmIngress, "JobManager")
+	}
+
+	if observedJmIngress != nil {
+		var owned, err = reconciler.verifyOwnerReference(
+			observedJmIngress, "JobManager ingress")
+		if !owned || err != nil {
+			return err
+		}
+	}
+
+	if desiredJmIngress != nil && observedJmIngress != nil {
+		if !isLabelsSynced(observedJmIngress, desiredJmIngress) {
+			return reconciler.updateLabels(
+				observedJmIngress, desiredJmIngress, "JobManagerIngress")
+		}
+		reconciler.log.Info("JobManager ingress already exists, no action")
+		return nil
+		// TODO: compare and update if needed.
+	}
+
+	if desiredJmIngress == nil && observedJmIngress != nil {
+		return reconciler.garbageCollectOrphan(observedJmIngress)
+	}
+
+	return nil
+}
+
+func (reconciler *ClusterReconciler) createIngress(
+	ingress *extensionsv1beta1.Ingress, component string) error {
+	var context = reconciler.context
+	var log = reconciler.log.WithValues("component", component)
+	var k8sClient = reconciler.k8sClient
+
+	log.Info("Creating ingress", "resource", *ingress)
+	var err = k8sClient.Create(context, ingress)
+	if err != nil {
+		log.Info("Failed to create ingress", "error", err)
+	} else {
+		log.Info("Ingress created")
+	}
+	return err
+}
+
+// Deletes the orphaned child resources, whose components have been removed
+// from the spec.
+func (reconciler *ClusterReconciler) reconcileOrphans() error {
+	for _, orphan := range reconciler.observed.orphans {
+		var err = reconciler.garbageCollectOrphan(orphan)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Deletes a child resource whose component has been removed from the spec of
+// the cluster, which is not garbage collected by its owner reference until the
+// cluster is deleted. Resources not controlled by the cluster are kept.
+func (reconciler *ClusterReconciler) garbageCollectOrphan(
+	obj runtime.Object) error {
+	var log = reconciler.log.WithValues("resource", getObjectDescription(obj))
+	var accessor, err = meta.Accessor(obj)
+	if err != nil {
+		return err
+	}
+	if !metav1.IsControlledBy(accessor, reconciler.observed.cluster) {
+		log.Info("Warning: orphaned resource is not controlled by the cluster, keep it")
+		return nil
+	}
+
+	log.Info("Deleting orphaned resource")
+	// Also delete the dependents, e.g., the pods of a job.
+	err = reconciler.k8sClient.Delete(
+		reconciler.context,
+		obj,
+		client.PropagationPolicy(metav1.DeletePropagationBackground))
+	err = client.IgnoreNotFound(err)
+	if err != nil {
+		log.Error(err, "Failed to delete orphaned resource")
+	} else {
+		log.Info("Orphaned resource deleted")
+	}
+	return err
+}
+
+func (reconciler *ClusterReconciler) reconcileConfigMap() error {
+	var desiredConfigMap = reconciler.desired.ConfigMap
+	var observedConfigMap = reconciler.observed.configMap
+
+	if desiredConfigMap != nil && observedConfigMap == nil {
+		if reconciler.isRecordedComponent(
+			"ConfigMap", desiredConfigMap.Name) {
+			reconciler.recordDriftCorrected(fmt.Sprintf(
+				"The ConfigMap %v is missing, recreating it",
+				desiredConfigMap.Name))
+		}
+		return reconciler.createConfigMap(desiredConfigMap, "ConfigMap")
+	}
+
+	if observedConfigMap != nil {
+		var owned, err = reconciler.verifyOwnerReference(
+			observedConfigMap, "ConfigMap")
+		if !owned || err != nil {
+			return err
+		}
+	}
+
+	if desiredConfigMap != nil && observedConfigMap != nil {
+		if !isLabelsSynced(observedConfigMap, desiredConfigMap) {
+			return reconciler.updateLabels(
+				observedConfigMap, desiredConfigMap, "ConfigMap")
+		}
+		reconciler.log.Info("ConfigMap already exists, no action")
+		return nil
+		// TODO: compare and update if needed.
+	}
+
+	if desiredConfigMap == nil && observedConfigMap != nil {
+		return reconciler.deleteConfigMap(observedConfigMap, "ConfigMap")
+	}
+
+	return nil
+}
+
+func (reconciler *ClusterReconciler) createConfigMap(
+	cm *corev1.ConfigMap, component string) error {
+	var context = reconciler.context
+	var log = reconciler.log.WithValues("component", component)
+	var k8sClient = reconciler.k8sClient
+
+	log.Info("Creating configMap", "configMap", *cm)
+	var err = k8sClient.Create(context, cm)
+	if err != nil {
+		log.Info("Failed to create configMap", "error", err)
+	} else {
+		log.Info("ConfigMap created")
+	}
+	return err
+}
+
+func (reconciler *ClusterReconciler) deleteConfigMap(
+	cm *corev1.ConfigMap, component string) error {
+	var context = reconciler.context
+	var log = reconciler.log.WithValues("component", component)
+	var k8sClient = reconciler.k8sClient
+
+	log.Info("Deleting configMap", "configMap", cm)
+	var err = k8sClient.Delete(context, cm)
+	err = client.IgnoreNotFound(err)
+	if err != nil {
+		log.Error(err, "Failed to delete configMap")
+	} else {
+		log.Info("ConfigMap deleted")
+	}
+	return err
+}
+
+// Creates the service account, role and role binding of the cluster pods if
+// needed. They are owned by the cluster, so they are garbage collected when
+// the cluster is deleted.
+func (reconciler *ClusterReconciler) reconcileServiceAccount() error {
+	var desired = reconciler.desired
+	var observed = reconciler.observed
+
+	if desired.ServiceAccount != nil && observed.serviceAccount == nil {
+		var err = reconciler.createObject(
+			desired.ServiceAccount, "ServiceAccount")
+		if err != nil {
+			return err
+		}
+	}
+
+	if desired.Role != nil && observed.role == nil {
+		var err = reconciler.createObject(desired.Role, "Role")
+		if err != nil {
+			return err
+		}
+	}
+
+	if desired.RoleBinding != nil && observed.roleBinding == nil {
+		var err = reconciler.createObject(desired.RoleBinding, "RoleBinding")
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Creates the PVC for checkpoints if needed. It is never deleted by the
+// operator.
+func (reconciler *ClusterReconciler) reconcileCheckpointPVC() error {
+	var desired = reconciler.desired
+	var observed = reconciler.observed
+
+	if desired.CheckpointPVC != nil && observed.checkpointPVC == nil {
+		return reconciler.createObject(desired.CheckpointPVC, "CheckpointPVC")
+	}
+	return nil
+}
+
+// Starts the collection of a diagnostics bundle when the cluster enters a
+// trigger state, and records the URI of the bundle. The finished collector job
+// is deleted after the cluster leaves the trigger state. The service account
+// of the collector is created in advance, so that its permissions are in
+// effect when the collection starts.
+func (reconciler *ClusterReconciler) reconcileDiagnosticsBundle() error {
+	var desired = reconciler.desired
+	var observed = reconciler.observed
+
+	if desired.DiagnosticsServiceAccount != nil && observed.diagnosticsSA == nil {
+		var err = reconciler.createObject(
+			desired.DiagnosticsServiceAccount, "DiagnosticsServiceAccount")
+		if err != nil {
+			return err
+		}
+	}
+	if desired.DiagnosticsRole != nil && observed.diagnosticsRole == nil {
+		var err = reconciler.createObject(
+			desired.DiagnosticsRole, "DiagnosticsRole")
+		if err != nil {
+			return err
+		}
+	}
+	if desired.DiagnosticsRoleBinding != nil &&
+		observed.diagnosticsRoleBinding == nil {
+		var err = reconciler.createObject(
+			desired.DiagnosticsRoleBinding, "DiagnosticsRoleBinding")
+		if err != nil {
+			return err
+		}
+	}
+
+	if desired.DiagnosticsJob != nil {
+		if observed.diagnosticsJob != nil {
+			return nil
+		}
+		var err = reconciler.createObject(
+			desired.DiagnosticsJob, "DiagnosticsJob")
+		if err != nil {
+			return err
+		}
+		var bundleURI = desired.DiagnosticsJob.Annotations[diagnosticsBundleURIAnnotation]
+		reconciler.recorder.Event(
+			observed.cluster,
+			"Normal",
+			"DiagnosticsBundle",
+			fmt.Sprintf("Collecting diagnostics bundle to %v", bundleURI))
+		var updated = observed.cluster.DeepCopy()
+		updated.Status.LastDiagnosticsBundleURI = bundleURI
+		setTimestamp(&updated.Status.LastUpdateTime)
+		err = reconciler.k8sClient.Status().Update(reconciler.context, updated)
+		if err != nil {
+			reconciler.log.Error(
+				err, "Failed to record the diagnostics bundle in the status")
+			return err
+		}
+		updated.Spec = observed.cluster.Spec
+		reconciler.observed.cluster = updated
+		return nil
 	}
 
-	if desiredJmService == nil && observedJmService != nil {
-		return reconciler.deleteService(observedJmService, "JobManager")
-		// TODO(dagang): compare and update if needed.
+	if observed.diagnosticsJob != nil && isJobFinished(observed.diagnosticsJob) {
+		var err = reconciler.k8sClient.Delete(
+			reconciler.context,
+			observed.diagnosticsJob,
+			client.PropagationPolicy(metav1.DeletePropagationBackground))
+		err = client.IgnoreNotFound(err)
+		if err != nil {
+			reconciler.log.Error(err, "Failed to delete diagnostics job")
+			return err
+		}
+		reconciler.log.Info("Diagnostics job deleted")
 	}
-
 	return nil
 }
 
-func (reconciler *ClusterReconciler) createService(
-	service *corev1.Service, component string) error {
-	var context = reconciler.context
-	var log = reconciler.log.WithValues("component", component)
-	var k8sClient = reconciler.k8sClient
+// Creates, updates or deletes the network policy of the cluster.
+func (reconciler *ClusterReconciler) reconcileNetworkPolicy() error {
+	var log = reconciler.log
+	var desired = reconciler.desired.NetworkPolicy
+	var observed = reconciler.observed.networkPolicy
 
-	log.Info("Creating service", "resource", *service)
-	var err = k8sClient.Create(context, service)
-	if err != nil {
-		log.Info("Failed to create service", "error", err)
-	} else {
-		log.Info("Service created")
+	if desired != nil && observed == nil {
+		return reconciler.createObject(desired, "NetworkPolicy")
 	}
-	return err
-}
-
-func (reconciler *ClusterReconciler) deleteService(
-	service *corev1.Service, component string) error {
-	var context = reconciler.context
-	var log = reconciler.log.WithValues("component", component)
-	var k8sClient = reconciler.k8sClient
 
-	log.Info("Deleting service", "service", service)
-	var err = k8sClient.Delete(context, service)
-	err = client.IgnoreNotFound(err)
-	if err != nil {
-		log.Error(err, "Failed to delete service")
-	} else {
-		log.Info("service deleted")
+	if observed != nil {
+		var owned, err = reconciler.verifyOwnerReference(
+			observed, "network policy")
+		if !owned || err != nil {
+			return err
+		}
 	}
-	return err
-}
 
-func (reconciler *ClusterReconciler) reconcileJobManagerIngress() error {
-	var desiredJmIngress = reconciler.desired.JmIngress
-	var observedJmIngress = reconciler.observed.jmIngress
-
-	if desiredJmIngress != nil && observedJmIngress == nil {
-		return reconciler.createIngress(desiredJmIngress, "JobManager")
+	if desired != nil && observed != nil {
+		if reflect.DeepEqual(observed.Spec, desired.Spec) &&
+			isLabelsSynced(observed, desired) {
+			log.Info("Network policy already exists, no action")
+			return nil
+		}
+		var updated = observed.DeepCopy()
+		updated.Spec = desired.Spec
+		updated.Labels, updated.Annotations = getSyncedLabels(observed, desired)
+		log.Info("Updating network policy", "networkPolicy", updated)
+		var err = reconciler.k8sClient.Update(reconciler.context, updated)
+		if err != nil {
+			log.Error(err, "Failed to update network policy")
+		}
+		return err
 	}
 
-	if desiredJmIngress != nil && observedJmIngress != nil {
-		reconciler.log.Info("JobManager ingress already exists, no action")
-		return nil
-		// TODO: compare and update if needed.
+	if desired == nil && observed != nil {
+		log.Info("Deleting network policy", "networkPolicy", observed)
+		var err = reconciler.k8sClient.Delete(reconciler.context, observed)
+		err = client.IgnoreNotFound(err)
+		if err != nil {
+			log.Error(err, "Failed to delete network policy")
+		}
+		return err
 	}
 
-	if desiredJmIngress == nil && observedJmIngress != nil {
-		return reconciler.deleteIngress(observedJmIngress, "JobManager")
+	return nil
+}
+
+// Creates or updates the Grafana dashboard ConfigMap of the cluster, and
+// deletes the dashboards of the cluster which are not desired, e.g., in the
+// previous namespace after the dashboard namespace changed.
+func (reconciler *ClusterReconciler) reconcileGrafanaDashboard() error {
+	var log = reconciler.log
+	var desired = reconciler.desired.GrafanaDashboard
+	var found = false
+
+	for i := range reconciler.observed.grafanaDashboards {
+		var observed = &reconciler.observed.grafanaDashboards[i]
+		if desired == nil || observed.Namespace != desired.Namespace ||
+			observed.Name != desired.Name {
+			log.Info(
+				"Deleting Grafana dashboard",
+				"namespace", observed.Namespace,
+				"name", observed.Name)
+			var err = reconciler.k8sClient.Delete(reconciler.context, observed)
+			err = client.IgnoreNotFound(err)
+			if err != nil {
+				log.Error(err, "Failed to delete Grafana dashboard")
+				return err
+			}
+			continue
+		}
+
+		found = true
+		if reflect.DeepEqual(observed.Data, desired.Data) &&
+			hasLabels(observed.Labels, desired.Labels) {
+			log.Info("Grafana dashboard already exists, no action")
+			continue
+		}
+		var updated = observed.DeepCopy()
+		updated.Data = desired.Data
+		updated.Labels = mergeLabels(observed.Labels, desired.Labels)
+		log.Info(
+			"Updating Grafana dashboard",
+			"namespace", updated.Namespace,
+			"name", updated.Name)
+		var err = reconciler.k8sClient.Update(reconciler.context, updated)
+		if err != nil {
+			log.Error(err, "Failed to update Grafana dashboard")
+			return err
+		}
 	}
 
+	if desired != nil && !found {
+		return reconciler.createObject(desired, "GrafanaDashboard")
+	}
 	return nil
 }
 
-func (reconciler *ClusterReconciler) createIngress(
-	ingress *extensionsv1beta1.Ingress, component string) error {
+func (reconciler *ClusterReconciler) createObject(
+	obj runtime.Object, component string) error {
 	var context = reconciler.context
 	var log = reconciler.log.WithValues("component", component)
 	var k8sClient = reconciler.k8sClient
 
-	log.Info("Creating ingress", "resource", *ingress)
-	var err = k8sClient.Create(context, ingress)
+	log.Info("Creating resource", "resource", obj)
+	var err = k8sClient.Create(context, obj)
 	if err != nil {
-		log.Info("Failed to create ingress", "error", err)
+		log.Info("Failed to create resource", "error", err)
 	} else {
-		log.Info("Ingress created")
+		log.Info("Resource created")
 	}
 	return err
 }
 
-func (reconciler *ClusterReconciler) deleteIngress(
-	ingress *extensionsv1beta1.Ingress, component string) error {
+// Syncs the labels of an existing resource with the desired ones, e.g., after
+// the inherited namespace labels changed.
+func (reconciler *ClusterReconciler) updateLabels(
+	obj runtime.Object, desired metav1.Object, component string) error {
 	var context = reconciler.context
 	var log = reconciler.log.WithValues("component", component)
 	var k8sClient = reconciler.k8sClient
 
-	log.Info("Deleting ingress", "ingress", ingress)
-	var err = k8sClient.Delete(context, ingress)
-	err = client.IgnoreNotFound(err)
+	var updated = obj.DeepCopyObject()
+	var objMeta, err = meta.Accessor(updated)
 	if err != nil {
-		log.Error(err, "Failed to delete ingress")
+		return err
+	}
+	var labels, annotations = getSyncedLabels(objMeta, desired)
+	objMeta.SetLabels(labels)
+	objMeta.SetAnnotations(annotations)
+	log.Info("Updating labels", "labels", objMeta.GetLabels())
+	err = k8sClient.Update(context, updated)
+	if err != nil {
+		log.Error(err, "Failed to update labels")
 	} else {
-		log.Info("Ingress deleted")
+		log.Info("Labels updated")
 	}
 	return err
 }
 
-func (reconciler *ClusterReconciler) reconcileConfigMap() error {
-	var desiredConfigMap = reconciler.desired.ConfigMap
-	var observedConfigMap = reconciler.observed.configMap
+func (reconciler *ClusterReconciler) reconcileTrafficSplitting() error {
+	var err = reconciler.reconcileVersionCluster(
+		"A", reconciler.desired.ClusterA, reconciler.observed.clusterA)
+	if err != nil {
+		return err
+	}
 
-	if desiredConfigMap != nil && observedConfigMap == nil {
-		return reconciler.createConfigMap(desiredConfigMap, "ConfigMap")
+	err = reconciler.reconcileVersionCluster(
+		"B", reconciler.desired.ClusterB, reconciler.observed.clusterB)
+	if err != nil {
+		return err
 	}
 
-	if desiredConfigMap != nil && observedConfigMap != nil {
-		reconciler.log.Info("ConfigMap already exists, no action")
+	return reconciler.reconcileVirtualService()
+}
+
+func (reconciler *ClusterReconciler) reconcileVersionCluster(
+	version string,
+	desiredCluster *v1beta1.FlinkCluster,
+	observedCluster *v1beta1.FlinkCluster) error {
+	var context = reconciler.context
+	var k8sClient = reconciler.k8sClient
+	var log = reconciler.log.WithValues(
+		"component", "VersionCluster", "version", version)
+
+	if desiredCluster != nil && observedCluster == nil {
+		log.Info("Creating cluster", "resource", *desiredCluster)
+		var err = k8sClient.Create(context, desiredCluster)
+		if err != nil {
+			log.Info("Failed to create cluster", "error", err)
+		} else {
+			log.Info("Cluster created")
+		}
+		return err
+	}
+
+	if desiredCluster != nil && observedCluster != nil {
+		log.Info("Cluster already exists, no action")
 		return nil
-		// TODO: compare and update if needed.
 	}
 
-	if desiredConfigMap == nil && observedConfigMap != nil {
-		return reconciler.deleteConfigMap(observedConfigMap, "ConfigMap")
+	if desiredCluster == nil && observedCluster != nil {
+		log.Info("Deleting cluster", "cluster", observedCluster)
+		var err = k8sClient.Delete(context, observedCluster)
+		err = client.IgnoreNotFound(err)
+		if err != nil {
+			log.Error(err, "Failed to delete cluster")
+		} else {
+			log.Info("Cluster deleted")
+		}
+		return err
 	}
 
 	return nil
 }
 
-func (reconciler *ClusterReconciler) createConfigMap(
-	cm *corev1.ConfigMap, component string) error {
+func (reconciler *ClusterReconciler) reconcileVirtualService() error {
 	var context = reconciler.context
-	var log = reconciler.log.WithValues("component", component)
+	var log = reconciler.log.WithValues("component", "VirtualService")
 	var k8sClient = reconciler.k8sClient
+	var desiredVirtualService = reconciler.desired.VirtualService
+	var observedVirtualService = reconciler.observed.virtualService
 
-	log.Info("Creating configMap", "configMap", *cm)
-	var err = k8sClient.Create(context, cm)
-	if err != nil {
-		log.Info("Failed to create configMap", "error", err)
-	} else {
-		log.Info("ConfigMap created")
+	if desiredVirtualService != nil && observedVirtualService == nil {
+		log.Info("Creating VirtualService", "resource", *desiredVirtualService)
+		var err = k8sClient.Create(context, desiredVirtualService)
+		if err != nil {
+			log.Info("Failed to create VirtualService", "error", err)
+		} else {
+			log.Info("VirtualService created")
+		}
+		return err
 	}
-	return err
-}
 
-func (reconciler *ClusterReconciler) deleteConfigMap(
-	cm *corev1.ConfigMap, component string) error {
-	var context = reconciler.context
-	var log = reconciler.log.WithValues("component", component)
-	var k8sClient = reconciler.k8sClient
+	if desiredVirtualService != nil && observedVirtualService != nil {
+		log.Info("VirtualService already exists, no action")
+		return nil
+		// TODO: compare and update if needed.
+	}
 
-	log.Info("Deleting configMap", "configMap", cm)
-	var err = k8sClient.Delete(context, cm)
-	err = client.IgnoreNotFound(err)
-	if err != nil {
-		log.Error(err, "Failed to delete configMap")
-	} else {
-		log.Info("ConfigMap deleted")
+	if desiredVirtualService == nil && observedVirtualService != nil {
+		log.Info("Deleting VirtualService", "VirtualService", observedVirtualService)
+		var err = k8sClient.Delete(context, observedVirtualService)
+		err = client.IgnoreNotFound(err)
+		if err != nil {
+			log.Error(err, "Failed to delete VirtualService")
+		} else {
+			log.Info("VirtualService deleted")
+		}
+		return err
 	}
-	return err
+
+	return nil
 }
 
 func (reconciler *ClusterReconciler) reconcileJob() (ctrl.Result, error) {
@@ -342,12 +1724,26 @@ func (reconciler *ClusterReconciler) reconcileJob() (ctrl.Result, error) {
 	var observedJob = observed.job
 	var err error
 
+	if isStreamGraphJob(observed.cluster) {
+		return reconciler.reconcileStreamGraphJob()
+	}
+	if isRESTSubmittedJob(observed.cluster) {
+		return reconciler.reconcileRESTSubmittedJob()
+	}
+
+	// Rescale
+	if desiredJob != nil &&
+		isJobRescaling(observed.cluster.Status.Components.Job) {
+		return reconciler.reconcileRescale()
+	}
+
 	// Create
 	if desiredJob != nil && observedJob == nil {
 		// If the observed Flink job status list is not nil (e.g., emtpy list),
 		// it means Flink REST API server is up and running. It is the source of
-		// truth of whether we can submit a job.
-		if observed.flinkJobList == nil {
+		// truth of whether we can submit a job. In native mode, the API server
+		// is deployed by the job submitter.
+		if observed.flinkJobList == nil && !isNativeMode(observed.cluster) {
 			log.Info("Waiting for Flink API server to be ready")
 			return requeueResult, nil
 		}
@@ -365,10 +1761,22 @@ func (reconciler *ClusterReconciler) reconcileJob() (ctrl.Result, error) {
 	// Update or restart
 	var jobID = reconciler.getFlinkJobID()
 	if desiredJob != nil && observedJob != nil {
-		var restartPolicy = observed.cluster.Spec.Job.RestartPolicy
+		var jobSpec = observed.cluster.Spec.Job
 		var observedJobStatus = observed.cluster.Status.Components.Job
 
-		if shouldRestartJob(restartPolicy, observedJobStatus) {
+		if shouldRestartJob(jobSpec, observedJobStatus) {
+			if len(observedJobStatus.NextRestartTime) > 0 {
+				var tc = &TimeConverter{}
+				var nextTime = tc.FromString(observedJobStatus.NextRestartTime)
+				var delay = time.Until(nextTime)
+				if delay > 0 {
+					log.Info(
+						"Waiting to restart failed job",
+						"restartCount", observedJobStatus.RestartCount,
+						"nextRestartTime", observedJobStatus.NextRestartTime)
+					return ctrl.Result{RequeueAfter: delay}, nil
+				}
+			}
 			var err = reconciler.restartJob()
 			if err != nil {
 				return requeueResult, err
@@ -376,6 +1784,21 @@ func (reconciler *ClusterReconciler) reconcileJob() (ctrl.Result, error) {
 			return ctrl.Result{}, nil
 		}
 
+		// The submission has finished, the submitter must not be terminated
+		// by the deadline while it stays attached to the running job.
+		if observedJob.Spec.ActiveDeadlineSeconds != nil &&
+			isJobRunning(observedJobStatus) {
+			var err = reconciler.clearSubmitJobDeadline(observedJob)
+			if err != nil {
+				return requeueResult, err
+			}
+		}
+
+		if len(jobID) > 0 && isRescaleRequired(observed.cluster, observedJob) {
+			var err = reconciler.startRescale(jobID)
+			return requeueResult, err
+		}
+
 		if len(jobID) > 0 && reconciler.shouldTakeSavepoint(jobID) {
 			reconciler.takeSavepoint(jobID)
 		}
@@ -406,6 +1829,267 @@ func (reconciler *ClusterReconciler) reconcileJob() (ctrl.Result, error) {
 	return ctrl.Result{}, nil
 }
 
+// Removes the submission deadline from the job submitter.
+func (reconciler *ClusterReconciler) clearSubmitJobDeadline(
+	job *batchv1.Job) error {
+	var log = reconciler.log
+	var owned, err = reconciler.verifyOwnerReference(job, "job submitter")
+	if !owned || err != nil {
+		return err
+	}
+	var updated = job.DeepCopy()
+	updated.Spec.ActiveDeadlineSeconds = nil
+
+	log.Info("Clearing the submission deadline of the job submitter")
+	err = reconciler.k8sClient.Update(reconciler.context, updated)
+	if err != nil {
+		log.Error(err, "Failed to clear the submission deadline")
+	}
+	return err
+}
+
+// Submits the stream graph of the job once, instead of creating the job
+// submitter.
+func (reconciler *ClusterReconciler) reconcileStreamGraphJob() (
+	ctrl.Result, error) {
+	var log = reconciler.log
+	var observed = reconciler.observed
+
+	if observed.cluster.Status.Components.Job != nil {
+		log.Info("Stream graph has been submitted, no action")
+		return ctrl.Result{}, nil
+	}
+	if observed.flinkJobList == nil {
+		log.Info("Waiting for Flink API server to be ready")
+		return requeueResult, nil
+	}
+	var err = reconciler.submitStreamGraph(
+		getFlinkAPIBaseURL(observed.cluster))
+	return requeueResult, err
+}
+
+func (reconciler *ClusterReconciler) submitStreamGraph(
+	apiBaseURL string) error {
+	var log = reconciler.log
+	var cluster = reconciler.observed.cluster
+	var jobSpec = cluster.Spec.Job
+	var jarName = path.Base(jobSpec.JarFile)
+
+	var jarID, err = reconciler.flinkClient.GetJarID(apiBaseURL, jarName)
+	if err != nil {
+		log.Error(err, "Failed to get the uploaded JAR files")
+		return err
+	}
+	if len(jarID) == 0 {
+		return fmt.Errorf("JAR file %v has not been uploaded", jarName)
+	}
+
+	log.Info("Submitting stream graph", "jarID", jarID)
+	resp, err := reconciler.flinkClient.SubmitStreamGraph(
+		apiBaseURL, jarID, jobSpec.StreamGraphJSON)
+	if err != nil {
+		log.Error(err, "Failed to submit stream graph", "jarID", jarID)
+		return err
+	}
+	log.Info("Stream graph submitted", "jarID", jarID, "jobID", resp.JobID)
+
+	// Record the submitted job, its status is observed from Flink afterwards.
+	var updated = cluster.DeepCopy()
+	updated.Status.Components.Job = &v1beta1.JobStatus{
+		ID:    resp.JobID,
+		State: v1beta1.JobStatePending,
+	}
+	setTimestamp(&updated.Status.LastUpdateTime)
+	return reconciler.k8sClient.Status().Update(reconciler.context, updated)
+}
+
+// Submits the job through the REST API of the JobManager instead of creating
+// the job submitter. A failed attempt is retried with exponential backoff in
+// the following reconciles, until the JobManager accepts the job or the
+// deadline of the submission passes.
+func (reconciler *ClusterReconciler) reconcileRESTSubmittedJob() (
+	ctrl.Result, error) {
+	var log = reconciler.log
+	var observed = reconciler.observed
+	var jobStatus = observed.cluster.Status.Components.Job
+
+	if jobStatus != nil && jobStatus.State != v1beta1.JobStateDeploying {
+		log.Info("Job has been submitted, no action")
+		return ctrl.Result{}, nil
+	}
+	if jobStatus == nil &&
+		observed.cluster.Status.State != v1beta1.ClusterStateRunning {
+		log.Info("Waiting for the cluster to be running to submit job")
+		return requeueResult, nil
+	}
+	var now = time.Now()
+	if jobStatus != nil && len(jobStatus.NextSubmissionTime) > 0 {
+		var tc = &TimeConverter{}
+		var delay = tc.FromString(jobStatus.NextSubmissionTime).Sub(now)
+		if delay > 0 {
+			log.Info(
+				"Waiting to retry job submission",
+				"attempts", jobStatus.SubmissionAttempts,
+				"nextSubmissionTime", jobStatus.NextSubmissionTime)
+			return ctrl.Result{RequeueAfter: delay}, nil
+		}
+	}
+	var err = reconciler.submitJob(getFlinkAPIBaseURL(observed.cluster), now)
+	return requeueResult, err
+}
+
+// Makes an attempt to submit the job, and records it in the job status. The
+// job is Deploying until the JobManager accepts it, and Failed when the next
+// attempt would be after the deadline.
+func (reconciler *ClusterReconciler) submitJob(
+	apiBaseURL string, now time.Time) error {
+	var log = reconciler.log
+	var observed = reconciler.observed
+	var cluster = observed.cluster
+	var retry = cluster.Spec.Job.SubmissionRetry
+	var tc = &TimeConverter{}
+
+	var updated = cluster.DeepCopy()
+	var jobStatus = updated.Status.Components.Job
+	if jobStatus == nil {
+		jobStatus = &v1beta1.JobStatus{
+			State:               v1beta1.JobStateDeploying,
+			FirstSubmissionTime: tc.ToString(now),
+		}
+		updated.Status.Components.Job = jobStatus
+	}
+	// The ID is generated before the first attempt and submitted with every
+	// attempt, so that an accepted attempt whose response was lost is found
+	// in the Flink job list instead of being submitted again.
+	if len(jobStatus.ID) == 0 {
+		var id, err = newFlinkJobID()
+		if err != nil {
+			return err
+		}
+		jobStatus.ID = id
+	}
+	var jobID = jobStatus.ID
+	var err error
+	if hasFlinkJob(observed.flinkJobList, jobID) {
+		log.Info("Found job submitted by a previous attempt", "jobID", jobID)
+	} else {
+		jobID, err = reconciler.runJar(apiBaseURL, jobID)
+		jobStatus.SubmissionAttempts++
+	}
+
+	if err == nil {
+		log.Info(
+			"Job submitted",
+			"jobID", jobID,
+			"attempts", jobStatus.SubmissionAttempts)
+		jobStatus.ID = jobID
+		jobStatus.State = v1beta1.JobStatePending
+		jobStatus.NextSubmissionTime = ""
+	} else {
+		var deadline = tc.FromString(jobStatus.FirstSubmissionTime).Add(
+			time.Duration(retry.DeadlineSeconds) * time.Second)
+		var nextTime = now.Add(
+			getSubmissionRetryDelay(retry, jobStatus.SubmissionAttempts))
+		if nextTime.Before(deadline) {
+			log.Info(
+				"Failed to submit job, will retry",
+				"attempts", jobStatus.SubmissionAttempts,
+				"nextSubmissionTime", tc.ToString(nextTime),
+				"error", err)
+			jobStatus.NextSubmissionTime = tc.ToString(nextTime)
+		} else {
+			jobStatus.State = v1beta1.JobStateFailed
+			jobStatus.Reason = v1beta1.ComponentReasonSubmissionFailed
+			jobStatus.FailureReason = fmt.Sprintf(
+				"job submission failed after %v attempts within %vs: %v",
+				jobStatus.SubmissionAttempts, retry.DeadlineSeconds, err)
+			jobStatus.NextSubmissionTime = ""
+			log.Info(
+				"Failed to submit job, giving up",
+				"attempts", jobStatus.SubmissionAttempts,
+				"error", err)
+			reconciler.recorder.Event(
+				cluster,
+				"Warning",
+				v1beta1.ComponentReasonSubmissionFailed,
+				jobStatus.FailureReason)
+		}
+	}
+	setTimestamp(&updated.Status.LastUpdateTime)
+	return reconciler.k8sClient.Status().Update(reconciler.context, updated)
+}
+
+// Runs the JAR file of the job with the job ID, uploading it first if it has
+// not been uploaded, and returns the ID of the submitted job.
+func (reconciler *ClusterReconciler) runJar(
+	apiBaseURL string, jobID string) (string, error) {
+	var log = reconciler.log
+	var jobSpec = reconciler.observed.cluster.Spec.Job
+	var jarName = path.Base(jobSpec.JarFile)
+
+	var jarID, err = reconciler.flinkClient.GetJarID(apiBaseURL, jarName)
+	if err != nil {
+		return "", err
+	}
+	if len(jarID) == 0 {
+		jarID, err = reconciler.uploadJar(apiBaseURL, jarName)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	var request = flinkclient.JarRunRequest{
+		ProgramArgsList: jobSpec.Args,
+		Parallelism:     jobSpec.Parallelism,
+		JobID:           jobID,
+	}
+	if jobSpec.ClassName != nil {
+		request.EntryClass = *jobSpec.ClassName
+	}
+	if jobSpec.FromSavepoint != nil {
+		request.SavepointPath = *jobSpec.FromSavepoint
+	}
+	if jobSpec.AllowNonRestoredState != nil {
+		request.AllowNonRestoredState = *jobSpec.AllowNonRestoredState
+	}
+	log.Info("Running JAR", "jarID", jarID, "jobID", jobID)
+	var resp flinkclient.JarRunResponse
+	resp, err = reconciler.flinkClient.RunJar(apiBaseURL, jarID, request)
+	if err != nil {
+		return "", err
+	}
+	if len(resp.JobID) > 0 {
+		jobID = resp.JobID
+	}
+	return jobID, nil
+}
+
+// Uploads the JAR file of the job to the JobManager from its HTTP(S)
+// `jarURI`, and returns the ID of the uploaded JAR file. The JAR file in the
+// image or at another URI must have been uploaded by the user.
+func (reconciler *ClusterReconciler) uploadJar(
+	apiBaseURL string, jarName string) (string, error) {
+	var log = reconciler.log
+	var jarURI = reconciler.observed.cluster.Spec.Job.JarURI
+	if !strings.HasPrefix(jarURI, "http://") &&
+		!strings.HasPrefix(jarURI, "https://") {
+		return "", fmt.Errorf("JAR file %v has not been uploaded", jarName)
+	}
+
+	log.Info("Uploading JAR", "jarURI", jarURI)
+	var httpClient = &http.Client{Timeout: jarDownloadTimeout}
+	var resp, err = httpClient.Get(jarURI)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf(
+			"failed to download JAR file from %v: %v", jarURI, resp.Status)
+	}
+	return reconciler.flinkClient.UploadJar(apiBaseURL, jarName, resp.Body)
+}
+
 func (reconciler *ClusterReconciler) createJob(job *batchv1.Job) error {
 	var context = reconciler.context
 	var log = reconciler.log
@@ -450,7 +2134,8 @@ func (reconciler *ClusterReconciler) isJobStopped() bool {
 	return jobStatus != nil &&
 		(jobStatus.State == v1beta1.JobStateSucceeded ||
 			jobStatus.State == v1beta1.JobStateFailed ||
-			jobStatus.State == v1beta1.JobStateCancelled)
+			jobStatus.State == v1beta1.JobStateCancelled ||
+			jobStatus.State == v1beta1.JobStateSubmitTimeout)
 }
 
 func (reconciler *ClusterReconciler) restartJob() error {
@@ -557,6 +2242,23 @@ func (reconciler *ClusterReconciler) canTakeSavepoint() bool {
 		!reconciler.isJobStopped()
 }
 
+// Takes a savepoint of the running job before the cluster is suspended, i.e.,
+// while the JobManager deployment has not been scaled down yet.
+func (reconciler *ClusterReconciler) takeSavepointBeforeSuspension() error {
+	var log = reconciler.log
+	var jmDeployment = reconciler.observed.jmDeployment
+	var jobStatus = reconciler.observed.cluster.Status.Components.Job
+	var jobID = reconciler.getFlinkJobID()
+
+	if jmDeployment == nil || isReplicasEqual(jmDeployment.Spec.Replicas, nil) ||
+		!isJobRunning(jobStatus) || len(jobID) == 0 || !reconciler.canTakeSavepoint() {
+		return nil
+	}
+
+	log.Info("Taking savepoint before suspending the cluster", "jobID", jobID)
+	return reconciler.takeSavepoint(jobID)
+}
+
 // Takes savepoint for a job then update job status with the info.
 func (reconciler *ClusterReconciler) takeSavepoint(
 	jobID string) error {
@@ -0,0 +1,1400 @@
+/*
+Copyright 2019 Google LLC.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	v1beta1 "github.com/googlecloudplatform/flink-operator/api/v1beta1"
+	"github.com/googlecloudplatform/flink-operator/controllers/flinkclient"
+	"gotest.tools/assert"
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+func TestReconcileDeploymentWithInheritedLabels(t *testing.T) {
+	var cluster = getTestSessionCluster()
+	cluster.Spec.InheritNamespaceLabels = []string{"team"}
+	var namespace = corev1.Namespace{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:   "default",
+			Labels: map[string]string{"team": "data"},
+		},
+	}
+	var k8sClient = fake.NewFakeClientWithScheme(scheme.Scheme)
+	var reconciler = ClusterReconciler{
+		k8sClient: k8sClient,
+		context:   context.Background(),
+		log:       log.Log,
+	}
+	var getDesired = func() *appsv1.Deployment {
+		var desired = getDesiredClusterState(cluster, time.Now())
+		addInheritedLabels(
+			&desired, getInheritedLabels(cluster, &namespace))
+		return desired.TmDeployment
+	}
+	var getObserved = func() *appsv1.Deployment {
+		var deployment = &appsv1.Deployment{}
+		var err = k8sClient.Get(
+			context.Background(),
+			types.NamespacedName{
+				Namespace: "default",
+				Name:      "flinksessioncluster-sample-taskmanager",
+			},
+			deployment)
+		assert.NilError(t, err)
+		return deployment
+	}
+
+	// The labels are added on creation.
+	var err = reconciler.reconcileDeployment("TaskManager", getDesired(), nil)
+	assert.NilError(t, err)
+	var observed = getObserved()
+	assert.Equal(t, observed.Labels["team"], "data")
+	assert.Equal(t, observed.Spec.Template.Labels["team"], "data")
+
+	// The labels are updated when the namespace labels change.
+	namespace.Labels["team"] = "analytics"
+	err = reconciler.reconcileDeployment("TaskManager", getDesired(), observed)
+	assert.NilError(t, err)
+	observed = getObserved()
+	assert.Equal(t, observed.Labels["team"], "analytics")
+	assert.Equal(t, observed.Labels["app"], "flink")
+	assert.Equal(t, observed.Annotations[inheritedLabelsAnnotation], "team")
+}
+
+func TestReconcileConfigMapWithRemovedInheritedLabels(t *testing.T) {
+	var cluster = getTestSessionCluster()
+	cluster.Spec.InheritNamespaceLabels = []string{"team"}
+	var desired = getDesiredClusterState(cluster, time.Now())
+	addInheritedLabels(&desired, map[string]string{"team": "data"})
+	var observed = desired.ConfigMap.DeepCopy()
+	observed.Labels["owner"] = "alice"
+	var k8sClient = fake.NewFakeClientWithScheme(scheme.Scheme, observed)
+	var reconciler = ClusterReconciler{
+		k8sClient: k8sClient,
+		context:   context.Background(),
+		log:       log.Log,
+		observed:  ObservedClusterState{configMap: observed},
+		desired:   getDesiredClusterState(cluster, time.Now()),
+	}
+
+	// The label is removed from the namespace, the labels added outside of
+	// the operator are kept.
+	assert.NilError(t, reconciler.reconcileConfigMap())
+	var updated = &corev1.ConfigMap{}
+	var err = k8sClient.Get(
+		context.Background(),
+		types.NamespacedName{Namespace: observed.Namespace, Name: observed.Name},
+		updated)
+	assert.NilError(t, err)
+	var _, ok = updated.Labels["team"]
+	assert.Assert(t, !ok)
+	_, ok = updated.Annotations[inheritedLabelsAnnotation]
+	assert.Assert(t, !ok)
+	assert.Equal(t, updated.Labels["owner"], "alice")
+	assert.Equal(t, updated.Labels["app"], "flink")
+}
+
+func TestReconcileDeploymentWithMissingPriorityClass(t *testing.T) {
+	var cluster = getTestSessionCluster()
+	cluster.Spec.TaskManager.PriorityClassName = "high-priority"
+	var k8sClient = fake.NewFakeClientWithScheme(scheme.Scheme)
+	var recorder = record.NewFakeRecorder(10)
+	var reconciler = ClusterReconciler{
+		k8sClient: k8sClient,
+		context:   context.Background(),
+		log:       log.Log,
+		recorder:  recorder,
+		observed: ObservedClusterState{
+			cluster:                cluster,
+			missingPriorityClasses: []string{"high-priority"},
+		},
+	}
+	var desired = getDesiredClusterState(cluster, time.Now())
+	assert.Equal(
+		t,
+		desired.TmDeployment.Spec.Template.Spec.PriorityClassName,
+		"high-priority")
+
+	// The deployment is not created until the priority class exists.
+	var err = reconciler.reconcileDeployment(
+		"TaskManager", desired.TmDeployment, nil)
+	assert.NilError(t, err)
+	var deployments = &appsv1.DeploymentList{}
+	err = k8sClient.List(context.Background(), deployments)
+	assert.NilError(t, err)
+	assert.Equal(t, len(deployments.Items), 0)
+	assert.Equal(t, len(recorder.Events), 0)
+
+	reconciler.observed.missingPriorityClasses = nil
+	err = reconciler.reconcileDeployment(
+		"TaskManager", desired.TmDeployment, nil)
+	assert.NilError(t, err)
+	err = k8sClient.List(context.Background(), deployments)
+	assert.NilError(t, err)
+	assert.Equal(t, len(deployments.Items), 1)
+}
+
+func TestCheckPriorityClasses(t *testing.T) {
+	var cluster = getTestSessionCluster()
+	var testScheme = runtime.NewScheme()
+	assert.NilError(t, scheme.AddToScheme(testScheme))
+	assert.NilError(t, v1beta1.AddToScheme(testScheme))
+	var k8sClient = fake.NewFakeClientWithScheme(testScheme, cluster)
+	var recorder = record.NewFakeRecorder(10)
+	var reconciler = ClusterReconciler{
+		k8sClient: k8sClient,
+		context:   context.Background(),
+		log:       log.Log,
+		recorder:  recorder,
+		observed: ObservedClusterState{
+			cluster:                cluster,
+			missingPriorityClasses: []string{"high-priority"},
+		},
+	}
+	var getCurrentCondition = func() *v1beta1.FlinkClusterCondition {
+		return getCondition(
+			reconciler.observed.cluster.Status.Conditions,
+			v1beta1.ClusterConditionPriorityClassNotFound)
+	}
+
+	// The warning is emitted when the condition becomes True.
+	assert.NilError(t, reconciler.checkPriorityClasses())
+	assert.Equal(t, getCurrentCondition().Status, corev1.ConditionTrue)
+	assert.Equal(
+		t,
+		<-recorder.Events,
+		"Warning PriorityClassNotFound Priority classes high-priority do not "+
+			"exist, waiting to create the pods using them")
+
+	// But not again while the same priority classes are missing.
+	assert.NilError(t, reconciler.checkPriorityClasses())
+	assert.Equal(t, len(recorder.Events), 0)
+
+	reconciler.observed.missingPriorityClasses = nil
+	assert.NilError(t, reconciler.checkPriorityClasses())
+	assert.Equal(t, getCurrentCondition().Status, corev1.ConditionFalse)
+	assert.Equal(t, len(recorder.Events), 0)
+}
+
+func TestReconcileDeploymentWithFlinkConfigChecksum(t *testing.T) {
+	var cluster = getTestSessionCluster()
+	cluster.Spec.FlinkConfigMap = "my-flink-config"
+	var configMap = &corev1.ConfigMap{
+		Data: map[string]string{"flink-conf.yaml": "parallelism.default: 1\n"},
+	}
+	var k8sClient = fake.NewFakeClientWithScheme(scheme.Scheme)
+	var reconciler = ClusterReconciler{
+		k8sClient: k8sClient,
+		context:   context.Background(),
+		log:       log.Log,
+	}
+	var getDesired = func() *appsv1.Deployment {
+		var desired = getDesiredClusterState(cluster, time.Now())
+		addFlinkConfigChecksum(&desired, configMap)
+		return desired.TmDeployment
+	}
+	var getObserved = func() *appsv1.Deployment {
+		var deployment = &appsv1.Deployment{}
+		var err = k8sClient.Get(
+			context.Background(),
+			types.NamespacedName{
+				Namespace: "default",
+				Name:      "flinksessioncluster-sample-taskmanager",
+			},
+			deployment)
+		assert.NilError(t, err)
+		return deployment
+	}
+
+	var err = reconciler.reconcileDeployment("TaskManager", getDesired(), nil)
+	assert.NilError(t, err)
+	var observed = getObserved()
+	var checksum = getFlinkConfigChecksum(observed)
+	assert.Equal(t, checksum, getConfigMapChecksum(configMap))
+
+	// The pods are restarted when the config changes.
+	configMap.Data["flink-conf.yaml"] = "parallelism.default: 2\n"
+	err = reconciler.reconcileDeployment("TaskManager", getDesired(), observed)
+	assert.NilError(t, err)
+	observed = getObserved()
+	assert.Assert(t, getFlinkConfigChecksum(observed) != checksum)
+	assert.Equal(
+		t, getFlinkConfigChecksum(observed), getConfigMapChecksum(configMap))
+}
+
+func TestReconcileDeploymentWithRestartedAt(t *testing.T) {
+	var cluster = getTestSessionCluster()
+	var k8sClient = fake.NewFakeClientWithScheme(scheme.Scheme)
+	var reconciler = ClusterReconciler{
+		k8sClient: k8sClient,
+		context:   context.Background(),
+		log:       log.Log,
+	}
+	var getDesired = func() *appsv1.Deployment {
+		var desired = getDesiredClusterState(cluster, time.Now())
+		addRestartedAt(&desired, cluster)
+		return desired.JmDeployment
+	}
+	var getObserved = func() *appsv1.Deployment {
+		var deployment = &appsv1.Deployment{}
+		var err = k8sClient.Get(
+			context.Background(),
+			types.NamespacedName{
+				Namespace: "default",
+				Name:      "flinksessioncluster-sample-jobmanager",
+			},
+			deployment)
+		assert.NilError(t, err)
+		return deployment
+	}
+	var getRestartedAt = func() string {
+		return getObserved().Spec.Template.Annotations[restartedAtAnnotation]
+	}
+
+	var err = reconciler.reconcileDeployment("JobManager", getDesired(), nil)
+	assert.NilError(t, err)
+	assert.Equal(t, getRestartedAt(), "")
+
+	// The pods are restarted when the annotation is set.
+	cluster.Annotations = map[string]string{
+		restartedAtAnnotation: "2020-01-01T00:00:00Z",
+	}
+	err = reconciler.reconcileDeployment(
+		"JobManager", getDesired(), getObserved())
+	assert.NilError(t, err)
+	assert.Equal(t, getRestartedAt(), "2020-01-01T00:00:00Z")
+
+	// And when its value changes.
+	cluster.Annotations[restartedAtAnnotation] = "2020-01-02T00:00:00Z"
+	err = reconciler.reconcileDeployment(
+		"JobManager", getDesired(), getObserved())
+	assert.NilError(t, err)
+	assert.Equal(t, getRestartedAt(), "2020-01-02T00:00:00Z")
+
+	// Removing the annotation doesn't restart the pods.
+	delete(cluster.Annotations, restartedAtAnnotation)
+	err = reconciler.reconcileDeployment(
+		"JobManager", getDesired(), getObserved())
+	assert.NilError(t, err)
+	assert.Equal(t, getRestartedAt(), "2020-01-02T00:00:00Z")
+}
+
+// Records the data of each patch, including the status patches, before
+// sending it.
+type patchSpyClient struct {
+	client.Client
+	patches []string
+}
+
+func (c *patchSpyClient) Patch(
+	ctx context.Context,
+	obj runtime.Object,
+	patch client.Patch,
+	opts ...client.PatchOption) error {
+	var data, err = patch.Data(obj)
+	if err != nil {
+		return err
+	}
+	c.patches = append(c.patches, string(data))
+	return c.Client.Patch(ctx, obj, patch, opts...)
+}
+
+func (c *patchSpyClient) Status() client.StatusWriter {
+	return &patchSpyStatusWriter{StatusWriter: c.Client.Status(), spy: c}
+}
+
+type patchSpyStatusWriter struct {
+	client.StatusWriter
+	spy *patchSpyClient
+}
+
+func (w *patchSpyStatusWriter) Patch(
+	ctx context.Context,
+	obj runtime.Object,
+	patch client.Patch,
+	opts ...client.PatchOption) error {
+	var data, err = patch.Data(obj)
+	if err != nil {
+		return err
+	}
+	w.spy.patches = append(w.spy.patches, string(data))
+	return w.StatusWriter.Patch(ctx, obj, patch, opts...)
+}
+
+func TestReconcileDeploymentPatchesChangedFields(t *testing.T) {
+	var cluster = getTestSessionCluster()
+	var k8sClient = &patchSpyClient{
+		Client: fake.NewFakeClientWithScheme(scheme.Scheme),
+	}
+	var reconciler = ClusterReconciler{
+		k8sClient: k8sClient,
+		context:   context.Background(),
+		log:       log.Log,
+	}
+	var getObserved = func() *appsv1.Deployment {
+		var deployment = &appsv1.Deployment{}
+		var err = k8sClient.Get(
+			context.Background(),
+			types.NamespacedName{
+				Namespace: "default",
+				Name:      "flinksessioncluster-sample-taskmanager",
+			},
+			deployment)
+		assert.NilError(t, err)
+		return deployment
+	}
+
+	var err = reconciler.reconcileDeployment(
+		"TaskManager", getDesiredClusterState(cluster, time.Now()).TmDeployment, nil)
+	assert.NilError(t, err)
+	assert.Equal(t, len(k8sClient.patches), 0)
+
+	// Only the replicas and the applied replicas are sent.
+	cluster.Spec.TaskManager.Replicas = 3
+	err = reconciler.reconcileDeployment(
+		"TaskManager",
+		getDesiredClusterState(cluster, time.Now()).TmDeployment,
+		getObserved())
+	assert.NilError(t, err)
+	assert.DeepEqual(
+		t,
+		k8sClient.patches,
+		[]string{
+			`{"metadata":{"annotations":{"flinkoperator.k8s.io/applied-replicas":"3"}},` +
+				`"spec":{"replicas":3}}`,
+		})
+	assert.Equal(t, *getObserved().Spec.Replicas, int32(3))
+	assert.Equal(t, getObserved().Labels["app"], "flink")
+}
+
+func TestReconcileTaskManagerDeploymentDrainsTaskManagers(t *testing.T) {
+	var cluster = getTestSessionCluster()
+	cluster.Spec.FlinkVersion = "1.12"
+	cluster.Spec.TaskManager.Replicas = 1
+	var k8sClient = fake.NewFakeClientWithScheme(scheme.Scheme)
+	var tmDeployment = getDesiredClusterState(cluster, time.Now()).TmDeployment
+	var replicas int32 = 2
+	tmDeployment.Spec.Replicas = &replicas
+	assert.NilError(t, k8sClient.Create(context.Background(), tmDeployment))
+	var tmPods = []corev1.Pod{}
+	for name, ip := range map[string]string{"a": "10.8.0.5", "b": "10.8.0.6"} {
+		var pod = corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace: "default",
+				Name:      "flinksessioncluster-sample-taskmanager-" + name,
+			},
+			Status: corev1.PodStatus{PodIP: ip},
+		}
+		assert.NilError(t, k8sClient.Create(context.Background(), &pod))
+		tmPods = append(tmPods, pod)
+	}
+	var taskManagers = &flinkclient.TaskManagerList{
+		TaskManagers: []flinkclient.TaskManagerInfo{
+			{
+				ID:          "flinksessioncluster-sample-taskmanager-a",
+				Path:        "akka.tcp://flink@10.8.0.5:6122/user/rpc/taskmanager_0",
+				SlotsNumber: 2,
+				FreeSlots:   1,
+			},
+			{
+				ID:          "flinksessioncluster-sample-taskmanager-b",
+				Path:        "akka.tcp://flink@10.8.0.6:6122/user/rpc/taskmanager_0",
+				SlotsNumber: 2,
+				FreeSlots:   0,
+			},
+		},
+	}
+	var reconciler = ClusterReconciler{
+		k8sClient: k8sClient,
+		context:   context.Background(),
+		log:       log.Log,
+		desired:   getDesiredClusterState(cluster, time.Now()),
+		observed: ObservedClusterState{
+			cluster:           cluster,
+			tmDeployment:      tmDeployment,
+			tmPods:            tmPods,
+			flinkTaskManagers: taskManagers,
+		},
+	}
+	var getObservedReplicas = func() int32 {
+		var deployment = &appsv1.Deployment{}
+		var err = k8sClient.Get(
+			context.Background(),
+			types.NamespacedName{
+				Namespace: "default",
+				Name:      "flinksessioncluster-sample-taskmanager",
+			},
+			deployment)
+		assert.NilError(t, err)
+		return *deployment.Spec.Replicas
+	}
+	var pods = &corev1.PodList{}
+
+	// The replicas are kept while no TaskManager is idle.
+	assert.NilError(t, reconciler.reconcileTaskManagerDeployment())
+	assert.Equal(t, getObservedReplicas(), int32(2))
+	assert.NilError(t, k8sClient.List(context.Background(), pods))
+	assert.Equal(t, len(pods.Items), 2)
+
+	// The idle TaskManager is removed first.
+	taskManagers.TaskManagers[1].FreeSlots = 2
+	assert.NilError(t, reconciler.reconcileTaskManagerDeployment())
+	assert.Equal(t, getObservedReplicas(), int32(1))
+	assert.NilError(t, k8sClient.List(context.Background(), pods))
+	assert.Equal(t, len(pods.Items), 1)
+	assert.Equal(
+		t, pods.Items[0].Name, "flinksessioncluster-sample-taskmanager-a")
+}
+
+func TestReconcileTaskManagerDeploymentDrainTimeout(t *testing.T) {
+	var cluster = getTestSessionCluster()
+	cluster.Spec.FlinkVersion = "1.12"
+	cluster.Spec.TaskManager.Replicas = 1
+	var drainTimeout int32 = 60
+	cluster.Spec.TaskManager.DrainTimeoutSeconds = &drainTimeout
+	var k8sClient = fake.NewFakeClientWithScheme(scheme.Scheme)
+	var tmDeployment = getDesiredClusterState(cluster, time.Now()).TmDeployment
+	var replicas int32 = 2
+	tmDeployment.Spec.Replicas = &replicas
+	assert.NilError(t, k8sClient.Create(context.Background(), tmDeployment))
+	var recorder = record.NewFakeRecorder(10)
+	var reconciler = ClusterReconciler{
+		k8sClient: k8sClient,
+		context:   context.Background(),
+		log:       log.Log,
+		recorder:  recorder,
+		desired:   getDesiredClusterState(cluster, time.Now()),
+		observed: ObservedClusterState{
+			cluster:      cluster,
+			tmDeployment: tmDeployment,
+			flinkTaskManagers: &flinkclient.TaskManagerList{
+				TaskManagers: []flinkclient.TaskManagerInfo{{
+					ID:          "flinksessioncluster-sample-taskmanager-a",
+					SlotsNumber: 2,
+					FreeSlots:   0,
+				}},
+			},
+		},
+	}
+	var getObservedReplicas = func() int32 {
+		var deployment = &appsv1.Deployment{}
+		var err = k8sClient.Get(
+			context.Background(),
+			types.NamespacedName{
+				Namespace: "default",
+				Name:      "flinksessioncluster-sample-taskmanager",
+			},
+			deployment)
+		assert.NilError(t, err)
+		return *deployment.Spec.Replicas
+	}
+	var tc = &TimeConverter{}
+	var tmStatus = &cluster.Status.Components.TaskManagerDeployment
+
+	// The replicas are kept within the drain timeout.
+	tmStatus.DrainStartTime = tc.ToString(time.Now().Add(-30 * time.Second))
+	assert.NilError(t, reconciler.reconcileTaskManagerDeployment())
+	assert.Equal(t, getObservedReplicas(), int32(2))
+
+	// The busy TaskManagers are removed after it.
+	tmStatus.DrainStartTime = tc.ToString(time.Now().Add(-90 * time.Second))
+	assert.NilError(t, reconciler.reconcileTaskManagerDeployment())
+	assert.Equal(t, getObservedReplicas(), int32(1))
+	assert.Equal(
+		t,
+		<-recorder.Events,
+		"Warning DrainTimeout The TaskManagers were not idle after 60s, "+
+			"removing them anyway")
+}
+
+func TestReconcileTaskManagerStatefulSet(t *testing.T) {
+	var cluster = getTestSessionCluster()
+	cluster.Spec.TaskManager.VolumeClaimTemplates = []corev1.PersistentVolumeClaim{{
+		ObjectMeta: metav1.ObjectMeta{Name: "rocksdb"},
+	}}
+	var k8sClient = fake.NewFakeClientWithScheme(scheme.Scheme)
+	var reconciler = ClusterReconciler{
+		k8sClient: k8sClient,
+		context:   context.Background(),
+		log:       log.Log,
+		observed:  ObservedClusterState{cluster: cluster},
+		desired:   getDesiredClusterState(cluster, time.Now()),
+	}
+	var getObserved = func() *appsv1.StatefulSet {
+		var statefulSet = &appsv1.StatefulSet{}
+		var err = k8sClient.Get(
+			context.Background(),
+			types.NamespacedName{
+				Namespace: "default",
+				Name:      "flinksessioncluster-sample-taskmanager",
+			},
+			statefulSet)
+		assert.NilError(t, err)
+		return statefulSet
+	}
+
+	// Created.
+	var err = reconciler.reconcileTaskManagerStatefulSet()
+	assert.NilError(t, err)
+	assert.Equal(t, *getObserved().Spec.Replicas, int32(2))
+
+	// Scaled.
+	cluster.Spec.TaskManager.Replicas = 4
+	reconciler.observed.tmStatefulSet = getObserved()
+	reconciler.desired = getDesiredClusterState(cluster, time.Now())
+	err = reconciler.reconcileTaskManagerStatefulSet()
+	assert.NilError(t, err)
+	assert.Equal(t, *getObserved().Spec.Replicas, int32(4))
+
+	// The scale-down waits for the TaskManagers with the highest ordinals to
+	// be drained.
+	cluster.Spec.FlinkVersion = "1.12"
+	cluster.Spec.TaskManager.Replicas = 3
+	var taskManagers = &flinkclient.TaskManagerList{}
+	for i := 0; i < 4; i++ {
+		var name = fmt.Sprintf("flinksessioncluster-sample-taskmanager-%v", i)
+		reconciler.observed.tmPods = append(reconciler.observed.tmPods, corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: name},
+		})
+		taskManagers.TaskManagers = append(
+			taskManagers.TaskManagers,
+			flinkclient.TaskManagerInfo{ID: name, SlotsNumber: 1, FreeSlots: 0})
+	}
+	// The idle TaskManager is not the one removed by the StatefulSet.
+	taskManagers.TaskManagers[0].FreeSlots = 1
+	reconciler.observed.flinkTaskManagers = taskManagers
+	reconciler.observed.tmStatefulSet = getObserved()
+	reconciler.desired = getDesiredClusterState(cluster, time.Now())
+	err = reconciler.reconcileTaskManagerStatefulSet()
+	assert.NilError(t, err)
+	assert.Equal(t, *getObserved().Spec.Replicas, int32(4))
+
+	taskManagers.TaskManagers[3].FreeSlots = 1
+	err = reconciler.reconcileTaskManagerStatefulSet()
+	assert.NilError(t, err)
+	assert.Equal(t, *getObserved().Spec.Replicas, int32(3))
+}
+
+func TestReconcileDriftCorrection(t *testing.T) {
+	var cluster = getTestSessionCluster()
+	cluster.Status.Components.JobManagerService.Name =
+		"flinksessioncluster-sample-jobmanager"
+	var k8sClient = fake.NewFakeClientWithScheme(scheme.Scheme)
+	var recorder = record.NewFakeRecorder(10)
+	var reconciler = ClusterReconciler{
+		k8sClient: k8sClient,
+		context:   context.Background(),
+		log:       log.Log,
+		recorder:  recorder,
+		observed:  ObservedClusterState{cluster: cluster},
+		desired:   getDesiredClusterState(cluster, time.Now()),
+	}
+	var getService = func() *corev1.Service {
+		var service = &corev1.Service{}
+		var err = k8sClient.Get(
+			context.Background(),
+			types.NamespacedName{
+				Namespace: "default",
+				Name:      "flinksessioncluster-sample-jobmanager",
+			},
+			service)
+		assert.NilError(t, err)
+		return service
+	}
+	var getDeployment = func() *appsv1.Deployment {
+		var deployment = &appsv1.Deployment{}
+		var err = k8sClient.Get(
+			context.Background(),
+			types.NamespacedName{
+				Namespace: "default",
+				Name:      "flinksessioncluster-sample-taskmanager",
+			},
+			deployment)
+		assert.NilError(t, err)
+		return deployment
+	}
+
+	// The recorded service is missing, it is recreated.
+	var err = reconciler.reconcileJobManagerService()
+	assert.NilError(t, err)
+	assert.Equal(
+		t,
+		<-recorder.Events,
+		"Warning DriftCorrected The JobManager service "+
+			"flinksessioncluster-sample-jobmanager is missing, recreating it")
+
+	// The ports of the service are restored.
+	var service = getService()
+	service.Spec.Ports[3].Port = 9091
+	err = k8sClient.Update(context.Background(), service)
+	assert.NilError(t, err)
+	reconciler.observed.jmService = getService()
+	err = reconciler.reconcileJobManagerService()
+	assert.NilError(t, err)
+	assert.Equal(t, getService().Spec.Ports[3].Port, int32(8081))
+	assert.Equal(
+		t,
+		<-recorder.Events,
+		"Warning DriftCorrected The ports of the JobManager service were "+
+			"changed, restoring them to the spec")
+
+	// The deployment is created with the applied replicas, which were not
+	// recorded in the status.
+	err = reconciler.reconcileTaskManagerDeployment()
+	assert.NilError(t, err)
+	assert.Equal(t, len(recorder.Events), 0)
+	var deployment = getDeployment()
+	assert.Equal(t, deployment.Annotations[appliedReplicasAnnotation], "2")
+
+	// The desired replicas change without a drift event.
+	cluster.Spec.TaskManager.Replicas = 3
+	reconciler.desired = getDesiredClusterState(cluster, time.Now())
+	reconciler.observed.tmDeployment = getDeployment()
+	err = reconciler.reconcileTaskManagerDeployment()
+	assert.NilError(t, err)
+	assert.Equal(t, len(recorder.Events), 0)
+	assert.Equal(t, *getDeployment().Spec.Replicas, int32(3))
+
+	// The replicas scaled outside of the operator are restored.
+	err = reconciler.reconcileJobManagerDeployment()
+	assert.NilError(t, err)
+	var jmDeployment = &appsv1.Deployment{}
+	var jmName = types.NamespacedName{
+		Namespace: "default", Name: "flinksessioncluster-sample-jobmanager"}
+	err = k8sClient.Get(context.Background(), jmName, jmDeployment)
+	assert.NilError(t, err)
+	var scaled int32 = 3
+	jmDeployment.Spec.Replicas = &scaled
+	err = k8sClient.Update(context.Background(), jmDeployment)
+	assert.NilError(t, err)
+	reconciler.observed.jmDeployment = jmDeployment
+	err = reconciler.reconcileJobManagerDeployment()
+	assert.NilError(t, err)
+	err = k8sClient.Get(context.Background(), jmName, jmDeployment)
+	assert.NilError(t, err)
+	assert.Equal(t, *jmDeployment.Spec.Replicas, int32(1))
+	assert.Equal(
+		t,
+		<-recorder.Events,
+		"Warning DriftCorrected The replicas of the JobManager deployment "+
+			"were changed to 3, restoring them to 1")
+
+	// The removed owner reference is restored, then the drift is corrected
+	// in the next reconcile.
+	var rescaled int32 = 3
+	jmDeployment.OwnerReferences = nil
+	jmDeployment.Spec.Replicas = &rescaled
+	err = k8sClient.Update(context.Background(), jmDeployment)
+	assert.NilError(t, err)
+	reconciler.observed.jmDeployment = jmDeployment
+	err = reconciler.reconcileJobManagerDeployment()
+	assert.NilError(t, err)
+	err = k8sClient.Get(context.Background(), jmName, jmDeployment)
+	assert.NilError(t, err)
+	assert.Assert(t, metav1.IsControlledBy(jmDeployment, cluster))
+	assert.Equal(t, *jmDeployment.Spec.Replicas, int32(3))
+	assert.Equal(
+		t,
+		<-recorder.Events,
+		"Warning DriftCorrected The owner reference of the JobManager "+
+			"deployment flinksessioncluster-sample-jobmanager was removed, "+
+			"restoring it")
+
+	// A service controlled by another owner is not updated.
+	service = getService()
+	service.OwnerReferences = []metav1.OwnerReference{{
+		APIVersion: "flinkoperator.k8s.io/v1beta1",
+		Kind:       "FlinkCluster",
+		Name:       "other",
+		UID:        "other-uid",
+		Controller: &[]bool{true}[0],
+	}}
+	service.Spec.Ports[3].Port = 9091
+	err = k8sClient.Update(context.Background(), service)
+	assert.NilError(t, err)
+	reconciler.observed.jmService = getService()
+	err = reconciler.reconcileJobManagerService()
+	assert.NilError(t, err)
+	assert.Equal(t, getService().Spec.Ports[3].Port, int32(9091))
+	assert.Equal(
+		t,
+		<-recorder.Events,
+		"Warning NotOwned The JobManager service "+
+			"flinksessioncluster-sample-jobmanager is controlled by FlinkCluster "+
+			"other, not updating it")
+}
+
+func TestReconcileDeploymentWithEnvFromSecret(t *testing.T) {
+	var cluster = getTestSessionCluster()
+	var accessKey = corev1.EnvVar{
+		Name: "AWS_ACCESS_KEY_ID",
+		ValueFrom: &corev1.EnvVarSource{
+			SecretKeyRef: &corev1.SecretKeySelector{
+				LocalObjectReference: corev1.LocalObjectReference{
+					Name: "s3-credentials",
+				},
+				Key: "access-key",
+			},
+		},
+	}
+	var envFrom = corev1.EnvFromSource{
+		ConfigMapRef: &corev1.ConfigMapEnvSource{
+			LocalObjectReference: corev1.LocalObjectReference{
+				Name: "s3-config",
+			},
+		},
+	}
+	cluster.Spec.TaskManager.Env = []corev1.EnvVar{accessKey}
+	cluster.Spec.TaskManager.EnvFrom = []corev1.EnvFromSource{envFrom}
+	cluster.Spec.JobManager.Env = []corev1.EnvVar{accessKey}
+	var k8sClient = fake.NewFakeClientWithScheme(scheme.Scheme)
+	var reconciler = ClusterReconciler{
+		k8sClient: k8sClient,
+		context:   context.Background(),
+		log:       log.Log,
+		desired:   getDesiredClusterState(cluster, time.Now()),
+	}
+
+	assert.NilError(t, reconciler.reconcileTaskManagerDeployment())
+	var deployment = &appsv1.Deployment{}
+	var err = k8sClient.Get(
+		context.Background(),
+		types.NamespacedName{
+			Namespace: "default",
+			Name:      "flinksessioncluster-sample-taskmanager",
+		},
+		deployment)
+	assert.NilError(t, err)
+	var container = deployment.Spec.Template.Spec.Containers[0]
+	// Appended after the shared env vars.
+	assert.DeepEqual(t, container.Env[len(container.Env)-1], accessKey)
+	assert.DeepEqual(t, container.EnvFrom, []corev1.EnvFromSource{envFrom})
+
+	// The JobManager container only gets its own env vars.
+	var jmContainer = reconciler.desired.JmDeployment.Spec.Template.Spec.Containers[0]
+	assert.DeepEqual(t, jmContainer.Env[len(jmContainer.Env)-1], accessKey)
+	assert.Equal(t, len(jmContainer.EnvFrom), 0)
+}
+
+func TestReconcileDeploymentWithSidecars(t *testing.T) {
+	var cluster = getTestSessionCluster()
+	cluster.Spec.TaskManager.Sidecars = []corev1.Container{
+		{Name: "fluentd", Image: "fluentd"},
+	}
+	var k8sClient = fake.NewFakeClientWithScheme(scheme.Scheme)
+	var reconciler = ClusterReconciler{
+		k8sClient: k8sClient,
+		context:   context.Background(),
+		log:       log.Log,
+	}
+	var getObserved = func() *appsv1.Deployment {
+		var deployment = &appsv1.Deployment{}
+		var err = k8sClient.Get(
+			context.Background(),
+			types.NamespacedName{
+				Namespace: "default",
+				Name:      "flinksessioncluster-sample-taskmanager",
+			},
+			deployment)
+		assert.NilError(t, err)
+		return deployment
+	}
+	var countLogVolumes = func(deployment *appsv1.Deployment) int {
+		var count = 0
+		for _, volume := range deployment.Spec.Template.Spec.Volumes {
+			if volume.Name == "flink-log-volume" {
+				count++
+			}
+		}
+		return count
+	}
+
+	var desired = getDesiredClusterState(cluster, time.Now())
+	var err = reconciler.reconcileDeployment(
+		"TaskManager", desired.TmDeployment, nil)
+	assert.NilError(t, err)
+	assert.Equal(t, countLogVolumes(getObserved()), 1)
+
+	// Sidecars change between reconciles.
+	cluster.Spec.TaskManager.Sidecars = append(
+		cluster.Spec.TaskManager.Sidecars,
+		corev1.Container{Name: "filebeat", Image: "filebeat"})
+	desired = getDesiredClusterState(cluster, time.Now())
+	err = reconciler.reconcileDeployment(
+		"TaskManager", desired.TmDeployment, getObserved())
+	assert.NilError(t, err)
+	assert.Equal(t, countLogVolumes(desired.TmDeployment), 1)
+	assert.Equal(t, countLogVolumes(getObserved()), 1)
+	for _, container := range desired.TmDeployment.Spec.Template.Spec.Containers {
+		var mounts = 0
+		for _, mount := range container.VolumeMounts {
+			if mount.Name == "flink-log-volume" {
+				mounts++
+			}
+		}
+		assert.Equal(t, mounts, 1, container.Name)
+	}
+}
+
+func TestReconcileJobClearsSubmitJobDeadline(t *testing.T) {
+	var cluster = getTestSessionCluster()
+	var parallelism int32 = 1
+	var timeout int64 = 300
+	cluster.Spec.Job = &v1beta1.JobSpec{
+		JarFile:                 "/opt/flink/job/wordcount.jar",
+		Parallelism:             &parallelism,
+		SubmitJobTimeoutSeconds: &timeout,
+	}
+	var desired = getDesiredClusterState(cluster, time.Now())
+	assert.DeepEqual(t, desired.Job.Spec.ActiveDeadlineSeconds, &timeout)
+
+	var k8sClient = fake.NewFakeClientWithScheme(scheme.Scheme, desired.Job)
+	var reconciler = ClusterReconciler{
+		k8sClient: k8sClient,
+		context:   context.Background(),
+		log:       log.Log,
+		observed: ObservedClusterState{
+			cluster: cluster,
+			job:     desired.Job,
+		},
+		desired: desired,
+	}
+	var getObserved = func() *batchv1.Job {
+		var job = &batchv1.Job{}
+		var err = k8sClient.Get(
+			context.Background(),
+			types.NamespacedName{
+				Namespace: "default",
+				Name:      "flinksessioncluster-sample-job",
+			},
+			job)
+		assert.NilError(t, err)
+		return job
+	}
+
+	// The deadline is kept while the job is being submitted.
+	cluster.Status.Components.Job = &v1beta1.JobStatus{
+		State: v1beta1.JobStatePending}
+	var _, err = reconciler.reconcileJob()
+	assert.NilError(t, err)
+	assert.DeepEqual(t, getObserved().Spec.ActiveDeadlineSeconds, &timeout)
+
+	// The deadline is cleared after the job is running.
+	cluster.Status.Components.Job.State = v1beta1.JobStateRunning
+	_, err = reconciler.reconcileJob()
+	assert.NilError(t, err)
+	assert.Assert(t, getObserved().Spec.ActiveDeadlineSeconds == nil)
+}
+
+func TestReconcileOrphans(t *testing.T) {
+	var cluster = getTestSessionCluster()
+	var parallelism int32 = 1
+	cluster.Spec.Job = &v1beta1.JobSpec{
+		JarFile:     "/opt/flink/job/wordcount.jar",
+		Parallelism: &parallelism,
+	}
+	var orphanJob = getDesiredClusterState(cluster, time.Now()).Job
+	var foreignJob = orphanJob.DeepCopy()
+	foreignJob.Name = "foreign-job"
+	foreignJob.OwnerReferences = nil
+	cluster.Spec.Job = nil
+
+	var k8sClient = fake.NewFakeClientWithScheme(
+		scheme.Scheme, orphanJob, foreignJob)
+	var reconciler = ClusterReconciler{
+		k8sClient: k8sClient,
+		context:   context.Background(),
+		log:       log.Log,
+		observed: ObservedClusterState{
+			cluster: cluster,
+			orphans: []runtime.Object{orphanJob, foreignJob},
+		},
+	}
+
+	// Only the job controlled by the cluster is deleted.
+	var err = reconciler.reconcileOrphans()
+	assert.NilError(t, err)
+	var jobs = &batchv1.JobList{}
+	err = k8sClient.List(context.Background(), jobs)
+	assert.NilError(t, err)
+	assert.Equal(t, len(jobs.Items), 1)
+	assert.Equal(t, jobs.Items[0].Name, "foreign-job")
+
+	// Deleting an orphan which is already gone is not an error.
+	err = reconciler.reconcileOrphans()
+	assert.NilError(t, err)
+}
+
+func TestReconcileInvalidSpec(t *testing.T) {
+	var cluster = getTestSessionCluster()
+	cluster.Spec.Image.Name = ""
+	cluster.Spec.TaskManager.Replicas = 0
+	var testScheme = runtime.NewScheme()
+	assert.NilError(t, scheme.AddToScheme(testScheme))
+	assert.NilError(t, v1beta1.AddToScheme(testScheme))
+	var k8sClient = fake.NewFakeClientWithScheme(testScheme, cluster)
+	var recorder = record.NewFakeRecorder(10)
+	var reconciler = ClusterReconciler{
+		k8sClient: k8sClient,
+		context:   context.Background(),
+		log:       log.Log,
+		recorder:  recorder,
+		observed: ObservedClusterState{
+			cluster:    cluster,
+			specErrors: validateSpec(cluster),
+		},
+	}
+	var getSpecValidCondition = func() *v1beta1.FlinkClusterCondition {
+		var updated = &v1beta1.FlinkCluster{}
+		var err = k8sClient.Get(
+			context.Background(),
+			types.NamespacedName{Namespace: cluster.Namespace, Name: cluster.Name},
+			updated)
+		assert.NilError(t, err)
+		return getCondition(
+			updated.Status.Conditions, v1beta1.ClusterConditionSpecValid)
+	}
+	var message = "image name is unspecified; " +
+		"invalid TaskManager replicas, it must >= 1"
+
+	// The errors are reported and no resources are created.
+	var _, err = reconciler.reconcile()
+	assert.NilError(t, err)
+	var condition = getSpecValidCondition()
+	assert.Equal(t, condition.Status, corev1.ConditionFalse)
+	assert.Equal(t, condition.Reason, "InvalidSpec")
+	assert.Equal(t, condition.Message, message)
+	assert.Equal(t, <-recorder.Events, "Warning InvalidSpec "+message)
+	var deployments = &appsv1.DeploymentList{}
+	assert.NilError(t, k8sClient.List(context.Background(), deployments))
+	assert.Equal(t, len(deployments.Items), 0)
+
+	// The event is emitted once while the errors stay the same.
+	_, err = reconciler.reconcile()
+	assert.NilError(t, err)
+	assert.Equal(t, len(recorder.Events), 0)
+
+	// The spec is fixed.
+	var fixed = reconciler.observed.cluster.DeepCopy()
+	fixed.Spec = getTestSessionCluster().Spec
+	fixed.Spec.Image.PullPolicy = corev1.PullIfNotPresent
+	reconciler.observed.cluster = fixed
+	reconciler.observed.specErrors = validateSpec(fixed)
+	specValid, err := reconciler.checkSpecValid()
+	assert.NilError(t, err)
+	assert.Assert(t, specValid)
+	assert.Equal(t, getSpecValidCondition().Status, corev1.ConditionTrue)
+}
+
+// Records the stopped jobs.
+type stoppingFlinkClient struct {
+	flinkclient.FlinkClient
+	stopped []string
+}
+
+func (c *stoppingFlinkClient) StopJob(apiBaseURL string, jobID string) error {
+	c.stopped = append(c.stopped, jobID)
+	return nil
+}
+
+func TestReconcileStopRequestsOfInvalidSpec(t *testing.T) {
+	var cluster = getTestSessionCluster()
+	var cancelRequested = true
+	cluster.Spec.Image.Name = ""
+	cluster.Spec.Suspend = true
+	cluster.Spec.Job = &v1beta1.JobSpec{
+		JarFile:         "/opt/flink/job/wordcount.jar",
+		CancelRequested: &cancelRequested,
+	}
+	cluster.Status.Components.Job = &v1beta1.JobStatus{
+		Name:  "flinksessioncluster-sample-job",
+		ID:    "3f1a",
+		State: v1beta1.JobStateRunning,
+	}
+	var replicas int32 = 1
+	var observedJob = &batchv1.Job{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: "default",
+			Name:      "flinksessioncluster-sample-job",
+		},
+	}
+	var jmDeployment = &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace:       "default",
+			Name:            "flinksessioncluster-sample-jobmanager",
+			OwnerReferences: []metav1.OwnerReference{toOwnerReference(cluster)},
+		},
+		Spec: appsv1.DeploymentSpec{Replicas: &replicas},
+	}
+	var testScheme = runtime.NewScheme()
+	assert.NilError(t, scheme.AddToScheme(testScheme))
+	assert.NilError(t, v1beta1.AddToScheme(testScheme))
+	var k8sClient = fake.NewFakeClientWithScheme(
+		testScheme, cluster, observedJob, jmDeployment)
+	var flinkClient = &stoppingFlinkClient{}
+	var reconciler = ClusterReconciler{
+		k8sClient:   k8sClient,
+		flinkClient: flinkClient,
+		context:     context.Background(),
+		log:         log.Log,
+		recorder:    record.NewFakeRecorder(10),
+		observed: ObservedClusterState{
+			cluster:      cluster,
+			specErrors:   validateSpec(cluster),
+			job:          observedJob,
+			jmDeployment: jmDeployment,
+		},
+	}
+
+	// The job is cancelled and the cluster is suspended, though the spec is
+	// invalid.
+	var _, err = reconciler.reconcile()
+	assert.NilError(t, err)
+	assert.DeepEqual(t, flinkClient.stopped, []string{"3f1a"})
+	var jobs = &batchv1.JobList{}
+	assert.NilError(t, k8sClient.List(context.Background(), jobs))
+	assert.Equal(t, len(jobs.Items), 0)
+	var deployment = &appsv1.Deployment{}
+	err = k8sClient.Get(
+		context.Background(),
+		types.NamespacedName{
+			Namespace: "default",
+			Name:      "flinksessioncluster-sample-jobmanager",
+		},
+		deployment)
+	assert.NilError(t, err)
+	assert.Equal(t, *deployment.Spec.Replicas, int32(0))
+}
+
+func TestSubmitStreamGraph(t *testing.T) {
+	var streamGraphJSON = `{"nodes":[{"id":1,"type":"Source"}]}`
+	var postedPlan string
+	var server = httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			switch {
+			case r.Method == "GET" && r.URL.Path == "/jars":
+				w.Write([]byte(`{"files":[
+					{"id":"a1b2_other.jar","name":"other.jar"},
+					{"id":"c3d4_wordcount.jar","name":"wordcount.jar"}]}`))
+			case r.Method == "POST" && r.URL.Path == "/jars/c3d4_wordcount.jar/run":
+				var body, _ = ioutil.ReadAll(r.Body)
+				postedPlan = string(body)
+				w.Write([]byte(`{"jobid":"3f1a"}`))
+			default:
+				http.NotFound(w, r)
+			}
+		}))
+	defer server.Close()
+
+	var cluster = getTestSessionCluster()
+	cluster.Spec.Job = &v1beta1.JobSpec{
+		JarFile:         "/opt/flink/job/wordcount.jar",
+		StreamGraphJSON: streamGraphJSON,
+	}
+	var testScheme = runtime.NewScheme()
+	assert.NilError(t, v1beta1.AddToScheme(testScheme))
+	var k8sClient = fake.NewFakeClientWithScheme(testScheme, cluster)
+	var reconciler = ClusterReconciler{
+		k8sClient:   k8sClient,
+		flinkClient: flinkclient.NewFlinkClient(log.Log, 0, 0),
+		context:     context.Background(),
+		log:         log.Log,
+		observed:    ObservedClusterState{cluster: cluster},
+	}
+
+	var err = reconciler.submitStreamGraph(server.URL)
+	assert.NilError(t, err)
+	assert.Equal(t, postedPlan, streamGraphJSON)
+
+	var updated = &v1beta1.FlinkCluster{}
+	err = k8sClient.Get(
+		context.Background(),
+		types.NamespacedName{Namespace: cluster.Namespace, Name: cluster.Name},
+		updated)
+	assert.NilError(t, err)
+	assert.Assert(t, updated.Status.Components.Job != nil)
+	assert.Equal(
+		t, updated.Status.Components.Job.State, v1beta1.JobStatePending)
+	assert.Equal(t, updated.Status.Components.Job.ID, "3f1a")
+
+	// The JAR file has not been uploaded.
+	cluster.Spec.Job.JarFile = "/opt/flink/job/missing.jar"
+	err = reconciler.submitStreamGraph(server.URL)
+	assert.Assert(t, err != nil, "err is not expected to be nil")
+	assert.Equal(t, err.Error(), "JAR file missing.jar has not been uploaded")
+}
+
+func TestReconcileRESTSubmittedJob(t *testing.T) {
+	var className = "org.example.WordCount"
+	var parallelism int32 = 2
+	var restartPolicy = v1beta1.JobRestartPolicyOnFailure
+	var cluster = getTestSessionCluster()
+	cluster.Spec.Job = &v1beta1.JobSpec{
+		JarFile:       "/opt/flink/job/wordcount.jar",
+		ClassName:     &className,
+		Args:          []string{"--input", "/data"},
+		Parallelism:   &parallelism,
+		RestartPolicy: &restartPolicy,
+		SubmissionRetry: &v1beta1.JobSubmissionRetry{
+			DeadlineSeconds:       300,
+			InitialBackoffSeconds: 5,
+			BackoffMultiplier:     2,
+			MaxBackoffSeconds:     60,
+		},
+	}
+	cluster.Status.State = v1beta1.ClusterStateRunning
+	var testScheme = runtime.NewScheme()
+	assert.NilError(t, scheme.AddToScheme(testScheme))
+	assert.NilError(t, v1beta1.AddToScheme(testScheme))
+	var k8sClient = fake.NewFakeClientWithScheme(testScheme, cluster)
+	var flinkClient = &fakeFlinkClient{
+		jarID:  "abc_wordcount.jar",
+		runErr: fmt.Errorf("connection refused"),
+	}
+	var recorder = record.NewFakeRecorder(10)
+	var reconciler = ClusterReconciler{
+		k8sClient:   k8sClient,
+		flinkClient: flinkClient,
+		context:     context.Background(),
+		log:         log.Log,
+		recorder:    recorder,
+		observed:    ObservedClusterState{cluster: cluster},
+	}
+	var getJobStatus = func() *v1beta1.JobStatus {
+		var updated = &v1beta1.FlinkCluster{}
+		var err = k8sClient.Get(
+			context.Background(),
+			types.NamespacedName{Namespace: cluster.Namespace, Name: cluster.Name},
+			updated)
+		assert.NilError(t, err)
+		reconciler.observed.cluster = updated
+		return updated.Status.Components.Job
+	}
+
+	// The first attempt fails, the generated job ID is recorded.
+	var _, err = reconciler.reconcileRESTSubmittedJob()
+	assert.NilError(t, err)
+	var jobStatus = getJobStatus()
+	assert.Equal(t, jobStatus.State, v1beta1.JobStateDeploying)
+	assert.Equal(t, jobStatus.SubmissionAttempts, int32(1))
+	assert.Assert(t, len(jobStatus.NextSubmissionTime) > 0)
+	assert.Equal(t, len(jobStatus.ID), 32)
+	var jobID = jobStatus.ID
+	assert.DeepEqual(
+		t,
+		flinkClient.runs,
+		[]flinkclient.JarRunRequest{{
+			EntryClass:      "org.example.WordCount",
+			ProgramArgsList: []string{"--input", "/data"},
+			Parallelism:     &parallelism,
+			JobID:           jobID,
+		}})
+
+	// Not retried before the backoff.
+	var result ctrl.Result
+	result, err = reconciler.reconcileRESTSubmittedJob()
+	assert.NilError(t, err)
+	assert.Assert(t, result.RequeueAfter > 0)
+	assert.Equal(t, len(flinkClient.runs), 1)
+
+	// The JobManager accepts the second attempt with the same job ID.
+	var tc = &TimeConverter{}
+	reconciler.observed.cluster.Status.Components.Job.NextSubmissionTime =
+		tc.ToString(time.Now().Add(-time.Second))
+	flinkClient.runErr = nil
+	_, err = reconciler.reconcileRESTSubmittedJob()
+	assert.NilError(t, err)
+	jobStatus = getJobStatus()
+	assert.Equal(t, jobStatus.State, v1beta1.JobStatePending)
+	assert.Equal(t, jobStatus.ID, jobID)
+	assert.Equal(t, flinkClient.runs[1].JobID, jobID)
+	assert.Equal(t, jobStatus.SubmissionAttempts, int32(2))
+	assert.Equal(t, jobStatus.NextSubmissionTime, "")
+
+	// An attempt was accepted but its response was lost, the job is found by
+	// its ID instead of being submitted again.
+	reconciler.observed.cluster.Status.Components.Job = &v1beta1.JobStatus{
+		State:               v1beta1.JobStateDeploying,
+		ID:                  "7e5c",
+		SubmissionAttempts:  1,
+		FirstSubmissionTime: tc.ToString(time.Now().Add(-10 * time.Second)),
+	}
+	reconciler.observed.flinkJobList = &flinkclient.JobStatusList{
+		Jobs: []flinkclient.JobStatus{
+			{ID: "other", Status: "RUNNING"},
+			{ID: "7e5c", Status: "RUNNING"},
+		},
+	}
+	_, err = reconciler.reconcileRESTSubmittedJob()
+	assert.NilError(t, err)
+	jobStatus = getJobStatus()
+	assert.Equal(t, jobStatus.State, v1beta1.JobStatePending)
+	assert.Equal(t, jobStatus.ID, "7e5c")
+	assert.Equal(t, jobStatus.SubmissionAttempts, int32(1))
+	assert.Equal(t, len(flinkClient.runs), 2)
+
+	// Without its job, another running job is not adopted.
+	reconciler.observed.cluster.Status.Components.Job = &v1beta1.JobStatus{
+		State:               v1beta1.JobStateDeploying,
+		ID:                  "8d6a",
+		SubmissionAttempts:  1,
+		FirstSubmissionTime: tc.ToString(time.Now().Add(-10 * time.Second)),
+	}
+	_, err = reconciler.reconcileRESTSubmittedJob()
+	assert.NilError(t, err)
+	jobStatus = getJobStatus()
+	assert.Equal(t, jobStatus.ID, "8d6a")
+	assert.Equal(t, jobStatus.SubmissionAttempts, int32(2))
+	assert.Equal(t, len(flinkClient.runs), 3)
+	reconciler.observed.flinkJobList = nil
+
+	// Given up when the next attempt would be after the deadline.
+	reconciler.observed.cluster.Status.Components.Job = &v1beta1.JobStatus{
+		State:               v1beta1.JobStateDeploying,
+		SubmissionAttempts:  3,
+		FirstSubmissionTime: tc.ToString(time.Now().Add(-290 * time.Second)),
+	}
+	flinkClient.runErr = fmt.Errorf("connection refused")
+	_, err = reconciler.reconcileRESTSubmittedJob()
+	assert.NilError(t, err)
+	jobStatus = getJobStatus()
+	assert.Equal(t, jobStatus.State, v1beta1.JobStateFailed)
+	assert.Equal(t, jobStatus.Reason, v1beta1.ComponentReasonSubmissionFailed)
+	var message = "job submission failed after 4 attempts within 300s: " +
+		"connection refused"
+	assert.Equal(t, jobStatus.FailureReason, message)
+	assert.Equal(t, <-recorder.Events, "Warning SubmissionFailed "+message)
+	assert.Assert(
+		t, !shouldRestartJob(reconciler.observed.cluster.Spec.Job, jobStatus))
+}
+
+func TestRunJarUploadsJar(t *testing.T) {
+	var jarServer = newTestFlinkAPIServer(map[string]string{
+		"/jobs/wordcount.jar": "jar content",
+	})
+	defer jarServer.Close()
+	var cluster = getTestSessionCluster()
+	cluster.Spec.Job = &v1beta1.JobSpec{
+		JarFile:         "/opt/flink/job-jar/wordcount.jar",
+		JarURI:          jarServer.URL + "/jobs/wordcount.jar",
+		SubmissionRetry: &v1beta1.JobSubmissionRetry{},
+	}
+	var flinkClient = &fakeFlinkClient{}
+	var reconciler = ClusterReconciler{
+		flinkClient: flinkClient,
+		log:         log.Log,
+		observed:    ObservedClusterState{cluster: cluster},
+	}
+
+	// The JAR file is uploaded from the URI before it is run.
+	var jobID, err = reconciler.runJar("http://jobmanager:8081", "3f1a")
+	assert.NilError(t, err)
+	assert.Equal(t, jobID, "3f1a")
+	assert.DeepEqual(
+		t, flinkClient.uploaded, map[string]string{"wordcount.jar": "jar content"})
+	assert.Equal(t, len(flinkClient.runs), 1)
+
+	// The JAR file in the image must have been uploaded.
+	flinkClient.jarID = ""
+	cluster.Spec.Job.JarURI = ""
+	_, err = reconciler.runJar("http://jobmanager:8081", "3f1a")
+	assert.Error(t, err, "JAR file wordcount.jar has not been uploaded")
+	assert.Equal(t, len(flinkClient.runs), 1)
+}
+
+func TestGetSubmissionRetryDelay(t *testing.T) {
+	var retry = &v1beta1.JobSubmissionRetry{
+		InitialBackoffSeconds: 5,
+		BackoffMultiplier:     2,
+		MaxBackoffSeconds:     30,
+	}
+	assert.Equal(t, getSubmissionRetryDelay(retry, 1), 5*time.Second)
+	assert.Equal(t, getSubmissionRetryDelay(retry, 2), 10*time.Second)
+	assert.Equal(t, getSubmissionRetryDelay(retry, 3), 20*time.Second)
+	assert.Equal(t, getSubmissionRetryDelay(retry, 4), 30*time.Second)
+}
+
+func TestReconcileNativeCluster(t *testing.T) {
+	var cluster = getTestSessionCluster()
+	var parallelism int32 = 1
+	var restartPolicy = v1beta1.JobRestartPolicyNever
+	cluster.Spec.DeploymentMode = v1beta1.DeploymentModeNative
+	cluster.Spec.Job = &v1beta1.JobSpec{
+		JarFile:       "/opt/flink/usrlib/wordcount.jar",
+		Parallelism:   &parallelism,
+		RestartPolicy: &restartPolicy,
+		CleanupPolicy: &v1beta1.CleanupPolicy{
+			AfterJobSucceeds: v1beta1.CleanupActionDeleteCluster,
+		},
+	}
+	cluster.Status.Components.Job = &v1beta1.JobStatus{
+		State: v1beta1.JobStateRunning}
+	var nativeDeployment = &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: "default",
+			Name:      "flinksessioncluster-sample",
+		},
+	}
+	var k8sClient = fake.NewFakeClientWithScheme(scheme.Scheme, nativeDeployment)
+	var reconciler = ClusterReconciler{
+		k8sClient: k8sClient,
+		context:   context.Background(),
+		log:       log.Log,
+		observed: ObservedClusterState{
+			cluster: cluster,
+			jmPods:  []corev1.Pod{{}},
+		},
+		desired: getDesiredClusterState(cluster, time.Now()),
+	}
+	var getErr = func() error {
+		return k8sClient.Get(
+			context.Background(),
+			types.NamespacedName{
+				Namespace: "default",
+				Name:      "flinksessioncluster-sample",
+			},
+			&appsv1.Deployment{})
+	}
+
+	// The application cluster is kept while the job is running.
+	assert.NilError(t, reconciler.reconcileNativeCluster())
+	assert.NilError(t, getErr())
+
+	// The application cluster is deleted after the job succeeded.
+	cluster.Status.Components.Job.State = v1beta1.JobStateSucceeded
+	assert.NilError(t, reconciler.reconcileNativeCluster())
+	assert.Assert(t, errors.IsNotFound(getErr()))
+}
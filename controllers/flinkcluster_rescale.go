@@ -0,0 +1,293 @@
+/*
+Copyright 2019 Google LLC.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+// Rescale of a running job when the parallelism of its spec is updated, or
+// raised by the TaskManager autoscaler for high backpressure. The
+// job is stopped with a savepoint, and its job submitter is deleted once the
+// savepoint completes. The TaskManagers are scaled for the new parallelism
+// by the desired state as usual, and the job is resubmitted from the
+// savepoint once they are ready. The progress is recorded in the rescale
+// status of the job across reconciles, the job is Rescaling until the
+// resubmitted job is observed, and the rescale status is cleared once it is
+// running.
+
+import (
+	"fmt"
+	"time"
+
+	v1beta1 "github.com/googlecloudplatform/flink-operator/api/v1beta1"
+	"github.com/googlecloudplatform/flink-operator/controllers/flinkclient"
+	batchv1 "k8s.io/api/batch/v1"
+	ctrl "sigs.k8s.io/controller-runtime"
+)
+
+// The time the savepoint of the job stopped for a rescale can take, after
+// which the rescale fails, e.g., when the JobManager restarted and lost the
+// savepoint trigger.
+const rescaleSavepointTimeout = 10 * time.Minute
+
+// Whether the job is being rescaled, i.e., it is being stopped with a
+// savepoint or resubmitted from it.
+func isJobRescaling(jobStatus *v1beta1.JobStatus) bool {
+	return jobStatus != nil && jobStatus.Rescale != nil &&
+		jobStatus.Rescale.Phase != v1beta1.JobRescalePhaseFailed
+}
+
+// The annotation of the job submitter which resubmits a rescaled job, with
+// the trigger ID of the savepoint of the rescale.
+const rescaleTriggerIDAnnotation = "flinkoperator.k8s.io/rescale-trigger-id"
+
+// Whether the observed job submitter is the one which resubmitted the
+// rescaled job, rather than the one of the stopped job or of an earlier
+// rescale, which might have the same parallelism.
+func isRescaledJobSubmitted(
+	rescale *v1beta1.JobRescaleStatus, observedJob *batchv1.Job) bool {
+	return observedJob != nil && len(rescale.TriggerID) > 0 &&
+		observedJob.Annotations[rescaleTriggerIDAnnotation] == rescale.TriggerID
+}
+
+// Whether the running job should be rescaled to the parallelism of its spec,
+// or the parallelism raised by the autoscaler. A failed rescale is not retried
+// until the parallelism is updated again.
+func isRescaleRequired(
+	cluster *v1beta1.FlinkCluster, observedJob *batchv1.Job) bool {
+	var jobSpec = cluster.Spec.Job
+	var jobStatus = cluster.Status.Components.Job
+	var desiredParallelism = getDesiredParallelism(cluster)
+	if jobSpec == nil || desiredParallelism == nil ||
+		jobSpec.SavepointsDir == nil || observedJob == nil ||
+		isNativeMode(cluster) || !isJobRunning(jobStatus) ||
+		isJobRescaling(jobStatus) {
+		return false
+	}
+	// The parallelism of the job submitted without it is unknown.
+	var parallelism = getJobParallelism(observedJob.Spec)
+	if parallelism == 0 || parallelism == *desiredParallelism {
+		return false
+	}
+	var rescale = jobStatus.Rescale
+	return rescale == nil || rescale.ToParallelism != *desiredParallelism
+}
+
+// Stops the job with a savepoint to rescale it, and records the rescale in
+// the job status.
+func (reconciler *ClusterReconciler) startRescale(jobID string) error {
+	var log = reconciler.log
+	var cluster = reconciler.observed.cluster
+	var jobSpec = cluster.Spec.Job
+	var rescale = &v1beta1.JobRescaleStatus{
+		FromParallelism: getJobParallelism(reconciler.observed.job.Spec),
+		ToParallelism:   *getDesiredParallelism(cluster),
+		Phase:           v1beta1.JobRescalePhaseStopping,
+	}
+
+	log.Info(
+		"Stopping job with savepoint to rescale it",
+		"jobID", jobID,
+		"fromParallelism", rescale.FromParallelism,
+		"toParallelism", rescale.ToParallelism)
+	var triggerID, err = reconciler.flinkClient.StopJobWithSavepoint(
+		getFlinkAPIBaseURL(cluster), jobID, *jobSpec.SavepointsDir)
+	if err != nil {
+		log.Error(err, "Failed to stop job with savepoint", "jobID", jobID)
+		return err
+	}
+	rescale.TriggerID = triggerID.RequestID
+	setTimestamp(&rescale.StartTime)
+	reconciler.recorder.Event(
+		cluster,
+		"Normal",
+		"RescaleStarted",
+		fmt.Sprintf(
+			"Stopping the job with a savepoint to rescale it from parallelism %v to %v",
+			rescale.FromParallelism, rescale.ToParallelism))
+	return reconciler.updateRescaleStatus(rescale, nil)
+}
+
+// Drives the rescale of the job: waits for the savepoint of the stopped job,
+// deletes its job submitter, and resubmits the job from the savepoint once
+// the TaskManagers have been scaled.
+func (reconciler *ClusterReconciler) reconcileRescale() (ctrl.Result, error) {
+	var log = reconciler.log
+	var observed = reconciler.observed
+	var observedJob = observed.job
+	var rescale = observed.cluster.Status.Components.Job.Rescale
+
+	if rescale.Phase == v1beta1.JobRescalePhaseStopping {
+		return reconciler.reconcileRescaleSavepoint()
+	}
+
+	// The job submitter of the stopped job, whose deletion failed after the
+	// savepoint completed.
+	if observedJob != nil && !isRescaledJobSubmitted(rescale, observedJob) {
+		var err = reconciler.deleteJob(observedJob)
+		return requeueResult, err
+	}
+	if observedJob != nil {
+		log.Info("Waiting for the rescaled job to run")
+		return requeueResult, nil
+	}
+
+	if !reconciler.isTaskManagerScaled() {
+		log.Info(
+			"Waiting for the TaskManagers to be scaled for the rescaled job",
+			"parallelism", rescale.ToParallelism)
+		return requeueResult, nil
+	}
+	if observed.flinkJobList == nil {
+		log.Info("Waiting for Flink API server to be ready")
+		return requeueResult, nil
+	}
+
+	reconciler.recorder.Event(
+		observed.cluster,
+		"Normal",
+		"RescaleResubmitted",
+		fmt.Sprintf(
+			"Resubmitting the job with parallelism %v from savepoint %v",
+			rescale.ToParallelism, rescale.SavepointLocation))
+	var err = reconciler.createJob(reconciler.desired.Job)
+	return requeueResult, err
+}
+
+// Checks the savepoint of the job stopped for the rescale. Once it is
+// completed, it is recorded for the resubmission and the job submitter of
+// the stopped job is deleted. A failed savepoint doesn't stop the job, the
+// rescale fails and the job keeps running with the old parallelism. The
+// rescale also fails if the savepoint doesn't complete in time, so that the
+// job is no longer masked as Rescaling.
+func (reconciler *ClusterReconciler) reconcileRescaleSavepoint() (
+	ctrl.Result, error) {
+	var log = reconciler.log
+	var observed = reconciler.observed
+	var jobID = reconciler.getFlinkJobID()
+	var rescale = observed.cluster.Status.Components.Job.Rescale.DeepCopy()
+
+	var status, err = reconciler.flinkClient.GetSavepointStatus(
+		getFlinkAPIBaseURL(observed.cluster), jobID, rescale.TriggerID)
+	if err != nil || !status.Completed {
+		if isRescaleSavepointTimedOut(rescale) {
+			var reason = fmt.Sprintf(
+				"savepoint did not complete within %v", rescaleSavepointTimeout)
+			return ctrl.Result{}, reconciler.failRescale(rescale, reason)
+		}
+		if err != nil {
+			log.Info("Failed to get the savepoint status", "error", err)
+		} else {
+			log.Info("Waiting for the savepoint of the stopped job", "jobID", jobID)
+		}
+		return requeueResult, nil
+	}
+
+	if len(status.FailureCause.StackTrace) > 0 || len(status.Location) == 0 {
+		var reason = status.FailureCause.ExceptionClass
+		if len(reason) == 0 {
+			reason = "savepoint location is unknown"
+		}
+		return ctrl.Result{}, reconciler.failRescale(rescale, reason)
+	}
+
+	log.Info(
+		"Stopped job with savepoint",
+		"jobID", jobID,
+		"location", status.Location)
+	rescale.Phase = v1beta1.JobRescalePhaseResubmitting
+	rescale.SavepointLocation = status.Location
+	err = reconciler.updateRescaleStatus(rescale, &status)
+	if err != nil {
+		return requeueResult, err
+	}
+	if observed.job != nil {
+		err = reconciler.deleteJob(observed.job)
+	}
+	return requeueResult, err
+}
+
+// Whether the savepoint of the job stopped for the rescale has not completed
+// in time.
+func isRescaleSavepointTimedOut(rescale *v1beta1.JobRescaleStatus) bool {
+	if len(rescale.StartTime) == 0 {
+		return false
+	}
+	var tc = &TimeConverter{}
+	var deadline = tc.FromString(rescale.StartTime).Add(rescaleSavepointTimeout)
+	return !time.Now().Before(deadline)
+}
+
+// Records the failure of the savepoint of the rescale, the job keeps running
+// with the old parallelism.
+func (reconciler *ClusterReconciler) failRescale(
+	rescale *v1beta1.JobRescaleStatus, reason string) error {
+	rescale.Phase = v1beta1.JobRescalePhaseFailed
+	rescale.FailureReason = reason
+	reconciler.recorder.Event(
+		reconciler.observed.cluster,
+		"Warning",
+		"RescaleFailed",
+		fmt.Sprintf(
+			"Failed to stop the job with a savepoint, it keeps running with parallelism %v: %v",
+			rescale.FromParallelism, rescale.FailureReason))
+	return reconciler.updateRescaleStatus(rescale, nil)
+}
+
+// Records the rescale in the job status, and the completed savepoint if any,
+// like the other savepoints taken by the operator.
+func (reconciler *ClusterReconciler) updateRescaleStatus(
+	rescale *v1beta1.JobRescaleStatus,
+	savepoint *flinkclient.SavepointStatus) error {
+	var cluster = reconciler.observed.cluster
+	var updated = cluster.DeepCopy()
+	var jobStatus = updated.Status.Components.Job
+	jobStatus.Rescale = rescale
+	if isJobRescaling(jobStatus) {
+		jobStatus.State = v1beta1.JobStateRescaling
+	}
+	if savepoint != nil {
+		jobStatus.SavepointGeneration++
+		jobStatus.LastSavepointTriggerID = savepoint.TriggerID
+		jobStatus.SavepointLocation = savepoint.Location
+		setTimestamp(&jobStatus.LastSavepointTime)
+	}
+	setTimestamp(&updated.Status.LastUpdateTime)
+	var err = reconciler.k8sClient.Status().Update(reconciler.context, updated)
+	if err != nil {
+		reconciler.log.Error(err, "Failed to update the rescale status")
+		return err
+	}
+	updated.Spec = cluster.Spec
+	reconciler.observed.cluster = updated
+	return nil
+}
+
+// Whether the TaskManagers are ready with the desired replicas, e.g., after
+// they have been scaled for the new parallelism of a rescaled job.
+func (reconciler *ClusterReconciler) isTaskManagerScaled() bool {
+	var desired = reconciler.desired
+	var observed = reconciler.observed
+	if desired.TmStatefulSet != nil {
+		return observed.tmStatefulSet != nil &&
+			observed.tmStatefulSet.Status.ReadyReplicas >=
+				*desired.TmStatefulSet.Spec.Replicas
+	}
+	if desired.TmDeployment != nil {
+		return observed.tmDeployment != nil &&
+			observed.tmDeployment.Status.AvailableReplicas >=
+				*desired.TmDeployment.Spec.Replicas
+	}
+	return true
+}
@@ -0,0 +1,375 @@
+/*
+Copyright 2019 Google LLC.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	v1beta1 "github.com/googlecloudplatform/flink-operator/api/v1beta1"
+	"github.com/googlecloudplatform/flink-operator/controllers/flinkclient"
+	"gotest.tools/assert"
+	batchv1 "k8s.io/api/batch/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// Records the stopped jobs, and returns the savepoint as their status.
+type rescaleFlinkClient struct {
+	flinkclient.FlinkClient
+	stopped      []string
+	savepoint    flinkclient.SavepointStatus
+	savepointErr error
+}
+
+func (c *rescaleFlinkClient) StopJobWithSavepoint(
+	apiBaseURL string,
+	jobID string,
+	dir string) (flinkclient.SavepointTriggerID, error) {
+	c.stopped = append(c.stopped, jobID)
+	return flinkclient.SavepointTriggerID{RequestID: "trigger-1"}, nil
+}
+
+func (c *rescaleFlinkClient) GetSavepointStatus(
+	apiBaseURL string,
+	jobID string,
+	triggerID string) (flinkclient.SavepointStatus, error) {
+	var status = c.savepoint
+	status.JobID = jobID
+	status.TriggerID = triggerID
+	return status, c.savepointErr
+}
+
+// Gets a session cluster running a job with parallelism 2.
+func getTestRescaleCluster() *v1beta1.FlinkCluster {
+	var jarFile = "/opt/flink/job/wordcount.jar"
+	var parallelism int32 = 2
+	var savepointsDir = "gs://my-bucket/savepoints/"
+	var cluster = getTestSessionCluster()
+	cluster.Spec.Job = &v1beta1.JobSpec{
+		JarFile:       jarFile,
+		Parallelism:   &parallelism,
+		SavepointsDir: &savepointsDir,
+	}
+	cluster.Status.Components.Job = &v1beta1.JobStatus{
+		Name:  "flinksessioncluster-sample-job",
+		ID:    "3f1a",
+		State: v1beta1.JobStateRunning,
+	}
+	return cluster
+}
+
+func TestIsRescaleRequired(t *testing.T) {
+	var cluster = getTestRescaleCluster()
+	var observedJob = getDesiredJob(cluster)
+
+	// The parallelism is unchanged.
+	assert.Assert(t, !isRescaleRequired(cluster, observedJob))
+
+	var parallelism int32 = 4
+	cluster.Spec.Job.Parallelism = &parallelism
+	assert.Assert(t, isRescaleRequired(cluster, observedJob))
+
+	// The job is not running yet.
+	cluster.Status.Components.Job.State = v1beta1.JobStatePending
+	assert.Assert(t, !isRescaleRequired(cluster, observedJob))
+	cluster.Status.Components.Job.State = v1beta1.JobStateRunning
+
+	// The rescale to the same parallelism failed.
+	cluster.Status.Components.Job.Rescale = &v1beta1.JobRescaleStatus{
+		FromParallelism: 2,
+		ToParallelism:   4,
+		Phase:           v1beta1.JobRescalePhaseFailed,
+	}
+	assert.Assert(t, !isRescaleRequired(cluster, observedJob))
+
+	// But the parallelism is updated again.
+	parallelism = 3
+	assert.Assert(t, isRescaleRequired(cluster, observedJob))
+
+	// The savepoints directory is required.
+	cluster.Spec.Job.SavepointsDir = nil
+	assert.Assert(t, !isRescaleRequired(cluster, observedJob))
+}
+
+func TestReconcileRescale(t *testing.T) {
+	var cluster = getTestRescaleCluster()
+	var observedJob = getDesiredJob(cluster)
+	var parallelism int32 = 4
+	cluster.Spec.Job.Parallelism = &parallelism
+	var testScheme = runtime.NewScheme()
+	assert.NilError(t, scheme.AddToScheme(testScheme))
+	assert.NilError(t, v1beta1.AddToScheme(testScheme))
+	var k8sClient = fake.NewFakeClientWithScheme(
+		testScheme, cluster, observedJob)
+	var flinkClient = &rescaleFlinkClient{}
+	var recorder = record.NewFakeRecorder(10)
+	var reconciler = ClusterReconciler{
+		k8sClient:   k8sClient,
+		flinkClient: flinkClient,
+		context:     context.Background(),
+		log:         log.Log,
+		recorder:    recorder,
+		observed: ObservedClusterState{
+			cluster: cluster,
+			job:     observedJob,
+		},
+		desired: getDesiredClusterState(cluster, time.Now()),
+	}
+	var getRescaleStatus = func() *v1beta1.JobRescaleStatus {
+		var updated = &v1beta1.FlinkCluster{}
+		var err = k8sClient.Get(
+			context.Background(),
+			types.NamespacedName{Namespace: cluster.Namespace, Name: cluster.Name},
+			updated)
+		assert.NilError(t, err)
+		assert.Equal(
+			t, updated.Status.Components.Job.State, v1beta1.JobStateRescaling)
+		return updated.Status.Components.Job.Rescale
+	}
+	var getJobs = func() []batchv1.Job {
+		var jobs = &batchv1.JobList{}
+		assert.NilError(t, k8sClient.List(context.Background(), jobs))
+		return jobs.Items
+	}
+
+	// The job is stopped with a savepoint.
+	assert.Assert(t, isRescaleRequired(cluster, observedJob))
+	assert.NilError(t, reconciler.startRescale("3f1a"))
+	assert.DeepEqual(t, flinkClient.stopped, []string{"3f1a"})
+	var rescale = getRescaleStatus()
+	assert.Equal(t, rescale.FromParallelism, int32(2))
+	assert.Equal(t, rescale.ToParallelism, int32(4))
+	assert.Equal(t, rescale.Phase, v1beta1.JobRescalePhaseStopping)
+	assert.Equal(t, rescale.TriggerID, "trigger-1")
+	assert.Equal(
+		t,
+		<-recorder.Events,
+		"Normal RescaleStarted Stopping the job with a savepoint to rescale it "+
+			"from parallelism 2 to 4")
+
+	// Waiting for the savepoint.
+	var _, err = reconciler.reconcileRescale()
+	assert.NilError(t, err)
+	assert.Equal(t, getRescaleStatus().Phase, v1beta1.JobRescalePhaseStopping)
+	assert.Equal(t, len(getJobs()), 1)
+
+	// The savepoint is completed, the job submitter is deleted.
+	flinkClient.savepoint = flinkclient.SavepointStatus{
+		Completed: true,
+		Location:  "gs://my-bucket/savepoints/savepoint-3f1a-1",
+	}
+	_, err = reconciler.reconcileRescale()
+	assert.NilError(t, err)
+	rescale = getRescaleStatus()
+	assert.Equal(t, rescale.Phase, v1beta1.JobRescalePhaseResubmitting)
+	assert.Equal(
+		t, rescale.SavepointLocation, "gs://my-bucket/savepoints/savepoint-3f1a-1")
+	assert.Equal(t, len(getJobs()), 0)
+
+	// Waiting for the TaskManagers to be scaled for the new parallelism.
+	reconciler.observed.job = nil
+	reconciler.desired = getDesiredClusterState(
+		reconciler.observed.cluster, time.Now())
+	var tmDeployment = reconciler.desired.TmDeployment.DeepCopy()
+	reconciler.observed.tmDeployment = tmDeployment
+	reconciler.observed.flinkJobList = &flinkclient.JobStatusList{}
+	_, err = reconciler.reconcileRescale()
+	assert.NilError(t, err)
+	assert.Equal(t, len(getJobs()), 0)
+
+	// The job is resubmitted from the savepoint.
+	tmDeployment.Status.AvailableReplicas = *tmDeployment.Spec.Replicas
+	_, err = reconciler.reconcileRescale()
+	assert.NilError(t, err)
+	var jobs = getJobs()
+	assert.Equal(t, len(jobs), 1)
+	assert.Equal(
+		t,
+		getFromSavepoint(jobs[0].Spec),
+		"gs://my-bucket/savepoints/savepoint-3f1a-1")
+	assert.Equal(t, getJobParallelism(jobs[0].Spec), int32(4))
+	assert.Equal(
+		t,
+		<-recorder.Events,
+		"Normal RescaleResubmitted Resubmitting the job with parallelism 4 "+
+			"from savepoint gs://my-bucket/savepoints/savepoint-3f1a-1")
+
+	// The resubmitted job is waited for.
+	reconciler.observed.job = &jobs[0]
+	_, err = reconciler.reconcileRescale()
+	assert.NilError(t, err)
+	assert.Equal(t, len(getJobs()), 1)
+}
+
+func TestReconcileRescaleDeletesStaleSubmitter(t *testing.T) {
+	var cluster = getTestRescaleCluster()
+	var parallelism int32 = 4
+	cluster.Spec.Job.Parallelism = &parallelism
+	cluster.Status.Components.Job.State = v1beta1.JobStateRescaling
+	cluster.Status.Components.Job.Rescale = &v1beta1.JobRescaleStatus{
+		FromParallelism:   2,
+		ToParallelism:     4,
+		Phase:             v1beta1.JobRescalePhaseResubmitting,
+		TriggerID:         "trigger-2",
+		SavepointLocation: "gs://my-bucket/savepoints/savepoint-3f1a-2",
+	}
+	// The submitter of an earlier rescale to the same parallelism, e.g.,
+	// before the parallelism was changed back after it failed.
+	var staleJob = getDesiredJob(cluster)
+	staleJob.Annotations[rescaleTriggerIDAnnotation] = "trigger-1"
+	assert.Equal(t, getJobParallelism(staleJob.Spec), int32(4))
+	var testScheme = runtime.NewScheme()
+	assert.NilError(t, scheme.AddToScheme(testScheme))
+	assert.NilError(t, v1beta1.AddToScheme(testScheme))
+	var k8sClient = fake.NewFakeClientWithScheme(
+		testScheme, cluster, staleJob)
+	var reconciler = ClusterReconciler{
+		k8sClient:   k8sClient,
+		flinkClient: &rescaleFlinkClient{},
+		context:     context.Background(),
+		log:         log.Log,
+		recorder:    record.NewFakeRecorder(10),
+		observed: ObservedClusterState{
+			cluster: cluster,
+			job:     staleJob,
+		},
+	}
+
+	var _, err = reconciler.reconcileRescale()
+	assert.NilError(t, err)
+	var jobs = &batchv1.JobList{}
+	assert.NilError(t, k8sClient.List(context.Background(), jobs))
+	assert.Equal(t, len(jobs.Items), 0)
+}
+
+func TestReconcileRescaleSavepointFailed(t *testing.T) {
+	var cluster = getTestRescaleCluster()
+	var observedJob = getDesiredJob(cluster)
+	cluster.Status.Components.Job.State = v1beta1.JobStateRescaling
+	cluster.Status.Components.Job.Rescale = &v1beta1.JobRescaleStatus{
+		FromParallelism: 2,
+		ToParallelism:   4,
+		Phase:           v1beta1.JobRescalePhaseStopping,
+		TriggerID:       "trigger-1",
+	}
+	var testScheme = runtime.NewScheme()
+	assert.NilError(t, scheme.AddToScheme(testScheme))
+	assert.NilError(t, v1beta1.AddToScheme(testScheme))
+	var k8sClient = fake.NewFakeClientWithScheme(
+		testScheme, cluster, observedJob)
+	var recorder = record.NewFakeRecorder(10)
+	var reconciler = ClusterReconciler{
+		k8sClient: k8sClient,
+		flinkClient: &rescaleFlinkClient{
+			savepoint: flinkclient.SavepointStatus{
+				Completed: true,
+				FailureCause: flinkclient.SavepointFailureCause{
+					ExceptionClass: "java.util.concurrent.CompletionException",
+					StackTrace:     "...",
+				},
+			},
+		},
+		context:  context.Background(),
+		log:      log.Log,
+		recorder: recorder,
+		observed: ObservedClusterState{
+			cluster: cluster,
+			job:     observedJob,
+		},
+	}
+
+	// The job keeps running, and the rescale is not retried.
+	var _, err = reconciler.reconcileRescale()
+	assert.NilError(t, err)
+	var jobStatus = reconciler.observed.cluster.Status.Components.Job
+	assert.Equal(t, jobStatus.Rescale.Phase, v1beta1.JobRescalePhaseFailed)
+	assert.Equal(
+		t,
+		jobStatus.Rescale.FailureReason,
+		"java.util.concurrent.CompletionException")
+	assert.Assert(t, !isJobRescaling(jobStatus))
+	assert.Equal(
+		t,
+		<-recorder.Events,
+		"Warning RescaleFailed Failed to stop the job with a savepoint, it keeps "+
+			"running with parallelism 2: java.util.concurrent.CompletionException")
+}
+
+func TestReconcileRescaleSavepointTimeout(t *testing.T) {
+	var tc = &TimeConverter{}
+	var cluster = getTestRescaleCluster()
+	var observedJob = getDesiredJob(cluster)
+	cluster.Status.Components.Job.State = v1beta1.JobStateRescaling
+	cluster.Status.Components.Job.Rescale = &v1beta1.JobRescaleStatus{
+		FromParallelism: 2,
+		ToParallelism:   4,
+		Phase:           v1beta1.JobRescalePhaseStopping,
+		TriggerID:       "trigger-1",
+		StartTime:       tc.ToString(time.Now()),
+	}
+	var testScheme = runtime.NewScheme()
+	assert.NilError(t, scheme.AddToScheme(testScheme))
+	assert.NilError(t, v1beta1.AddToScheme(testScheme))
+	var k8sClient = fake.NewFakeClientWithScheme(
+		testScheme, cluster, observedJob)
+	var recorder = record.NewFakeRecorder(10)
+	var reconciler = ClusterReconciler{
+		k8sClient: k8sClient,
+		flinkClient: &rescaleFlinkClient{
+			savepointErr: fmt.Errorf("savepoint trigger not found"),
+		},
+		context:  context.Background(),
+		log:      log.Log,
+		recorder: recorder,
+		observed: ObservedClusterState{
+			cluster: cluster,
+			job:     observedJob,
+		},
+	}
+
+	// The savepoint status is retried until the deadline.
+	var result, err = reconciler.reconcileRescale()
+	assert.NilError(t, err)
+	assert.DeepEqual(t, result, requeueResult)
+	var jobStatus = reconciler.observed.cluster.Status.Components.Job
+	assert.Equal(t, jobStatus.Rescale.Phase, v1beta1.JobRescalePhaseStopping)
+
+	// After the deadline, the rescale fails.
+	jobStatus.Rescale.StartTime = tc.ToString(
+		time.Now().Add(-rescaleSavepointTimeout - time.Minute))
+	_, err = reconciler.reconcileRescale()
+	assert.NilError(t, err)
+	jobStatus = reconciler.observed.cluster.Status.Components.Job
+	assert.Equal(t, jobStatus.Rescale.Phase, v1beta1.JobRescalePhaseFailed)
+	assert.Equal(
+		t,
+		jobStatus.Rescale.FailureReason,
+		"savepoint did not complete within 10m0s")
+	assert.Assert(t, !isJobRescaling(jobStatus))
+	assert.Equal(
+		t,
+		<-recorder.Events,
+		"Warning RescaleFailed Failed to stop the job with a savepoint, it keeps "+
+			"running with parallelism 2: savepoint did not complete within 10m0s")
+}
@@ -0,0 +1,79 @@
+/*
+Copyright 2019 Google LLC.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	v1beta1 "github.com/googlecloudplatform/flink-operator/api/v1beta1"
+	appsv1 "k8s.io/api/apps/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+var _ = Describe("FlinkCluster scale subresource", func() {
+	It("scales the TaskManager deployment", func() {
+		var ctx = context.Background()
+		var cluster = getTestSessionCluster()
+		var clusterKey = types.NamespacedName{
+			Namespace: cluster.Namespace, Name: cluster.Name}
+		Expect(k8sClient.Create(ctx, cluster)).To(Succeed())
+		var desired = getDesiredClusterState(cluster, time.Now())
+		Expect(k8sClient.Create(ctx, desired.TmDeployment)).To(Succeed())
+
+		// Scale the cluster like `kubectl scale flinkcluster --replicas=5`.
+		var clientset, err = kubernetes.NewForConfig(cfg)
+		Expect(err).NotTo(HaveOccurred())
+		err = clientset.CoreV1().RESTClient().
+			Patch(types.MergePatchType).
+			AbsPath(
+				"/apis/flinkoperator.k8s.io/v1beta1/namespaces", cluster.Namespace,
+				"flinkclusters", cluster.Name, "scale").
+			Body([]byte(`{"spec":{"replicas":5}}`)).
+			Do().
+			Error()
+		Expect(err).NotTo(HaveOccurred())
+
+		var scaled = &v1beta1.FlinkCluster{}
+		Expect(k8sClient.Get(ctx, clusterKey, scaled)).To(Succeed())
+		Expect(scaled.Spec.TaskManager.Replicas).To(Equal(int32(5)))
+
+		var observedDeployment = &appsv1.Deployment{}
+		var deploymentKey = types.NamespacedName{
+			Namespace: cluster.Namespace, Name: desired.TmDeployment.Name}
+		Expect(k8sClient.Get(ctx, deploymentKey, observedDeployment)).To(Succeed())
+		var reconciler = ClusterReconciler{
+			k8sClient: k8sClient,
+			context:   ctx,
+			log:       log.Log,
+			desired:   getDesiredClusterState(scaled, time.Now()),
+			observed: ObservedClusterState{
+				cluster:      scaled,
+				tmDeployment: observedDeployment,
+			},
+		}
+		Expect(reconciler.reconcileTaskManagerDeployment()).To(Succeed())
+
+		Expect(k8sClient.Get(ctx, deploymentKey, observedDeployment)).To(Succeed())
+		Expect(*observedDeployment.Spec.Replicas).To(Equal(int32(5)))
+	})
+})
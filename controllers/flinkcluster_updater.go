@@ -21,18 +21,34 @@ package controllers
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
+	"net"
+	"net/url"
 	"reflect"
+	"sort"
 	"time"
 
 	"github.com/go-logr/logr"
 	v1beta1 "github.com/googlecloudplatform/flink-operator/api/v1beta1"
+	"github.com/googlecloudplatform/flink-operator/controllers/flinkclient"
 	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
 	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/client-go/tools/record"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 )
 
+// The maximum number of the state transitions in the status history.
+const statusHistoryLimit = 10
+
+// The number of consecutive JobManager metrics snapshots with the heap usage
+// above the memory pressure ratio before the JobManager is flagged.
+const highMemoryPressureSamples = 2
+
 // ClusterStatusUpdater updates the status of the FlinkCluster CR.
 type ClusterStatusUpdater struct {
 	k8sClient client.Client
@@ -40,6 +56,20 @@ type ClusterStatusUpdater struct {
 	log       logr.Logger
 	recorder  record.EventRecorder
 	observed  ObservedClusterState
+	debouncer *StatusDebouncer
+	batcher   *StatusBatcher
+
+	// The rest of the debounce window or batching interval when a status
+	// change was skipped, the status should be updated again after it.
+	debounceRemaining time.Duration
+
+	// The cluster state derived by the last status update, even if it was
+	// not written, e.g., when it was debounced.
+	derivedState string
+
+	// The JobManager is flagged NotReady when its heap usage stays above
+	// this ratio of the maximum heap, 0 disables it.
+	memoryPressureRatio float64
 }
 
 // Compares the current status recorded in the cluster's status field and the
@@ -60,21 +90,63 @@ func (updater *ClusterStatusUpdater) updateStatusIfChanged() (
 	// New status derived from the cluster's components.
 	var newStatus = updater.deriveClusterStatus(
 		&updater.observed.cluster.Status, &updater.observed)
+	updater.derivedState = newStatus.State
+
+	var clusterName = types.NamespacedName{
+		Namespace: updater.observed.cluster.ObjectMeta.Namespace,
+		Name:      updater.observed.cluster.ObjectMeta.Name,
+	}
+	updateBackpressureMetrics(clusterName, newStatus.BackpressureStatus)
 
 	// Compare
 	var changed = updater.isStatusChanged(oldStatus, newStatus)
 
+	// Debounce
+	var now = time.Now()
+	if changed && updater.debouncer != nil {
+		var skip, remaining = updater.debouncer.ShouldSkip(
+			clusterName, &oldStatus, &newStatus, now)
+		if skip {
+			updater.log.Info(
+				"Skip status flap within the debounce window",
+				"remaining",
+				remaining)
+			updater.debounceRemaining = remaining
+			return false, nil
+		}
+	}
+	if changed && updater.batcher != nil {
+		var skip, remaining = updater.batcher.ShouldSkip(
+			updater.observed.cluster.UID, &oldStatus, &newStatus, now)
+		if skip {
+			updater.log.Info(
+				"Skip status change within the batching interval",
+				"remaining",
+				remaining)
+			updater.debounceRemaining = remaining
+			return false, nil
+		}
+	}
+
 	// Update
 	if changed {
 		updater.log.Info(
 			"Status changed",
-			"old",
+			"oldStatus",
 			updater.observed.cluster.Status,
-			"new", newStatus)
+			"newStatus", newStatus)
 		updater.createStatusChangeEvents(oldStatus, newStatus)
 		var tc = &TimeConverter{}
-		newStatus.LastUpdateTime = tc.ToString(time.Now())
-		return true, updater.updateClusterStatus(newStatus)
+		newStatus.LastUpdateTime = tc.ToString(now)
+		newStatus.History = getStatusHistory(&oldStatus, &newStatus, now)
+		var err = updater.updateClusterStatus(newStatus)
+		if err == nil && updater.debouncer != nil {
+			updater.debouncer.Record(clusterName, &newStatus, now)
+		}
+		if err == nil && updater.batcher != nil {
+			updater.batcher.Record(updater.observed.cluster.UID, now)
+		}
+		return true, err
 	}
 
 	updater.log.Info("No status change", "state", oldStatus.State)
@@ -132,6 +204,29 @@ func (updater *ClusterStatusUpdater) createStatusChangeEvents(
 			oldStatus.Components.TaskManagerDeployment.State,
 			newStatus.Components.TaskManagerDeployment.State)
 	}
+	var newTmStatus = newStatus.Components.TaskManagerDeployment
+	if newTmStatus.Reason == v1beta1.ComponentReasonMemoryMismatch &&
+		oldStatus.Components.TaskManagerDeployment.Reason !=
+			newTmStatus.Reason {
+		updater.recorder.Event(
+			updater.observed.cluster,
+			"Warning",
+			v1beta1.ComponentReasonMemoryMismatch,
+			"TaskManager containers were OOMKilled, "+
+				"check that the memory limit fits the memory configured for Flink")
+	}
+	if newTmStatus.LastScaleTime !=
+		oldStatus.Components.TaskManagerDeployment.LastScaleTime &&
+		len(newTmStatus.ScaleReason) > 0 {
+		updater.recorder.Event(
+			updater.observed.cluster,
+			"Normal",
+			"Autoscaling",
+			fmt.Sprintf(
+				"TaskManager desired replicas changed to %v: %v",
+				newTmStatus.DesiredReplicas,
+				newTmStatus.ScaleReason))
+	}
 
 	// Job.
 	if oldStatus.Components.Job == nil && newStatus.Components.Job != nil {
@@ -146,6 +241,18 @@ func (updater *ClusterStatusUpdater) createStatusChangeEvents(
 			newStatus.Components.Job.State)
 	}
 
+	var newJobStatus = newStatus.Components.Job
+	if newJobStatus != nil && newJobStatus.State == v1beta1.JobStateFailed &&
+		len(newJobStatus.FailureReason) > 0 &&
+		(oldStatus.Components.Job == nil ||
+			oldStatus.Components.Job.State != v1beta1.JobStateFailed) {
+		updater.recorder.Event(
+			updater.observed.cluster,
+			"Warning",
+			"JobFailed",
+			newJobStatus.FailureReason)
+	}
+
 	// Cluster.
 	if oldStatus.State != newStatus.State {
 		updater.createStatusChangeEvent("Cluster", oldStatus.State, newStatus.State)
@@ -174,9 +281,10 @@ func (updater *ClusterStatusUpdater) deriveClusterStatus(
 	recorded *v1beta1.FlinkClusterStatus,
 	observed *ObservedClusterState) v1beta1.FlinkClusterStatus {
 	var status = v1beta1.FlinkClusterStatus{}
-	var runningComponents = 0
-	// jmDeployment, jmService, tmDeployment.
-	var totalComponents = 3
+	// The components requested by the spec must all be ready for the cluster
+	// to be running.
+	var requiredComponents = getExpectedComponents(observed.cluster)
+	var readyRequiredComponents = 0
 
 	// ConfigMap.
 	var observedConfigMap = observed.configMap
@@ -200,9 +308,44 @@ func (updater *ClusterStatusUpdater) deriveClusterStatus(
 			observedJmDeployment.ObjectMeta.Name
 		status.Components.JobManagerDeployment.State =
 			getDeploymentState(observedJmDeployment)
+		deriveJobManagerLeader(&status.Components.JobManagerDeployment, observed)
 		if status.Components.JobManagerDeployment.State ==
 			v1beta1.ComponentStateReady {
-			runningComponents++
+			readyRequiredComponents++
+		} else {
+			if len(status.Components.JobManagerDeployment.Reason) == 0 {
+				status.Components.JobManagerDeployment.Reason =
+					getMissingConfigReason(observed)
+			}
+			if len(status.Components.JobManagerDeployment.Reason) == 0 {
+				status.Components.JobManagerDeployment.Reason =
+					getMissingPullSecretReason(observed, observed.jmPods)
+			}
+			if len(status.Components.JobManagerDeployment.Reason) == 0 {
+				status.Components.JobManagerDeployment.Reason =
+					getJarDownloadReason(observed.jmPods)
+			}
+			if len(status.Components.JobManagerDeployment.Reason) == 0 {
+				status.Components.JobManagerDeployment.Reason =
+					getSidecarNotReadyReason(
+						observed.jmPods, observed.cluster.Spec.JobManager.Sidecars)
+			}
+		}
+		var metrics = deriveJobManagerMetrics(
+			recorded.Components.JobManagerDeployment.Metrics,
+			observed.jmMetrics,
+			updater.memoryPressureRatio)
+		status.Components.JobManagerDeployment.Metrics = metrics
+		// The JobManager still serves under memory pressure, so it is only
+		// flagged and still counted as ready for the cluster state.
+		if status.Components.JobManagerDeployment.State ==
+			v1beta1.ComponentStateReady &&
+			metrics != nil &&
+			metrics.HighHeapSamples >= highMemoryPressureSamples {
+			status.Components.JobManagerDeployment.State =
+				v1beta1.ComponentStateNotReady
+			status.Components.JobManagerDeployment.Reason =
+				v1beta1.ComponentReasonHighMemoryPressure
 		}
 	} else if recorded.Components.JobManagerDeployment.Name != "" {
 		status.Components.JobManagerDeployment =
@@ -220,21 +363,21 @@ func (updater *ClusterStatusUpdater) deriveClusterStatus(
 		if observedJmService.Spec.Type == corev1.ServiceTypeClusterIP {
 			if observedJmService.Spec.ClusterIP != "" {
 				state = v1beta1.ComponentStateReady
-				runningComponents++
+				readyRequiredComponents++
 			} else {
 				state = v1beta1.ComponentStateNotReady
 			}
 		} else if observedJmService.Spec.Type == corev1.ServiceTypeLoadBalancer {
 			if len(observedJmService.Status.LoadBalancer.Ingress) > 0 {
 				state = v1beta1.ComponentStateReady
-				runningComponents++
+				readyRequiredComponents++
 			} else {
 				state = v1beta1.ComponentStateNotReady
 			}
 		} else if observedJmService.Spec.Type == corev1.ServiceTypeNodePort {
 			if len(observedJmService.Spec.Ports) > 0 {
 				state = v1beta1.ComponentStateReady
-				runningComponents++
+				readyRequiredComponents++
 				for _, port := range observedJmService.Spec.Ports {
 					if port.Name == "ui" {
 						nodePort = port.NodePort
@@ -248,9 +391,11 @@ func (updater *ClusterStatusUpdater) deriveClusterStatus(
 
 		status.Components.JobManagerService =
 			v1beta1.JobManagerServiceStatus{
-				Name:  observedJmService.ObjectMeta.Name,
-				State: state,
+				Name:     observedJmService.ObjectMeta.Name,
+				State:    state,
 				NodePort: nodePort,
+				WebUIURL: getWebUIURL(
+					observed.cluster, observedJmService, observed.jmPods),
 			}
 	} else if recorded.Components.JobManagerService.Name != "" {
 		status.Components.JobManagerService =
@@ -318,8 +463,12 @@ func (updater *ClusterStatusUpdater) deriveClusterStatus(
 		}
 
 		// Jobmanager ingress state become ready when LB for ingress is specified.
+		// An ingress which is no longer in the spec is not counted.
 		if loadbalancerReady {
 			state = v1beta1.ComponentStateReady
+			if observed.cluster.Spec.JobManager.Ingress != nil {
+				readyRequiredComponents++
+			}
 		} else {
 			state = v1beta1.ComponentStateNotReady
 		}
@@ -339,17 +488,87 @@ func (updater *ClusterStatusUpdater) deriveClusterStatus(
 			}
 	}
 
-	// TaskManager deployment.
+	// TaskManager deployment, or the StatefulSet instead when the TaskManagers
+	// have volume claim templates, whose readiness is mapped the same way.
 	var observedTmDeployment = observed.tmDeployment
-	if observedTmDeployment != nil {
-		status.Components.TaskManagerDeployment.Name =
-			observedTmDeployment.ObjectMeta.Name
-		status.Components.TaskManagerDeployment.State =
-			getDeploymentState(observedTmDeployment)
+	var observedTmStatefulSet = observed.tmStatefulSet
+	if observedTmDeployment != nil || observedTmStatefulSet != nil {
+		var tmSelector *metav1.LabelSelector
+		if observedTmStatefulSet != nil {
+			status.Components.TaskManagerDeployment.Name =
+				observedTmStatefulSet.ObjectMeta.Name
+			status.Components.TaskManagerDeployment.State =
+				getStatefulSetState(observedTmStatefulSet)
+			status.Components.TaskManagerDeployment.Replicas =
+				observedTmStatefulSet.Status.Replicas
+			tmSelector = observedTmStatefulSet.Spec.Selector
+		} else {
+			status.Components.TaskManagerDeployment.Name =
+				observedTmDeployment.ObjectMeta.Name
+			status.Components.TaskManagerDeployment.State =
+				getDeploymentState(observedTmDeployment)
+			status.Components.TaskManagerDeployment.Replicas =
+				observedTmDeployment.Status.Replicas
+			tmSelector = observedTmDeployment.Spec.Selector
+		}
+		if tmSelector != nil {
+			status.Selector = metav1.FormatLabelSelector(tmSelector)
+		}
+		if hasCrashLoopingPod(observed.tmPods) {
+			status.Components.TaskManagerDeployment.State =
+				v1beta1.ComponentStateCrashLoopBackOff
+		}
 		if status.Components.TaskManagerDeployment.State ==
 			v1beta1.ComponentStateReady {
-			runningComponents++
+			readyRequiredComponents++
+		} else if status.Components.TaskManagerDeployment.State ==
+			v1beta1.ComponentStateNotReady {
+			status.Components.TaskManagerDeployment.Reason =
+				getMissingConfigReason(observed)
+			if len(status.Components.TaskManagerDeployment.Reason) == 0 {
+				status.Components.TaskManagerDeployment.Reason =
+					getMissingPullSecretReason(observed, observed.tmPods)
+			}
+		}
+		// A crash looping sidecar is distinguished from the Flink container.
+		if status.Components.TaskManagerDeployment.State !=
+			v1beta1.ComponentStateReady &&
+			len(status.Components.TaskManagerDeployment.Reason) == 0 {
+			status.Components.TaskManagerDeployment.Reason =
+				getSidecarNotReadyReason(
+					observed.tmPods, observed.cluster.Spec.TaskManager.Sidecars)
+		}
+		// The restarted containers might be ready again, the reason is kept
+		// in any state to explain the restarts.
+		if len(status.Components.TaskManagerDeployment.Reason) == 0 &&
+			hasOOMKilledPod(observed.tmPods) {
+			status.Components.TaskManagerDeployment.Reason =
+				v1beta1.ComponentReasonMemoryMismatch
+		}
+		if isTaskManagerScalingDown(observed) {
+			if len(status.Components.TaskManagerDeployment.Reason) == 0 {
+				status.Components.TaskManagerDeployment.Reason =
+					v1beta1.ComponentReasonDraining
+			}
+			// The drain timeout counts from the start of the scale-down.
+			var drainStartTime = recorded.Components.TaskManagerDeployment.DrainStartTime
+			if len(drainStartTime) == 0 {
+				var tc = &TimeConverter{}
+				drainStartTime = tc.ToString(time.Now())
+			}
+			status.Components.TaskManagerDeployment.DrainStartTime = drainStartTime
+		}
+		// The replicas of the spec are not raised for the job parallelism.
+		if len(status.Components.TaskManagerDeployment.Reason) == 0 &&
+			hasInsufficientSlots(observed) {
+			status.Components.TaskManagerDeployment.Reason =
+				v1beta1.ComponentReasonInsufficientSlots
 		}
+		deriveTaskManagerAutoscaling(
+			recorded.Components.TaskManagerDeployment,
+			observed,
+			&status.Components.TaskManagerDeployment,
+			time.Now())
 	} else if recorded.Components.TaskManagerDeployment.Name != "" {
 		status.Components.TaskManagerDeployment =
 			v1beta1.FlinkClusterComponentState{
@@ -358,6 +577,35 @@ func (updater *ClusterStatusUpdater) deriveClusterStatus(
 			}
 	}
 
+	// In native mode, there are only the JobManager and TaskManager pods
+	// created by Flink, which are required once the job is submitted.
+	if isNativeMode(observed.cluster) {
+		var namer = NewResourceNamer(observed.cluster)
+		status.Components.JobManagerDeployment = deriveNativeComponentState(
+			namer.NativeClusterID(), observed.jmPods)
+		deriveJobManagerLeader(&status.Components.JobManagerDeployment, observed)
+		status.Components.TaskManagerDeployment = deriveNativeComponentState(
+			namer.TaskManagerDeploymentName(), observed.tmPods)
+		for _, state := range []string{
+			status.Components.JobManagerDeployment.State,
+			status.Components.TaskManagerDeployment.State} {
+			if state == v1beta1.ComponentStateReady {
+				readyRequiredComponents++
+			}
+		}
+	}
+
+	// (Optional) TaskManager pool deployments. The pools which are being
+	// removed from the spec are not counted.
+	status.Components.TaskManagerPools = deriveTaskManagerPoolsStatus(
+		recorded.Components.TaskManagerPools, observed.tmPools)
+	for _, pool := range observed.cluster.Spec.TaskManager.Pools {
+		var poolState, ok = status.Components.TaskManagerPools[pool.Name]
+		if ok && poolState.State == v1beta1.ComponentStateReady {
+			readyRequiredComponents++
+		}
+	}
+
 	// (Optional) Job.
 	var jobStopped = false
 	var jobSucceeded = false
@@ -366,42 +614,151 @@ func (updater *ClusterStatusUpdater) deriveClusterStatus(
 	var observedJob = observed.job
 	var recordedJobStatus = recorded.Components.Job
 	var jobStatus *v1beta1.JobStatus
-	if observedJob != nil {
+	if isJobRescaling(recordedJobStatus) &&
+		!isRescaledJobSubmitted(recordedJobStatus.Rescale, observedJob) {
+		// The job is being stopped with a savepoint or resubmitted, the job
+		// submitter of the stopped job is not observed for its state.
+		jobStatus = recordedJobStatus.DeepCopy()
+		jobStatus.State = v1beta1.JobStateRescaling
+	} else if observedJob != nil && isNativeMode(observed.cluster) {
+		// The submitter exits once the application cluster is deployed, the
+		// job is observed from Flink afterwards.
+		jobStatus = deriveNativeJobStatus(
+			recordedJobStatus, observedJob, observed.flinkJobList)
+		switch jobStatus.State {
+		case v1beta1.JobStateSucceeded:
+			jobStopped = true
+			jobSucceeded = true
+		case v1beta1.JobStateFailed:
+			jobStopped = true
+			jobFailed = true
+		case v1beta1.JobStateCancelled:
+			jobStopped = true
+			jobCancelled = true
+		}
+	} else if observedJob != nil {
 		jobStatus = &v1beta1.JobStatus{}
 		if recordedJobStatus != nil {
 			recordedJobStatus.DeepCopyInto(jobStatus)
 		}
 		jobStatus.Name = observedJob.ObjectMeta.Name
+		jobStatus.Reason = ""
 		jobStatus.FromSavepoint = getFromSavepoint(observedJob.Spec)
 		var flinkJobID = updater.getFlinkJobID()
 		if flinkJobID != nil {
 			jobStatus.ID = *flinkJobID
 		}
 
-		if observedJob.Status.Failed > 0 {
+		if isSubmitJobDeadlineExceeded(observedJob) {
+			// Not restarted by the restart policy, which is for the failures
+			// of the running job.
+			jobStatus.State = v1beta1.JobStateSubmitTimeout
+			jobStopped = true
+			jobFailed = true
+		} else if failed := getJobCondition(
+			observedJob, batchv1.JobFailed); failed != nil {
 			jobStatus.State = v1beta1.JobStateFailed
+			jobStatus.Reason = getJarDownloadReason(observed.jobPods)
+			jobStatus.FailureReason = failed.Message
+			if len(jobStatus.FailureReason) == 0 {
+				jobStatus.FailureReason = failed.Reason
+			}
 			jobStopped = true
 			jobFailed = true
-		} else if observedJob.Status.Succeeded > 0 {
+			// Schedule the restart when the failure is first observed.
+			var jobSpec = observed.cluster.Spec.Job
+			if (recordedJobStatus == nil ||
+				recordedJobStatus.State != v1beta1.JobStateFailed) &&
+				shouldRestartJob(jobSpec, jobStatus) {
+				var tc = &TimeConverter{}
+				var delay = getJobRestartDelay(
+					jobSpec.RestartBackoff, jobStatus.RestartCount)
+				jobStatus.NextRestartTime = tc.ToString(time.Now().Add(delay))
+			}
+		} else if getJobCondition(observedJob, batchv1.JobComplete) != nil {
 			jobStatus.State = v1beta1.JobStateSucceeded
+			jobStatus.FailureReason = ""
 			jobStopped = true
 			jobSucceeded = true
+		} else if observedJob.Status.Failed > 0 {
+			// The failure is not final until the Kubernetes job sets its
+			// Failed condition.
+			jobStatus.State = v1beta1.JobStateRetrying
+			jobStatus.Reason = getJarDownloadReason(observed.jobPods)
 		} else {
 			// When job status is Active, it is possible that the pod is still
 			// Pending (for scheduling), so we use Flink job ID to determine
 			// the actual state.
 			if flinkJobID == nil {
 				jobStatus.State = v1beta1.JobStatePending
+				if hasInsufficientSlots(observed) {
+					jobStatus.Reason = v1beta1.ComponentReasonInsufficientSlots
+				} else {
+					jobStatus.Reason = getJarDownloadReason(observed.jobPods)
+				}
+			} else if observed.flinkOverview != nil &&
+				observed.flinkOverview.JobsRunning == 0 {
+				// The job ID is known, but Flink reports no running job, e.g.,
+				// the job is being scheduled or restarted by Flink.
+				jobStatus.State = v1beta1.JobStatePending
+				if hasInsufficientSlots(observed) {
+					jobStatus.Reason = v1beta1.ComponentReasonInsufficientSlots
+				}
 			} else {
 				jobStatus.State = v1beta1.JobStateRunning
+				deriveCheckpointHealth(
+					observed.cluster.Spec.Job,
+					recordedJobStatus,
+					observed.flinkCheckpoints,
+					jobStatus,
+					time.Now())
 			}
 			if recordedJobStatus != nil && (recordedJobStatus.State ==
 				v1beta1.JobStateFailed ||
 				recordedJobStatus.State == v1beta1.JobStateCancelled) {
 				jobStatus.RestartCount++
 			}
+			jobStatus.NextRestartTime = ""
+			jobStatus.FailureReason = ""
+		}
+		// The rescale is finished once the resubmitted job is running or
+		// stopped.
+		if isJobRescaling(jobStatus) &&
+			jobStatus.State != v1beta1.JobStatePending &&
+			jobStatus.State != v1beta1.JobStateRetrying {
+			jobStatus.Rescale = nil
 		}
-	} else if recordedJobStatus != nil {
+	} else if recordedJobStatus != nil && (isStreamGraphJob(observed.cluster) ||
+		isRESTSubmittedJob(observed.cluster)) {
+		// There is no job submitter, the submission and the ID of the
+		// submitted job are recorded by the reconciler and the job is
+		// observed from Flink afterwards.
+		jobStatus = recordedJobStatus.DeepCopy()
+		if jobStatus.State == v1beta1.JobStatePending ||
+			jobStatus.State == v1beta1.JobStateRunning {
+			jobStatus.State = getRESTSubmittedJobState(
+				jobStatus, observed.flinkJobList)
+		}
+		switch jobStatus.State {
+		case v1beta1.JobStateSucceeded:
+			jobStopped = true
+			jobSucceeded = true
+		case v1beta1.JobStateFailed:
+			jobStopped = true
+			jobFailed = true
+		case v1beta1.JobStateCancelled:
+			jobStopped = true
+			jobCancelled = true
+		}
+	} else if observed.cluster.Spec.Job == nil {
+		// A session cluster, whose jobs are submitted by its users, so they
+		// don't change the state of the cluster.
+		if observed.cluster.Spec.ObserveSessionJobs {
+			jobStatus = deriveSessionJobStatus(
+				recordedJobStatus, observed.flinkJobList)
+		}
+	} else if recordedJobStatus != nil &&
+		recordedJobStatus.Reason != v1beta1.ComponentReasonJobNotCreated {
 		jobStatus = recordedJobStatus.DeepCopy()
 		jobStopped = true
 		var cancelRequested = observed.cluster.Spec.Job.CancelRequested
@@ -409,56 +766,973 @@ func (updater *ClusterStatusUpdater) deriveClusterStatus(
 			jobStatus.State = v1beta1.JobStateCancelled
 			jobCancelled = true
 		}
+	} else if readyRequiredComponents == requiredComponents &&
+		isJobSubmitterExpected(observed.cluster) {
+		// The job should have been created once the other components are
+		// ready, make its absence visible instead of leaving the status nil.
+		jobStatus = &v1beta1.JobStatus{
+			Name:   NewResourceNamer(observed.cluster).JobName(),
+			State:  v1beta1.JobStateUnknown,
+			Reason: v1beta1.ComponentReasonJobNotCreated,
+		}
 	}
 	status.Components.Job = jobStatus
 
+	// (Optional) traffic splitting.
+	status.Components.TrafficSplitting = deriveTrafficSplittingStatus(
+		recorded.Components.TrafficSplitting, observed)
+
+	// (Optional) Grafana dashboard.
+	status.Components.GrafanaDashboard = deriveGrafanaDashboardStatus(observed)
+
+	status.ReadyComponents = readyRequiredComponents
+	status.TotalComponents = requiredComponents
+
 	// Derive the new cluster state.
-	switch recorded.State {
-	case "", v1beta1.ClusterStateCreating:
-		if runningComponents < totalComponents {
-			status.State = v1beta1.ClusterStateCreating
-		} else {
-			status.State = v1beta1.ClusterStateRunning
-		}
-	case v1beta1.ClusterStateRunning,
-		v1beta1.ClusterStateReconciling:
-		if jobStopped {
-			var policy = observed.cluster.Spec.Job.CleanupPolicy
-			if jobSucceeded &&
-				policy.AfterJobSucceeds != v1beta1.CleanupActionKeepCluster {
-				status.State = v1beta1.ClusterStateStopping
-			} else if jobFailed &&
-				policy.AfterJobFails != v1beta1.CleanupActionKeepCluster {
-				status.State = v1beta1.ClusterStateStopping
-			} else if jobCancelled &&
-				policy.AfterJobCancelled != v1beta1.CleanupActionKeepCluster {
-				status.State = v1beta1.ClusterStateStopping
-			} else {
-				status.State = v1beta1.ClusterStateRunning
+	var jobSpec = observed.cluster.Spec.Job
+	var observedState = v1beta1.ObservedState{
+		RecordedState:           recorded.State,
+		RequiredComponents:      requiredComponents,
+		ReadyRequiredComponents: readyRequiredComponents,
+		JobStopped:              jobStopped,
+		JobSucceeded:            jobSucceeded,
+		JobFailed:               jobFailed,
+		JobCancelled:            jobCancelled,
+		ReadinessTimeoutRetried: isReadinessTimeoutRetried(
+			recorded, observed.cluster),
+		Suspend:      observed.cluster.Spec.Suspend,
+		ScaledToZero: isScaledToZero(observed),
+		Unhealthy:    observed.unhealthy,
+	}
+	if jobStopped {
+		observedState.JobRestartLimitReached = isJobRestartLimitReached(
+			jobSpec, jobStatus)
+		observedState.JobRestartPending = shouldRestartJob(jobSpec, jobStatus)
+		observedState.CleanupPolicy = jobSpec.CleanupPolicy
+	}
+	status.State = v1beta1.DeriveState(observedState)
+
+	// Fail the cluster if it does not become ready in time.
+	deriveReadinessTimeout(recorded, observed.cluster, &status, time.Now())
+
+	// Backpressure of the job vertices.
+	status.BackpressureStatus = deriveBackpressureStatus(recorded, observed)
+
+	// Throughput and backpressure of the running job.
+	status.JobMetrics = deriveJobMetrics(
+		recorded, observed, status.BackpressureStatus)
+
+	// Flink cluster overview.
+	status.Flink = deriveFlinkStatus(recorded.Flink, observed.flinkOverview)
+
+	// Conditions are set by the reconciler.
+	status.Conditions = recorded.Conditions
+
+	// The last diagnostics bundle is recorded by the reconciler.
+	status.LastDiagnosticsBundleURI = recorded.LastDiagnosticsBundleURI
+
+	// The time when the job succeeded, which triggers the success hooks.
+	status.CompletionTime = getCompletionTime(recorded, jobStatus, time.Now())
+
+	// The effective Flink config, kept when the ConfigMap is not observed,
+	// e.g., after it has been cleaned up.
+	status.EffectiveConfig, status.EffectiveConfigChecksum =
+		deriveEffectiveConfig(recorded, observed)
+
+	// State transitions are appended when the status is written.
+	status.History = recorded.History
+
+	// Estimated rollout time of the TaskManagers.
+	var tmSpec = observed.cluster.Spec.TaskManager
+	status.EstimatedRolloutSeconds = tmSpec.MinReadySeconds * tmSpec.Replicas
+
+	// Parallelism of the job on the observed TaskManager deployment.
+	status.EffectiveParallelism = getEffectiveParallelism(observed)
+
+	// Free task slots of the registered TaskManagers.
+	status.AvailableSlots = deriveAvailableSlots(recorded, &status, observed)
+
+	// Record the time of component state transitions.
+	setLastTransitionTimes(recorded, &status, time.Now())
+
+	// Summary of the status, e.g., what the cluster is waiting for.
+	status.Message = getStatusMessage(&status, observed)
+
+	return status
+}
+
+// Gets the number of the components requested by the spec of the cluster,
+// i.e., the JobManager deployment and service, the TaskManager deployment or
+// StatefulSet, and the JobManager ingress and the TaskManager pools when they
+// are configured. In native mode, there are only the JobManager and
+// TaskManager pods created by Flink.
+func getExpectedComponents(cluster *v1beta1.FlinkCluster) int {
+	if isNativeMode(cluster) {
+		return 2
+	}
+	var expectedComponents = 3
+	if cluster.Spec.JobManager.Ingress != nil {
+		expectedComponents++
+	}
+	expectedComponents += len(cluster.Spec.TaskManager.Pools)
+	return expectedComponents
+}
+
+// Checks whether all the JobManager and TaskManager pods have been terminated
+// after their deployments are scaled to zero.
+func isScaledToZero(observed *ObservedClusterState) bool {
+	var deployments = []*appsv1.Deployment{
+		observed.jmDeployment, observed.tmDeployment}
+	for _, deployment := range observed.tmPools {
+		deployments = append(deployments, deployment)
+	}
+	for _, deployment := range deployments {
+		if deployment == nil {
+			continue
+		}
+		if !isReplicasEqual(deployment.Spec.Replicas, nil) ||
+			deployment.Status.Replicas > 0 {
+			return false
+		}
+	}
+	var statefulSet = observed.tmStatefulSet
+	if statefulSet != nil &&
+		(!isReplicasEqual(statefulSet.Spec.Replicas, nil) ||
+			statefulSet.Status.Replicas > 0) {
+		return false
+	}
+	return true
+}
+
+// Gets the completion time of the job, which is set when the job transitions
+// to Succeeded and kept while it stays Succeeded. A job which had already
+// succeeded before the completion time was recorded, e.g., by an older
+// version of the operator, doesn't get one, so that its hooks are not
+// executed long after it succeeded.
+func getCompletionTime(
+	recorded *v1beta1.FlinkClusterStatus,
+	jobStatus *v1beta1.JobStatus,
+	now time.Time) string {
+	if jobStatus == nil || jobStatus.State != v1beta1.JobStateSucceeded {
+		return ""
+	}
+	var recordedJobStatus = recorded.Components.Job
+	if recordedJobStatus != nil &&
+		recordedJobStatus.State == v1beta1.JobStateSucceeded {
+		return recorded.CompletionTime
+	}
+	var tc = &TimeConverter{}
+	return tc.ToString(now)
+}
+
+// Derives the state of a component of the application cluster in native mode
+// from its pods, it is ready when all of them are ready.
+func deriveNativeComponentState(
+	name string, pods []corev1.Pod) v1beta1.FlinkClusterComponentState {
+	var state = v1beta1.FlinkClusterComponentState{
+		Name:     name,
+		State:    v1beta1.ComponentStateNotReady,
+		Replicas: int32(len(pods)),
+	}
+	if len(pods) == 0 {
+		return state
+	}
+	if hasCrashLoopingPod(pods) {
+		state.State = v1beta1.ComponentStateCrashLoopBackOff
+		return state
+	}
+	for i := range pods {
+		if !isPodReady(&pods[i]) {
+			return state
+		}
+	}
+	state.State = v1beta1.ComponentStateReady
+	return state
+}
+
+// Derives the JobManager leader elected by Flink Kubernetes high
+// availability. The ready JobManager is not ready until a leader is elected,
+// e.g., while the standby JobManagers take over from a failed leader.
+func deriveJobManagerLeader(
+	state *v1beta1.FlinkClusterComponentState,
+	observed *ObservedClusterState) {
+	if !v1beta1.IsKubernetesHAEnabled(observed.cluster.Spec.FlinkProperties) ||
+		state.State != v1beta1.ComponentStateReady {
+		return
+	}
+	var leader = getLeaderPod(observed.jmLeaderAddress, observed.jmPods)
+	if leader == nil {
+		state.State = v1beta1.ComponentStateNotReady
+		state.Reason = v1beta1.ComponentReasonLeaderElection
+		return
+	}
+	state.Leader = leader.Name
+}
+
+// Gets the ready pod at the leader address, e.g., "http://10.8.0.5:8081",
+// which is nil if there is no leader or it is not one of the pods.
+func getLeaderPod(address string, pods []corev1.Pod) *corev1.Pod {
+	if len(address) == 0 {
+		return nil
+	}
+	var host = address
+	var leaderURL, err = url.Parse(address)
+	if err == nil && len(leaderURL.Hostname()) > 0 {
+		host = leaderURL.Hostname()
+	}
+	for i := range pods {
+		var pod = &pods[i]
+		if (pod.Status.PodIP == host || pod.Name == host) && isPodReady(pod) {
+			return pod
+		}
+	}
+	return nil
+}
+
+// Derives the status of the job in native mode. The submission failed if the
+// submitter failed, otherwise the job is pending until it is observed in the
+// Flink job list of the application cluster.
+func deriveNativeJobStatus(
+	recorded *v1beta1.JobStatus,
+	observedJob *batchv1.Job,
+	flinkJobList *flinkclient.JobStatusList) *v1beta1.JobStatus {
+	var jobStatus = deriveSessionJobStatus(recorded, flinkJobList)
+	if jobStatus == nil {
+		jobStatus = &v1beta1.JobStatus{}
+	}
+	jobStatus.Name = observedJob.ObjectMeta.Name
+	jobStatus.FromSavepoint = getFromSavepoint(observedJob.Spec)
+	if failed := getJobCondition(observedJob, batchv1.JobFailed); failed != nil {
+		jobStatus.State = v1beta1.JobStateFailed
+		jobStatus.Reason = v1beta1.ComponentReasonSubmissionFailed
+		jobStatus.FailureReason = failed.Message
+		if len(jobStatus.FailureReason) == 0 {
+			jobStatus.FailureReason = failed.Reason
+		}
+	} else if len(jobStatus.ID) == 0 {
+		jobStatus.State = v1beta1.JobStatePending
+	}
+	return jobStatus
+}
+
+// Derives the effective Flink config and its checksum from the observed
+// `flink-conf.yaml`, of the external Flink ConfigMap if the cluster mounts
+// one, otherwise of the ConfigMap generated by the operator.
+func deriveEffectiveConfig(
+	recorded *v1beta1.FlinkClusterStatus,
+	observed *ObservedClusterState) (map[string]string, string) {
+	var configMap = observed.configMap
+	if len(observed.cluster.Spec.FlinkConfigMap) > 0 {
+		configMap = observed.flinkConfigMap
+	}
+	if configMap == nil {
+		return recorded.EffectiveConfig, recorded.EffectiveConfigChecksum
+	}
+	var flinkConf, ok = configMap.Data["flink-conf.yaml"]
+	if !ok {
+		return recorded.EffectiveConfig, recorded.EffectiveConfigChecksum
+	}
+	var checksum = sha256.Sum256([]byte(flinkConf))
+	return redactFlinkConfig(parseFlinkConfig(flinkConf)),
+		hex.EncodeToString(checksum[:])
+}
+
+// Records the last completed checkpoint and the consecutive failed checkpoints
+// of the running job, and marks the job unhealthy when they exceed the
+// thresholds. The recorded health is kept if the checkpoints cannot be
+// observed, because the Flink API might be temporarily unavailable.
+func deriveCheckpointHealth(
+	jobSpec *v1beta1.JobSpec,
+	recordedJobStatus *v1beta1.JobStatus,
+	checkpoints *flinkclient.CheckpointStatistics,
+	jobStatus *v1beta1.JobStatus,
+	now time.Time) {
+	if checkpoints == nil {
+		if recordedJobStatus != nil &&
+			recordedJobStatus.State == v1beta1.JobStateUnhealthy {
+			jobStatus.State = v1beta1.JobStateUnhealthy
+		}
+		return
+	}
+
+	var tc = &TimeConverter{}
+	var latest = checkpoints.Latest.Completed
+	if latest != nil {
+		jobStatus.LastCheckpointTime = tc.ToString(
+			time.Unix(0, latest.LatestAckTimestamp*int64(time.Millisecond)))
+	}
+	jobStatus.FailedCheckpoints = 0
+	for _, checkpoint := range checkpoints.History {
+		if checkpoint.Status == "IN_PROGRESS" {
+			continue
+		}
+		if checkpoint.Status != "FAILED" {
+			break
+		}
+		jobStatus.FailedCheckpoints++
+	}
+
+	var health = jobSpec.CheckpointHealth
+	if health == nil {
+		return
+	}
+	if jobStatus.FailedCheckpoints >= health.MaxConsecutiveFailures {
+		jobStatus.State = v1beta1.JobStateUnhealthy
+	}
+	if health.MaxCheckpointAgeSeconds > 0 &&
+		len(jobStatus.LastCheckpointTime) > 0 {
+		var age = now.Sub(tc.FromString(jobStatus.LastCheckpointTime))
+		if age > time.Duration(health.MaxCheckpointAgeSeconds)*time.Second {
+			jobStatus.State = v1beta1.JobStateUnhealthy
+		}
+	}
+}
+
+// Checks whether the cluster failed by the readiness timeout should be
+// retried, i.e., its spec has been updated since it failed.
+func isReadinessTimeoutRetried(
+	recorded *v1beta1.FlinkClusterStatus, cluster *v1beta1.FlinkCluster) bool {
+	return recorded.Reason == v1beta1.ClusterReasonReadinessTimeout &&
+		recorded.ObservedGeneration != cluster.ObjectMeta.Generation
+}
+
+// Records the time when the cluster entered the Reconciling state, and fails
+// the cluster if it stays Reconciling longer than the readiness timeout. The
+// reason of the failure is kept until the cluster is retried.
+func deriveReadinessTimeout(
+	recorded *v1beta1.FlinkClusterStatus,
+	cluster *v1beta1.FlinkCluster,
+	status *v1beta1.FlinkClusterStatus,
+	now time.Time) {
+	var tc = &TimeConverter{}
+	status.ObservedGeneration = cluster.ObjectMeta.Generation
+	if status.State == v1beta1.ClusterStateFailed &&
+		recorded.State == v1beta1.ClusterStateFailed {
+		status.Reason = recorded.Reason
+		return
+	}
+	if status.State != v1beta1.ClusterStateReconciling {
+		return
+	}
+
+	status.ReconcilingSince = recorded.ReconcilingSince
+	if recorded.State != v1beta1.ClusterStateReconciling ||
+		len(status.ReconcilingSince) == 0 {
+		status.ReconcilingSince = tc.ToString(now)
+	}
+	var timeout = cluster.Spec.ReadinessTimeoutSeconds
+	if timeout == nil {
+		return
+	}
+	var reconcilingSince = tc.FromString(status.ReconcilingSince)
+	if now.Sub(reconcilingSince) > time.Duration(*timeout)*time.Second {
+		status.State = v1beta1.ClusterStateFailed
+		status.Reason = v1beta1.ClusterReasonReadinessTimeout
+		status.ReconcilingSince = ""
+	}
+}
+
+// Summarizes why the cluster is not running, e.g., "Waiting for TaskManager
+// deployment (1/3 ready)" or "Job failed: BackoffLimitExceeded", or how to
+// access the Web UI of a running cluster behind a ClusterIP service. The
+// message only depends on the status and the observed resources, and the
+// components are checked in a fixed order, so that it doesn't flap between
+// equivalent messages. It is empty when there is nothing to report.
+func getStatusMessage(
+	status *v1beta1.FlinkClusterStatus, observed *ObservedClusterState) string {
+	var jobStatus = status.Components.Job
+	if jobStatus != nil {
+		switch jobStatus.State {
+		case v1beta1.JobStateFailed:
+			if len(jobStatus.FailureReason) > 0 {
+				return "Job failed: " + jobStatus.FailureReason
 			}
-		} else if runningComponents < totalComponents {
-			status.State = v1beta1.ClusterStateReconciling
-		} else {
-			status.State = v1beta1.ClusterStateRunning
-		}
-	case v1beta1.ClusterStateStopping,
-		v1beta1.ClusterStatePartiallyStopped:
-		if runningComponents == 0 {
-			status.State = v1beta1.ClusterStateStopped
-		} else if runningComponents < totalComponents {
-			status.State = v1beta1.ClusterStatePartiallyStopped
-		} else {
-			status.State = v1beta1.ClusterStateStopping
+			return "Job failed"
+		case v1beta1.JobStateSubmitTimeout:
+			return "Job submission timed out"
+		case v1beta1.JobStateDeploying:
+			return fmt.Sprintf(
+				"Job deploying, retrying the submission after %v failed attempts",
+				jobStatus.SubmissionAttempts)
+		case v1beta1.JobStateRescaling:
+			return fmt.Sprintf(
+				"Job rescaling from parallelism %v to %v",
+				jobStatus.Rescale.FromParallelism,
+				jobStatus.Rescale.ToParallelism)
+		case v1beta1.JobStatePending:
+			if jobStatus.Reason == v1beta1.ComponentReasonInsufficientSlots {
+				return "Job pending: the TaskManagers have fewer task slots than the job parallelism"
+			}
+		}
+	}
+	if len(observed.flinkTLSError) > 0 {
+		return "Flink REST TLS misconfigured: " + observed.flinkTLSError
+	}
+	if status.Reason == v1beta1.ClusterReasonReadinessTimeout {
+		return "Cluster not ready within the readiness timeout"
+	}
+	if status.State == v1beta1.ClusterStateDegraded {
+		return "Flink REST API failed the health check"
+	}
+	if status.State == v1beta1.ClusterStateRunning {
+		return getPortForwardMessage(
+			&status.Components.JobManagerService, observed.jmService)
+	}
+	if status.State != v1beta1.ClusterStateCreating &&
+		status.State != v1beta1.ClusterStateReconciling {
+		return ""
+	}
+
+	var components = status.Components
+	if components.JobManagerDeployment.State != v1beta1.ComponentStateReady {
+		return getWaitingMessage(
+			"JobManager deployment",
+			observed.jmDeployment,
+			components.JobManagerDeployment.Reason)
+	}
+	if components.JobManagerService.State != v1beta1.ComponentStateReady {
+		return "Waiting for JobManager service"
+	}
+	if components.TaskManagerDeployment.State != v1beta1.ComponentStateReady {
+		if observed.tmStatefulSet != nil {
+			return getStatefulSetWaitingMessage(
+				"TaskManager StatefulSet",
+				observed.tmStatefulSet,
+				components.TaskManagerDeployment.Reason)
+		}
+		return getWaitingMessage(
+			"TaskManager deployment",
+			observed.tmDeployment,
+			components.TaskManagerDeployment.Reason)
+	}
+	var poolNames []string
+	for name := range components.TaskManagerPools {
+		poolNames = append(poolNames, name)
+	}
+	sort.Strings(poolNames)
+	for _, name := range poolNames {
+		var poolState = components.TaskManagerPools[name]
+		if poolState.State != v1beta1.ComponentStateReady &&
+			poolState.State != v1beta1.ComponentStateDeleted {
+			return getWaitingMessage(
+				fmt.Sprintf("TaskManager pool %v deployment", name),
+				observed.tmPools[name],
+				poolState.Reason)
+		}
+	}
+	return ""
+}
+
+// Gets the message suggesting the port-forward command to access the Flink
+// Web UI of a running cluster whose JobManager service is only accessible in
+// the Kubernetes cluster, empty for the other service types.
+func getPortForwardMessage(
+	serviceStatus *v1beta1.JobManagerServiceStatus,
+	service *corev1.Service) string {
+	if service == nil || service.Spec.Type != corev1.ServiceTypeClusterIP ||
+		len(serviceStatus.WebUIURL) == 0 {
+		return ""
+	}
+	var uiPort = getServiceUIPort(service)
+	return fmt.Sprintf(
+		"Flink Web UI is only accessible in the cluster, run "+
+			"`kubectl port-forward -n %v svc/%v %v` to access it locally",
+		service.Namespace,
+		service.Name,
+		uiPort.Port)
+}
+
+// Gets the message of waiting for a deployment, with its available replicas
+// and the reason if any.
+func getWaitingMessage(
+	component string, deployment *appsv1.Deployment, reason string) string {
+	var message = "Waiting for " + component
+	if deployment != nil {
+		var desiredReplicas int32 = 1
+		if deployment.Spec.Replicas != nil {
+			desiredReplicas = *deployment.Spec.Replicas
 		}
-	case v1beta1.ClusterStateStopped:
-		status.State = v1beta1.ClusterStateStopped
+		message += fmt.Sprintf(
+			" (%d/%d ready)",
+			deployment.Status.AvailableReplicas,
+			desiredReplicas)
+	}
+	if len(reason) > 0 {
+		message += ": " + reason
+	}
+	return message
+}
+
+// Gets the message of waiting for a StatefulSet, with its ready replicas if it
+// exists.
+func getStatefulSetWaitingMessage(
+	component string, statefulSet *appsv1.StatefulSet, reason string) string {
+	var message = "Waiting for " + component
+	var desiredReplicas int32 = 1
+	if statefulSet.Spec.Replicas != nil {
+		desiredReplicas = *statefulSet.Spec.Replicas
+	}
+	message += fmt.Sprintf(
+		" (%d/%d ready)", statefulSet.Status.ReadyReplicas, desiredReplicas)
+	if len(reason) > 0 {
+		message += ": " + reason
+	}
+	return message
+}
+
+// Gets the state history of the new status, which is the recorded history
+// with the transition from the old state appended if the state has changed.
+// Only the last statusHistoryLimit transitions are kept.
+func getStatusHistory(
+	oldStatus *v1beta1.FlinkClusterStatus,
+	newStatus *v1beta1.FlinkClusterStatus,
+	now time.Time) []v1beta1.StatusTransition {
+	var history = oldStatus.History
+	if newStatus.State == oldStatus.State {
+		return history
+	}
+	var tc = &TimeConverter{}
+	var transition = v1beta1.StatusTransition{
+		Time:      tc.ToString(now),
+		FromState: oldStatus.State,
+		ToState:   newStatus.State,
+		Reason:    newStatus.Reason,
+	}
+	if len(history) >= statusHistoryLimit {
+		history = history[len(history)-statusHistoryLimit+1:]
+	}
+	// Copy so that the recorded history is not modified.
+	var newHistory = make([]v1beta1.StatusTransition, 0, len(history)+1)
+	newHistory = append(newHistory, history...)
+	return append(newHistory, transition)
+}
+
+// Sets the last transition time of each component of the new status, which
+// is the recorded time if the state of the component has not changed, or the
+// current time otherwise.
+func setLastTransitionTimes(
+	recorded *v1beta1.FlinkClusterStatus,
+	status *v1beta1.FlinkClusterStatus,
+	now time.Time) {
+	var tc = &TimeConverter{}
+	var nowStr = tc.ToString(now)
+	var recordedComponents = &recorded.Components
+	var components = &status.Components
+
+	setComponentLastTransitionTime(
+		recordedComponents.ConfigMap, &components.ConfigMap, nowStr)
+	setComponentLastTransitionTime(
+		recordedComponents.JobManagerDeployment,
+		&components.JobManagerDeployment,
+		nowStr)
+	components.JobManagerService.LastTransitionTime = getLastTransitionTime(
+		recordedComponents.JobManagerService.State,
+		recordedComponents.JobManagerService.LastTransitionTime,
+		components.JobManagerService.State,
+		nowStr)
+	if components.JobManagerIngress != nil {
+		var recordedIngress = recordedComponents.JobManagerIngress
+		if recordedIngress == nil {
+			recordedIngress = &v1beta1.JobManagerIngressStatus{}
+		}
+		components.JobManagerIngress.LastTransitionTime = getLastTransitionTime(
+			recordedIngress.State,
+			recordedIngress.LastTransitionTime,
+			components.JobManagerIngress.State,
+			nowStr)
+	}
+	setComponentLastTransitionTime(
+		recordedComponents.TaskManagerDeployment,
+		&components.TaskManagerDeployment,
+		nowStr)
+	for name, poolState := range components.TaskManagerPools {
+		setComponentLastTransitionTime(
+			recordedComponents.TaskManagerPools[name], &poolState, nowStr)
+		components.TaskManagerPools[name] = poolState
+	}
+	if components.Job != nil {
+		var recordedJob = recordedComponents.Job
+		if recordedJob == nil {
+			recordedJob = &v1beta1.JobStatus{}
+		}
+		components.Job.LastTransitionTime = getLastTransitionTime(
+			recordedJob.State,
+			recordedJob.LastTransitionTime,
+			components.Job.State,
+			nowStr)
+	}
+	if components.TrafficSplitting != nil {
+		var recordedTrafficSplitting = recordedComponents.TrafficSplitting
+		if recordedTrafficSplitting == nil {
+			recordedTrafficSplitting = &v1beta1.TrafficSplittingStatus{}
+		}
+		setComponentLastTransitionTime(
+			recordedTrafficSplitting.VirtualService,
+			&components.TrafficSplitting.VirtualService,
+			nowStr)
+		setComponentLastTransitionTime(
+			recordedTrafficSplitting.VersionA,
+			&components.TrafficSplitting.VersionA,
+			nowStr)
+		setComponentLastTransitionTime(
+			recordedTrafficSplitting.VersionB,
+			&components.TrafficSplitting.VersionB,
+			nowStr)
+	}
+}
+
+func setComponentLastTransitionTime(
+	recorded v1beta1.FlinkClusterComponentState,
+	component *v1beta1.FlinkClusterComponentState,
+	now string) {
+	component.LastTransitionTime = getLastTransitionTime(
+		recorded.State, recorded.LastTransitionTime, component.State, now)
+}
+
+// Gets the last transition time of a component, it only changes when the
+// state of the component changes.
+func getLastTransitionTime(
+	recordedState string,
+	recordedTime string,
+	newState string,
+	now string) string {
+	if len(newState) == 0 {
+		return ""
+	}
+	if newState == recordedState && len(recordedTime) > 0 {
+		return recordedTime
+	}
+	return now
+}
+
+// Derives the status of traffic splitting from the observed VirtualService
+// and clusters of version A and B. Returns nil once traffic splitting is
+// disabled and none of them is observed.
+// Derives the Grafana dashboard ConfigMap recorded in the status. An observed
+// dashboard which is no longer in the spec is recorded until it is deleted,
+// then the one of the spec once it is created.
+func deriveGrafanaDashboardStatus(
+	observed *ObservedClusterState) *v1beta1.GrafanaDashboardStatus {
+	var key, enabled = getGrafanaDashboardKey(observed.cluster)
+	var status *v1beta1.GrafanaDashboardStatus
+	for _, dashboard := range observed.grafanaDashboards {
+		status = &v1beta1.GrafanaDashboardStatus{
+			Namespace: dashboard.Namespace,
+			Name:      dashboard.Name,
+		}
+		if !enabled || dashboard.Namespace != key.Namespace ||
+			dashboard.Name != key.Name {
+			return status
+		}
+	}
+	return status
+}
+
+func deriveTrafficSplittingStatus(
+	recorded *v1beta1.TrafficSplittingStatus,
+	observed *ObservedClusterState) *v1beta1.TrafficSplittingStatus {
+	var enabled = observed.cluster != nil &&
+		getTrafficSplitting(observed.cluster) != nil
+	if observed.virtualService == nil &&
+		observed.clusterA == nil && observed.clusterB == nil &&
+		(recorded == nil || !enabled) {
+		return nil
+	}
+
+	var status = &v1beta1.TrafficSplittingStatus{}
+	if recorded != nil {
+		*status = *recorded
+	}
+
+	if observed.virtualService != nil {
+		status.VirtualService = v1beta1.FlinkClusterComponentState{
+			Name:  observed.virtualService.GetName(),
+			State: v1beta1.ComponentStateReady,
+		}
+	} else if status.VirtualService.Name != "" {
+		status.VirtualService.State = v1beta1.ComponentStateDeleted
+	}
+
+	deriveVersionClusterState(&status.VersionA, observed.clusterA)
+	deriveVersionClusterState(&status.VersionB, observed.clusterB)
+
+	return status
+}
+
+// Derives the state of a version of traffic splitting from the state of the
+// job in its cluster.
+func deriveVersionClusterState(
+	state *v1beta1.FlinkClusterComponentState,
+	observedCluster *v1beta1.FlinkCluster) {
+	if observedCluster == nil {
+		if state.Name != "" {
+			state.State = v1beta1.ComponentStateDeleted
+		}
+		return
+	}
+
+	state.Name = observedCluster.ObjectMeta.Name
+	state.State = v1beta1.JobStatePending
+	var jobStatus = observedCluster.Status.Components.Job
+	if jobStatus != nil && jobStatus.State != "" {
+		state.State = jobStatus.State
+	}
+}
+
+// Gets the condition of the type of the Kubernetes job, nil if it is absent
+// or not true.
+func getJobCondition(
+	job *batchv1.Job,
+	conditionType batchv1.JobConditionType) *batchv1.JobCondition {
+	for i := range job.Status.Conditions {
+		var condition = &job.Status.Conditions[i]
+		if condition.Type == conditionType &&
+			condition.Status == corev1.ConditionTrue {
+			return condition
+		}
+	}
+	return nil
+}
+
+// Checks whether the job submitter was terminated because it did not finish
+// the submission before its deadline.
+func isSubmitJobDeadlineExceeded(job *batchv1.Job) bool {
+	var failed = getJobCondition(job, batchv1.JobFailed)
+	return failed != nil && failed.Reason == "DeadlineExceeded"
+}
+
+// Whether the Kubernetes job which submits the job is expected, i.e., the job
+// is specified and not cancelled, and it is not submitted through the REST
+// API by the operator.
+func isJobSubmitterExpected(cluster *v1beta1.FlinkCluster) bool {
+	var jobSpec = cluster.Spec.Job
+	if jobSpec == nil || isStreamGraphJob(cluster) ||
+		isRESTSubmittedJob(cluster) {
+		return false
+	}
+	return jobSpec.CancelRequested == nil || !*jobSpec.CancelRequested
+}
+
+// Gets the state of a job submitted through the REST API from its status in
+// the Flink job list, which is only observed while the cluster is running.
+func getRESTSubmittedJobState(
+	jobStatus *v1beta1.JobStatus,
+	flinkJobList *flinkclient.JobStatusList) string {
+	if flinkJobList == nil {
+		return jobStatus.State
+	}
+	for _, job := range flinkJobList.Jobs {
+		if job.ID == jobStatus.ID {
+			return getFlinkJobState(job.Status)
+		}
+	}
+	return jobStatus.State
+}
+
+// Maps the status of a job in the Flink job list to the job state. The
+// transient statuses, e.g., CREATED or RESTARTING, are Pending.
+func getFlinkJobState(flinkJobStatus string) string {
+	switch flinkJobStatus {
+	case "RUNNING":
+		return v1beta1.JobStateRunning
+	case "FINISHED":
+		return v1beta1.JobStateSucceeded
+	case "FAILED":
+		return v1beta1.JobStateFailed
+	case "CANCELED":
+		return v1beta1.JobStateCancelled
+	}
+	return v1beta1.JobStatePending
+}
+
+// Derives the status of a job of a session cluster from the Flink job list.
+// The recorded job is followed while it is running, otherwise a running job
+// takes precedence, then the recorded job until it is no longer listed, e.g.,
+// after the JobManager restarted. Among the other jobs, the one which started
+// last is taken, or the first by ID if they started at the same time, so that
+// the choice doesn't change between reconciles. The recorded status is kept
+// if the list is not observed.
+func deriveSessionJobStatus(
+	recorded *v1beta1.JobStatus,
+	flinkJobList *flinkclient.JobStatusList) *v1beta1.JobStatus {
+	if flinkJobList == nil {
+		return recorded.DeepCopy()
+	}
+	var jobs = append([]flinkclient.JobStatus{}, flinkJobList.Jobs...)
+	sort.SliceStable(jobs, func(i, j int) bool {
+		if jobs[i].StartTime != jobs[j].StartTime {
+			return jobs[i].StartTime > jobs[j].StartTime
+		}
+		return jobs[i].ID < jobs[j].ID
+	})
+	var recordedJob, runningJob *flinkclient.JobStatus
+	for i := range jobs {
+		var job = &jobs[i]
+		if recorded != nil && job.ID == recorded.ID {
+			recordedJob = job
+		}
+		if job.Status == "RUNNING" && runningJob == nil {
+			runningJob = job
+		}
+	}
+	var observed *flinkclient.JobStatus
+	switch {
+	case recordedJob != nil && recordedJob.Status == "RUNNING":
+		observed = recordedJob
+	case runningJob != nil:
+		observed = runningJob
+	case recordedJob != nil:
+		observed = recordedJob
+	case len(jobs) > 0:
+		observed = &jobs[0]
 	default:
-		panic(fmt.Sprintf("Unknown cluster state: %v", recorded.State))
+		return recorded.DeepCopy()
+	}
+	var jobStatus = &v1beta1.JobStatus{}
+	if recorded != nil && recorded.ID == observed.ID {
+		recorded.DeepCopyInto(jobStatus)
+	}
+	jobStatus.ID = observed.ID
+	jobStatus.State = getFlinkJobState(observed.Status)
+	return jobStatus
+}
+
+// Derives the states of the TaskManager pool deployments, keyed by pool name.
+// The pools which were recorded but are no longer observed are deleted, and
+// pruned from the status after that.
+func deriveTaskManagerPoolsStatus(
+	recorded map[string]v1beta1.FlinkClusterComponentState,
+	observed map[string]*appsv1.Deployment) map[string]v1beta1.FlinkClusterComponentState {
+	if len(recorded) == 0 && len(observed) == 0 {
+		return nil
 	}
 
+	var status = map[string]v1beta1.FlinkClusterComponentState{}
+	for name, deployment := range observed {
+		status[name] = v1beta1.FlinkClusterComponentState{
+			Name:  deployment.ObjectMeta.Name,
+			State: getDeploymentState(deployment),
+		}
+	}
+	// A pool which is gone is reported as deleted once, then pruned.
+	for name, recordedState := range recorded {
+		if _, ok := observed[name]; !ok &&
+			recordedState.State != v1beta1.ComponentStateDeleted {
+			status[name] = v1beta1.FlinkClusterComponentState{
+				Name:  recordedState.Name,
+				State: v1beta1.ComponentStateDeleted,
+			}
+		}
+	}
+	if len(status) == 0 {
+		return nil
+	}
 	return status
 }
 
+// Derives the Flink cluster overview. When it cannot be observed, the recorded
+// values are kept and marked stale.
+func deriveFlinkStatus(
+	recorded *v1beta1.FlinkStatus,
+	overview *flinkclient.ClusterOverview) *v1beta1.FlinkStatus {
+	if overview == nil {
+		if recorded == nil {
+			return nil
+		}
+		var status = *recorded
+		status.Stale = true
+		return &status
+	}
+	return &v1beta1.FlinkStatus{
+		JobsRunning:    overview.JobsRunning,
+		JobsFinished:   overview.JobsFinished,
+		JobsCancelled:  overview.JobsCancelled,
+		JobsFailed:     overview.JobsFailed,
+		SlotsTotal:     overview.SlotsTotal,
+		SlotsAvailable: overview.SlotsAvailable,
+	}
+}
+
+// Derives the number of free task slots of the TaskManagers registered with the
+// JobManager. When they cannot be observed, the recorded number is kept while
+// the cluster is running, otherwise there are no available slots.
+func deriveAvailableSlots(
+	recorded *v1beta1.FlinkClusterStatus,
+	status *v1beta1.FlinkClusterStatus,
+	observed *ObservedClusterState) int {
+	if observed.flinkTaskManagers == nil {
+		if status.State == v1beta1.ClusterStateRunning {
+			return recorded.AvailableSlots
+		}
+		return 0
+	}
+	var slots = 0
+	for _, taskManager := range observed.flinkTaskManagers.TaskManagers {
+		slots += int(taskManager.FreeSlots)
+	}
+	return slots
+}
+
+// Derives the JobManager metrics snapshot. The recorded snapshot is kept until
+// a new one is observed, which counts the consecutive snapshots with the heap
+// usage above the memory pressure ratio.
+func deriveJobManagerMetrics(
+	recorded *v1beta1.JobManagerMetrics,
+	observed *v1beta1.JobManagerMetrics,
+	memoryPressureRatio float64) *v1beta1.JobManagerMetrics {
+	if observed == nil {
+		return recorded.DeepCopy()
+	}
+	var metrics = *observed
+	metrics.HighHeapSamples = 0
+	if memoryPressureRatio > 0 && metrics.HeapMax > 0 &&
+		float64(metrics.HeapUsed) > memoryPressureRatio*float64(metrics.HeapMax) {
+		metrics.HighHeapSamples = 1
+		if recorded != nil {
+			metrics.HighHeapSamples = recorded.HighHeapSamples + 1
+		}
+	}
+	return &metrics
+}
+
+// Derives the backpressure of the job vertices. The recorded backpressure is
+// kept if it cannot be observed while the job is still running, because the
+// Flink API might be temporarily unavailable or the sampling might be still in
+// progress.
+func deriveBackpressureStatus(
+	recorded *v1beta1.FlinkClusterStatus,
+	observed *ObservedClusterState) []v1beta1.VertexBackpressure {
+	if observed.flinkBackpressure != nil {
+		return observed.flinkBackpressure
+	}
+	var recordedJob = recorded.Components.Job
+	if observed.job != nil && isJobRunning(recordedJob) {
+		return recorded.BackpressureStatus
+	}
+	return nil
+}
+
+// Derives the job metrics from the newly polled throughput, or the recorded
+// one while the job is still running, and the highest backpressure level of
+// the vertices. Returns nil if neither is available.
+func deriveJobMetrics(
+	recorded *v1beta1.FlinkClusterStatus,
+	observed *ObservedClusterState,
+	backpressure []v1beta1.VertexBackpressure) *v1beta1.JobMetrics {
+	var jobMetrics = &v1beta1.JobMetrics{}
+	var recordedJob = recorded.Components.Job
+	if observed.flinkJobMetrics != nil {
+		*jobMetrics = *observed.flinkJobMetrics
+	} else if observed.job != nil && isJobRunning(recordedJob) &&
+		recorded.JobMetrics != nil {
+		*jobMetrics = *recorded.JobMetrics
+	} else if len(backpressure) == 0 {
+		return nil
+	}
+	jobMetrics.BackpressureLevel = getMaxBackpressureLevel(backpressure)
+	return jobMetrics
+}
+
 // Gets Flink job ID based on the observed state and the recorded state.
 //
 // It is possible that the recorded is not nil, but the observed is, due
@@ -487,66 +1761,94 @@ func (updater *ClusterStatusUpdater) isStatusChanged(
 		changed = true
 		updater.log.Info(
 			"Cluster state changed",
-			"current",
+			"oldState",
 			currentStatus.State,
-			"new",
+			"newState",
 			newStatus.State)
 	}
-	if newStatus.Components.ConfigMap !=
-		currentStatus.Components.ConfigMap {
+	if newStatus.Reason != currentStatus.Reason ||
+		newStatus.Message != currentStatus.Message ||
+		newStatus.ReadyComponents != currentStatus.ReadyComponents ||
+		newStatus.TotalComponents != currentStatus.TotalComponents ||
+		newStatus.ReconcilingSince != currentStatus.ReconcilingSince ||
+		newStatus.ObservedGeneration != currentStatus.ObservedGeneration {
+		changed = true
+		updater.log.Info(
+			"Cluster state details changed",
+			"oldReason",
+			currentStatus.Reason,
+			"newReason",
+			newStatus.Reason,
+			"message",
+			newStatus.Message,
+			"readyComponents",
+			newStatus.ReadyComponents,
+			"totalComponents",
+			newStatus.TotalComponents,
+			"reconcilingSince",
+			newStatus.ReconcilingSince,
+			"observedGeneration",
+			newStatus.ObservedGeneration)
+	}
+	if isComponentStateChanged(
+		currentStatus.Components.ConfigMap,
+		newStatus.Components.ConfigMap) {
 		updater.log.Info(
 			"ConfigMap status changed",
-			"current",
+			"oldStatus",
 			currentStatus.Components.ConfigMap,
-			"new",
+			"newStatus",
 			newStatus.Components.ConfigMap)
 		changed = true
 	}
-	if newStatus.Components.JobManagerDeployment !=
-		currentStatus.Components.JobManagerDeployment {
+	if isComponentStateChanged(
+		currentStatus.Components.JobManagerDeployment,
+		newStatus.Components.JobManagerDeployment) {
 		updater.log.Info(
 			"JobManager deployment status changed",
-			"current", currentStatus.Components.JobManagerDeployment,
-			"new",
+			"oldStatus", currentStatus.Components.JobManagerDeployment,
+			"newStatus",
 			newStatus.Components.JobManagerDeployment)
 		changed = true
 	}
-	if newStatus.Components.JobManagerService !=
-		currentStatus.Components.JobManagerService {
+	if isJobManagerServiceStatusChanged(
+		currentStatus.Components.JobManagerService,
+		newStatus.Components.JobManagerService) {
 		updater.log.Info(
 			"JobManager service status changed",
-			"current",
+			"oldStatus",
 			currentStatus.Components.JobManagerService,
-			"new", newStatus.Components.JobManagerService)
+			"newStatus", newStatus.Components.JobManagerService)
 		changed = true
 	}
 	if currentStatus.Components.JobManagerIngress == nil {
 		if newStatus.Components.JobManagerIngress != nil {
 			updater.log.Info(
 				"JobManager ingress status changed",
-				"current",
+				"oldStatus",
 				"nil",
-				"new", *newStatus.Components.JobManagerIngress)
+				"newStatus", *newStatus.Components.JobManagerIngress)
 			changed = true
 		}
 	} else {
 		if newStatus.Components.JobManagerIngress.State != currentStatus.Components.JobManagerIngress.State {
 			updater.log.Info(
 				"JobManager ingress status changed",
-				"current",
+				"oldStatus",
 				*currentStatus.Components.JobManagerIngress,
-				"new",
+				"newStatus",
 				*newStatus.Components.JobManagerIngress)
 			changed = true
 		}
 	}
-	if newStatus.Components.TaskManagerDeployment !=
-		currentStatus.Components.TaskManagerDeployment {
+	if isComponentStateChanged(
+		currentStatus.Components.TaskManagerDeployment,
+		newStatus.Components.TaskManagerDeployment) {
 		updater.log.Info(
 			"TaskManager deployment status changed",
-			"current",
+			"oldStatus",
 			currentStatus.Components.TaskManagerDeployment,
-			"new",
+			"newStatus",
 			newStatus.Components.TaskManagerDeployment)
 		changed = true
 	}
@@ -554,22 +1856,22 @@ func (updater *ClusterStatusUpdater) isStatusChanged(
 		if newStatus.Components.Job != nil {
 			updater.log.Info(
 				"Job status changed",
-				"current",
+				"oldStatus",
 				"nil",
-				"new",
+				"newStatus",
 				*newStatus.Components.Job)
 			changed = true
 		}
 	} else {
 		if newStatus.Components.Job != nil {
-			var isEqual = reflect.DeepEqual(
-				newStatus.Components.Job, currentStatus.Components.Job)
+			var isEqual = isJobStatusEqual(
+				currentStatus.Components.Job, newStatus.Components.Job)
 			if !isEqual {
 				updater.log.Info(
 					"Job status changed",
-					"current",
+					"oldStatus",
 					*currentStatus.Components.Job,
-					"new",
+					"newStatus",
 					*newStatus.Components.Job)
 				changed = true
 			}
@@ -577,20 +1879,345 @@ func (updater *ClusterStatusUpdater) isStatusChanged(
 			changed = true
 		}
 	}
+	if isTaskManagerPoolsStatusChanged(
+		currentStatus.Components.TaskManagerPools,
+		newStatus.Components.TaskManagerPools) {
+		updater.log.Info(
+			"TaskManager pools status changed",
+			"oldStatus",
+			currentStatus.Components.TaskManagerPools,
+			"newStatus",
+			newStatus.Components.TaskManagerPools)
+		changed = true
+	}
+	if isTrafficSplittingStatusChanged(
+		currentStatus.Components.TrafficSplitting,
+		newStatus.Components.TrafficSplitting) {
+		updater.log.Info(
+			"Traffic splitting status changed",
+			"oldStatus",
+			currentStatus.Components.TrafficSplitting,
+			"newStatus",
+			newStatus.Components.TrafficSplitting)
+		changed = true
+	}
+	if !reflect.DeepEqual(
+		currentStatus.Components.GrafanaDashboard,
+		newStatus.Components.GrafanaDashboard) {
+		updater.log.Info(
+			"Grafana dashboard status changed",
+			"oldStatus",
+			currentStatus.Components.GrafanaDashboard,
+			"newStatus",
+			newStatus.Components.GrafanaDashboard)
+		changed = true
+	}
+	if isBackpressureStatusChanged(
+		currentStatus.BackpressureStatus, newStatus.BackpressureStatus) {
+		updater.log.Info(
+			"Backpressure status changed",
+			"oldStatus",
+			currentStatus.BackpressureStatus,
+			"newStatus",
+			newStatus.BackpressureStatus)
+		changed = true
+	}
+	if isJobMetricsChanged(currentStatus.JobMetrics, newStatus.JobMetrics) {
+		updater.log.Info(
+			"Job metrics changed",
+			"oldStatus",
+			currentStatus.JobMetrics,
+			"newStatus",
+			newStatus.JobMetrics)
+		changed = true
+	}
+	if currentStatus.EstimatedRolloutSeconds !=
+		newStatus.EstimatedRolloutSeconds {
+		updater.log.Info(
+			"Estimated rollout time changed",
+			"oldStatus",
+			currentStatus.EstimatedRolloutSeconds,
+			"newStatus",
+			newStatus.EstimatedRolloutSeconds)
+		changed = true
+	}
+	if currentStatus.EffectiveParallelism != newStatus.EffectiveParallelism {
+		updater.log.Info(
+			"Effective parallelism changed",
+			"oldStatus",
+			currentStatus.EffectiveParallelism,
+			"newStatus",
+			newStatus.EffectiveParallelism)
+		changed = true
+	}
+	if currentStatus.AvailableSlots != newStatus.AvailableSlots {
+		updater.log.Info(
+			"Available slots changed",
+			"oldStatus",
+			currentStatus.AvailableSlots,
+			"newStatus",
+			newStatus.AvailableSlots)
+		changed = true
+	}
+	if currentStatus.Selector != newStatus.Selector {
+		updater.log.Info(
+			"Selector changed",
+			"oldStatus",
+			currentStatus.Selector,
+			"newStatus",
+			newStatus.Selector)
+		changed = true
+	}
+	if currentStatus.CompletionTime != newStatus.CompletionTime {
+		updater.log.Info(
+			"Completion time changed",
+			"oldStatus",
+			currentStatus.CompletionTime,
+			"newStatus",
+			newStatus.CompletionTime)
+		changed = true
+	}
+	// The config is compared by its checksum, it is not logged because it
+	// might be large.
+	if currentStatus.EffectiveConfigChecksum !=
+		newStatus.EffectiveConfigChecksum {
+		updater.log.Info(
+			"Effective Flink config changed",
+			"oldChecksum",
+			currentStatus.EffectiveConfigChecksum,
+			"newChecksum",
+			newStatus.EffectiveConfigChecksum)
+		changed = true
+	}
+	if isFlinkStatusChanged(currentStatus.Flink, newStatus.Flink) {
+		updater.log.Info(
+			"Flink status changed",
+			"oldStatus",
+			currentStatus.Flink,
+			"newStatus",
+			newStatus.Flink)
+		changed = true
+	}
 	return changed
 }
 
+// Patches the status of the cluster with the changed fields. The resource
+// version of the base is cleared, so that the patch carries it and fails on
+// conflict like an update, because the status is derived from the observed
+// cluster.
 func (updater *ClusterStatusUpdater) updateClusterStatus(
 	status v1beta1.FlinkClusterStatus) error {
+	var base = updater.observed.cluster.DeepCopy()
+	base.ObjectMeta.ResourceVersion = ""
 	var cluster = v1beta1.FlinkCluster{}
 	updater.observed.cluster.DeepCopyInto(&cluster)
 	cluster.Status = status
-	return updater.k8sClient.Status().Update(updater.context, &cluster)
+	return updater.k8sClient.Status().Patch(
+		updater.context, &cluster, client.MergeFrom(base))
 }
 
+// Gets the state of the deployment, which is ready only after the deployment
+// controller has observed its latest spec and all the desired replicas exist
+// and are available. A freshly created deployment has an empty status, which
+// must not be mistaken for a ready one with no replicas.
 func getDeploymentState(deployment *appsv1.Deployment) string {
-	if deployment.Status.AvailableReplicas >= *deployment.Spec.Replicas {
-		return v1beta1.ComponentStateReady
+	var desiredReplicas int32 = 1
+	if deployment.Spec.Replicas != nil {
+		desiredReplicas = *deployment.Spec.Replicas
+	}
+	var status = deployment.Status
+	if status.ObservedGeneration < deployment.ObjectMeta.Generation ||
+		status.Replicas != desiredReplicas ||
+		status.AvailableReplicas < desiredReplicas {
+		return v1beta1.ComponentStateNotReady
+	}
+	return v1beta1.ComponentStateReady
+}
+
+// Gets the state of a StatefulSet, which is ready when all of its desired
+// replicas are ready, like a deployment.
+func getStatefulSetState(statefulSet *appsv1.StatefulSet) string {
+	var desiredReplicas int32 = 1
+	if statefulSet.Spec.Replicas != nil {
+		desiredReplicas = *statefulSet.Spec.Replicas
+	}
+	var status = statefulSet.Status
+	if status.ObservedGeneration < statefulSet.ObjectMeta.Generation ||
+		status.Replicas != desiredReplicas ||
+		status.ReadyReplicas < desiredReplicas {
+		return v1beta1.ComponentStateNotReady
+	}
+	return v1beta1.ComponentStateReady
+}
+
+// Checks whether the component state has changed, ignoring the last
+// transition time which only changes along with the state.
+func isComponentStateChanged(
+	current v1beta1.FlinkClusterComponentState,
+	updated v1beta1.FlinkClusterComponentState) bool {
+	return current.Name != updated.Name ||
+		current.State != updated.State ||
+		current.Reason != updated.Reason ||
+		current.Replicas != updated.Replicas ||
+		current.Leader != updated.Leader ||
+		current.DesiredReplicas != updated.DesiredReplicas ||
+		current.LastScaleTime != updated.LastScaleTime ||
+		current.DrainStartTime != updated.DrainStartTime ||
+		isJobManagerMetricsChanged(current.Metrics, updated.Metrics)
+}
+
+// The observed time of the metrics snapshot is not a change by itself, so
+// that a refreshed snapshot with the same values does not update the status.
+func isJobManagerMetricsChanged(
+	current *v1beta1.JobManagerMetrics, updated *v1beta1.JobManagerMetrics) bool {
+	if current == nil || updated == nil {
+		return current != updated
+	}
+	var currentMetrics, updatedMetrics = *current, *updated
+	currentMetrics.ObservedTime = ""
+	updatedMetrics.ObservedTime = ""
+	return currentMetrics != updatedMetrics
+}
+
+func isJobManagerServiceStatusChanged(
+	current v1beta1.JobManagerServiceStatus,
+	updated v1beta1.JobManagerServiceStatus) bool {
+	return current.Name != updated.Name ||
+		current.State != updated.State ||
+		current.NodePort != updated.NodePort ||
+		current.WebUIURL != updated.WebUIURL
+}
+
+// Gets the URL of the Flink Web UI through the JobManager service, depending
+// on its type: the node IP of a JobManager pod and the node port for
+// NodePort, the first external address for LoadBalancer, and the in-cluster
+// address for ClusterIP. It is empty until the address is assigned, e.g., the
+// LoadBalancer is provisioned or the JobManager pod is scheduled.
+func getWebUIURL(
+	cluster *v1beta1.FlinkCluster,
+	service *corev1.Service,
+	jmPods []corev1.Pod) string {
+	var uiPort = getServiceUIPort(service)
+	if uiPort == nil {
+		return ""
+	}
+	var scheme = "http"
+	if cluster != nil && cluster.Spec.Security != nil &&
+		cluster.Spec.Security.RESTTLS != nil {
+		scheme = "https"
+	}
+	var getURL = func(host string, port int32) string {
+		return scheme + "://" + net.JoinHostPort(host, fmt.Sprint(port))
+	}
+
+	switch service.Spec.Type {
+	case corev1.ServiceTypeNodePort:
+		if uiPort.NodePort == 0 {
+			return ""
+		}
+		for _, pod := range jmPods {
+			if len(pod.Status.HostIP) > 0 {
+				return getURL(pod.Status.HostIP, uiPort.NodePort)
+			}
+		}
+	case corev1.ServiceTypeLoadBalancer:
+		for _, ingress := range service.Status.LoadBalancer.Ingress {
+			if len(ingress.IP) > 0 {
+				return getURL(ingress.IP, uiPort.Port)
+			}
+			if len(ingress.Hostname) > 0 {
+				return getURL(ingress.Hostname, uiPort.Port)
+			}
+		}
+	case corev1.ServiceTypeClusterIP:
+		if len(service.Spec.ClusterIP) > 0 {
+			return getURL(
+				fmt.Sprintf(
+					"%s.%s.svc.cluster.local", service.Name, service.Namespace),
+				uiPort.Port)
+		}
+	}
+	return ""
+}
+
+// Gets the UI port of the JobManager service, nil if there is none.
+func getServiceUIPort(service *corev1.Service) *corev1.ServicePort {
+	for i := range service.Spec.Ports {
+		if service.Spec.Ports[i].Name == "ui" {
+			return &service.Spec.Ports[i]
+		}
+	}
+	return nil
+}
+
+func isJobStatusEqual(current *v1beta1.JobStatus, updated *v1beta1.JobStatus) bool {
+	var currentCopy = *current
+	var updatedCopy = *updated
+	currentCopy.LastTransitionTime = ""
+	updatedCopy.LastTransitionTime = ""
+	currentCopy.Rescale = nil
+	updatedCopy.Rescale = nil
+	return currentCopy == updatedCopy &&
+		reflect.DeepEqual(current.Rescale, updated.Rescale)
+}
+
+// Compares the states of the TaskManager pools element by element.
+func isTaskManagerPoolsStatusChanged(
+	current map[string]v1beta1.FlinkClusterComponentState,
+	updated map[string]v1beta1.FlinkClusterComponentState) bool {
+	if len(current) != len(updated) {
+		return true
+	}
+	for name, currentState := range current {
+		var updatedState, ok = updated[name]
+		if !ok || isComponentStateChanged(currentState, updatedState) {
+			return true
+		}
+	}
+	return false
+}
+
+func isTrafficSplittingStatusChanged(
+	current *v1beta1.TrafficSplittingStatus,
+	updated *v1beta1.TrafficSplittingStatus) bool {
+	if current == nil || updated == nil {
+		return current != updated
+	}
+	return isComponentStateChanged(current.VirtualService, updated.VirtualService) ||
+		isComponentStateChanged(current.VersionA, updated.VersionA) ||
+		isComponentStateChanged(current.VersionB, updated.VersionB)
+}
+
+// Checks whether the backpressure levels of the vertices have changed, a nil
+// list is considered the same as an empty one. The ratios fluctuate with every
+// sampling, so they are updated only along with other changes.
+func isBackpressureStatusChanged(
+	current []v1beta1.VertexBackpressure,
+	updated []v1beta1.VertexBackpressure) bool {
+	if len(current) != len(updated) {
+		return true
+	}
+	for i := range current {
+		if current[i].VertexName != updated[i].VertexName ||
+			current[i].Level != updated[i].Level {
+			return true
+		}
+	}
+	return false
+}
+
+func isJobMetricsChanged(
+	current *v1beta1.JobMetrics, updated *v1beta1.JobMetrics) bool {
+	if current == nil || updated == nil {
+		return current != updated
+	}
+	return *current != *updated
+}
+
+func isFlinkStatusChanged(
+	current *v1beta1.FlinkStatus, updated *v1beta1.FlinkStatus) bool {
+	if current == nil || updated == nil {
+		return current != updated
 	}
-	return v1beta1.ComponentStateNotReady
+	return *current != *updated
 }
@@ -17,11 +17,24 @@ limitations under the License.
 package controllers
 
 import (
+	"context"
+	"fmt"
 	"testing"
+	"time"
 
 	v1beta1 "github.com/googlecloudplatform/flink-operator/api/v1beta1"
+	"github.com/googlecloudplatform/flink-operator/controllers/flinkclient"
 	"gotest.tools/assert"
 	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	extensionsv1beta1 "k8s.io/api/extensions/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
 	"sigs.k8s.io/controller-runtime/pkg/log"
 )
 
@@ -29,7 +42,7 @@ func TestGetDeploymentStateNotReady(t *testing.T) {
 	var replicas int32 = 3
 	var deployment = appsv1.Deployment{
 		Spec:   appsv1.DeploymentSpec{Replicas: &replicas},
-		Status: appsv1.DeploymentStatus{AvailableReplicas: 2},
+		Status: appsv1.DeploymentStatus{Replicas: 3, AvailableReplicas: 2},
 	}
 	var state = getDeploymentState(&deployment)
 	assert.Assert(
@@ -40,12 +53,86 @@ func TestGetDeploymentStateReady(t *testing.T) {
 	var replicas int32 = 3
 	var deployment = appsv1.Deployment{
 		Spec:   appsv1.DeploymentSpec{Replicas: &replicas},
-		Status: appsv1.DeploymentStatus{AvailableReplicas: 3},
+		Status: appsv1.DeploymentStatus{Replicas: 3, AvailableReplicas: 3},
 	}
 	var state = getDeploymentState(&deployment)
 	assert.Assert(t, state == v1beta1.ComponentStateReady)
 }
 
+func TestDeriveTaskManagerStatefulSetStatus(t *testing.T) {
+	var updater = &ClusterStatusUpdater{log: log.Log}
+	var observed = getTestObservedSessionCluster(2)
+	var replicas int32 = 2
+	observed.tmDeployment = nil
+	observed.tmStatefulSet = &appsv1.StatefulSet{
+		ObjectMeta: metav1.ObjectMeta{Name: "mycluster-taskmanager"},
+		Spec: appsv1.StatefulSetSpec{
+			Replicas: &replicas,
+			Selector: &metav1.LabelSelector{
+				MatchLabels: map[string]string{"component": "taskmanager"},
+			},
+		},
+		Status: appsv1.StatefulSetStatus{Replicas: 2, ReadyReplicas: 1},
+	}
+	var recorded = v1beta1.FlinkClusterStatus{
+		State: v1beta1.ClusterStateCreating}
+
+	// Not all the replicas are ready.
+	var status = updater.deriveClusterStatus(&recorded, &observed)
+	var tmStatus = status.Components.TaskManagerDeployment
+	assert.Equal(t, tmStatus.Name, "mycluster-taskmanager")
+	assert.Equal(t, tmStatus.State, v1beta1.ComponentStateNotReady)
+	assert.Equal(t, tmStatus.Replicas, int32(2))
+	assert.Equal(t, status.Selector, "component=taskmanager")
+	assert.Equal(t, status.State, v1beta1.ClusterStateCreating)
+	assert.Equal(
+		t, status.Message, "Waiting for TaskManager StatefulSet (1/2 ready)")
+
+	// All the replicas are ready.
+	observed.tmStatefulSet.Status.ReadyReplicas = 2
+	status = updater.deriveClusterStatus(&recorded, &observed)
+	assert.Equal(
+		t,
+		status.Components.TaskManagerDeployment.State,
+		v1beta1.ComponentStateReady)
+	assert.Equal(t, status.State, v1beta1.ClusterStateRunning)
+}
+
+func TestGetDeploymentStateNotObserved(t *testing.T) {
+	// Freshly created, the status is empty.
+	var replicas int32 = 0
+	var deployment = appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{Generation: 1},
+		Spec:       appsv1.DeploymentSpec{Replicas: &replicas},
+	}
+	assert.Equal(
+		t, getDeploymentState(&deployment), v1beta1.ComponentStateNotReady)
+
+	// The deployment controller has not observed the latest spec.
+	replicas = 2
+	deployment.ObjectMeta.Generation = 2
+	deployment.Status = appsv1.DeploymentStatus{
+		ObservedGeneration: 1,
+		Replicas:           2,
+		AvailableReplicas:  2,
+	}
+	assert.Equal(
+		t, getDeploymentState(&deployment), v1beta1.ComponentStateNotReady)
+
+	// The pods are not created yet.
+	deployment.Status = appsv1.DeploymentStatus{ObservedGeneration: 2}
+	assert.Equal(
+		t, getDeploymentState(&deployment), v1beta1.ComponentStateNotReady)
+
+	deployment.Status = appsv1.DeploymentStatus{
+		ObservedGeneration: 2,
+		Replicas:           2,
+		AvailableReplicas:  2,
+	}
+	assert.Equal(
+		t, getDeploymentState(&deployment), v1beta1.ComponentStateReady)
+}
+
 func TestIsStatusChangedFalse(t *testing.T) {
 	var oldStatus = v1beta1.FlinkClusterStatus{}
 	var newStatus = v1beta1.FlinkClusterStatus{}
@@ -106,3 +193,2048 @@ func TestIsStatusChangedTrue(t *testing.T) {
 	var updater = &ClusterStatusUpdater{log: log.Log}
 	assert.Assert(t, updater.isStatusChanged(oldStatus, newStatus))
 }
+
+func TestUpdateClusterStatusPatchesChangedFields(t *testing.T) {
+	var cluster = getTestSessionCluster()
+	cluster.ResourceVersion = "1"
+	cluster.Status.State = v1beta1.ClusterStateCreating
+	var testScheme = runtime.NewScheme()
+	assert.NilError(t, v1beta1.AddToScheme(testScheme))
+	var k8sClient = &patchSpyClient{
+		Client: fake.NewFakeClientWithScheme(testScheme, cluster.DeepCopy()),
+	}
+	var updater = &ClusterStatusUpdater{
+		k8sClient: k8sClient,
+		context:   context.Background(),
+		log:       log.Log,
+		observed:  ObservedClusterState{cluster: cluster},
+	}
+
+	var status = cluster.Status.DeepCopy()
+	status.State = v1beta1.ClusterStateRunning
+	assert.NilError(t, updater.updateClusterStatus(*status))
+
+	// The patch carries the resource version for the conflict check.
+	assert.DeepEqual(
+		t,
+		k8sClient.patches,
+		[]string{
+			`{"metadata":{"resourceVersion":"1"},"status":{"state":"Running"}}`,
+		})
+	var updated = &v1beta1.FlinkCluster{}
+	assert.NilError(
+		t,
+		k8sClient.Get(
+			context.Background(),
+			types.NamespacedName{Namespace: cluster.Namespace, Name: cluster.Name},
+			updated))
+	assert.Equal(t, updated.Status.State, v1beta1.ClusterStateRunning)
+}
+
+func TestUpdateStatusIfChangedDerivedState(t *testing.T) {
+	var cluster = getTestSessionCluster()
+	cluster.Status.State = v1beta1.ClusterStateRunning
+	var testScheme = runtime.NewScheme()
+	assert.NilError(t, v1beta1.AddToScheme(testScheme))
+	var k8sClient = fake.NewFakeClientWithScheme(testScheme, cluster.DeepCopy())
+	var updater = &ClusterStatusUpdater{
+		k8sClient: k8sClient,
+		context:   context.Background(),
+		log:       log.Log,
+		recorder:  record.NewFakeRecorder(100),
+		observed:  ObservedClusterState{cluster: cluster},
+	}
+
+	// The state derived from the missing components, rather than the state
+	// recorded before the update, drives the requeue backoff.
+	var changed, err = updater.updateStatusIfChanged()
+	assert.NilError(t, err)
+	assert.Assert(t, changed)
+	var updated = &v1beta1.FlinkCluster{}
+	assert.NilError(
+		t,
+		k8sClient.Get(
+			context.Background(),
+			types.NamespacedName{Namespace: cluster.Namespace, Name: cluster.Name},
+			updated))
+	assert.Assert(t, updater.derivedState != v1beta1.ClusterStateRunning)
+	assert.Equal(t, updater.derivedState, updated.Status.State)
+}
+
+func TestUpdateStatusIfChangedBatching(t *testing.T) {
+	var cluster = getTestSessionCluster()
+	cluster.UID = "7c4f"
+	var testScheme = runtime.NewScheme()
+	assert.NilError(t, v1beta1.AddToScheme(testScheme))
+	var k8sClient = fake.NewFakeClientWithScheme(testScheme, cluster.DeepCopy())
+	var batcher = &StatusBatcher{Interval: time.Minute}
+	var getStatus = func() v1beta1.FlinkClusterStatus {
+		var updated = &v1beta1.FlinkCluster{}
+		assert.NilError(
+			t,
+			k8sClient.Get(
+				context.Background(),
+				types.NamespacedName{
+					Namespace: cluster.Namespace, Name: cluster.Name},
+				updated))
+		return updated.Status
+	}
+	var newUpdater = func() *ClusterStatusUpdater {
+		var observed = getStatus()
+		var updatedCluster = cluster.DeepCopy()
+		updatedCluster.Status = observed
+		return &ClusterStatusUpdater{
+			k8sClient: k8sClient,
+			context:   context.Background(),
+			log:       log.Log,
+			recorder:  record.NewFakeRecorder(100),
+			observed:  ObservedClusterState{cluster: updatedCluster},
+			batcher:   batcher,
+		}
+	}
+
+	// The first status is written.
+	var changed, err = newUpdater().updateStatusIfChanged()
+	assert.NilError(t, err)
+	assert.Assert(t, changed)
+	var written = getStatus()
+
+	// A change of a sub-field within the interval is not written, and the
+	// reconcile is requeued at the end of the interval.
+	var updater = newUpdater()
+	updater.observed.cluster.Status.Components.ConfigMap.Name = "stale"
+	changed, err = updater.updateStatusIfChanged()
+	assert.NilError(t, err)
+	assert.Assert(t, !changed)
+	assert.Assert(t, updater.debounceRemaining > 0)
+	assert.Assert(t, updater.debounceRemaining <= time.Minute)
+	assert.DeepEqual(t, getStatus(), written)
+
+	// A change of the cluster state is written at once, e.g., when the
+	// recorded state is outdated.
+	updater = newUpdater()
+	updater.observed.cluster.Status.State = v1beta1.ClusterStateRunning
+	changed, err = updater.updateStatusIfChanged()
+	assert.NilError(t, err)
+	assert.Assert(t, changed)
+	assert.Equal(t, getStatus().State, updater.derivedState)
+}
+
+func TestDeriveTrafficSplittingStatus(t *testing.T) {
+	var cluster = getTestSessionCluster()
+	cluster.Spec.Networking = &v1beta1.NetworkingSpec{
+		ServiceMesh: &v1beta1.ServiceMeshSpec{
+			TrafficSplitting: &v1beta1.TrafficSplittingSpec{Enabled: true},
+		},
+	}
+	var observed = ObservedClusterState{cluster: cluster}
+	assert.Assert(t, deriveTrafficSplittingStatus(nil, &observed) == nil)
+
+	var virtualService = &unstructured.Unstructured{}
+	virtualService.SetGroupVersionKind(virtualServiceGVK)
+	virtualService.SetName("my-cluster-traffic-split")
+	observed = ObservedClusterState{
+		cluster:        cluster,
+		virtualService: virtualService,
+		clusterA: &v1beta1.FlinkCluster{
+			ObjectMeta: metav1.ObjectMeta{Name: "my-cluster-version-a"},
+			Status: v1beta1.FlinkClusterStatus{
+				Components: v1beta1.FlinkClusterComponentsStatus{
+					Job: &v1beta1.JobStatus{State: v1beta1.JobStateRunning},
+				},
+			},
+		},
+		clusterB: &v1beta1.FlinkCluster{
+			ObjectMeta: metav1.ObjectMeta{Name: "my-cluster-version-b"},
+		},
+	}
+	var status = deriveTrafficSplittingStatus(nil, &observed)
+	var expectedStatus = v1beta1.TrafficSplittingStatus{
+		VirtualService: v1beta1.FlinkClusterComponentState{
+			Name:  "my-cluster-traffic-split",
+			State: v1beta1.ComponentStateReady,
+		},
+		VersionA: v1beta1.FlinkClusterComponentState{
+			Name:  "my-cluster-version-a",
+			State: v1beta1.JobStateRunning,
+		},
+		VersionB: v1beta1.FlinkClusterComponentState{
+			Name:  "my-cluster-version-b",
+			State: v1beta1.JobStatePending,
+		},
+	}
+	assert.DeepEqual(t, *status, expectedStatus)
+
+	// The VirtualService and the cluster of version B were deleted.
+	observed.virtualService = nil
+	observed.clusterB = nil
+	status = deriveTrafficSplittingStatus(status, &observed)
+	assert.Equal(
+		t, status.VirtualService.State, v1beta1.ComponentStateDeleted)
+	assert.Equal(t, status.VersionB.State, v1beta1.ComponentStateDeleted)
+
+	// Traffic splitting is disabled and all its resources are deleted.
+	cluster.Spec.Networking.ServiceMesh.TrafficSplitting.Enabled = false
+	observed.clusterA = nil
+	assert.Assert(t, deriveTrafficSplittingStatus(status, &observed) == nil)
+}
+
+func TestSetLastTransitionTimes(t *testing.T) {
+	var tc = &TimeConverter{}
+	var recordedTime = "2019-10-23T05:10:36Z"
+	var now = tc.FromString("2019-10-23T05:20:00Z")
+	var recorded = v1beta1.FlinkClusterStatus{
+		Components: v1beta1.FlinkClusterComponentsStatus{
+			JobManagerDeployment: v1beta1.FlinkClusterComponentState{
+				Name:               "my-jobmanager",
+				State:              "NotReady",
+				LastTransitionTime: recordedTime,
+			},
+			TaskManagerDeployment: v1beta1.FlinkClusterComponentState{
+				Name:               "my-taskmanager",
+				State:              "NotReady",
+				LastTransitionTime: recordedTime,
+			},
+		},
+	}
+	var status = v1beta1.FlinkClusterStatus{
+		Components: v1beta1.FlinkClusterComponentsStatus{
+			JobManagerDeployment: v1beta1.FlinkClusterComponentState{
+				Name:  "my-jobmanager",
+				State: "Ready",
+			},
+			TaskManagerDeployment: v1beta1.FlinkClusterComponentState{
+				Name:  "my-taskmanager",
+				State: "NotReady",
+			},
+			Job: &v1beta1.JobStatus{
+				Name:  "my-job",
+				State: "Pending",
+			},
+		},
+	}
+
+	setLastTransitionTimes(&recorded, &status, now)
+
+	assert.Equal(
+		t,
+		status.Components.JobManagerDeployment.LastTransitionTime,
+		"2019-10-23T05:20:00Z")
+	assert.Equal(
+		t,
+		status.Components.TaskManagerDeployment.LastTransitionTime,
+		recordedTime)
+	assert.Equal(
+		t, status.Components.Job.LastTransitionTime, "2019-10-23T05:20:00Z")
+	assert.Equal(t, status.Components.ConfigMap.LastTransitionTime, "")
+}
+
+func TestIsStatusChangedIgnoresLastTransitionTime(t *testing.T) {
+	var oldStatus = v1beta1.FlinkClusterStatus{
+		Components: v1beta1.FlinkClusterComponentsStatus{
+			JobManagerDeployment: v1beta1.FlinkClusterComponentState{
+				Name:  "my-jobmanager",
+				State: "Ready",
+			},
+			Job: &v1beta1.JobStatus{
+				Name:  "my-job",
+				State: "Running",
+			},
+		},
+		State: "Running"}
+	var newStatus = v1beta1.FlinkClusterStatus{
+		Components: v1beta1.FlinkClusterComponentsStatus{
+			JobManagerDeployment: v1beta1.FlinkClusterComponentState{
+				Name:               "my-jobmanager",
+				State:              "Ready",
+				LastTransitionTime: "2019-10-23T05:10:36Z",
+			},
+			Job: &v1beta1.JobStatus{
+				Name:               "my-job",
+				State:              "Running",
+				LastTransitionTime: "2019-10-23T05:10:36Z",
+			},
+		},
+		State: "Running"}
+	var updater = &ClusterStatusUpdater{log: log.Log}
+	assert.Assert(t, updater.isStatusChanged(oldStatus, newStatus) == false)
+}
+
+func TestDeriveBackpressureStatus(t *testing.T) {
+	var recorded = v1beta1.FlinkClusterStatus{
+		Components: v1beta1.FlinkClusterComponentsStatus{
+			Job: &v1beta1.JobStatus{State: v1beta1.JobStateRunning},
+		},
+		BackpressureStatus: []v1beta1.VertexBackpressure{
+			{VertexName: "Source", Ratio: 50, Level: v1beta1.BackpressureLevelLow},
+		},
+	}
+	var observedBackpressure = []v1beta1.VertexBackpressure{
+		{VertexName: "Source", Ratio: 90, Level: v1beta1.BackpressureLevelHigh},
+	}
+
+	// Observed.
+	var observed = ObservedClusterState{
+		job:               &batchv1.Job{},
+		flinkBackpressure: observedBackpressure,
+	}
+	assert.DeepEqual(
+		t, deriveBackpressureStatus(&recorded, &observed), observedBackpressure)
+
+	// Not observed while the job is running.
+	observed = ObservedClusterState{job: &batchv1.Job{}}
+	assert.DeepEqual(
+		t,
+		deriveBackpressureStatus(&recorded, &observed),
+		recorded.BackpressureStatus)
+
+	// Not observed after the job is deleted.
+	observed = ObservedClusterState{}
+	assert.Assert(t, deriveBackpressureStatus(&recorded, &observed) == nil)
+}
+
+func TestDeriveJobMetrics(t *testing.T) {
+	var recorded = v1beta1.FlinkClusterStatus{
+		Components: v1beta1.FlinkClusterComponentsStatus{
+			Job: &v1beta1.JobStatus{State: v1beta1.JobStateRunning},
+		},
+		JobMetrics: &v1beta1.JobMetrics{
+			RecordsPerSecondIn:  10,
+			RecordsPerSecondOut: 8,
+			BackpressureLevel:   v1beta1.BackpressureLevelOK,
+		},
+	}
+	var backpressure = []v1beta1.VertexBackpressure{
+		{VertexName: "Source", Ratio: 20, Level: v1beta1.BackpressureLevelLow},
+		{VertexName: "Map", Ratio: 90, Level: v1beta1.BackpressureLevelHigh},
+		{VertexName: "Sink", Ratio: 0, Level: v1beta1.BackpressureLevelOK},
+	}
+
+	// Observed, with the highest level of the vertices.
+	var observed = ObservedClusterState{
+		job: &batchv1.Job{},
+		flinkJobMetrics: &v1beta1.JobMetrics{
+			RecordsPerSecondIn: 20, RecordsPerSecondOut: 16},
+	}
+	assert.DeepEqual(
+		t,
+		deriveJobMetrics(&recorded, &observed, backpressure),
+		&v1beta1.JobMetrics{
+			RecordsPerSecondIn:  20,
+			RecordsPerSecondOut: 16,
+			BackpressureLevel:   v1beta1.BackpressureLevelHigh,
+		})
+
+	// Not polled while the job is running, the recorded throughput is kept.
+	observed = ObservedClusterState{job: &batchv1.Job{}}
+	assert.DeepEqual(
+		t,
+		deriveJobMetrics(&recorded, &observed, backpressure[:1]),
+		&v1beta1.JobMetrics{
+			RecordsPerSecondIn:  10,
+			RecordsPerSecondOut: 8,
+			BackpressureLevel:   v1beta1.BackpressureLevelLow,
+		})
+
+	// Not observed after the job is deleted.
+	observed = ObservedClusterState{}
+	assert.Assert(t, deriveJobMetrics(&recorded, &observed, nil) == nil)
+}
+
+func TestIsStatusChangedBackpressure(t *testing.T) {
+	var updater = &ClusterStatusUpdater{log: log.Log}
+	var oldStatus = v1beta1.FlinkClusterStatus{}
+	var newStatus = v1beta1.FlinkClusterStatus{
+		BackpressureStatus: []v1beta1.VertexBackpressure{},
+	}
+	assert.Assert(t, updater.isStatusChanged(oldStatus, newStatus) == false)
+
+	newStatus.BackpressureStatus = []v1beta1.VertexBackpressure{
+		{VertexName: "Source", Ratio: 90, Level: v1beta1.BackpressureLevelHigh},
+		{VertexName: "Sink", Ratio: 10, Level: v1beta1.BackpressureLevelOK},
+	}
+	assert.Assert(t, updater.isStatusChanged(oldStatus, newStatus) == true)
+
+	oldStatus.BackpressureStatus = []v1beta1.VertexBackpressure{
+		{VertexName: "Source", Ratio: 90, Level: v1beta1.BackpressureLevelHigh},
+		{VertexName: "Sink", Ratio: 10, Level: v1beta1.BackpressureLevelOK},
+	}
+	assert.Assert(t, updater.isStatusChanged(oldStatus, newStatus) == false)
+
+	// Only the levels are compared.
+	newStatus.BackpressureStatus[1].Ratio = 20
+	assert.Assert(t, updater.isStatusChanged(oldStatus, newStatus) == false)
+
+	newStatus.BackpressureStatus[1].Level = v1beta1.BackpressureLevelLow
+	assert.Assert(t, updater.isStatusChanged(oldStatus, newStatus) == true)
+}
+
+func TestDeriveTaskManagerPoolsStatus(t *testing.T) {
+	var replicas int32 = 2
+	var recorded = map[string]v1beta1.FlinkClusterComponentState{
+		"cpu": {
+			Name:  "mycluster-taskmanager-cpu",
+			State: v1beta1.ComponentStateNotReady,
+		},
+		"old": {
+			Name:  "mycluster-taskmanager-old",
+			State: v1beta1.ComponentStateReady,
+		},
+		"older": {
+			Name:  "mycluster-taskmanager-older",
+			State: v1beta1.ComponentStateDeleted,
+		},
+	}
+	var observed = map[string]*appsv1.Deployment{
+		"cpu": {
+			ObjectMeta: metav1.ObjectMeta{Name: "mycluster-taskmanager-cpu"},
+			Spec:       appsv1.DeploymentSpec{Replicas: &replicas},
+			Status: appsv1.DeploymentStatus{
+				Replicas: 2, AvailableReplicas: 2},
+		},
+		"memory": {
+			ObjectMeta: metav1.ObjectMeta{Name: "mycluster-taskmanager-memory"},
+			Spec:       appsv1.DeploymentSpec{Replicas: &replicas},
+			Status: appsv1.DeploymentStatus{
+				Replicas: 2, AvailableReplicas: 1},
+		},
+	}
+
+	var status = deriveTaskManagerPoolsStatus(recorded, observed)
+
+	assert.DeepEqual(
+		t,
+		status,
+		map[string]v1beta1.FlinkClusterComponentState{
+			"cpu": {
+				Name:  "mycluster-taskmanager-cpu",
+				State: v1beta1.ComponentStateReady,
+			},
+			"memory": {
+				Name:  "mycluster-taskmanager-memory",
+				State: v1beta1.ComponentStateNotReady,
+			},
+			"old": {
+				Name:  "mycluster-taskmanager-old",
+				State: v1beta1.ComponentStateDeleted,
+			},
+		})
+	assert.Assert(t, deriveTaskManagerPoolsStatus(nil, nil) == nil)
+
+	// The deleted pools are pruned.
+	status = deriveTaskManagerPoolsStatus(
+		map[string]v1beta1.FlinkClusterComponentState{"old": status["old"]},
+		nil)
+	assert.Assert(t, status == nil)
+}
+
+func TestIsStatusChangedTaskManagerPools(t *testing.T) {
+	var updater = &ClusterStatusUpdater{log: log.Log}
+	var oldStatus = v1beta1.FlinkClusterStatus{}
+	oldStatus.Components.TaskManagerPools =
+		map[string]v1beta1.FlinkClusterComponentState{
+			"cpu": {
+				Name:               "mycluster-taskmanager-cpu",
+				State:              v1beta1.ComponentStateReady,
+				LastTransitionTime: "2020-01-01T00:00:00+00:00",
+			},
+		}
+	var newStatus = v1beta1.FlinkClusterStatus{}
+	newStatus.Components.TaskManagerPools =
+		map[string]v1beta1.FlinkClusterComponentState{
+			"cpu": {
+				Name:               "mycluster-taskmanager-cpu",
+				State:              v1beta1.ComponentStateReady,
+				LastTransitionTime: "2020-01-02T00:00:00+00:00",
+			},
+		}
+	assert.Assert(t, updater.isStatusChanged(oldStatus, newStatus) == false)
+
+	newStatus.Components.TaskManagerPools["cpu"] =
+		v1beta1.FlinkClusterComponentState{
+			Name:  "mycluster-taskmanager-cpu",
+			State: v1beta1.ComponentStateNotReady,
+		}
+	assert.Assert(t, updater.isStatusChanged(oldStatus, newStatus) == true)
+
+	newStatus.Components.TaskManagerPools =
+		map[string]v1beta1.FlinkClusterComponentState{
+			"memory": {
+				Name:  "mycluster-taskmanager-memory",
+				State: v1beta1.ComponentStateReady,
+			},
+		}
+	assert.Assert(t, updater.isStatusChanged(oldStatus, newStatus) == true)
+}
+
+func getTestObservedSessionCluster(replicas int32) ObservedClusterState {
+	var newDeployment = func(name string) *appsv1.Deployment {
+		var deploymentReplicas = replicas
+		return &appsv1.Deployment{
+			ObjectMeta: metav1.ObjectMeta{Name: name},
+			Spec:       appsv1.DeploymentSpec{Replicas: &deploymentReplicas},
+			Status: appsv1.DeploymentStatus{
+				Replicas:          replicas,
+				AvailableReplicas: replicas,
+			},
+		}
+	}
+	return ObservedClusterState{
+		cluster: &v1beta1.FlinkCluster{
+			ObjectMeta: metav1.ObjectMeta{Name: "mycluster"},
+			Spec: v1beta1.FlinkClusterSpec{
+				TaskManager: v1beta1.TaskManagerSpec{Replicas: replicas},
+			},
+		},
+		configMap: &corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{Name: "mycluster-configmap"},
+		},
+		jmDeployment: newDeployment("mycluster-jobmanager"),
+		jmService: &corev1.Service{
+			ObjectMeta: metav1.ObjectMeta{Name: "mycluster-jobmanager"},
+			Spec: corev1.ServiceSpec{
+				Type:      corev1.ServiceTypeClusterIP,
+				ClusterIP: "10.0.0.1",
+			},
+		},
+		tmDeployment: newDeployment("mycluster-taskmanager"),
+	}
+}
+
+func TestDeriveClusterStatusSuspended(t *testing.T) {
+	var updater = &ClusterStatusUpdater{log: log.Log}
+
+	// Suspending while the pods are terminating.
+	var observed = getTestObservedSessionCluster(1)
+	observed.cluster.Spec.Suspend = true
+	var recorded = v1beta1.FlinkClusterStatus{
+		State: v1beta1.ClusterStateRunning}
+	var status = updater.deriveClusterStatus(&recorded, &observed)
+	assert.Equal(t, status.State, v1beta1.ClusterStateSuspending)
+
+	// Suspended after the deployments are scaled to zero.
+	observed = getTestObservedSessionCluster(0)
+	observed.cluster.Spec.Suspend = true
+	recorded.State = status.State
+	status = updater.deriveClusterStatus(&recorded, &observed)
+	assert.Equal(t, status.State, v1beta1.ClusterStateSuspended)
+
+	// Stays suspended even if the components are not ready.
+	observed.jmService.Spec.ClusterIP = ""
+	recorded.State = status.State
+	status = updater.deriveClusterStatus(&recorded, &observed)
+	assert.Equal(t, status.State, v1beta1.ClusterStateSuspended)
+
+	// Resumed.
+	observed = getTestObservedSessionCluster(1)
+	observed.tmDeployment.Status.AvailableReplicas = 0
+	status = updater.deriveClusterStatus(&recorded, &observed)
+	assert.Equal(t, status.State, v1beta1.ClusterStateReconciling)
+
+	recorded.State = status.State
+	observed = getTestObservedSessionCluster(1)
+	status = updater.deriveClusterStatus(&recorded, &observed)
+	assert.Equal(t, status.State, v1beta1.ClusterStateRunning)
+
+	// A stopped cluster is not suspended.
+	observed.cluster.Spec.Suspend = true
+	recorded.State = v1beta1.ClusterStateStopped
+	status = updater.deriveClusterStatus(&recorded, &observed)
+	assert.Equal(t, status.State, v1beta1.ClusterStateStopped)
+}
+
+func TestDeriveClusterStatusReadyComponents(t *testing.T) {
+	var updater = &ClusterStatusUpdater{log: log.Log}
+	var recorded = v1beta1.FlinkClusterStatus{
+		State: v1beta1.ClusterStateCreating}
+
+	// Running without a job once the required components are ready.
+	var observed = getTestObservedSessionCluster(1)
+	var status = updater.deriveClusterStatus(&recorded, &observed)
+	assert.Equal(t, status.State, v1beta1.ClusterStateRunning)
+	assert.Equal(t, status.ReadyComponents, 3)
+	assert.Equal(t, status.TotalComponents, 3)
+
+	// A required component is not ready.
+	observed.tmDeployment.Status.AvailableReplicas = 0
+	status = updater.deriveClusterStatus(&recorded, &observed)
+	assert.Equal(t, status.State, v1beta1.ClusterStateCreating)
+	assert.Equal(t, status.ReadyComponents, 2)
+	assert.Equal(t, status.TotalComponents, 3)
+
+	// The TaskManager pools of the spec are required even before they are
+	// created.
+	observed = getTestObservedSessionCluster(1)
+	observed.cluster.Spec.TaskManager.Pools = []v1beta1.TaskManagerPoolSpec{
+		{Name: "highmem"}}
+	status = updater.deriveClusterStatus(&recorded, &observed)
+	assert.Equal(t, status.State, v1beta1.ClusterStateCreating)
+	assert.Equal(t, status.ReadyComponents, 3)
+	assert.Equal(t, status.TotalComponents, 4)
+
+	// The ingress of the spec must be ready as well.
+	observed = getTestObservedSessionCluster(1)
+	observed.cluster.Spec.JobManager.Ingress = &v1beta1.JobManagerIngressSpec{}
+	observed.jmIngress = &extensionsv1beta1.Ingress{
+		ObjectMeta: metav1.ObjectMeta{Name: "mycluster-jobmanager"},
+	}
+	status = updater.deriveClusterStatus(&recorded, &observed)
+	assert.Equal(t, status.State, v1beta1.ClusterStateCreating)
+	assert.Equal(t, status.ReadyComponents, 3)
+	assert.Equal(t, status.TotalComponents, 4)
+	assert.Assert(t, updater.isStatusChanged(recorded, status) == true)
+
+	observed.jmIngress.Status.LoadBalancer.Ingress =
+		[]corev1.LoadBalancerIngress{{IP: "10.0.0.1"}}
+	status = updater.deriveClusterStatus(&recorded, &observed)
+	assert.Equal(t, status.State, v1beta1.ClusterStateRunning)
+	assert.Equal(t, status.ReadyComponents, 4)
+	assert.Equal(t, status.TotalComponents, 4)
+
+	// The components which are no longer in the spec are not counted, e.g.,
+	// a removed pool which is being deleted.
+	observed = getTestObservedSessionCluster(1)
+	observed.tmPools = map[string]*appsv1.Deployment{
+		"highmem": observed.tmDeployment.DeepCopy()}
+	status = updater.deriveClusterStatus(&recorded, &observed)
+	assert.Equal(t, status.State, v1beta1.ClusterStateRunning)
+	assert.Equal(t, status.ReadyComponents, 3)
+	assert.Equal(t, status.TotalComponents, 3)
+}
+
+func TestGetExpectedComponents(t *testing.T) {
+	var cluster = getTestSessionCluster()
+	assert.Equal(t, getExpectedComponents(cluster), 3)
+
+	cluster.Spec.JobManager.Ingress = &v1beta1.JobManagerIngressSpec{}
+	cluster.Spec.TaskManager.Pools = []v1beta1.TaskManagerPoolSpec{
+		{Name: "highmem"}, {Name: "gpu"}}
+	assert.Equal(t, getExpectedComponents(cluster), 6)
+
+	cluster = getTestSessionCluster()
+	cluster.Spec.DeploymentMode = v1beta1.DeploymentModeNative
+	assert.Equal(t, getExpectedComponents(cluster), 2)
+}
+
+func TestDeriveFlinkStatus(t *testing.T) {
+	var overview = flinkclient.ClusterOverview{
+		SlotsTotal:     4,
+		SlotsAvailable: 2,
+		JobsRunning:    1,
+		JobsFinished:   3,
+	}
+	var expected = v1beta1.FlinkStatus{
+		SlotsTotal:     4,
+		SlotsAvailable: 2,
+		JobsRunning:    1,
+		JobsFinished:   3,
+	}
+
+	// Observed.
+	var status = deriveFlinkStatus(nil, &overview)
+	assert.DeepEqual(t, status, &expected)
+
+	// Not observed, the recorded values are kept but stale.
+	var staleStatus = deriveFlinkStatus(status, nil)
+	expected.Stale = true
+	assert.DeepEqual(t, staleStatus, &expected)
+	assert.Assert(t, status.Stale == false)
+
+	// Never observed.
+	assert.Assert(t, deriveFlinkStatus(nil, nil) == nil)
+}
+
+func TestDeriveAvailableSlots(t *testing.T) {
+	var observed = getTestObservedSessionCluster(2)
+	observed.flinkTaskManagers = &flinkclient.TaskManagerList{
+		TaskManagers: []flinkclient.TaskManagerInfo{
+			{ID: "tm-0", SlotsNumber: 2, FreeSlots: 1},
+			{ID: "tm-1", SlotsNumber: 2, FreeSlots: 2},
+		},
+	}
+	var recorded = v1beta1.FlinkClusterStatus{}
+	var status = v1beta1.FlinkClusterStatus{
+		State: v1beta1.ClusterStateRunning}
+
+	// The free slots of the TaskManagers are summed.
+	assert.Equal(t, deriveAvailableSlots(&recorded, &status, &observed), 3)
+
+	// Not observed, the recorded number is kept while running.
+	observed.flinkTaskManagers = nil
+	recorded.AvailableSlots = 3
+	assert.Equal(t, deriveAvailableSlots(&recorded, &status, &observed), 3)
+
+	status.State = v1beta1.ClusterStateStopped
+	assert.Equal(t, deriveAvailableSlots(&recorded, &status, &observed), 0)
+}
+
+func TestDeriveJobManagerMetrics(t *testing.T) {
+	var observed = &v1beta1.JobManagerMetrics{HeapUsed: 95, HeapMax: 100}
+
+	// Not observed, the recorded snapshot is kept.
+	assert.Assert(t, deriveJobManagerMetrics(nil, nil, 0.9) == nil)
+	var metrics = deriveJobManagerMetrics(nil, observed, 0.9)
+	assert.DeepEqual(t, deriveJobManagerMetrics(metrics, nil, 0.9), metrics)
+
+	// The consecutive snapshots above the ratio are counted.
+	assert.Equal(t, metrics.HighHeapSamples, int32(1))
+	metrics = deriveJobManagerMetrics(metrics, observed, 0.9)
+	assert.Equal(t, metrics.HighHeapSamples, int32(2))
+
+	// The count is reset below the ratio or when it is disabled.
+	var below = deriveJobManagerMetrics(
+		metrics, &v1beta1.JobManagerMetrics{HeapUsed: 50, HeapMax: 100}, 0.9)
+	assert.Equal(t, below.HighHeapSamples, int32(0))
+	var disabled = deriveJobManagerMetrics(metrics, observed, 0)
+	assert.Equal(t, disabled.HighHeapSamples, int32(0))
+}
+
+func TestIsJobManagerMetricsChanged(t *testing.T) {
+	var current = &v1beta1.JobManagerMetrics{
+		HeapUsed:     50,
+		HeapMax:      100,
+		ObservedTime: "2020-01-01T00:00:00+00:00",
+	}
+	var updated = current.DeepCopy()
+	updated.ObservedTime = "2020-01-01T00:01:00+00:00"
+	assert.Assert(t, !isJobManagerMetricsChanged(current, updated))
+	updated.HeapUsed = 60
+	assert.Assert(t, isJobManagerMetricsChanged(current, updated))
+	assert.Assert(t, isJobManagerMetricsChanged(nil, updated))
+	assert.Assert(t, !isJobManagerMetricsChanged(nil, nil))
+}
+
+func TestDeriveClusterStatusHighMemoryPressure(t *testing.T) {
+	var updater = &ClusterStatusUpdater{log: log.Log, memoryPressureRatio: 0.9}
+	var recorded = v1beta1.FlinkClusterStatus{
+		State: v1beta1.ClusterStateRunning}
+	var observed = getTestObservedSessionCluster(1)
+	observed.jmMetrics = &v1beta1.JobManagerMetrics{HeapUsed: 95, HeapMax: 100}
+
+	// A single snapshot above the ratio is tolerated.
+	var status = updater.deriveClusterStatus(&recorded, &observed)
+	var jmStatus = status.Components.JobManagerDeployment
+	assert.Equal(t, jmStatus.State, v1beta1.ComponentStateReady)
+	assert.Equal(t, jmStatus.Metrics.HighHeapSamples, int32(1))
+
+	// The JobManager is flagged, but the cluster keeps running.
+	recorded = status
+	status = updater.deriveClusterStatus(&recorded, &observed)
+	jmStatus = status.Components.JobManagerDeployment
+	assert.Equal(t, jmStatus.State, v1beta1.ComponentStateNotReady)
+	assert.Equal(t, jmStatus.Reason, v1beta1.ComponentReasonHighMemoryPressure)
+	assert.Equal(t, status.State, v1beta1.ClusterStateRunning)
+	assert.Assert(t, updater.isStatusChanged(recorded, status) == true)
+
+	// Missing metrics keep the recorded snapshot.
+	recorded = status
+	observed.jmMetrics = nil
+	status = updater.deriveClusterStatus(&recorded, &observed)
+	assert.DeepEqual(
+		t,
+		status.Components.JobManagerDeployment.Metrics,
+		recorded.Components.JobManagerDeployment.Metrics)
+}
+
+func TestDeriveClusterStatusJobManagerLeader(t *testing.T) {
+	var updater = &ClusterStatusUpdater{log: log.Log}
+	var getPod = func(name string, ip string) corev1.Pod {
+		return corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: name},
+			Status: corev1.PodStatus{
+				Phase: corev1.PodRunning,
+				PodIP: ip,
+				Conditions: []corev1.PodCondition{
+					{Type: corev1.PodReady, Status: corev1.ConditionTrue},
+				},
+			},
+		}
+	}
+	var recorded = v1beta1.FlinkClusterStatus{
+		State: v1beta1.ClusterStateRunning}
+	var observed = getTestObservedSessionCluster(2)
+	observed.cluster.Spec.FlinkProperties = map[string]string{
+		"high-availability": "kubernetes",
+	}
+	observed.jmPods = []corev1.Pod{
+		getPod("mycluster-jobmanager-1", "10.8.0.5"),
+		getPod("mycluster-jobmanager-2", "10.8.0.6"),
+	}
+
+	// The leader is elected.
+	observed.jmLeaderAddress = "http://10.8.0.6:8081"
+	var status = updater.deriveClusterStatus(&recorded, &observed)
+	var jmStatus = status.Components.JobManagerDeployment
+	assert.Equal(t, jmStatus.State, v1beta1.ComponentStateReady)
+	assert.Equal(t, jmStatus.Leader, "mycluster-jobmanager-2")
+	assert.Equal(t, status.ReadyComponents, 3)
+
+	// The leader failed, the standby JobManager has not taken over yet.
+	recorded = status
+	observed.jmPods = observed.jmPods[:1]
+	status = updater.deriveClusterStatus(&recorded, &observed)
+	jmStatus = status.Components.JobManagerDeployment
+	assert.Equal(t, jmStatus.State, v1beta1.ComponentStateNotReady)
+	assert.Equal(t, jmStatus.Reason, v1beta1.ComponentReasonLeaderElection)
+	assert.Equal(t, jmStatus.Leader, "")
+	assert.Equal(t, status.ReadyComponents, 2)
+	assert.Assert(t, updater.isStatusChanged(recorded, status) == true)
+
+	// The standby JobManager is elected.
+	recorded = status
+	observed.jmLeaderAddress = "http://10.8.0.5:8081"
+	status = updater.deriveClusterStatus(&recorded, &observed)
+	jmStatus = status.Components.JobManagerDeployment
+	assert.Equal(t, jmStatus.State, v1beta1.ComponentStateReady)
+	assert.Equal(t, jmStatus.Leader, "mycluster-jobmanager-1")
+
+	// Without Kubernetes high availability, there is no leader.
+	observed.cluster.Spec.FlinkProperties = nil
+	observed.jmLeaderAddress = ""
+	status = updater.deriveClusterStatus(&recorded, &observed)
+	jmStatus = status.Components.JobManagerDeployment
+	assert.Equal(t, jmStatus.State, v1beta1.ComponentStateReady)
+	assert.Equal(t, jmStatus.Leader, "")
+}
+
+func TestDeriveJobStatusNotCreated(t *testing.T) {
+	var updater = &ClusterStatusUpdater{log: log.Log}
+	var observed = getTestObservedSessionCluster(1)
+	observed.cluster.Spec.Job = &v1beta1.JobSpec{}
+	var recorded = v1beta1.FlinkClusterStatus{
+		State: v1beta1.ClusterStateCreating}
+
+	// No job is expected while the other components are not ready.
+	observed.tmDeployment.Status.AvailableReplicas = 0
+	var status = updater.deriveClusterStatus(&recorded, &observed)
+	assert.Assert(t, status.Components.Job == nil)
+
+	// The components are ready, but the job has not been created.
+	observed.tmDeployment.Status.AvailableReplicas = 1
+	status = updater.deriveClusterStatus(&recorded, &observed)
+	assert.Equal(t, status.Components.Job.Name, "mycluster-job")
+	assert.Equal(t, status.Components.Job.State, v1beta1.JobStateUnknown)
+	assert.Equal(
+		t,
+		status.Components.Job.Reason,
+		v1beta1.ComponentReasonJobNotCreated)
+
+	// The missing job is not taken as a stopped job.
+	recorded = status
+	status = updater.deriveClusterStatus(&recorded, &observed)
+	assert.Equal(t, status.State, v1beta1.ClusterStateRunning)
+	assert.Equal(t, status.Components.Job.State, v1beta1.JobStateUnknown)
+
+	// The reason is cleared once the job is observed.
+	recorded = status
+	observed.job = &batchv1.Job{
+		ObjectMeta: metav1.ObjectMeta{Name: "mycluster-job"},
+		Spec: batchv1.JobSpec{
+			Template: corev1.PodTemplateSpec{
+				Spec: corev1.PodSpec{
+					Containers: []corev1.Container{{Name: "main"}},
+				},
+			},
+		},
+		Status: batchv1.JobStatus{Active: 1},
+	}
+	updater = &ClusterStatusUpdater{log: log.Log, observed: observed}
+	status = updater.deriveClusterStatus(&recorded, &observed)
+	assert.Equal(t, status.Components.Job.State, v1beta1.JobStatePending)
+	assert.Equal(t, status.Components.Job.Reason, "")
+}
+
+func TestDeriveJobStatusInsufficientSlots(t *testing.T) {
+	var parallelism int32 = 2
+	var observed = getTestObservedSessionCluster(1)
+	observed.cluster.Spec.Job = &v1beta1.JobSpec{Parallelism: &parallelism}
+	observed.job = &batchv1.Job{
+		ObjectMeta: metav1.ObjectMeta{Name: "mycluster-job"},
+		Spec: batchv1.JobSpec{
+			Template: corev1.PodTemplateSpec{
+				Spec: corev1.PodSpec{
+					Containers: []corev1.Container{{Name: "main"}},
+				},
+			},
+		},
+		Status: batchv1.JobStatus{Active: 1},
+	}
+	var recorded = v1beta1.FlinkClusterStatus{
+		State: v1beta1.ClusterStateRunning}
+	var updater = &ClusterStatusUpdater{log: log.Log, observed: observed}
+
+	// A single TaskManager with one slot can't run the job.
+	var status = updater.deriveClusterStatus(&recorded, &observed)
+	assert.Equal(t, status.Components.Job.State, v1beta1.JobStatePending)
+	assert.Equal(
+		t,
+		status.Components.Job.Reason,
+		v1beta1.ComponentReasonInsufficientSlots)
+	assert.Equal(
+		t,
+		status.Message,
+		"Job pending: the TaskManagers have fewer task slots than the job parallelism")
+
+	// The reason is cleared once there are enough slots.
+	var replicas int32 = 2
+	observed.tmDeployment.Spec.Replicas = &replicas
+	status = updater.deriveClusterStatus(&recorded, &observed)
+	assert.Equal(t, status.Components.Job.State, v1beta1.JobStatePending)
+	assert.Equal(t, status.Components.Job.Reason, "")
+}
+
+func TestDeriveJobStatusRescaling(t *testing.T) {
+	var flinkJobID = "job1"
+	var parallelism int32 = 2
+	var observed = getTestObservedSessionCluster(1)
+	observed.cluster.Spec.Job = &v1beta1.JobSpec{Parallelism: &parallelism}
+	var newSubmitter = func(
+		parallelism string, triggerID string) *batchv1.Job {
+		return &batchv1.Job{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: "mycluster-job",
+				Annotations: map[string]string{
+					rescaleTriggerIDAnnotation: triggerID,
+				},
+			},
+			Spec: batchv1.JobSpec{
+				Template: corev1.PodTemplateSpec{
+					Spec: corev1.PodSpec{
+						Containers: []corev1.Container{
+							{
+								Name: "main",
+								Args: []string{"--parallelism", parallelism},
+							},
+						},
+					},
+				},
+			},
+			Status: batchv1.JobStatus{Active: 1},
+		}
+	}
+	observed.job = newSubmitter("1", "")
+	observed.flinkJobID = &flinkJobID
+	observed.flinkOverview = &flinkclient.ClusterOverview{JobsRunning: 1}
+	var recorded = v1beta1.FlinkClusterStatus{
+		State: v1beta1.ClusterStateRunning,
+		Components: v1beta1.FlinkClusterComponentsStatus{
+			Job: &v1beta1.JobStatus{
+				ID:    flinkJobID,
+				State: v1beta1.JobStateRescaling,
+				Rescale: &v1beta1.JobRescaleStatus{
+					FromParallelism: 1,
+					ToParallelism:   2,
+					Phase:           v1beta1.JobRescalePhaseStopping,
+					TriggerID:       "trigger-1",
+				},
+			},
+		},
+	}
+
+	// The submitter of the stopped job is still observed.
+	var updater = &ClusterStatusUpdater{log: log.Log, observed: observed}
+	var status = updater.deriveClusterStatus(&recorded, &observed)
+	assert.Equal(t, status.Components.Job.State, v1beta1.JobStateRescaling)
+	assert.Equal(t, status.Message, "Job rescaling from parallelism 1 to 2")
+
+	// The rescale is finished once the resubmitted job is running.
+	recorded.Components.Job.Rescale.Phase = v1beta1.JobRescalePhaseResubmitting
+	observed.job = newSubmitter("2", "trigger-1")
+	updater = &ClusterStatusUpdater{log: log.Log, observed: observed}
+	status = updater.deriveClusterStatus(&recorded, &observed)
+	assert.Equal(t, status.Components.Job.State, v1beta1.JobStateRunning)
+	assert.Assert(t, status.Components.Job.Rescale == nil)
+}
+
+func TestDeriveJobStateFromFlinkOverview(t *testing.T) {
+	var flinkJobID = "job1"
+	var observed = getTestObservedSessionCluster(1)
+	observed.cluster.Spec.Job = &v1beta1.JobSpec{}
+	observed.job = &batchv1.Job{
+		ObjectMeta: metav1.ObjectMeta{Name: "mycluster-job"},
+		Spec: batchv1.JobSpec{
+			Template: corev1.PodTemplateSpec{
+				Spec: corev1.PodSpec{
+					Containers: []corev1.Container{{Name: "main"}},
+				},
+			},
+		},
+		Status: batchv1.JobStatus{Active: 1},
+	}
+	observed.flinkJobID = &flinkJobID
+	var recorded = v1beta1.FlinkClusterStatus{
+		State: v1beta1.ClusterStateRunning}
+
+	// No running job in Flink.
+	observed.flinkOverview = &flinkclient.ClusterOverview{JobsRunning: 0}
+	var updater = &ClusterStatusUpdater{log: log.Log, observed: observed}
+	var status = updater.deriveClusterStatus(&recorded, &observed)
+	assert.Equal(t, status.Components.Job.State, v1beta1.JobStatePending)
+
+	// The job is running in Flink.
+	observed.flinkOverview = &flinkclient.ClusterOverview{JobsRunning: 1}
+	updater = &ClusterStatusUpdater{log: log.Log, observed: observed}
+	status = updater.deriveClusterStatus(&recorded, &observed)
+	assert.Equal(t, status.Components.Job.State, v1beta1.JobStateRunning)
+
+	// The JobManager is unreachable, rely on the job ID.
+	observed.flinkOverview = nil
+	updater = &ClusterStatusUpdater{log: log.Log, observed: observed}
+	status = updater.deriveClusterStatus(&recorded, &observed)
+	assert.Equal(t, status.Components.Job.State, v1beta1.JobStateRunning)
+}
+
+func TestIsStatusChangedFlink(t *testing.T) {
+	var updater = &ClusterStatusUpdater{log: log.Log}
+	var oldStatus = v1beta1.FlinkClusterStatus{}
+	var newStatus = v1beta1.FlinkClusterStatus{
+		Flink: &v1beta1.FlinkStatus{JobsRunning: 1}}
+	assert.Assert(t, updater.isStatusChanged(oldStatus, newStatus) == true)
+
+	oldStatus.Flink = &v1beta1.FlinkStatus{JobsRunning: 1}
+	assert.Assert(t, updater.isStatusChanged(oldStatus, newStatus) == false)
+
+	newStatus.Flink.Stale = true
+	assert.Assert(t, updater.isStatusChanged(oldStatus, newStatus) == true)
+}
+
+func TestDeriveEstimatedRolloutSeconds(t *testing.T) {
+	var updater = &ClusterStatusUpdater{log: log.Log}
+	var observed = getTestObservedSessionCluster(1)
+	observed.cluster.Spec.TaskManager.Replicas = 4
+	observed.cluster.Spec.TaskManager.MinReadySeconds = 30
+	var recorded = v1beta1.FlinkClusterStatus{
+		State: v1beta1.ClusterStateRunning}
+
+	var status = updater.deriveClusterStatus(&recorded, &observed)
+	assert.Equal(t, status.EstimatedRolloutSeconds, int32(120))
+	assert.Assert(t, updater.isStatusChanged(recorded, status) == true)
+}
+
+func TestDeriveClusterStatusMissingPullSecret(t *testing.T) {
+	var updater = &ClusterStatusUpdater{log: log.Log}
+	var recorded = v1beta1.FlinkClusterStatus{
+		State: v1beta1.ClusterStateCreating}
+
+	// Private registry without pull secrets, but the image is not known to
+	// fail to be pulled.
+	var observed = getTestObservedSessionCluster(1)
+	observed.cluster.Spec.Image.Name = "gcr.io/my-project/flink:1.9.1"
+	observed.tmDeployment.Status.AvailableReplicas = 0
+	var status = updater.deriveClusterStatus(&recorded, &observed)
+	assert.Equal(t, status.Components.TaskManagerDeployment.Reason, "")
+
+	// The image fails to be pulled.
+	observed.tmPods = []corev1.Pod{{
+		Status: corev1.PodStatus{
+			ContainerStatuses: []corev1.ContainerStatus{{
+				Name: "taskmanager",
+				State: corev1.ContainerState{
+					Waiting: &corev1.ContainerStateWaiting{
+						Reason: "ImagePullBackOff"},
+				},
+			}},
+		},
+	}}
+	status = updater.deriveClusterStatus(&recorded, &observed)
+	assert.Equal(
+		t,
+		status.Components.TaskManagerDeployment.State,
+		v1beta1.ComponentStateNotReady)
+	assert.Equal(
+		t,
+		status.Components.TaskManagerDeployment.Reason,
+		v1beta1.ComponentReasonMissingPullSecret)
+	// The reason is only set on components which are not ready.
+	assert.Equal(t, status.Components.JobManagerDeployment.Reason, "")
+
+	// The referenced pull secret does not exist.
+	observed.cluster.Spec.Image.PullSecrets = []corev1.LocalObjectReference{
+		{Name: "gcr-secret"}}
+	observed.missingPullSecrets = []string{"gcr-secret"}
+	status = updater.deriveClusterStatus(&recorded, &observed)
+	assert.Equal(
+		t,
+		status.Components.TaskManagerDeployment.Reason,
+		v1beta1.ComponentReasonMissingPullSecret)
+
+	// The pull secret exists.
+	observed.missingPullSecrets = nil
+	status = updater.deriveClusterStatus(&recorded, &observed)
+	assert.Equal(t, status.Components.TaskManagerDeployment.Reason, "")
+}
+
+func TestDeriveClusterStatusScale(t *testing.T) {
+	var updater = &ClusterStatusUpdater{log: log.Log}
+	var recorded = v1beta1.FlinkClusterStatus{
+		State: v1beta1.ClusterStateRunning}
+	var observed = getTestObservedSessionCluster(3)
+	observed.tmDeployment.Status.Replicas = 3
+	observed.tmDeployment.Spec.Selector = &metav1.LabelSelector{
+		MatchLabels: map[string]string{
+			"cluster":   "mycluster",
+			"component": "taskmanager",
+		},
+	}
+
+	var status = updater.deriveClusterStatus(&recorded, &observed)
+	assert.Equal(t, status.Components.TaskManagerDeployment.Replicas, int32(3))
+	assert.Equal(t, status.Selector, "cluster=mycluster,component=taskmanager")
+
+	var previous = *status.DeepCopy()
+	previous.Components.TaskManagerDeployment.Replicas = 2
+	assert.Assert(t, updater.isStatusChanged(previous, status))
+	previous = *status.DeepCopy()
+	previous.Selector = ""
+	assert.Assert(t, updater.isStatusChanged(previous, status))
+}
+
+func TestDeriveClusterStatusMissingConfig(t *testing.T) {
+	var updater = &ClusterStatusUpdater{log: log.Log}
+	var recorded = v1beta1.FlinkClusterStatus{
+		State: v1beta1.ClusterStateCreating}
+
+	// The external Flink ConfigMap does not exist.
+	var observed = getTestObservedSessionCluster(1)
+	observed.cluster.Spec.FlinkConfigMap = "my-flink-config"
+	observed.jmDeployment.Status.AvailableReplicas = 0
+	observed.tmDeployment.Status.AvailableReplicas = 0
+	var status = updater.deriveClusterStatus(&recorded, &observed)
+	assert.Equal(
+		t,
+		status.Components.JobManagerDeployment.Reason,
+		v1beta1.ComponentReasonMissingConfig)
+	assert.Equal(
+		t,
+		status.Components.TaskManagerDeployment.Reason,
+		v1beta1.ComponentReasonMissingConfig)
+
+	// The ConfigMap exists.
+	observed.flinkConfigMap = &corev1.ConfigMap{}
+	status = updater.deriveClusterStatus(&recorded, &observed)
+	assert.Equal(t, status.Components.JobManagerDeployment.Reason, "")
+	assert.Equal(t, status.Components.TaskManagerDeployment.Reason, "")
+}
+
+func TestDeriveClusterStatusCrashLoopBackOff(t *testing.T) {
+	var updater = &ClusterStatusUpdater{log: log.Log}
+	var recorded = v1beta1.FlinkClusterStatus{
+		State: v1beta1.ClusterStateRunning}
+
+	// The deployment still has available replicas.
+	var observed = getTestObservedSessionCluster(2)
+	observed.tmPods = []corev1.Pod{
+		{
+			Status: corev1.PodStatus{
+				ContainerStatuses: []corev1.ContainerStatus{
+					{
+						Name: "taskmanager",
+						State: corev1.ContainerState{
+							Running: &corev1.ContainerStateRunning{},
+						},
+					},
+				},
+			},
+		},
+		{
+			Status: corev1.PodStatus{
+				ContainerStatuses: []corev1.ContainerStatus{
+					{
+						Name: "taskmanager",
+						State: corev1.ContainerState{
+							Waiting: &corev1.ContainerStateWaiting{
+								Reason: "CrashLoopBackOff",
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+	var status = updater.deriveClusterStatus(&recorded, &observed)
+	assert.Equal(
+		t,
+		status.Components.TaskManagerDeployment.State,
+		v1beta1.ComponentStateCrashLoopBackOff)
+	assert.Equal(t, status.Components.TaskManagerDeployment.Reason, "")
+	assert.Equal(t, status.State, v1beta1.ClusterStateReconciling)
+
+	// Recovered.
+	observed.tmPods = observed.tmPods[:1]
+	status = updater.deriveClusterStatus(&recorded, &observed)
+	assert.Equal(
+		t,
+		status.Components.TaskManagerDeployment.State,
+		v1beta1.ComponentStateReady)
+	assert.Equal(t, status.State, v1beta1.ClusterStateRunning)
+}
+
+func TestDeriveClusterStatusOOMKilled(t *testing.T) {
+	var updater = &ClusterStatusUpdater{log: log.Log}
+	var recorded = v1beta1.FlinkClusterStatus{
+		State: v1beta1.ClusterStateRunning}
+
+	// The restarted container is running again.
+	var observed = getTestObservedSessionCluster(2)
+	observed.tmPods = []corev1.Pod{
+		{
+			Status: corev1.PodStatus{
+				ContainerStatuses: []corev1.ContainerStatus{
+					{
+						Name: "taskmanager",
+						State: corev1.ContainerState{
+							Running: &corev1.ContainerStateRunning{},
+						},
+						LastTerminationState: corev1.ContainerState{
+							Terminated: &corev1.ContainerStateTerminated{
+								Reason:   "OOMKilled",
+								ExitCode: 137,
+							},
+						},
+						RestartCount: 1,
+					},
+				},
+			},
+		},
+	}
+	var status = updater.deriveClusterStatus(&recorded, &observed)
+	assert.Equal(
+		t,
+		status.Components.TaskManagerDeployment.State,
+		v1beta1.ComponentStateReady)
+	assert.Equal(
+		t,
+		status.Components.TaskManagerDeployment.Reason,
+		v1beta1.ComponentReasonMemoryMismatch)
+
+	// The warning is emitted when the reason is set.
+	var recorder = record.NewFakeRecorder(10)
+	updater.recorder = recorder
+	updater.observed = observed
+	var previous = status
+	previous.Components.TaskManagerDeployment.Reason = ""
+	updater.createStatusChangeEvents(previous, status)
+	assert.Equal(t, len(recorder.Events), 1)
+	assert.Equal(
+		t,
+		<-recorder.Events,
+		"Warning MemoryMismatch TaskManager containers were OOMKilled, "+
+			"check that the memory limit fits the memory configured for Flink")
+}
+
+func TestDeriveReadinessTimeout(t *testing.T) {
+	var tc = &TimeConverter{}
+	// The recorded times are in seconds.
+	var now = time.Now().Truncate(time.Second)
+	var timeout int64 = 300
+	var cluster = getTestSessionCluster()
+	cluster.Generation = 2
+	cluster.Spec.ReadinessTimeoutSeconds = &timeout
+
+	// Entering Reconciling.
+	var recorded = v1beta1.FlinkClusterStatus{State: v1beta1.ClusterStateRunning}
+	var status = v1beta1.FlinkClusterStatus{State: v1beta1.ClusterStateReconciling}
+	deriveReadinessTimeout(&recorded, cluster, &status, now)
+	assert.Equal(t, status.State, v1beta1.ClusterStateReconciling)
+	assert.Equal(t, status.ReconcilingSince, tc.ToString(now))
+	assert.Equal(t, status.ObservedGeneration, int64(2))
+
+	// Still within the timeout.
+	recorded = status
+	status = v1beta1.FlinkClusterStatus{State: v1beta1.ClusterStateReconciling}
+	deriveReadinessTimeout(&recorded, cluster, &status, now.Add(5*time.Minute))
+	assert.Equal(t, status.State, v1beta1.ClusterStateReconciling)
+	assert.Equal(t, status.ReconcilingSince, tc.ToString(now))
+
+	// Timed out.
+	status = v1beta1.FlinkClusterStatus{State: v1beta1.ClusterStateReconciling}
+	deriveReadinessTimeout(&recorded, cluster, &status, now.Add(6*time.Minute))
+	assert.Equal(t, status.State, v1beta1.ClusterStateFailed)
+	assert.Equal(t, status.Reason, v1beta1.ClusterReasonReadinessTimeout)
+	assert.Equal(t, status.ReconcilingSince, "")
+
+	// The failure is kept until the spec is updated.
+	recorded = status
+	assert.Assert(t, !isReadinessTimeoutRetried(&recorded, cluster))
+	status = v1beta1.FlinkClusterStatus{State: v1beta1.ClusterStateFailed}
+	deriveReadinessTimeout(&recorded, cluster, &status, now.Add(7*time.Minute))
+	assert.Equal(t, status.Reason, v1beta1.ClusterReasonReadinessTimeout)
+
+	// Retried after the spec is updated.
+	cluster.Generation = 3
+	assert.Assert(t, isReadinessTimeoutRetried(&recorded, cluster))
+	status = v1beta1.FlinkClusterStatus{State: v1beta1.ClusterStateReconciling}
+	deriveReadinessTimeout(&recorded, cluster, &status, now.Add(8*time.Minute))
+	assert.Equal(t, status.State, v1beta1.ClusterStateReconciling)
+	assert.Equal(t, status.Reason, "")
+	assert.Equal(t, status.ReconcilingSince, tc.ToString(now.Add(8*time.Minute)))
+	assert.Equal(t, status.ObservedGeneration, int64(3))
+}
+
+func TestDeriveCheckpointHealth(t *testing.T) {
+	var jobSpec = &v1beta1.JobSpec{
+		CheckpointHealth: &v1beta1.JobCheckpointHealth{
+			MaxConsecutiveFailures:  2,
+			MaxCheckpointAgeSeconds: 600,
+		},
+	}
+	var lastCheckpoint = time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	var checkpoints = &flinkclient.CheckpointStatistics{
+		Latest: flinkclient.LatestCheckpoints{
+			Completed: &flinkclient.Checkpoint{
+				ID:                 3,
+				Status:             "COMPLETED",
+				LatestAckTimestamp: lastCheckpoint.UnixNano() / int64(time.Millisecond),
+			},
+		},
+		History: []flinkclient.Checkpoint{
+			{ID: 5, Status: "IN_PROGRESS"},
+			{ID: 4, Status: "FAILED"},
+			{ID: 3, Status: "COMPLETED"},
+			{ID: 2, Status: "FAILED"},
+		},
+	}
+	var derive = func(
+		recorded *v1beta1.JobStatus,
+		checkpoints *flinkclient.CheckpointStatistics,
+		now time.Time) v1beta1.JobStatus {
+		var jobStatus = v1beta1.JobStatus{State: v1beta1.JobStateRunning}
+		deriveCheckpointHealth(jobSpec, recorded, checkpoints, &jobStatus, now)
+		return jobStatus
+	}
+
+	// Healthy, the in-progress checkpoint is not counted.
+	var status = derive(nil, checkpoints, lastCheckpoint.Add(time.Minute))
+	assert.Equal(t, status.State, v1beta1.JobStateRunning)
+	assert.Equal(t, status.LastCheckpointTime, "2020-01-02T03:04:05Z")
+	assert.Equal(t, status.FailedCheckpoints, int32(1))
+
+	// Too old.
+	status = derive(nil, checkpoints, lastCheckpoint.Add(11*time.Minute))
+	assert.Equal(t, status.State, v1beta1.JobStateUnhealthy)
+
+	// Too many consecutive failures.
+	checkpoints.History = append(
+		[]flinkclient.Checkpoint{{ID: 6, Status: "FAILED"}},
+		checkpoints.History...)
+	status = derive(nil, checkpoints, lastCheckpoint.Add(time.Minute))
+	assert.Equal(t, status.State, v1beta1.JobStateUnhealthy)
+	assert.Equal(t, status.FailedCheckpoints, int32(2))
+
+	// The recorded health is kept when the checkpoints are unavailable.
+	status = derive(&status, nil, lastCheckpoint.Add(time.Minute))
+	assert.Equal(t, status.State, v1beta1.JobStateUnhealthy)
+
+	// Only recorded without thresholds.
+	jobSpec.CheckpointHealth = nil
+	status = derive(nil, checkpoints, lastCheckpoint.Add(time.Hour))
+	assert.Equal(t, status.State, v1beta1.JobStateRunning)
+	assert.Equal(t, status.FailedCheckpoints, int32(2))
+}
+
+func TestDeriveJobStateSubmitTimeout(t *testing.T) {
+	var observed = getTestObservedSessionCluster(1)
+	observed.cluster.Spec.Job = &v1beta1.JobSpec{
+		CleanupPolicy: &v1beta1.CleanupPolicy{
+			AfterJobFails: v1beta1.CleanupActionKeepCluster,
+		},
+	}
+	observed.job = &batchv1.Job{
+		ObjectMeta: metav1.ObjectMeta{Name: "mycluster-job"},
+		Spec: batchv1.JobSpec{
+			Template: corev1.PodTemplateSpec{
+				Spec: corev1.PodSpec{
+					Containers: []corev1.Container{{Name: "main"}},
+				},
+			},
+		},
+		Status: batchv1.JobStatus{
+			Failed: 1,
+			Conditions: []batchv1.JobCondition{
+				{
+					Type:   batchv1.JobFailed,
+					Status: corev1.ConditionTrue,
+					Reason: "DeadlineExceeded",
+				},
+			},
+		},
+	}
+	var recorded = v1beta1.FlinkClusterStatus{
+		State: v1beta1.ClusterStateRunning}
+
+	var updater = &ClusterStatusUpdater{log: log.Log, observed: observed}
+	var status = updater.deriveClusterStatus(&recorded, &observed)
+	assert.Equal(t, status.Components.Job.State, v1beta1.JobStateSubmitTimeout)
+	assert.Equal(t, status.State, v1beta1.ClusterStateRunning)
+
+	// Other failures of the submitter are failures of the job.
+	observed.job.Status.Conditions[0].Reason = "BackoffLimitExceeded"
+	status = updater.deriveClusterStatus(&recorded, &observed)
+	assert.Equal(t, status.Components.Job.State, v1beta1.JobStateFailed)
+}
+
+func TestDeriveJobStateBackoffLimit(t *testing.T) {
+	var observed = getTestObservedSessionCluster(1)
+	observed.cluster.Spec.Job = &v1beta1.JobSpec{
+		CleanupPolicy: &v1beta1.CleanupPolicy{
+			AfterJobFails: v1beta1.CleanupActionKeepCluster,
+		},
+	}
+	observed.job = &batchv1.Job{
+		ObjectMeta: metav1.ObjectMeta{Name: "mycluster-job"},
+		Spec: batchv1.JobSpec{
+			Template: corev1.PodTemplateSpec{
+				Spec: corev1.PodSpec{
+					Containers: []corev1.Container{{Name: "main"}},
+				},
+			},
+		},
+		Status: batchv1.JobStatus{Active: 1, Failed: 1},
+	}
+	var recorded = v1beta1.FlinkClusterStatus{
+		State: v1beta1.ClusterStateRunning}
+	var updater = &ClusterStatusUpdater{log: log.Log, observed: observed}
+
+	// A pod failed, but the job is retrying within its backoff limit.
+	var status = updater.deriveClusterStatus(&recorded, &observed)
+	assert.Equal(t, status.Components.Job.State, v1beta1.JobStateRetrying)
+	assert.Equal(t, status.Components.Job.FailureReason, "")
+	assert.Equal(t, status.State, v1beta1.ClusterStateRunning)
+
+	// The backoff limit is exceeded.
+	observed.job.Status.Active = 0
+	observed.job.Status.Failed = 2
+	observed.job.Status.Conditions = []batchv1.JobCondition{
+		{
+			Type:    batchv1.JobFailed,
+			Status:  corev1.ConditionTrue,
+			Reason:  "BackoffLimitExceeded",
+			Message: "Job has reached the specified backoff limit",
+		},
+	}
+	status = updater.deriveClusterStatus(&recorded, &observed)
+	assert.Equal(t, status.Components.Job.State, v1beta1.JobStateFailed)
+	assert.Equal(
+		t,
+		status.Components.Job.FailureReason,
+		"Job has reached the specified backoff limit")
+
+	// The failure is reported once by a warning.
+	var recorder = record.NewFakeRecorder(10)
+	updater.recorder = recorder
+	var previous = status
+	previous.Components.Job = &v1beta1.JobStatus{
+		Name: "mycluster-job", State: v1beta1.JobStateRetrying}
+	updater.createStatusChangeEvents(previous, status)
+	assert.Equal(
+		t,
+		<-recorder.Events,
+		"Normal StatusUpdate Job status changed: Retrying -> Failed")
+	assert.Equal(
+		t,
+		<-recorder.Events,
+		"Warning JobFailed Job has reached the specified backoff limit")
+	updater.createStatusChangeEvents(status, status)
+	assert.Equal(t, len(recorder.Events), 0)
+
+	// The job completed.
+	observed.job.Status.Conditions = []batchv1.JobCondition{
+		{Type: batchv1.JobComplete, Status: corev1.ConditionTrue},
+	}
+	status = updater.deriveClusterStatus(&recorded, &observed)
+	assert.Equal(t, status.Components.Job.State, v1beta1.JobStateSucceeded)
+}
+
+func TestDeriveJobStateJarDownloadFailed(t *testing.T) {
+	var observed = getTestObservedSessionCluster(1)
+	observed.cluster.Spec.Job = &v1beta1.JobSpec{
+		JarURI: "gs://my-bucket/jobs/wordcount.jar",
+	}
+	observed.job = &batchv1.Job{
+		ObjectMeta: metav1.ObjectMeta{Name: "mycluster-job"},
+		Spec: batchv1.JobSpec{
+			Template: corev1.PodTemplateSpec{
+				Spec: corev1.PodSpec{
+					Containers: []corev1.Container{{Name: "main"}},
+				},
+			},
+		},
+		Status: batchv1.JobStatus{Active: 1},
+	}
+	observed.jobPods = []corev1.Pod{
+		{
+			Status: corev1.PodStatus{
+				InitContainerStatuses: []corev1.ContainerStatus{
+					{
+						Name: jarDownloaderContainer,
+						State: corev1.ContainerState{
+							Waiting: &corev1.ContainerStateWaiting{},
+						},
+						LastTerminationState: corev1.ContainerState{
+							Terminated: &corev1.ContainerStateTerminated{ExitCode: 1},
+						},
+					},
+				},
+			},
+		},
+	}
+	var recorded = v1beta1.FlinkClusterStatus{
+		State: v1beta1.ClusterStateRunning}
+	var updater = &ClusterStatusUpdater{log: log.Log, observed: observed}
+
+	// The downloader of the submitter pod is restarting.
+	var status = updater.deriveClusterStatus(&recorded, &observed)
+	assert.Equal(t, status.Components.Job.State, v1beta1.JobStatePending)
+	assert.Equal(
+		t,
+		status.Components.Job.Reason,
+		v1beta1.ComponentReasonJarDownloadFailed)
+
+	// The submitter pod failed.
+	observed.job.Status.Active = 0
+	observed.job.Status.Failed = 1
+	status = updater.deriveClusterStatus(&recorded, &observed)
+	assert.Equal(t, status.Components.Job.State, v1beta1.JobStateRetrying)
+	assert.Equal(
+		t,
+		status.Components.Job.Reason,
+		v1beta1.ComponentReasonJarDownloadFailed)
+}
+
+func TestGetStatusMessage(t *testing.T) {
+	var tmReplicas int32 = 3
+	var observed = ObservedClusterState{
+		tmDeployment: &appsv1.Deployment{
+			Spec: appsv1.DeploymentSpec{Replicas: &tmReplicas},
+			Status: appsv1.DeploymentStatus{
+				Replicas: 3, AvailableReplicas: 1},
+		},
+	}
+	var status = v1beta1.FlinkClusterStatus{
+		State: v1beta1.ClusterStateReconciling,
+		Components: v1beta1.FlinkClusterComponentsStatus{
+			JobManagerDeployment: v1beta1.FlinkClusterComponentState{
+				State: v1beta1.ComponentStateReady},
+			JobManagerService: v1beta1.JobManagerServiceStatus{
+				State: v1beta1.ComponentStateReady},
+			TaskManagerDeployment: v1beta1.FlinkClusterComponentState{
+				State: v1beta1.ComponentStateNotReady},
+		},
+	}
+	assert.Equal(
+		t,
+		getStatusMessage(&status, &observed),
+		"Waiting for TaskManager deployment (1/3 ready)")
+
+	status.Components.TaskManagerDeployment.Reason =
+		v1beta1.ComponentReasonMissingPullSecret
+	assert.Equal(
+		t,
+		getStatusMessage(&status, &observed),
+		"Waiting for TaskManager deployment (1/3 ready): MissingPullSecret")
+
+	// The first component which is not ready is reported.
+	status.Components.JobManagerService.State = v1beta1.ComponentStateNotReady
+	assert.Equal(
+		t, getStatusMessage(&status, &observed), "Waiting for JobManager service")
+
+	// Nothing to report for a running cluster.
+	status.State = v1beta1.ClusterStateRunning
+	assert.Equal(t, getStatusMessage(&status, &observed), "")
+
+	// The job failure is reported in any state.
+	status.Components.Job = &v1beta1.JobStatus{
+		State:         v1beta1.JobStateFailed,
+		FailureReason: "OutOfMemoryError",
+	}
+	assert.Equal(
+		t, getStatusMessage(&status, &observed), "Job failed: OutOfMemoryError")
+
+	// So is the TLS misconfiguration of the Flink REST API.
+	status.Components.Job = nil
+	observed.flinkTLSError = "secret flink-tls does not exist"
+	assert.Equal(
+		t,
+		getStatusMessage(&status, &observed),
+		"Flink REST TLS misconfigured: secret flink-tls does not exist")
+
+	observed.flinkTLSError = ""
+	status.State = v1beta1.ClusterStateFailed
+	status.Reason = v1beta1.ClusterReasonReadinessTimeout
+	assert.Equal(
+		t,
+		getStatusMessage(&status, &observed),
+		"Cluster not ready within the readiness timeout")
+}
+
+func TestGetWebUIURL(t *testing.T) {
+	var cluster = &v1beta1.FlinkCluster{}
+	var service = &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: "default",
+			Name:      "mycluster-jobmanager",
+		},
+		Spec: corev1.ServiceSpec{
+			Type:      corev1.ServiceTypeClusterIP,
+			ClusterIP: "10.0.0.1",
+			Ports: []corev1.ServicePort{
+				{Name: "rpc", Port: 6123},
+				{Name: "ui", Port: 8081, NodePort: 30081},
+			},
+		},
+	}
+	var jmPods = []corev1.Pod{
+		{Status: corev1.PodStatus{}},
+		{Status: corev1.PodStatus{HostIP: "192.168.0.1"}},
+	}
+
+	assert.Equal(
+		t,
+		getWebUIURL(cluster, service, jmPods),
+		"http://mycluster-jobmanager.default.svc.cluster.local:8081")
+
+	// The node IP of the JobManager pod for NodePort.
+	service.Spec.Type = corev1.ServiceTypeNodePort
+	assert.Equal(
+		t, getWebUIURL(cluster, service, jmPods), "http://192.168.0.1:30081")
+	assert.Equal(t, getWebUIURL(cluster, service, nil), "")
+
+	// Empty until the LoadBalancer address is assigned.
+	service.Spec.Type = corev1.ServiceTypeLoadBalancer
+	assert.Equal(t, getWebUIURL(cluster, service, jmPods), "")
+	service.Status.LoadBalancer.Ingress = []corev1.LoadBalancerIngress{
+		{Hostname: "flink.example.com"},
+	}
+	cluster.Spec.Security = &v1beta1.SecuritySpec{
+		RESTTLS: &v1beta1.RESTTLSSpec{SecretName: "flink-tls"},
+	}
+	assert.Equal(
+		t,
+		getWebUIURL(cluster, service, jmPods),
+		"https://flink.example.com:8081")
+}
+
+func TestGetStatusMessagePortForward(t *testing.T) {
+	var observed = getTestObservedSessionCluster(1)
+	observed.jmService.Namespace = "default"
+	observed.jmService.Spec.Ports = []corev1.ServicePort{
+		{Name: "ui", Port: 8081},
+	}
+	var status = v1beta1.FlinkClusterStatus{
+		State: v1beta1.ClusterStateRunning,
+		Components: v1beta1.FlinkClusterComponentsStatus{
+			JobManagerService: v1beta1.JobManagerServiceStatus{
+				State: v1beta1.ComponentStateReady,
+				WebUIURL: getWebUIURL(
+					observed.cluster, observed.jmService, nil),
+			},
+		},
+	}
+	assert.Equal(
+		t,
+		getStatusMessage(&status, &observed),
+		"Flink Web UI is only accessible in the cluster, run "+
+			"`kubectl port-forward -n default svc/mycluster-jobmanager 8081` "+
+			"to access it locally")
+
+	// Not for the other service types.
+	observed.jmService.Spec.Type = corev1.ServiceTypeNodePort
+	assert.Equal(t, getStatusMessage(&status, &observed), "")
+}
+
+func TestIsStatusChangedWebUIURL(t *testing.T) {
+	var updater = &ClusterStatusUpdater{log: log.Log}
+	var oldStatus = v1beta1.FlinkClusterStatus{}
+	var newStatus = v1beta1.FlinkClusterStatus{}
+	newStatus.Components.JobManagerService.WebUIURL = "http://10.0.0.1:8081"
+	assert.Assert(t, updater.isStatusChanged(oldStatus, newStatus))
+}
+
+func TestIsStatusChangedMessage(t *testing.T) {
+	var updater = &ClusterStatusUpdater{log: log.Log}
+	var oldStatus = v1beta1.FlinkClusterStatus{
+		State:   v1beta1.ClusterStateReconciling,
+		Message: "Waiting for TaskManager deployment (1/3 ready)",
+	}
+	var newStatus = *oldStatus.DeepCopy()
+	assert.Assert(t, !updater.isStatusChanged(oldStatus, newStatus))
+	newStatus.Message = "Waiting for TaskManager deployment (2/3 ready)"
+	assert.Assert(t, updater.isStatusChanged(oldStatus, newStatus))
+}
+
+func TestGetStatusHistory(t *testing.T) {
+	var tc = &TimeConverter{}
+	var now = tc.FromString("2019-10-23T05:20:00Z")
+
+	// No transition without a state change.
+	var oldStatus = v1beta1.FlinkClusterStatus{State: "Running"}
+	var newStatus = v1beta1.FlinkClusterStatus{State: "Running"}
+	assert.Assert(t, getStatusHistory(&oldStatus, &newStatus, now) == nil)
+
+	// The first state.
+	oldStatus = v1beta1.FlinkClusterStatus{}
+	newStatus = v1beta1.FlinkClusterStatus{State: "Creating"}
+	assert.DeepEqual(
+		t,
+		getStatusHistory(&oldStatus, &newStatus, now),
+		[]v1beta1.StatusTransition{{
+			Time:    "2019-10-23T05:20:00Z",
+			ToState: "Creating",
+		}})
+
+	// The oldest transitions are dropped beyond the limit.
+	for i := 0; i < statusHistoryLimit; i++ {
+		oldStatus.History = append(
+			oldStatus.History,
+			v1beta1.StatusTransition{
+				Time:      "2019-10-23T05:10:36Z",
+				FromState: "Running",
+				ToState:   fmt.Sprintf("State%d", i),
+			})
+	}
+	var recordedHistory = oldStatus.History
+	oldStatus.State = "Running"
+	newStatus = v1beta1.FlinkClusterStatus{
+		State:  "Failed",
+		Reason: v1beta1.ClusterReasonReadinessTimeout,
+	}
+	var history = getStatusHistory(&oldStatus, &newStatus, now)
+	assert.Equal(t, len(history), statusHistoryLimit)
+	assert.Equal(t, history[0].ToState, "State1")
+	assert.DeepEqual(
+		t,
+		history[statusHistoryLimit-1],
+		v1beta1.StatusTransition{
+			Time:      "2019-10-23T05:20:00Z",
+			FromState: "Running",
+			ToState:   "Failed",
+			Reason:    v1beta1.ClusterReasonReadinessTimeout,
+		})
+	assert.Equal(t, recordedHistory[statusHistoryLimit-1].ToState, "State9")
+}
+
+func TestDeriveStreamGraphJobStatus(t *testing.T) {
+	var updater = &ClusterStatusUpdater{log: log.Log}
+	var observed = getTestObservedSessionCluster(2)
+	observed.cluster.Spec.Job = &v1beta1.JobSpec{
+		JarFile:         "/opt/flink/job/wordcount.jar",
+		StreamGraphJSON: `{"nodes":[{"id":1}]}`,
+	}
+	var recorded = v1beta1.FlinkClusterStatus{
+		State: v1beta1.ClusterStateRunning,
+		Components: v1beta1.FlinkClusterComponentsStatus{
+			Job: &v1beta1.JobStatus{ID: "3f1a", State: v1beta1.JobStatePending},
+		},
+	}
+
+	// Another job which is running is not adopted.
+	observed.flinkRunningJobIDs = []string{"0000"}
+	observed.flinkJobList = &flinkclient.JobStatusList{
+		Jobs: []flinkclient.JobStatus{
+			{ID: "0000", Status: "RUNNING"},
+			{ID: "3f1a", Status: "CREATED"},
+		},
+	}
+	var jobStatus = updater.deriveClusterStatus(&recorded, &observed).
+		Components.Job
+	assert.Equal(t, jobStatus.ID, "3f1a")
+	assert.Equal(t, jobStatus.State, v1beta1.JobStatePending)
+
+	// The submitted job is running.
+	observed.flinkJobList.Jobs[1].Status = "RUNNING"
+	jobStatus = updater.deriveClusterStatus(&recorded, &observed).Components.Job
+	assert.Equal(t, jobStatus.ID, "3f1a")
+	assert.Equal(t, jobStatus.State, v1beta1.JobStateRunning)
+}
+
+func TestGetRESTSubmittedJobState(t *testing.T) {
+	var jobStatus = &v1beta1.JobStatus{
+		ID:    "job1",
+		State: v1beta1.JobStatePending,
+	}
+
+	// The job list is not observed.
+	assert.Equal(
+		t, getRESTSubmittedJobState(jobStatus, nil), v1beta1.JobStatePending)
+
+	var jobList = &flinkclient.JobStatusList{
+		Jobs: []flinkclient.JobStatus{
+			{ID: "job0", Status: "FAILED"},
+			{ID: "job1", Status: "CREATED"},
+		},
+	}
+	assert.Equal(
+		t,
+		getRESTSubmittedJobState(jobStatus, jobList),
+		v1beta1.JobStatePending)
+	jobList.Jobs[1].Status = "RUNNING"
+	assert.Equal(
+		t,
+		getRESTSubmittedJobState(jobStatus, jobList),
+		v1beta1.JobStateRunning)
+	jobList.Jobs[1].Status = "FAILED"
+	assert.Equal(
+		t,
+		getRESTSubmittedJobState(jobStatus, jobList),
+		v1beta1.JobStateFailed)
+}
+
+func TestDeriveSessionJobStatus(t *testing.T) {
+	// Neither recorded nor observed.
+	assert.Assert(t, deriveSessionJobStatus(nil, nil) == nil)
+	assert.Assert(
+		t, deriveSessionJobStatus(nil, &flinkclient.JobStatusList{}) == nil)
+
+	// The running job takes precedence.
+	var jobList = &flinkclient.JobStatusList{
+		Jobs: []flinkclient.JobStatus{
+			{ID: "job0", Status: "FINISHED"},
+			{ID: "job1", Status: "RUNNING"},
+		},
+	}
+	var jobStatus = deriveSessionJobStatus(nil, jobList)
+	assert.DeepEqual(
+		t,
+		jobStatus,
+		&v1beta1.JobStatus{ID: "job1", State: v1beta1.JobStateRunning})
+
+	// The recorded job is followed after it stopped, its status is kept.
+	jobStatus.SavepointGeneration = 2
+	jobList.Jobs[1].Status = "CANCELED"
+	assert.DeepEqual(
+		t,
+		deriveSessionJobStatus(jobStatus, jobList),
+		&v1beta1.JobStatus{
+			ID:                  "job1",
+			State:               v1beta1.JobStateCancelled,
+			SavepointGeneration: 2,
+		})
+
+	// The recorded status is kept if the list is not observed.
+	assert.DeepEqual(t, deriveSessionJobStatus(jobStatus, nil), jobStatus)
+
+	// Another job when the recorded one is no longer listed.
+	jobList.Jobs = jobList.Jobs[:1]
+	assert.DeepEqual(
+		t,
+		deriveSessionJobStatus(jobStatus, jobList),
+		&v1beta1.JobStatus{ID: "job0", State: v1beta1.JobStateSucceeded})
+
+	// The recorded running job is followed even if another job started later,
+	// regardless of the order of the list.
+	jobList.Jobs = []flinkclient.JobStatus{
+		{ID: "job3", Status: "RUNNING", StartTime: 3000},
+		{ID: "job1", Status: "RUNNING", StartTime: 1000},
+	}
+	jobStatus = &v1beta1.JobStatus{ID: "job1", State: v1beta1.JobStateRunning}
+	assert.Equal(t, deriveSessionJobStatus(jobStatus, jobList).ID, "job1")
+
+	// Otherwise the running job which started last, then the first by ID.
+	jobStatus.ID = "job0"
+	assert.Equal(t, deriveSessionJobStatus(jobStatus, jobList).ID, "job3")
+	jobList.Jobs = append(
+		jobList.Jobs, flinkclient.JobStatus{
+			ID: "job2", Status: "RUNNING", StartTime: 3000})
+	for i := 0; i < 3; i++ {
+		jobList.Jobs[0], jobList.Jobs[2] = jobList.Jobs[2], jobList.Jobs[0]
+		assert.Equal(t, deriveSessionJobStatus(nil, jobList).ID, "job2")
+	}
+
+	// The stopped job which started last when none is running.
+	jobList.Jobs = []flinkclient.JobStatus{
+		{ID: "job1", Status: "FAILED", StartTime: 1000},
+		{ID: "job2", Status: "FINISHED", StartTime: 2000},
+	}
+	assert.DeepEqual(
+		t,
+		deriveSessionJobStatus(nil, jobList),
+		&v1beta1.JobStatus{ID: "job2", State: v1beta1.JobStateSucceeded})
+}
+
+func TestGetCompletionTime(t *testing.T) {
+	var tc = &TimeConverter{}
+	var now = tc.FromString("2019-10-23T05:20:00Z")
+	var recorded = &v1beta1.FlinkClusterStatus{
+		Components: v1beta1.FlinkClusterComponentsStatus{
+			Job: &v1beta1.JobStatus{State: v1beta1.JobStateRunning},
+		},
+	}
+	var jobStatus = &v1beta1.JobStatus{State: v1beta1.JobStateSucceeded}
+
+	// Set when the job transitions to Succeeded.
+	assert.Equal(
+		t, getCompletionTime(recorded, jobStatus, now), "2019-10-23T05:20:00Z")
+
+	// Kept while the job stays Succeeded.
+	recorded.Components.Job.State = v1beta1.JobStateSucceeded
+	recorded.CompletionTime = "2019-10-23T05:10:00Z"
+	assert.Equal(
+		t, getCompletionTime(recorded, jobStatus, now), "2019-10-23T05:10:00Z")
+
+	// Not set for a job which had succeeded before it was recorded.
+	recorded.CompletionTime = ""
+	assert.Equal(t, getCompletionTime(recorded, jobStatus, now), "")
+
+	// Cleared when the job runs again.
+	recorded.CompletionTime = "2019-10-23T05:10:00Z"
+	jobStatus.State = v1beta1.JobStateRunning
+	assert.Equal(t, getCompletionTime(recorded, jobStatus, now), "")
+}
+
+func TestDeriveClusterStatusEffectiveConfig(t *testing.T) {
+	var updater = &ClusterStatusUpdater{log: log.Log}
+	var recorded = v1beta1.FlinkClusterStatus{
+		State: v1beta1.ClusterStateRunning}
+
+	// The config of the ConfigMap generated by the operator.
+	var observed = getTestObservedSessionCluster(1)
+	observed.configMap.Data = map[string]string{
+		"flink-conf.yaml": "taskmanager.numberOfTaskSlots: 2\n" +
+			"s3.secret-key: mysecret\n",
+	}
+	var status = updater.deriveClusterStatus(&recorded, &observed)
+	assert.DeepEqual(
+		t,
+		status.EffectiveConfig,
+		map[string]string{
+			"taskmanager.numberOfTaskSlots": "2",
+			"s3.secret-key":                 redactedValue,
+		})
+	assert.Assert(t, len(status.EffectiveConfigChecksum) > 0)
+	assert.Assert(t, !updater.isStatusChanged(status, status))
+
+	// The status changes when a redacted value changes.
+	var previous = status
+	observed.configMap.Data["flink-conf.yaml"] =
+		"taskmanager.numberOfTaskSlots: 2\ns3.secret-key: newsecret\n"
+	status = updater.deriveClusterStatus(&previous, &observed)
+	assert.DeepEqual(t, status.EffectiveConfig, previous.EffectiveConfig)
+	assert.Assert(
+		t, status.EffectiveConfigChecksum != previous.EffectiveConfigChecksum)
+	assert.Assert(t, updater.isStatusChanged(previous, status))
+
+	// The recorded config is kept when the ConfigMap is not observed.
+	previous = status
+	observed.configMap = nil
+	status = updater.deriveClusterStatus(&previous, &observed)
+	assert.DeepEqual(t, status.EffectiveConfig, previous.EffectiveConfig)
+	assert.Equal(
+		t, status.EffectiveConfigChecksum, previous.EffectiveConfigChecksum)
+
+	// The config of the external Flink ConfigMap.
+	observed.cluster.Spec.FlinkConfigMap = "my-flink-config"
+	observed.flinkConfigMap = &corev1.ConfigMap{
+		Data: map[string]string{"flink-conf.yaml": "parallelism.default: 4\n"},
+	}
+	status = updater.deriveClusterStatus(&previous, &observed)
+	assert.DeepEqual(
+		t, status.EffectiveConfig, map[string]string{"parallelism.default": "4"})
+}
+
+func TestDeriveClusterStatusNativeMode(t *testing.T) {
+	var updater = &ClusterStatusUpdater{log: log.Log}
+	var restartPolicy = v1beta1.JobRestartPolicyNever
+	var getPod = func(ready corev1.ConditionStatus) corev1.Pod {
+		return corev1.Pod{
+			Status: corev1.PodStatus{
+				Phase: corev1.PodRunning,
+				Conditions: []corev1.PodCondition{
+					{Type: corev1.PodReady, Status: ready},
+				},
+			},
+		}
+	}
+	var observed = ObservedClusterState{
+		cluster: &v1beta1.FlinkCluster{
+			ObjectMeta: metav1.ObjectMeta{Name: "mycluster"},
+			Spec: v1beta1.FlinkClusterSpec{
+				DeploymentMode: v1beta1.DeploymentModeNative,
+				Job: &v1beta1.JobSpec{
+					RestartPolicy: &restartPolicy,
+					CleanupPolicy: &v1beta1.CleanupPolicy{},
+				},
+			},
+		},
+		job: &batchv1.Job{
+			ObjectMeta: metav1.ObjectMeta{Name: "mycluster-job"},
+			Spec: batchv1.JobSpec{
+				Template: corev1.PodTemplateSpec{
+					Spec: corev1.PodSpec{
+						Containers: []corev1.Container{{
+							Args: []string{
+								"bin/flink",
+								"run-application",
+								"--target",
+								"kubernetes-application"},
+						}},
+					},
+				},
+			},
+			Status: batchv1.JobStatus{Active: 1},
+		},
+	}
+	var recorded = v1beta1.FlinkClusterStatus{
+		State: v1beta1.ClusterStateCreating}
+
+	// Submitting, Flink has not created the pods yet.
+	var status = updater.deriveClusterStatus(&recorded, &observed)
+	assert.Equal(t, status.TotalComponents, 2)
+	assert.Equal(t, status.ReadyComponents, 0)
+	assert.Equal(t, status.Components.JobManagerDeployment.Name, "mycluster")
+	assert.Equal(
+		t,
+		status.Components.JobManagerDeployment.State,
+		v1beta1.ComponentStateNotReady)
+	assert.Equal(t, status.Components.Job.State, v1beta1.JobStatePending)
+
+	// The application cluster is deployed and the job is running.
+	recorded = status
+	observed.job.Status = batchv1.JobStatus{
+		Succeeded: 1,
+		Conditions: []batchv1.JobCondition{
+			{Type: batchv1.JobComplete, Status: corev1.ConditionTrue},
+		},
+	}
+	observed.jmPods = []corev1.Pod{getPod(corev1.ConditionTrue)}
+	observed.tmPods = []corev1.Pod{
+		getPod(corev1.ConditionTrue), getPod(corev1.ConditionFalse)}
+	observed.flinkJobList = &flinkclient.JobStatusList{
+		Jobs: []flinkclient.JobStatus{{ID: "1234", Status: "RUNNING"}},
+	}
+	status = updater.deriveClusterStatus(&recorded, &observed)
+	assert.Equal(t, status.ReadyComponents, 1)
+	assert.Equal(
+		t,
+		status.Components.TaskManagerDeployment.State,
+		v1beta1.ComponentStateNotReady)
+	assert.Equal(t, status.Components.TaskManagerDeployment.Replicas, int32(2))
+	assert.Equal(t, status.Components.Job.ID, "1234")
+	assert.Equal(t, status.Components.Job.State, v1beta1.JobStateRunning)
+
+	// The job has finished.
+	recorded = status
+	observed.tmPods = observed.tmPods[:1]
+	observed.flinkJobList.Jobs[0].Status = "FINISHED"
+	status = updater.deriveClusterStatus(&recorded, &observed)
+	assert.Equal(t, status.ReadyComponents, 2)
+	assert.Equal(t, status.Components.Job.State, v1beta1.JobStateSucceeded)
+
+	// The submitter failed to deploy the application cluster.
+	observed.job.Status = batchv1.JobStatus{
+		Failed: 1,
+		Conditions: []batchv1.JobCondition{{
+			Type:    batchv1.JobFailed,
+			Status:  corev1.ConditionTrue,
+			Message: "Job has reached the specified backoff limit",
+		}},
+	}
+	observed.flinkJobList = nil
+	status = updater.deriveClusterStatus(
+		&v1beta1.FlinkClusterStatus{State: v1beta1.ClusterStateCreating},
+		&observed)
+	assert.Equal(t, status.Components.Job.State, v1beta1.JobStateFailed)
+	assert.Equal(
+		t,
+		status.Components.Job.Reason,
+		v1beta1.ComponentReasonSubmissionFailed)
+}
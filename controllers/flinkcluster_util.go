@@ -17,49 +17,73 @@ limitations under the License.
 package controllers
 
 import (
+	"crypto/rand"
+	"encoding/hex"
 	"fmt"
+	"math"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
 
+	"github.com/google/go-cmp/cmp"
 	v1beta1 "github.com/googlecloudplatform/flink-operator/api/v1beta1"
+	"github.com/googlecloudplatform/flink-operator/controllers/flinkclient"
 	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
+)
+
+const (
+	// Default requeue interval of the first reconcile in a transitional
+	// state.
+	requeueInitialInterval = 2 * time.Second
+	// Default upper bound of the requeue interval in a transitional state.
+	requeueMaxInterval = 30 * time.Second
+	// Default requeue interval in a stable state.
+	requeueStableInterval = 60 * time.Second
+
+	// Placeholders of the values of sensitive spec fields in spec diffs.
+	redactedValue        = "<redacted>"
+	redactedChangedValue = "<redacted, changed>"
 )
 
 func getFlinkAPIBaseURL(cluster *v1beta1.FlinkCluster) string {
+	var scheme = "http"
+	if cluster.Spec.Security != nil && cluster.Spec.Security.RESTTLS != nil {
+		scheme = "https"
+	}
 	return fmt.Sprintf(
-		"http://%s.%s.svc.cluster.local:%d",
-		getJobManagerServiceName(cluster.ObjectMeta.Name),
+		"%s://%s.%s.svc.cluster.local:%d",
+		scheme,
+		getFlinkAPIServiceName(cluster),
 		cluster.ObjectMeta.Namespace,
-		*cluster.Spec.JobManager.Ports.UI)
-}
-
-// Gets JobManager ingress name
-func getConfigMapName(clusterName string) string {
-	return clusterName + "-configmap"
-}
-
-// Gets JobManager deployment name
-func getJobManagerDeploymentName(clusterName string) string {
-	return clusterName + "-jobmanager"
-}
-
-// Gets JobManager service name
-func getJobManagerServiceName(clusterName string) string {
-	return clusterName + "-jobmanager"
+		getFlinkAPIPort(cluster))
 }
 
-// Gets JobManager ingress name
-func getJobManagerIngressName(clusterName string) string {
-	return clusterName + "-jobmanager"
-}
-
-// Gets TaskManager name
-func getTaskManagerDeploymentName(clusterName string) string {
-	return clusterName + "-taskmanager"
+// Gets the port of the Flink REST API in the JobManager service. When the UI
+// port is served by a proxy, e.g., the OAuth2 proxy of SSO, the REST API is
+// reached on an internal port which bypasses it.
+func getFlinkAPIPort(cluster *v1beta1.FlinkCluster) int32 {
+	if !isNativeMode(cluster) && isJobManagerUIProxied(cluster) {
+		return jmRESTPort
+	}
+	return *cluster.Spec.JobManager.Ports.UI
 }
 
-// Gets Job name
-func getJobName(clusterName string) string {
-	return clusterName + "-job"
+// Gets the name of the service of the Flink REST API, which is created by
+// Flink itself in native mode.
+func getFlinkAPIServiceName(cluster *v1beta1.FlinkCluster) string {
+	var namer = NewResourceNamer(cluster)
+	if isNativeMode(cluster) {
+		return namer.NativeRESTServiceName()
+	}
+	return namer.JobManagerServiceName()
 }
 
 // TimeConverter converts between time.Time and string.
@@ -87,16 +111,469 @@ func setTimestamp(target *string) {
 	*target = tc.ToString(now)
 }
 
+// isJobRunning returns true if the job is running, including a running job
+// which is unhealthy.
+func isJobRunning(jobStatus *v1beta1.JobStatus) bool {
+	return jobStatus != nil &&
+		(jobStatus.State == v1beta1.JobStateRunning ||
+			jobStatus.State == v1beta1.JobStateUnhealthy)
+}
+
 // shouldRestartJob returns true if the controller should restart the failed
 // job.
 func shouldRestartJob(
-	restartPolicy *v1beta1.JobRestartPolicy,
+	jobSpec *v1beta1.JobSpec,
+	jobStatus *v1beta1.JobStatus) bool {
+	if jobSpec == nil || jobSpec.RestartPolicy == nil ||
+		jobStatus == nil || jobStatus.State != v1beta1.JobStateFailed ||
+		jobStatus.Reason == v1beta1.ComponentReasonSubmissionFailed {
+		return false
+	}
+	switch *jobSpec.RestartPolicy {
+	case v1beta1.JobRestartPolicyFromSavepointOnFailure:
+		if len(jobStatus.SavepointLocation) == 0 {
+			return false
+		}
+	case v1beta1.JobRestartPolicyOnFailure:
+	default:
+		return false
+	}
+	return !isJobRestartLimitReached(jobSpec, jobStatus)
+}
+
+// isJobRestartLimitReached returns true if the failed job has used up all
+// the attempts allowed by the restart backoff.
+func isJobRestartLimitReached(
+	jobSpec *v1beta1.JobSpec,
 	jobStatus *v1beta1.JobStatus) bool {
-	return restartPolicy != nil &&
-		*restartPolicy == v1beta1.JobRestartPolicyFromSavepointOnFailure &&
-		jobStatus != nil &&
+	if jobSpec == nil || jobSpec.RestartPolicy == nil ||
+		*jobSpec.RestartPolicy == v1beta1.JobRestartPolicyNever ||
+		jobSpec.RestartBackoff == nil ||
+		jobSpec.RestartBackoff.MaxAttempts <= 0 {
+		return false
+	}
+	return jobStatus != nil &&
 		jobStatus.State == v1beta1.JobStateFailed &&
-		len(jobStatus.SavepointLocation) > 0
+		jobStatus.RestartCount+1 >= jobSpec.RestartBackoff.MaxAttempts
+}
+
+// getJobRestartDelay returns how long to wait before the next restart of the
+// failed job, growing exponentially with the number of restarts.
+func getJobRestartDelay(
+	backoff *v1beta1.JobRestartBackoff, restartCount int32) time.Duration {
+	if backoff == nil {
+		return 0
+	}
+	var delay = float64(backoff.InitialBackoffSeconds) *
+		math.Pow(float64(backoff.BackoffMultiplier), float64(restartCount))
+	return time.Duration(delay * float64(time.Second))
+}
+
+// getSubmissionRetryDelay returns how long to wait before the next attempt to
+// submit the job, growing exponentially with the number of attempts up to the
+// maximum backoff.
+func getSubmissionRetryDelay(
+	retry *v1beta1.JobSubmissionRetry, attempts int32) time.Duration {
+	var delay = float64(retry.InitialBackoffSeconds) *
+		math.Pow(float64(retry.BackoffMultiplier), float64(attempts-1))
+	if delay > float64(retry.MaxBackoffSeconds) {
+		delay = float64(retry.MaxBackoffSeconds)
+	}
+	return time.Duration(delay * float64(time.Second))
+}
+
+// newFlinkJobID generates a random Flink job ID, 32 hex characters, so that
+// the job submitted through the REST API can be found by its ID even when the
+// response of the submission is lost.
+func newFlinkJobID() (string, error) {
+	var id = make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(id), nil
+}
+
+// Checks whether the Flink job list contains the job with the ID.
+func hasFlinkJob(jobList *flinkclient.JobStatusList, jobID string) bool {
+	if jobList == nil || len(jobID) == 0 {
+		return false
+	}
+	for _, job := range jobList.Jobs {
+		if job.ID == jobID {
+			return true
+		}
+	}
+	return false
+}
+
+// The labels set by the operator, which are not inherited from the namespace,
+// because the selectors of the components depend on them.
+var reservedLabels = map[string]bool{
+	"app":       true,
+	"cluster":   true,
+	"component": true,
+	"pool":      true,
+	"version":   true,
+}
+
+// Gets the labels of the namespace which should be inherited by the
+// resources of the cluster, except the labels set by the operator.
+func getInheritedLabels(
+	cluster *v1beta1.FlinkCluster,
+	namespace *corev1.Namespace) map[string]string {
+	if cluster == nil || namespace == nil {
+		return nil
+	}
+	var labels = map[string]string{}
+	for _, key := range cluster.Spec.InheritNamespaceLabels {
+		if reservedLabels[key] {
+			continue
+		}
+		if value, ok := namespace.Labels[key]; ok {
+			labels[key] = value
+		}
+	}
+	return labels
+}
+
+// Returns a new map with the labels and the additional labels, the additional
+// labels take precedence.
+func mergeLabels(
+	labels map[string]string,
+	additionalLabels map[string]string) map[string]string {
+	var merged = make(map[string]string, len(labels)+len(additionalLabels))
+	for key, value := range labels {
+		merged[key] = value
+	}
+	for key, value := range additionalLabels {
+		merged[key] = value
+	}
+	return merged
+}
+
+// Gets the labels and annotations of an existing resource updated with the
+// desired ones. The labels which were inherited from the namespace but are no
+// longer desired, e.g., after they were removed from the namespace, are
+// removed.
+func getSyncedLabels(
+	observed metav1.Object,
+	desired metav1.Object) (map[string]string, map[string]string) {
+	var labels = mergeLabels(observed.GetLabels(), desired.GetLabels())
+	var annotations = mergeLabels(observed.GetAnnotations(), nil)
+	var inherited = annotations[inheritedLabelsAnnotation]
+	if inherited != "" {
+		for _, key := range strings.Split(inherited, ",") {
+			if _, ok := desired.GetLabels()[key]; !ok {
+				delete(labels, key)
+			}
+		}
+	}
+	var desiredInherited, ok = desired.GetAnnotations()[inheritedLabelsAnnotation]
+	if ok {
+		annotations[inheritedLabelsAnnotation] = desiredInherited
+	} else {
+		delete(annotations, inheritedLabelsAnnotation)
+	}
+	return labels, annotations
+}
+
+// Checks whether the labels of an existing resource are in sync with the
+// desired ones, see getSyncedLabels.
+func isLabelsSynced(observed metav1.Object, desired metav1.Object) bool {
+	var labels, annotations = getSyncedLabels(observed, desired)
+	return isMapEqual(labels, observed.GetLabels()) &&
+		isMapEqual(annotations, observed.GetAnnotations())
+}
+
+// Checks whether the maps have the same entries, nil and empty maps are
+// equal.
+func isMapEqual(a map[string]string, b map[string]string) bool {
+	return len(a) == len(b) && hasLabels(a, b)
+}
+
+// Checks whether the labels contain all the expected labels.
+func hasLabels(labels map[string]string, expected map[string]string) bool {
+	for key, value := range expected {
+		if current, ok := labels[key]; !ok || current != value {
+			return false
+		}
+	}
+	return true
+}
+
+// Gets the registry host of the image, empty for images on Docker Hub, e.g.,
+// "gcr.io" for "gcr.io/my-project/flink:1.9.1" and "" for "flink:1.9.1".
+func getImageRegistry(image string) string {
+	var parts = strings.SplitN(image, "/", 2)
+	if len(parts) < 2 {
+		return ""
+	}
+	var host = parts[0]
+	if !strings.ContainsAny(host, ".:") && host != "localhost" {
+		return ""
+	}
+	switch host {
+	case "docker.io", "index.docker.io", "registry-1.docker.io":
+		return ""
+	}
+	return host
+}
+
+// Gets the reason why the pods fail to pull the image, i.e., a container is
+// waiting due to ErrImagePull or ImagePullBackOff, if it is likely due to
+// missing pull secrets, empty if there is no such problem.
+func getMissingPullSecretReason(
+	observed *ObservedClusterState, pods []corev1.Pod) string {
+	if observed.cluster == nil || !hasImagePullErrorPod(pods) {
+		return ""
+	}
+	var imageSpec = observed.cluster.Spec.Image
+	if len(observed.missingPullSecrets) > 0 ||
+		(len(imageSpec.PullSecrets) == 0 &&
+			len(getImageRegistry(imageSpec.Name)) > 0) {
+		return v1beta1.ComponentReasonMissingPullSecret
+	}
+	return ""
+}
+
+// Gets the reason why the pods of the cluster cannot start due to the missing
+// external Flink ConfigMap, empty if there is no such problem.
+func getMissingConfigReason(observed *ObservedClusterState) string {
+	if observed.cluster == nil ||
+		len(observed.cluster.Spec.FlinkConfigMap) == 0 ||
+		observed.flinkConfigMap != nil {
+		return ""
+	}
+	return v1beta1.ComponentReasonMissingConfig
+}
+
+// Gets the condition of the type, nil if it is absent.
+func getCondition(
+	conditions []v1beta1.FlinkClusterCondition,
+	conditionType string) *v1beta1.FlinkClusterCondition {
+	for i := range conditions {
+		if conditions[i].Type == conditionType {
+			return &conditions[i]
+		}
+	}
+	return nil
+}
+
+// Sets the condition, its last transition time only changes when the status
+// changes. Returns true if the conditions are changed.
+func setCondition(
+	conditions *[]v1beta1.FlinkClusterCondition,
+	condition v1beta1.FlinkClusterCondition,
+	now time.Time) bool {
+	var tc = &TimeConverter{}
+	var current = getCondition(*conditions, condition.Type)
+	if current == nil {
+		condition.LastTransitionTime = tc.ToString(now)
+		*conditions = append(*conditions, condition)
+		return true
+	}
+	if current.Status == condition.Status {
+		condition.LastTransitionTime = current.LastTransitionTime
+	} else {
+		condition.LastTransitionTime = tc.ToString(now)
+	}
+	if *current == condition {
+		return false
+	}
+	*current = condition
+	return true
+}
+
+// Checks whether any container of the pods is waiting in CrashLoopBackOff.
+func hasCrashLoopingPod(pods []corev1.Pod) bool {
+	for _, pod := range pods {
+		for _, containerStatus := range pod.Status.ContainerStatuses {
+			var waiting = containerStatus.State.Waiting
+			if waiting != nil && waiting.Reason == "CrashLoopBackOff" {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Checks whether any container of the pods is waiting because its image
+// cannot be pulled.
+func hasImagePullErrorPod(pods []corev1.Pod) bool {
+	for _, pod := range pods {
+		var statuses = append(
+			append([]corev1.ContainerStatus{}, pod.Status.InitContainerStatuses...),
+			pod.Status.ContainerStatuses...)
+		for _, containerStatus := range statuses {
+			var waiting = containerStatus.State.Waiting
+			if waiting != nil && (waiting.Reason == "ErrImagePull" ||
+				waiting.Reason == "ImagePullBackOff") {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Checks whether any container of the pods is or was last terminated because
+// it ran out of memory.
+func hasOOMKilledPod(pods []corev1.Pod) bool {
+	for _, pod := range pods {
+		for _, containerStatus := range pod.Status.ContainerStatuses {
+			var terminated = containerStatus.State.Terminated
+			var lastTerminated = containerStatus.LastTerminationState.Terminated
+			if (terminated != nil && terminated.Reason == "OOMKilled") ||
+				(lastTerminated != nil && lastTerminated.Reason == "OOMKilled") {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Gets the reason of the pods not being ready from the status of their job
+// JAR downloader init containers, empty if the JAR is downloaded or there is
+// no downloader. A failure of any pod takes precedence.
+func getJarDownloadReason(pods []corev1.Pod) string {
+	var reason = ""
+	for _, pod := range pods {
+		for _, containerStatus := range pod.Status.InitContainerStatuses {
+			if containerStatus.Name != jarDownloaderContainer {
+				continue
+			}
+			var terminated = containerStatus.State.Terminated
+			var lastTerminated = containerStatus.LastTerminationState.Terminated
+			if (terminated != nil && terminated.ExitCode != 0) ||
+				(lastTerminated != nil && lastTerminated.ExitCode != 0) {
+				return v1beta1.ComponentReasonJarDownloadFailed
+			}
+			if terminated == nil {
+				reason = v1beta1.ComponentReasonDownloadingJar
+			}
+		}
+	}
+	return reason
+}
+
+// Gets the reason of the pods which are not ready because of their sidecar
+// containers, empty if all the sidecars are ready or there are none.
+func getSidecarNotReadyReason(
+	pods []corev1.Pod, sidecars []corev1.Container) string {
+	if len(sidecars) == 0 {
+		return ""
+	}
+	var sidecarNames = make(map[string]bool)
+	for _, sidecar := range sidecars {
+		sidecarNames[sidecar.Name] = true
+	}
+	for _, pod := range pods {
+		for _, containerStatus := range pod.Status.ContainerStatuses {
+			if sidecarNames[containerStatus.Name] && !containerStatus.Ready {
+				return v1beta1.ComponentReasonSidecarNotReady
+			}
+		}
+	}
+	return ""
+}
+
+// Checks whether the job of the cluster is submitted as a stream graph.
+func isStreamGraphJob(cluster *v1beta1.FlinkCluster) bool {
+	return cluster != nil &&
+		cluster.Spec.Job != nil &&
+		len(cluster.Spec.Job.StreamGraphJSON) > 0
+}
+
+// Checks whether the job of the cluster is submitted through the REST API of
+// the JobManager with retries, instead of by the job submitter.
+func isRESTSubmittedJob(cluster *v1beta1.FlinkCluster) bool {
+	return cluster != nil &&
+		cluster.Spec.Job != nil &&
+		cluster.Spec.Job.SubmissionRetry != nil
+}
+
+// Checks whether the JobManager and TaskManagers of the cluster are deployed
+// by Flink itself instead of by the operator.
+func isNativeMode(cluster *v1beta1.FlinkCluster) bool {
+	return cluster != nil &&
+		cluster.Spec.DeploymentMode == v1beta1.DeploymentModeNative
+}
+
+// Checks whether the pod is running and ready.
+func isPodReady(pod *corev1.Pod) bool {
+	return getPodRank(pod) == 2
+}
+
+// Gets the labels which Flink sets on the pods of a component of the
+// application cluster in native mode.
+func getNativePodLabels(namer ResourceNamer, component string) map[string]string {
+	return map[string]string{
+		"app":       namer.NativeClusterID(),
+		"component": component,
+		"type":      "flink-native-kubernetes",
+	}
+}
+
+// Checks whether two replicas are equal, nil is considered as 0.
+func isReplicasEqual(replicas1 *int32, replicas2 *int32) bool {
+	var value1, value2 int32
+	if replicas1 != nil {
+		value1 = *replicas1
+	}
+	if replicas2 != nil {
+		value2 = *replicas2
+	}
+	return value1 == value2
+}
+
+// Gets a copy of the cluster with the spec of the source cluster, except for
+// `cloneFrom` which is removed and `namingPrefix`, which is kept so that the
+// resources of the clone don't collide with those of the source. For the same
+// reason, the service account and the checkpoint PVC created by the operator
+// get the default names of the clone. Labels of the source are added unless
+// the cluster already has them; status is not copied.
+func getClonedCluster(
+	cluster *v1beta1.FlinkCluster,
+	source *v1beta1.FlinkCluster) *v1beta1.FlinkCluster {
+	var cloned = cluster.DeepCopy()
+	source.Spec.DeepCopyInto(&cloned.Spec)
+	cloned.Spec.CloneFrom = nil
+	cloned.Spec.NamingPrefix = cluster.Spec.NamingPrefix
+	var serviceAccount = cloned.Spec.ServiceAccount
+	if serviceAccount != nil && serviceAccount.Create {
+		serviceAccount.Name = cluster.Name + "-flink"
+	}
+	var checkpointStorage = cloned.Spec.CheckpointStorage
+	if checkpointStorage != nil && len(checkpointStorage.StorageClass) > 0 {
+		checkpointStorage.PVCName = cluster.Name + "-checkpoints"
+	}
+	for key, value := range source.Labels {
+		if cloned.Labels == nil {
+			cloned.Labels = map[string]string{}
+		}
+		if _, ok := cloned.Labels[key]; !ok {
+			cloned.Labels[key] = value
+		}
+	}
+	return cloned
+}
+
+// Converts the backpressure of a vertex returned by the Flink API to the
+// status of the vertex. The ratio of the vertex is the max ratio of its
+// subtasks in percent.
+func getVertexBackpressure(
+	vertexName string,
+	backpressure flinkclient.VertexBackpressure) v1beta1.VertexBackpressure {
+	var ratio = 0.0
+	for _, subtask := range backpressure.Subtasks {
+		if subtask.Ratio > ratio {
+			ratio = subtask.Ratio
+		}
+	}
+	return v1beta1.VertexBackpressure{
+		VertexName: vertexName,
+		Ratio:      int32(math.Round(ratio * 100)),
+		Level:      strings.ToUpper(backpressure.Level),
+	}
 }
 
 func getFromSavepoint(jobSpec batchv1.JobSpec) string {
@@ -108,3 +585,667 @@ func getFromSavepoint(jobSpec batchv1.JobSpec) string {
 	}
 	return ""
 }
+
+// Gets the parallelism the job submitter submits the job with, 0 if it is not
+// specified.
+func getJobParallelism(jobSpec batchv1.JobSpec) int32 {
+	var jobArgs = jobSpec.Template.Spec.Containers[0].Args
+	for i, arg := range jobArgs {
+		if arg == "--parallelism" && i < len(jobArgs)-1 {
+			var parallelism, err = strconv.ParseInt(jobArgs[i+1], 10, 32)
+			if err == nil {
+				return int32(parallelism)
+			}
+		}
+	}
+	return 0
+}
+
+// All the cluster states, for validating the requeue intervals.
+var clusterStates = []string{
+	v1beta1.ClusterStateCreating,
+	v1beta1.ClusterStateRunning,
+	v1beta1.ClusterStateReconciling,
+	v1beta1.ClusterStateStopping,
+	v1beta1.ClusterStatePartiallyStopped,
+	v1beta1.ClusterStateStopped,
+	v1beta1.ClusterStateFailed,
+	v1beta1.ClusterStateSuspending,
+	v1beta1.ClusterStateSuspended,
+	v1beta1.ClusterStateDegraded,
+}
+
+// RequeuePolicy defines how long to wait before reconciling a cluster again
+// depending on its state. Clusters in stable states are requeued slowly;
+// clusters in transitional states are requeued aggressively at first, then
+// the interval doubles with each consecutive reconcile in the same state up
+// to a limit. The zero value is the default policy.
+type RequeuePolicy struct {
+	// Fixed requeue intervals of cluster states, which override the defaults,
+	// e.g., a longer interval of Running or a shorter one of Reconciling.
+	RequeueAfter map[string]time.Duration
+	// Interval of the first reconcile in a transitional state, 0 means the
+	// default.
+	InitialInterval time.Duration
+	// Upper bound of the interval in a transitional state, 0 means the
+	// default.
+	MaxInterval time.Duration
+}
+
+// For returns the requeue interval of a cluster in the given state after the
+// given number of consecutive reconciles in the state.
+func (policy RequeuePolicy) For(clusterState string, attempts int) time.Duration {
+	if interval, ok := policy.RequeueAfter[clusterState]; ok {
+		return interval
+	}
+	switch clusterState {
+	case v1beta1.ClusterStateRunning, v1beta1.ClusterStateStopped,
+		v1beta1.ClusterStateFailed, v1beta1.ClusterStateSuspended:
+		return requeueStableInterval
+	}
+	var maxInterval = policy.MaxInterval
+	if maxInterval <= 0 {
+		maxInterval = requeueMaxInterval
+	}
+	var interval = policy.InitialInterval
+	if interval <= 0 {
+		interval = requeueInitialInterval
+	}
+	for i := 0; i < attempts && interval < maxInterval; i++ {
+		interval *= 2
+	}
+	if interval > maxInterval {
+		interval = maxInterval
+	}
+	return interval
+}
+
+// ParseRequeueAfter parses the fixed requeue intervals of cluster states from
+// a comma-separated list of state=duration pairs, e.g.,
+// "Running=60s,Reconciling=5s".
+func ParseRequeueAfter(value string) (map[string]time.Duration, error) {
+	var requeueAfter = make(map[string]time.Duration)
+	if len(strings.TrimSpace(value)) == 0 {
+		return requeueAfter, nil
+	}
+	for _, pair := range strings.Split(value, ",") {
+		var parts = strings.SplitN(strings.TrimSpace(pair), "=", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("invalid requeue interval %q", pair)
+		}
+		var state = parts[0]
+		var known = false
+		for _, clusterState := range clusterStates {
+			if state == clusterState {
+				known = true
+				break
+			}
+		}
+		if !known {
+			return nil, fmt.Errorf("unknown cluster state %q", state)
+		}
+		var interval, err = time.ParseDuration(parts[1])
+		if err != nil {
+			return nil, fmt.Errorf(
+				"invalid requeue interval of state %v: %v", state, err)
+		}
+		if interval <= 0 {
+			return nil, fmt.Errorf(
+				"requeue interval of state %v must be > 0", state)
+		}
+		requeueAfter[state] = interval
+	}
+	return requeueAfter, nil
+}
+
+// ParseWatchNamespaces parses a comma-separated list of namespaces, e.g.,
+// "team-a,team-b". Empty and duplicate entries are dropped, an empty list
+// means all namespaces.
+func ParseWatchNamespaces(value string) []string {
+	var namespaces = []string{}
+	var seen = map[string]bool{}
+	for _, namespace := range strings.Split(value, ",") {
+		namespace = strings.TrimSpace(namespace)
+		if len(namespace) == 0 || seen[namespace] {
+			continue
+		}
+		seen[namespace] = true
+		namespaces = append(namespaces, namespace)
+	}
+	return namespaces
+}
+
+// SetCacheNamespaces restricts the cache of the manager to the watched
+// namespaces, so that the operator neither caches nor needs to list the
+// objects of other namespaces. The cache is cluster-wide if the list is empty.
+func SetCacheNamespaces(options *ctrl.Options, namespaces []string) {
+	if len(namespaces) == 1 {
+		options.Namespace = namespaces[0]
+	} else if len(namespaces) > 1 {
+		options.NewCache = cache.MultiNamespacedCacheBuilder(namespaces)
+	}
+}
+
+// Whether the namespace is one of the watched namespaces, all namespaces are
+// watched if the list is empty.
+func isNamespaceWatched(watchNamespaces []string, namespace string) bool {
+	if len(watchNamespaces) == 0 {
+		return true
+	}
+	for _, watchNamespace := range watchNamespaces {
+		if watchNamespace == namespace {
+			return true
+		}
+	}
+	return false
+}
+
+// RequeueBackoff tracks the number of consecutive reconciles of each cluster
+// in the same state, which determines the requeue interval.
+type RequeueBackoff struct {
+	// The requeue intervals of the cluster states.
+	Policy RequeuePolicy
+
+	mutex    sync.Mutex
+	attempts map[types.NamespacedName]requeueAttempts
+}
+
+type requeueAttempts struct {
+	state string
+	count int
+}
+
+// Next records a reconcile of the cluster in the given state and returns the
+// interval after which it should be reconciled again.
+func (backoff *RequeueBackoff) Next(
+	cluster types.NamespacedName, clusterState string) time.Duration {
+	backoff.mutex.Lock()
+	defer backoff.mutex.Unlock()
+	if backoff.attempts == nil {
+		backoff.attempts = make(map[types.NamespacedName]requeueAttempts)
+	}
+	var attempts = backoff.attempts[cluster]
+	if attempts.state != clusterState {
+		attempts = requeueAttempts{state: clusterState}
+	}
+	var interval = backoff.Policy.For(clusterState, attempts.count)
+	attempts.count++
+	backoff.attempts[cluster] = attempts
+	return interval
+}
+
+// Forget clears the record of the cluster, e.g., after it has been deleted.
+func (backoff *RequeueBackoff) Forget(cluster types.NamespacedName) {
+	backoff.mutex.Lock()
+	defer backoff.mutex.Unlock()
+	delete(backoff.attempts, cluster)
+}
+
+// StatusBatcher limits the status writes of each cluster to one per
+// interval. A change within the interval after the last write is skipped,
+// unless it changes the cluster state, which is always written at once. The
+// clusters are keyed by UID, so that a cluster recreated with the same name
+// doesn't inherit the last write of the deleted one.
+type StatusBatcher struct {
+	// The minimum interval between the status writes of a cluster, batching
+	// is disabled if it is not positive.
+	Interval time.Duration
+
+	mutex     sync.Mutex
+	writes    map[types.UID]time.Time
+	lastPrune time.Time
+}
+
+// ShouldSkip returns true and the rest of the interval if the change from the
+// current status to the updated status keeps the cluster state and the last
+// write of the cluster's status was within the interval. The skipped change
+// should be written again when the interval ends.
+func (batcher *StatusBatcher) ShouldSkip(
+	cluster types.UID,
+	current *v1beta1.FlinkClusterStatus,
+	updated *v1beta1.FlinkClusterStatus,
+	now time.Time) (bool, time.Duration) {
+	if batcher.Interval <= 0 || current.State != updated.State {
+		return false, 0
+	}
+	batcher.mutex.Lock()
+	defer batcher.mutex.Unlock()
+	var last, ok = batcher.writes[cluster]
+	if !ok {
+		return false, 0
+	}
+	var remaining = batcher.Interval - now.Sub(last)
+	if remaining <= 0 {
+		return false, 0
+	}
+	return true, remaining
+}
+
+// Record records a write of the cluster's status. The records older than the
+// interval, which no longer skip any change, are pruned once per interval,
+// e.g., those of the deleted clusters.
+func (batcher *StatusBatcher) Record(cluster types.UID, now time.Time) {
+	if batcher.Interval <= 0 {
+		return
+	}
+	batcher.mutex.Lock()
+	defer batcher.mutex.Unlock()
+	if batcher.writes == nil {
+		batcher.writes = make(map[types.UID]time.Time)
+	}
+	if now.Sub(batcher.lastPrune) >= batcher.Interval {
+		for uid, last := range batcher.writes {
+			if now.Sub(last) >= batcher.Interval {
+				delete(batcher.writes, uid)
+			}
+		}
+		batcher.lastPrune = now
+	}
+	batcher.writes[cluster] = now
+}
+
+// Forget clears the record of the cluster, e.g., after it has been deleted.
+func (batcher *StatusBatcher) Forget(cluster types.UID) {
+	batcher.mutex.Lock()
+	defer batcher.mutex.Unlock()
+	delete(batcher.writes, cluster)
+}
+
+// StatusDebouncer coalesces rapid status changes of each cluster. A change
+// is skipped within the window after the last write only if it is a flap of
+// the JobManager or TaskManager between NotReady and Ready, i.e., it changes
+// nothing else than their readiness, replicas and what is derived from them.
+// Other changes, e.g., of the cluster state or the job status, are always
+// written.
+type StatusDebouncer struct {
+	// The window after a status write during which flaps are skipped,
+	// debouncing is disabled if it is not positive.
+	Window time.Duration
+
+	mutex  sync.Mutex
+	writes map[types.NamespacedName]statusWrite
+}
+
+type statusWrite struct {
+	status v1beta1.FlinkClusterStatus
+	time   time.Time
+}
+
+// ShouldSkip returns true and the rest of the window if the change from the
+// current status to the updated status is a flap and the last write of the
+// cluster's status was within the window. The skipped change should be
+// written again when the window ends.
+func (debouncer *StatusDebouncer) ShouldSkip(
+	cluster types.NamespacedName,
+	current *v1beta1.FlinkClusterStatus,
+	updated *v1beta1.FlinkClusterStatus,
+	now time.Time) (bool, time.Duration) {
+	if debouncer.Window <= 0 || !isStatusFlap(current, updated) {
+		return false, 0
+	}
+	debouncer.mutex.Lock()
+	defer debouncer.mutex.Unlock()
+	var last, ok = debouncer.writes[cluster]
+	if !ok {
+		return false, 0
+	}
+	// The recorded status might lag behind the last write in the cache, so
+	// also compare with the status which was written.
+	if !isStatusFlap(&last.status, updated) {
+		return false, 0
+	}
+	var remaining = debouncer.Window - now.Sub(last.time)
+	if remaining <= 0 {
+		return false, 0
+	}
+	return true, remaining
+}
+
+// Record records a write of the cluster's status.
+func (debouncer *StatusDebouncer) Record(
+	cluster types.NamespacedName,
+	status *v1beta1.FlinkClusterStatus,
+	now time.Time) {
+	debouncer.mutex.Lock()
+	defer debouncer.mutex.Unlock()
+	if debouncer.writes == nil {
+		debouncer.writes = make(map[types.NamespacedName]statusWrite)
+	}
+	debouncer.writes[cluster] = statusWrite{status: *status.DeepCopy(), time: now}
+}
+
+// Forget clears the record of the cluster, e.g., after it has been deleted.
+func (debouncer *StatusDebouncer) Forget(cluster types.NamespacedName) {
+	debouncer.mutex.Lock()
+	defer debouncer.mutex.Unlock()
+	delete(debouncer.writes, cluster)
+}
+
+// Checks whether the only change between the statuses is a flap of the
+// JobManager, TaskManager or TaskManager pool deployments between NotReady and
+// Ready, along with the fields derived from their readiness.
+func isStatusFlap(
+	current *v1beta1.FlinkClusterStatus,
+	updated *v1beta1.FlinkClusterStatus) bool {
+	var a = current.DeepCopy()
+	var b = updated.DeepCopy()
+	if !clearComponentFlap(
+		&a.Components.JobManagerDeployment,
+		&b.Components.JobManagerDeployment) {
+		return false
+	}
+	if !clearComponentFlap(
+		&a.Components.TaskManagerDeployment,
+		&b.Components.TaskManagerDeployment) {
+		return false
+	}
+	if len(a.Components.TaskManagerPools) != len(b.Components.TaskManagerPools) {
+		return false
+	}
+	for name, aPool := range a.Components.TaskManagerPools {
+		var bPool, ok = b.Components.TaskManagerPools[name]
+		if !ok || !clearComponentFlap(&aPool, &bPool) {
+			return false
+		}
+		a.Components.TaskManagerPools[name] = aPool
+		b.Components.TaskManagerPools[name] = bPool
+	}
+	for _, status := range []*v1beta1.FlinkClusterStatus{a, b} {
+		status.ReadyComponents = 0
+		status.Message = ""
+		status.AvailableSlots = 0
+		status.Flink = nil
+		status.LastUpdateTime = ""
+	}
+	return reflect.DeepEqual(a, b)
+}
+
+// Clears the fields of the component states which change when it flaps
+// between NotReady and Ready, returns false if either state is another one.
+func clearComponentFlap(a, b *v1beta1.FlinkClusterComponentState) bool {
+	for _, state := range []*v1beta1.FlinkClusterComponentState{a, b} {
+		if state.State != v1beta1.ComponentStateReady &&
+			state.State != v1beta1.ComponentStateNotReady {
+			return false
+		}
+	}
+	for _, state := range []*v1beta1.FlinkClusterComponentState{a, b} {
+		state.State = ""
+		state.Reason = ""
+		state.Replicas = 0
+		state.LastTransitionTime = ""
+	}
+	return true
+}
+
+// MetricsSampler decides in which reconciles of each cluster the JobManager
+// metrics are sampled, so that the Flink REST API is not queried for them in
+// every reconcile.
+type MetricsSampler struct {
+	// The metrics are sampled once every this many reconciles of a cluster,
+	// sampling is disabled if it is not positive.
+	Every int
+
+	mutex  sync.Mutex
+	counts map[types.NamespacedName]int
+}
+
+// ShouldSample counts a reconcile of the cluster and returns true if the
+// metrics should be sampled in it. The first reconcile is always sampled.
+func (sampler *MetricsSampler) ShouldSample(cluster types.NamespacedName) bool {
+	if sampler.Every <= 0 {
+		return false
+	}
+	sampler.mutex.Lock()
+	defer sampler.mutex.Unlock()
+	if sampler.counts == nil {
+		sampler.counts = make(map[types.NamespacedName]int)
+	}
+	var count = sampler.counts[cluster]
+	sampler.counts[cluster] = (count + 1) % sampler.Every
+	return count == 0
+}
+
+// Forget clears the count of the cluster, e.g., after it has been deleted.
+func (sampler *MetricsSampler) Forget(cluster types.NamespacedName) {
+	sampler.mutex.Lock()
+	defer sampler.mutex.Unlock()
+	delete(sampler.counts, cluster)
+}
+
+// MetricsPoller decides when the job metrics of each cluster are polled, so
+// that the Flink REST API is queried for them at most once per interval.
+type MetricsPoller struct {
+	// The minimum time between two polls of a cluster, polling is disabled if
+	// it is not positive.
+	Interval time.Duration
+
+	mutex     sync.Mutex
+	lastPolls map[types.NamespacedName]time.Time
+}
+
+// ShouldPoll returns true if the metrics of the cluster have not been polled
+// within the interval, and records now as the time of the last poll if so.
+func (poller *MetricsPoller) ShouldPoll(
+	cluster types.NamespacedName, now time.Time) bool {
+	if poller.Interval <= 0 {
+		return false
+	}
+	poller.mutex.Lock()
+	defer poller.mutex.Unlock()
+	if poller.lastPolls == nil {
+		poller.lastPolls = make(map[types.NamespacedName]time.Time)
+	}
+	var lastPoll, polled = poller.lastPolls[cluster]
+	if polled && now.Sub(lastPoll) < poller.Interval {
+		return false
+	}
+	poller.lastPolls[cluster] = now
+	return true
+}
+
+// Forget clears the last poll time of the cluster, e.g., after it has been
+// deleted.
+func (poller *MetricsPoller) Forget(cluster types.NamespacedName) {
+	poller.mutex.Lock()
+	defer poller.mutex.Unlock()
+	delete(poller.lastPolls, cluster)
+}
+
+// Gets the sum of the aggregated metric with the ID rounded to an integer,
+// returns 0 if it is missing.
+func getAggregatedMetricSum(
+	metrics []flinkclient.AggregatedMetric, id string) int64 {
+	for _, metric := range metrics {
+		if metric.ID == id {
+			return int64(math.Round(metric.Sum))
+		}
+	}
+	return 0
+}
+
+// Gets the highest backpressure level of the vertices, returns an empty string
+// if there is none.
+func getMaxBackpressureLevel(vertices []v1beta1.VertexBackpressure) string {
+	var rank = map[string]int{
+		v1beta1.BackpressureLevelOK:   1,
+		v1beta1.BackpressureLevelLow:  2,
+		v1beta1.BackpressureLevelHigh: 3,
+	}
+	var level = ""
+	for _, vertex := range vertices {
+		if rank[vertex.Level] > rank[level] {
+			level = vertex.Level
+		}
+	}
+	return level
+}
+
+// Converts the JobManager metrics from the Flink API to a compact snapshot,
+// the garbage collector metrics are summed up over all the collectors. Returns
+// nil if the heap metrics are missing.
+func getJobManagerMetricsSnapshot(
+	metrics []flinkclient.Metric) *v1beta1.JobManagerMetrics {
+	var snapshot = &v1beta1.JobManagerMetrics{}
+	var hasHeapUsed, hasHeapMax bool
+	for _, metric := range metrics {
+		var value, err = strconv.ParseFloat(metric.Value, 64)
+		if err != nil {
+			continue
+		}
+		switch {
+		case metric.ID == "Status.JVM.Memory.Heap.Used":
+			snapshot.HeapUsed = int64(value)
+			hasHeapUsed = true
+		case metric.ID == "Status.JVM.Memory.Heap.Max":
+			snapshot.HeapMax = int64(value)
+			hasHeapMax = true
+		case strings.HasPrefix(metric.ID, "Status.JVM.GarbageCollector.") &&
+			strings.HasSuffix(metric.ID, ".Count"):
+			snapshot.GCCount += int64(value)
+		case strings.HasPrefix(metric.ID, "Status.JVM.GarbageCollector.") &&
+			strings.HasSuffix(metric.ID, ".Time"):
+			snapshot.GCTimeMillis += int64(value)
+		}
+	}
+	if !hasHeapUsed || !hasHeapMax {
+		return nil
+	}
+	return snapshot
+}
+
+// SpecTracker records the last observed spec of each cluster, so that spec
+// changes can be detected across reconciles.
+type SpecTracker struct {
+	mutex sync.Mutex
+	specs map[types.NamespacedName]v1beta1.FlinkClusterSpec
+}
+
+// Update records the spec of the cluster and returns the previously recorded
+// spec, or nil if there is none.
+func (tracker *SpecTracker) Update(
+	cluster types.NamespacedName,
+	spec *v1beta1.FlinkClusterSpec) *v1beta1.FlinkClusterSpec {
+	tracker.mutex.Lock()
+	defer tracker.mutex.Unlock()
+	if tracker.specs == nil {
+		tracker.specs = make(map[types.NamespacedName]v1beta1.FlinkClusterSpec)
+	}
+	var last, ok = tracker.specs[cluster]
+	tracker.specs[cluster] = *spec.DeepCopy()
+	if !ok {
+		return nil
+	}
+	return &last
+}
+
+// Forget clears the record of the cluster, e.g., after it has been deleted.
+func (tracker *SpecTracker) Forget(cluster types.NamespacedName) {
+	tracker.mutex.Lock()
+	defer tracker.mutex.Unlock()
+	delete(tracker.specs, cluster)
+}
+
+// Gets a human readable diff of two cluster specs, empty if they are equal.
+// Values of the fields marked with `+sensitive` are redacted, the diff only
+// tells whether they have changed.
+func specDiff(
+	oldSpec v1beta1.FlinkClusterSpec, newSpec v1beta1.FlinkClusterSpec) string {
+	var redactedOld = oldSpec.DeepCopy()
+	var redactedNew = newSpec.DeepCopy()
+	redactSensitiveFields(redactedOld, redactedNew)
+	// Quantities have unexported fields, compare them as strings.
+	var quantityToString = cmp.Transformer(
+		"Quantity", func(quantity resource.Quantity) string {
+			return quantity.String()
+		})
+	return cmp.Diff(redactedOld, redactedNew, quantityToString)
+}
+
+// Replaces the values of the sensitive fields in both specs with placeholders,
+// which differ only if the values differ.
+func redactSensitiveFields(
+	oldSpec *v1beta1.FlinkClusterSpec, newSpec *v1beta1.FlinkClusterSpec) {
+	redactEnvVars(oldSpec.EnvVars, newSpec.EnvVars)
+	redactEnvVars(oldSpec.JobManager.Env, newSpec.JobManager.Env)
+	redactEnvVars(oldSpec.TaskManager.Env, newSpec.TaskManager.Env)
+
+	var oldProperties = map[string]string{}
+	for key, value := range oldSpec.FlinkProperties {
+		oldProperties[key] = value
+		oldSpec.FlinkProperties[key] = redactedValue
+	}
+	for key, value := range newSpec.FlinkProperties {
+		newSpec.FlinkProperties[key] = getRedactedValue(
+			value, oldProperties, key)
+	}
+}
+
+// Replaces the literal values of the environment variables with placeholders,
+// the references to Secrets and ConfigMaps are kept.
+func redactEnvVars(oldEnvVars []corev1.EnvVar, newEnvVars []corev1.EnvVar) {
+	var oldValues = map[string]string{}
+	for i := range oldEnvVars {
+		var envVar = &oldEnvVars[i]
+		oldValues[envVar.Name] = envVar.Value
+		if len(envVar.Value) > 0 {
+			envVar.Value = redactedValue
+		}
+	}
+	for i := range newEnvVars {
+		var envVar = &newEnvVars[i]
+		if len(envVar.Value) > 0 {
+			envVar.Value = getRedactedValue(envVar.Value, oldValues, envVar.Name)
+		}
+	}
+}
+
+func getRedactedValue(
+	value string, oldValues map[string]string, key string) string {
+	if oldValue, ok := oldValues[key]; ok && oldValue != value {
+		return redactedChangedValue
+	}
+	return redactedValue
+}
+
+// The substrings of the keys of the sensitive Flink properties, the same as
+// Flink uses to hide them in its logs and web UI.
+var sensitiveFlinkConfigKeys = []string{
+	"password", "secret", "fs.azure.account.key", "apikey"}
+
+// Parses the properties of `flink-conf.yaml` the same way as Flink does, i.e.,
+// one "key: value" pair per line, comments start with '#', and lines without
+// a key or a value are ignored.
+func parseFlinkConfig(flinkConf string) map[string]string {
+	var config = map[string]string{}
+	for _, line := range strings.Split(flinkConf, "\n") {
+		if index := strings.Index(line, "#"); index >= 0 {
+			line = line[:index]
+		}
+		var kv = strings.SplitN(line, ": ", 2)
+		if len(kv) != 2 {
+			continue
+		}
+		var key = strings.TrimSpace(kv[0])
+		var value = strings.TrimSpace(kv[1])
+		if len(key) == 0 || len(value) == 0 {
+			continue
+		}
+		config[key] = value
+	}
+	return config
+}
+
+// Replaces the values of the sensitive Flink properties with a placeholder.
+func redactFlinkConfig(config map[string]string) map[string]string {
+	for key := range config {
+		var lowerKey = strings.ToLower(key)
+		for _, sensitiveKey := range sensitiveFlinkConfigKeys {
+			if strings.Contains(lowerKey, sensitiveKey) {
+				config[key] = redactedValue
+				break
+			}
+		}
+	}
+	return config
+}
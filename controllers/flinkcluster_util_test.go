@@ -17,10 +17,16 @@ limitations under the License.
 package controllers
 
 import (
+	"strings"
 	"testing"
+	"time"
 
 	v1beta1 "github.com/googlecloudplatform/flink-operator/api/v1beta1"
 	"gotest.tools/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
 )
 
 func TestTimeConverter(t *testing.T) {
@@ -39,24 +45,679 @@ func TestTimeConverter(t *testing.T) {
 
 func TestShouldRestartJob(t *testing.T) {
 	var restartOnFailure = v1beta1.JobRestartPolicyFromSavepointOnFailure
+	var jobSpec1 = v1beta1.JobSpec{RestartPolicy: &restartOnFailure}
 	var jobStatus1 = v1beta1.JobStatus{
 		State:             v1beta1.JobStateFailed,
 		SavepointLocation: "gs://my-bucket/savepoint-123",
 	}
-	var restart1 = shouldRestartJob(&restartOnFailure, &jobStatus1)
+	var restart1 = shouldRestartJob(&jobSpec1, &jobStatus1)
 	assert.Equal(t, restart1, true)
 
 	var jobStatus2 = v1beta1.JobStatus{
 		State: v1beta1.JobStateFailed,
 	}
-	var restart2 = shouldRestartJob(&restartOnFailure, &jobStatus2)
+	var restart2 = shouldRestartJob(&jobSpec1, &jobStatus2)
 	assert.Equal(t, restart2, false)
 
 	var neverRestart = v1beta1.JobRestartPolicyNever
+	var jobSpec3 = v1beta1.JobSpec{RestartPolicy: &neverRestart}
 	var jobStatus3 = v1beta1.JobStatus{
 		State:             v1beta1.JobStateFailed,
 		SavepointLocation: "gs://my-bucket/savepoint-123",
 	}
-	var restart3 = shouldRestartJob(&neverRestart, &jobStatus3)
+	var restart3 = shouldRestartJob(&jobSpec3, &jobStatus3)
 	assert.Equal(t, restart3, false)
+
+	var alwaysRestart = v1beta1.JobRestartPolicyOnFailure
+	var jobSpec4 = v1beta1.JobSpec{
+		RestartPolicy: &alwaysRestart,
+		RestartBackoff: &v1beta1.JobRestartBackoff{
+			MaxAttempts:           3,
+			InitialBackoffSeconds: 10,
+			BackoffMultiplier:     2,
+		},
+	}
+	var jobStatus4 = v1beta1.JobStatus{
+		State:        v1beta1.JobStateFailed,
+		RestartCount: 1,
+	}
+	var restart4 = shouldRestartJob(&jobSpec4, &jobStatus4)
+	assert.Equal(t, restart4, true)
+	assert.Equal(t, isJobRestartLimitReached(&jobSpec4, &jobStatus4), false)
+
+	var jobStatus5 = v1beta1.JobStatus{
+		State:        v1beta1.JobStateFailed,
+		RestartCount: 2,
+	}
+	var restart5 = shouldRestartJob(&jobSpec4, &jobStatus5)
+	assert.Equal(t, restart5, false)
+	assert.Equal(t, isJobRestartLimitReached(&jobSpec4, &jobStatus5), true)
+}
+
+func TestGetJobRestartDelay(t *testing.T) {
+	var backoff = v1beta1.JobRestartBackoff{
+		InitialBackoffSeconds: 10,
+		BackoffMultiplier:     2,
+	}
+	assert.Equal(t, getJobRestartDelay(nil, 3), time.Duration(0))
+	assert.Equal(t, getJobRestartDelay(&backoff, 0), 10*time.Second)
+	assert.Equal(t, getJobRestartDelay(&backoff, 2), 40*time.Second)
+}
+
+func TestRequeuePolicy(t *testing.T) {
+	var policy = RequeuePolicy{}
+	assert.Equal(
+		t,
+		policy.For(v1beta1.ClusterStateReconciling, 0),
+		2*time.Second)
+	assert.Equal(
+		t,
+		policy.For(v1beta1.ClusterStateReconciling, 2),
+		8*time.Second)
+	assert.Equal(
+		t,
+		policy.For(v1beta1.ClusterStateStopping, 100),
+		30*time.Second)
+	assert.Equal(
+		t,
+		policy.For(v1beta1.ClusterStateRunning, 0),
+		60*time.Second)
+	assert.Equal(
+		t,
+		policy.For(v1beta1.ClusterStateStopped, 5),
+		60*time.Second)
+	assert.Equal(
+		t,
+		policy.For(v1beta1.ClusterStateSuspended, 5),
+		60*time.Second)
+
+	// Fixed intervals override the defaults.
+	policy = RequeuePolicy{
+		RequeueAfter: map[string]time.Duration{
+			v1beta1.ClusterStateRunning:     120 * time.Second,
+			v1beta1.ClusterStateReconciling: 5 * time.Second,
+		},
+		InitialInterval: 1 * time.Second,
+		MaxInterval:     10 * time.Second,
+	}
+	assert.Equal(
+		t,
+		policy.For(v1beta1.ClusterStateRunning, 0),
+		120*time.Second)
+	assert.Equal(
+		t,
+		policy.For(v1beta1.ClusterStateReconciling, 3),
+		5*time.Second)
+	assert.Equal(
+		t,
+		policy.For(v1beta1.ClusterStateCreating, 2),
+		4*time.Second)
+	assert.Equal(
+		t,
+		policy.For(v1beta1.ClusterStateCreating, 10),
+		10*time.Second)
+	assert.Equal(
+		t,
+		policy.For(v1beta1.ClusterStateStopped, 0),
+		60*time.Second)
+}
+
+func TestParseRequeueAfter(t *testing.T) {
+	var requeueAfter, err = ParseRequeueAfter("Running=60s, Reconciling=5s")
+	assert.NilError(t, err)
+	assert.DeepEqual(
+		t,
+		requeueAfter,
+		map[string]time.Duration{
+			v1beta1.ClusterStateRunning:     60 * time.Second,
+			v1beta1.ClusterStateReconciling: 5 * time.Second,
+		})
+
+	requeueAfter, err = ParseRequeueAfter("")
+	assert.NilError(t, err)
+	assert.Equal(t, len(requeueAfter), 0)
+
+	var invalidValues = []struct {
+		value       string
+		expectedErr string
+	}{
+		{"Running", `invalid requeue interval "Running"`},
+		{"Runing=60s", `unknown cluster state "Runing"`},
+		{"Running=0s", "requeue interval of state Running must be > 0"},
+	}
+	for _, invalid := range invalidValues {
+		_, err = ParseRequeueAfter(invalid.value)
+		assert.Assert(t, err != nil, "err is not expected to be nil")
+		assert.Equal(t, err.Error(), invalid.expectedErr)
+	}
+
+	_, err = ParseRequeueAfter("Running=1x")
+	assert.Assert(t, err != nil, "err is not expected to be nil")
+	assert.Assert(t, strings.HasPrefix(
+		err.Error(), "invalid requeue interval of state Running: "))
+}
+
+func TestParseWatchNamespaces(t *testing.T) {
+	assert.DeepEqual(
+		t,
+		ParseWatchNamespaces(" team-a,team-b,,team-a "),
+		[]string{"team-a", "team-b"})
+	assert.DeepEqual(t, ParseWatchNamespaces(""), []string{})
+}
+
+func TestIsNamespaceWatched(t *testing.T) {
+	assert.Assert(t, isNamespaceWatched(nil, "team-a"))
+	assert.Assert(t, isNamespaceWatched([]string{"team-a", "team-b"}, "team-b"))
+	assert.Assert(t, !isNamespaceWatched([]string{"team-a"}, "team-b"))
+}
+
+func TestSetCacheNamespaces(t *testing.T) {
+	var options = ctrl.Options{}
+	SetCacheNamespaces(&options, []string{})
+	assert.Equal(t, options.Namespace, "")
+	assert.Assert(t, options.NewCache == nil)
+
+	options = ctrl.Options{}
+	SetCacheNamespaces(&options, []string{"team-a"})
+	assert.Equal(t, options.Namespace, "team-a")
+	assert.Assert(t, options.NewCache == nil)
+
+	options = ctrl.Options{}
+	SetCacheNamespaces(&options, []string{"team-a", "team-b"})
+	assert.Equal(t, options.Namespace, "")
+	assert.Assert(t, options.NewCache != nil)
+}
+
+func TestRequeueBackoff(t *testing.T) {
+	var backoff = RequeueBackoff{}
+	var cluster = types.NamespacedName{Namespace: "default", Name: "mycluster"}
+
+	assert.Equal(
+		t, backoff.Next(cluster, v1beta1.ClusterStateCreating), 2*time.Second)
+	assert.Equal(
+		t, backoff.Next(cluster, v1beta1.ClusterStateCreating), 4*time.Second)
+	assert.Equal(
+		t, backoff.Next(cluster, v1beta1.ClusterStateCreating), 8*time.Second)
+
+	// State changed, start over.
+	assert.Equal(
+		t, backoff.Next(cluster, v1beta1.ClusterStateRunning), 60*time.Second)
+	assert.Equal(
+		t, backoff.Next(cluster, v1beta1.ClusterStateReconciling), 2*time.Second)
+
+	backoff.Forget(cluster)
+	assert.Equal(
+		t, backoff.Next(cluster, v1beta1.ClusterStateReconciling), 2*time.Second)
+
+	// A fixed interval has no backoff.
+	backoff.Policy = RequeuePolicy{
+		RequeueAfter: map[string]time.Duration{
+			v1beta1.ClusterStateReconciling: 5 * time.Second,
+		},
+	}
+	assert.Equal(
+		t, backoff.Next(cluster, v1beta1.ClusterStateReconciling), 5*time.Second)
+	assert.Equal(
+		t, backoff.Next(cluster, v1beta1.ClusterStateReconciling), 5*time.Second)
+}
+
+func TestGetClonedCluster(t *testing.T) {
+	var replicas int32 = 3
+	var source = v1beta1.FlinkCluster{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "prod",
+			Namespace: "default",
+			Labels:    map[string]string{"env": "prod", "team": "data"},
+		},
+		Spec: v1beta1.FlinkClusterSpec{
+			Image:           v1beta1.ImageSpec{Name: "flink:1.9.1"},
+			TaskManager:     v1beta1.TaskManagerSpec{Replicas: replicas},
+			FlinkProperties: map[string]string{"taskmanager.numberOfTaskSlots": "2"},
+			NamingPrefix:    "prod-flink",
+			ServiceAccount: &v1beta1.ServiceAccountSpec{
+				Create: true,
+				Name:   "prod-flink",
+			},
+			CheckpointStorage: &v1beta1.CheckpointStorageSpec{
+				PVCName:      "prod-checkpoints",
+				StorageClass: "standard",
+			},
+		},
+		Status: v1beta1.FlinkClusterStatus{State: v1beta1.ClusterStateRunning},
+	}
+	var cluster = v1beta1.FlinkCluster{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "staging",
+			Namespace: "default",
+			Labels:    map[string]string{"env": "staging"},
+		},
+		Spec: v1beta1.FlinkClusterSpec{
+			CloneFrom: &v1beta1.ClusterRef{Name: "prod"},
+		},
+	}
+
+	var cloned = getClonedCluster(&cluster, &source)
+	assert.Equal(t, cloned.Name, "staging")
+	assert.Assert(t, cloned.Spec.CloneFrom == nil)
+	assert.Equal(t, cloned.Spec.Image.Name, "flink:1.9.1")
+	assert.Equal(t, cloned.Spec.TaskManager.Replicas, replicas)
+	assert.Equal(t, cloned.Spec.NamingPrefix, "")
+	assert.Equal(t, cloned.Spec.ServiceAccount.Name, "staging-flink")
+	assert.Equal(t, cloned.Spec.CheckpointStorage.PVCName, "staging-checkpoints")
+	assert.DeepEqual(
+		t,
+		cloned.Labels,
+		map[string]string{"env": "staging", "team": "data"})
+	assert.Equal(t, cloned.Status.State, "")
+
+	// The source and the original cluster are not modified.
+	cloned.Spec.FlinkProperties["taskmanager.numberOfTaskSlots"] = "4"
+	assert.Equal(
+		t, source.Spec.FlinkProperties["taskmanager.numberOfTaskSlots"], "2")
+	assert.Equal(t, source.Spec.ServiceAccount.Name, "prod-flink")
+	assert.Assert(t, cluster.Spec.CloneFrom != nil)
+}
+
+func TestStatusDebouncer(t *testing.T) {
+	var debouncer = StatusDebouncer{Window: 10 * time.Second}
+	var cluster = types.NamespacedName{Namespace: "default", Name: "mycluster"}
+	var now = time.Now()
+	var newStatus = func(
+		state string, tmState string) *v1beta1.FlinkClusterStatus {
+		return &v1beta1.FlinkClusterStatus{
+			State: state,
+			Components: v1beta1.FlinkClusterComponentsStatus{
+				JobManagerDeployment: v1beta1.FlinkClusterComponentState{
+					Name:  "mycluster-jobmanager",
+					State: v1beta1.ComponentStateReady,
+				},
+				TaskManagerDeployment: v1beta1.FlinkClusterComponentState{
+					Name:  "mycluster-taskmanager",
+					State: tmState,
+				},
+			},
+		}
+	}
+	var running = newStatus(
+		v1beta1.ClusterStateRunning, v1beta1.ComponentStateReady)
+	var flapping = newStatus(
+		v1beta1.ClusterStateRunning, v1beta1.ComponentStateNotReady)
+	flapping.Components.TaskManagerDeployment.Replicas = 2
+	flapping.ReadyComponents = 2
+	flapping.Message = "Waiting for the TaskManagers to be ready"
+	var reconciling = newStatus(
+		v1beta1.ClusterStateReconciling, v1beta1.ComponentStateNotReady)
+
+	// No write has been recorded.
+	var skip, _ = debouncer.ShouldSkip(cluster, running, flapping, now)
+	assert.Assert(t, !skip)
+
+	// Flap within the window, it is written when the window ends.
+	debouncer.Record(cluster, running, now)
+	var remaining time.Duration
+	skip, remaining = debouncer.ShouldSkip(
+		cluster, running, flapping, now.Add(4*time.Second))
+	assert.Assert(t, skip)
+	assert.Equal(t, remaining, 6*time.Second)
+
+	// Flap after the window.
+	skip, _ = debouncer.ShouldSkip(
+		cluster, running, flapping, now.Add(10*time.Second))
+	assert.Assert(t, !skip)
+
+	// Cluster state change.
+	skip, _ = debouncer.ShouldSkip(
+		cluster, running, reconciling, now.Add(5*time.Second))
+	assert.Assert(t, !skip)
+
+	// Job status change.
+	var jobRunning = running.DeepCopy()
+	jobRunning.Components.Job = &v1beta1.JobStatus{
+		State: v1beta1.JobStateRunning}
+	skip, _ = debouncer.ShouldSkip(
+		cluster, running, jobRunning, now.Add(5*time.Second))
+	assert.Assert(t, !skip)
+
+	// Other changes than flaps, e.g., the TaskManagers are deleted or the
+	// job metrics are updated.
+	var tmDeleted = running.DeepCopy()
+	tmDeleted.Components.TaskManagerDeployment.State =
+		v1beta1.ComponentStateDeleted
+	skip, _ = debouncer.ShouldSkip(
+		cluster, running, tmDeleted, now.Add(5*time.Second))
+	assert.Assert(t, !skip)
+	var metricsUpdated = running.DeepCopy()
+	metricsUpdated.JobMetrics = &v1beta1.JobMetrics{}
+	skip, _ = debouncer.ShouldSkip(
+		cluster, running, metricsUpdated, now.Add(5*time.Second))
+	assert.Assert(t, !skip)
+
+	// The cluster state differs from the last write.
+	debouncer.Record(cluster, reconciling, now)
+	skip, _ = debouncer.ShouldSkip(
+		cluster, running, flapping, now.Add(5*time.Second))
+	assert.Assert(t, !skip)
+
+	// Disabled.
+	debouncer.Window = 0
+	debouncer.Record(cluster, running, now)
+	skip, _ = debouncer.ShouldSkip(cluster, running, flapping, now)
+	assert.Assert(t, !skip)
+
+	debouncer.Forget(cluster)
+}
+
+func TestStatusBatcher(t *testing.T) {
+	var batcher = StatusBatcher{Interval: 10 * time.Second}
+	var cluster = types.UID("7c4f")
+	var recreated = types.UID("9e2b")
+	var now = time.Now()
+	var running = &v1beta1.FlinkClusterStatus{
+		State: v1beta1.ClusterStateRunning,
+	}
+	var metricsUpdated = running.DeepCopy()
+	metricsUpdated.JobMetrics = &v1beta1.JobMetrics{}
+	var checkpointed = running.DeepCopy()
+	checkpointed.Components.Job = &v1beta1.JobStatus{
+		State:              v1beta1.JobStateRunning,
+		LastCheckpointTime: "2020-01-01T00:00:00Z",
+	}
+	var reconciling = &v1beta1.FlinkClusterStatus{
+		State: v1beta1.ClusterStateReconciling,
+	}
+
+	// No write has been recorded.
+	var skip, _ = batcher.ShouldSkip(cluster, running, metricsUpdated, now)
+	assert.Assert(t, !skip)
+
+	// Sub-field changes within the interval are written when it ends.
+	batcher.Record(cluster, now)
+	var remaining time.Duration
+	skip, remaining = batcher.ShouldSkip(
+		cluster, running, metricsUpdated, now.Add(4*time.Second))
+	assert.Assert(t, skip)
+	assert.Equal(t, remaining, 6*time.Second)
+	skip, _ = batcher.ShouldSkip(
+		cluster, running, checkpointed, now.Add(4*time.Second))
+	assert.Assert(t, skip)
+
+	// After the interval.
+	skip, _ = batcher.ShouldSkip(
+		cluster, running, metricsUpdated, now.Add(10*time.Second))
+	assert.Assert(t, !skip)
+
+	// Cluster state change.
+	skip, _ = batcher.ShouldSkip(
+		cluster, running, reconciling, now.Add(4*time.Second))
+	assert.Assert(t, !skip)
+
+	// A cluster recreated with the same name has another UID.
+	skip, _ = batcher.ShouldSkip(
+		recreated, running, metricsUpdated, now.Add(4*time.Second))
+	assert.Assert(t, !skip)
+
+	// The records older than the interval are pruned.
+	batcher.Record(recreated, now.Add(20*time.Second))
+	assert.Equal(t, len(batcher.writes), 1)
+
+	// Forgotten.
+	batcher.Forget(recreated)
+	skip, _ = batcher.ShouldSkip(
+		recreated, running, metricsUpdated, now.Add(21*time.Second))
+	assert.Assert(t, !skip)
+
+	// Disabled.
+	batcher.Interval = 0
+	batcher.Record(cluster, now)
+	skip, _ = batcher.ShouldSkip(cluster, running, metricsUpdated, now)
+	assert.Assert(t, !skip)
+}
+
+func TestGetInheritedLabels(t *testing.T) {
+	var cluster = v1beta1.FlinkCluster{
+		Spec: v1beta1.FlinkClusterSpec{
+			InheritNamespaceLabels: []string{"team", "cost-center", "app"},
+		},
+	}
+	var namespace = corev1.Namespace{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "default",
+			Labels: map[string]string{
+				"team": "data", "env": "prod", "app": "billing"},
+		},
+	}
+
+	assert.DeepEqual(
+		t,
+		getInheritedLabels(&cluster, &namespace),
+		map[string]string{"team": "data"})
+	assert.Assert(t, getInheritedLabels(&cluster, nil) == nil)
+}
+
+func TestSpecDiff(t *testing.T) {
+	var oldSpec = getTestSessionCluster().Spec
+	oldSpec.EnvVars = []corev1.EnvVar{
+		{Name: "API_TOKEN", Value: "secret-1"},
+		{Name: "REGION", Value: "us-west1"},
+	}
+	oldSpec.FlinkProperties = map[string]string{
+		"s3.secret-key":                 "secret-2",
+		"taskmanager.numberOfTaskSlots": "1",
+	}
+	oldSpec.JobManager.Env = []corev1.EnvVar{
+		{Name: "AWS_SECRET_ACCESS_KEY", Value: "secret-4"}}
+	oldSpec.TaskManager.Env = []corev1.EnvVar{
+		{Name: "AWS_SECRET_ACCESS_KEY", Value: "secret-5"}}
+
+	assert.Equal(t, specDiff(oldSpec, *oldSpec.DeepCopy()), "")
+
+	var newSpec = oldSpec.DeepCopy()
+	newSpec.TaskManager.Replicas = 3
+	newSpec.EnvVars[0].Value = "secret-3"
+	newSpec.FlinkProperties["taskmanager.numberOfTaskSlots"] = "2"
+	newSpec.JobManager.Env[0].Value = "secret-6"
+	newSpec.TaskManager.Env[0].Value = "secret-7"
+
+	var diff = specDiff(oldSpec, *newSpec)
+	assert.Assert(t, strings.Contains(diff, "Replicas"), diff)
+	assert.Assert(t, strings.Contains(diff, redactedChangedValue), diff)
+	assert.Assert(t, strings.Contains(diff, "taskmanager.numberOfTaskSlots"), diff)
+	for _, value := range []string{
+		"secret-1", "secret-2", "secret-3", "secret-4", "secret-5", "secret-6",
+		"secret-7"} {
+		assert.Assert(t, !strings.Contains(diff, value), diff)
+	}
+
+	// Sensitive values are not modified in the original specs.
+	assert.Equal(t, newSpec.EnvVars[0].Value, "secret-3")
+	assert.Equal(t, newSpec.TaskManager.Env[0].Value, "secret-7")
+	assert.Equal(t, oldSpec.FlinkProperties["s3.secret-key"], "secret-2")
+}
+
+func TestMetricsSampler(t *testing.T) {
+	var sampler = MetricsSampler{Every: 3}
+	var cluster = types.NamespacedName{Namespace: "default", Name: "mycluster"}
+	var other = types.NamespacedName{Namespace: "default", Name: "other"}
+
+	var samples []bool
+	for i := 0; i < 7; i++ {
+		samples = append(samples, sampler.ShouldSample(cluster))
+	}
+	assert.DeepEqual(
+		t, samples, []bool{true, false, false, true, false, false, true})
+
+	// Each cluster is counted separately.
+	assert.Assert(t, sampler.ShouldSample(other))
+
+	sampler.Forget(cluster)
+	assert.Assert(t, sampler.ShouldSample(cluster))
+
+	var disabled = MetricsSampler{}
+	assert.Assert(t, !disabled.ShouldSample(cluster))
+}
+
+func TestMetricsPoller(t *testing.T) {
+	var poller = MetricsPoller{Interval: time.Minute}
+	var cluster = types.NamespacedName{Namespace: "default", Name: "mycluster"}
+	var other = types.NamespacedName{Namespace: "default", Name: "other"}
+	var now = time.Now()
+
+	assert.Assert(t, poller.ShouldPoll(cluster, now))
+	assert.Assert(t, !poller.ShouldPoll(cluster, now.Add(30*time.Second)))
+	assert.Assert(t, poller.ShouldPoll(cluster, now.Add(time.Minute)))
+
+	// Each cluster is polled separately.
+	assert.Assert(t, poller.ShouldPoll(other, now.Add(30*time.Second)))
+
+	poller.Forget(cluster)
+	assert.Assert(t, poller.ShouldPoll(cluster, now.Add(90*time.Second)))
+
+	var disabled = MetricsPoller{}
+	assert.Assert(t, !disabled.ShouldPoll(cluster, now))
+}
+
+func TestGetMaxBackpressureLevel(t *testing.T) {
+	assert.Equal(t, getMaxBackpressureLevel(nil), "")
+	assert.Equal(
+		t,
+		getMaxBackpressureLevel([]v1beta1.VertexBackpressure{
+			{VertexName: "Source", Level: v1beta1.BackpressureLevelOK},
+			{VertexName: "Map", Level: v1beta1.BackpressureLevelLow},
+			{VertexName: "Sink", Level: v1beta1.BackpressureLevelOK},
+		}),
+		v1beta1.BackpressureLevelLow)
+}
+
+func TestSpecTracker(t *testing.T) {
+	var tracker = SpecTracker{}
+	var cluster = types.NamespacedName{Namespace: "default", Name: "mycluster"}
+	var spec = getTestSessionCluster().Spec
+
+	assert.Assert(t, tracker.Update(cluster, &spec) == nil)
+
+	var newSpec = spec.DeepCopy()
+	newSpec.TaskManager.Replicas = 3
+	var last = tracker.Update(cluster, newSpec)
+	assert.Assert(t, last != nil)
+	assert.Equal(t, last.TaskManager.Replicas, spec.TaskManager.Replicas)
+
+	tracker.Forget(cluster)
+	assert.Assert(t, tracker.Update(cluster, &spec) == nil)
+}
+
+func TestGetImageRegistry(t *testing.T) {
+	assert.Equal(t, getImageRegistry("flink:1.9.1"), "")
+	assert.Equal(t, getImageRegistry("library/flink:1.9.1"), "")
+	assert.Equal(t, getImageRegistry("docker.io/library/flink:1.9.1"), "")
+	assert.Equal(t, getImageRegistry("gcr.io/my-project/flink:1.9.1"), "gcr.io")
+	assert.Equal(
+		t, getImageRegistry("registry.example.com:5000/flink"), "registry.example.com:5000")
+	assert.Equal(t, getImageRegistry("localhost/flink"), "localhost")
+}
+
+func TestGetJarDownloadReason(t *testing.T) {
+	var getPod = func(state corev1.ContainerState) corev1.Pod {
+		return corev1.Pod{
+			Status: corev1.PodStatus{
+				InitContainerStatuses: []corev1.ContainerStatus{
+					{Name: "download-jar", State: state},
+				},
+			},
+		}
+	}
+	var downloading = getPod(corev1.ContainerState{
+		Running: &corev1.ContainerStateRunning{}})
+	var downloaded = getPod(corev1.ContainerState{
+		Terminated: &corev1.ContainerStateTerminated{ExitCode: 0}})
+	var failed = getPod(corev1.ContainerState{
+		Terminated: &corev1.ContainerStateTerminated{ExitCode: 1}})
+	var crashLooping = getPod(corev1.ContainerState{
+		Waiting: &corev1.ContainerStateWaiting{Reason: "CrashLoopBackOff"}})
+	crashLooping.Status.InitContainerStatuses[0].LastTerminationState =
+		corev1.ContainerState{
+			Terminated: &corev1.ContainerStateTerminated{ExitCode: 1}}
+
+	assert.Equal(t, getJarDownloadReason(nil), "")
+	assert.Equal(t, getJarDownloadReason([]corev1.Pod{{}}), "")
+	assert.Equal(t, getJarDownloadReason([]corev1.Pod{downloaded}), "")
+	assert.Equal(
+		t,
+		getJarDownloadReason([]corev1.Pod{downloaded, downloading}),
+		v1beta1.ComponentReasonDownloadingJar)
+	assert.Equal(
+		t,
+		getJarDownloadReason([]corev1.Pod{downloading, failed}),
+		v1beta1.ComponentReasonJarDownloadFailed)
+	assert.Equal(
+		t,
+		getJarDownloadReason([]corev1.Pod{crashLooping}),
+		v1beta1.ComponentReasonJarDownloadFailed)
+}
+
+func TestHasOOMKilledPod(t *testing.T) {
+	var getPod = func(state corev1.ContainerState) corev1.Pod {
+		return corev1.Pod{
+			Status: corev1.PodStatus{
+				ContainerStatuses: []corev1.ContainerStatus{
+					{Name: "taskmanager", LastTerminationState: state},
+				},
+			},
+		}
+	}
+	var oomKilled = getPod(corev1.ContainerState{
+		Terminated: &corev1.ContainerStateTerminated{
+			Reason: "OOMKilled", ExitCode: 137}})
+	var failed = getPod(corev1.ContainerState{
+		Terminated: &corev1.ContainerStateTerminated{
+			Reason: "Error", ExitCode: 1}})
+
+	assert.Assert(t, !hasOOMKilledPod(nil))
+	assert.Assert(t, !hasOOMKilledPod([]corev1.Pod{{}, failed}))
+	assert.Assert(t, hasOOMKilledPod([]corev1.Pod{failed, oomKilled}))
+}
+
+func TestGetSidecarNotReadyReason(t *testing.T) {
+	var getPod = func(sidecarReady bool) corev1.Pod {
+		return corev1.Pod{
+			Status: corev1.PodStatus{
+				ContainerStatuses: []corev1.ContainerStatus{
+					{Name: "taskmanager", Ready: true},
+					{Name: "fluent-bit", Ready: sidecarReady},
+				},
+			},
+		}
+	}
+	var sidecars = []corev1.Container{{Name: "fluent-bit"}}
+
+	assert.Equal(t, getSidecarNotReadyReason(nil, sidecars), "")
+	assert.Equal(
+		t, getSidecarNotReadyReason([]corev1.Pod{getPod(true)}, sidecars), "")
+	assert.Equal(
+		t,
+		getSidecarNotReadyReason(
+			[]corev1.Pod{getPod(true), getPod(false)}, sidecars),
+		v1beta1.ComponentReasonSidecarNotReady)
+	// Only the sidecars are checked.
+	assert.Equal(
+		t, getSidecarNotReadyReason([]corev1.Pod{getPod(false)}, nil), "")
+}
+
+func TestParseFlinkConfig(t *testing.T) {
+	var flinkConf = "jobmanager.rpc.port: 6123\n" +
+		"# A comment\n" +
+		"  taskmanager.numberOfTaskSlots: 2  # Trailing comment\n" +
+		"empty.value: \n" +
+		"invalid line\n" +
+		"s3.secret-key: mysecret\n" +
+		"fs.azure.account.key.myaccount.blob.core.windows.net: mykey\n"
+	var config = redactFlinkConfig(parseFlinkConfig(flinkConf))
+	assert.DeepEqual(
+		t,
+		config,
+		map[string]string{
+			"jobmanager.rpc.port":                                  "6123",
+			"taskmanager.numberOfTaskSlots":                        "2",
+			"s3.secret-key":                                        redactedValue,
+			"fs.azure.account.key.myaccount.blob.core.windows.net": redactedValue,
+		})
 }
@@ -0,0 +1,208 @@
+/*
+Copyright 2019 Google LLC.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"sort"
+
+	"github.com/go-logr/logr"
+	v1beta1 "github.com/googlecloudplatform/flink-operator/api/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	// The name of the ConfigMap holding the summary of the FlinkClusters in
+	// a namespace.
+	clusterSummaryConfigMapName = "flink-cluster-summary"
+	// The key of the JSON summary in the ConfigMap.
+	clusterSummaryKey = "summary.json"
+)
+
+// FlinkClusterSummaryReconciler maintains a ConfigMap in each namespace which
+// summarizes the status of all the FlinkClusters in the namespace, so that
+// platform operators can get a single view of them.
+type FlinkClusterSummaryReconciler struct {
+	Client client.Client
+	Log    logr.Logger
+	// The namespaces to summarize, empty means all namespaces.
+	WatchNamespaces []string
+	// Preview the changes of the summaries without applying them.
+	DryRun bool
+}
+
+// ClusterSummary is the summary of a FlinkCluster.
+type ClusterSummary struct {
+	// The name of the cluster.
+	Name string `json:"name"`
+
+	// The state of the cluster.
+	State string `json:"state"`
+
+	// The states of the components of the cluster, keyed by component.
+	Components map[string]string `json:"components"`
+
+	// The summary of the job, only for job clusters.
+	Job *JobSummary `json:"job,omitempty"`
+}
+
+// JobSummary is the summary of the job of a FlinkCluster.
+type JobSummary struct {
+	// The name of the Kubernetes job resource.
+	Name string `json:"name"`
+
+	// The ID of the Flink job.
+	ID string `json:"id,omitempty"`
+
+	// The state of the job.
+	State string `json:"state"`
+}
+
+// Reconcile refreshes the summary ConfigMap of the namespace of the
+// FlinkCluster in the request.
+func (reconciler *FlinkClusterSummaryReconciler) Reconcile(
+	request ctrl.Request) (ctrl.Result, error) {
+	var context = context.Background()
+	var namespace = request.Namespace
+	var log = reconciler.Log.WithValues("namespace", namespace)
+
+	if !isNamespaceWatched(reconciler.WatchNamespaces, namespace) {
+		return ctrl.Result{}, nil
+	}
+
+	var k8sClient = reconciler.Client
+	if reconciler.DryRun {
+		k8sClient = &dryRunClient{Client: k8sClient, plan: &dryRunPlan{log: log}}
+	}
+
+	var clusters = &v1beta1.FlinkClusterList{}
+	var err = k8sClient.List(
+		context, clusters, client.InNamespace(namespace))
+	if err != nil {
+		log.Error(err, "Failed to list clusters")
+		return ctrl.Result{}, err
+	}
+
+	summary, err := getClusterSummary(clusters.Items)
+	if err != nil {
+		log.Error(err, "Failed to get cluster summary")
+		return ctrl.Result{}, err
+	}
+
+	var observedConfigMap = new(corev1.ConfigMap)
+	err = k8sClient.Get(
+		context,
+		types.NamespacedName{
+			Namespace: namespace,
+			Name:      clusterSummaryConfigMapName,
+		},
+		observedConfigMap)
+	if client.IgnoreNotFound(err) != nil {
+		log.Error(err, "Failed to get cluster summary configMap")
+		return ctrl.Result{}, err
+	}
+
+	if err != nil {
+		var configMap = &corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace: namespace,
+				Name:      clusterSummaryConfigMapName,
+				Labels:    map[string]string{"app": "flink"},
+			},
+			Data: map[string]string{clusterSummaryKey: summary},
+		}
+		log.Info("Creating cluster summary configMap")
+		err = k8sClient.Create(context, configMap)
+		if err != nil {
+			log.Error(err, "Failed to create cluster summary configMap")
+		}
+		return ctrl.Result{}, err
+	}
+
+	if observedConfigMap.Data[clusterSummaryKey] == summary {
+		log.Info("Cluster summary not changed, no action")
+		return ctrl.Result{}, nil
+	}
+
+	if observedConfigMap.Data == nil {
+		observedConfigMap.Data = map[string]string{}
+	}
+	observedConfigMap.Data[clusterSummaryKey] = summary
+	log.Info("Updating cluster summary configMap")
+	err = k8sClient.Update(context, observedConfigMap)
+	if err != nil {
+		log.Error(err, "Failed to update cluster summary configMap")
+	}
+	return ctrl.Result{}, err
+}
+
+// SetupWithManager registers this reconciler with the controller manager and
+// starts watching FlinkCluster resources.
+func (reconciler *FlinkClusterSummaryReconciler) SetupWithManager(
+	mgr ctrl.Manager) error {
+	return ctrl.NewControllerManagedBy(mgr).
+		Named("flinkclustersummary").
+		For(&v1beta1.FlinkCluster{}).
+		Complete(reconciler)
+}
+
+// Gets the JSON summary of the clusters, sorted by cluster name.
+func getClusterSummary(clusters []v1beta1.FlinkCluster) (string, error) {
+	var summaries = []ClusterSummary{}
+	for _, cluster := range clusters {
+		var components = cluster.Status.Components
+		var summary = ClusterSummary{
+			Name:  cluster.ObjectMeta.Name,
+			State: cluster.Status.State,
+			Components: map[string]string{
+				"configMap":             components.ConfigMap.State,
+				"jobManagerDeployment":  components.JobManagerDeployment.State,
+				"jobManagerService":     components.JobManagerService.State,
+				"taskManagerDeployment": components.TaskManagerDeployment.State,
+			},
+		}
+		if components.JobManagerIngress != nil {
+			summary.Components["jobManagerIngress"] =
+				components.JobManagerIngress.State
+		}
+		for name, pool := range components.TaskManagerPools {
+			summary.Components["taskManagerPool/"+name] = pool.State
+		}
+		if components.Job != nil {
+			summary.Job = &JobSummary{
+				Name:  components.Job.Name,
+				ID:    components.Job.ID,
+				State: components.Job.State,
+			}
+		}
+		summaries = append(summaries, summary)
+	}
+	sort.Slice(summaries, func(i, j int) bool {
+		return summaries[i].Name < summaries[j].Name
+	})
+
+	var data, err = json.Marshal(summaries)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
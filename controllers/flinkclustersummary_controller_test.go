@@ -0,0 +1,90 @@
+/*
+Copyright 2019 Google LLC.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"testing"
+
+	v1beta1 "github.com/googlecloudplatform/flink-operator/api/v1beta1"
+	"gotest.tools/assert"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestGetClusterSummary(t *testing.T) {
+	var clusters = []v1beta1.FlinkCluster{
+		{
+			ObjectMeta: metav1.ObjectMeta{Name: "session-cluster"},
+			Status: v1beta1.FlinkClusterStatus{
+				State: "Running",
+				Components: v1beta1.FlinkClusterComponentsStatus{
+					ConfigMap: v1beta1.FlinkClusterComponentState{
+						State: "Ready",
+					},
+					JobManagerDeployment: v1beta1.FlinkClusterComponentState{
+						State: "Ready",
+					},
+					JobManagerService: v1beta1.JobManagerServiceStatus{
+						State: "Ready",
+					},
+					TaskManagerDeployment: v1beta1.FlinkClusterComponentState{
+						State: "Ready",
+					},
+				},
+			},
+		},
+		{
+			ObjectMeta: metav1.ObjectMeta{Name: "job-cluster"},
+			Status: v1beta1.FlinkClusterStatus{
+				State: "Creating",
+				Components: v1beta1.FlinkClusterComponentsStatus{
+					ConfigMap: v1beta1.FlinkClusterComponentState{
+						State: "Ready",
+					},
+					JobManagerDeployment: v1beta1.FlinkClusterComponentState{
+						State: "NotReady",
+					},
+					JobManagerService: v1beta1.JobManagerServiceStatus{
+						State: "Ready",
+					},
+					TaskManagerDeployment: v1beta1.FlinkClusterComponentState{
+						State: "NotReady",
+					},
+					Job: &v1beta1.JobStatus{
+						Name:  "job-cluster-job",
+						State: "Pending",
+					},
+				},
+			},
+		},
+	}
+
+	var summary, err = getClusterSummary(clusters)
+	assert.NilError(t, err)
+	var expectedSummary = `[` +
+		`{"name":"job-cluster","state":"Creating","components":{` +
+		`"configMap":"Ready","jobManagerDeployment":"NotReady",` +
+		`"jobManagerService":"Ready","taskManagerDeployment":"NotReady"},` +
+		`"job":{"name":"job-cluster-job","state":"Pending"}},` +
+		`{"name":"session-cluster","state":"Running","components":{` +
+		`"configMap":"Ready","jobManagerDeployment":"Ready",` +
+		`"jobManagerService":"Ready","taskManagerDeployment":"Ready"}}]`
+	assert.Equal(t, summary, expectedSummary)
+
+	summary, err = getClusterSummary(nil)
+	assert.NilError(t, err)
+	assert.Equal(t, summary, "[]")
+}
@@ -0,0 +1,66 @@
+/*
+Copyright 2019 Google LLC.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"net/http"
+	"sync/atomic"
+)
+
+// LeaderTracker tracks whether this operator replica is the leader. It is
+// added to the controller manager as a runnable, which is only started after
+// the replica has acquired the leader lease (or right away when leader election
+// is disabled).
+type LeaderTracker struct {
+	leader int32
+}
+
+// Start marks the replica as the leader until the manager is stopped.
+func (tracker *LeaderTracker) Start(stop <-chan struct{}) error {
+	atomic.StoreInt32(&tracker.leader, 1)
+	<-stop
+	atomic.StoreInt32(&tracker.leader, 0)
+	return nil
+}
+
+// IsLeader returns whether this replica is the leader.
+func (tracker *LeaderTracker) IsLeader() bool {
+	return atomic.LoadInt32(&tracker.leader) == 1
+}
+
+// NewHealthProbeHandler returns the handler of the `/healthz` liveness
+// endpoint and the `/readyz` readiness endpoint, which both succeed while the
+// process is serving. Readiness doesn't depend on leadership, otherwise a new
+// replica would never become ready while the old one holds the lease, and a
+// rolling update would be stuck. The readiness response tells whether the
+// replica is the leader or a standby.
+func NewHealthProbeHandler(tracker *LeaderTracker) http.Handler {
+	var mux = http.NewServeMux()
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte("ok"))
+	})
+	mux.HandleFunc("/readyz", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		if !tracker.IsLeader() {
+			w.Write([]byte("ok, standby"))
+			return
+		}
+		w.Write([]byte("ok, leader"))
+	})
+	return mux
+}
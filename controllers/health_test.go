@@ -0,0 +1,65 @@
+/*
+Copyright 2019 Google LLC.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"gotest.tools/assert"
+)
+
+func getProbeResponse(handler http.Handler, path string) (int, string) {
+	var recorder = httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest("GET", path, nil))
+	return recorder.Code, recorder.Body.String()
+}
+
+func TestHealthProbeHandler(t *testing.T) {
+	var tracker = &LeaderTracker{}
+	var handler = NewHealthProbeHandler(tracker)
+	var code, body = getProbeResponse(handler, "/healthz")
+	assert.Equal(t, code, http.StatusOK)
+
+	// Not the leader, still ready.
+	code, body = getProbeResponse(handler, "/readyz")
+	assert.Equal(t, code, http.StatusOK)
+	assert.Equal(t, body, "ok, standby")
+
+	// Leader.
+	var stop = make(chan struct{})
+	var stopped = make(chan struct{})
+	go func() {
+		tracker.Start(stop)
+		close(stopped)
+	}()
+	for !tracker.IsLeader() {
+		time.Sleep(time.Millisecond)
+	}
+	code, body = getProbeResponse(handler, "/readyz")
+	assert.Equal(t, code, http.StatusOK)
+	assert.Equal(t, body, "ok, leader")
+
+	// Stopped.
+	close(stop)
+	<-stopped
+	code, body = getProbeResponse(handler, "/readyz")
+	assert.Equal(t, code, http.StatusOK)
+	assert.Equal(t, body, "ok, standby")
+}
@@ -0,0 +1,46 @@
+/*
+Copyright 2019 Google LLC.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+// Field index of the child resources of the clusters in the cache of the
+// manager. Listing by labels makes the cache copy and filter every object of
+// the namespace, which adds up with many clusters in a namespace, while the
+// index only returns the children of the cluster.
+
+import (
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+// OwnerUIDIndexField is the field of the index of the child resources by the
+// UIDs of their owners. It is only supported by the cache, not by the API
+// server.
+const OwnerUIDIndexField = ".metadata.ownerReferences.uid"
+
+// GetOwnerUIDs returns the UIDs of the owners of the object, which are the
+// values of OwnerUIDIndexField.
+func GetOwnerUIDs(obj runtime.Object) []string {
+	var accessor, err = meta.Accessor(obj)
+	if err != nil {
+		return nil
+	}
+	var uids []string
+	for _, owner := range accessor.GetOwnerReferences() {
+		uids = append(uids, string(owner.UID))
+	}
+	return uids
+}
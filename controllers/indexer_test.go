@@ -0,0 +1,119 @@
+/*
+Copyright 2019 Google LLC.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"gotest.tools/assert"
+	appsv1 "k8s.io/api/apps/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/cache"
+)
+
+func TestGetOwnerUIDs(t *testing.T) {
+	var cluster = getTestSessionCluster()
+	cluster.UID = "cluster-uid"
+	var deployment = getDesiredClusterState(cluster, time.Now()).TmDeployment
+	assert.DeepEqual(t, GetOwnerUIDs(deployment), []string{"cluster-uid"})
+
+	// Not owned.
+	assert.Assert(t, GetOwnerUIDs(&appsv1.Deployment{}) == nil)
+}
+
+// Looks up the TaskManager pool deployments of 100 clusters in a namespace
+// from an indexer like the one of the cache, by labels and by the owner
+// index. Like the cache, the lookup by labels copies all the deployments of
+// the namespace before filtering them, e.g.,
+// `go test ./controllers -run x -bench ListTaskManagerPools`.
+func BenchmarkListTaskManagerPools(b *testing.B) {
+	const clusters = 100
+	var indexer = cache.NewIndexer(
+		cache.MetaNamespaceKeyFunc,
+		cache.Indexers{
+			cache.NamespaceIndex: cache.MetaNamespaceIndexFunc,
+			OwnerUIDIndexField: func(obj interface{}) ([]string, error) {
+				return GetOwnerUIDs(obj.(runtime.Object)), nil
+			},
+		})
+	var getLabels = func(cluster int, component string) map[string]string {
+		return map[string]string{
+			"cluster":   fmt.Sprintf("cluster-%d", cluster),
+			"app":       "flink",
+			"component": component,
+		}
+	}
+	for i := 0; i < clusters; i++ {
+		for _, name := range []string{"jobmanager", "taskmanager", "pool-a", "pool-b"} {
+			var component = "taskmanager"
+			if name == "jobmanager" {
+				component = "jobmanager"
+			}
+			var deployment = &appsv1.Deployment{
+				ObjectMeta: metav1.ObjectMeta{
+					Namespace: "default",
+					Name:      fmt.Sprintf("cluster-%d-%v", i, name),
+					Labels:    getLabels(i, component),
+					OwnerReferences: []metav1.OwnerReference{
+						{UID: types.UID(fmt.Sprintf("uid-%d", i))},
+					},
+				},
+			}
+			assert.NilError(b, indexer.Add(deployment))
+		}
+	}
+
+	b.Run("labels", func(b *testing.B) {
+		for n := 0; n < b.N; n++ {
+			for i := 0; i < clusters; i++ {
+				var selector = labels.SelectorFromSet(getLabels(i, "taskmanager"))
+				var objs, err = indexer.ByIndex(cache.NamespaceIndex, "default")
+				assert.NilError(b, err)
+				var found = 0
+				for _, obj := range objs {
+					var deployment = obj.(runtime.Object).DeepCopyObject().(*appsv1.Deployment)
+					if selector.Matches(labels.Set(deployment.Labels)) {
+						found++
+					}
+				}
+				assert.Equal(b, found, 3)
+			}
+		}
+	})
+	b.Run("ownerIndex", func(b *testing.B) {
+		for n := 0; n < b.N; n++ {
+			for i := 0; i < clusters; i++ {
+				var objs, err = indexer.ByIndex(
+					OwnerUIDIndexField, fmt.Sprintf("uid-%d", i))
+				assert.NilError(b, err)
+				var found = 0
+				for _, obj := range objs {
+					var deployment = obj.(runtime.Object).DeepCopyObject().(*appsv1.Deployment)
+					if deployment.Labels["component"] == "taskmanager" {
+						found++
+					}
+				}
+				assert.Equal(b, found, 3)
+			}
+		}
+	})
+}
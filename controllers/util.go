@@ -0,0 +1,242 @@
+/*
+Copyright 2019 Google LLC.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+// Helpers for tooling built on top of the operator, which locate the
+// resources of a cluster by their labels or by the naming conventions of the
+// operator.
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	v1beta1 "github.com/googlecloudplatform/flink-operator/api/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// GetJobManagerPodName gets the name of the JobManager pod of the cluster,
+// e.g., for `kubectl logs`. When there are several JobManager pods, e.g.,
+// during a rolling update or with high availability, a ready pod is
+// preferred over a running one, and a running one over the others; pods being
+// deleted are ignored and ties are broken by the pod name.
+func GetJobManagerPodName(
+	ctx context.Context,
+	k8sClient client.Reader,
+	cluster *v1beta1.FlinkCluster) (string, error) {
+	var pods = corev1.PodList{}
+	var err = k8sClient.List(
+		ctx,
+		&pods,
+		client.InNamespace(cluster.Namespace),
+		client.MatchingLabels{
+			"cluster":   cluster.Name,
+			"app":       "flink",
+			"component": "jobmanager",
+		})
+	if err != nil {
+		return "", err
+	}
+
+	var candidates []corev1.Pod
+	for _, pod := range pods.Items {
+		if pod.ObjectMeta.DeletionTimestamp == nil {
+			candidates = append(candidates, pod)
+		}
+	}
+	if len(candidates) == 0 {
+		return "", fmt.Errorf(
+			"no JobManager pod found for cluster %v in namespace %v",
+			cluster.Name, cluster.Namespace)
+	}
+	sort.Slice(candidates, func(i, j int) bool {
+		var rankI, rankJ = getPodRank(&candidates[i]), getPodRank(&candidates[j])
+		if rankI != rankJ {
+			return rankI > rankJ
+		}
+		return candidates[i].Name < candidates[j].Name
+	})
+	return candidates[0].Name, nil
+}
+
+// Ranks a pod by how useful it is for reading logs: 2 if it is ready, 1 if
+// it is running, otherwise 0.
+func getPodRank(pod *corev1.Pod) int {
+	if pod.Status.Phase != corev1.PodRunning {
+		return 0
+	}
+	for _, condition := range pod.Status.Conditions {
+		if condition.Type == corev1.PodReady &&
+			condition.Status == corev1.ConditionTrue {
+			return 2
+		}
+	}
+	return 1
+}
+
+// ResourceNamer names the resources created for a cluster, i.e.,
+// `<prefix>-<component>`, where the prefix is the naming prefix of the
+// cluster if it is set, otherwise the cluster name.
+type ResourceNamer struct {
+	namespace string
+	prefix    string
+}
+
+// NewResourceNamer creates the namer of the resources of the cluster.
+func NewResourceNamer(cluster *v1beta1.FlinkCluster) ResourceNamer {
+	var prefix = cluster.Spec.NamingPrefix
+	if len(prefix) == 0 {
+		prefix = cluster.Name
+	}
+	return ResourceNamer{namespace: cluster.Namespace, prefix: prefix}
+}
+
+// Prefix gets the prefix of the resource names, which is also the prefix of
+// the names of the pods.
+func (namer ResourceNamer) Prefix() string {
+	return namer.prefix
+}
+
+// ConfigMapName gets the name of the ConfigMap of the Flink config.
+func (namer ResourceNamer) ConfigMapName() string {
+	return namer.prefix + "-configmap"
+}
+
+// JobManagerDeploymentName gets the name of the JobManager deployment.
+func (namer ResourceNamer) JobManagerDeploymentName() string {
+	return namer.prefix + "-jobmanager"
+}
+
+// JobManagerServiceName gets the name of the JobManager service.
+func (namer ResourceNamer) JobManagerServiceName() string {
+	return namer.prefix + "-jobmanager"
+}
+
+// JobManagerIngressName gets the name of the JobManager ingress.
+func (namer ResourceNamer) JobManagerIngressName() string {
+	return namer.prefix + "-jobmanager"
+}
+
+// TaskManagerDeploymentName gets the name of the TaskManager deployment.
+func (namer ResourceNamer) TaskManagerDeploymentName() string {
+	return namer.prefix + "-taskmanager"
+}
+
+// TaskManagerStatefulSetName gets the name of the TaskManager StatefulSet.
+func (namer ResourceNamer) TaskManagerStatefulSetName() string {
+	return namer.prefix + "-taskmanager"
+}
+
+// TaskManagerPoolDeploymentName gets the name of the deployment of a
+// TaskManager pool.
+func (namer ResourceNamer) TaskManagerPoolDeploymentName(poolName string) string {
+	return namer.prefix + "-taskmanager-" + poolName
+}
+
+// JobName gets the name of the job submitter.
+func (namer ResourceNamer) JobName() string {
+	return namer.prefix + "-job"
+}
+
+// VersionClusterName gets the name of the cluster of a version of traffic
+// splitting.
+func (namer ResourceNamer) VersionClusterName(version string) string {
+	return namer.prefix + "-version-" + version
+}
+
+// NetworkPolicyName gets the name of the network policy.
+func (namer ResourceNamer) NetworkPolicyName() string {
+	return namer.prefix + "-network-policy"
+}
+
+// GrafanaDashboardName gets the name of the Grafana dashboard ConfigMap,
+// which includes the namespace of the cluster because the ConfigMap might be
+// in a namespace shared by clusters of several namespaces.
+func (namer ResourceNamer) GrafanaDashboardName() string {
+	return namer.namespace + "-" + namer.prefix + "-grafana-dashboard"
+}
+
+// DiagnosticsJobName gets the name of the diagnostics bundle collector job.
+func (namer ResourceNamer) DiagnosticsJobName() string {
+	return namer.prefix + "-diagnostics"
+}
+
+// DiagnosticsServiceAccountName gets the name of the service account of the
+// diagnostics bundle collector.
+func (namer ResourceNamer) DiagnosticsServiceAccountName() string {
+	return namer.prefix + "-diagnostics"
+}
+
+// DiagnosticsRoleName gets the name of the Role of the diagnostics bundle
+// collector.
+func (namer ResourceNamer) DiagnosticsRoleName() string {
+	return namer.prefix + "-diagnostics"
+}
+
+// DiagnosticsRoleBindingName gets the name of the RoleBinding of the
+// diagnostics bundle collector.
+func (namer ResourceNamer) DiagnosticsRoleBindingName() string {
+	return namer.prefix + "-diagnostics"
+}
+
+// RoleName gets the name of the Role of the created service account.
+func (namer ResourceNamer) RoleName() string {
+	return namer.prefix + "-flink"
+}
+
+// RoleBindingName gets the name of the RoleBinding of the created service
+// account.
+func (namer ResourceNamer) RoleBindingName() string {
+	return namer.prefix + "-flink"
+}
+
+// VirtualServiceName gets the name of the VirtualService of traffic
+// splitting.
+func (namer ResourceNamer) VirtualServiceName() string {
+	return namer.prefix + "-traffic-split"
+}
+
+// NativeClusterID gets the cluster ID of the application cluster deployed by
+// Flink in native mode, which is also the name of its JobManager deployment.
+func (namer ResourceNamer) NativeClusterID() string {
+	return namer.prefix
+}
+
+// HAClusterID gets the cluster ID of Flink Kubernetes high availability,
+// which prefixes the names of the leader ConfigMaps created by Flink.
+func (namer ResourceNamer) HAClusterID() string {
+	return namer.prefix
+}
+
+// HAConfigMapName gets the name of the ConfigMap holding the leaders of the
+// components with Flink 1.15 or later.
+func (namer ResourceNamer) HAConfigMapName() string {
+	return namer.HAClusterID() + "-cluster-config-map"
+}
+
+// HARESTServerLeaderConfigMapName gets the name of the ConfigMap holding the
+// leader of the REST server with Flink 1.12 to 1.14.
+func (namer ResourceNamer) HARESTServerLeaderConfigMapName() string {
+	return namer.HAClusterID() + "-restserver-leader"
+}
+
+// NativeRESTServiceName gets the name of the REST service created by Flink in
+// native mode.
+func (namer ResourceNamer) NativeRESTServiceName() string {
+	return namer.prefix + "-rest"
+}
@@ -0,0 +1,111 @@
+/*
+Copyright 2019 Google LLC.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"testing"
+
+	v1beta1 "github.com/googlecloudplatform/flink-operator/api/v1beta1"
+	"gotest.tools/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestGetJobManagerPodName(t *testing.T) {
+	var jmLabels = map[string]string{
+		"cluster": "mycluster", "app": "flink", "component": "jobmanager"}
+	var newPod = func(
+		name string,
+		labels map[string]string,
+		phase corev1.PodPhase,
+		ready corev1.ConditionStatus) *corev1.Pod {
+		return &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      name,
+				Namespace: "default",
+				Labels:    labels,
+			},
+			Status: corev1.PodStatus{
+				Phase: phase,
+				Conditions: []corev1.PodCondition{
+					{Type: corev1.PodReady, Status: ready},
+				},
+			},
+		}
+	}
+	var cluster = &v1beta1.FlinkCluster{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "mycluster"},
+	}
+	var k8sClient = fake.NewFakeClientWithScheme(
+		scheme.Scheme,
+		newPod("mycluster-jobmanager-a", jmLabels,
+			corev1.PodPending, corev1.ConditionFalse),
+		newPod("mycluster-jobmanager-c", jmLabels,
+			corev1.PodRunning, corev1.ConditionTrue),
+		newPod("mycluster-jobmanager-b", jmLabels,
+			corev1.PodRunning, corev1.ConditionFalse),
+		newPod("mycluster-taskmanager-a",
+			map[string]string{
+				"cluster": "mycluster", "app": "flink", "component": "taskmanager"},
+			corev1.PodRunning, corev1.ConditionTrue))
+
+	var name, err = GetJobManagerPodName(context.Background(), k8sClient, cluster)
+	assert.NilError(t, err)
+	assert.Equal(t, name, "mycluster-jobmanager-c")
+
+	cluster.Name = "other"
+	_, err = GetJobManagerPodName(context.Background(), k8sClient, cluster)
+	var expectedErr = "no JobManager pod found for cluster other in namespace default"
+	assert.Assert(t, err != nil, "err is not expected to be nil")
+	assert.Equal(t, err.Error(), expectedErr)
+}
+
+func TestResourceNamer(t *testing.T) {
+	var cluster = &v1beta1.FlinkCluster{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "mycluster"},
+	}
+
+	// Named after the cluster by default.
+	var namer = NewResourceNamer(cluster)
+	assert.Equal(t, namer.Prefix(), "mycluster")
+	assert.Equal(t, namer.JobManagerDeploymentName(), "mycluster-jobmanager")
+	assert.Equal(t, namer.JobManagerServiceName(), "mycluster-jobmanager")
+	assert.Equal(t, namer.ConfigMapName(), "mycluster-configmap")
+	assert.Equal(
+		t, namer.TaskManagerPoolDeploymentName("highmem"),
+		"mycluster-taskmanager-highmem")
+	assert.Equal(t, namer.JobName(), "mycluster-job")
+	assert.Equal(
+		t, namer.GrafanaDashboardName(), "default-mycluster-grafana-dashboard")
+
+	// The naming prefix takes precedence.
+	cluster.Spec.NamingPrefix = "tenant1-mc"
+	namer = NewResourceNamer(cluster)
+	assert.Equal(t, namer.JobManagerDeploymentName(), "tenant1-mc-jobmanager")
+	assert.Equal(t, namer.TaskManagerDeploymentName(), "tenant1-mc-taskmanager")
+	assert.Equal(t, namer.VersionClusterName("b"), "tenant1-mc-version-b")
+	assert.Equal(t, namer.RoleName(), "tenant1-mc-flink")
+	assert.Equal(t, namer.HAConfigMapName(), "tenant1-mc-cluster-config-map")
+	assert.Equal(
+		t, namer.HARESTServerLeaderConfigMapName(),
+		"tenant1-mc-restserver-leader")
+	assert.Equal(
+		t, namer.GrafanaDashboardName(), "default-tenant1-mc-grafana-dashboard")
+}
@@ -18,16 +18,26 @@ package main
 
 import (
 	"flag"
+	"fmt"
+	"io/ioutil"
+	"net/http"
 	"os"
+	"strings"
+	"time"
 
 	v1beta1 "github.com/googlecloudplatform/flink-operator/api/v1beta1"
 	"github.com/googlecloudplatform/flink-operator/controllers"
 	appsv1 "k8s.io/api/apps/v1"
 	batchv1 "k8s.io/api/batch/v1"
+	batchv1beta1 "k8s.io/api/batch/v1beta1"
 	corev1 "k8s.io/api/core/v1"
 	extensionsv1beta1 "k8s.io/api/extensions/v1beta1"
+	networkingv1 "k8s.io/api/networking/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	schedulingv1 "k8s.io/api/scheduling/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	_ "k8s.io/client-go/plugin/pkg/client/auth/gcp"
+	"k8s.io/client-go/util/workqueue"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/log/zap"
 	// +kubebuilder:scaffold:imports
@@ -41,48 +51,281 @@ var (
 func init() {
 	appsv1.AddToScheme(scheme)
 	batchv1.AddToScheme(scheme)
+	batchv1beta1.AddToScheme(scheme)
 	corev1.AddToScheme(scheme)
 	v1beta1.AddToScheme(scheme)
 	extensionsv1beta1.AddToScheme(scheme)
+	networkingv1.AddToScheme(scheme)
+	rbacv1.AddToScheme(scheme)
+	schedulingv1.AddToScheme(scheme)
 	// +kubebuilder:scaffold:scheme
 }
 
 func main() {
 	var metricsAddr string
+	var healthProbeAddr string
 	var enableLeaderElection bool
 	var watchNamespace string
+	var watchNamespaces string
+	var clusterScopedRBAC bool
+	var statusDebounceWindow time.Duration
+	var statusBatchInterval time.Duration
+	var logJSON bool
+	var quotaRequeueInterval time.Duration
+	var flinkAPITimeout time.Duration
+	var flinkAPIMaxRetries int
+	var jobManagerMetricsInterval int
+	var jobManagerMemoryPressureRatio float64
+	var metricsPollInterval time.Duration
+	var requeueAfter string
+	var requeueInitialInterval time.Duration
+	var requeueMaxInterval time.Duration
+	var maxConcurrentReconciles int
+	var retryBaseDelay time.Duration
+	var retryMaxDelay time.Duration
+	var dryRun bool
+	var auditWebhookURL string
+	var grafanaDashboardNamespaces string
+	var webhookAllowedHosts string
 	flag.StringVar(&metricsAddr, "metrics-addr", ":8080", "The address the metric endpoint binds to.")
-	flag.BoolVar(&enableLeaderElection, "enable-leader-election", false,
+	flag.StringVar(
+		&healthProbeAddr,
+		"health-probe-addr",
+		":8081",
+		"The address the /healthz and /readyz probe endpoints bind to.")
+	flag.BoolVar(&enableLeaderElection, "enable-leader-election", true,
 		"Enable leader election for controller manager. Enabling this will ensure there is only one active controller manager.")
 	flag.StringVar(
 		&watchNamespace,
 		"watch-namespace",
 		"",
-		"Watch custom resources in the namespace, ignore other namespaces. If empty, all namespaces will be watched.")
+		"Deprecated: use --watch-namespaces instead.")
+	flag.StringVar(
+		&watchNamespaces,
+		"watch-namespaces",
+		"",
+		"Comma-separated list of namespaces to watch custom resources in, ignore other namespaces. If empty, all namespaces will be watched.")
+	flag.BoolVar(
+		&clusterScopedRBAC,
+		"cluster-scoped-rbac",
+		true,
+		"Whether the operator is granted its permissions by a ClusterRole. If false, it must be granted a Role with the same rules in each of --watch-namespaces, which are then required, and namespace label changes are not watched. Reading namespaces (inheritNamespaceLabels) and priority classes (priorityClassName) still needs a ClusterRole, as they are cluster-scoped.")
+	flag.DurationVar(
+		&statusDebounceWindow,
+		"status-debounce-window",
+		10*time.Second,
+		"Skip status changes of a cluster which only flap the JobManager or TaskManagers between NotReady and Ready within the window after a status write, the last change is written when the window ends. 0 disables it.")
+	flag.DurationVar(
+		&statusBatchInterval,
+		"status-batch-interval",
+		10*time.Second,
+		"Write the status of a cluster at most once per interval, unless its state changes, which is written immediately. The last change is written when the interval ends. 0 disables it.")
+	flag.BoolVar(
+		&logJSON,
+		"log-json",
+		false,
+		"Write logs as JSON, one object per line, instead of the human readable development format.")
+	flag.DurationVar(
+		&quotaRequeueInterval,
+		"quota-requeue-interval",
+		30*time.Second,
+		"The interval of checking again whether a cluster which exceeds the resource quota of its namespace can be created.")
+	flag.DurationVar(
+		&flinkAPITimeout,
+		"flink-api-timeout",
+		30*time.Second,
+		"The timeout of each request to the Flink REST API of the JobManagers.")
+	flag.IntVar(
+		&flinkAPIMaxRetries,
+		"flink-api-max-retries",
+		2,
+		"The maximum number of retries of a failed read from the Flink REST API, e.g., when the JobManager is restarting.")
+	flag.IntVar(
+		&jobManagerMetricsInterval,
+		"jobmanager-metrics-interval",
+		10,
+		"Sample the heap and GC metrics of the JobManager of a running cluster into its status once every this many reconciles. 0 disables it.")
+	flag.Float64Var(
+		&jobManagerMemoryPressureRatio,
+		"jobmanager-memory-pressure-ratio",
+		0,
+		"Flag the JobManager NotReady with reason HighMemoryPressure when its heap usage stays above this ratio of the maximum heap, e.g., 0.9. 0 disables it.")
+	flag.DurationVar(
+		&metricsPollInterval,
+		"metrics-poll-interval",
+		30*time.Second,
+		"Poll the throughput of the running job of a cluster and the backpressure of its vertices into its status at most once per this interval. 0 disables it.")
+	flag.StringVar(
+		&requeueAfter,
+		"requeue-after",
+		"",
+		"Fixed intervals of polling the clusters in the given states, e.g., \"Running=60s,Reconciling=5s\". By default, clusters in stable states are polled every 60s, and clusters in transitional states with a backoff.")
+	flag.DurationVar(
+		&requeueInitialInterval,
+		"requeue-initial-interval",
+		2*time.Second,
+		"The interval of polling a cluster which entered a transitional state without a fixed interval, which doubles with each consecutive poll in the state.")
+	flag.DurationVar(
+		&requeueMaxInterval,
+		"requeue-max-interval",
+		30*time.Second,
+		"The upper bound of the interval of polling a cluster in a transitional state without a fixed interval.")
+	flag.IntVar(
+		&maxConcurrentReconciles,
+		"max-concurrent-reconciles",
+		1,
+		"The maximum number of clusters reconciled concurrently.")
+	flag.DurationVar(
+		&retryBaseDelay,
+		"reconcile-retry-base-delay",
+		5*time.Millisecond,
+		"The delay of retrying the first failed reconcile of a cluster, which doubles with each consecutive failure.")
+	flag.DurationVar(
+		&retryMaxDelay,
+		"reconcile-retry-max-delay",
+		1000*time.Second,
+		"The upper bound of the delay of retrying a failed reconcile of a cluster.")
+	flag.BoolVar(
+		&dryRun,
+		"dry-run",
+		false,
+		"Run the reconciles without applying their changes, which are only logged with the [DRY-RUN] prefix and summarized in an event on each cluster. It can't be used with leader election, which it disables by default.")
+	flag.StringVar(
+		&auditWebhookURL,
+		"audit-webhook-url",
+		"",
+		"POST an audit event as JSON to the URL for each create, update, patch or delete of a child resource of a cluster by the operator. The events are sent in the background and retried. If empty, the changes are not audited.")
+	flag.StringVar(
+		&grafanaDashboardNamespaces,
+		"grafana-dashboard-namespaces",
+		"",
+		"Comma-separated list of namespaces the Grafana dashboards of the clusters may be created in, besides the namespaces of the clusters themselves.")
+	flag.StringVar(
+		&webhookAllowedHosts,
+		"webhook-allowed-hosts",
+		"",
+		"Comma-separated list of hosts the success webhooks of the clusters may target at loopback, private and link-local addresses, e.g., services in the cluster. Other hosts at such addresses are rejected.")
 	flag.Parse()
 
-	ctrl.SetLogger(zap.Logger(true))
+	ctrl.SetLogger(zap.Logger(!logJSON))
+
+	requeueAfterByState, err := controllers.ParseRequeueAfter(requeueAfter)
+	if err != nil {
+		setupLog.Error(err, "Invalid flag", "flag", "requeue-after")
+		os.Exit(1)
+	}
+
+	if dryRun {
+		var leaderElectionSet = false
+		flag.Visit(func(f *flag.Flag) {
+			if f.Name == "enable-leader-election" {
+				leaderElectionSet = true
+			}
+		})
+		if leaderElectionSet && enableLeaderElection {
+			setupLog.Error(
+				fmt.Errorf("dry-run can't be used with leader election"),
+				"Invalid flag",
+				"flag", "dry-run")
+			os.Exit(1)
+		}
+		enableLeaderElection = false
+		setupLog.Info("Running in dry-run mode, no changes will be applied")
+	}
 
-	mgr, err := ctrl.NewManager(ctrl.GetConfigOrDie(), ctrl.Options{
-		Scheme:             scheme,
-		MetricsBindAddress: metricsAddr,
-		LeaderElection:     enableLeaderElection,
-	})
+	var namespaces = controllers.ParseWatchNamespaces(
+		watchNamespace + "," + watchNamespaces)
+	if !clusterScopedRBAC && len(namespaces) == 0 {
+		setupLog.Error(
+			fmt.Errorf("watch-namespaces is required without cluster-scoped RBAC"),
+			"Invalid flag",
+			"flag", "cluster-scoped-rbac")
+		os.Exit(1)
+	}
+
+	var options = ctrl.Options{
+		Scheme:                  scheme,
+		MetricsBindAddress:      metricsAddr,
+		LeaderElection:          enableLeaderElection,
+		LeaderElectionID:        "flink-operator-lock",
+		LeaderElectionNamespace: getLeaderElectionNamespace(),
+	}
+	controllers.SetCacheNamespaces(&options, namespaces)
+	setupLog.Info("Watching namespaces", "namespaces", namespaces)
+
+	mgr, err := ctrl.NewManager(ctrl.GetConfigOrDie(), options)
 	if err != nil {
 		setupLog.Error(err, "Unable to start manager")
 		os.Exit(1)
 	}
 
+	// Index the child resources of the clusters by their owner, so that the
+	// observer doesn't filter all the objects of the namespace by labels.
+	for _, obj := range []runtime.Object{
+		&batchv1.Job{}, &appsv1.Deployment{}, &corev1.Service{}} {
+		err = mgr.GetFieldIndexer().IndexField(
+			obj, controllers.OwnerUIDIndexField, controllers.GetOwnerUIDs)
+		if err != nil {
+			setupLog.Error(err, "Unable to index child resources")
+			os.Exit(1)
+		}
+	}
+
+	var auditLogger controllers.AuditLogger = controllers.NoopAuditLogger{}
+	if len(auditWebhookURL) > 0 {
+		auditLogger = &controllers.WebhookAuditLogger{
+			URL:    auditWebhookURL,
+			Logger: ctrl.Log.WithName("audit"),
+		}
+	}
+
 	err = (&controllers.FlinkClusterReconciler{
-		Client:         mgr.GetClient(),
-		Log:            ctrl.Log.WithName("controllers").WithName("FlinkCluster"),
-		WatchNamespace: watchNamespace,
+		Client:               mgr.GetClient(),
+		Log:                  ctrl.Log.WithName("controllers").WithName("FlinkCluster"),
+		WatchNamespaces:      namespaces,
+		NamespaceScopedRBAC:  !clusterScopedRBAC,
+		OperatorNamespace:    os.Getenv("OPERATOR_NAMESPACE"),
+		StatusDebounceWindow: statusDebounceWindow,
+		StatusBatchInterval:  statusBatchInterval,
+		QuotaRequeueInterval: quotaRequeueInterval,
+		FlinkAPITimeout:      flinkAPITimeout,
+		FlinkAPIMaxRetries:   flinkAPIMaxRetries,
+
+		JobManagerMetricsInterval:     jobManagerMetricsInterval,
+		JobManagerMemoryPressureRatio: jobManagerMemoryPressureRatio,
+		MetricsPollInterval:           metricsPollInterval,
+		RequeuePolicy: controllers.RequeuePolicy{
+			RequeueAfter:    requeueAfterByState,
+			InitialInterval: requeueInitialInterval,
+			MaxInterval:     requeueMaxInterval,
+		},
+		MaxConcurrentReconciles: maxConcurrentReconciles,
+		RetryRateLimiter: workqueue.NewItemExponentialFailureRateLimiter(
+			retryBaseDelay, retryMaxDelay),
+		DryRun:                 dryRun,
+		AuditLogger:            auditLogger,
+		OperatorServiceAccount: os.Getenv("OPERATOR_SERVICE_ACCOUNT"),
+		GrafanaDashboardNamespaces: controllers.ParseWatchNamespaces(
+			grafanaDashboardNamespaces),
+		WebhookAllowedHosts: controllers.ParseWatchNamespaces(
+			webhookAllowedHosts),
 	}).SetupWithManager(mgr)
 	if err != nil {
 		setupLog.Error(err, "Unable to create controller", "controller", "FlinkCluster")
 		os.Exit(1)
 	}
 
+	err = (&controllers.FlinkClusterSummaryReconciler{
+		Client:          mgr.GetClient(),
+		Log:             ctrl.Log.WithName("controllers").WithName("FlinkClusterSummary"),
+		WatchNamespaces: namespaces,
+		DryRun:          dryRun,
+	}).SetupWithManager(mgr)
+	if err != nil {
+		setupLog.Error(err, "Unable to create controller", "controller", "FlinkClusterSummary")
+		os.Exit(1)
+	}
+
 	// Set up webhooks for the custom resource.
 	// Disable it with `FLINK_OPERATOR_ENABLE_WEBHOOKS=false` when we run locally.
 	if os.Getenv("FLINK_OPERATOR_ENABLE_WEBHOOKS") != "false" {
@@ -91,13 +334,52 @@ func main() {
 			setupLog.Error(err, "Unable to setup webhooks", "webhook", "FlinkCluster")
 			os.Exit(1)
 		}
+		err = (&v1beta1.FlinkClusterTemplate{}).SetupWebhookWithManager(mgr)
+		if err != nil {
+			setupLog.Error(
+				err, "Unable to setup webhooks", "webhook", "FlinkClusterTemplate")
+			os.Exit(1)
+		}
 	}
 
 	// +kubebuilder:scaffold:builder
 
+	// Serve the probes whether the replica is the leader or not, so that a
+	// standby replica is ready, e.g., for a rolling update to proceed while
+	// the old replica still holds the lease.
+	var leaderTracker = &controllers.LeaderTracker{}
+	err = mgr.Add(leaderTracker)
+	if err != nil {
+		setupLog.Error(err, "Unable to add leader tracker")
+		os.Exit(1)
+	}
+	go func() {
+		var err = http.ListenAndServe(
+			healthProbeAddr, controllers.NewHealthProbeHandler(leaderTracker))
+		if err != nil {
+			setupLog.Error(err, "Problem serving health probes")
+			os.Exit(1)
+		}
+	}()
+
 	setupLog.Info("Starting manager")
 	if err := mgr.Start(ctrl.SetupSignalHandler()); err != nil {
 		setupLog.Error(err, "Problem running manager")
 		os.Exit(1)
 	}
 }
+
+// Gets the namespace of the leader lease, which is the namespace the operator
+// runs in, or "default" when it runs outside of a cluster, e.g., with
+// `make run`.
+func getLeaderElectionNamespace() string {
+	if namespace := os.Getenv("OPERATOR_NAMESPACE"); len(namespace) > 0 {
+		return namespace
+	}
+	var namespace, err = ioutil.ReadFile(
+		"/var/run/secrets/kubernetes.io/serviceaccount/namespace")
+	if err == nil && len(namespace) > 0 {
+		return strings.TrimSpace(string(namespace))
+	}
+	return "default"
+}